@@ -22,13 +22,18 @@ package main
 
 import (
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/wcrum/labby/internal/auth"
 	"github.com/wcrum/labby/internal/handlers"
 	"github.com/wcrum/labby/internal/lab"
+	"github.com/wcrum/labby/internal/models"
+	"github.com/wcrum/labby/internal/services"
 
 	_ "github.com/wcrum/labby/docs" // This will be generated
 
@@ -39,6 +44,13 @@ import (
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
+// defaultJWTSecret is only acceptable for local development
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
+// defaultBootstrapAdminEmail is the admin created when BOOTSTRAP_ADMIN_EMAIL is not set. Every
+// instance left at the default shares this predictable account.
+const defaultBootstrapAdminEmail = "admin@spectrocloud.com"
+
 func main() {
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
@@ -46,17 +58,23 @@ func main() {
 	}
 
 	// Get configuration from environment
-	jwtSecret := getEnv("JWT_SECRET", "your-secret-key-change-in-production")
+	jwtSecret := getEnv("JWT_SECRET", defaultJWTSecret)
 	port := getEnv("PORT", "8080")
+	// Debug by default so go run works on a clean checkout; the container image sets release
+	ginMode := getEnv("GIN_MODE", gin.DebugMode)
+
+	// Tokens signed with the well-known default secret can be forged by anyone
+	if ginMode == gin.ReleaseMode && jwtSecret == defaultJWTSecret {
+		log.Fatal("JWT_SECRET must be set when running in release mode (set GIN_MODE=debug for local development)")
+	}
 
 	// Initialize services
 	authService := auth.NewService(jwtSecret)
+	authService.SetTokenIssuer(getEnv("JWT_ISSUER", auth.DefaultTokenIssuer), getEnv("JWT_AUDIENCE", auth.DefaultTokenAudience))
 	labService := lab.NewService()
 
-	// Load lab templates
-	if err := labService.LoadTemplates("./templates"); err != nil {
-		log.Printf("Warning: Failed to load templates: %v", err)
-	}
+	// Users who log in without an invite join the organization that opted in to auto-assigning their email domain
+	authService.SetDomainOrganizationLookup(services.NewOrganizationService().FindOrganizationForEmail)
 
 	// Load service configurations
 	log.Printf("Loading service configurations from ./service-configs")
@@ -74,33 +92,174 @@ func main() {
 		log.Printf("Successfully loaded service limits")
 	}
 
+	// Load lab templates once the service configs they reference are known
+	if err := labService.LoadTemplates("./templates"); err != nil {
+		log.Printf("Warning: Failed to load templates: %v", err)
+	}
+
 	// Enrich templates with service type information
 	log.Printf("Enriching templates with service type information")
 	labService.EnrichTemplatesWithServiceTypes()
 
 	handler := handlers.NewHandler(authService, labService)
 
-	// Create a default admin user
-	adminUser, err := authService.CreateAdminUser("admin@spectrocloud.com", "Admin User")
-	if err != nil {
-		log.Printf("Failed to create admin user: %v", err)
+	// Renewed invites can be emailed to their invitee (only when SMTP_HOST is set)
+	handler.SetInviteEmail(services.NewEmailServiceFromEnv(), getEnv("FRONTEND_URL", "http://localhost:3000"))
+
+	// Create the bootstrap admin user
+	bootstrapAdmin(authService)
+
+	// Configure per-service setup timeouts
+	setupTimeouts := lab.DefaultServiceSetupTimeouts()
+	if timeout, err := time.ParseDuration(getEnv("SERVICE_SETUP_TIMEOUT", "10m")); err == nil {
+		setupTimeouts.Default = timeout
+	} else {
+		log.Printf("Invalid SERVICE_SETUP_TIMEOUT, using default: %v", err)
+	}
+	if perType, err := lab.ParseServiceSetupTimeouts(getEnv("SERVICE_SETUP_TIMEOUTS", "")); err == nil {
+		setupTimeouts.PerType = perType
+	} else {
+		log.Printf("Invalid SERVICE_SETUP_TIMEOUTS, ignoring per-service timeouts: %v", err)
+	}
+	labService.SetServiceSetupTimeouts(setupTimeouts)
+
+	// Configure how many services of a lab are provisioned concurrently
+	if concurrency, err := strconv.Atoi(getEnv("PROVISIONING_CONCURRENCY", "3")); err == nil && concurrency > 0 {
+		labService.SetProvisioningConcurrency(concurrency)
+	} else {
+		log.Printf("Invalid PROVISIONING_CONCURRENCY, using default: %d", lab.DefaultProvisioningConcurrency)
+	}
+
+	// Configure how long stopped labs keep their resources and can be resumed (0 to clean up on stop)
+	if gracePeriod, err := time.ParseDuration(getEnv("LAB_STOP_GRACE_PERIOD", "1h")); err == nil && gracePeriod >= 0 {
+		labService.SetStopGracePeriod(gracePeriod)
+	} else {
+		log.Printf("Invalid LAB_STOP_GRACE_PERIOD, using default: %v", lab.DefaultStopGracePeriod)
+	}
+
+	// Configure how long ready labs may go unused before they expire (0 to only expire labs when their duration ends)
+	if idleTimeout, err := time.ParseDuration(getEnv("LAB_IDLE_TIMEOUT", "0")); err == nil && idleTimeout >= 0 {
+		labService.SetIdleTimeout(idleTimeout)
+	} else {
+		log.Printf("Invalid LAB_IDLE_TIMEOUT, idle labs are not expired")
+	}
+
+	// Configure the hard cap on how long any lab may run, in minutes (0 for no cap beyond the duration limits)
+	if maxLifetime, err := strconv.Atoi(getEnv("MAX_LAB_LIFETIME_MINUTES", "0")); err == nil && maxLifetime >= 0 {
+		labService.SetMaxLabLifetime(time.Duration(maxLifetime) * time.Minute)
+	} else {
+		log.Printf("Invalid MAX_LAB_LIFETIME_MINUTES, lab lifetimes are not capped")
+	}
+
+	// Configure how many labs are provisioned at the same time, queueing the rest (0 for no limit)
+	if limit, err := strconv.Atoi(getEnv("MAX_CONCURRENT_PROVISIONS", "10")); err == nil && limit >= 0 {
+		labService.SetMaxConcurrentProvisions(limit)
 	} else {
-		log.Printf("Created admin user: %s (%s)", adminUser.Email, adminUser.Role)
+		log.Printf("Invalid MAX_CONCURRENT_PROVISIONS, using default: %d", lab.DefaultMaxConcurrentProvisions)
 	}
 
+	// Configure lab ready/failure notifications (email is only sent when SMTP_HOST is set)
+	labService.SetNotifier(lab.NewNotifier(services.NewEmailServiceFromEnv(), getEnv("FRONTEND_URL", "http://localhost:3000"), func(userID string) (string, error) {
+		user, err := authService.GetUserByID(userID)
+		if err != nil {
+			return "", err
+		}
+		return user.Email, nil
+	}))
+
+	// Labs use the service config overrides of their owner's organization
+	labService.SetOrganizationResolver(func(userID string) (string, error) {
+		user, err := authService.GetUserByID(userID)
+		if err != nil || user.OrganizationID == nil {
+			return "", err
+		}
+		return *user.OrganizationID, nil
+	})
+
 	// Start cleanup scheduler
-	labService.StartCleanupScheduler()
+	cleanupConfig := lab.DefaultCleanupSchedulerConfig()
+	if interval, err := time.ParseDuration(getEnv("CLEANUP_INTERVAL", "5m")); err == nil {
+		cleanupConfig.Interval = interval
+	} else {
+		log.Printf("Invalid CLEANUP_INTERVAL, using default: %v", err)
+	}
+	if jitter, err := time.ParseDuration(getEnv("CLEANUP_JITTER", "30s")); err == nil {
+		cleanupConfig.Jitter = jitter
+	} else {
+		log.Printf("Invalid CLEANUP_JITTER, using default: %v", err)
+	}
+	if batchDelay, err := time.ParseDuration(getEnv("CLEANUP_BATCH_DELAY", "2s")); err == nil {
+		cleanupConfig.BatchDelay = batchDelay
+	} else {
+		log.Printf("Invalid CLEANUP_BATCH_DELAY, using default: %v", err)
+	}
+	cleanupConfig.BatchSize = getEnvInt("CLEANUP_BATCH_SIZE", cleanupConfig.BatchSize)
+	labService.StartCleanupScheduler(cleanupConfig)
+
+	// Start lab scheduler for labs created with a future start time
+	if interval, err := time.ParseDuration(getEnv("LAB_SCHEDULER_INTERVAL", "30s")); err == nil {
+		labService.StartLabScheduler(interval)
+	} else {
+		log.Printf("Invalid LAB_SCHEDULER_INTERVAL, using default: %v", err)
+		labService.StartLabScheduler(lab.DefaultLabSchedulerInterval)
+	}
+
+	// Warn lab owners before their labs end
+	expiryWarningThresholds, err := lab.ParseExpiryWarningThresholds(getEnv("LAB_EXPIRY_WARNINGS", "15m,5m"))
+	if err != nil {
+		log.Printf("Invalid LAB_EXPIRY_WARNINGS, using default: %v", err)
+		expiryWarningThresholds = lab.DefaultExpiryWarningThresholds
+	}
+	if interval, err := time.ParseDuration(getEnv("LAB_EXPIRY_WARNING_INTERVAL", "1m")); err == nil {
+		labService.StartExpiryWarnings(expiryWarningThresholds, interval)
+	} else {
+		log.Printf("Invalid LAB_EXPIRY_WARNING_INTERVAL, using default: %v", err)
+		labService.StartExpiryWarnings(expiryWarningThresholds, lab.DefaultExpiryWarningInterval)
+	}
+
+	// Expire invites nobody looks up again and purge long-finished ones (INVITE_PURGE_AFTER 0 keeps them)
+	inviteSweepConfig := services.DefaultInviteSweepConfig()
+	if interval, err := time.ParseDuration(getEnv("INVITE_SWEEP_INTERVAL", "1h")); err == nil {
+		inviteSweepConfig.Interval = interval
+	} else {
+		log.Printf("Invalid INVITE_SWEEP_INTERVAL, using default: %v", err)
+	}
+	if purgeAfter, err := time.ParseDuration(getEnv("INVITE_PURGE_AFTER", "0")); err == nil && purgeAfter >= 0 {
+		inviteSweepConfig.PurgeAfter = purgeAfter
+	} else {
+		log.Printf("Invalid INVITE_PURGE_AFTER, invites are not purged")
+	}
+	services.NewOrganizationService().StartInviteSweeper(inviteSweepConfig)
+
+	// Start orphaned resource reconciler (dry-run sweeps only, real sweeps are triggered by admins)
+	reconciler := labService.GetReconciler()
+	if gracePeriod, err := time.ParseDuration(getEnv("RECONCILE_GRACE_PERIOD", "2h")); err == nil {
+		reconciler.SetGracePeriod(gracePeriod)
+	} else {
+		log.Printf("Invalid RECONCILE_GRACE_PERIOD, using default: %v", err)
+	}
+	if interval, err := time.ParseDuration(getEnv("RECONCILE_INTERVAL", "1h")); err == nil {
+		reconciler.Start(interval)
+	} else {
+		log.Printf("Invalid RECONCILE_INTERVAL, reconciler disabled: %v", err)
+	}
 
 	// Set up Gin router
-	gin.SetMode(gin.ReleaseMode)
+	gin.SetMode(ginMode)
 	router := gin.Default()
 
-	// Add CORS middleware for development
+	// Only trust X-Forwarded-For from configured proxies, so clients can't spoof the IP rate limits are keyed on
+	if err := router.SetTrustedProxies(getEnvList("TRUSTED_PROXIES", nil)); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// Add CORS middleware, allowing only the configured frontend origins
 	corsMiddleware := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000", "http://127.0.0.1:3000", "https://tunnel.wcrum.dev"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		AllowCredentials: true,
+		AllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS", []string{"http://localhost:3000", "http://127.0.0.1:3000"}),
+		AllowedMethods:   getEnvList("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
+		AllowedHeaders:   []string{"Origin", "Content-Type", "Accept", "Authorization", "If-None-Match", "If-Modified-Since", "If-Match"},
+		ExposedHeaders:   []string{"ETag", "Last-Modified"},
+		AllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", true),
 	})
 
 	router.Use(func(c *gin.Context) {
@@ -121,7 +280,7 @@ func main() {
 	router.NoRoute(func(c *gin.Context) {
 		// Don't serve static files for API routes
 		if strings.HasPrefix(c.Request.URL.Path, "/api/") {
-			c.JSON(404, gin.H{"error": "API endpoint not found"})
+			c.JSON(http.StatusNotFound, handlers.ErrorResponse{Error: &models.APIError{Code: models.CodeNotFound, Message: "API endpoint not found"}})
 			return
 		}
 
@@ -149,18 +308,31 @@ func main() {
 		c.File("./static/404.html")
 	})
 
-	// Health check endpoint
+	// Health check endpoints. Container health checks use /health/live, which makes no outbound
+	// calls, so an outage of a backing service never gets a healthy backend restarted.
 	router.GET("/health", handler.HealthCheck)
+	router.GET("/health/ready", handler.HealthCheck)
+	router.GET("/health/live", handler.LivenessCheck)
 
 	// Swagger documentation
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// Rate limiters for sensitive endpoints (requests per minute and burst size)
+	authRateLimiter := handlers.NewRateLimiter(
+		getEnvInt("RATE_LIMIT_AUTH_PER_MINUTE", 10),
+		getEnvInt("RATE_LIMIT_AUTH_BURST", 5),
+	)
+	labRateLimiter := handlers.NewRateLimiter(
+		getEnvInt("RATE_LIMIT_LABS_PER_MINUTE", 5),
+		getEnvInt("RATE_LIMIT_LABS_BURST", 3),
+	)
+
 	// Public routes
-	router.POST("/api/auth/login", handler.Login)
+	router.POST("/api/auth/login", authRateLimiter.Middleware(), handler.Login)
 
 	// Public invite routes
 	router.GET("/api/invites/:id", handler.GetInvite)
-	router.POST("/api/invites/:id/accept", handler.AcceptInvite)
+	router.POST("/api/invites/:id/accept", authRateLimiter.Middleware(), handler.AcceptInvite)
 
 	// Protected routes
 	protected := router.Group("/api")
@@ -168,68 +340,166 @@ func main() {
 	{
 		// Auth routes
 		protected.GET("/auth/me", handler.GetCurrentUser)
+		protected.POST("/auth/logout", handler.Logout)
+
+		// Personal access token routes
+		protected.GET("/tokens", handler.GetAccessTokens)
+		protected.POST("/tokens", handler.NoImpersonation(), handler.CreateAccessToken)
+		protected.DELETE("/tokens/:id", handler.NoImpersonation(), handler.RevokeAccessToken)
 
 		// User routes
 		protected.GET("/user/organization", handler.GetUserOrganization)
 
 		// Lab routes
-		protected.POST("/labs", handler.CreateLab)
+		protected.POST("/labs", labRateLimiter.Middleware(), handler.CreateLab)
 		protected.GET("/labs", handler.GetUserLabs)
+		protected.GET("/labs/scheduled", handler.GetScheduledLabs)
+		protected.GET("/labs/shared", handler.GetSharedLabs)
 		protected.GET("/labs/:id", handler.GetLab)
 		protected.GET("/labs/:id/progress", handler.GetLabProgress)
+		protected.POST("/labs/:id/heartbeat", handler.LabHeartbeat)
+		protected.GET("/labs/:id/diagnostics", handler.GetLabDiagnostics)
+		protected.GET("/labs/:id/events", handler.GetLabEvents)
+		protected.GET("/labs/:id/cost", handler.GetLabCost)
+		protected.GET("/labs/:id/terraform-logs", handler.GetTerraformLogs)
+		protected.GET("/labs/:id/credentials", handler.GetLabCredentials)
+		protected.GET("/labs/:id/credentials/export", handler.ExportLabCredentials)
+		protected.POST("/labs/:id/credentials/:credID/rotate", handler.RotateLabCredential)
+		protected.POST("/labs/:id/credentials/:credID/reveal", handler.NoImpersonation(), handler.RevealLabCredential)
 		protected.DELETE("/labs/:id", handler.DeleteLab)
 		protected.POST("/labs/:id/stop", handler.StopLab)
+		protected.POST("/labs/:id/resume", handler.ResumeLab)
+		protected.PUT("/labs/:id/tags", handler.UpdateLabTags)
+		protected.POST("/labs/:id/retry", labRateLimiter.Middleware(), handler.RetryLabProvisioning)
 		protected.POST("/labs/:id/cleanup", handler.CleanupFailedLab)
+		protected.POST("/labs/:id/cancel", handler.CancelScheduledLab)
+		protected.GET("/labs/:id/shares", handler.GetLabShares)
+		protected.POST("/labs/:id/shares", handler.ShareLab)
+		protected.DELETE("/labs/:id/shares/:userId", handler.UnshareLab)
 
 		// Template routes
 		protected.GET("/templates", handler.GetLabTemplates)
+		protected.GET("/templates/facets", handler.GetTemplateFacets)
 		protected.GET("/templates/:id", handler.GetLabTemplate)
-		protected.POST("/templates/:id/labs", handler.CreateLabFromTemplate)
+		protected.POST("/templates/:id/labs", labRateLimiter.Middleware(), handler.CreateLabFromTemplate)
+	}
+
+	// Org admin routes (global admins, or org admins scoped to their own organization)
+	orgAdmin := router.Group("/api/admin")
+	orgAdmin.Use(handler.AuthMiddleware(), handler.OrgAdminMiddleware())
+	{
+		orgAdmin.GET("/labs", handler.GetAllLabs)
+		orgAdmin.GET("/labs/ws", handler.AdminLabEvents)
+		orgAdmin.GET("/labs/tags", handler.GetLabTagCounts)
+		orgAdmin.POST("/labs/:id/stop", handler.AdminStopLab)
+		orgAdmin.POST("/labs/:id/resume", handler.AdminResumeLab)
+		orgAdmin.DELETE("/labs/:id", handler.AdminDeleteLab)
+		orgAdmin.POST("/labs/:id/cleanup", handler.CleanupLab)
+		orgAdmin.GET("/organizations/:id", handler.GetOrganization)
+		orgAdmin.GET("/organizations/:id/stats", handler.GetOrganizationStats)
+		orgAdmin.POST("/organizations/:id/invites", handler.CreateInvite)
+		orgAdmin.POST("/invites/:id/renew", handler.RenewInvite)
 	}
 
-	// Admin routes (require both auth and admin privileges)
+	// Admin routes (require both auth and global admin privileges)
 	admin := router.Group("/api/admin")
 	admin.Use(handler.AuthMiddleware(), handler.AdminMiddleware())
 	{
-		admin.GET("/labs", handler.GetAllLabs)
-		admin.POST("/labs/:id/stop", handler.AdminStopLab)
-		admin.DELETE("/labs/:id", handler.AdminDeleteLab)
-		admin.POST("/labs/:id/cleanup", handler.CleanupLab)
 		// Cleanup endpoints
 		admin.POST("/cleanup/service", handler.AdminCleanupService)
 		admin.POST("/cleanup/service-by-id", handler.AdminCleanupServiceByID)
 		admin.POST("/cleanup/lab", handler.AdminCleanupByLab)
 		admin.GET("/cleanup/services", handler.AdminGetAvailableServices)
+		admin.GET("/labs/search", handler.SearchLabs)
+		admin.POST("/labs/bulk", handler.BulkLabAction)
+		admin.GET("/labs/:id/resources", handler.GetLabResources)
+		admin.GET("/labs/:id/terraform-config", handler.GetLabTerraformConfig)
+		admin.GET("/labs/:id/cleanup", handler.GetLabCleanupState)
+		admin.POST("/labs/:id/cleanup/retry", handler.RetryLabCleanup)
+		admin.GET("/labs/:id/registration-tokens", handler.ListLabRegistrationTokens)
+		admin.DELETE("/labs/:id/registration-tokens/:tokenID", handler.RevokeLabRegistrationToken)
+		admin.GET("/reconcile", handler.GetReconcileReport)
+		admin.POST("/reconcile", handler.RunReconcile)
 		admin.GET("/users", handler.GetUsers)
+		admin.GET("/users/inactive", handler.GetInactiveUsers)
 		admin.POST("/users", handler.CreateUser)
 		admin.PUT("/users/:id/role", handler.UpdateUserRole)
 		admin.DELETE("/users/:id", handler.DeleteUser)
+		admin.POST("/users/:id/impersonate", handler.ImpersonateUser)
+		admin.GET("/impersonations", handler.GetImpersonationAudit)
 
 		// Organization management
 		admin.GET("/organizations", handler.GetOrganizations)
 		admin.POST("/organizations", handler.CreateOrganization)
-		admin.GET("/organizations/:id", handler.GetOrganization)
-		admin.POST("/organizations/:id/invites", handler.CreateInvite)
+		admin.PUT("/organizations/:id/auto-join", handler.SetOrganizationDomainAutoJoin)
+		admin.GET("/invites/stats", handler.GetInviteStats)
 
 		// Service configuration and limit management
+		admin.GET("/templates/:id/export", handler.ExportTemplate)
+		admin.POST("/templates/import", handler.ImportTemplate)
+		admin.GET("/service-types", handler.GetServiceTypes)
 		admin.GET("/service-configs", handler.GetServiceConfigs)
 		admin.POST("/service-configs", handler.CreateServiceConfig)
+		admin.POST("/service-configs/reload", handler.ReloadServiceConfigs)
 		admin.PUT("/service-configs/:id", handler.UpdateServiceConfig)
 		admin.DELETE("/service-configs/:id", handler.DeleteServiceConfig)
+		admin.POST("/service-configs/:id/test", handler.TestServiceConfig)
 		admin.GET("/service-limits", handler.GetServiceLimits)
 		admin.POST("/service-limits", handler.CreateServiceLimit)
 		admin.PUT("/service-limits/:id", handler.UpdateServiceLimit)
 		admin.DELETE("/service-limits/:id", handler.DeleteServiceLimit)
 		admin.GET("/service-usage", handler.GetServiceUsage)
+		admin.GET("/vlan-usage", handler.GetVlanUsage)
+		admin.GET("/health", handler.AdminHealthCheck)
+	}
+
+	// Start server, over TLS when a certificate is configured
+	certFile := getEnv("TLS_CERT_FILE", "")
+	keyFile := getEnv("TLS_KEY_FILE", "")
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			log.Fatal("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		}
+		log.Printf("Server starting with TLS on port %s", port)
+		if err := router.RunTLS(":"+port, certFile, keyFile); err != nil {
+			log.Fatal("Failed to start server:", err)
+		}
+		return
 	}
 
-	// Start server
 	log.Printf("Server starting on port %s", port)
 	if err := router.Run(":" + port); err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
 }
 
+// bootstrapAdmin creates the admin account configured by BOOTSTRAP_ADMIN_EMAIL and BOOTSTRAP_ADMIN_NAME,
+// unless BOOTSTRAP_ADMIN_ENABLED is false or the account already exists
+func bootstrapAdmin(authService *auth.Service) {
+	if !getEnvBool("BOOTSTRAP_ADMIN_ENABLED", true) {
+		log.Printf("Bootstrap admin disabled, not creating an admin user")
+		return
+	}
+
+	email := getEnv("BOOTSTRAP_ADMIN_EMAIL", defaultBootstrapAdminEmail)
+	name := getEnv("BOOTSTRAP_ADMIN_NAME", "Admin User")
+	if email == defaultBootstrapAdminEmail {
+		log.Printf("WARNING: BOOTSTRAP_ADMIN_EMAIL is not set, creating the default admin %s. Anyone who can log in as this well-known address gets admin access; set BOOTSTRAP_ADMIN_EMAIL to an address you control, or BOOTSTRAP_ADMIN_ENABLED=false to skip it.", email)
+	}
+
+	if existing, err := authService.GetUserByEmail(email); err == nil {
+		log.Printf("Bootstrap admin %s already exists (%s), skipping", existing.Email, existing.Role)
+		return
+	}
+
+	adminUser, err := authService.CreateAdminUser(email, name)
+	if err != nil {
+		log.Printf("Failed to create admin user: %v", err)
+		return
+	}
+	log.Printf("Created admin user: %s (%s)", adminUser.Email, adminUser.Role)
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -237,3 +507,39 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvList gets a comma-separated environment variable or returns a default list
+func getEnvList(key string, defaultValue []string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return defaultValue
+	}
+	return values
+}
+
+// getEnvBool gets a boolean environment variable with a default value
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid value for %s, using default: %t", key, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvInt gets an integer environment variable with a default value
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid value for %s, using default: %d", key, defaultValue)
+	}
+	return defaultValue
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token so they can be told apart from JWTs
+const PersonalAccessTokenPrefix = "labpat_"
+
+var (
+	ErrAccessTokenNotFound = errors.New("access token not found")
+	ErrInvalidTokenScope   = errors.New("invalid token scope")
+)
+
+// IsPersonalAccessToken reports whether a bearer token is a personal access token rather than a JWT
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// hashAccessToken returns the stored form of a personal access token
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreatePersonalAccessToken issues a new token for a user. The returned token string is not stored
+// and cannot be retrieved again.
+func (s *Service) CreatePersonalAccessToken(userID, name string, scopes []models.TokenScope, expiresIn time.Duration) (string, *models.PersonalAccessToken, error) {
+	if _, err := s.GetUserByID(userID); err != nil {
+		return "", nil, err
+	}
+	for _, scope := range scopes {
+		if !scope.IsValid() {
+			return "", nil, fmt.Errorf("%w: %s", ErrInvalidTokenScope, scope)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := PersonalAccessTokenPrefix + hex.EncodeToString(secret)
+
+	now := time.Now()
+	accessToken := &models.PersonalAccessToken{
+		ID:        models.GenerateID(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    token[:len(PersonalAccessTokenPrefix)+6],
+		TokenHash: hashAccessToken(token),
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if expiresIn > 0 {
+		expiresAt := now.Add(expiresIn)
+		accessToken.ExpiresAt = &expiresAt
+	}
+
+	s.tokensMu.Lock()
+	s.accessTokens[accessToken.TokenHash] = accessToken
+	s.tokensMu.Unlock()
+
+	fmt.Printf("Created personal access token %s (%s) for user %s with scopes %v\n", accessToken.ID, name, userID, scopes)
+	return token, accessToken, nil
+}
+
+// ValidatePersonalAccessToken looks up a personal access token and returns it with its user
+func (s *Service) ValidatePersonalAccessToken(token string) (*models.User, *models.PersonalAccessToken, error) {
+	hash := hashAccessToken(token)
+
+	s.tokensMu.Lock()
+	accessToken, exists := s.accessTokens[hash]
+	if !exists {
+		s.tokensMu.Unlock()
+		return nil, nil, ErrInvalidToken
+	}
+	if accessToken.IsExpired() {
+		s.tokensMu.Unlock()
+		return nil, nil, ErrTokenExpired
+	}
+	now := time.Now()
+	accessToken.LastUsedAt = &now
+	s.tokensMu.Unlock()
+
+	user, err := s.GetUserByID(accessToken.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+	// Machine clients count as activity, so users who only use tokens aren't reported as inactive
+	s.recordLogin(user)
+	return user, accessToken, nil
+}
+
+// GetPersonalAccessTokens returns a user's tokens, newest first
+func (s *Service) GetPersonalAccessTokens(userID string) []*models.PersonalAccessToken {
+	s.tokensMu.RLock()
+	defer s.tokensMu.RUnlock()
+
+	tokens := []*models.PersonalAccessToken{}
+	for _, accessToken := range s.accessTokens {
+		if accessToken.UserID == userID {
+			tokens = append(tokens, accessToken)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens
+}
+
+// RevokePersonalAccessToken deletes one of a user's tokens
+func (s *Service) RevokePersonalAccessToken(userID, tokenID string) error {
+	s.tokensMu.Lock()
+	defer s.tokensMu.Unlock()
+
+	for hash, accessToken := range s.accessTokens {
+		if accessToken.ID == tokenID && accessToken.UserID == userID {
+			delete(s.accessTokens, hash)
+			fmt.Printf("Revoked personal access token %s for user %s\n", tokenID, userID)
+			return nil
+		}
+	}
+	return ErrAccessTokenNotFound
+}
+
+// revokeUserAccessTokens deletes every token belonging to a user
+func (s *Service) revokeUserAccessTokens(userID string) {
+	s.tokensMu.Lock()
+	defer s.tokensMu.Unlock()
+
+	for hash, accessToken := range s.accessTokens {
+		if accessToken.UserID == userID {
+			delete(s.accessTokens, hash)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package auth
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/wcrum/labby/internal/models"
@@ -13,48 +15,110 @@ import (
 var (
 	ErrInvalidToken = errors.New("invalid token")
 	ErrTokenExpired = errors.New("token expired")
+	ErrTokenRevoked = errors.New("token revoked")
+	ErrUserNotFound = errors.New("user not found")
+	ErrEmailTaken   = errors.New("a user with this email already exists")
 )
 
-// JWTClaims represents the JWT claims
+// Defaults for the iss and aud claims when nothing is configured
+const (
+	DefaultTokenIssuer   = "labby"
+	DefaultTokenAudience = "labby"
+)
+
+// JWTClaims represents the JWT claims. Role and OrganizationID let middleware authorize a request
+// without looking the user up; tokens are revoked when either changes in a way that affects access.
 type JWTClaims struct {
-	UserID string          `json:"user_id"`
-	Email  string          `json:"email"`
-	Role   models.UserRole `json:"role"`
+	UserID         string          `json:"user_id"`
+	Email          string          `json:"email"`
+	Role           models.UserRole `json:"role"`
+	OrganizationID string          `json:"org_id,omitempty"`
+
+	// Set on impersonation tokens only: the admin acting as the user, see GenerateImpersonationToken
+	ImpersonatorID    string `json:"impersonator_id,omitempty"`
+	ImpersonatorEmail string `json:"impersonator_email,omitempty"`
+
 	jwt.RegisteredClaims
 }
 
 // Service handles authentication
 type Service struct {
-	jwtSecret []byte
-	users     map[string]*models.User // In-memory user store
+	jwtSecret    []byte
+	users        map[string]*models.User                // In-memory user store
+	usersByEmail map[string]string                      // Normalized email -> user ID, keeps emails unique
+	usersMu      sync.RWMutex                           // Guards users and usersByEmail
+	accessTokens map[string]*models.PersonalAccessToken // Personal access tokens by token hash
+	tokensMu     sync.RWMutex
+	lastLogins   map[string]time.Time // User ID -> last login or authenticated request
+	activityMu   sync.RWMutex         // Guards lastLogins, which every authenticated request updates
+
+	revokedTokens    map[string]time.Time // Revoked token ID -> when the token expires
+	tokensValidAfter map[string]time.Time // User ID -> tokens issued at or before this time are revoked
+	revocationMu     sync.RWMutex
+
+	impersonationAudit []*models.ImpersonationAuditEntry // Oldest first, capped at maxImpersonationAuditEntries
+	auditMu            sync.RWMutex
+
+	issuer   string // iss claim of issued tokens, required on validation
+	audience string // aud claim of issued tokens, required on validation
+
+	// domainOrganization finds the organization that auto-assigns users of an email's domain
+	domainOrganization func(email string) (string, bool)
 }
 
 // NewService creates a new auth service
 func NewService(jwtSecret string) *Service {
 	return &Service{
-		jwtSecret: []byte(jwtSecret),
-		users:     make(map[string]*models.User),
+		jwtSecret:    []byte(jwtSecret),
+		users:        make(map[string]*models.User),
+		usersByEmail: make(map[string]string),
+		accessTokens: make(map[string]*models.PersonalAccessToken),
+		lastLogins:   make(map[string]time.Time),
+
+		revokedTokens:    make(map[string]time.Time),
+		tokensValidAfter: make(map[string]time.Time),
+
+		issuer:   DefaultTokenIssuer,
+		audience: DefaultTokenAudience,
 	}
 }
 
-// CreateUser creates a new user
+// SetTokenIssuer sets the issuer and audience written to and required of JWTs, so tokens of another
+// instance sharing the secret are rejected. Empty values keep the current setting.
+func (s *Service) SetTokenIssuer(issuer, audience string) {
+	if issuer != "" {
+		s.issuer = issuer
+	}
+	if audience != "" {
+		s.audience = audience
+	}
+}
+
+// SetDomainOrganizationLookup sets how users who log in without an organization are matched to one by
+// their email domain. Only organizations that opted in should be returned.
+func (s *Service) SetDomainOrganizationLookup(lookup func(email string) (string, bool)) {
+	s.domainOrganization = lookup
+}
+
+// CreateUser creates a new user. It returns ErrEmailTaken when a user with the email, in any case,
+// already exists.
 func (s *Service) CreateUser(email, name string, role models.UserRole) (*models.User, error) {
 	return s.CreateUserWithOrganization(email, name, role, nil)
 }
 
-// CreateUserWithOrganization creates a new user with optional organization
+// CreateUserWithOrganization creates a new user with optional organization. Emails are stored lowercase
+// and a user with the email already existing is rejected with ErrEmailTaken.
 func (s *Service) CreateUserWithOrganization(email, name string, role models.UserRole, organizationID *string) (*models.User, error) {
-	// Check if user already exists
-	for _, user := range s.users {
-		if user.Email == email {
-			// If user exists but has no organization and we're providing one, update it
-			if user.OrganizationID == nil && organizationID != nil {
-				user.OrganizationID = organizationID
-				user.UpdatedAt = time.Now()
-				fmt.Printf("DEBUG: Updated existing user %s with organization %s\n", user.Email, *organizationID)
-			}
-			return user, nil
-		}
+	s.usersMu.Lock()
+	defer s.usersMu.Unlock()
+
+	return s.createUserLocked(models.NormalizeEmail(email), name, role, organizationID)
+}
+
+// createUserLocked creates a user with a normalized email. The caller must hold s.usersMu.
+func (s *Service) createUserLocked(email, name string, role models.UserRole, organizationID *string) (*models.User, error) {
+	if _, exists := s.usersByEmail[email]; exists {
+		return nil, ErrEmailTaken
 	}
 
 	// Create new user
@@ -70,6 +134,7 @@ func (s *Service) CreateUserWithOrganization(email, name string, role models.Use
 	}
 
 	s.users[user.ID] = user
+	s.usersByEmail[email] = user.ID
 	if organizationID != nil {
 		fmt.Printf("DEBUG: Created new user: %s (ID: %s) with organization %s\n", user.Email, user.ID, *organizationID)
 	} else {
@@ -85,21 +150,26 @@ func stringPtr(s string) *string {
 
 // GetUserByID retrieves a user by ID
 func (s *Service) GetUserByID(userID string) (*models.User, error) {
+	s.usersMu.RLock()
+	defer s.usersMu.RUnlock()
+
 	user, exists := s.users[userID]
 	if !exists {
-		return nil, errors.New("user not found")
+		return nil, ErrUserNotFound
 	}
 	return user, nil
 }
 
-// GetUserByEmail retrieves a user by email
+// GetUserByEmail retrieves a user by email, in any case
 func (s *Service) GetUserByEmail(email string) (*models.User, error) {
-	for _, user := range s.users {
-		if user.Email == email {
-			return user, nil
-		}
+	s.usersMu.RLock()
+	defer s.usersMu.RUnlock()
+
+	userID, exists := s.usersByEmail[models.NormalizeEmail(email)]
+	if !exists {
+		return nil, ErrUserNotFound
 	}
-	return nil, errors.New("user not found")
+	return s.users[userID], nil
 }
 
 // Login performs authentication
@@ -107,74 +177,144 @@ func (s *Service) Login(email string) (*models.User, error) {
 	return s.LoginWithOrganization(email, nil)
 }
 
-// LoginWithOrganization performs authentication with optional organization assignment
+// LoginWithOrganization performs authentication with optional organization assignment. Emails are
+// matched in any case, so logging in with a differently cased address reaches the same user.
 func (s *Service) LoginWithOrganization(email string, organizationID *string) (*models.User, error) {
-	// Try to find existing user
-	user, err := s.GetUserByEmail(email)
-	if err != nil {
-		// Create new user if not found
+	email = models.NormalizeEmail(email)
+
+	// Users without an invite join the organization that auto-assigns their email domain, if any
+	if organizationID == nil && s.domainOrganization != nil {
+		if domainOrgID, ok := s.domainOrganization(email); ok {
+			organizationID = &domainOrgID
+		}
+	}
+
+	// Try to find existing user, creating them if not found. Looking up and creating under one lock
+	// keeps concurrent first logins from creating two users.
+	s.usersMu.Lock()
+	var user *models.User
+	if userID, exists := s.usersByEmail[email]; exists {
+		user = s.users[userID]
+	} else {
 		// Default to user role for new users
-		user, err = s.CreateUserWithOrganization(email, "User", models.UserRoleUser, organizationID)
+		created, err := s.createUserLocked(email, "User", models.UserRoleUser, organizationID)
 		if err != nil {
+			s.usersMu.Unlock()
 			return nil, err
 		}
-	} else if organizationID != nil && user.OrganizationID == nil {
+		user = created
+	}
+	s.usersMu.Unlock()
+
+	if organizationID != nil && user.OrganizationID == nil {
 		// If user exists but has no organization and we're providing one, update it
 		user.OrganizationID = organizationID
 		user.UpdatedAt = time.Now()
 		fmt.Printf("DEBUG: Updated existing user %s with organization %s during login\n", user.Email, *organizationID)
 	}
 
+	s.recordLogin(user)
 	return user, nil
 }
 
 // GenerateToken generates a JWT token for a user
 func (s *Service) GenerateToken(user *models.User) (string, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
 	claims := JWTClaims{
 		UserID: user.ID,
 		Email:  user.Email,
 		Role:   user.Role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        tokenID,
+			Issuer:    s.issuer,
+			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{s.audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenLifetime)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
+	if user.OrganizationID != nil {
+		claims.OrganizationID = *user.OrganizationID
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(s.jwtSecret)
 }
 
+// parseToken verifies a JWT's signature, expiry, issuer and audience and returns its claims
+func (s *Service) parseToken(tokenString string) (*JWTClaims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(s.audience),
+		jwt.WithExpirationRequired(),
+	)
+
+	claims := &JWTClaims{}
+	token, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.jwtSecret, nil
+	})
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
 // ValidateToken validates a JWT token and returns the user
 func (s *Service) ValidateToken(tokenString string) (*models.User, error) {
-	fmt.Printf("ValidateToken: Validating token: %s...\n", tokenString[:10]+"...")
+	user, _, err := s.ValidateTokenClaims(tokenString)
+	return user, err
+}
 
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return s.jwtSecret, nil
-	})
+// ValidateTokenClaims validates a JWT token and returns the user together with the token's claims
+func (s *Service) ValidateTokenClaims(tokenString string) (*models.User, *JWTClaims, error) {
+	fmt.Printf("ValidateToken: Validating token: %s...\n", tokenString[:10]+"...")
 
+	claims, err := s.parseToken(tokenString)
 	if err != nil {
 		fmt.Printf("ValidateToken: JWT parsing failed: %v\n", err)
-		return nil, ErrInvalidToken
+		return nil, nil, err
 	}
 
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-		fmt.Printf("ValidateToken: Token claims - UserID: %s, Email: %s, Role: %s\n", claims.UserID, claims.Email, claims.Role)
-		user, err := s.GetUserByID(claims.UserID)
-		if err != nil {
-			fmt.Printf("ValidateToken: User not found by ID %s: %v\n", claims.UserID, err)
-			return nil, ErrInvalidToken
+	fmt.Printf("ValidateToken: Token claims - UserID: %s, Email: %s, Role: %s\n", claims.UserID, claims.Email, claims.Role)
+	if s.isTokenRevoked(claims) {
+		fmt.Printf("ValidateToken: Token %s has been revoked\n", claims.ID)
+		return nil, nil, ErrTokenRevoked
+	}
+	user, err := s.GetUserByID(claims.UserID)
+	if err != nil {
+		fmt.Printf("ValidateToken: User not found by ID %s: %v\n", claims.UserID, err)
+		return nil, nil, ErrInvalidToken
+	}
+	fmt.Printf("ValidateToken: User found: %s\n", user.Email)
+	if claims.IsImpersonation() {
+		// Support acting as a user must not make them look active
+		if impersonator, err := s.GetUserByID(claims.ImpersonatorID); err != nil || impersonator.Role != models.UserRoleAdmin {
+			fmt.Printf("ValidateToken: Impersonator %s of token %s is no longer an admin\n", claims.ImpersonatorID, claims.ID)
+			return nil, nil, ErrTokenRevoked
 		}
-		fmt.Printf("ValidateToken: User found: %s\n", user.Email)
-		return user, nil
+		return user, claims, nil
 	}
-
-	fmt.Printf("ValidateToken: Token claims invalid or token not valid\n")
-	return nil, ErrInvalidToken
+	s.recordLogin(user)
+	return user, claims, nil
 }
 
 // GetAllUsers returns all users (for admin purposes)
 func (s *Service) GetAllUsers() []*models.User {
+	s.usersMu.RLock()
+	defer s.usersMu.RUnlock()
+
 	users := make([]*models.User, 0, len(s.users))
 	for _, user := range s.users {
 		users = append(users, user)
@@ -182,6 +322,80 @@ func (s *Service) GetAllUsers() []*models.User {
 	return users
 }
 
+// QueryUsers returns one page of the users matching a filter, ordered by email, along with the
+// number of users that match across all pages
+func (s *Service) QueryUsers(filter models.UserFilter, offset, limit int) ([]*models.User, int) {
+	matched := make([]*models.User, 0)
+	s.usersMu.RLock()
+	for _, user := range s.users {
+		if filter.Matches(user) {
+			matched = append(matched, user)
+		}
+	}
+	s.usersMu.RUnlock()
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].Email < matched[j].Email
+	})
+
+	total := len(matched)
+	if offset >= total {
+		return []*models.User{}, total
+	}
+	end := offset + limit
+	if limit <= 0 || end > total {
+		end = total
+	}
+	return matched[offset:end], total
+}
+
+// recordLogin marks a user as active now. Times are kept apart from the user records, which
+// handlers read without locking.
+func (s *Service) recordLogin(user *models.User) {
+	now := time.Now()
+	s.activityMu.Lock()
+	s.lastLogins[user.ID] = now
+	s.activityMu.Unlock()
+}
+
+// LastLoginAt returns when a user last logged in or made an authenticated request, or nil if never
+func (s *Service) LastLoginAt(userID string) *time.Time {
+	s.activityMu.RLock()
+	defer s.activityMu.RUnlock()
+
+	lastLogin, exists := s.lastLogins[userID]
+	if !exists {
+		return nil
+	}
+	return &lastLogin
+}
+
+// InactiveUsers returns the users who haven't logged in since the cutoff, longest inactive first.
+// Users who never logged in are measured from when their account was created.
+func (s *Service) InactiveUsers(since time.Time) []*models.User {
+	s.activityMu.RLock()
+	defer s.activityMu.RUnlock()
+
+	lastActive := func(user *models.User) time.Time {
+		if lastLogin, exists := s.lastLogins[user.ID]; exists {
+			return lastLogin
+		}
+		return user.CreatedAt
+	}
+
+	inactive := make([]*models.User, 0)
+	s.usersMu.RLock()
+	for _, user := range s.users {
+		if lastActive(user).Before(since) {
+			inactive = append(inactive, user)
+		}
+	}
+	s.usersMu.RUnlock()
+	sort.Slice(inactive, func(i, j int) bool {
+		return lastActive(inactive[i]).Before(lastActive(inactive[j]))
+	})
+	return inactive
+}
+
 // CreateAdminUser creates an admin user
 func (s *Service) CreateAdminUser(email, name string) (*models.User, error) {
 	return s.CreateUser(email, name, models.UserRoleAdmin)
@@ -189,12 +403,15 @@ func (s *Service) CreateAdminUser(email, name string) (*models.User, error) {
 
 // UpdateUserRole updates a user's role
 func (s *Service) UpdateUserRole(userID string, role models.UserRole) error {
-	user, exists := s.users[userID]
-	if !exists {
-		return errors.New("user not found")
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
 	}
 	user.Role = role
 	user.UpdatedAt = time.Now()
+
+	// Make the user log in again so no session outlives the role it was issued for
+	s.RevokeUserTokens(userID)
 	return nil
 }
 
@@ -202,10 +419,10 @@ func (s *Service) UpdateUserRole(userID string, role models.UserRole) error {
 func (s *Service) UpdateUserOrganization(userID string, organizationID *string) error {
 	fmt.Printf("DEBUG: UpdateUserOrganization called for userID: %s, organizationID: %v\n", userID, organizationID)
 
-	user, exists := s.users[userID]
-	if !exists {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
 		fmt.Printf("ERROR: User not found with ID: %s\n", userID)
-		return errors.New("user not found")
+		return err
 	}
 
 	fmt.Printf("DEBUG: Found user: %s (email: %s), current org: %v\n", user.Name, user.Email, user.OrganizationID)
@@ -214,14 +431,19 @@ func (s *Service) UpdateUserOrganization(userID string, organizationID *string)
 	user.UpdatedAt = time.Now()
 
 	fmt.Printf("DEBUG: Updated user organization to: %v\n", user.OrganizationID)
+
+	// An organization admin's tokens carry the organization they administer, so they must log in again
+	if user.Role == models.UserRoleOrgAdmin {
+		s.RevokeUserTokens(userID)
+	}
 	return nil
 }
 
 // AssignUserToDefaultOrganization assigns a user to the default organization if they don't have one
 func (s *Service) AssignUserToDefaultOrganization(userID string) error {
-	user, exists := s.users[userID]
-	if !exists {
-		return errors.New("user not found")
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
 	}
 
 	// Only assign to default organization if user has no organization
@@ -239,11 +461,28 @@ func (s *Service) IsAdmin(user *models.User) bool {
 	return user.Role == models.UserRoleAdmin
 }
 
+// IsOrgAdmin checks if a user is an organization admin
+func (s *Service) IsOrgAdmin(user *models.User) bool {
+	return user.Role == models.UserRoleOrgAdmin
+}
+
 // DeleteUser deletes a user
 func (s *Service) DeleteUser(userID string) error {
-	if _, exists := s.users[userID]; !exists {
-		return errors.New("user not found")
+	s.usersMu.Lock()
+	user, exists := s.users[userID]
+	if !exists {
+		s.usersMu.Unlock()
+		return ErrUserNotFound
 	}
 	delete(s.users, userID)
+	delete(s.usersByEmail, user.Email)
+	s.usersMu.Unlock()
+
+	s.revokeUserAccessTokens(userID)
+	s.RevokeUserTokens(userID)
+
+	s.activityMu.Lock()
+	delete(s.lastLogins, userID)
+	s.activityMu.Unlock()
 	return nil
 }
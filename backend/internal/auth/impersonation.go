@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// impersonationTokenLifetime is how long an impersonation token stays valid after it is issued
+	impersonationTokenLifetime = 15 * time.Minute
+	// maxImpersonationAuditEntries caps the in-memory audit log; the oldest entries are dropped first
+	maxImpersonationAuditEntries = 10000
+)
+
+// ErrCannotImpersonate is returned when an admin tries to impersonate themselves or another admin
+var ErrCannotImpersonate = errors.New("user cannot be impersonated")
+
+// IsImpersonation reports whether the token was issued to an admin acting as its user
+func (c *JWTClaims) IsImpersonation() bool {
+	return c.ImpersonatorID != ""
+}
+
+// GenerateImpersonationToken issues a short-lived JWT that lets an admin see the application as another
+// user. The token carries the user's identity and role, with the admin in the impersonator claims, so
+// middleware can refuse it for admin actions. Admins can't be impersonated, which would hand out admin
+// access under someone else's name. Issuing the token is recorded in the impersonation audit log.
+func (s *Service) GenerateImpersonationToken(impersonator *models.User, userID, reason string) (*models.ImpersonationResponse, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == impersonator.ID || user.Role == models.UserRoleAdmin {
+		return nil, ErrCannotImpersonate
+	}
+
+	tokenID, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(impersonationTokenLifetime)
+	claims := JWTClaims{
+		UserID:            user.ID,
+		Email:             user.Email,
+		Role:              user.Role,
+		ImpersonatorID:    impersonator.ID,
+		ImpersonatorEmail: impersonator.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Issuer:    s.issuer,
+			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{s.audience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+	if user.OrganizationID != nil {
+		claims.OrganizationID = *user.OrganizationID
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	s.RecordImpersonation(&claims, models.ImpersonationAuditIssued, "", "", 0, reason)
+	return &models.ImpersonationResponse{
+		Token:          token,
+		TokenID:        tokenID,
+		ExpiresAt:      expiresAt,
+		User:           *user,
+		ImpersonatorID: impersonator.ID,
+	}, nil
+}
+
+// RecordImpersonation adds an entry for an impersonation token to the audit log and writes it to the
+// server log. method, path and status describe the request the token was used for, if any.
+func (s *Service) RecordImpersonation(claims *JWTClaims, action models.ImpersonationAuditAction, method, path string, status int, reason string) {
+	entry := &models.ImpersonationAuditEntry{
+		ID:                models.GenerateID(),
+		Action:            action,
+		TokenID:           claims.ID,
+		ImpersonatorID:    claims.ImpersonatorID,
+		ImpersonatorEmail: claims.ImpersonatorEmail,
+		UserID:            claims.UserID,
+		UserEmail:         claims.Email,
+		Reason:            reason,
+		Method:            method,
+		Path:              path,
+		Status:            status,
+		Timestamp:         time.Now(),
+	}
+
+	s.auditMu.Lock()
+	s.impersonationAudit = append(s.impersonationAudit, entry)
+	if excess := len(s.impersonationAudit) - maxImpersonationAuditEntries; excess > 0 {
+		s.impersonationAudit = append([]*models.ImpersonationAuditEntry(nil), s.impersonationAudit[excess:]...)
+	}
+	s.auditMu.Unlock()
+
+	switch action {
+	case models.ImpersonationAuditIssued:
+		fmt.Printf("AUDIT: Admin %s (%s) started impersonating user %s (%s) with token %s: %s\n",
+			claims.ImpersonatorEmail, claims.ImpersonatorID, claims.Email, claims.UserID, claims.ID, reason)
+	default:
+		fmt.Printf("AUDIT: Admin %s (%s) impersonating user %s (%s): %s %s -> %d (%s)\n",
+			claims.ImpersonatorEmail, claims.ImpersonatorID, claims.Email, claims.UserID, method, path, status, action)
+	}
+}
+
+// GetImpersonationAudit returns the impersonation audit log, newest first, optionally only the entries
+// involving a user as the impersonated user or the impersonator
+func (s *Service) GetImpersonationAudit(userID string) []*models.ImpersonationAuditEntry {
+	s.auditMu.RLock()
+	defer s.auditMu.RUnlock()
+
+	entries := make([]*models.ImpersonationAuditEntry, 0)
+	for i := len(s.impersonationAudit) - 1; i >= 0; i-- {
+		entry := s.impersonationAudit[i]
+		if userID != "" && entry.UserID != userID && entry.ImpersonatorID != userID {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// tokenLifetime is how long a JWT stays valid after it is issued
+const tokenLifetime = 24 * time.Hour
+
+// newTokenID returns a random JWT ID, so single tokens can be revoked
+func newTokenID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate token ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// RevokeToken invalidates a single JWT, such as on logout, until it would have expired anyway
+func (s *Service) RevokeToken(tokenString string) error {
+	claims, err := s.parseToken(tokenString)
+	if err != nil || claims.ID == "" {
+		return ErrInvalidToken
+	}
+
+	expiresAt := time.Now().Add(tokenLifetime)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	s.revocationMu.Lock()
+	defer s.revocationMu.Unlock()
+
+	s.pruneRevocationsLocked(time.Now())
+	s.revokedTokens[claims.ID] = expiresAt
+	fmt.Printf("Revoked token %s of user %s\n", claims.ID, claims.UserID)
+	return nil
+}
+
+// RevokeUserTokens invalidates every JWT issued to a user so far. Tokens issued within the same
+// second are revoked too, since issue times only have second precision.
+func (s *Service) RevokeUserTokens(userID string) {
+	now := time.Now()
+
+	s.revocationMu.Lock()
+	defer s.revocationMu.Unlock()
+
+	s.pruneRevocationsLocked(now)
+	s.tokensValidAfter[userID] = now.Truncate(time.Second)
+	fmt.Printf("Revoked all tokens of user %s\n", userID)
+}
+
+// isTokenRevoked reports whether a validated token was revoked on its own or with all of its user's tokens
+func (s *Service) isTokenRevoked(claims *JWTClaims) bool {
+	s.revocationMu.RLock()
+	defer s.revocationMu.RUnlock()
+
+	if claims.ID != "" {
+		if _, revoked := s.revokedTokens[claims.ID]; revoked {
+			return true
+		}
+	}
+	// Impersonation tokens are revoked with the tokens of the user and of the admin impersonating them
+	for _, userID := range []string{claims.UserID, claims.ImpersonatorID} {
+		if userID == "" {
+			continue
+		}
+		if validAfter, exists := s.tokensValidAfter[userID]; exists {
+			if claims.IssuedAt == nil || !claims.IssuedAt.Time.After(validAfter) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pruneRevocationsLocked forgets revocations of tokens that have expired since. The caller must hold revocationMu.
+func (s *Service) pruneRevocationsLocked(now time.Time) {
+	for tokenID, expiresAt := range s.revokedTokens {
+		if now.After(expiresAt) {
+			delete(s.revokedTokens, tokenID)
+		}
+	}
+	for userID, validAfter := range s.tokensValidAfter {
+		if now.Sub(validAfter) > tokenLifetime {
+			delete(s.tokensValidAfter, userID)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/wcrum/labby/internal/auth"
+	"github.com/wcrum/labby/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// personalAccessTokenRoutes maps the routes personal access tokens may call to the scope each needs.
+// Any other route, including token management and admin routes, requires a JWT login.
+var personalAccessTokenRoutes = map[string]models.TokenScope{
+	"GET /api/labs":                 models.TokenScopeReadLab,
+	"GET /api/labs/:id":             models.TokenScopeReadLab,
+	"GET /api/labs/:id/progress":    models.TokenScopeReadLab,
+	"GET /api/labs/:id/diagnostics": models.TokenScopeReadLab,
+	"GET /api/templates":            models.TokenScopeReadLab,
+	"GET /api/templates/:id":        models.TokenScopeReadLab,
+	"POST /api/labs":                models.TokenScopeCreateLab,
+	"POST /api/templates/:id/labs":  models.TokenScopeCreateLab,
+	"POST /api/labs/:id/retry":      models.TokenScopeCreateLab,
+	"POST /api/labs/:id/stop":       models.TokenScopeDeleteLab,
+	"DELETE /api/labs/:id":          models.TokenScopeDeleteLab,
+	"POST /api/labs/:id/cleanup":    models.TokenScopeDeleteLab,
+}
+
+// GetAccessTokens handles listing the current user's personal access tokens
+// @Summary Get access tokens
+// @Description List the authenticated user's personal access tokens. Token values are never returned.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.PersonalAccessToken
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Router /tokens [get]
+func (h *Handler) GetAccessTokens(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "User not found in context")
+		return
+	}
+
+	c.JSON(http.StatusOK, h.authService.GetPersonalAccessTokens(user.(*models.User).ID))
+}
+
+// CreateAccessToken handles creating a personal access token
+// @Summary Create access token
+// @Description Create a personal access token for machine clients such as CI. The token is scoped to read-lab, create-lab and/or delete-lab and is only shown in this response.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreatePersonalAccessTokenRequest true "Token name, scopes and optional expiry"
+// @Success 201 {object} models.CreatePersonalAccessTokenResponse
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Router /tokens [post]
+func (h *Handler) CreateAccessToken(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "User not found in context")
+		return
+	}
+
+	var req models.CreatePersonalAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	expiresIn := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	token, accessToken, err := h.authService.CreatePersonalAccessToken(user.(*models.User).ID, req.Name, req.Scopes, expiresIn)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidTokenScope) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: apiErrorFor(http.StatusBadRequest, err).WithDetail("valid_scopes", models.ValidTokenScopes)})
+			return
+		}
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to create access token")
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.CreatePersonalAccessTokenResponse{
+		Token:               token,
+		PersonalAccessToken: *accessToken,
+	})
+}
+
+// RevokeAccessToken handles revoking one of the current user's personal access tokens
+// @Summary Revoke access token
+// @Description Revoke a personal access token so it can no longer be used
+// @Tags auth
+// @Security BearerAuth
+// @Param id path string true "Token ID"
+// @Success 204 "No content"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 404 {object} handlers.ErrorResponse "Token not found"
+// @Router /tokens/{id} [delete]
+func (h *Handler) RevokeAccessToken(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "User not found in context")
+		return
+	}
+
+	if err := h.authService.RevokePersonalAccessToken(user.(*models.User).ID, c.Param("id")); err != nil {
+		if err == auth.ErrAccessTokenNotFound {
+			respondError(c, http.StatusNotFound, models.CodeAccessTokenNotFound, "Access token not found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to revoke access token")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
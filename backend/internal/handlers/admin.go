@@ -1,12 +1,21 @@
 package handlers
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/wcrum/labby/internal/auth"
 	"github.com/wcrum/labby/internal/interfaces"
+	"github.com/wcrum/labby/internal/lab"
 	"github.com/wcrum/labby/internal/models"
 	"github.com/wcrum/labby/internal/services"
 
@@ -32,6 +41,21 @@ type AdminCleanupByLabRequest struct {
 	LabID string `json:"lab_id" binding:"required"` // Required: lab UUID
 }
 
+// AdminBulkLabRequest represents a request to apply an action to many labs, selected by ID or by filter
+type AdminBulkLabRequest struct {
+	Action string              `json:"action" binding:"required"` // Required: stop, delete or cleanup
+	LabIDs []string            `json:"lab_ids,omitempty"`         // Labs to act on; takes precedence over filter
+	Filter *AdminBulkLabFilter `json:"filter,omitempty"`          // Selects labs when lab_ids is empty
+}
+
+// AdminBulkLabFilter selects labs for a bulk action. At least one field must be set.
+type AdminBulkLabFilter struct {
+	OwnerID   string           `json:"owner_id,omitempty"`
+	Status    models.LabStatus `json:"status,omitempty"`
+	Tag       string           `json:"tag,omitempty"`
+	OlderThan string           `json:"older_than,omitempty"` // Go duration, e.g. "24h"
+}
+
 // ServiceInfo represents information about a service configuration
 type ServiceInfo struct {
 	ID          string `json:"id"`
@@ -61,10 +85,12 @@ type ParameterInfo struct {
 // @Tags admin
 // @Produce json
 // @Security BearerAuth
+// @Param include query string false "Set to credentials to include each lab's credentials inline"
+// @Param tag query string false "Only labs carrying this tag"
 // @Success 200 {array} models.LabResponse
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /admin/labs [get]
 func (h *Handler) GetAllLabs(c *gin.Context) {
 	fmt.Printf("GetAllLabs: Admin request received\n")
@@ -73,25 +99,430 @@ func (h *Handler) GetAllLabs(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
 		fmt.Printf("GetAllLabs: No user found in context\n")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "User not found in context")
 		return
 	}
 
 	userObj := user.(*models.User)
 	fmt.Printf("GetAllLabs: User %s (role: %s) requesting all labs\n", userObj.Email, userObj.Role)
 
-	labs := h.labService.GetAllLabs()
+	labs := h.adminLabs(c)
 	fmt.Printf("GetAllLabs: Found %d labs\n", len(labs))
 
+	if tag := strings.TrimSpace(c.Query("tag")); tag != "" {
+		var tagged []*models.Lab
+		for _, lab := range labs {
+			if lab.HasTag(tag) {
+				tagged = append(tagged, lab)
+			}
+		}
+		labs = tagged
+	}
+
 	// Convert Labs to LabResponses
 	labResponses := make([]*models.LabResponse, len(labs))
 	for i, lab := range labs {
-		labResponses[i] = h.labService.ConvertLabToResponse(lab, h.authService)
+		labResponses[i] = h.labResponse(c, lab)
 	}
 
 	c.JSON(http.StatusOK, labResponses)
 }
 
+// GetLabTagCounts handles counting labs by tag (admin only)
+// @Summary Count labs by tag (admin)
+// @Description Count the labs carrying each tag, e.g. how many labs belong to an event. Org admins only count their organization's labs. (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]int "Labs per tag"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Router /admin/labs/tags [get]
+func (h *Handler) GetLabTagCounts(c *gin.Context) {
+	c.JSON(http.StatusOK, lab.CountLabsByTag(h.adminLabs(c)))
+}
+
+// adminLabs returns the labs the current admin can see: every lab, or for org admins
+// the labs owned by members of their organization
+func (h *Handler) adminLabs(c *gin.Context) []*models.Lab {
+	labs := h.labService.GetAllLabs()
+	orgID, scoped := orgScope(c)
+	if !scoped {
+		return labs
+	}
+
+	var orgLabs []*models.Lab
+	for _, lab := range labs {
+		if h.labInOrganization(lab, orgID) {
+			orgLabs = append(orgLabs, lab)
+		}
+	}
+	fmt.Printf("adminLabs: %d labs in organization %s\n", len(orgLabs), orgID)
+	return orgLabs
+}
+
+// SearchLabs handles searching labs by credential contents, notes and service data (admin only)
+// @Summary Search labs (admin)
+// @Description Case-insensitive search across lab names, credential usernames, URLs and notes, and non-secret service data such as project names (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param q query string true "Search text (at least 2 characters)"
+// @Param include query string false "Set to credentials to include each lab's credentials inline"
+// @Success 200 {array} map[string]interface{} "Matching labs with highlighted matches"
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Router /admin/labs/search [get]
+func (h *Handler) SearchLabs(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if len(query) < 2 {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Query parameter 'q' must be at least 2 characters")
+		return
+	}
+
+	results := h.labService.SearchLabs(query)
+	fmt.Printf("SearchLabs: Query %q matched %d labs\n", query, len(results))
+
+	response := make([]gin.H, 0, len(results))
+	for _, result := range results {
+		response = append(response, gin.H{
+			"lab":     h.labResponse(c, result.Lab),
+			"matches": result.Matches,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// BulkLabAction handles stopping, deleting or cleaning up many labs at once (admin only)
+// @Summary Bulk lab operation (admin)
+// @Description Apply stop, delete or cleanup to the given lab IDs, or to every lab matching a filter. Labs are processed concurrently and a result is returned per lab. (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body AdminBulkLabRequest true "Bulk action and the labs to apply it to"
+// @Success 200 {object} map[string]interface{} "Per-lab results"
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Router /admin/labs/bulk [post]
+func (h *Handler) BulkLabAction(c *gin.Context) {
+	var req AdminBulkLabRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !lab.IsValidBulkAction(req.Action) {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "action must be one of stop, delete or cleanup")
+		return
+	}
+
+	var labIDs []string
+	if len(req.LabIDs) > 0 {
+		seen := make(map[string]bool)
+		for _, labID := range req.LabIDs {
+			if labID == "" || seen[labID] {
+				continue
+			}
+			seen[labID] = true
+			labIDs = append(labIDs, labID)
+		}
+	} else {
+		if req.Filter == nil {
+			respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "lab_ids or filter is required")
+			return
+		}
+
+		filter := lab.BulkLabFilter{
+			OwnerID: req.Filter.OwnerID,
+			Status:  req.Filter.Status,
+			Tag:     strings.TrimSpace(req.Filter.Tag),
+		}
+		if req.Filter.OlderThan != "" {
+			olderThan, err := time.ParseDuration(req.Filter.OlderThan)
+			if err != nil || olderThan <= 0 {
+				respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "older_than must be a positive duration such as 24h")
+				return
+			}
+			filter.OlderThan = olderThan
+		}
+
+		// Refuse to act on every lab by accident
+		if filter.IsEmpty() {
+			respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "filter must set at least one of owner_id, status, tag or older_than")
+			return
+		}
+
+		labIDs = h.labService.FindLabIDs(filter)
+	}
+
+	results, err := h.labService.BulkLabAction(req.Action, labIDs)
+	if err != nil {
+		respondWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	succeeded := 0
+	for _, result := range results {
+		if result.Success {
+			succeeded++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"action":    req.Action,
+		"total":     len(results),
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+		"results":   results,
+	})
+}
+
+// GetLabResources handles returning the inventory of resources a lab provisioned (admin only)
+// @Summary Get lab resource inventory (admin)
+// @Description Get the resources a lab owns grouped by service type, derived from its service data and naming conventions. Secrets are redacted. (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Success 200 {object} lab.LabResourceInventory
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Router /admin/labs/{id}/resources [get]
+func (h *Handler) GetLabResources(c *gin.Context) {
+	labID := c.Param("id")
+	if labID == "" {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
+		return
+	}
+
+	inventory, err := h.labService.GetLabResourceInventory(labID)
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab resources")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, inventory)
+}
+
+// GetLabTerraformConfig handles downloading the Terraform configuration a lab's workspaces were set up with (admin only)
+// @Summary Download lab Terraform configuration (admin)
+// @Description Render the Terraform files and workspace variables uploaded for a lab's Terraform Cloud workspaces again from their service config and the lab's variables, and return them as a zip. Sensitive variable values are redacted. (admin only)
+// @Tags admin
+// @Produce application/zip
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Success 200 {file} file "Zip of the rendered configuration"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found or lab has no Terraform Cloud service"
+// @Failure 500 {object} handlers.ErrorResponse "Configuration could not be rendered"
+// @Router /admin/labs/{id}/terraform-config [get]
+func (h *Handler) GetLabTerraformConfig(c *gin.Context) {
+	labID := c.Param("id")
+	if labID == "" {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
+		return
+	}
+
+	files, err := h.labService.GetTerraformConfiguration(labID)
+	if err != nil {
+		if errors.Is(err, lab.ErrLabNotFound) || errors.Is(err, lab.ErrNoTerraformService) {
+			respondWithError(c, http.StatusNotFound, err)
+		} else {
+			respondWithError(c, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	data, err := zipFiles(files)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to create configuration archive")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=lab-%s-terraform.zip", labID))
+	c.Data(http.StatusOK, "application/zip", data)
+}
+
+// zipFiles writes files, keyed by path, into a zip archive in path order
+func zipFiles(files map[string]string) ([]byte, error) {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, path := range paths {
+		file, err := writer.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(file, files[path]); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GetLabCleanupState handles returning a lab's per-service cleanup progress (admin only)
+// @Summary Get lab cleanup state (admin)
+// @Description Get the cleanup status, attempt count and last error of each service used by a lab. Services without an entry have not been cleaned up yet. (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Success 200 {object} map[string]interface{} "Cleanup state"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Router /admin/labs/{id}/cleanup [get]
+func (h *Handler) GetLabCleanupState(c *gin.Context) {
+	labID := c.Param("id")
+	if labID == "" {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
+		return
+	}
+
+	state, err := h.labService.GetLabCleanupState(labID)
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab cleanup state")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lab_id":          labID,
+		"services":        state,
+		"failed_services": state.FailedServices(),
+	})
+}
+
+// RetryLabCleanup handles re-running cleanup for a lab's failed services (admin only)
+// @Summary Retry failed lab cleanup (admin)
+// @Description Re-run cleanup for only the services whose last cleanup attempt failed. Services that completed are not touched. (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Success 200 {object} map[string]interface{} "Updated cleanup state"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 409 {object} handlers.ErrorResponse "No failed services to retry, or cleanup already in progress"
+// @Router /admin/labs/{id}/cleanup/retry [post]
+func (h *Handler) RetryLabCleanup(c *gin.Context) {
+	labID := c.Param("id")
+	if labID == "" {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
+		return
+	}
+
+	state, err := h.labService.RetryLabCleanup(c.Request.Context(), labID)
+	if err != nil {
+		switch err {
+		case lab.ErrLabNotFound:
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		case lab.ErrNoFailedCleanup:
+			respondError(c, http.StatusConflict, models.CodeNoFailedCleanup, "Lab has no failed service cleanups to retry")
+		case lab.ErrCleanupInProgress:
+			respondError(c, http.StatusConflict, models.CodeCleanupInProgress, "Cleanup already in progress for this lab")
+		default:
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to retry lab cleanup")
+		}
+		return
+	}
+
+	failed := state.FailedServices()
+	c.JSON(http.StatusOK, gin.H{
+		"lab_id":          labID,
+		"success":         len(failed) == 0,
+		"services":        state,
+		"failed_services": failed,
+	})
+}
+
+// ListLabRegistrationTokens handles listing the device registration tokens issued for a lab (admin only)
+// @Summary List lab registration tokens (admin)
+// @Description List the registration tokens, such as Palette edge tokens, that the lab's services issued and that still exist. Labs already removed after cleanup are matched by lab ID. (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Success 200 {object} map[string]interface{} "Registration tokens"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 502 {object} handlers.ErrorResponse "Backing system could not list tokens"
+// @Router /admin/labs/{id}/registration-tokens [get]
+func (h *Handler) ListLabRegistrationTokens(c *gin.Context) {
+	labID := c.Param("id")
+	if labID == "" {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
+		return
+	}
+
+	tokens, err := h.labService.ListRegistrationTokens(c.Request.Context(), labID)
+	if err != nil {
+		respondError(c, http.StatusBadGateway, models.CodeUpstreamError, fmt.Sprintf("Failed to list registration tokens: %v", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lab_id": labID,
+		"tokens": tokens,
+	})
+}
+
+// RevokeLabRegistrationToken handles revoking a single registration token of a lab (admin only)
+// @Summary Revoke lab registration token (admin)
+// @Description Revoke one of the registration tokens listed for a lab, leaving the lab's other resources untouched (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Param tokenID path string true "Registration token UID"
+// @Success 200 {object} map[string]interface{} "Token revoked"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Token not found for this lab"
+// @Failure 502 {object} handlers.ErrorResponse "Backing system rejected the revocation"
+// @Router /admin/labs/{id}/registration-tokens/{tokenID} [delete]
+func (h *Handler) RevokeLabRegistrationToken(c *gin.Context) {
+	labID := c.Param("id")
+	tokenID := c.Param("tokenID")
+	if labID == "" || tokenID == "" {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID and token ID are required")
+		return
+	}
+
+	if err := h.labService.RevokeRegistrationToken(c.Request.Context(), labID, tokenID); err != nil {
+		if errors.Is(err, lab.ErrRegistrationTokenNotFound) {
+			respondError(c, http.StatusNotFound, models.CodeRegistrationTokenNotFound, "Registration token not found for this lab")
+		} else {
+			respondError(c, http.StatusBadGateway, models.CodeUpstreamError, fmt.Sprintf("Failed to revoke registration token: %v", err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Registration token revoked"})
+}
+
 // LoadTemplates handles loading lab templates from a directory (admin only)
 // @Summary Load lab templates (admin)
 // @Description Load lab templates from a directory (admin only)
@@ -99,101 +530,174 @@ func (h *Handler) GetAllLabs(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param request body map[string]string true "Directory path"
+// @Param request body models.LoadTemplatesRequest true "Directory path"
 // @Success 200 {object} map[string]interface{} "Templates loaded"
-// @Failure 400 {object} map[string]interface{} "Bad request"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /admin/templates/load [post]
 func (h *Handler) LoadTemplates(c *gin.Context) {
-	var req map[string]string
+	var req models.LoadTemplatesRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	dirPath, exists := req["directory"]
-	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Directory path is required"})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
-	err := h.labService.LoadTemplates(dirPath)
+	err := h.labService.LoadTemplates(req.Directory)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load templates"})
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to load templates")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Templates loaded successfully"})
 }
 
-// GetUsers handles getting all users (admin only)
-// @Summary Get all users (admin)
-// @Description Get all users in the system with organization information (admin only)
+// Page sizes for the admin user list
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
+// defaultInactiveUserDays is the inactivity window used when listing inactive users
+const defaultInactiveUserDays = 90
+
+// GetUsers handles listing users (admin only)
+// @Summary List users (admin)
+// @Description List users with their organization, filtered by role, organization and a name/email search and paginated (admin only)
 // @Tags admin
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {array} models.UserWithOrganization
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Param role query string false "Only users with this role (user, admin, org_admin)"
+// @Param org_id query string false "Only members of this organization"
+// @Param q query string false "Case-insensitive search in name and email"
+// @Param page query int false "Page number, starting at 1" default(1)
+// @Param page_size query int false "Users per page, at most 200" default(50)
+// @Success 200 {object} models.UserPage
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /admin/users [get]
 func (h *Handler) GetUsers(c *gin.Context) {
-	users := h.authService.GetAllUsers()
+	filter := models.UserFilter{
+		Role:           models.UserRole(c.Query("role")),
+		OrganizationID: c.Query("org_id"),
+		Query:          strings.TrimSpace(c.Query("q")),
+	}
+	switch filter.Role {
+	case "", models.UserRoleUser, models.UserRoleAdmin, models.UserRoleOrgAdmin:
+	default:
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "role must be one of user, admin or org_admin")
+		return
+	}
 
-	// Convert users to UserWithOrganization format
-	usersWithOrg := make([]*models.UserWithOrganization, len(users))
-	orgService := services.NewOrganizationService()
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "page must be a positive integer")
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultUserPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxUserPageSize {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, fmt.Sprintf("page_size must be between 1 and %d", maxUserPageSize))
+		return
+	}
+
+	users, total := h.authService.QueryUsers(filter, (page-1)*pageSize, pageSize)
+
+	c.JSON(http.StatusOK, models.UserPage{
+		Users:    h.withOrganizations(users),
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	})
+}
+
+// GetInactiveUsers handles listing users who haven't logged in recently (admin only)
+// @Summary List inactive users (admin)
+// @Description List users who haven't logged in within the given number of days, longest inactive first. Users who never logged in count from their account creation. (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param days query int false "Inactivity window in days" default(90)
+// @Success 200 {object} map[string]interface{} "Inactive users and the cutoff used"
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Router /admin/users/inactive [get]
+func (h *Handler) GetInactiveUsers(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultInactiveUserDays)))
+	if err != nil || days < 1 {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "days must be a positive integer")
+		return
+	}
 
+	cutoff := time.Now().AddDate(0, 0, -days)
+	users := h.authService.InactiveUsers(cutoff)
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":   days,
+		"cutoff": cutoff,
+		"users":  h.withOrganizations(users),
+		"total":  len(users),
+	})
+}
+
+// withOrganizations attaches each user's organization and last login, looking organizations up once rather than once per user
+func (h *Handler) withOrganizations(users []*models.User) []*models.UserWithOrganization {
+	organizations := make(map[string]*models.Organization)
+	for _, org := range services.NewOrganizationService().GetAllOrganizations() {
+		organizations[org.ID] = org
+	}
+
+	usersWithOrg := make([]*models.UserWithOrganization, len(users))
 	for i, user := range users {
 		userWithOrg := &models.UserWithOrganization{
-			ID:        user.ID,
-			Email:     user.Email,
-			Name:      user.Name,
-			Role:      user.Role,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
+			ID:          user.ID,
+			Email:       user.Email,
+			Name:        user.Name,
+			Role:        user.Role,
+			CreatedAt:   user.CreatedAt,
+			UpdatedAt:   user.UpdatedAt,
+			LastLoginAt: h.authService.LastLoginAt(user.ID),
 		}
-
-		// If user has an organization, fetch organization details
 		if user.OrganizationID != nil {
-			org, err := orgService.GetOrganization(*user.OrganizationID)
-			if err == nil {
-				userWithOrg.Organization = org
-			}
+			userWithOrg.Organization = organizations[*user.OrganizationID]
 		}
-
 		usersWithOrg[i] = userWithOrg
 	}
-
-	c.JSON(http.StatusOK, usersWithOrg)
+	return usersWithOrg
 }
 
 // CreateUser handles creating a new user (admin only)
 // @Summary Create user (admin)
-// @Description Create a new user (admin only)
+// @Description Create a new user (admin only). Emails are stored lowercase and must be unique in any case.
 // @Tags admin
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param request body models.CreateUserRequest true "User creation request"
 // @Success 201 {object} models.User
-// @Failure 400 {object} map[string]interface{} "Bad request"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 409 {object} handlers.ErrorResponse "A user with this email already exists"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /admin/users [post]
 func (h *Handler) CreateUser(c *gin.Context) {
 	var req models.CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	user, err := h.authService.CreateUser(req.Email, req.Name, req.Role)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		if errors.Is(err, auth.ErrEmailTaken) {
+			respondWithError(c, http.StatusConflict, err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to create user")
 		return
 	}
 
@@ -208,48 +712,35 @@ func (h *Handler) CreateUser(c *gin.Context) {
 // @Produce json
 // @Security BearerAuth
 // @Param id path string true "User ID"
-// @Param request body map[string]string true "Role update request"
+// @Param request body models.UpdateUserRoleRequest true "Role update request"
 // @Success 200 {object} models.User
-// @Failure 400 {object} map[string]interface{} "Bad request"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
-// @Failure 404 {object} map[string]interface{} "User not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "User not found"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /admin/users/{id}/role [put]
 func (h *Handler) UpdateUserRole(c *gin.Context) {
 	userID := c.Param("id")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "User ID is required")
 		return
 	}
 
-	var req map[string]string
+	// Roles other than user, admin and org_admin are rejected with a field-level error
+	var req models.UpdateUserRoleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	roleStr, exists := req["role"]
-	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Role is required"})
-		return
-	}
-
-	// Convert string to UserRole
-	var role models.UserRole
-	switch roleStr {
-	case "admin":
-		role = models.UserRoleAdmin
-	case "user":
-		role = models.UserRoleUser
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role. Must be 'admin' or 'user'"})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
-	err := h.authService.UpdateUserRole(userID, role)
+	err := h.authService.UpdateUserRole(userID, req.Role)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user role"})
+		if errors.Is(err, auth.ErrUserNotFound) {
+			respondWithError(c, http.StatusNotFound, err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to update user role")
 		return
 	}
 
@@ -263,27 +754,84 @@ func (h *Handler) UpdateUserRole(c *gin.Context) {
 // @Security BearerAuth
 // @Param id path string true "User ID"
 // @Success 204 "No content"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
-// @Failure 404 {object} map[string]interface{} "User not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "User not found"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /admin/users/{id} [delete]
 func (h *Handler) DeleteUser(c *gin.Context) {
 	userID := c.Param("id")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "User ID is required")
 		return
 	}
 
 	err := h.authService.DeleteUser(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to delete user")
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
 
+// ImpersonateUser handles issuing a token to act as a user for support (admin only)
+// @Summary Impersonate user (admin)
+// @Description Issue a 15 minute token that acts as the user, so support can see their labs and credentials as they do (admin only). The token is flagged as impersonation in its claims and can't be used for admin routes, access token management or one-time credential reveals. Admins can't be impersonated. Issuing the token and every request made with it are recorded in the impersonation audit log.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.ImpersonateUserRequest true "Reason for impersonating the user"
+// @Success 201 {object} models.ImpersonationResponse
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden or the user can't be impersonated"
+// @Failure 404 {object} handlers.ErrorResponse "User not found"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
+// @Router /admin/users/{id}/impersonate [post]
+func (h *Handler) ImpersonateUser(c *gin.Context) {
+	user, _ := c.Get("user")
+
+	var req models.ImpersonateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	impersonation, err := h.authService.GenerateImpersonationToken(user.(*models.User), c.Param("id"), strings.TrimSpace(req.Reason))
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrUserNotFound):
+			respondWithError(c, http.StatusNotFound, err)
+		case errors.Is(err, auth.ErrCannotImpersonate):
+			respondWithError(c, http.StatusForbidden, err)
+		default:
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to generate impersonation token")
+		}
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, impersonation)
+}
+
+// GetImpersonationAudit handles listing the impersonation audit log (admin only)
+// @Summary Get impersonation audit log (admin)
+// @Description List impersonation tokens issued and the requests made with them, newest first (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param user_id query string false "Only entries where this user was impersonated or impersonating"
+// @Success 200 {array} models.ImpersonationAuditEntry
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Router /admin/impersonations [get]
+func (h *Handler) GetImpersonationAudit(c *gin.Context) {
+	c.JSON(http.StatusOK, h.authService.GetImpersonationAudit(c.Query("user_id")))
+}
+
 // AdminCleanupService handles flexible cleanup for any service (admin only)
 // @Summary Cleanup any service with custom parameters (admin)
 // @Description Clean up resources for any service type with custom input parameters (admin only)
@@ -293,21 +841,21 @@ func (h *Handler) DeleteUser(c *gin.Context) {
 // @Security BearerAuth
 // @Param request body AdminCleanupRequest true "Service cleanup request"
 // @Success 200 {object} map[string]interface{} "Cleanup successful"
-// @Failure 400 {object} map[string]interface{} "Bad request"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /admin/cleanup/service [post]
 func (h *Handler) AdminCleanupService(c *gin.Context) {
 	var req AdminCleanupRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	// Validate required fields
 	if req.ServiceType == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "service_type is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "service_type is required")
 		return
 	}
 
@@ -318,7 +866,7 @@ func (h *Handler) AdminCleanupService(c *gin.Context) {
 	// Get the service by type
 	service, exists := serviceManager.GetServiceByType(req.ServiceType)
 	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Service type '%s' not found. Available types: palette_project, palette_tenant, proxmox_user, terraform_cloud, guacamole", req.ServiceType)})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, fmt.Sprintf("Service type '%s' not found. Available types: %s", req.ServiceType, strings.Join(serviceManager.GetServiceTypes(), ", ")))
 		return
 	}
 
@@ -326,7 +874,7 @@ func (h *Handler) AdminCleanupService(c *gin.Context) {
 	if req.ServiceConfigID != "" {
 		serviceConfig, exists := serviceConfigManager.GetServiceConfig(req.ServiceConfigID)
 		if !exists {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Service config '%s' not found", req.ServiceConfigID)})
+			respondError(c, http.StatusBadRequest, models.CodeServiceConfigNotFound, fmt.Sprintf("Service config '%s' not found", req.ServiceConfigID))
 			return
 		}
 
@@ -334,7 +882,12 @@ func (h *Handler) AdminCleanupService(c *gin.Context) {
 		if configurableService, ok := service.(interface {
 			ConfigureFromServiceConfig(*models.ServiceConfig)
 		}); ok {
-			configurableService.ConfigureFromServiceConfig(serviceConfig)
+			resolvedConfig, err := resolveServiceConfigSecrets(serviceConfig)
+			if err != nil {
+				respondWithError(c, http.StatusInternalServerError, err)
+				return
+			}
+			configurableService.ConfigureFromServiceConfig(resolvedConfig)
 		}
 	}
 
@@ -353,7 +906,7 @@ func (h *Handler) AdminCleanupService(c *gin.Context) {
 	// Execute cleanup
 	err := service.ExecuteCleanup(cleanupCtx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to cleanup %s service: %v", req.ServiceType, err)})
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, fmt.Sprintf("Failed to cleanup %s service: %v", req.ServiceType, err))
 		return
 	}
 
@@ -365,6 +918,21 @@ func (h *Handler) AdminCleanupService(c *gin.Context) {
 	})
 }
 
+// GetServiceTypes returns the registered service types and the config each accepts
+// @Summary Get service types (admin)
+// @Description List the service types service configs can use, with each service's name, description, required parameters and the keys its config accepts (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} services.ServiceTypeDescription
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Router /admin/service-types [get]
+func (h *Handler) GetServiceTypes(c *gin.Context) {
+	serviceManager := services.NewServiceManager(h.labService.GetServiceConfigManager())
+	c.JSON(http.StatusOK, serviceManager.DescribeServiceTypes())
+}
+
 // AdminGetAvailableServices returns all available service types and their cleanup parameters
 // @Summary Get available services for cleanup (admin)
 // @Description Get all available service types and their cleanup parameters (admin only)
@@ -372,11 +940,12 @@ func (h *Handler) AdminCleanupService(c *gin.Context) {
 // @Produce json
 // @Security BearerAuth
 // @Success 200 {object} map[string]interface{} "Available services"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
 // @Router /admin/cleanup/services [get]
 func (h *Handler) AdminGetAvailableServices(c *gin.Context) {
 	serviceConfigManager := h.labService.GetServiceConfigManager()
+	serviceManager := services.NewServiceManager(serviceConfigManager)
 
 	// Get all service configs
 	serviceConfigs := serviceConfigManager.GetAllServiceConfigs()
@@ -399,10 +968,11 @@ func (h *Handler) AdminGetAvailableServices(c *gin.Context) {
 	// Get cleanup parameters for each service type
 	serviceTypes := []ServiceTypeInfo{}
 	for serviceType, configs := range servicesByType {
+		service, _ := serviceManager.GetServiceByType(serviceType)
 		serviceInfo := ServiceTypeInfo{
 			Type:       serviceType,
 			Configs:    configs,
-			Parameters: getCleanupParametersForServiceType(serviceType),
+			Parameters: getCleanupParametersForServiceType(serviceType, service),
 		}
 		serviceTypes = append(serviceTypes, serviceInfo)
 	}
@@ -419,8 +989,8 @@ func (h *Handler) AdminGetAvailableServices(c *gin.Context) {
 				"service_config_id": "palette-project",
 				"lab_id":            "abc123",
 				"parameters": gin.H{
-					"project_name": "lab-abc123",
-					"user_email":   "lab+abc123@spectrocloud.com",
+					"palette_project_name":       "lab-abc123",
+					"palette_project_user_email": "lab+abc123@spectrocloud.com",
 				},
 			},
 		},
@@ -436,25 +1006,25 @@ func (h *Handler) AdminGetAvailableServices(c *gin.Context) {
 // @Security BearerAuth
 // @Param request body AdminCleanupServiceByIDRequest true "Service cleanup request"
 // @Success 200 {object} map[string]interface{} "Cleanup successful"
-// @Failure 400 {object} map[string]interface{} "Bad request"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /admin/cleanup/service-by-id [post]
 func (h *Handler) AdminCleanupServiceByID(c *gin.Context) {
 	var req AdminCleanupServiceByIDRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	// Validate required fields
 	if req.ServiceConfigID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "service_config_id is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "service_config_id is required")
 		return
 	}
 	if req.LabID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "lab_id is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "lab_id is required")
 		return
 	}
 
@@ -465,14 +1035,14 @@ func (h *Handler) AdminCleanupServiceByID(c *gin.Context) {
 	// Get the specific service config
 	serviceConfig, exists := serviceConfigManager.GetServiceConfig(req.ServiceConfigID)
 	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Service config '%s' not found", req.ServiceConfigID)})
+		respondError(c, http.StatusBadRequest, models.CodeServiceConfigNotFound, fmt.Sprintf("Service config '%s' not found", req.ServiceConfigID))
 		return
 	}
 
 	// Get the service by type from the service config
 	service, exists := serviceManager.GetServiceByType(serviceConfig.Type)
 	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Service type '%s' not found for config '%s'", serviceConfig.Type, req.ServiceConfigID)})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, fmt.Sprintf("Service type '%s' not found for config '%s'", serviceConfig.Type, req.ServiceConfigID))
 		return
 	}
 
@@ -480,7 +1050,12 @@ func (h *Handler) AdminCleanupServiceByID(c *gin.Context) {
 	if configurableService, ok := service.(interface {
 		ConfigureFromServiceConfig(*models.ServiceConfig)
 	}); ok {
-		configurableService.ConfigureFromServiceConfig(serviceConfig)
+		resolvedConfig, err := resolveServiceConfigSecrets(serviceConfig)
+		if err != nil {
+			respondWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		configurableService.ConfigureFromServiceConfig(resolvedConfig)
 	}
 
 	// Create cleanup context with auto-constructed parameters
@@ -490,27 +1065,15 @@ func (h *Handler) AdminCleanupServiceByID(c *gin.Context) {
 		Lab:     nil, // No lab instance for admin cleanup
 	}
 
-	// Auto-construct parameters based on service type
-	switch serviceConfig.Type {
-	case "palette_project":
-		cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "palette_project_name", fmt.Sprintf("lab-%s", req.LabID))
-		cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "palette_user_email", fmt.Sprintf("lab+%s@spectrocloud.com", req.LabID))
-		cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "palette_api_key_name", fmt.Sprintf("lab-%s-api-key", req.LabID))
-	case "palette_tenant":
-		cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "palette_tenant_id", fmt.Sprintf("tenant-%s", req.LabID))
-	case "proxmox_user":
-		cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "proxmox_user_username", fmt.Sprintf("lab-%s@pve", req.LabID))
-		cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "proxmox_pool_name", fmt.Sprintf("lab-%s-pool", req.LabID))
-	case "terraform_cloud":
-		cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "terraform_workspace_name", fmt.Sprintf("lab-%s-workspace", req.LabID))
-	case "guacamole":
-		cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "guacamole_username", fmt.Sprintf("lab-%s", req.LabID))
+	// Pass the resource names the service derives from the lab ID
+	for key, value := range service.DescribeResources(req.LabID) {
+		cleanupCtx.Context = context.WithValue(cleanupCtx.Context, key, value)
 	}
 
 	// Execute cleanup
 	err := service.ExecuteCleanup(cleanupCtx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to cleanup service config '%s': %v", req.ServiceConfigID, err)})
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, fmt.Sprintf("Failed to cleanup service config '%s': %v", req.ServiceConfigID, err))
 		return
 	}
 
@@ -519,57 +1082,34 @@ func (h *Handler) AdminCleanupServiceByID(c *gin.Context) {
 		"service_config_id":          req.ServiceConfigID,
 		"service_type":               serviceConfig.Type,
 		"lab_id":                     req.LabID,
-		"auto_constructed_resources": getAutoConstructedResources(serviceConfig.Type, req.LabID),
+		"auto_constructed_resources": service.DescribeResources(req.LabID),
 	})
 }
 
-// getAutoConstructedResources returns the list of auto-constructed resource names for a service type
-func getAutoConstructedResources(serviceType, labID string) map[string]string {
-	resources := make(map[string]string)
-
-	switch serviceType {
-	case "palette_project":
-		resources["project_name"] = fmt.Sprintf("lab-%s", labID)
-		resources["user_email"] = fmt.Sprintf("lab+%s@spectrocloud.com", labID)
-		resources["api_key_name"] = fmt.Sprintf("lab-%s-api-key", labID)
-	case "palette_tenant":
-		resources["tenant_id"] = fmt.Sprintf("tenant-%s", labID)
-	case "proxmox_user":
-		resources["username"] = fmt.Sprintf("lab-%s@pve", labID)
-		resources["pool_name"] = fmt.Sprintf("lab-%s-pool", labID)
-	case "terraform_cloud":
-		resources["workspace_name"] = fmt.Sprintf("lab-%s-workspace", labID)
-	case "guacamole":
-		resources["username"] = fmt.Sprintf("lab-%s", labID)
-	}
-
-	return resources
-}
-
 // AdminCleanupByLab handles simplified cleanup by lab UUID only (admin only)
 // @Summary Cleanup all services for a lab by UUID (admin)
-// @Description Clean up all resources for a lab using just the lab UUID - automatically constructs all resource names (admin only)
+// @Description Clean up all resources for a lab using just the lab UUID - automatically constructs all resource names, and reports the outcome of each resource (admin only)
 // @Tags admin
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param request body AdminCleanupByLabRequest true "Lab cleanup request"
 // @Success 200 {object} map[string]interface{} "Cleanup successful"
-// @Failure 400 {object} map[string]interface{} "Bad request"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /admin/cleanup/lab [post]
 func (h *Handler) AdminCleanupByLab(c *gin.Context) {
 	var req AdminCleanupByLabRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	// Validate required fields
 	if req.LabID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "lab_id is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "lab_id is required")
 		return
 	}
 
@@ -579,17 +1119,30 @@ func (h *Handler) AdminCleanupByLab(c *gin.Context) {
 
 	// Get all available service types
 	serviceConfigs := serviceConfigManager.GetAllServiceConfigs()
-	serviceTypes := make(map[string]bool)
+	seenTypes := make(map[string]bool)
+	serviceTypes := []string{}
 	for _, config := range serviceConfigs {
-		serviceTypes[config.Type] = true
+		if !seenTypes[config.Type] {
+			seenTypes[config.Type] = true
+			serviceTypes = append(serviceTypes, config.Type)
+		}
 	}
+	sort.Strings(serviceTypes)
 
-	// Track cleanup results
+	// Labs that still exist are cleaned up with their organization's service configs
+	var organizationID string
+	if labInstance, err := h.labService.GetLab(req.LabID); err == nil {
+		organizationID = labInstance.OrganizationID
+	}
+
+	// Track cleanup results, per service type and per resource
 	results := make(map[string]interface{})
 	errors := make(map[string]string)
+	resources := []interfaces.ResourceCleanupResult{}
+	failedResources := 0
 
 	// Cleanup each service type
-	for serviceType := range serviceTypes {
+	for _, serviceType := range serviceTypes {
 		service, exists := serviceManager.GetServiceByType(serviceType)
 		if !exists {
 			errors[serviceType] = "Service not available"
@@ -597,14 +1150,16 @@ func (h *Handler) AdminCleanupByLab(c *gin.Context) {
 		}
 
 		// Configure service with service config if available
-		for _, config := range serviceConfigs {
-			if config.Type == serviceType && config.IsActive {
-				if configurableService, ok := service.(interface {
-					ConfigureFromServiceConfig(*models.ServiceConfig)
-				}); ok {
-					configurableService.ConfigureFromServiceConfig(config)
+		if config := cleanupConfigForType(serviceConfigs, serviceType, organizationID); config != nil {
+			if configurableService, ok := service.(interface {
+				ConfigureFromServiceConfig(*models.ServiceConfig)
+			}); ok {
+				resolvedConfig, err := resolveServiceConfigSecrets(config)
+				if err != nil {
+					errors[serviceType] = err.Error()
+					continue
 				}
-				break
+				configurableService.ConfigureFromServiceConfig(resolvedConfig)
 			}
 		}
 
@@ -615,27 +1170,29 @@ func (h *Handler) AdminCleanupByLab(c *gin.Context) {
 			Lab:     nil, // No lab instance for admin cleanup
 		}
 
-		// Auto-construct common parameters based on service type
-		switch serviceType {
-		case "palette_project":
-			cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "palette_project_name", fmt.Sprintf("lab-%s", req.LabID))
-			cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "palette_user_email", fmt.Sprintf("lab+%s@spectrocloud.com", req.LabID))
-			cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "palette_api_key_name", fmt.Sprintf("lab-%s-api-key", req.LabID))
-		case "palette_tenant":
-			cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "palette_tenant_id", fmt.Sprintf("tenant-%s", req.LabID))
-		case "proxmox_user":
-			cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "proxmox_user_username", fmt.Sprintf("lab-%s@pve", req.LabID))
-			cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "proxmox_pool_name", fmt.Sprintf("lab-%s-pool", req.LabID))
-		case "terraform_cloud":
-			cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "terraform_workspace_name", fmt.Sprintf("lab-%s-workspace", req.LabID))
-		case "guacamole":
-			cleanupCtx.Context = context.WithValue(cleanupCtx.Context, "guacamole_username", fmt.Sprintf("lab-%s", req.LabID))
+		// Pass the resource names the service derives from the lab ID
+		for key, value := range service.DescribeResources(req.LabID) {
+			cleanupCtx.Context = context.WithValue(cleanupCtx.Context, key, value)
+		}
+
+		// Collect the outcome of each resource the service cleans up
+		serviceFailures := 0
+		cleanupCtx.RecordResource = func(result interfaces.ResourceCleanupResult) {
+			result.Service = serviceType
+			if result.Status == interfaces.ResourceCleanupFailed {
+				serviceFailures++
+			}
+			resources = append(resources, result)
 		}
 
 		// Execute cleanup
 		err := service.ExecuteCleanup(cleanupCtx)
+		failedResources += serviceFailures
 		if err != nil {
 			errors[serviceType] = err.Error()
+		} else if serviceFailures > 0 {
+			// Services log and continue past failed sub-resources, so these would otherwise look successful
+			results[serviceType] = fmt.Sprintf("Cleanup completed with %d failed resource(s)", serviceFailures)
 		} else {
 			results[serviceType] = "Cleanup completed successfully"
 		}
@@ -643,12 +1200,14 @@ func (h *Handler) AdminCleanupByLab(c *gin.Context) {
 
 	// Prepare response
 	response := gin.H{
-		"message":    "Lab cleanup completed",
-		"lab_id":     req.LabID,
-		"results":    results,
-		"errors":     errors,
-		"successful": len(results),
-		"failed":     len(errors),
+		"message":          "Lab cleanup completed",
+		"lab_id":           req.LabID,
+		"results":          results,
+		"errors":           errors,
+		"successful":       len(results),
+		"failed":           len(errors),
+		"resources":        resources,
+		"failed_resources": failedResources,
 	}
 
 	// Determine HTTP status
@@ -661,95 +1220,156 @@ func (h *Handler) AdminCleanupByLab(c *gin.Context) {
 	}
 }
 
-// getCleanupParametersForServiceType returns the cleanup parameters for a specific service type
-func getCleanupParametersForServiceType(serviceType string) []ParameterInfo {
-	switch serviceType {
-	case "palette_project":
-		return []ParameterInfo{
-			{
-				Name:        "project_name",
-				Description: "Name of the Palette project to cleanup (e.g., 'lab-abc123')",
-				Required:    false,
-				Example:     "lab-abc123",
-			},
-			{
-				Name:        "user_email",
-				Description: "Email of the user to cleanup (e.g., 'lab+abc123@spectrocloud.com')",
-				Required:    false,
-				Example:     "lab+abc123@spectrocloud.com",
-			},
-			{
-				Name:        "api_key_name",
-				Description: "Name of the API key to cleanup (e.g., 'lab-abc123-api-key')",
-				Required:    false,
-				Example:     "lab-abc123-api-key",
-			},
+// cleanupConfigForType picks the service config of a type to clean up a lab with: one of the lab's
+// organization if there is one, otherwise a global one. Active configs are preferred, but inactive ones
+// are still used since deactivating a config only stops new labs from being provisioned with it.
+func cleanupConfigForType(configs []*models.ServiceConfig, serviceType, organizationID string) *models.ServiceConfig {
+	var best *models.ServiceConfig
+	bestRank := 0
+	for _, config := range configs {
+		if config.Type != serviceType {
+			continue
 		}
-	case "palette_tenant":
-		return []ParameterInfo{
-			{
-				Name:        "tenant_id",
-				Description: "ID of the tenant to cleanup (e.g., 'tenant-abc123')",
-				Required:    false,
-				Example:     "tenant-abc123",
-			},
+
+		rank := 0
+		switch {
+		case organizationID != "" && config.OrganizationID == organizationID:
+			rank = 3
+		case config.OrganizationID == "":
+			rank = 1
+		default:
+			continue
 		}
-	case "proxmox_user":
-		return []ParameterInfo{
-			{
-				Name:        "username",
-				Description: "Proxmox username to cleanup (e.g., 'lab-abc123@pve')",
-				Required:    false,
-				Example:     "lab-abc123@pve",
-			},
-			{
-				Name:        "pool_name",
-				Description: "Resource pool name to cleanup (e.g., 'lab-abc123-pool')",
-				Required:    false,
-				Example:     "lab-abc123-pool",
-			},
+		if config.IsActive {
+			rank++
+		}
+		if rank > bestRank {
+			best, bestRank = config, rank
 		}
-	case "terraform_cloud":
-		return []ParameterInfo{
-			{
-				Name:        "workspace_name",
-				Description: "Terraform Cloud workspace name to cleanup (e.g., 'lab-abc123-workspace')",
+	}
+	return best
+}
+
+// GetReconcileReport returns the report of the most recent orphan sweep (admin only)
+// @Summary Get last orphan sweep report (admin)
+// @Description Get the report of the most recent orphan sweep, periodic or admin-triggered (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} lab.ReconcileReport "Last sweep report"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "No sweep has run yet"
+// @Router /admin/reconcile [get]
+func (h *Handler) GetReconcileReport(c *gin.Context) {
+	report := h.labService.GetReconciler().GetLastReport()
+	if report == nil {
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "No reconcile sweep has run yet")
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// RunReconcile runs a real orphan sweep, cleaning up stray resources (admin only)
+// @Summary Clean up orphaned resources (admin)
+// @Description Clean up lab-named resources whose labs no longer exist and are older than the grace period (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param dry_run query bool false "Only report orphans without deleting them"
+// @Success 200 {object} lab.ReconcileReport "Sweep report"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Router /admin/reconcile [post]
+func (h *Handler) RunReconcile(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+	report := h.labService.GetReconciler().Run(dryRun)
+	c.JSON(http.StatusOK, report)
+}
+
+// cleanupExampleLabID is the lab ID used to build example cleanup parameters
+const cleanupExampleLabID = "abc123"
+
+// getCleanupParametersForServiceType returns the cleanup parameters for a service type: the resource
+// names the service derives from the lab ID, plus the IDs it only learns during setup
+func getCleanupParametersForServiceType(serviceType string, service interfaces.Service) []ParameterInfo {
+	parameters := []ParameterInfo{}
+
+	if service != nil {
+		resources := service.DescribeResources(cleanupExampleLabID)
+		keys := make([]string, 0, len(resources))
+		for key := range resources {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			parameters = append(parameters, ParameterInfo{
+				Name:        key,
+				Description: fmt.Sprintf("Resource name to cleanup, derived from the lab ID if omitted (e.g., '%s')", resources[key]),
 				Required:    false,
-				Example:     "lab-abc123-workspace",
-			},
+				Example:     resources[key],
+			})
 		}
-	case "guacamole":
-		return []ParameterInfo{
-			{
-				Name:        "username",
-				Description: "Guacamole username to cleanup (e.g., 'lab-abc123')",
+	}
+
+	switch serviceType {
+	case "vault":
+		parameters = append(parameters, ParameterInfo{
+			Name:        "vault_lease_id",
+			Description: "Vault lease ID to revoke (e.g., 'database/creds/lab/abc123')",
+			Required:    true,
+			Example:     "database/creds/lab/abc123",
+		})
+	case "azure":
+		parameters = append(parameters,
+			ParameterInfo{
+				Name:        "azure_role_assignment_id",
+				Description: "Full ID of the role assignment to delete",
 				Required:    false,
-				Example:     "lab-abc123",
+				Example:     "/subscriptions/.../resourcegroups/lab-abc123/providers/Microsoft.Authorization/roleAssignments/...",
 			},
-		}
-	default:
-		return []ParameterInfo{
-			{
-				Name:        "lab_id",
-				Description: "Lab ID for context (used to construct resource names)",
+			ParameterInfo{
+				Name:        "azure_application_object_id",
+				Description: "Object ID of the lab application registration (looked up by name 'lab-{id}' if omitted)",
 				Required:    false,
-				Example:     "abc123",
+				Example:     "00000000-0000-0000-0000-000000000000",
 			},
-		}
+		)
+	case "http":
+		parameters = append(parameters, ParameterInfo{
+			Name:        "http_teardown_url",
+			Description: "Teardown URL of the resource to remove, called with DELETE",
+			Required:    true,
+			Example:     "https://provisioner.internal/api/environments/env-123",
+		})
+	}
+
+	if len(parameters) == 0 {
+		parameters = append(parameters, ParameterInfo{
+			Name:        "lab_id",
+			Description: "Lab ID for context (used to construct resource names)",
+			Required:    false,
+			Example:     cleanupExampleLabID,
+		})
 	}
+
+	return parameters
 }
 
 // GetServiceConfigs returns all service configurations
 // @Summary Get service configurations
-// @Description Get all service configurations (admin only)
+// @Description Get all service configurations (admin only). Responses carry an ETag and Last-Modified so unchanged lists can be skipped.
 // @Tags admin
 // @Produce json
 // @Security BearerAuth
+// @Param If-None-Match header string false "ETag of a previous response"
 // @Success 200 {array} models.ServiceConfig
+// @Success 304 "Not modified"
 // @Router /admin/service-configs [get]
 func (h *Handler) GetServiceConfigs(c *gin.Context) {
-	configs := h.labService.GetServiceConfigManager().GetAllServiceConfigs()
-	c.JSON(http.StatusOK, configs)
+	h.serviceConfigCache.serve(c, "all", func() interface{} {
+		return h.labService.GetServiceConfigManager().GetAllServiceConfigs()
+	})
 }
 
 // GetServiceLimits returns all service limits
@@ -778,6 +1398,43 @@ func (h *Handler) GetServiceUsage(c *gin.Context) {
 	c.JSON(http.StatusOK, usage)
 }
 
+// GetVlanUsage returns VLAN tag utilization
+// @Summary Get VLAN usage
+// @Description Get the utilization of every range Terraform Cloud configs allocate VLAN tags from with ${unique_integer(min,max)}, with the lab holding each tag in use. A range alerts once its utilization reaches VLAN_ALERT_THRESHOLD percent; labs that would need a tag from a full range fail with "no VLAN available" (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.VlanRangeUsage
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Router /admin/vlan-usage [get]
+func (h *Handler) GetVlanUsage(c *gin.Context) {
+	c.JSON(http.StatusOK, services.GetVlanTagUsage())
+}
+
+// ReloadServiceConfigs reloads service configs and limits from disk
+// @Summary Reload service configurations
+// @Description Reload service configurations and limits from the directories they were loaded from at startup and swap them in at once, without a restart (admin only). Configs and limits created or updated through the API since are replaced. Nothing is replaced when a file fails to load.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} lab.ServiceConfigReload
+// @Failure 409 {object} handlers.ErrorResponse "Service configs were not loaded from a directory"
+// @Failure 422 {object} handlers.ErrorResponse "A service config or limit file failed to load"
+// @Router /admin/service-configs/reload [post]
+func (h *Handler) ReloadServiceConfigs(c *gin.Context) {
+	reload, err := h.labService.ReloadServiceConfigs()
+	if err != nil {
+		if errors.Is(err, lab.ErrServiceConfigsNotLoaded) {
+			respondWithError(c, http.StatusConflict, err)
+			return
+		}
+		respondWithError(c, http.StatusUnprocessableEntity, err)
+		return
+	}
+	c.JSON(http.StatusOK, reload)
+}
+
 // CreateServiceConfig creates a new service configuration
 // @Summary Create service configuration
 // @Description Create a new service configuration (admin only)
@@ -787,11 +1444,16 @@ func (h *Handler) GetServiceUsage(c *gin.Context) {
 // @Security BearerAuth
 // @Param config body models.ServiceConfig true "Service configuration"
 // @Success 201 {object} models.ServiceConfig
+// @Failure 400 {object} handlers.ErrorResponse "Invalid service configuration"
 // @Router /admin/service-configs [post]
 func (h *Handler) CreateServiceConfig(c *gin.Context) {
 	var config models.ServiceConfig
 	if err := c.ShouldBindJSON(&config); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	if err := lab.ValidateServiceSettings(&config); err != nil {
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -799,6 +1461,7 @@ func (h *Handler) CreateServiceConfig(c *gin.Context) {
 	now := time.Now()
 	config.CreatedAt = now
 	config.UpdatedAt = now
+	config.Version = 1
 
 	h.labService.GetServiceConfigManager().AddServiceConfig(&config)
 	c.JSON(http.StatusCreated, config)
@@ -817,7 +1480,7 @@ func (h *Handler) CreateServiceConfig(c *gin.Context) {
 func (h *Handler) CreateServiceLimit(c *gin.Context) {
 	var limit models.ServiceLimit
 	if err := c.ShouldBindJSON(&limit); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -825,6 +1488,7 @@ func (h *Handler) CreateServiceLimit(c *gin.Context) {
 	now := time.Now()
 	limit.CreatedAt = now
 	limit.UpdatedAt = now
+	limit.Version = 1
 
 	h.labService.GetServiceConfigManager().AddServiceLimit(&limit)
 	c.JSON(http.StatusCreated, limit)
@@ -832,7 +1496,7 @@ func (h *Handler) CreateServiceLimit(c *gin.Context) {
 
 // UpdateServiceConfig updates a service configuration
 // @Summary Update service configuration
-// @Description Update an existing service configuration (admin only)
+// @Description Create or update a service configuration (admin only). Updates must carry the version last read; a stale version is rejected with 409.
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -840,26 +1504,48 @@ func (h *Handler) CreateServiceLimit(c *gin.Context) {
 // @Param id path string true "Service configuration ID"
 // @Param config body models.ServiceConfig true "Service configuration"
 // @Success 200 {object} models.ServiceConfig
+// @Failure 400 {object} handlers.ErrorResponse
+// @Failure 409 {object} handlers.ErrorResponse
 // @Router /admin/service-configs/{id} [put]
 func (h *Handler) UpdateServiceConfig(c *gin.Context) {
 	id := c.Param("id")
 
 	var config models.ServiceConfig
 	if err := c.ShouldBindJSON(&config); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	config.ID = id
 	config.UpdatedAt = time.Now()
+	if err := lab.ValidateServiceSettings(&config); err != nil {
+		respondWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	configManager := h.labService.GetServiceConfigManager()
+	if err := configManager.UpdateServiceConfig(&config, config.Version); err != nil {
+		switch {
+		case errors.Is(err, models.ErrVersionRequired):
+			respondWithError(c, http.StatusBadRequest, err)
+		case errors.Is(err, models.ErrVersionConflict):
+			apiErr := apiErrorFor(http.StatusConflict, err)
+			if current, exists := configManager.GetServiceConfig(id); exists {
+				apiErr.WithDetail("current_version", current.Version)
+			}
+			c.JSON(http.StatusConflict, ErrorResponse{Error: apiErr})
+		default:
+			respondWithError(c, http.StatusInternalServerError, err)
+		}
+		return
+	}
 
-	h.labService.GetServiceConfigManager().AddServiceConfig(&config)
 	c.JSON(http.StatusOK, config)
 }
 
 // UpdateServiceLimit updates a service limit
 // @Summary Update service limit
-// @Description Update an existing service limit (admin only)
+// @Description Update an existing service limit (admin only). The body must carry the version last read; a stale version is rejected with 409. The service_id cannot be changed.
 // @Tags admin
 // @Accept json
 // @Produce json
@@ -867,23 +1553,82 @@ func (h *Handler) UpdateServiceConfig(c *gin.Context) {
 // @Param id path string true "Service limit ID"
 // @Param limit body models.ServiceLimit true "Service limit"
 // @Success 200 {object} models.ServiceLimit
+// @Failure 400 {object} handlers.ErrorResponse
+// @Failure 404 {object} handlers.ErrorResponse
+// @Failure 409 {object} handlers.ErrorResponse
 // @Router /admin/service-limits/{id} [put]
 func (h *Handler) UpdateServiceLimit(c *gin.Context) {
 	id := c.Param("id")
 
 	var limit models.ServiceLimit
 	if err := c.ShouldBindJSON(&limit); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if limit.Version == 0 {
+		respondError(c, http.StatusBadRequest, models.CodeVersionRequired, "version is required")
 		return
 	}
 
 	limit.ID = id
 	limit.UpdatedAt = time.Now()
 
-	h.labService.GetServiceConfigManager().AddServiceLimit(&limit)
+	configManager := h.labService.GetServiceConfigManager()
+	if err := configManager.UpdateServiceLimit(&limit, limit.Version); err != nil {
+		switch {
+		case errors.Is(err, models.ErrServiceLimitNotFound):
+			respondWithError(c, http.StatusNotFound, err)
+		case errors.Is(err, models.ErrServiceIDChanged):
+			respondWithError(c, http.StatusBadRequest, err)
+		case errors.Is(err, models.ErrVersionConflict):
+			apiErr := apiErrorFor(http.StatusConflict, err)
+			for _, current := range configManager.GetAllServiceLimits() {
+				if current.ID == id {
+					apiErr.WithDetail("current_version", current.Version)
+					break
+				}
+			}
+			c.JSON(http.StatusConflict, ErrorResponse{Error: apiErr})
+		default:
+			respondWithError(c, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
 	c.JSON(http.StatusOK, limit)
 }
 
+// TestServiceConfig runs a read-only connectivity and authentication probe against a service configuration
+// @Summary Test service configuration
+// @Description Configure the service from a stored service configuration and verify its host and credentials without creating anything (admin only). A failed probe returns 200 with success=false and the error.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Service configuration ID"
+// @Success 200 {object} lab.ServiceConfigTestResult
+// @Failure 400 {object} handlers.ErrorResponse "Service type cannot be tested"
+// @Failure 404 {object} handlers.ErrorResponse "Service configuration not found"
+// @Router /admin/service-configs/{id}/test [post]
+func (h *Handler) TestServiceConfig(c *gin.Context) {
+	id := c.Param("id")
+
+	result, err := h.labService.TestServiceConfig(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrServiceConfigNotFound):
+			respondError(c, http.StatusNotFound, models.CodeServiceConfigNotFound, "Service configuration not found")
+		case errors.Is(err, lab.ErrConnectionTestUnsupported):
+			respondWithError(c, http.StatusBadRequest, err)
+		default:
+			respondWithError(c, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 // DeleteServiceConfig deletes a service configuration
 // @Summary Delete service configuration
 // @Description Delete a service configuration (admin only)
@@ -913,3 +1658,14 @@ func (h *Handler) DeleteServiceLimit(c *gin.Context) {
 	h.labService.GetServiceConfigManager().RemoveServiceLimit(id)
 	c.Status(http.StatusNoContent)
 }
+
+// resolveServiceConfigSecrets returns a copy of a service config with its env: and vault: references resolved
+func resolveServiceConfigSecrets(serviceConfig *models.ServiceConfig) (*models.ServiceConfig, error) {
+	config, err := services.ResolveConfig(serviceConfig.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets of service config %s: %w", serviceConfig.ID, err)
+	}
+	resolved := *serviceConfig
+	resolved.Config = config
+	return &resolved, nil
+}
@@ -18,13 +18,13 @@ import (
 // @Produce json
 // @Param request body models.LoginRequest true "Login credentials"
 // @Success 200 {object} models.LoginResponse
-// @Failure 400 {object} map[string]interface{} "Bad request"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /auth/login [post]
 func (h *Handler) Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -46,13 +46,13 @@ func (h *Handler) Login(c *gin.Context) {
 
 	user, err := h.authService.LoginWithOrganization(req.Email, organizationID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Login failed")
 		return
 	}
 
 	token, err := h.authService.GenerateToken(user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to generate token")
 		return
 	}
 
@@ -69,12 +69,12 @@ func (h *Handler) Login(c *gin.Context) {
 // @Produce json
 // @Security BearerAuth
 // @Success 200 {object} models.User
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
 // @Router /auth/me [get]
 func (h *Handler) GetCurrentUser(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "User not found in context")
 		return
 	}
 
@@ -95,6 +95,31 @@ func (h *Handler) GetCurrentUser(c *gin.Context) {
 	c.JSON(http.StatusOK, userObj)
 }
 
+// Logout handles ending the current session
+// @Summary Log out
+// @Description Revoke the JWT used for this request so it can no longer be used
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} handlers.ErrorResponse "Not a session token"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Router /auth/logout [post]
+func (h *Handler) Logout(c *gin.Context) {
+	token, exists := c.Get("session_token")
+	if !exists {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Only session tokens can be logged out; revoke personal access tokens instead")
+		return
+	}
+
+	if err := h.authService.RevokeToken(token.(string)); err != nil {
+		respondWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
 // Helper function to create string pointer
 func stringPtr(s string) *string {
 	return &s
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cachedResponse is a serialized JSON response with its validators
+type cachedResponse struct {
+	body         []byte
+	etag         string
+	lastModified time.Time
+}
+
+// maxCachedResponses bounds how many distinct responses a cache holds, since keys are built from
+// query parameters
+const maxCachedResponses = 256
+
+// responseCache keeps serialized list responses in memory until the data behind them changes.
+// Invalidate is registered as a change hook on the managers the responses are built from.
+type responseCache struct {
+	entries    map[string]*cachedResponse
+	generation uint64 // Incremented on every invalidation so builds that raced one are not stored
+	mu         sync.RWMutex
+}
+
+// newResponseCache creates an empty response cache
+func newResponseCache() *responseCache {
+	return &responseCache{
+		entries: make(map[string]*cachedResponse),
+	}
+}
+
+// Invalidate drops every cached response
+func (rc *responseCache) Invalidate() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.entries = make(map[string]*cachedResponse)
+	rc.generation++
+}
+
+// get returns the cached response for key, building and storing it on a miss. An empty key
+// builds the response without caching it.
+func (rc *responseCache) get(key string, build func() interface{}) (*cachedResponse, error) {
+	rc.mu.RLock()
+	entry, exists := rc.entries[key]
+	generation := rc.generation
+	rc.mu.RUnlock()
+	if exists && key != "" {
+		return entry, nil
+	}
+
+	body, err := json.Marshal(build())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	entry = &cachedResponse{
+		body:         body,
+		etag:         `"` + hex.EncodeToString(sum[:8]) + `"`,
+		lastModified: time.Now().UTC().Truncate(time.Second),
+	}
+
+	rc.mu.Lock()
+	if key != "" && rc.generation == generation && len(rc.entries) < maxCachedResponses {
+		rc.entries[key] = entry
+	}
+	rc.mu.Unlock()
+
+	return entry, nil
+}
+
+// serve writes the cached response for key, answering 304 Not Modified when the client's
+// If-None-Match or If-Modified-Since shows it already has the current version
+func (rc *responseCache) serve(c *gin.Context, key string, build func() interface{}) {
+	entry, err := rc.get(key, build)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to encode response")
+		return
+	}
+
+	c.Header("ETag", entry.etag)
+	c.Header("Last-Modified", entry.lastModified.Format(http.TimeFormat))
+	c.Header("Cache-Control", "private, no-cache")
+
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		if match == entry.etag || match == "*" {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	} else if since := c.GetHeader("If-Modified-Since"); since != "" {
+		if sinceTime, err := http.ParseTime(since); err == nil && !entry.lastModified.After(sinceTime) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", entry.body)
+}
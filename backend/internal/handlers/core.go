@@ -2,35 +2,61 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/wcrum/labby/internal/auth"
 	"github.com/wcrum/labby/internal/lab"
 	"github.com/wcrum/labby/internal/models"
+	"github.com/wcrum/labby/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 // Handler contains all the handlers
 type Handler struct {
-	authService *auth.Service
-	labService  *lab.Service
+	authService        *auth.Service
+	labService         *lab.Service
+	templateCache      *responseCache // GET /templates responses
+	serviceConfigCache *responseCache // GET /admin/service-configs responses
+	inviteEmail        *services.EmailService
+	frontendURL        string // Base URL invite links in emails point to
 }
 
 // NewHandler creates a new handler
 func NewHandler(authService *auth.Service, labService *lab.Service) *Handler {
-	return &Handler{
-		authService: authService,
-		labService:  labService,
+	h := &Handler{
+		authService:        authService,
+		labService:         labService,
+		templateCache:      newResponseCache(),
+		serviceConfigCache: newResponseCache(),
 	}
+
+	// Templates embed service types and logos from their service configs, so both invalidate the template cache
+	labService.OnTemplatesChange(h.templateCache.Invalidate)
+	labService.GetServiceConfigManager().OnChange(h.templateCache.Invalidate)
+	labService.GetServiceConfigManager().OnChange(h.serviceConfigCache.Invalidate)
+
+	return h
+}
+
+// SetInviteEmail sets how invite links are emailed. email may be nil to disable invite emails.
+func (h *Handler) SetInviteEmail(email *services.EmailService, frontendURL string) {
+	h.inviteEmail = email
+	h.frontendURL = strings.TrimSuffix(frontendURL, "/")
 }
 
-// AuthMiddleware validates JWT tokens
+// AuthMiddleware validates JWT tokens and personal access tokens
 func (h *Handler) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := c.GetHeader("Authorization")
 
+		// Browsers can't set headers on WebSocket connections, so upgrades may pass the token as a query parameter
+		if token == "" && strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+			token = c.Query("token")
+		}
+
 		if token == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "Authorization header required")
 			c.Abort()
 			return
 		}
@@ -40,14 +66,78 @@ func (h *Handler) AuthMiddleware() gin.HandlerFunc {
 			token = token[7:]
 		}
 
-		user, err := h.authService.ValidateToken(token)
+		// Personal access tokens only reach the routes their scopes allow
+		if auth.IsPersonalAccessToken(token) {
+			user, accessToken, err := h.authService.ValidatePersonalAccessToken(token)
+			if err != nil {
+				respondError(c, http.StatusUnauthorized, models.CodeInvalidToken, "Invalid token")
+				c.Abort()
+				return
+			}
+
+			scope, allowed := personalAccessTokenRoutes[c.Request.Method+" "+c.FullPath()]
+			if !allowed || !accessToken.HasScope(scope) {
+				respondError(c, http.StatusForbidden, models.CodeForbidden, "Access token does not allow this action")
+				c.Abort()
+				return
+			}
+
+			c.Set("user", user)
+			c.Set("access_token", accessToken)
+			c.Next()
+			return
+		}
+
+		user, claims, err := h.authService.ValidateTokenClaims(token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			respondError(c, http.StatusUnauthorized, models.CodeInvalidToken, "Invalid token")
 			c.Abort()
 			return
 		}
 
 		c.Set("user", user)
+		c.Set("session_token", token)
+		c.Set("token_claims", claims)
+		if !claims.IsImpersonation() {
+			c.Next()
+			return
+		}
+
+		// Every request made while impersonating is audited, including those refused
+		c.Header("X-Impersonated-By", claims.ImpersonatorEmail)
+		c.Next()
+		action := models.ImpersonationAuditRequest
+		if c.GetBool("impersonation_denied") {
+			action = models.ImpersonationAuditDenied
+		}
+		h.authService.RecordImpersonation(claims, action, c.Request.Method, c.Request.URL.Path, c.Writer.Status(), "")
+	}
+}
+
+// impersonating reports whether the request was made with an impersonation token
+func impersonating(c *gin.Context) bool {
+	value, exists := c.Get("token_claims")
+	return exists && value.(*auth.JWTClaims).IsImpersonation()
+}
+
+// rejectImpersonation aborts with 403 when the request was made with an impersonation token
+func rejectImpersonation(c *gin.Context) bool {
+	if !impersonating(c) {
+		return false
+	}
+	c.Set("impersonation_denied", true)
+	respondError(c, http.StatusForbidden, models.CodeImpersonationNotAllowed, "Not allowed while impersonating a user")
+	c.Abort()
+	return true
+}
+
+// NoImpersonation refuses impersonation tokens on routes that only the user themselves may call, such as
+// managing their access tokens or using up a one-time credential reveal
+func (h *Handler) NoImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rejectImpersonation(c) {
+			return
+		}
 		c.Next()
 	}
 }
@@ -57,31 +147,200 @@ func (h *Handler) AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, exists := c.Get("user")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+			respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "User not found in context")
+			c.Abort()
+			return
+		}
+
+		// Impersonation tokens never carry admin access, whoever issued them
+		if rejectImpersonation(c) {
+			return
+		}
+
+		role, _ := requestIdentity(c, user.(*models.User))
+		if role != models.UserRoleAdmin {
+			respondError(c, http.StatusForbidden, models.CodeForbidden, "Admin access required")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// OrgAdminMiddleware allows global admins and organization admins.
+// Organization admins are scoped to their own organization via the "org_scope" context key.
+func (h *Handler) OrgAdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "User not found in context")
 			c.Abort()
 			return
 		}
 
-		userObj := user.(*models.User)
+		if rejectImpersonation(c) {
+			return
+		}
+
+		role, orgID := requestIdentity(c, user.(*models.User))
+		if role == models.UserRoleAdmin {
+			c.Next()
+			return
+		}
 
-		if !h.authService.IsAdmin(userObj) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		if role != models.UserRoleOrgAdmin || orgID == "" {
+			respondError(c, http.StatusForbidden, models.CodeForbidden, "Admin access required")
 			c.Abort()
 			return
 		}
 
+		c.Set("org_scope", orgID)
 		c.Next()
 	}
 }
 
+// requestIdentity returns the role and organization a request is authorized with: the claims of its
+// session token, or the user's current values for personal access tokens
+func requestIdentity(c *gin.Context, user *models.User) (models.UserRole, string) {
+	if value, exists := c.Get("token_claims"); exists {
+		claims := value.(*auth.JWTClaims)
+		return claims.Role, claims.OrganizationID
+	}
+
+	var orgID string
+	if user.OrganizationID != nil {
+		orgID = *user.OrganizationID
+	}
+	return user.Role, orgID
+}
+
+// orgScope returns the organization an org admin is restricted to, if any
+func orgScope(c *gin.Context) (string, bool) {
+	orgID, exists := c.Get("org_scope")
+	if !exists {
+		return "", false
+	}
+	return orgID.(string), true
+}
+
+// labInOrganization reports whether a lab's owner belongs to the given organization
+func (h *Handler) labInOrganization(labInstance *models.Lab, orgID string) bool {
+	return h.userInOrganization(labInstance.OwnerID, orgID)
+}
+
+// userInOrganization reports whether a user belongs to an organization
+func (h *Handler) userInOrganization(userID, orgID string) bool {
+	user, err := h.authService.GetUserByID(userID)
+	if err != nil || user.OrganizationID == nil {
+		return false
+	}
+	return *user.OrganizationID == orgID
+}
+
+// checkLabOrgScope aborts with 404 when an org admin targets a lab outside their organization
+func (h *Handler) checkLabOrgScope(c *gin.Context) bool {
+	orgID, scoped := orgScope(c)
+	if !scoped {
+		return true
+	}
+
+	labInstance, err := h.labService.GetLab(c.Param("id"))
+	if err != nil || !h.labInOrganization(labInstance, orgID) {
+		// Don't reveal labs belonging to other organizations
+		respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		return false
+	}
+	return true
+}
+
+// canAccessLab reports whether the current user owns the lab or is an admin
+func (h *Handler) canAccessLab(c *gin.Context, labInstance *models.Lab) bool {
+	user, exists := c.Get("user")
+	if !exists {
+		return false
+	}
+
+	userObj := user.(*models.User)
+	return labInstance.OwnerID == userObj.ID || h.authService.IsAdmin(userObj)
+}
+
+// canViewLab reports whether the current user can read the lab: its owner, an admin,
+// or a user the lab has been shared with
+func (h *Handler) canViewLab(c *gin.Context, labInstance *models.Lab) bool {
+	if h.canAccessLab(c, labInstance) {
+		return true
+	}
+
+	user, exists := c.Get("user")
+	if !exists {
+		return false
+	}
+
+	_, shared := h.labService.GetLabAccessLevel(labInstance.ID, user.(*models.User).ID)
+	return shared
+}
+
+// recordLabActivity restarts a lab's idle timer when its owner or a user it is shared with uses it.
+// Admins looking at a lab, including while impersonating the user, don't keep it alive.
+func (h *Handler) recordLabActivity(c *gin.Context, labInstance *models.Lab) {
+	user, exists := c.Get("user")
+	if !exists || impersonating(c) {
+		return
+	}
+	userID := user.(*models.User).ID
+	if labInstance.OwnerID != userID {
+		if _, shared := h.labService.GetLabAccessLevel(labInstance.ID, userID); !shared {
+			return
+		}
+	}
+	h.labService.RecordLabActivity(labInstance.ID)
+}
+
 // HealthCheck handles health check endpoint
 // @Summary Health check
-// @Description Check if the API is running
+// @Description Check the API and probe the endpoints of all active service configurations. Only the status of each dependency is shown; GET /api/admin/health has the details. Probe results are cached briefly.
 // @Tags system
 // @Produce json
-// @Success 200 {object} map[string]interface{} "API status"
+// @Success 200 {object} lab.HealthSummary "API and dependency status"
+// @Failure 503 {object} lab.HealthSummary "All dependencies unreachable"
+// @Router /health/ready [get]
 // @Router /health [get]
 func (h *Handler) HealthCheck(c *gin.Context) {
+	report := h.labService.CheckHealth(c.Request.Context())
+	c.JSON(healthStatus(report), report.Summary())
+}
+
+// AdminHealthCheck returns the detailed health report
+// @Summary Detailed health check
+// @Description Probe the endpoints of all active service configurations and report each one's name, endpoint, latency and error (admin only). Probe results are cached briefly.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} lab.HealthReport "API and dependency status"
+// @Failure 503 {object} lab.HealthReport "All dependencies unreachable"
+// @Router /admin/health [get]
+func (h *Handler) AdminHealthCheck(c *gin.Context) {
+	report := h.labService.CheckHealth(c.Request.Context())
+	c.JSON(healthStatus(report), report)
+}
+
+// healthStatus returns the HTTP status of a health report, 503 once every dependency is unreachable
+func healthStatus(report *lab.HealthReport) int {
+	if report.Status == lab.HealthStatusUnhealthy {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// LivenessCheck handles the lightweight liveness endpoint
+// @Summary Liveness check
+// @Description Check if the API process is running without probing dependencies
+// @Tags system
+// @Produce json
+// @Success 200 {object} map[string]interface{} "API status"
+// @Router /health/live [get]
+func (h *Handler) LivenessCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "healthy",
 		"message": "Spectro Lab Backend is running",
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wcrum/labby/internal/lab"
+	"github.com/wcrum/labby/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Page sizes of the lab credential list
+const (
+	defaultCredentialPageSize = 50
+	maxCredentialPageSize     = 200
+)
+
+// GetLabCredentials handles listing a lab's credentials a page at a time
+// @Summary List lab credentials
+// @Description List the credentials of a lab in the order they were issued (owner, admin or users the lab is shared with)
+// @Tags labs
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Param limit query int false "Credentials per page, at most 200" default(50)
+// @Param offset query int false "Credentials to skip" default(0)
+// @Success 200 {object} models.CredentialPage
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Router /labs/{id}/credentials [get]
+func (h *Handler) GetLabCredentials(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultCredentialPageSize)))
+	if err != nil || limit < 1 || limit > maxCredentialPageSize {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, fmt.Sprintf("limit must be between 1 and %d", maxCredentialPageSize))
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "offset must be a non-negative integer")
+		return
+	}
+
+	labInstance, ok := h.getLab(c)
+	if !ok {
+		return
+	}
+	if !h.canViewLab(c, labInstance) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access denied")
+		return
+	}
+
+	credentials, total, err := h.labService.GetLabCredentials(labInstance.ID, offset, limit)
+	if err != nil {
+		respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		return
+	}
+	h.recordLabActivity(c, labInstance)
+
+	c.JSON(http.StatusOK, models.CredentialPage{
+		Credentials: credentials,
+		Total:       total,
+		Limit:       limit,
+		Offset:      offset,
+	})
+}
+
+// ExportLabCredentials handles exporting a lab's credentials as a downloadable file
+// @Summary Export lab credentials
+// @Description Export all credentials of a lab as an env, json or csv file (owner, admin or users the lab is shared with)
+// @Tags labs
+// @Produce plain
+// @Produce json
+// @Produce text/csv
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Param format query string false "Export format: env, json or csv (default env)"
+// @Success 200 {file} file "Exported credentials"
+// @Failure 400 {object} handlers.ErrorResponse "Unsupported format"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 410 {object} handlers.ErrorResponse "Lab expired"
+// @Router /labs/{id}/credentials/export [get]
+func (h *Handler) ExportLabCredentials(c *gin.Context) {
+	labID := c.Param("id")
+	if labID == "" {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
+		return
+	}
+
+	labInstance, err := h.labService.GetLab(labID)
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab")
+		}
+		return
+	}
+
+	if !h.canViewLab(c, labInstance) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access denied")
+		return
+	}
+
+	if labInstance.Status == models.LabStatusExpired || models.IsExpired(labInstance.EndsAt) {
+		respondError(c, http.StatusGone, models.CodeLabExpired, "Lab has expired")
+		return
+	}
+
+	format := c.DefaultQuery("format", "env")
+	filename := fmt.Sprintf("%s-credentials", labInstance.Name)
+
+	switch format {
+	case "env":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.env", filename))
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", formatCredentialsEnv(labInstance.Credentials))
+	case "json":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.json", filename))
+		c.JSON(http.StatusOK, labInstance.Credentials)
+	case "csv":
+		data, err := formatCredentialsCSV(labInstance.Credentials)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to export credentials")
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+	default:
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Unsupported format. Must be 'env', 'json' or 'csv'")
+	}
+}
+
+// RotateLabCredential handles regenerating the secret of a single lab credential
+// @Summary Rotate lab credential
+// @Description Regenerate a credential's secret on the backing system without recreating the lab (owner or admin)
+// @Tags labs
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Param credID path string true "Credential ID"
+// @Success 200 {object} models.Credential "Rotated credential"
+// @Failure 400 {object} handlers.ErrorResponse "Credential cannot be rotated"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab or credential not found"
+// @Failure 409 {object} handlers.ErrorResponse "Lab not ready"
+// @Failure 502 {object} handlers.ErrorResponse "Backing system rejected the rotation"
+// @Router /labs/{id}/credentials/{credID}/rotate [post]
+func (h *Handler) RotateLabCredential(c *gin.Context) {
+	labInstance, ok := h.getOwnedLab(c)
+	if !ok {
+		return
+	}
+
+	credential, err := h.labService.RotateCredential(c.Request.Context(), labInstance.ID, c.Param("credID"))
+	if err != nil {
+		switch {
+		case errors.Is(err, lab.ErrLabNotFound):
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		case errors.Is(err, lab.ErrCredentialNotFound):
+			respondError(c, http.StatusNotFound, models.CodeCredentialNotFound, "Credential not found")
+		case errors.Is(err, lab.ErrLabNotReady):
+			respondError(c, http.StatusConflict, models.CodeLabNotReady, "Credentials can only be rotated while the lab is ready")
+		case errors.Is(err, lab.ErrRotationUnsupported), errors.Is(err, lab.ErrCredentialServiceUnknown):
+			respondWithError(c, http.StatusBadRequest, err)
+		default:
+			respondError(c, http.StatusBadGateway, models.CodeUpstreamError, fmt.Sprintf("Failed to rotate credential: %v", err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, credential)
+}
+
+// RevealLabCredential handles returning the secret of a one-time reveal credential
+// @Summary Reveal lab credential
+// @Description Return a credential's password and private key. One-time reveal credentials are masked everywhere else and can only be revealed once; the reveal is recorded with its time and user on the credential and in the lab's event timeline. Other credentials are returned as they are (owner or admin)
+// @Tags labs
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Param credID path string true "Credential ID"
+// @Success 200 {object} models.RevealedCredential
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab or credential not found"
+// @Failure 410 {object} handlers.ErrorResponse "Lab expired or credential already revealed"
+// @Router /labs/{id}/credentials/{credID}/reveal [post]
+func (h *Handler) RevealLabCredential(c *gin.Context) {
+	labInstance, ok := h.getOwnedLab(c)
+	if !ok {
+		return
+	}
+	user, _ := c.Get("user")
+	revealed, err := h.labService.RevealCredential(labInstance.ID, c.Param("credID"), user.(*models.User).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, lab.ErrLabNotFound), errors.Is(err, lab.ErrCredentialNotFound):
+			respondWithError(c, http.StatusNotFound, err)
+		case errors.Is(err, lab.ErrLabExpired), errors.Is(err, lab.ErrCredentialRevealed):
+			respondWithError(c, http.StatusGone, err)
+		default:
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to reveal credential")
+		}
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, revealed)
+}
+
+// formatCredentialsEnv renders credentials as LABEL_USERNAME / LABEL_PASSWORD / LABEL_URL lines, plus
+// LABEL_PUBLIC_KEY / LABEL_PRIVATE_KEY for SSH key credentials.
+// Labels that map to the same prefix get a numeric suffix so no variable is overwritten.
+func formatCredentialsEnv(credentials []models.Credential) []byte {
+	var buf bytes.Buffer
+	used := make(map[string]bool)
+	for _, credential := range credentials {
+		credential = credential.Masked()
+		prefix := envVarName(credential.Label)
+		for i := 2; used[prefix]; i++ {
+			prefix = fmt.Sprintf("%s_%d", envVarName(credential.Label), i)
+		}
+		used[prefix] = true
+
+		// Keep the label on its comment line when the file is sourced
+		fmt.Fprintf(&buf, "# %s\n", strings.NewReplacer("\r", " ", "\n", " ").Replace(credential.Label))
+		if credential.Username != "" {
+			fmt.Fprintf(&buf, "%s_USERNAME=%s\n", prefix, quoteEnvValue(credential.Username))
+		}
+		if credential.Password != "" {
+			fmt.Fprintf(&buf, "%s_PASSWORD=%s\n", prefix, quoteEnvValue(credential.Password))
+		}
+		if credential.URL != "" {
+			fmt.Fprintf(&buf, "%s_URL=%s\n", prefix, quoteEnvValue(credential.URL))
+		}
+		if credential.PublicKey != "" {
+			fmt.Fprintf(&buf, "%s_PUBLIC_KEY=%s\n", prefix, quoteEnvValue(credential.PublicKey))
+		}
+		if credential.PrivateKey != "" {
+			fmt.Fprintf(&buf, "%s_PRIVATE_KEY=%s\n", prefix, quoteEnvValue(credential.PrivateKey))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// formatCredentialsCSV renders credentials as a spreadsheet with a header row
+func formatCredentialsCSV(credentials []models.Credential) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	if err := writer.Write([]string{"label", "username", "password", "url", "expires_at", "notes", "credential_type", "public_key", "private_key"}); err != nil {
+		return nil, err
+	}
+	for _, credential := range credentials {
+		credential = credential.Masked()
+		record := []string{
+			credential.Label,
+			credential.Username,
+			credential.Password,
+			credential.URL,
+			credential.ExpiresAt.Format(time.RFC3339),
+			credential.Notes,
+			string(credential.CredentialType),
+			credential.PublicKey,
+			credential.PrivateKey,
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// envVarName converts a credential label into an upper-case environment variable prefix
+// made of [A-Z0-9_] only
+func envVarName(label string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			return r
+		default:
+			return '_'
+		}
+	}, strings.TrimSpace(label))
+
+	name = strings.Trim(name, "_")
+	if name == "" {
+		return "CREDENTIAL"
+	}
+	if first := []rune(name)[0]; first >= '0' && first <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// quoteEnvValue single-quotes a value so it can be safely sourced by a shell
+func quoteEnvValue(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/wcrum/labby/internal/auth"
+	"github.com/wcrum/labby/internal/lab"
+	"github.com/wcrum/labby/internal/models"
+	"github.com/wcrum/labby/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Error *models.APIError `json:"error"`
+}
+
+// errorCodes maps errors returned by the services to the codes clients see
+var errorCodes = []struct {
+	err  error
+	code models.ErrorCode
+}{
+	{lab.ErrLabNotFound, models.CodeLabNotFound},
+	{lab.ErrLabExpired, models.CodeLabExpired},
+	{lab.ErrLabNotReady, models.CodeLabNotReady},
+	{lab.ErrLabNotStopped, models.CodeLabNotStopped},
+	{lab.ErrLabNotScheduled, models.CodeLabNotScheduled},
+	{lab.ErrLabNotRetryable, models.CodeLabNotRetryable},
+	{lab.ErrLabNameTaken, models.CodeLabNameTaken},
+	{lab.ErrInvalidLabName, models.CodeInvalidLabName},
+	{lab.ErrInvalidLabTags, models.CodeInvalidLabTags},
+	{lab.ErrInvalidDuration, models.CodeInvalidDuration},
+	{lab.ErrLabLifetimeExceeded, models.CodeLabLifetimeExceeded},
+	{lab.ErrInvalidStartAt, models.CodeInvalidStartTime},
+	{lab.ErrInvalidNotification, models.CodeInvalidNotification},
+	{lab.ErrCleanupInProgress, models.CodeCleanupInProgress},
+	{lab.ErrNoFailedCleanup, models.CodeNoFailedCleanup},
+	{lab.ErrNoTerraformRun, models.CodeNoTerraformRun},
+	{lab.ErrNoTerraformService, models.CodeNoTerraformService},
+	{lab.ErrLabShareNotFound, models.CodeLabShareNotFound},
+	{lab.ErrTemplateNotFound, models.CodeTemplateNotFound},
+	{lab.ErrTemplateExists, models.CodeTemplateExists},
+	{lab.ErrInvalidTemplateBundle, models.CodeTemplateInvalid},
+	{lab.ErrCredentialNotFound, models.CodeCredentialNotFound},
+	{lab.ErrRotationUnsupported, models.CodeRotationUnsupported},
+	{lab.ErrCredentialRevealed, models.CodeCredentialRevealed},
+	{lab.ErrRegistrationTokenNotFound, models.CodeRegistrationTokenNotFound},
+	{models.ErrInvalidTemplateVariables, models.CodeInvalidTemplateVariables},
+	{lab.ErrInvalidServiceConfig, models.CodeInvalidServiceConfig},
+	{models.ErrServiceConfigNotFound, models.CodeServiceConfigNotFound},
+	{models.ErrServiceLimitNotFound, models.CodeServiceLimitNotFound},
+	{models.ErrServiceLimitExceeded, models.CodeServiceLimitReached},
+	{models.ErrVersionConflict, models.CodeVersionConflict},
+	{models.ErrVersionRequired, models.CodeVersionRequired},
+	{services.ErrOrganizationNotFound, models.CodeOrganizationNotFound},
+	{services.ErrInvalidOrganization, models.CodeInvalidOrganization},
+	{services.ErrInviteNotFound, models.CodeInviteNotFound},
+	{services.ErrInviteNotRenewable, models.CodeInviteNotRenewable},
+	{auth.ErrAccessTokenNotFound, models.CodeAccessTokenNotFound},
+	{auth.ErrUserNotFound, models.CodeUserNotFound},
+	{auth.ErrEmailTaken, models.CodeEmailTaken},
+	{auth.ErrInvalidTokenScope, models.CodeInvalidTokenScope},
+	{auth.ErrCannotImpersonate, models.CodeImpersonationNotAllowed},
+	{auth.ErrInvalidToken, models.CodeInvalidToken},
+	{auth.ErrTokenExpired, models.CodeInvalidToken},
+	{auth.ErrTokenRevoked, models.CodeInvalidToken},
+}
+
+// statusCodes are the codes of failures nothing more specific is known about
+var statusCodes = map[int]models.ErrorCode{
+	http.StatusBadRequest:          models.CodeInvalidRequest,
+	http.StatusUnauthorized:        models.CodeUnauthorized,
+	http.StatusForbidden:           models.CodeForbidden,
+	http.StatusNotFound:            models.CodeNotFound,
+	http.StatusConflict:            models.CodeConflict,
+	http.StatusGone:                models.CodeGone,
+	http.StatusUnprocessableEntity: models.CodeValidationFailed,
+	http.StatusTooManyRequests:     models.CodeRateLimited,
+	http.StatusBadGateway:          models.CodeUpstreamError,
+	http.StatusServiceUnavailable:  models.CodeServiceUnavailable,
+}
+
+// codeForStatus returns the generic code of an HTTP status
+func codeForStatus(status int) models.ErrorCode {
+	if code, exists := statusCodes[status]; exists {
+		return code
+	}
+	return models.CodeInternal
+}
+
+// respondError writes an error response with a code and message
+func respondError(c *gin.Context, status int, code models.ErrorCode, message string) {
+	c.JSON(status, ErrorResponse{Error: &models.APIError{Code: code, Message: message}})
+}
+
+// respondWithError writes err as an error response. An APIError in err's chain is sent as it is, request
+// bodies that fail validation get VALIDATION_FAILED with the rejected fields, known service errors get
+// their code and anything else the generic code of the status, with err's message.
+func respondWithError(c *gin.Context, status int, err error) {
+	c.JSON(status, ErrorResponse{Error: apiErrorFor(status, err)})
+}
+
+// isAPIError reports whether err's chain has an APIError with the given code
+func isAPIError(err error, code models.ErrorCode) bool {
+	apiErr, ok := models.AsAPIError(err)
+	return ok && apiErr.Code == code
+}
+
+// apiErrorFor returns the API error reported to clients for err
+func apiErrorFor(status int, err error) *models.APIError {
+	if apiErr, ok := models.AsAPIError(err); ok {
+		return apiErr
+	}
+	if apiErr, ok := validationError(err); ok {
+		return apiErr
+	}
+	for _, known := range errorCodes {
+		if errors.Is(err, known.err) {
+			return &models.APIError{Code: known.code, Message: err.Error()}
+		}
+	}
+	return &models.APIError{Code: codeForStatus(status), Message: err.Error()}
+}
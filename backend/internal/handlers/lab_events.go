@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wcrum/labby/internal/lab"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// labEventsKeepalive is how often an idle lab events connection is sent a keepalive message
+// so proxies don't close it
+const labEventsKeepalive = 30 * time.Second
+
+// AdminLabEvents handles the live lab dashboard WebSocket (admin only)
+// @Summary Stream lab events (admin)
+// @Description Upgrade to a WebSocket that first sends a snapshot of every lab, then pushes lab_created, lab_status_changed and lab_deleted events as they happen. Browsers may pass the token as the token query parameter. Org admins only receive labs in their organization. (admin only)
+// @Tags admin
+// @Security BearerAuth
+// @Param token query string false "Bearer token, for clients that can't set headers"
+// @Success 101 "Switching protocols"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Router /admin/labs/ws [get]
+func (h *Handler) AdminLabEvents(c *gin.Context) {
+	orgID, scoped := orgScope(c)
+
+	// The token is checked by the middleware, so the handshake doesn't need an origin check
+	server := websocket.Server{
+		Handler: func(conn *websocket.Conn) {
+			defer conn.Close()
+			h.streamLabEvents(conn, orgID, scoped)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// streamLabEvents writes the lab snapshot and then every lab event to a connection until it closes
+func (h *Handler) streamLabEvents(conn *websocket.Conn, orgID string, scoped bool) {
+	snapshot, events, unsubscribe := h.labService.SubscribeLabEvents()
+	defer unsubscribe()
+
+	visible := func(summary *lab.LabSummary) bool {
+		return !scoped || h.userInOrganization(summary.OwnerID, orgID)
+	}
+
+	labs := make([]lab.LabSummary, 0, len(snapshot.Labs))
+	for i := range snapshot.Labs {
+		if visible(&snapshot.Labs[i]) {
+			labs = append(labs, snapshot.Labs[i])
+		}
+	}
+	snapshot.Labs = labs
+
+	if err := websocket.JSON.Send(conn, snapshot); err != nil {
+		fmt.Printf("AdminLabEvents: failed to send snapshot: %v\n", err)
+		return
+	}
+
+	// Clients don't send anything, reading only tells us when the connection closes
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var message []byte
+		for {
+			if err := websocket.Message.Receive(conn, &message); err != nil {
+				return
+			}
+		}
+	}()
+
+	keepalive := time.NewTicker(labEventsKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case event := <-events:
+			if event.Lab != nil && !visible(event.Lab) {
+				continue
+			}
+			if err := websocket.JSON.Send(conn, event); err != nil {
+				fmt.Printf("AdminLabEvents: failed to send %s event: %v\n", event.Type, err)
+				return
+			}
+		case <-keepalive.C:
+			if err := websocket.JSON.Send(conn, gin.H{"type": "keepalive", "timestamp": time.Now()}); err != nil {
+				return
+			}
+		}
+	}
+}
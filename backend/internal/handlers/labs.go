@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/wcrum/labby/internal/interfaces"
 	"github.com/wcrum/labby/internal/lab"
@@ -13,69 +16,121 @@ import (
 
 // GetLabs handles getting all labs for a user
 // @Summary Get user labs
-// @Description Get all labs for the authenticated user
+// @Description Get the authenticated user's labs, newest first. Expired labs are left out unless status asks for them.
 // @Tags labs
 // @Produce json
 // @Security BearerAuth
+// @Param status query string false "Comma-separated statuses to include (provisioning, queued, ready, error, expired, scheduled), or all"
+// @Param include query string false "Set to credentials to include each lab's credentials inline"
 // @Success 200 {array} models.LabResponse
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 400 {object} handlers.ErrorResponse "Invalid status"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
 // @Router /labs [get]
 func (h *Handler) GetLabs(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "User not found in context")
 		return
 	}
 
-	userObj := user.(*models.User)
-	labs, err := h.labService.GetLabsByOwner(userObj.ID)
+	statuses, err := parseLabStatuses(c.Query("status"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get labs"})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
+	userObj := user.(*models.User)
+	labs := h.labService.QueryLabsByOwner(userObj.ID, statuses)
+
 	// Convert Labs to LabResponses
 	labResponses := make([]*models.LabResponse, len(labs))
 	for i, lab := range labs {
-		labResponses[i] = h.labService.ConvertLabToResponse(lab, h.authService)
+		labResponses[i] = h.labResponse(c, lab)
 	}
 
 	c.JSON(http.StatusOK, labResponses)
 }
 
+// parseLabStatuses parses the status filter of a lab list. "all" selects every status; an empty
+// value returns no statuses, leaving the default to the lab service.
+func parseLabStatuses(value string) ([]models.LabStatus, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	if value == "all" {
+		return []models.LabStatus{
+			models.LabStatusProvisioning,
+			models.LabStatusQueued,
+			models.LabStatusReady,
+			models.LabStatusError,
+			models.LabStatusExpired,
+			models.LabStatusScheduled,
+			models.LabStatusStopped,
+		}, nil
+	}
+
+	var statuses []models.LabStatus
+	for _, part := range strings.Split(value, ",") {
+		status := models.LabStatus(strings.TrimSpace(part))
+		if !models.IsValidLabStatus(status) {
+			return nil, fmt.Errorf("invalid status %q", part)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// labResponse converts a lab for a response. Credentials are left out, keeping lab lists and details
+// small, unless the request asks for them with include=credentials.
+func (h *Handler) labResponse(c *gin.Context, labInstance *models.Lab) *models.LabResponse {
+	response := h.labService.ConvertLabToResponse(labInstance, h.authService)
+	for _, include := range strings.Split(c.Query("include"), ",") {
+		if strings.TrimSpace(include) == "credentials" {
+			return response
+		}
+	}
+	response.Credentials = nil
+	return response
+}
+
 // GetLab handles getting a specific lab
 // @Summary Get lab
-// @Description Get a specific lab by ID
+// @Description Get a specific lab by ID (owner, admin or users the lab is shared with)
 // @Tags labs
 // @Produce json
 // @Security BearerAuth
 // @Param id path string true "Lab ID"
+// @Param include query string false "Set to credentials to include the lab's credentials inline"
 // @Success 200 {object} models.LabResponse
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 404 {object} map[string]interface{} "Lab not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /labs/{id} [get]
 func (h *Handler) GetLab(c *gin.Context) {
 	labID := c.Param("id")
 	if labID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Lab ID is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
 		return
 	}
 
 	labInstance, err := h.labService.GetLab(labID)
 	if err != nil {
 		if err == lab.ErrLabNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Lab not found"})
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get lab"})
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab")
 		}
 		return
 	}
 
-	// Convert Lab to LabResponse
-	labResponse := h.labService.ConvertLabToResponse(labInstance, h.authService)
-	c.JSON(http.StatusOK, labResponse)
+	if !h.canViewLab(c, labInstance) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access denied")
+		return
+	}
+
+	c.JSON(http.StatusOK, h.labResponse(c, labInstance))
 }
 
 // CreateLab handles creating a new lab
@@ -87,30 +142,35 @@ func (h *Handler) GetLab(c *gin.Context) {
 // @Security BearerAuth
 // @Param request body models.CreateLabRequest true "Lab creation request"
 // @Success 201 {object} models.Lab
-// @Failure 400 {object} map[string]interface{} "Bad request"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 409 {object} handlers.ErrorResponse "Lab name already in use"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /labs [post]
 func (h *Handler) CreateLab(c *gin.Context) {
 	var req models.CreateLabRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "User not found in context")
 		return
 	}
 
 	userObj := user.(*models.User)
-	labInstance, err := h.labService.CreateLab(req.Name, userObj.ID, req.Duration)
+	labInstance, err := h.labService.CreateLab(req.Name, userObj.ID, req.Duration, req.Tags)
 	if err != nil {
 		if err == lab.ErrInvalidDuration {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid duration"})
+			respondError(c, http.StatusBadRequest, models.CodeInvalidDuration, "Invalid duration")
+		} else if errors.Is(err, lab.ErrInvalidLabName) || errors.Is(err, lab.ErrInvalidLabTags) || errors.Is(err, lab.ErrLabLifetimeExceeded) {
+			respondWithError(c, http.StatusBadRequest, err)
+		} else if errors.Is(err, lab.ErrLabNameTaken) {
+			respondWithError(c, http.StatusConflict, err)
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create lab"})
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to create lab")
 		}
 		return
 	}
@@ -120,28 +180,53 @@ func (h *Handler) CreateLab(c *gin.Context) {
 
 // DeleteLab handles deleting a lab
 // @Summary Delete lab
-// @Description Delete a lab by ID
+// @Description Delete a lab by ID (owner or admin only)
 // @Tags labs
 // @Security BearerAuth
 // @Param id path string true "Lab ID"
 // @Success 204 "No content"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 404 {object} map[string]interface{} "Lab not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 409 {object} handlers.ErrorResponse "Cleanup already in progress"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /labs/{id} [delete]
 func (h *Handler) DeleteLab(c *gin.Context) {
 	labID := c.Param("id")
 	if labID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Lab ID is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
+		return
+	}
+
+	labInstance, err := h.labService.GetLab(labID)
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab")
+		}
 		return
 	}
 
+	// Users a lab is shared with can only observe it
+	if !h.canAccessLab(c, labInstance) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access denied")
+		return
+	}
+
+	h.deleteLab(c, labID)
+}
+
+// deleteLab deletes a lab and writes the response. Callers check access to the lab first.
+func (h *Handler) deleteLab(c *gin.Context, labID string) {
 	err := h.labService.DeleteLab(labID)
 	if err != nil {
 		if err == lab.ErrLabNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Lab not found"})
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else if errors.Is(err, lab.ErrCleanupInProgress) {
+			respondError(c, http.StatusConflict, models.CodeCleanupInProgress, "Cleanup already in progress for this lab")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete lab"})
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to delete lab")
 		}
 		return
 	}
@@ -149,30 +234,105 @@ func (h *Handler) DeleteLab(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+// UpdateLabTags handles replacing a lab's tags
+// @Summary Update lab tags
+// @Description Replace the tags of a lab (owner or admin only). Tags are lower-cased, may use letters, digits and . _ : / -, and key/value labels are written as key:value.
+// @Tags labs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Param request body models.UpdateLabTagsRequest true "The lab's new tags"
+// @Success 200 {object} models.LabResponse
+// @Failure 400 {object} handlers.ErrorResponse "Invalid tags"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Router /labs/{id}/tags [put]
+func (h *Handler) UpdateLabTags(c *gin.Context) {
+	var req models.UpdateLabTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	labInstance, err := h.labService.GetLab(c.Param("id"))
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab")
+		}
+		return
+	}
+
+	// Users a lab is shared with can only observe it
+	if !h.canAccessLab(c, labInstance) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access denied")
+		return
+	}
+
+	labInstance, err = h.labService.SetLabTags(labInstance.ID, req.Tags)
+	if err != nil {
+		if errors.Is(err, lab.ErrInvalidLabTags) {
+			respondWithError(c, http.StatusBadRequest, err)
+		} else if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to update lab tags")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, h.labResponse(c, labInstance))
+}
+
 // StopLab handles stopping a lab
 // @Summary Stop lab
-// @Description Stop a lab by ID (marks it as expired)
+// @Description Stop a lab by ID (owner or admin only). A ready lab keeps its resources for the stop grace period and can be resumed until then; other labs are marked as expired and cleaned up right away.
 // @Tags labs
 // @Security BearerAuth
 // @Param id path string true "Lab ID"
 // @Success 200 {object} models.Lab
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 404 {object} map[string]interface{} "Lab not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /labs/{id}/stop [post]
 func (h *Handler) StopLab(c *gin.Context) {
 	labID := c.Param("id")
 	if labID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Lab ID is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
+		return
+	}
+
+	labInstance, err := h.labService.GetLab(labID)
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab")
+		}
 		return
 	}
 
+	// Users a lab is shared with can only observe it
+	if !h.canAccessLab(c, labInstance) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access denied")
+		return
+	}
+
+	h.stopLab(c, labID)
+}
+
+// stopLab stops a lab and writes the updated lab. Callers check access to the lab first.
+func (h *Handler) stopLab(c *gin.Context, labID string) {
 	err := h.labService.StopLab(labID)
 	if err != nil {
 		if err == lab.ErrLabNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Lab not found"})
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop lab"})
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to stop lab")
 		}
 		return
 	}
@@ -180,41 +340,361 @@ func (h *Handler) StopLab(c *gin.Context) {
 	// Get the updated lab
 	labInstance, err := h.labService.GetLab(labID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get updated lab"})
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get updated lab")
+		return
+	}
+
+	c.JSON(http.StatusOK, labInstance)
+}
+
+// ResumeLab handles resuming a stopped lab
+// @Summary Resume lab
+// @Description Make a stopped lab ready again while its stop grace period lasts (owner or admin only)
+// @Tags labs
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Success 200 {object} models.Lab
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 409 {object} handlers.ErrorResponse "Lab is not stopped or its grace period has ended"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
+// @Router /labs/{id}/resume [post]
+func (h *Handler) ResumeLab(c *gin.Context) {
+	labID := c.Param("id")
+	if labID == "" {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
+		return
+	}
+
+	labInstance, err := h.labService.GetLab(labID)
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab")
+		}
+		return
+	}
+
+	// Users a lab is shared with can only observe it
+	if !h.canAccessLab(c, labInstance) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access denied")
+		return
+	}
+
+	h.resumeLab(c, labID)
+}
+
+// resumeLab resumes a stopped lab and writes it. Callers check access to the lab first.
+func (h *Handler) resumeLab(c *gin.Context, labID string) {
+	labInstance, err := h.labService.ResumeLab(labID)
+	if err != nil {
+		switch {
+		case errors.Is(err, lab.ErrLabNotFound):
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		case errors.Is(err, lab.ErrLabNotStopped):
+			respondError(c, http.StatusConflict, models.CodeLabNotStopped, "Only stopped labs can be resumed")
+		case errors.Is(err, lab.ErrLabExpired), errors.Is(err, lab.ErrCleanupInProgress):
+			respondError(c, http.StatusConflict, models.CodeLabExpired, "The lab's grace period has ended and it is being cleaned up")
+		default:
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to resume lab")
+		}
 		return
 	}
 
 	c.JSON(http.StatusOK, labInstance)
 }
 
+// RetryLabProvisioning handles re-running provisioning for a failed lab
+// @Summary Retry lab provisioning
+// @Description Re-run provisioning for a lab in error status. Services that completed in the earlier attempt keep their resources; failed and incomplete services are provisioned again. (owner or admin only)
+// @Tags labs
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Success 202 {object} models.Lab
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 409 {object} handlers.ErrorResponse "Lab is not in error status, or a service it needs again is at its limit"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
+// @Router /labs/{id}/retry [post]
+func (h *Handler) RetryLabProvisioning(c *gin.Context) {
+	labID := c.Param("id")
+	if labID == "" {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
+		return
+	}
+
+	labInstance, err := h.labService.GetLab(labID)
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab")
+		}
+		return
+	}
+
+	// Users a lab is shared with can only observe it
+	if !h.canAccessLab(c, labInstance) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access denied")
+		return
+	}
+
+	labInstance, err = h.labService.RetryLabProvisioning(labID)
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else if errors.Is(err, lab.ErrLabNotRetryable) || errors.Is(err, models.ErrServiceLimitExceeded) || isAPIError(err, models.CodeServiceNotAvailable) {
+			respondWithError(c, http.StatusConflict, err)
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to retry lab provisioning")
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, labInstance)
+}
+
+// LabHeartbeat handles the UI reporting that a lab is still in use
+// @Summary Lab heartbeat
+// @Description Report that a lab is still being used, restarting its idle timer. Ready labs unused for longer than LAB_IDLE_TIMEOUT expire even before their duration ends; fetching the lab's credentials or progress counts as use too. Heartbeats from admins the lab isn't shared with are not counted. (owner, admin or users the lab is shared with)
+// @Tags labs
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Success 200 {object} models.LabActivity
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Router /labs/{id}/heartbeat [post]
+func (h *Handler) LabHeartbeat(c *gin.Context) {
+	labInstance, ok := h.getLab(c)
+	if !ok {
+		return
+	}
+	if !h.canViewLab(c, labInstance) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access denied")
+		return
+	}
+
+	h.recordLabActivity(c, labInstance)
+	activity, err := h.labService.GetLabActivity(labInstance.ID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, activity)
+}
+
 // GetLabProgress handles getting lab progress
 // @Summary Get lab progress
-// @Description Get the progress of a lab's provisioning
+// @Description Get the progress of a lab's provisioning (owner, admin or users the lab is shared with)
 // @Tags labs
 // @Produce json
 // @Security BearerAuth
 // @Param id path string true "Lab ID"
 // @Success 200 {object} lab.LabProgress
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 404 {object} map[string]interface{} "Lab not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /labs/{id}/progress [get]
 func (h *Handler) GetLabProgress(c *gin.Context) {
 	labID := c.Param("id")
 	if labID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Lab ID is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
+		return
+	}
+
+	labInstance, err := h.labService.GetLab(labID)
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab")
+		}
+		return
+	}
+
+	if !h.canViewLab(c, labInstance) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access denied")
 		return
 	}
 
 	progress := h.labService.GetProgress(labID)
 	if progress == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Lab progress not found"})
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "Lab progress not found")
 		return
 	}
+	h.recordLabActivity(c, labInstance)
 
 	c.JSON(http.StatusOK, progress)
 }
 
+// GetLabDiagnostics handles explaining why a lab failed
+// @Summary Get lab diagnostics
+// @Description Get the failed service, step and error message of a lab together with the tail of its progress log (owner or admin)
+// @Tags labs
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Success 200 {object} lab.LabDiagnostics
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
+// @Router /labs/{id}/diagnostics [get]
+func (h *Handler) GetLabDiagnostics(c *gin.Context) {
+	labInstance, ok := h.getOwnedLab(c)
+	if !ok {
+		return
+	}
+
+	diagnostics, err := h.labService.GetLabDiagnostics(labInstance.ID)
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab diagnostics")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, diagnostics)
+}
+
+// GetLabEvents handles listing a lab's event timeline
+// @Summary Get lab events
+// @Description Get the ordered timeline of a lab's status transitions and progress log entries. Unlike progress, the timeline is kept after provisioning ends and for a while after the lab is removed. (owner or admin)
+// @Tags labs
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Success 200 {object} lab.LabTimeline
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Router /labs/{id}/events [get]
+func (h *Handler) GetLabEvents(c *gin.Context) {
+	timeline, err := h.labService.GetLabTimeline(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		return
+	}
+
+	// The lab may already be removed, so access is checked against the owner the timeline recorded
+	if !h.canAccessLab(c, &models.Lab{ID: timeline.LabID, OwnerID: timeline.OwnerID}) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access denied")
+		return
+	}
+
+	c.JSON(http.StatusOK, timeline)
+}
+
+// GetLabCost handles estimating a lab's cost
+// @Summary Get lab cost estimate
+// @Description Estimate a lab's cost to date and for its full duration from the hourly rates configured on its services. This is an estimate for chargeback, not billing data. (owner or admin)
+// @Tags labs
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Success 200 {object} lab.LabCostEstimate
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Router /labs/{id}/cost [get]
+func (h *Handler) GetLabCost(c *gin.Context) {
+	labInstance, ok := h.getOwnedLab(c)
+	if !ok {
+		return
+	}
+
+	estimate, err := h.labService.GetLabCostEstimate(labInstance.ID)
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to estimate lab cost")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, estimate)
+}
+
+// GetTerraformLogs streams the plan and apply logs of a lab's Terraform Cloud run
+// @Summary Get Terraform run logs
+// @Description Stream the plan and apply log output of the Terraform Cloud run backing a lab (owner, admin or users the lab is shared with)
+// @Tags labs
+// @Produce plain
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Success 200 {string} string "Plan and apply logs"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab or Terraform run not found"
+// @Failure 502 {object} handlers.ErrorResponse "Failed to fetch logs from Terraform Cloud"
+// @Router /labs/{id}/terraform-logs [get]
+func (h *Handler) GetTerraformLogs(c *gin.Context) {
+	labID := c.Param("id")
+	if labID == "" {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
+		return
+	}
+
+	labInstance, err := h.labService.GetLab(labID)
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab")
+		}
+		return
+	}
+
+	if !h.canViewLab(c, labInstance) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access denied")
+		return
+	}
+
+	runLogs, err := h.labService.GetTerraformRunLogs(labID)
+	if err != nil {
+		if err == lab.ErrNoTerraformRun {
+			respondError(c, http.StatusNotFound, models.CodeNoTerraformRun, "Lab has no Terraform run")
+		} else {
+			respondWithError(c, http.StatusBadGateway, err)
+		}
+		return
+	}
+
+	// Stream logs directly to the client since they can be large
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	sections := []struct {
+		name string
+		url  string
+	}{
+		{"Plan", runLogs.PlanLogURL},
+		{"Apply", runLogs.ApplyLogURL},
+	}
+	for _, section := range sections {
+		fmt.Fprintf(c.Writer, "==> %s log (run %s)\n", section.name, runLogs.RunID)
+		if section.url == "" {
+			fmt.Fprintf(c.Writer, "No %s log available\n\n", section.name)
+			continue
+		}
+		if err := services.StreamTerraformLog(section.url, c.Writer, nil); err != nil {
+			fmt.Fprintf(c.Writer, "\nError reading %s log: %v\n", section.name, err)
+		}
+		fmt.Fprintf(c.Writer, "\n")
+		c.Writer.Flush()
+	}
+}
+
 // CleanupPaletteProject handles cleaning up a specific Palette Project
 // @Summary Cleanup Palette Project
 // @Description Clean up a specific Palette Project service
@@ -222,14 +702,14 @@ func (h *Handler) GetLabProgress(c *gin.Context) {
 // @Security BearerAuth
 // @Param id path string true "Lab ID"
 // @Success 200 {object} map[string]interface{} "Cleanup successful"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 404 {object} map[string]interface{} "Lab not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /labs/{id}/cleanup/palette-project [post]
 func (h *Handler) CleanupPaletteProject(c *gin.Context) {
 	labID := c.Param("id")
 	if labID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Lab ID is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
 		return
 	}
 
@@ -237,9 +717,9 @@ func (h *Handler) CleanupPaletteProject(c *gin.Context) {
 	labInstance, err := h.labService.GetLab(labID)
 	if err != nil {
 		if err == lab.ErrLabNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Lab not found"})
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get lab"})
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab")
 		}
 		return
 	}
@@ -251,7 +731,7 @@ func (h *Handler) CleanupPaletteProject(c *gin.Context) {
 	// Get the service by type (palette_project)
 	paletteService, exists := serviceManager.GetServiceByType("palette_project")
 	if !exists {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Palette Project service not available"})
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Palette Project service not available")
 		return
 	}
 
@@ -265,7 +745,7 @@ func (h *Handler) CleanupPaletteProject(c *gin.Context) {
 	// Execute cleanup
 	err = paletteService.ExecuteCleanup(cleanupCtx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cleanup Palette Project"})
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to cleanup Palette Project")
 		return
 	}
 
@@ -274,33 +754,119 @@ func (h *Handler) CleanupPaletteProject(c *gin.Context) {
 
 // GetUserLabs handles getting all labs for a user (alias for GetLabs)
 // @Summary Get user labs
-// @Description Get all labs for the authenticated user
+// @Description Get the authenticated user's labs, newest first. Expired labs are left out unless status asks for them.
 // @Tags labs
 // @Produce json
 // @Security BearerAuth
-// @Success 200 {array} models.Lab
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Param status query string false "Comma-separated statuses to include (provisioning, queued, ready, error, expired, scheduled), or all"
+// @Param include query string false "Set to credentials to include each lab's credentials inline"
+// @Success 200 {array} models.LabResponse
+// @Failure 400 {object} handlers.ErrorResponse "Invalid status"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
 // @Router /labs [get]
 func (h *Handler) GetUserLabs(c *gin.Context) {
 	h.GetLabs(c)
 }
 
+// GetScheduledLabs handles listing labs that are waiting for their scheduled start time
+// @Summary Get scheduled labs
+// @Description Get labs scheduled to start in the future. Admins see scheduled labs of all users.
+// @Tags labs
+// @Produce json
+// @Security BearerAuth
+// @Param include query string false "Set to credentials to include each lab's credentials inline"
+// @Success 200 {array} models.LabResponse
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Router /labs/scheduled [get]
+func (h *Handler) GetScheduledLabs(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "User not found in context")
+		return
+	}
+
+	userObj := user.(*models.User)
+	ownerID := userObj.ID
+	if h.authService.IsAdmin(userObj) {
+		ownerID = ""
+	}
+
+	labs := h.labService.GetScheduledLabs(ownerID)
+
+	labResponses := make([]*models.LabResponse, len(labs))
+	for i, lab := range labs {
+		labResponses[i] = h.labResponse(c, lab)
+	}
+
+	c.JSON(http.StatusOK, labResponses)
+}
+
+// CancelScheduledLab handles cancelling a lab before its scheduled start
+// @Summary Cancel scheduled lab
+// @Description Cancel a lab that has not started yet (owner or admin only)
+// @Tags labs
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Success 204 "No content"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 409 {object} handlers.ErrorResponse "Lab is not scheduled"
+// @Router /labs/{id}/cancel [post]
+func (h *Handler) CancelScheduledLab(c *gin.Context) {
+	labID := c.Param("id")
+	if labID == "" {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
+		return
+	}
+
+	labInstance, err := h.labService.GetLab(labID)
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab")
+		}
+		return
+	}
+
+	if !h.canAccessLab(c, labInstance) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access denied")
+		return
+	}
+
+	if err := h.labService.CancelScheduledLab(labID); err != nil {
+		switch err {
+		case lab.ErrLabNotFound:
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		case lab.ErrLabNotScheduled:
+			respondError(c, http.StatusConflict, models.CodeLabNotScheduled, "Only scheduled labs can be cancelled")
+		default:
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to cancel lab")
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 // CleanupFailedLab handles cleaning up a failed lab
 // @Summary Cleanup failed lab
-// @Description Clean up a lab that has failed to provision
+// @Description Clean up a lab that has failed to provision (owner or admin only)
 // @Tags labs
 // @Security BearerAuth
 // @Param id path string true "Lab ID"
 // @Success 200 {object} map[string]interface{} "Cleanup successful"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 404 {object} map[string]interface{} "Lab not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 409 {object} handlers.ErrorResponse "Cleanup already in progress"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /labs/{id}/cleanup [post]
 func (h *Handler) CleanupFailedLab(c *gin.Context) {
 	labID := c.Param("id")
 	if labID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Lab ID is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
 		return
 	}
 
@@ -308,24 +874,39 @@ func (h *Handler) CleanupFailedLab(c *gin.Context) {
 	labInstance, err := h.labService.GetLab(labID)
 	if err != nil {
 		if err == lab.ErrLabNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Lab not found"})
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get lab"})
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab")
 		}
 		return
 	}
 
+	// Users a lab is shared with can only observe it
+	if !h.canAccessLab(c, labInstance) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access denied")
+		return
+	}
+
+	h.cleanupLab(c, labInstance)
+}
+
+// cleanupLab cleans up a lab's services and writes the response. Callers check access to the lab first.
+func (h *Handler) cleanupLab(c *gin.Context, labInstance *models.Lab) {
 	// Create cleanup context
 	cleanupCtx := &interfaces.CleanupContext{
-		LabID:   labID,
+		LabID:   labInstance.ID,
 		Context: c.Request.Context(),
 		Lab:     labInstance,
 	}
 
 	// Execute cleanup
-	err = h.labService.CleanupLabServices(cleanupCtx)
+	err := h.labService.CleanupLabServices(cleanupCtx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cleanup lab"})
+		if errors.Is(err, lab.ErrCleanupInProgress) {
+			respondError(c, http.StatusConflict, models.CodeCleanupInProgress, "Cleanup already in progress for this lab")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to cleanup lab")
 		return
 	}
 
@@ -339,13 +920,38 @@ func (h *Handler) CleanupFailedLab(c *gin.Context) {
 // @Security BearerAuth
 // @Param id path string true "Lab ID"
 // @Success 200 {object} models.Lab
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
-// @Failure 404 {object} map[string]interface{} "Lab not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /admin/labs/{id}/stop [post]
 func (h *Handler) AdminStopLab(c *gin.Context) {
-	h.StopLab(c)
+	// Org admins may stop any lab in their organization, not just their own
+	if !h.checkLabOrgScope(c) {
+		return
+	}
+	h.stopLab(c, c.Param("id"))
+}
+
+// AdminResumeLab handles resuming a stopped lab (admin only)
+// @Summary Resume lab (admin)
+// @Description Make a stopped lab ready again while its stop grace period lasts (admin only)
+// @Tags admin
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Success 200 {object} models.Lab
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 409 {object} handlers.ErrorResponse "Lab is not stopped or its grace period has ended"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
+// @Router /admin/labs/{id}/resume [post]
+func (h *Handler) AdminResumeLab(c *gin.Context) {
+	// Org admins may resume any lab in their organization, not just their own
+	if !h.checkLabOrgScope(c) {
+		return
+	}
+	h.resumeLab(c, c.Param("id"))
 }
 
 // AdminDeleteLab handles deleting a lab (admin only)
@@ -355,13 +961,17 @@ func (h *Handler) AdminStopLab(c *gin.Context) {
 // @Security BearerAuth
 // @Param id path string true "Lab ID"
 // @Success 204 "No content"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
-// @Failure 404 {object} map[string]interface{} "Lab not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /admin/labs/{id} [delete]
 func (h *Handler) AdminDeleteLab(c *gin.Context) {
-	h.DeleteLab(c)
+	// Org admins may delete any lab in their organization, not just their own
+	if !h.checkLabOrgScope(c) {
+		return
+	}
+	h.deleteLab(c, c.Param("id"))
 }
 
 // CleanupLab handles cleaning up a lab (admin only)
@@ -371,11 +981,20 @@ func (h *Handler) AdminDeleteLab(c *gin.Context) {
 // @Security BearerAuth
 // @Param id path string true "Lab ID"
 // @Success 200 {object} map[string]interface{} "Cleanup successful"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
-// @Failure 404 {object} map[string]interface{} "Lab not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /admin/labs/{id}/cleanup [post]
 func (h *Handler) CleanupLab(c *gin.Context) {
-	h.CleanupFailedLab(c)
+	// Org admins may clean up any lab in their organization, not just their own
+	if !h.checkLabOrgScope(c) {
+		return
+	}
+
+	labInstance, ok := h.getLab(c)
+	if !ok {
+		return
+	}
+	h.cleanupLab(c, labInstance)
 }
@@ -1,51 +1,50 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/wcrum/labby/internal/lab"
 	"github.com/wcrum/labby/internal/models"
 	"github.com/wcrum/labby/internal/services"
 )
 
 // CreateOrganization handles creating a new organization (admin only)
 // @Summary Create organization (admin)
-// @Description Create a new organization (admin only)
+// @Description Create a new organization (admin only). The name is required, at most 64 characters, starts with a letter or digit and may only use letters, digits, spaces and . _ -; runs of whitespace are collapsed. The optional domain must be a valid domain name and the optional description at most 500 printable characters.
 // @Tags admin
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param request body map[string]string true "Organization creation request"
+// @Param request body models.CreateOrganizationRequest true "Organization creation request"
 // @Success 201 {object} models.Organization
-// @Failure 400 {object} map[string]interface{} "Bad request"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /admin/organizations [post]
 func (h *Handler) CreateOrganization(c *gin.Context) {
-	var req map[string]string
+	var req models.CreateOrganizationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
-	name, exists := req["name"]
-	if !exists || name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Organization name is required"})
-		return
-	}
-
-	description := req["description"]
-	domain := req["domain"]
-
 	// For now, we'll use a mock organization service
 	// In a real implementation, this would be injected into the handler
 	orgService := services.NewOrganizationService()
 
-	org, err := orgService.CreateOrganization(name, description, domain)
+	org, err := orgService.CreateOrganization(req.Name, req.Description, req.Domain)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		if errors.Is(err, services.ErrInvalidOrganization) {
+			respondWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to create organization")
 		return
 	}
 
@@ -59,8 +58,8 @@ func (h *Handler) CreateOrganization(c *gin.Context) {
 // @Produce json
 // @Security BearerAuth
 // @Success 200 {array} models.Organization
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
 // @Router /admin/organizations [get]
 func (h *Handler) GetOrganizations(c *gin.Context) {
 	orgService := services.NewOrganizationService()
@@ -76,27 +75,138 @@ func (h *Handler) GetOrganizations(c *gin.Context) {
 // @Security BearerAuth
 // @Param id path string true "Organization ID"
 // @Success 200 {object} models.OrganizationWithMembers
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
-// @Failure 404 {object} map[string]interface{} "Organization not found"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Organization not found"
 // @Router /admin/organizations/{id} [get]
 func (h *Handler) GetOrganization(c *gin.Context) {
 	orgID := c.Param("id")
 	if orgID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Organization ID is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Organization ID is required")
+		return
+	}
+
+	if scopedOrgID, scoped := orgScope(c); scoped && scopedOrgID != orgID {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access to this organization is not allowed")
 		return
 	}
 
 	orgService := services.NewOrganizationService()
 	orgWithMembers, err := orgService.GetOrganizationWithMembers(orgID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		respondError(c, http.StatusNotFound, models.CodeOrganizationNotFound, "Organization not found")
 		return
 	}
 
 	c.JSON(http.StatusOK, orgWithMembers)
 }
 
+// SetOrganizationDomainAutoJoin handles turning email domain auto-assignment on or off (admin only)
+// @Summary Set organization domain auto-join (admin)
+// @Description Opt an organization in or out of auto-assigning users whose email matches its domain when they first log in (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Organization ID"
+// @Param request body models.SetDomainAutoJoinRequest true "Auto-join setting"
+// @Success 200 {object} models.Organization
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Organization not found"
+// @Failure 409 {object} handlers.ErrorResponse "Another organization auto-assigns this domain"
+// @Router /admin/organizations/{id}/auto-join [put]
+func (h *Handler) SetOrganizationDomainAutoJoin(c *gin.Context) {
+	var req models.SetDomainAutoJoinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	orgService := services.NewOrganizationService()
+	org, err := orgService.SetDomainAutoJoin(c.Param("id"), req.Enabled)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOrganizationNotFound):
+			respondError(c, http.StatusNotFound, models.CodeOrganizationNotFound, "Organization not found")
+		case errors.Is(err, services.ErrOrganizationDomainRequired):
+			respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Organization must have a domain to auto-assign users")
+		case errors.Is(err, services.ErrDomainAutoJoinConflict):
+			respondWithError(c, http.StatusConflict, err)
+		default:
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to update organization")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+// GetOrganizationStats handles getting a summary of an organization's activity (admin only)
+// @Summary Get organization stats (admin)
+// @Description Get member count, lab counts, labs by template, invite counts and active service usage for an organization (admin or that organization's admin)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Organization ID"
+// @Success 200 {object} models.OrganizationStats
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Organization not found"
+// @Router /admin/organizations/{id}/stats [get]
+func (h *Handler) GetOrganizationStats(c *gin.Context) {
+	orgID := c.Param("id")
+	if orgID == "" {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Organization ID is required")
+		return
+	}
+
+	if scopedOrgID, scoped := orgScope(c); scoped && scopedOrgID != orgID {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access to this organization is not allowed")
+		return
+	}
+
+	orgService := services.NewOrganizationService()
+	if _, err := orgService.GetOrganization(orgID); err != nil {
+		respondError(c, http.StatusNotFound, models.CodeOrganizationNotFound, "Organization not found")
+		return
+	}
+
+	// Labs belong to an organization through their owner, as in labInOrganization
+	owners := make(map[string]bool)
+	for _, user := range h.authService.GetAllUsers() {
+		if user.OrganizationID != nil && *user.OrganizationID == orgID {
+			owners[user.ID] = true
+		}
+	}
+
+	members := make(map[string]bool, len(owners))
+	for userID := range owners {
+		members[userID] = true
+	}
+	for _, userID := range orgService.GetOrganizationMemberIDs(orgID) {
+		members[userID] = true
+	}
+
+	labStats := h.labService.GetLabStats(owners)
+	invitesIssued, invitesAccepted := orgService.GetInviteCounts(orgID)
+
+	c.JSON(http.StatusOK, models.OrganizationStats{
+		OrganizationID:  orgID,
+		MemberCount:     len(members),
+		ActiveLabs:      labStats.Active,
+		TotalLabs:       labStats.Total,
+		LabsByTemplate:  labStats.ByTemplate,
+		LabsByTag:       labStats.ByTag,
+		InvitesIssued:   invitesIssued,
+		InvitesAccepted: invitesAccepted,
+		ServiceUsage:    labStats.ActiveServices,
+		EstimatedCost:   labStats.EstimatedCost,
+		GeneratedAt:     time.Now(),
+	})
+}
+
 // CreateInvite handles creating an invitation to join an organization (admin only)
 // @Summary Create invite (admin)
 // @Description Create an invitation to join an organization (admin only)
@@ -106,10 +216,10 @@ func (h *Handler) GetOrganization(c *gin.Context) {
 // @Security BearerAuth
 // @Param request body models.CreateInviteRequest true "Invite creation request"
 // @Success 201 {object} models.Invite
-// @Failure 400 {object} map[string]interface{} "Bad request"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 403 {object} map[string]interface{} "Forbidden"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /admin/organizations/{id}/invites [post]
 func (h *Handler) CreateInvite(c *gin.Context) {
 	orgID := c.Param("id")
@@ -117,14 +227,19 @@ func (h *Handler) CreateInvite(c *gin.Context) {
 
 	if orgID == "" {
 		fmt.Printf("DEBUG: Organization ID is empty\n")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Organization ID is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Organization ID is required")
+		return
+	}
+
+	if scopedOrgID, scoped := orgScope(c); scoped && scopedOrgID != orgID {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access to this organization is not allowed")
 		return
 	}
 
 	var req models.CreateInviteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		fmt.Printf("DEBUG: Failed to bind JSON request: %v\n", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -134,19 +249,32 @@ func (h *Handler) CreateInvite(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
 		fmt.Printf("DEBUG: User not found in context\n")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "User not found in context")
 		return
 	}
 	userObj := user.(*models.User)
 	fmt.Printf("DEBUG: User from context: %+v\n", userObj)
 
+	// Labs are created for whoever accepts, so the template must not need values only they could supply
+	if req.LabTemplateID != "" {
+		template, exists := h.labService.GetTemplate(req.LabTemplateID)
+		if !exists {
+			respondError(c, http.StatusNotFound, models.CodeTemplateNotFound, "Template not found")
+			return
+		}
+		if _, err := template.ResolveVariables(nil); err != nil {
+			respondWithError(c, http.StatusBadRequest, fmt.Errorf("template %s cannot be used for invites: %w", template.ID, err))
+			return
+		}
+	}
+
 	orgService := services.NewOrganizationService()
 	fmt.Printf("DEBUG: Created new OrganizationService instance\n")
 
-	invite, err := orgService.CreateInvite(orgID, req.Email, req.Role, userObj.ID)
+	invite, err := orgService.CreateInvite(orgID, req.Email, req.Role, userObj.ID, req.UsageLimit, req.LabTemplateID)
 	if err != nil {
 		fmt.Printf("DEBUG: CreateInvite service error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to create invite")
 		return
 	}
 
@@ -154,6 +282,104 @@ func (h *Handler) CreateInvite(c *gin.Context) {
 	c.JSON(http.StatusCreated, invite)
 }
 
+// RenewInvite handles making an expired or expiring invite acceptable again
+// @Summary Renew invite (admin)
+// @Description Give an invite a new expiry, keeping its organization, role, usage limit and lab template, so attendees can still join with the same link. With new_id the invite gets a new ID and the old link stops working; with send_email the link is emailed to the invited address. Invites with no uses left cannot be renewed. (admin or org admin of the invite's organization)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Invite ID"
+// @Param request body models.RenewInviteRequest false "Renew options"
+// @Success 200 {object} models.RenewInviteResponse
+// @Failure 400 {object} handlers.ErrorResponse "Bad request, or email is not configured"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Invite not found"
+// @Failure 409 {object} handlers.ErrorResponse "Invite has no uses left"
+// @Router /admin/invites/{id}/renew [post]
+func (h *Handler) RenewInvite(c *gin.Context) {
+	inviteID := c.Param("id")
+
+	// Request body is optional, renewing keeps the invite's ID without emailing it
+	var req models.RenewInviteRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondWithError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if req.SendEmail && h.inviteEmail == nil {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Email is not configured, set SMTP_HOST to email invites")
+		return
+	}
+
+	orgService := services.NewOrganizationService()
+
+	invite, err := orgService.GetInvite(inviteID)
+	if err != nil {
+		respondWithError(c, http.StatusNotFound, err)
+		return
+	}
+	if scopedOrgID, scoped := orgScope(c); scoped && scopedOrgID != invite.OrganizationID {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access to this organization is not allowed")
+		return
+	}
+
+	invite, err = orgService.RenewInvite(inviteID, req.NewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInviteNotFound):
+			respondWithError(c, http.StatusNotFound, err)
+		case errors.Is(err, services.ErrInviteNotRenewable):
+			respondWithError(c, http.StatusConflict, err)
+		default:
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to renew invite")
+		}
+		return
+	}
+
+	response := models.RenewInviteResponse{Invite: invite}
+	if req.SendEmail {
+		if err := h.emailInvite(invite); err != nil {
+			fmt.Printf("RenewInvite: failed to email invite %s: %v\n", invite.ID, err)
+			response.EmailError = apiErrorFor(http.StatusBadGateway, err)
+		} else {
+			response.EmailSent = true
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetInviteStats handles counting invites by status (admin only)
+// @Summary Get invite stats (admin)
+// @Description Count invites by status, with pending invites past their expiry counted as expired, and report the last invite sweep (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.InviteStats
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Router /admin/invites/stats [get]
+func (h *Handler) GetInviteStats(c *gin.Context) {
+	c.JSON(http.StatusOK, services.NewOrganizationService().GetInviteStats())
+}
+
+// emailInvite emails an invite's link to the invited address
+func (h *Handler) emailInvite(invite *models.Invite) error {
+	organizationName := "an organization"
+	if org, err := services.NewOrganizationService().GetOrganization(invite.OrganizationID); err == nil {
+		organizationName = org.Name
+	}
+
+	inviteURL := fmt.Sprintf("%s/invite?code=%s", h.frontendURL, url.QueryEscape(invite.ID))
+	subject := fmt.Sprintf("You're invited to join %s", organizationName)
+	body := fmt.Sprintf("You have been invited to join %s as %s.\n\nAccept the invite: %s\n\nThe invite expires on %s.\n",
+		organizationName, invite.Role, inviteURL, invite.ExpiresAt.Format(time.RFC1123))
+	return h.inviteEmail.Send(invite.Email, subject, body)
+}
+
 // GetInvite handles getting an invite by ID (public endpoint for accepting invites)
 // @Summary Get invite
 // @Description Get an invitation by ID (public endpoint)
@@ -161,7 +387,7 @@ func (h *Handler) CreateInvite(c *gin.Context) {
 // @Produce json
 // @Param id path string true "Invite ID"
 // @Success 200 {object} models.Invite
-// @Failure 404 {object} map[string]interface{} "Invite not found"
+// @Failure 404 {object} handlers.ErrorResponse "Invite not found"
 // @Router /invites/{id} [get]
 func (h *Handler) GetInvite(c *gin.Context) {
 	inviteID := c.Param("id")
@@ -169,7 +395,7 @@ func (h *Handler) GetInvite(c *gin.Context) {
 
 	if inviteID == "" {
 		fmt.Printf("DEBUG: Invite ID is empty\n")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invite ID is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Invite ID is required")
 		return
 	}
 
@@ -179,7 +405,7 @@ func (h *Handler) GetInvite(c *gin.Context) {
 	invite, err := orgService.GetInvite(inviteID)
 	if err != nil {
 		fmt.Printf("DEBUG: GetInvite service error: %v\n", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusNotFound, err)
 		return
 	}
 
@@ -189,29 +415,31 @@ func (h *Handler) GetInvite(c *gin.Context) {
 
 // AcceptInvite handles accepting an invitation (public endpoint)
 // @Summary Accept invite
-// @Description Accept an invitation to join an organization (public endpoint)
+// @Description Accept an invitation to join an organization (public endpoint). Invites with a lab template also create a lab from it for the new member; the invite is not used up while the template's services are unavailable or at their limit.
 // @Tags public
 // @Accept json
 // @Produce json
 // @Param id path string true "Invite ID"
 // @Param request body models.AcceptInviteRequest true "Accept invite request"
-// @Success 200 {object} map[string]interface{} "Invite accepted"
-// @Failure 400 {object} map[string]interface{} "Bad request"
-// @Failure 404 {object} map[string]interface{} "Invite not found"
+// @Success 200 {object} models.AcceptInviteResponse "Invite accepted"
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 404 {object} handlers.ErrorResponse "Invite not found"
+// @Failure 409 {object} handlers.ErrorResponse "The invite's lab template is unavailable or at its limit"
+// @Failure 410 {object} handlers.ErrorResponse "Invite usage limit reached"
 // @Router /invites/{id}/accept [post]
 func (h *Handler) AcceptInvite(c *gin.Context) {
 	inviteID := c.Param("id")
 	fmt.Printf("DEBUG: AcceptInvite handler called with inviteID: %s\n", inviteID)
 
 	if inviteID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invite ID is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Invite ID is required")
 		return
 	}
 
 	var req models.AcceptInviteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		fmt.Printf("DEBUG: Failed to bind JSON request: %v\n", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -223,17 +451,37 @@ func (h *Handler) AcceptInvite(c *gin.Context) {
 	invite, err := orgService.GetInvite(inviteID)
 	if err != nil {
 		fmt.Printf("DEBUG: Failed to get invite: %v\n", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	fmt.Printf("DEBUG: Found invite: %+v\n", invite)
 
+	// Refuse before using up the invite when its lab couldn't be created, so the member can try again later
+	if invite.LabTemplateID != "" {
+		if _, err := h.authService.GetUserByID(req.UserID); err != nil {
+			respondWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		if err := h.labService.CheckTemplateAvailability(invite.LabTemplateID); err != nil {
+			status := http.StatusConflict
+			if errors.Is(err, lab.ErrTemplateNotFound) {
+				status = http.StatusNotFound
+			}
+			respondWithError(c, status, err)
+			return
+		}
+	}
+
 	// Accept the invite (adds user to organization members)
 	err = orgService.AcceptInvite(inviteID, req.UserID)
+	if err == services.ErrInviteExhausted {
+		respondWithError(c, http.StatusGone, err)
+		return
+	}
 	if err != nil {
 		fmt.Printf("DEBUG: Failed to accept invite: %v\n", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -258,7 +506,21 @@ func (h *Handler) AcceptInvite(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Invite accepted successfully"})
+	response := models.AcceptInviteResponse{Message: "Invite accepted successfully"}
+
+	// Created after the organization update, so the lab uses the organization's service configs
+	if invite.LabTemplateID != "" {
+		labInstance, err := h.labService.CreateLabFromTemplate(invite.LabTemplateID, req.UserID, "", 0, nil, nil, nil, nil)
+		if err != nil {
+			// Another lab may have taken the last slot since the check, the membership stands
+			fmt.Printf("ERROR: Failed to create lab from template %s for invite %s: %v\n", invite.LabTemplateID, invite.ID, err)
+			response.LabError = apiErrorFor(http.StatusConflict, err)
+		} else {
+			response.LabID = labInstance.ID
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 // GetUserOrganization handles getting the current user's organization
@@ -268,14 +530,14 @@ func (h *Handler) AcceptInvite(c *gin.Context) {
 // @Produce json
 // @Security BearerAuth
 // @Success 200 {object} models.Organization
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 404 {object} map[string]interface{} "User not in organization"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 404 {object} handlers.ErrorResponse "User not in organization"
 // @Router /user/organization [get]
 func (h *Handler) GetUserOrganization(c *gin.Context) {
 	// Get user from context
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "User not found in context")
 		return
 	}
 	userObj := user.(*models.User)
@@ -286,7 +548,7 @@ func (h *Handler) GetUserOrganization(c *gin.Context) {
 	// Check if user has an organization
 	if userObj.OrganizationID == nil {
 		fmt.Printf("DEBUG: User has no organization assigned\n")
-		c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of any organization"})
+		respondError(c, http.StatusNotFound, models.CodeNotFound, "User is not a member of any organization")
 		return
 	}
 
@@ -296,7 +558,7 @@ func (h *Handler) GetUserOrganization(c *gin.Context) {
 	organization, err := orgService.GetOrganization(*userObj.OrganizationID)
 	if err != nil {
 		fmt.Printf("DEBUG: Failed to get organization %s: %v\n", *userObj.OrganizationID, err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		respondError(c, http.StatusNotFound, models.CodeOrganizationNotFound, "Organization not found")
 		return
 	}
 
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitIdleTTL is how long an unused bucket is kept before being evicted
+const rateLimitIdleTTL = 10 * time.Minute
+
+// tokenBucket tracks the available tokens for a single client
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// RateLimiter is a token-bucket rate limiter keyed by user ID or client IP
+type RateLimiter struct {
+	ratePerSecond float64
+	burst         float64
+	buckets       map[string]*tokenBucket
+	mu            sync.Mutex
+}
+
+// NewRateLimiter creates a rate limiter that refills requestsPerMinute tokens per minute up to burst
+func NewRateLimiter(requestsPerMinute, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	rl := &RateLimiter{
+		ratePerSecond: float64(requestsPerMinute) / 60,
+		burst:         float64(burst),
+		buckets:       make(map[string]*tokenBucket),
+	}
+
+	// Evict idle buckets so the map doesn't grow without bound
+	go func() {
+		ticker := time.NewTicker(rateLimitIdleTTL)
+		for range ticker.C {
+			rl.evictIdle()
+		}
+	}()
+
+	return rl
+}
+
+// allow consumes a token for key, returning the wait time until the next token when none is available
+func (rl *RateLimiter) allow(key string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	bucket, exists := rl.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: rl.burst, lastSeen: now}
+		rl.buckets[key] = bucket
+	}
+
+	// Refill based on elapsed time
+	elapsed := now.Sub(bucket.lastSeen).Seconds()
+	bucket.tokens = math.Min(rl.burst, bucket.tokens+elapsed*rl.ratePerSecond)
+	bucket.lastSeen = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	if rl.ratePerSecond <= 0 {
+		return false, time.Minute
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / rl.ratePerSecond * float64(time.Second))
+	return false, wait
+}
+
+// evictIdle removes buckets that have not been used recently
+func (rl *RateLimiter) evictIdle() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for key, bucket := range rl.buckets {
+		if time.Since(bucket.lastSeen) > rateLimitIdleTTL {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// Middleware limits requests per authenticated user, falling back to client IP for public routes
+func (rl *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := "ip:" + c.ClientIP()
+		if user, exists := c.Get("user"); exists {
+			if userObj, ok := user.(*models.User); ok {
+				key = "user:" + userObj.ID
+			}
+		}
+
+		allowed, wait := rl.allow(key)
+		if !allowed {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", fmt.Sprintf("%d", retryAfter))
+			respondError(c, http.StatusTooManyRequests, models.CodeRateLimited, "Rate limit exceeded, please try again later")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
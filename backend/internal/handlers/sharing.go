@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/wcrum/labby/internal/lab"
+	"github.com/wcrum/labby/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSharedLabs handles listing labs other users have shared with the current user
+// @Summary Get shared labs
+// @Description Get labs shared with the authenticated user, e.g. by students they are helping
+// @Tags labs
+// @Produce json
+// @Security BearerAuth
+// @Param include query string false "Set to credentials to include each lab's credentials inline"
+// @Success 200 {array} models.LabResponse
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Router /labs/shared [get]
+func (h *Handler) GetSharedLabs(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "User not found in context")
+		return
+	}
+
+	labs := h.labService.GetLabsSharedWith(user.(*models.User).ID)
+
+	labResponses := make([]*models.LabResponse, len(labs))
+	for i, lab := range labs {
+		labResponses[i] = h.labResponse(c, lab)
+	}
+
+	c.JSON(http.StatusOK, labResponses)
+}
+
+// GetLabShares handles listing the users a lab is shared with
+// @Summary Get lab shares
+// @Description List the users a lab is shared with (owner or admin only)
+// @Tags labs
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Success 200 {array} models.LabShare
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found"
+// @Router /labs/{id}/shares [get]
+func (h *Handler) GetLabShares(c *gin.Context) {
+	labInstance, ok := h.getOwnedLab(c)
+	if !ok {
+		return
+	}
+
+	shares, err := h.labService.GetLabShares(labInstance.ID)
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab shares")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, shares)
+}
+
+// ShareLab handles sharing a lab with another user
+// @Summary Share lab
+// @Description Give another user read-only observer access to a lab's progress and credentials (owner or admin only)
+// @Tags labs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Param request body models.ShareLabRequest true "User to share with, by ID or email"
+// @Success 201 {object} models.LabShare
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab or user not found"
+// @Router /labs/{id}/shares [post]
+func (h *Handler) ShareLab(c *gin.Context) {
+	labInstance, ok := h.getOwnedLab(c)
+	if !ok {
+		return
+	}
+
+	var req models.ShareLabRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	var target *models.User
+	var err error
+	switch {
+	case req.UserID != "":
+		target, err = h.authService.GetUserByID(req.UserID)
+	case req.Email != "":
+		target, err = h.authService.GetUserByEmail(req.Email)
+	default:
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "user_id or email is required")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusNotFound, models.CodeUserNotFound, "User not found")
+		return
+	}
+
+	if target.ID == labInstance.OwnerID {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab owner already has access")
+		return
+	}
+
+	user, _ := c.Get("user")
+	share, err := h.labService.ShareLab(labInstance.ID, target.ID, req.AccessLevel, user.(*models.User).ID)
+	if err != nil {
+		switch {
+		case err == lab.ErrLabNotFound:
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		case errors.Is(err, lab.ErrInvalidAccessLevel):
+			respondWithError(c, http.StatusBadRequest, err)
+		default:
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to share lab")
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, share)
+}
+
+// UnshareLab handles revoking another user's access to a lab
+// @Summary Unshare lab
+// @Description Revoke a user's access to a lab (owner or admin only)
+// @Tags labs
+// @Security BearerAuth
+// @Param id path string true "Lab ID"
+// @Param userId path string true "User ID"
+// @Success 204 "No content"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Lab not found or not shared with the user"
+// @Router /labs/{id}/shares/{userId} [delete]
+func (h *Handler) UnshareLab(c *gin.Context) {
+	labInstance, ok := h.getOwnedLab(c)
+	if !ok {
+		return
+	}
+
+	if err := h.labService.UnshareLab(labInstance.ID, c.Param("userId")); err != nil {
+		switch err {
+		case lab.ErrLabNotFound:
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		case lab.ErrLabShareNotFound:
+			respondError(c, http.StatusNotFound, models.CodeLabShareNotFound, "Lab is not shared with this user")
+		default:
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to unshare lab")
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// getOwnedLab loads the lab in the path and aborts unless the current user owns it or is an admin
+func (h *Handler) getOwnedLab(c *gin.Context) (*models.Lab, bool) {
+	labInstance, ok := h.getLab(c)
+	if !ok {
+		return nil, false
+	}
+
+	if !h.canAccessLab(c, labInstance) {
+		respondError(c, http.StatusForbidden, models.CodeForbidden, "Access denied")
+		return nil, false
+	}
+
+	return labInstance, true
+}
+
+// getLab loads the lab in the path, aborting with 400 or 404 when there is none. It doesn't check access.
+func (h *Handler) getLab(c *gin.Context) (*models.Lab, bool) {
+	labID := c.Param("id")
+	if labID == "" {
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Lab ID is required")
+		return nil, false
+	}
+
+	labInstance, err := h.labService.GetLab(labID)
+	if err != nil {
+		if err == lab.ErrLabNotFound {
+			respondError(c, http.StatusNotFound, models.CodeLabNotFound, "Lab not found")
+		} else {
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, "Failed to get lab")
+		}
+		return nil, false
+	}
+
+	return labInstance, true
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/wcrum/labby/internal/lab"
 	"github.com/wcrum/labby/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -11,17 +14,47 @@ import (
 
 // GetTemplates handles getting all lab templates
 // @Summary Get lab templates
-// @Description Get all available lab templates
+// @Description Get available lab templates, optionally filtered by category, tag or a search query
 // @Tags templates
 // @Produce json
 // @Security BearerAuth
+// @Param category query string false "Only templates in this category"
+// @Param tag query string false "Only templates with this tag"
+// @Param q query string false "Search template name, ID and description"
+// @Param If-None-Match header string false "ETag of a previous response"
 // @Success 200 {array} models.LabTemplate
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Success 304 "Not modified"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /templates [get]
 func (h *Handler) GetTemplates(c *gin.Context) {
-	templates := h.labService.GetTemplates()
-	c.JSON(http.StatusOK, templates)
+	filter := models.TemplateFilter{
+		Category: strings.TrimSpace(c.Query("category")),
+		Tag:      strings.TrimSpace(c.Query("tag")),
+		Query:    strings.TrimSpace(c.Query("q")),
+	}
+	// Free-text searches are too varied to be worth caching
+	cacheKey := ""
+	if filter.Query == "" {
+		cacheKey = strings.ToLower(filter.Category + "\x00" + filter.Tag)
+	}
+
+	h.templateCache.serve(c, cacheKey, func() interface{} {
+		return h.labService.FilterTemplates(filter)
+	})
+}
+
+// GetTemplateFacets handles listing the categories and tags used by lab templates
+// @Summary Get template facets
+// @Description Get the distinct categories and tags across all lab templates, for building filters
+// @Tags templates
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.TemplateFacets
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Router /templates/facets [get]
+func (h *Handler) GetTemplateFacets(c *gin.Context) {
+	c.JSON(http.StatusOK, h.labService.GetTemplateFacets())
 }
 
 // GetTemplate handles getting a specific lab template
@@ -32,20 +65,20 @@ func (h *Handler) GetTemplates(c *gin.Context) {
 // @Security BearerAuth
 // @Param id path string true "Template ID"
 // @Success 200 {object} models.LabTemplate
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 404 {object} map[string]interface{} "Template not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 404 {object} handlers.ErrorResponse "Template not found"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /templates/{id} [get]
 func (h *Handler) GetTemplate(c *gin.Context) {
 	templateID := c.Param("id")
 	if templateID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Template ID is required")
 		return
 	}
 
 	template, exists := h.labService.GetTemplate(templateID)
 	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		respondError(c, http.StatusNotFound, models.CodeTemplateNotFound, "Template not found")
 		return
 	}
 
@@ -54,17 +87,19 @@ func (h *Handler) GetTemplate(c *gin.Context) {
 
 // CreateLabFromTemplate handles creating a lab from a template
 // @Summary Create lab from template
-// @Description Create a new lab from a specific template
+// @Description Create a new lab from a specific template, optionally with a custom name and duration (up to the template's max), scheduled to start at a future time, and notifying the owner by email or webhook when it is ready or fails
 // @Tags templates
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path string true "Template ID"
+// @Param request body models.CreateLabFromTemplateRequest false "Optional lab name, duration, template variable values, start time, notification settings and tags"
 // @Success 201 {object} models.Lab
-// @Failure 400 {object} map[string]interface{} "Bad request"
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 404 {object} map[string]interface{} "Template not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 400 {object} handlers.ErrorResponse "Bad request"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 404 {object} handlers.ErrorResponse "Template not found"
+// @Failure 409 {object} handlers.ErrorResponse "Lab name already in use, or a service is not available or at its limit"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /templates/{id}/create-lab [post]
 func (h *Handler) CreateLabFromTemplate(c *gin.Context) {
 	fmt.Printf("CreateLabFromTemplate handler: Starting lab creation from template\n")
@@ -72,7 +107,7 @@ func (h *Handler) CreateLabFromTemplate(c *gin.Context) {
 	templateID := c.Param("id")
 	if templateID == "" {
 		fmt.Printf("CreateLabFromTemplate handler: Template ID is empty\n")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Template ID is required"})
+		respondError(c, http.StatusBadRequest, models.CodeInvalidRequest, "Template ID is required")
 		return
 	}
 	fmt.Printf("CreateLabFromTemplate handler: Template ID: %s\n", templateID)
@@ -80,33 +115,128 @@ func (h *Handler) CreateLabFromTemplate(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
 		fmt.Printf("CreateLabFromTemplate handler: User not found in context\n")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		respondError(c, http.StatusUnauthorized, models.CodeUnauthorized, "User not found in context")
 		return
 	}
 
 	userObj := user.(*models.User)
 	fmt.Printf("CreateLabFromTemplate handler: User: %s (%s)\n", userObj.Email, userObj.ID)
 
-	lab, err := h.labService.CreateLabFromTemplate(templateID, userObj.ID)
+	// Request body is optional for templates without variables
+	var req models.CreateLabFromTemplateRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondWithError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	labInstance, err := h.labService.CreateLabFromTemplate(templateID, userObj.ID, req.Name, req.Duration, req.Variables, req.StartAt, req.Notify, req.Tags)
 	if err != nil {
+		if errors.Is(err, models.ErrInvalidTemplateVariables) || errors.Is(err, lab.ErrInvalidDuration) || errors.Is(err, lab.ErrLabLifetimeExceeded) || errors.Is(err, lab.ErrInvalidStartAt) || errors.Is(err, lab.ErrInvalidLabName) || errors.Is(err, lab.ErrInvalidLabTags) || errors.Is(err, lab.ErrInvalidNotification) {
+			respondWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, lab.ErrTemplateNotFound) {
+			respondWithError(c, http.StatusNotFound, err)
+			return
+		}
+		// Services that are inactive or at their limit report which service it was
+		if errors.Is(err, lab.ErrLabNameTaken) || errors.Is(err, models.ErrServiceLimitExceeded) || isAPIError(err, models.CodeServiceNotAvailable) {
+			respondWithError(c, http.StatusConflict, err)
+			return
+		}
 		fmt.Printf("CreateLabFromTemplate handler: Failed to create lab: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create lab from template: %v", err)})
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, fmt.Sprintf("Failed to create lab from template: %v", err))
+		return
+	}
+
+	fmt.Printf("CreateLabFromTemplate handler: Lab created successfully with ID: %s\n", labInstance.ID)
+	c.JSON(http.StatusCreated, labInstance)
+}
+
+// ExportTemplate handles exporting a lab template as a bundle
+// @Summary Export lab template
+// @Description Export a template together with the shapes of the service configs it references, for importing into another environment. Secret config values are left out. (admin only)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Template ID"
+// @Success 200 {object} models.TemplateBundle
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 404 {object} handlers.ErrorResponse "Template not found"
+// @Router /admin/templates/{id}/export [get]
+func (h *Handler) ExportTemplate(c *gin.Context) {
+	bundle, err := h.labService.ExportTemplateBundle(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, lab.ErrTemplateNotFound) {
+			respondError(c, http.StatusNotFound, models.CodeTemplateNotFound, "Template not found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, models.CodeInternal, fmt.Sprintf("Failed to export template: %v", err))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s-template.json", bundle.Template.ID))
+	c.JSON(http.StatusOK, bundle)
+}
+
+// ImportTemplate handles importing a lab template bundle
+// @Summary Import lab template
+// @Description Validate a template bundle, load it and save it to the templates directory. The service configs it references must already exist. (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param overwrite query bool false "Replace an existing template with the same ID"
+// @Param bundle body models.TemplateBundle true "Template bundle"
+// @Success 201 {object} models.LabTemplate
+// @Failure 400 {object} handlers.ErrorResponse "Invalid bundle"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 403 {object} handlers.ErrorResponse "Forbidden"
+// @Failure 409 {object} handlers.ErrorResponse "Template already exists"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
+// @Router /admin/templates/import [post]
+func (h *Handler) ImportTemplate(c *gin.Context) {
+	var bundle models.TemplateBundle
+	if err := c.ShouldBindJSON(&bundle); err != nil {
+		respondWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	overwrite := c.Query("overwrite") == "true"
+
+	template, err := h.labService.ImportTemplateBundle(&bundle, overwrite)
+	if err != nil {
+		switch {
+		case errors.Is(err, lab.ErrInvalidTemplateBundle):
+			respondWithError(c, http.StatusBadRequest, err)
+		case errors.Is(err, lab.ErrTemplateExists):
+			respondWithError(c, http.StatusConflict, err)
+		default:
+			respondError(c, http.StatusInternalServerError, models.CodeInternal, fmt.Sprintf("Failed to import template: %v", err))
+		}
 		return
 	}
 
-	fmt.Printf("CreateLabFromTemplate handler: Lab created successfully with ID: %s\n", lab.ID)
-	c.JSON(http.StatusCreated, lab)
+	c.JSON(http.StatusCreated, template)
 }
 
 // GetLabTemplates handles getting all lab templates (alias for GetTemplates)
 // @Summary Get lab templates
-// @Description Get all available lab templates
+// @Description Get available lab templates, optionally filtered by category, tag or a search query
 // @Tags templates
 // @Produce json
 // @Security BearerAuth
+// @Param category query string false "Only templates in this category"
+// @Param tag query string false "Only templates with this tag"
+// @Param q query string false "Search template name, ID and description"
+// @Param If-None-Match header string false "ETag of a previous response"
 // @Success 200 {array} models.LabTemplate
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Success 304 "Not modified"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /templates [get]
 func (h *Handler) GetLabTemplates(c *gin.Context) {
 	h.GetTemplates(c)
@@ -120,9 +250,9 @@ func (h *Handler) GetLabTemplates(c *gin.Context) {
 // @Security BearerAuth
 // @Param id path string true "Template ID"
 // @Success 200 {object} models.LabTemplate
-// @Failure 401 {object} map[string]interface{} "Unauthorized"
-// @Failure 404 {object} map[string]interface{} "Template not found"
-// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Failure 401 {object} handlers.ErrorResponse "Unauthorized"
+// @Failure 404 {object} handlers.ErrorResponse "Template not found"
+// @Failure 500 {object} handlers.ErrorResponse "Internal server error"
 // @Router /templates/{id} [get]
 func (h *Handler) GetLabTemplate(c *gin.Context) {
 	h.GetTemplate(c)
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/wcrum/labby/internal/models"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError describes why one field of a request body was rejected
+type FieldError struct {
+	Field   string `json:"field"`           // JSON name of the field, with its path for nested fields
+	Rule    string `json:"rule"`            // Validation rule that failed, such as required or oneof
+	Param   string `json:"param,omitempty"` // The rule's parameter, such as the allowed values of oneof
+	Message string `json:"message"`
+}
+
+func init() {
+	// Report fields by their JSON names, which is what clients send
+	if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// validationError returns the API error for a request body that failed binding validation or has a
+// field of the wrong type, listing each rejected field in the "fields" detail
+func validationError(err error) (*models.APIError, bool) {
+	var fields []FieldError
+
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErrs):
+		for _, fieldErr := range validationErrs {
+			fields = append(fields, FieldError{
+				Field:   fieldPath(fieldErr),
+				Rule:    fieldErr.Tag(),
+				Param:   fieldErr.Param(),
+				Message: fieldMessage(fieldErr),
+			})
+		}
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		fields = append(fields, FieldError{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Param:   typeErr.Type.String(),
+			Message: fmt.Sprintf("must be a %s, not a %s", typeErr.Type.Kind(), typeErr.Value),
+		})
+	default:
+		return nil, false
+	}
+
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = field.Field + " " + field.Message
+	}
+	return models.NewAPIError(models.CodeValidationFailed, strings.Join(messages, "; "), err).
+		WithDetail("fields", fields), true
+}
+
+// fieldPath returns a field's JSON path below the request struct, such as notify.email
+func fieldPath(fieldErr validator.FieldError) string {
+	_, path, found := strings.Cut(fieldErr.Namespace(), ".")
+	if !found {
+		return fieldErr.Field()
+	}
+	return path
+}
+
+// fieldMessage describes a failed validation rule in words
+func fieldMessage(fieldErr validator.FieldError) string {
+	param := fieldErr.Param()
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(param), ", ")
+	case "email":
+		return "must be a valid email address"
+	case "fqdn":
+		return "must be a valid domain name"
+	case "min", "max":
+		bound := "at least"
+		if fieldErr.Tag() == "max" {
+			bound = "at most"
+		}
+		switch fieldErr.Kind() {
+		case reflect.String:
+			return fmt.Sprintf("must be %s %s characters", bound, param)
+		case reflect.Slice, reflect.Map, reflect.Array:
+			return fmt.Sprintf("must have %s %s items", bound, param)
+		default:
+			return fmt.Sprintf("must be %s %s", bound, param)
+		}
+	default:
+		return fmt.Sprintf("is invalid (%s)", fieldErr.Tag())
+	}
+}
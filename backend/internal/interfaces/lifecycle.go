@@ -19,6 +19,12 @@ type Credential struct {
 	Notes     string    `json:"notes,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// Set for SSH key credentials
+	CredentialType models.CredentialType `json:"credential_type,omitempty"`
+	PublicKey      string                `json:"public_key,omitempty"`
+	PrivateKey     string                `json:"private_key,omitempty"`
+	// Set for secrets that should only be shown once, such as root passwords
+	OneTimeReveal bool `json:"one_time_reveal,omitempty"`
 }
 
 // SetupContext provides context and utilities for setup operations
@@ -31,6 +37,7 @@ type SetupContext struct {
 	Lab            *models.Lab // Reference to the lab for persistent data storage
 	AddCredential  func(credential *Credential) error
 	UpdateProgress func(stepName, status, message string) // Function to update progress steps
+	AddLog         func(message string)                   // Appends a line to the lab's progress log, e.g. command output
 }
 
 // CleanupContext provides context and utilities for cleanup operations
@@ -38,6 +45,50 @@ type CleanupContext struct {
 	LabID   string
 	Context context.Context
 	Lab     *models.Lab // Reference to the lab for accessing stored service data
+
+	// ShouldCleanup reports whether a service still needs cleaning up. Nil means every service does.
+	ShouldCleanup func(serviceID string) bool
+	// RecordCleanup is called with the outcome of each service's cleanup. Nil disables tracking.
+	RecordCleanup func(serviceID, serviceName string, err error)
+	// RecordResource is called with the outcome of each resource a service cleans up. Nil disables reporting.
+	RecordResource func(result ResourceCleanupResult)
+}
+
+// Resource cleanup statuses
+const (
+	ResourceCleanupSucceeded = "succeeded"
+	ResourceCleanupFailed    = "failed"
+	ResourceCleanupSkipped   = "skipped"
+)
+
+// ResourceCleanupResult is the outcome of one cleanup action on a single resource
+type ResourceCleanupResult struct {
+	Service  string `json:"service,omitempty"` // Filled in by whoever aggregates results across services
+	Resource string `json:"resource"`          // e.g. "project lab-abc123"
+	Action   string `json:"action"`            // e.g. "delete", "revoke"
+	Status   string `json:"status"`            // "succeeded", "failed" or "skipped"
+	Error    string `json:"error,omitempty"`   // Why the action failed or was skipped
+}
+
+// ReportResource records the outcome of a cleanup action on one resource; a nil error counts as success
+func (ctx *CleanupContext) ReportResource(resource, action string, err error) {
+	if ctx.RecordResource == nil {
+		return
+	}
+	result := ResourceCleanupResult{Resource: resource, Action: action, Status: ResourceCleanupSucceeded}
+	if err != nil {
+		result.Status = ResourceCleanupFailed
+		result.Error = err.Error()
+	}
+	ctx.RecordResource(result)
+}
+
+// SkipResource records a resource that cleanup left alone, and why
+func (ctx *CleanupContext) SkipResource(resource, action, reason string) {
+	if ctx.RecordResource == nil {
+		return
+	}
+	ctx.RecordResource(ResourceCleanupResult{Resource: resource, Action: action, Status: ResourceCleanupSkipped, Error: reason})
 }
 
 // Setup defines the contract for setup actions
@@ -58,12 +109,79 @@ type Lifecycle interface {
 	Cleanup
 }
 
+// LabResource represents an external resource created for a lab
+type LabResource struct {
+	Name      string    `json:"name"`
+	LabID     string    `json:"lab_id"`
+	CreatedAt time.Time `json:"created_at,omitempty"` // Zero when the backing API does not report creation time
+}
+
+// CredentialRotator is implemented by services that can regenerate a credential's secret on the
+// backing system. The credential is updated in place, and any ServiceData that mirrors the secret
+// is updated on the lab passed in.
+type CredentialRotator interface {
+	RotateCredential(ctx context.Context, lab *models.Lab, credential *models.Credential) error
+}
+
+// RegistrationToken is a device registration token a service issued for a lab, such as a Palette edge token
+type RegistrationToken struct {
+	UID        string    `json:"uid"`
+	Name       string    `json:"name"`
+	ProjectUID string    `json:"project_uid,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"`
+	Recorded   bool      `json:"recorded"` // Whether the lab's ServiceData records the token, rather than it matching by name or project
+}
+
+// RegistrationTokenManager is implemented by services that issue registration tokens for lab devices.
+// Tokens may outlive the lab, so they are found through the lab's ServiceData as well as by naming convention.
+type RegistrationTokenManager interface {
+	ListRegistrationTokens(ctx context.Context, lab *models.Lab) ([]RegistrationToken, error)
+	RevokeRegistrationToken(ctx context.Context, lab *models.Lab, tokenUID string) error
+}
+
+// ResourceLister is implemented by services that can enumerate the lab resources they manage
+type ResourceLister interface {
+	ListLabResources() ([]LabResource, error)
+}
+
+// ConnectionTester is implemented by services that can verify their endpoint and credentials
+// with a read-only request, without creating anything
+type ConnectionTester interface {
+	TestConnection() error
+}
+
+// ConfigField describes one key a service config of a service type accepts
+type ConfigField struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	Required    bool   `json:"required,omitempty"` // Setup fails without it, unless Env provides it
+	Secret      bool   `json:"secret,omitempty"`   // Holds a credential, best given as an env: or vault: reference
+	Default     string `json:"default,omitempty"`
+	Env         string `json:"env,omitempty"` // Environment variable used when the config doesn't set the key
+}
+
+// ConfigSchemaProvider is implemented by services that describe the keys their service configs accept
+type ConfigSchemaProvider interface {
+	ConfigSchema() []ConfigField
+}
+
+// ReadinessChecker is implemented by services whose provisioned endpoints may take a while to accept
+// users after setup returns. CheckReady makes a single attempt; the caller retries until it succeeds.
+type ReadinessChecker interface {
+	CheckReady(ctx context.Context, lab *models.Lab) error
+}
+
 // Service represents a service that can be set up and cleaned up
 type Service interface {
 	Lifecycle
 	GetName() string
 	GetDescription() string
 	GetRequiredParams() []string
+	// ServiceDataKeys returns the prefixes of the lab ServiceData keys the service records during setup
+	ServiceDataKeys() []string
+	// DescribeResources returns the names of the resources the service derives from a lab ID, keyed
+	// by the ServiceData key that cleanup reads them from
+	DescribeResources(labID string) map[string]string
 }
 
 // ServiceRegistry manages all available services
@@ -0,0 +1,149 @@
+package lab
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// Bulk lab actions
+const (
+	BulkActionStop    = "stop"    // Mark the lab expired and clean up its services, keeping the lab record
+	BulkActionDelete  = "delete"  // Clean up the lab's services and remove the lab
+	BulkActionCleanup = "cleanup" // Re-run service cleanup only, e.g. after a partially failed stop
+)
+
+// BulkLabFilter selects labs for a bulk action. Empty fields match every lab.
+type BulkLabFilter struct {
+	OwnerID   string
+	Status    models.LabStatus
+	Tag       string
+	OlderThan time.Duration // Only labs created more than this long ago
+}
+
+// IsEmpty reports whether the filter would match every lab
+func (f BulkLabFilter) IsEmpty() bool {
+	return f.OwnerID == "" && f.Status == "" && f.Tag == "" && f.OlderThan <= 0
+}
+
+// BulkLabResult is the outcome of a bulk action for a single lab
+type BulkLabResult struct {
+	LabID   string `json:"lab_id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// IsValidBulkAction reports whether action is a supported bulk action
+func IsValidBulkAction(action string) bool {
+	switch action {
+	case BulkActionStop, BulkActionDelete, BulkActionCleanup:
+		return true
+	default:
+		return false
+	}
+}
+
+// FindLabIDs returns the IDs of labs matching the filter, oldest first
+func (s *Service) FindLabIDs(filter BulkLabFilter) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cutoff := time.Now().Add(-filter.OlderThan)
+	matched := make([]*models.Lab, 0)
+	for _, lab := range s.labs {
+		if filter.OwnerID != "" && lab.OwnerID != filter.OwnerID {
+			continue
+		}
+		if filter.Status != "" && lab.Status != filter.Status {
+			continue
+		}
+		if filter.Tag != "" && !lab.HasTag(filter.Tag) {
+			continue
+		}
+		if filter.OlderThan > 0 && !lab.CreatedAt.Before(cutoff) {
+			continue
+		}
+		matched = append(matched, lab)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.Before(matched[j].CreatedAt)
+	})
+
+	ids := make([]string, 0, len(matched))
+	for _, lab := range matched {
+		ids = append(ids, lab.ID)
+	}
+	return ids
+}
+
+// BulkLabAction applies an action to every lab concurrently, bounded by the cleanup batch size,
+// and returns one result per lab in the order the IDs were given
+func (s *Service) BulkLabAction(action string, labIDs []string) ([]BulkLabResult, error) {
+	if !IsValidBulkAction(action) {
+		return nil, fmt.Errorf("unsupported bulk action: %s", action)
+	}
+
+	workers := s.cleanupConfig.BatchSize
+	if workers < 1 {
+		workers = 1
+	}
+
+	fmt.Printf("BulkLabAction: applying %s to %d labs with %d workers\n", action, len(labIDs), workers)
+
+	results := make([]BulkLabResult, len(labIDs))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				labID := labIDs[index]
+				result := BulkLabResult{LabID: labID, Success: true}
+
+				var err error
+				switch action {
+				case BulkActionStop:
+					err = s.StopLab(labID)
+				case BulkActionDelete:
+					err = s.DeleteLab(labID)
+				case BulkActionCleanup:
+					err = s.cleanupLabServices(labID)
+				}
+				if err != nil {
+					fmt.Printf("BulkLabAction: %s failed for lab %s: %v\n", action, labID, err)
+					result.Success = false
+					result.Error = err.Error()
+				}
+
+				results[index] = result
+			}
+		}()
+	}
+
+	for index := range labIDs {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, nil
+}
+
+// cleanupLabServices runs service cleanup for a lab without changing its status or removing it
+func (s *Service) cleanupLabServices(labID string) error {
+	s.mu.RLock()
+	lab, exists := s.labs[labID]
+	s.mu.RUnlock()
+	if !exists {
+		return ErrLabNotFound
+	}
+
+	return s.runCleanup(s.newCleanupContext(context.Background(), lab, false))
+}
@@ -0,0 +1,77 @@
+package lab
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// provisioningCancelWait bounds how long stopping or deleting a lab waits for its provisioning
+// goroutine to notice the cancellation before cleanup runs anyway
+const provisioningCancelWait = 2 * time.Minute
+
+// provisioningRun tracks a lab's in-flight provisioning goroutine
+type provisioningRun struct {
+	cancel context.CancelFunc
+	done   chan struct{} // Closed when the provisioning goroutine returns
+}
+
+// startProvisioning provisions a lab in the background with a cancellable context, once it gets a
+// provisioning slot. The caller must hold s.mu so the run is registered before anyone can stop or
+// delete the lab.
+func (s *Service) startProvisioning(labID, templateID string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &provisioningRun{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	s.provisioning[labID] = run
+	admitted := s.acquireProvisionSlotLocked(labID)
+
+	go func() {
+		defer func() {
+			cancel()
+			s.mu.Lock()
+			s.releaseProvisionSlotLocked(admitted)
+			if s.provisioning[labID] == run {
+				delete(s.provisioning, labID)
+			}
+			s.mu.Unlock()
+			close(run.done)
+		}()
+
+		select {
+		case <-admitted:
+		case <-ctx.Done():
+			fmt.Printf("Lab %s: provisioning cancelled while queued\n", labID)
+			return
+		}
+
+		s.provisionLabFromTemplate(ctx, labID, templateID)
+	}()
+}
+
+// cancelProvisioning cancels a lab's in-flight provisioning and waits for the goroutine to return,
+// so cleanup doesn't race services that are still creating resources. It reports whether
+// provisioning was running.
+func (s *Service) cancelProvisioning(labID string) bool {
+	s.mu.RLock()
+	run, exists := s.provisioning[labID]
+	s.mu.RUnlock()
+	if !exists {
+		return false
+	}
+
+	fmt.Printf("Lab %s: cancelling in-progress provisioning\n", labID)
+	s.progressTracker.AddLog(labID, "Cancelling provisioning")
+	run.cancel()
+
+	select {
+	case <-run.done:
+		fmt.Printf("Lab %s: provisioning stopped\n", labID)
+	case <-time.After(provisioningCancelWait):
+		fmt.Printf("Warning: lab %s provisioning did not stop within %v, cleaning up anyway\n", labID, provisioningCancelWait)
+	}
+
+	return true
+}
@@ -0,0 +1,52 @@
+package lab
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/wcrum/labby/internal/interfaces"
+)
+
+// ErrCleanupInProgress is returned when another cleanup of the same lab is already running
+var ErrCleanupInProgress = errors.New("cleanup already in progress for this lab")
+
+// runCleanup runs service cleanup for a lab while holding its cleanup lock, so the scheduler,
+// admins and timeouts never clean up the same lab at the same time. When the lock is held by
+// another cleanup it returns ErrCleanupInProgress without touching any service.
+func (s *Service) runCleanup(cleanupCtx *interfaces.CleanupContext) error {
+	if !s.acquireCleanupLock(cleanupCtx.LabID) {
+		fmt.Printf("Cleanup of lab %s skipped, another cleanup is in progress\n", cleanupCtx.LabID)
+		return ErrCleanupInProgress
+	}
+	defer s.releaseCleanupLock(cleanupCtx.LabID)
+
+	// Services still provisioning other parts of the lab may merge ServiceData into it meanwhile,
+	// so service cleanup reads from a private copy
+	if cleanupCtx.Lab != nil {
+		isolatedCtx := *cleanupCtx
+		isolatedCtx.Lab = s.isolatedLabCopy(cleanupCtx.Lab)
+		cleanupCtx = &isolatedCtx
+	}
+
+	return s.serviceManager.CleanupLabServices(cleanupCtx)
+}
+
+// acquireCleanupLock marks a lab as being cleaned up and reports whether it wasn't already
+func (s *Service) acquireCleanupLock(labID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, locked := s.cleaning[labID]; locked {
+		return false
+	}
+	s.cleaning[labID] = struct{}{}
+	return true
+}
+
+// releaseCleanupLock marks a lab's cleanup as finished
+func (s *Service) releaseCleanupLock(labID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.cleaning, labID)
+}
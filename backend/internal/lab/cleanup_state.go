@@ -0,0 +1,118 @@
+package lab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+	"github.com/wcrum/labby/internal/models"
+)
+
+// ErrNoFailedCleanup is returned when retrying cleanup for a lab that has no failed services
+var ErrNoFailedCleanup = errors.New("lab has no failed service cleanups")
+
+// newCleanupContext builds a cleanup context that records each service's outcome on the lab and skips
+// services that were already cleaned up. With failedOnly set, only services whose last attempt failed run.
+func (s *Service) newCleanupContext(ctx context.Context, lab *models.Lab, failedOnly bool) *interfaces.CleanupContext {
+	cleanupCtx := &interfaces.CleanupContext{
+		LabID:   lab.ID,
+		Context: ctx,
+		Lab:     lab,
+	}
+	s.trackCleanup(cleanupCtx, failedOnly)
+	return cleanupCtx
+}
+
+// trackCleanup attaches the cleanup state hooks for a lab to a cleanup context
+func (s *Service) trackCleanup(cleanupCtx *interfaces.CleanupContext, failedOnly bool) {
+	lab := cleanupCtx.Lab
+
+	cleanupCtx.ShouldCleanup = func(serviceID string) bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+
+		state, exists := lab.CleanupState[serviceID]
+		if failedOnly {
+			return exists && state.Status == models.CleanupStatusFailed
+		}
+		return !exists || state.Status != models.CleanupStatusCompleted
+	}
+
+	cleanupCtx.RecordCleanup = func(serviceID, serviceName string, err error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if lab.CleanupState == nil {
+			lab.CleanupState = make(models.CleanupState)
+		}
+		state, exists := lab.CleanupState[serviceID]
+		if !exists {
+			state = &models.ServiceCleanupState{ServiceID: serviceID}
+			lab.CleanupState[serviceID] = state
+		}
+
+		state.Service = serviceName
+		state.Attempts++
+		state.UpdatedAt = time.Now()
+		if err != nil {
+			state.Status = models.CleanupStatusFailed
+			state.Error = err.Error()
+		} else {
+			state.Status = models.CleanupStatusCompleted
+			state.Error = ""
+		}
+		lab.Version++
+	}
+}
+
+// GetLabCleanupState returns a copy of a lab's per-service cleanup progress
+func (s *Service) GetLabCleanupState(labID string) (models.CleanupState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lab, exists := s.labs[labID]
+	if !exists {
+		return nil, ErrLabNotFound
+	}
+
+	return copyCleanupState(lab.CleanupState), nil
+}
+
+// RetryLabCleanup re-runs cleanup for only the services whose last attempt failed and returns the updated state
+func (s *Service) RetryLabCleanup(ctx context.Context, labID string) (models.CleanupState, error) {
+	s.mu.RLock()
+	lab, exists := s.labs[labID]
+	var failed []string
+	if exists {
+		failed = lab.CleanupState.FailedServices()
+	}
+	s.mu.RUnlock()
+	if !exists {
+		return nil, ErrLabNotFound
+	}
+	if len(failed) == 0 {
+		return nil, ErrNoFailedCleanup
+	}
+
+	fmt.Printf("RetryLabCleanup: retrying cleanup of %v for lab %s\n", failed, labID)
+	if err := s.runCleanup(s.newCleanupContext(ctx, lab, true)); err != nil {
+		if errors.Is(err, ErrCleanupInProgress) {
+			return nil, err
+		}
+		fmt.Printf("RetryLabCleanup: cleanup still failing for lab %s: %v\n", labID, err)
+	}
+
+	return s.GetLabCleanupState(labID)
+}
+
+// copyCleanupState copies cleanup state so callers can read it without holding the lab lock
+func copyCleanupState(state models.CleanupState) models.CleanupState {
+	copied := make(models.CleanupState, len(state))
+	for serviceID, serviceState := range state {
+		serviceCopy := *serviceState
+		copied[serviceID] = &serviceCopy
+	}
+	return copied
+}
@@ -0,0 +1,57 @@
+package lab
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+	"github.com/wcrum/labby/internal/models"
+)
+
+// ServiceConfigTestResult is the outcome of a connectivity and authentication probe against a service config
+type ServiceConfigTestResult struct {
+	ServiceConfigID string    `json:"service_config_id"`
+	ServiceType     string    `json:"service_type"`
+	Success         bool      `json:"success"`
+	Error           string    `json:"error,omitempty"`
+	DurationMs      int64     `json:"duration_ms"`
+	TestedAt        time.Time `json:"tested_at"`
+}
+
+// TestServiceConfig configures the service behind a service config and runs a read-only probe against it.
+// A failed probe is reported in the result; an error is only returned when the config cannot be tested at all.
+func (s *Service) TestServiceConfig(configID string) (*ServiceConfigTestResult, error) {
+	config, exists := s.serviceConfigManager.GetServiceConfig(configID)
+	if !exists {
+		return nil, models.ErrServiceConfigNotFound
+	}
+
+	service, err := newServiceFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	tester, ok := service.(interfaces.ConnectionTester)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrConnectionTestUnsupported, config.Type)
+	}
+
+	fmt.Printf("Testing service config %s (%s)\n", config.ID, config.Type)
+
+	result := &ServiceConfigTestResult{
+		ServiceConfigID: config.ID,
+		ServiceType:     config.Type,
+		TestedAt:        time.Now(),
+	}
+
+	err = tester.TestConnection()
+	result.DurationMs = time.Since(result.TestedAt).Milliseconds()
+	if err != nil {
+		fmt.Printf("Service config %s test failed: %v\n", config.ID, err)
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	fmt.Printf("Service config %s test succeeded in %dms\n", config.ID, result.DurationMs)
+	result.Success = true
+	return result, nil
+}
@@ -16,49 +16,121 @@ var (
 	ErrLabExpired      = errors.New("lab expired")
 	ErrLabNotReady     = errors.New("lab not ready")
 	ErrInvalidDuration = errors.New("invalid duration")
+	ErrNoTerraformRun  = errors.New("lab has no terraform run")
+	ErrInvalidStartAt  = errors.New("invalid start time")
+	ErrLabNotScheduled = errors.New("lab is not scheduled")
+
+	ErrConnectionTestUnsupported = errors.New("connection test not supported for service type")
+	ErrServiceSetupTimeout       = errors.New("service setup timed out")
+	ErrLabShareNotFound          = errors.New("lab is not shared with this user")
+	ErrInvalidAccessLevel        = errors.New("invalid lab access level")
+	ErrServiceConfigsNotLoaded   = errors.New("service configs were not loaded from a directory")
+	ErrLabNotStopped             = errors.New("lab is not stopped")
+	ErrNoTerraformService        = errors.New("lab has no terraform cloud service")
+	ErrLabLifetimeExceeded       = errors.New("lab lifetime exceeds the maximum")
+	ErrInvalidServiceConfig      = errors.New("invalid service config")
 )
 
 // Service handles lab lifecycle management
 type Service struct {
-	labs                 map[string]*models.Lab
-	mu                   sync.RWMutex
-	serviceManager       *services.ServiceManager
-	progressTracker      *ProgressTracker
-	templateManager      *models.LabTemplateManager
-	templateLoader       *TemplateLoader
-	serviceConfigManager *models.ServiceConfigManager
+	labs                    map[string]*models.Lab
+	mu                      sync.RWMutex
+	serviceManager          *services.ServiceManager
+	progressTracker         *ProgressTracker
+	templateManager         *models.LabTemplateManager
+	templateLoader          *TemplateLoader
+	templatesDir            string // Directory templates are loaded from and imported templates are written to
+	serviceConfigManager    *models.ServiceConfigManager
+	serviceConfigsDir       string     // Directory service configs are loaded and reloaded from
+	serviceLimitsDir        string     // Directory service limits are loaded and reloaded from
+	serviceConfigReloadMu   sync.Mutex // Serializes service config reloads
+	reconciler              *Reconciler
+	cleanupConfig           CleanupSchedulerConfig
+	setupTimeouts           ServiceSetupTimeouts
+	provisioningConcurrency int                                    // Maximum services of one lab provisioned at the same time
+	shares                  map[string]map[string]*models.LabShare // Lab ID -> user ID -> share
+	provisioning            map[string]*provisioningRun            // Lab ID -> in-flight provisioning, guarded by mu
+	events                  *labEventBus                           // Lab creation, status and deletion events for live dashboards
+	cleaning                map[string]struct{}                    // Lab IDs whose services are being cleaned up, guarded by mu
+	notifier                *Notifier                              // Ready and failure notifications for lab owners, nil when disabled
+	healthProber            *healthProber                          // Shared HTTP clients for dependency health checks
+	maxConcurrentProvisions int                                    // Labs provisioned at the same time, 0 for no limit
+	activeProvisions        int                                    // Labs holding a provisioning slot, guarded by mu
+	provisionQueue          []queuedProvision                      // Labs waiting for a provisioning slot, oldest first, guarded by mu
+	expiryWarnings          map[string]*expiryWarningState         // Lab ID -> expiry warnings already sent, guarded by mu
+	timeline                *labTimelineStore                      // Progress logs and status transitions, kept after labs finish
+	organizationResolver    func(userID string) (string, error)    // Looks up lab owners' organizations, nil when organizations aren't used
+	stopGracePeriod         time.Duration                          // How long stopped labs keep their resources, 0 to clean up on stop
+	idleTimeout             time.Duration                          // How long ready labs may go unused before they expire, 0 to disable
+	maxLabLifetime          time.Duration                          // Longest a lab may run from start to end, however it was created, 0 for no cap
 }
 
 // NewService creates a new lab service
 func NewService() *Service {
 	templateManager := models.NewLabTemplateManager()
-	templateLoader := NewTemplateLoader(templateManager)
 	serviceConfigManager := models.NewServiceConfigManager()
-
-	return &Service{
-		labs:                 make(map[string]*models.Lab),
-		serviceManager:       services.NewServiceManager(serviceConfigManager),
-		progressTracker:      NewProgressTracker(),
-		templateManager:      templateManager,
-		templateLoader:       templateLoader,
-		serviceConfigManager: serviceConfigManager,
+	templateLoader := NewTemplateLoader(templateManager, serviceConfigManager)
+
+	s := &Service{
+		labs:                    make(map[string]*models.Lab),
+		serviceManager:          services.NewServiceManager(serviceConfigManager),
+		progressTracker:         NewProgressTracker(),
+		templateManager:         templateManager,
+		templateLoader:          templateLoader,
+		serviceConfigManager:    serviceConfigManager,
+		cleanupConfig:           DefaultCleanupSchedulerConfig(),
+		setupTimeouts:           DefaultServiceSetupTimeouts(),
+		provisioningConcurrency: DefaultProvisioningConcurrency,
+		shares:                  make(map[string]map[string]*models.LabShare),
+		provisioning:            make(map[string]*provisioningRun),
+		events:                  newLabEventBus(),
+		cleaning:                make(map[string]struct{}),
+		healthProber:            newHealthProber(),
+		maxConcurrentProvisions: DefaultMaxConcurrentProvisions,
+		expiryWarnings:          make(map[string]*expiryWarningState),
+		timeline:                newLabTimelineStore(),
+		stopGracePeriod:         DefaultStopGracePeriod,
 	}
+	s.reconciler = NewReconciler(s, DefaultReconcileGracePeriod)
+	s.progressTracker.SetFailureHandler(s.recordFailure)
+	s.progressTracker.SetLogHandler(s.recordLabLog)
+
+	return s
 }
 
-// CreateLab creates a new lab session
-func (s *Service) CreateLab(name, ownerID string, durationMinutes int) (*models.Lab, error) {
+// CreateLab creates a new lab session. The name is optional and defaults to lab-<id>.
+func (s *Service) CreateLab(name, ownerID string, durationMinutes int, tags []string) (*models.Lab, error) {
 	if durationMinutes < MinLabDurationMinutes || durationMinutes > MaxLabDurationMinutes {
 		return nil, ErrInvalidDuration
 	}
+	if err := s.checkLabLifetime(time.Duration(durationMinutes) * time.Minute); err != nil {
+		return nil, err
+	}
+
+	name, err := normalizeLabName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err = normalizeLabTags(tags)
+	if err != nil {
+		return nil, err
+	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	now := time.Now()
 	labID := models.GenerateID()
+	if name == "" {
+		name = fmt.Sprintf("lab-%s", labID) // Use consistent lab name format
+	} else if err := s.checkLabNameAvailable(ownerID, name); err != nil {
+		return nil, err
+	}
+
 	lab := &models.Lab{
 		ID:           labID,
-		Name:         fmt.Sprintf("lab-%s", labID), // Use consistent lab name format
+		Name:         name,
 		Status:       models.LabStatusProvisioning,
 		OwnerID:      ownerID,
 		StartedAt:    now,
@@ -67,16 +139,19 @@ func (s *Service) CreateLab(name, ownerID string, durationMinutes int) (*models.
 		UpdatedAt:    now,
 		Credentials:  []models.Credential{},
 		UsedServices: []string{}, // Empty for labs created without templates
+		Tags:         tags,
+		Version:      1,
 	}
 
 	s.labs[lab.ID] = lab
+	s.publishLabCreated(lab)
 
 	// Initialize progress tracking
 	s.progressTracker.InitializeProgress(lab.ID)
 	s.progressTracker.AddLog(lab.ID, "Lab creation started")
 
 	// Start lab provisioning
-	go s.provisionLabFromTemplate(lab.ID, "")
+	s.startProvisioning(lab.ID, "")
 
 	return lab, nil
 }
@@ -86,14 +161,15 @@ func (s *Service) GetProgress(labID string) *LabProgress {
 	return s.progressTracker.GetProgress(labID)
 }
 
-// LoadTemplates loads lab templates from a directory
+// LoadTemplates loads lab templates from a directory. Service configs must be loaded first, since
+// templates referencing unknown service configs are rejected. Templates that load are kept even
+// when others fail.
 func (s *Service) LoadTemplates(dirPath string) error {
 	fmt.Printf("Service.LoadTemplates: Loading from %s\n", dirPath)
-	templateLoader := NewTemplateLoader(s.templateManager)
-	err := templateLoader.LoadTemplatesFromDirectory(dirPath)
+	s.templatesDir = dirPath
+	err := s.templateLoader.LoadTemplatesFromDirectory(dirPath)
 	if err != nil {
 		fmt.Printf("Service.LoadTemplates: Failed to load: %v\n", err)
-		return err
 	}
 
 	// Enrich templates with service type information
@@ -108,12 +184,13 @@ func (s *Service) LoadTemplates(dirPath string) error {
 			fmt.Printf("    * %s (ID: %s, Type: %s)\n", service.Name, service.ServiceID, service.Type)
 		}
 	}
-	return nil
+	return err
 }
 
 // LoadServiceConfigs loads service configurations from a directory
 func (s *Service) LoadServiceConfigs(dirPath string) error {
 	fmt.Printf("Service.LoadServiceConfigs: Loading from %s\n", dirPath)
+	s.serviceConfigsDir = dirPath
 	serviceConfigLoader := NewServiceConfigLoader(s.serviceConfigManager)
 	err := serviceConfigLoader.LoadServiceConfigsFromDirectory(dirPath)
 	if err != nil {
@@ -133,6 +210,7 @@ func (s *Service) LoadServiceConfigs(dirPath string) error {
 // LoadServiceLimits loads service limits from a directory
 func (s *Service) LoadServiceLimits(dirPath string) error {
 	fmt.Printf("Service.LoadServiceLimits: Loading from %s\n", dirPath)
+	s.serviceLimitsDir = dirPath
 	serviceConfigLoader := NewServiceConfigLoader(s.serviceConfigManager)
 	err := serviceConfigLoader.LoadServiceLimitsFromDirectory(dirPath)
 	if err != nil {
@@ -149,76 +227,206 @@ func (s *Service) LoadServiceLimits(dirPath string) error {
 	return nil
 }
 
+// ServiceConfigReload is the outcome of reloading service configs and limits
+type ServiceConfigReload struct {
+	models.ServiceConfigChanges
+	Configs int `json:"configs"` // Service configs loaded
+	Limits  int `json:"limits"`  // Service limits loaded
+}
+
+// ReloadServiceConfigs loads service configs and limits again from the directories they were first
+// loaded from and swaps them in at once, replacing configs and limits created or updated through the
+// admin API since. When any file fails to load, nothing is replaced. Templates are re-enriched with
+// the new service types afterwards.
+func (s *Service) ReloadServiceConfigs() (*ServiceConfigReload, error) {
+	s.serviceConfigReloadMu.Lock()
+	defer s.serviceConfigReloadMu.Unlock()
+
+	if s.serviceConfigsDir == "" {
+		return nil, ErrServiceConfigsNotLoaded
+	}
+	fmt.Printf("Service.ReloadServiceConfigs: Reloading from %s\n", s.serviceConfigsDir)
+
+	staged := models.NewServiceConfigManager()
+	loader := NewServiceConfigLoader(staged)
+	if err := loader.LoadServiceConfigsFromDirectory(s.serviceConfigsDir); err != nil {
+		return nil, fmt.Errorf("failed to load service configs: %w", err)
+	}
+	if s.serviceLimitsDir != "" {
+		if err := loader.LoadServiceLimitsFromDirectory(s.serviceLimitsDir); err != nil {
+			return nil, fmt.Errorf("failed to load service limits: %w", err)
+		}
+	}
+
+	configs := staged.GetAllServiceConfigs()
+	limits := staged.GetAllServiceLimits()
+	changes := s.serviceConfigManager.ReplaceAll(configs, limits)
+	s.templateManager.EnrichTemplatesWithServiceTypes(s.serviceConfigManager)
+
+	fmt.Printf("Service.ReloadServiceConfigs: %d configs (added %v, removed %v, changed %v), %d limits (added %v, removed %v, changed %v)\n",
+		len(configs), changes.AddedConfigs, changes.RemovedConfigs, changes.ChangedConfigs,
+		len(limits), changes.AddedLimits, changes.RemovedLimits, changes.ChangedLimits)
+	return &ServiceConfigReload{ServiceConfigChanges: changes, Configs: len(configs), Limits: len(limits)}, nil
+}
+
 // GetTemplates returns all available lab templates
 func (s *Service) GetTemplates() []*models.LabTemplate {
 	return s.templateManager.GetAllTemplates()
 }
 
+// FilterTemplates returns the lab templates matching a category, tag and search query
+func (s *Service) FilterTemplates(filter models.TemplateFilter) []*models.LabTemplate {
+	return s.templateManager.FilterTemplates(filter)
+}
+
+// OnTemplatesChange registers a function called whenever templates are loaded, imported or re-enriched
+func (s *Service) OnTemplatesChange(hook func()) {
+	s.templateManager.OnChange(hook)
+}
+
+// GetTemplateFacets returns the distinct template categories and tags
+func (s *Service) GetTemplateFacets() models.TemplateFacets {
+	return s.templateManager.GetFacets()
+}
+
 // GetTemplate returns a specific lab template
 func (s *Service) GetTemplate(templateID string) (*models.LabTemplate, bool) {
 	return s.templateManager.GetTemplate(templateID)
 }
 
+// CheckTemplateAvailability reports whether a lab could be created from a template now, returning
+// ErrTemplateNotFound or an APIError naming the service that is unavailable or at its limit
+func (s *Service) CheckTemplateAvailability(templateID string) error {
+	template, exists := s.templateManager.GetTemplate(templateID)
+	if !exists {
+		return ErrTemplateNotFound
+	}
+	return s.checkTemplateServices(template, false)
+}
+
 // EnrichTemplatesWithServiceTypes enriches all templates with service type information
 func (s *Service) EnrichTemplatesWithServiceTypes() {
 	s.templateManager.EnrichTemplatesWithServiceTypes(s.serviceConfigManager)
 }
 
-// CreateLabFromTemplate creates a lab from a template
-func (s *Service) CreateLabFromTemplate(templateID, ownerID string) (*models.Lab, error) {
+// CreateLabFromTemplate creates a lab from a template. When startAt is set, the lab is scheduled
+// and provisioned by the lab scheduler at that time instead of immediately. The name is optional
+// and defaults to the template name followed by the lab ID; a name already used by one of the
+// owner's active labs is rejected. A durationMinutes of zero uses the template's default duration.
+func (s *Service) CreateLabFromTemplate(templateID, ownerID, name string, durationMinutes int, variables map[string]string, startAt *time.Time, notify *models.LabNotification, tags []string) (*models.Lab, error) {
 	fmt.Printf("CreateLabFromTemplate: Starting lab creation for template %s, owner %s\n", templateID, ownerID)
 
+	name, err := normalizeLabName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err = normalizeLabTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if startAt != nil {
+		if err := validateStartAt(*startAt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validateNotification(notify); err != nil {
+		return nil, err
+	}
+
 	// Get the template
 	template, exists := s.templateManager.GetTemplate(templateID)
 	if !exists {
 		fmt.Printf("CreateLabFromTemplate: Template %s not found\n", templateID)
-		return nil, errors.New("template not found")
+		return nil, ErrTemplateNotFound
 	}
 	fmt.Printf("CreateLabFromTemplate: Found template %s with %d services\n", templateID, len(template.Services))
 
 	// Check service availability and limits for all services in the template
-	for _, serviceRef := range template.Services {
-		fmt.Printf("CreateLabFromTemplate: Checking service %s (ID: %s)\n", serviceRef.Name, serviceRef.ServiceID)
-
-		// Get current usage for this service
-		currentUsage := s.getServiceUsage(serviceRef.ServiceID)
-		fmt.Printf("CreateLabFromTemplate: Service %s current usage: %d\n", serviceRef.ServiceID, currentUsage)
+	if err := s.checkTemplateServices(template, startAt != nil); err != nil {
+		return nil, err
+	}
 
-		// Check if service is available and within limits
-		if err := s.serviceConfigManager.CheckServiceAvailability(serviceRef.ServiceID, currentUsage); err != nil {
-			fmt.Printf("CreateLabFromTemplate: Service %s availability check failed: %v\n", serviceRef.ServiceID, err)
-			return nil, fmt.Errorf("service %s (%s) not available: %w", serviceRef.Name, serviceRef.ServiceID, err)
-		}
-		fmt.Printf("CreateLabFromTemplate: Service %s availability check passed\n", serviceRef.ServiceID)
+	// Labs keep their owner's organization, so they use its service config overrides until they are removed
+	organizationID, err := s.ownerOrganization(ownerID)
+	if err != nil {
+		return nil, err
 	}
 
 	fmt.Printf("CreateLabFromTemplate: All service checks passed, creating lab from template\n")
-	lab, err := s.templateLoader.CreateLabFromTemplate(templateID, ownerID)
+	lab, err := s.templateLoader.CreateLabFromTemplate(templateID, ownerID, durationMinutes, variables)
 	if err != nil {
 		fmt.Printf("CreateLabFromTemplate: Failed to create lab from template: %v\n", err)
 		return nil, err
 	}
 	fmt.Printf("CreateLabFromTemplate: Lab created with ID %s\n", lab.ID)
+	// Templates may set their own maximum and default durations, which the cap applies to as well
+	if err := s.checkLabLifetime(lab.EndsAt.Sub(lab.StartedAt)); err != nil {
+		return nil, err
+	}
+	lab.OrganizationID = organizationID
+	lab.Tags = tags
+
+	if startAt != nil {
+		duration := lab.EndsAt.Sub(lab.StartedAt)
+		lab.Status = models.LabStatusScheduled
+		lab.StartedAt = *startAt
+		lab.EndsAt = startAt.Add(duration)
+	}
+	if notify.Enabled() {
+		lab.Notify = notify
+	}
 
 	s.mu.Lock()
+	if name != "" {
+		if err := s.checkLabNameAvailable(ownerID, name); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		lab.Name = name
+	}
+	// Check the limits again now that the lab is about to count against them, since other labs may
+	// have been created since the check above
+	if startAt == nil {
+		if err := s.checkTemplateServicesLocked(template, false); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+	}
 	s.labs[lab.ID] = lab
+	s.publishLabCreated(lab)
 	s.mu.Unlock()
 
 	// Initialize progress tracking
 	s.progressTracker.InitializeProgress(lab.ID)
+
+	if startAt != nil {
+		s.progressTracker.AddLog(lab.ID, fmt.Sprintf("Lab scheduled to start at %s", startAt.Format(time.RFC3339)))
+		fmt.Printf("CreateLabFromTemplate: Lab %s scheduled for %s\n", lab.ID, startAt.Format(time.RFC3339))
+		return lab, nil
+	}
+
 	s.progressTracker.AddLog(lab.ID, "Lab creation started from template")
 
 	// Start lab provisioning
 	fmt.Printf("CreateLabFromTemplate: Starting lab provisioning for lab %s\n", lab.ID)
-	go s.provisionLabFromTemplate(lab.ID, templateID)
+	s.mu.Lock()
+	s.startProvisioning(lab.ID, templateID)
+	s.mu.Unlock()
 
 	fmt.Printf("CreateLabFromTemplate: Lab creation completed successfully for lab %s\n", lab.ID)
 	return lab, nil
 }
 
-// CleanupLabServices executes cleanup for a specific lab
+// CleanupLabServices executes cleanup for a specific lab, skipping services that were already cleaned up.
+// It returns ErrCleanupInProgress when the lab is already being cleaned up.
 func (s *Service) CleanupLabServices(cleanupCtx *interfaces.CleanupContext) error {
-	return s.serviceManager.CleanupLabServices(cleanupCtx)
+	if cleanupCtx.Lab != nil && cleanupCtx.RecordCleanup == nil {
+		s.trackCleanup(cleanupCtx, false)
+	}
+	return s.runCleanup(cleanupCtx)
 }
 
 // ConvertLabToResponse converts a Lab to LabResponse by looking up the owner
@@ -250,7 +458,7 @@ func (s *Service) ConvertLabToResponse(lab *models.Lab, authService interface{})
 	// Enrich used services with service config information
 	var enrichedServices []models.ServiceReference
 	for _, serviceID := range lab.UsedServices {
-		if serviceConfig, exists := s.serviceConfigManager.GetServiceConfig(serviceID); exists {
+		if serviceConfig, exists := s.serviceConfigManager.ResolveServiceConfig(serviceID, lab.OrganizationID); exists {
 			enrichedServices = append(enrichedServices, models.ServiceReference{
 				Name:        serviceConfig.Name,
 				ServiceID:   serviceConfig.ID,
@@ -261,52 +469,81 @@ func (s *Service) ConvertLabToResponse(lab *models.Lab, authService interface{})
 		}
 	}
 
+	// Report labs past their end time as expired, matching how lab lists filter them
+	status := lab.Status
+	if models.IsExpired(lab.EndsAt) {
+		status = models.LabStatusExpired
+	}
+
 	return &models.LabResponse{
-		ID:           lab.ID,
-		Name:         lab.Name,
-		Status:       lab.Status,
-		Owner:        owner,
-		StartedAt:    lab.StartedAt,
-		EndsAt:       lab.EndsAt,
-		Credentials:  lab.Credentials,
-		UsedServices: enrichedServices,
+		ID:               lab.ID,
+		Name:             lab.Name,
+		Status:           status,
+		Owner:            owner,
+		StartedAt:        lab.StartedAt,
+		EndsAt:           lab.EndsAt,
+		Credentials:      credentialsWithExpiryWarnings(lab.Credentials, lab.EndsAt),
+		CredentialsCount: len(lab.Credentials),
+		CredentialsURL:   fmt.Sprintf("/api/labs/%s/credentials", lab.ID),
+		UsedServices:     enrichedServices,
+		Resources:        s.labResources(lab),
+		Tags:             lab.Tags,
+		LastActivityAt:   lab.LastActivityAt,
+		IdleExpiresAt:    s.idleExpiresAt(lab),
+		Version:          lab.Version,
 	}
 }
 
-// getServiceUsage returns the current number of active labs using a specific service
-func (s *Service) getServiceUsage(serviceID string) int {
+// labResources returns the names of the resources a lab's services recorded in ServiceData, such as its
+// project or workspace. Only resources services describe are included, never connection settings or secrets.
+func (s *Service) labResources(lab *models.Lab) map[string]string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	count := 0
-	for _, lab := range s.labs {
-		if lab.Status == models.LabStatusReady || lab.Status == models.LabStatusProvisioning {
-			// Check if this lab uses the specified service
-			for _, usedService := range lab.UsedServices {
-				if usedService == serviceID {
-					count++
-					break
+	var resources map[string]string
+	for _, serviceID := range lab.UsedServices {
+		config, exists := s.serviceConfigManager.ResolveServiceConfig(serviceID, lab.OrganizationID)
+		if !exists {
+			continue
+		}
+		service, exists := s.serviceManager.GetServiceByType(config.Type)
+		if !exists {
+			continue
+		}
+		for key := range service.DescribeResources(lab.ID) {
+			if value := lab.ServiceData[key]; value != "" {
+				if resources == nil {
+					resources = make(map[string]string)
 				}
+				resources[key] = value
 			}
 		}
 	}
-	return count
+	return resources
 }
 
-// GetServiceUsage returns usage information for all services
-func (s *Service) GetServiceUsage() []*models.ServiceUsage {
-	usage := make([]*models.ServiceUsage, 0)
+// credentialExpirySlack absorbs the rounding of lab durations to whole minutes when services
+// compute credential expiry from the remaining lab time
+const credentialExpirySlack = time.Minute
 
-	// Get all service configs
-	configs := s.serviceConfigManager.GetAllServiceConfigs()
+// credentialsWithExpiryWarnings returns a copy of credentials with ExpiresBeforeLab set on those
+// that expire before the lab ends
+func credentialsWithExpiryWarnings(credentials []models.Credential, endsAt time.Time) []models.Credential {
+	if credentials == nil {
+		return nil
+	}
 
-	for _, config := range configs {
-		currentUsage := s.getServiceUsage(config.ID)
-		usageInfo := s.serviceConfigManager.GetServiceUsage(config.ID, currentUsage)
-		usage = append(usage, usageInfo)
+	result := make([]models.Credential, len(credentials))
+	for i, credential := range credentials {
+		credential.ExpiresBeforeLab = !credential.ExpiresAt.IsZero() && credential.ExpiresAt.Add(credentialExpirySlack).Before(endsAt)
+		result[i] = credential
 	}
+	return result
+}
 
-	return usage
+// GetReconciler returns the orphaned resource reconciler
+func (s *Service) GetReconciler() *Reconciler {
+	return s.reconciler
 }
 
 // GetServiceConfigManager returns the service configuration manager
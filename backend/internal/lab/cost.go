@@ -0,0 +1,106 @@
+package lab
+
+import (
+	"math"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// ServiceCostEstimate is the estimated cost of one service of a lab
+type ServiceCostEstimate struct {
+	ServiceID     string  `json:"service_id"`
+	Name          string  `json:"name"`
+	CostPerHour   float64 `json:"cost_per_hour"`
+	CostToDate    float64 `json:"cost_to_date"`
+	EstimatedCost float64 `json:"estimated_cost"` // For the lab's full scheduled duration
+}
+
+// LabCostEstimate is an estimate of a lab's cost from the configured hourly rates of its services.
+// It is not billing data: rates come from service configs and templates, not the providers.
+type LabCostEstimate struct {
+	LabID         string                `json:"lab_id"`
+	CostPerHour   float64               `json:"cost_per_hour"` // Sum of the service rates
+	ElapsedHours  float64               `json:"elapsed_hours"`
+	TotalHours    float64               `json:"total_hours"`
+	CostToDate    float64               `json:"cost_to_date"`
+	EstimatedCost float64               `json:"estimated_cost"` // For the lab's full scheduled duration
+	Services      []ServiceCostEstimate `json:"services"`
+	CalculatedAt  time.Time             `json:"calculated_at"`
+}
+
+// GetLabCostEstimate estimates a lab's cost to date and for its full duration
+func (s *Service) GetLabCostEstimate(labID string) (*LabCostEstimate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lab, exists := s.labs[labID]
+	if !exists {
+		return nil, ErrLabNotFound
+	}
+
+	return s.estimateLabCost(lab, time.Now()), nil
+}
+
+// estimateLabCost prices each service the lab uses at its hourly rate over the time the lab has run
+// and over its scheduled duration. The caller must hold s.mu.
+func (s *Service) estimateLabCost(lab *models.Lab, now time.Time) *LabCostEstimate {
+	elapsedEnd := lab.EndsAt
+	if now.Before(elapsedEnd) {
+		elapsedEnd = now
+	}
+	elapsedHours := math.Max(elapsedEnd.Sub(lab.StartedAt).Hours(), 0)
+	totalHours := math.Max(lab.EndsAt.Sub(lab.StartedAt).Hours(), 0)
+
+	estimate := &LabCostEstimate{
+		LabID:        lab.ID,
+		ElapsedHours: roundCost(elapsedHours),
+		TotalHours:   roundCost(totalHours),
+		Services:     []ServiceCostEstimate{},
+		CalculatedAt: now,
+	}
+
+	for _, serviceID := range lab.UsedServices {
+		rate, name := s.serviceCostPerHour(lab.TemplateID, serviceID, lab.OrganizationID)
+		estimate.Services = append(estimate.Services, ServiceCostEstimate{
+			ServiceID:     serviceID,
+			Name:          name,
+			CostPerHour:   rate,
+			CostToDate:    roundCost(rate * elapsedHours),
+			EstimatedCost: roundCost(rate * totalHours),
+		})
+		estimate.CostPerHour += rate
+	}
+	estimate.CostToDate = roundCost(estimate.CostPerHour * elapsedHours)
+	estimate.EstimatedCost = roundCost(estimate.CostPerHour * totalHours)
+
+	return estimate
+}
+
+// serviceCostPerHour returns the hourly rate of a service in a lab: the template's cost_per_hour for the
+// service if it sets one, otherwise the service config's, or that of the organization's override. Unknown
+// services cost nothing.
+func (s *Service) serviceCostPerHour(templateID, serviceID, organizationID string) (float64, string) {
+	name := serviceID
+	rate := 0.0
+	if serviceConfig, exists := s.serviceConfigManager.ResolveServiceConfig(serviceID, organizationID); exists {
+		name = serviceConfig.Name
+		rate = serviceConfig.CostPerHour
+	}
+
+	if template, exists := s.templateManager.GetTemplate(templateID); exists {
+		for _, serviceRef := range template.Services {
+			if serviceRef.ServiceID == serviceID && serviceRef.CostPerHour != nil {
+				rate = *serviceRef.CostPerHour
+				break
+			}
+		}
+	}
+
+	return rate, name
+}
+
+// roundCost rounds to cents (or hundredths of an hour)
+func roundCost(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,171 @@
+package lab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+	"github.com/wcrum/labby/internal/models"
+)
+
+var (
+	ErrCredentialNotFound       = errors.New("credential not found")
+	ErrRotationUnsupported      = errors.New("credential rotation not supported for service type")
+	ErrCredentialServiceUnknown = errors.New("credential was not issued by a known service")
+	ErrCredentialRevealed       = errors.New("credential has already been revealed")
+)
+
+// oneTimeRevealConfigured reports whether a service config sets one_time_reveal, delivering every
+// credential its service issues for one-time reveal
+func oneTimeRevealConfigured(config *models.ServiceConfig) bool {
+	oneTime, _ := strconv.ParseBool(config.Config["one_time_reveal"])
+	return oneTime
+}
+
+// GetLabCredentials returns a page of a lab's credentials, in the order they were issued, and how many
+// credentials the lab has
+func (s *Service) GetLabCredentials(labID string, offset, limit int) ([]models.Credential, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lab, exists := s.labs[labID]
+	if !exists {
+		return nil, 0, ErrLabNotFound
+	}
+
+	total := len(lab.Credentials)
+	start := min(offset, total)
+	end := min(start+limit, total)
+	page := credentialsWithExpiryWarnings(lab.Credentials[start:end], lab.EndsAt)
+	if page == nil {
+		page = []models.Credential{}
+	}
+	return page, total, nil
+}
+
+// RotateCredential regenerates a lab credential's secret on the backing system through the service
+// that issued it, and stores the new secret on the lab
+func (s *Service) RotateCredential(ctx context.Context, labID, credentialID string) (*models.Credential, error) {
+	s.mu.RLock()
+	lab, exists := s.labs[labID]
+	if !exists {
+		s.mu.RUnlock()
+		return nil, ErrLabNotFound
+	}
+	if lab.Status != models.LabStatusReady {
+		s.mu.RUnlock()
+		return nil, ErrLabNotReady
+	}
+	var credential *models.Credential
+	for i := range lab.Credentials {
+		if lab.Credentials[i].ID == credentialID {
+			credentialCopy := lab.Credentials[i]
+			credential = &credentialCopy
+			break
+		}
+	}
+	s.mu.RUnlock()
+
+	if credential == nil {
+		return nil, ErrCredentialNotFound
+	}
+
+	config, exists := s.serviceConfigManager.GetServiceConfig(credential.ServiceID)
+	if credential.ServiceID == "" || !exists {
+		return nil, ErrCredentialServiceUnknown
+	}
+	service, err := newServiceFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	rotator, ok := service.(interfaces.CredentialRotator)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRotationUnsupported, config.Type)
+	}
+
+	// The service talks to the backing system without holding the lock, recording any changes to its
+	// ServiceData on a private copy of the lab
+	labCopy := s.isolatedLabCopy(lab)
+	if err := rotator.RotateCredential(ctx, labCopy, credential); err != nil {
+		fmt.Printf("Failed to rotate credential %s of lab %s: %v\n", credentialID, labID, err)
+		return nil, err
+	}
+	credential.UpdatedAt = time.Now()
+	// A new secret can be revealed once again
+	credential.RevealedAt = nil
+	credential.RevealedBy = ""
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, value := range labCopy.ServiceData {
+		lab.ServiceData[key] = value
+	}
+	for i := range lab.Credentials {
+		if lab.Credentials[i].ID == credentialID {
+			lab.Credentials[i] = *credential
+			break
+		}
+	}
+	lab.UpdatedAt = credential.UpdatedAt
+
+	fmt.Printf("Rotated credential %s (%s) of lab %s\n", credentialID, credential.Label, labID)
+	return credential, nil
+}
+
+// RevealCredential returns a credential's secret. A one-time reveal credential is marked as revealed to
+// the user and recorded in the lab's timeline; revealing it again returns ErrCredentialRevealed.
+// Other credentials are returned as they are, since they can be read from the lab any time.
+func (s *Service) RevealCredential(labID, credentialID, userID string) (*models.RevealedCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lab, exists := s.labs[labID]
+	if !exists {
+		return nil, ErrLabNotFound
+	}
+	if lab.Status == models.LabStatusExpired || models.IsExpired(lab.EndsAt) {
+		return nil, ErrLabExpired
+	}
+
+	for i := range lab.Credentials {
+		credential := &lab.Credentials[i]
+		if credential.ID != credentialID {
+			continue
+		}
+
+		if credential.OneTimeReveal {
+			if credential.RevealedAt != nil {
+				return nil, fmt.Errorf("%w: revealed to user %s at %s", ErrCredentialRevealed, credential.RevealedBy, credential.RevealedAt.Format(time.RFC3339))
+			}
+			now := time.Now()
+			credential.RevealedAt = &now
+			credential.RevealedBy = userID
+			lab.UpdatedAt = now
+
+			s.timeline.record(lab.ID, lab.OwnerID, models.LabTimelineEvent{
+				Type:      models.LabTimelineCredentialRevealed,
+				Message:   fmt.Sprintf("Credential %s (%s) revealed", credential.ID, credential.Label),
+				Status:    lab.Status,
+				UserID:    userID,
+				Timestamp: now,
+			})
+			fmt.Printf("Revealed one-time credential %s (%s) of lab %s to user %s\n", credential.ID, credential.Label, labID, userID)
+		}
+
+		return &models.RevealedCredential{
+			ID:         credential.ID,
+			Label:      credential.Label,
+			Username:   credential.Username,
+			Password:   credential.Password,
+			PrivateKey: credential.PrivateKey,
+			URL:        credential.URL,
+			RevealedAt: credential.RevealedAt,
+			RevealedBy: credential.RevealedBy,
+		}, nil
+	}
+	return nil, ErrCredentialNotFound
+}
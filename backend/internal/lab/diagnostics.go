@@ -0,0 +1,70 @@
+package lab
+
+import (
+	"fmt"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// LabDiagnostics explains the state of a lab, in particular why it failed
+type LabDiagnostics struct {
+	LabID       string              `json:"lab_id"`
+	Status      models.LabStatus    `json:"status"`
+	CurrentStep string              `json:"current_step,omitempty"`
+	Failure     *models.LabFailure  `json:"failure,omitempty"`      // Set when provisioning failed
+	StepTimings []models.StepTiming `json:"step_timings,omitempty"` // How long each step took, once provisioning ended
+	Logs        []string            `json:"logs"`                   // Latest progress log lines
+}
+
+// recordFailure stores the failure reported by the progress tracker on the lab, so it is still
+// available after the progress logs rotate or are cleaned up. Only the first failure is kept; services
+// cancelled because of it report failures of their own.
+func (s *Service) recordFailure(labID string, failure models.LabFailure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lab, exists := s.labs[labID]
+	if !exists || lab.Failure != nil {
+		return
+	}
+
+	lab.Failure = &failure
+	s.recordLabTimelineEvent(lab, models.LabTimelineFailed, "", failure.Message)
+	lab.StepTimings = s.progressTracker.StepTimings(labID)
+	fmt.Printf("Lab %s: provisioning failed (service %q, step %q): %s\n", labID, failure.Service, failure.Step, failure.Message)
+}
+
+// GetLabDiagnostics returns the failure details of a lab together with the tail of its progress log.
+// The live log is used while progress is still tracked, otherwise the log captured at failure time.
+func (s *Service) GetLabDiagnostics(labID string) (*LabDiagnostics, error) {
+	s.mu.RLock()
+	lab, exists := s.labs[labID]
+	if !exists {
+		s.mu.RUnlock()
+		return nil, ErrLabNotFound
+	}
+	diagnostics := &LabDiagnostics{
+		LabID:       lab.ID,
+		Status:      lab.Status,
+		Failure:     lab.Failure,
+		StepTimings: lab.StepTimings,
+		Logs:        []string{},
+	}
+	if lab.Failure != nil {
+		diagnostics.Logs = lab.Failure.Logs
+	}
+	s.mu.RUnlock()
+
+	if progress := s.progressTracker.GetProgress(labID); progress != nil {
+		progress.mu.RLock()
+		diagnostics.CurrentStep = progress.CurrentStep
+		logs := progress.Logs
+		if len(logs) > FailureLogTail {
+			logs = logs[len(logs)-FailureLogTail:]
+		}
+		diagnostics.Logs = append([]string(nil), logs...)
+		progress.mu.RUnlock()
+	}
+
+	return diagnostics, nil
+}
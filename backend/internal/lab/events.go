@@ -0,0 +1,176 @@
+package lab
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// labEventBuffer is how many events a subscriber can fall behind before events are dropped for it
+const labEventBuffer = 64
+
+// LabEventType identifies what happened to a lab
+type LabEventType string
+
+const (
+	LabEventSnapshot      LabEventType = "snapshot"           // Current state of every lab, sent when a subscriber connects
+	LabEventCreated       LabEventType = "lab_created"        // A lab was created or scheduled
+	LabEventStatusChanged LabEventType = "lab_status_changed" // A lab moved to a new status
+	LabEventDeleted       LabEventType = "lab_deleted"        // A lab was removed
+	LabEventExpiring      LabEventType = "lab_expiring"       // A lab crossed an expiry warning threshold
+)
+
+// LabSummary is the lightweight view of a lab carried by lab events
+type LabSummary struct {
+	ID         string           `json:"id"`
+	Name       string           `json:"name"`
+	OwnerID    string           `json:"owner_id"`
+	TemplateID string           `json:"template_id,omitempty"`
+	Status     models.LabStatus `json:"status"`
+	StartedAt  time.Time        `json:"started_at"`
+	EndsAt     time.Time        `json:"ends_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+}
+
+// LabEvent describes a change to a lab, or the full set of labs for a snapshot
+type LabEvent struct {
+	Type           LabEventType     `json:"type"`
+	Lab            *LabSummary      `json:"lab,omitempty"`
+	PreviousStatus models.LabStatus `json:"previous_status,omitempty"`
+	ExpiresIn      int              `json:"expires_in,omitempty"` // Seconds until the lab ends, only set for lab_expiring
+	Labs           []LabSummary     `json:"labs,omitempty"`       // Only set for snapshots
+	Timestamp      time.Time        `json:"timestamp"`
+}
+
+// labEventBus fans lab events out to subscribers. Publishing never blocks: a subscriber that
+// stops reading misses events rather than stalling provisioning.
+type labEventBus struct {
+	subscribers map[chan LabEvent]struct{}
+	mu          sync.Mutex
+}
+
+// newLabEventBus creates an event bus with no subscribers
+func newLabEventBus() *labEventBus {
+	return &labEventBus{
+		subscribers: make(map[chan LabEvent]struct{}),
+	}
+}
+
+// publish sends an event to every subscriber that has room for it
+func (b *labEventBus) publish(event LabEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			fmt.Printf("Warning: dropping %s event for lab %s, subscriber is not keeping up\n", event.Type, event.Lab.ID)
+		}
+	}
+}
+
+// summarizeLab copies the fields of a lab that lab events carry. The caller must hold s.mu.
+func summarizeLab(lab *models.Lab) *LabSummary {
+	return &LabSummary{
+		ID:         lab.ID,
+		Name:       lab.Name,
+		OwnerID:    lab.OwnerID,
+		TemplateID: lab.TemplateID,
+		Status:     lab.Status,
+		StartedAt:  lab.StartedAt,
+		EndsAt:     lab.EndsAt,
+		UpdatedAt:  lab.UpdatedAt,
+	}
+}
+
+// SubscribeLabEvents returns a snapshot of every lab and a channel of the changes that follow it.
+// No event is lost or duplicated between the snapshot and the channel. Call the returned function
+// to unsubscribe once the caller stops reading.
+func (s *Service) SubscribeLabEvents() (LabEvent, <-chan LabEvent, func()) {
+	events := make(chan LabEvent, labEventBuffer)
+
+	// Lab changes are published while s.mu is held, so registering under the read lock
+	// lines the snapshot up exactly with the first event the subscriber receives
+	s.mu.RLock()
+	snapshot := LabEvent{
+		Type:      LabEventSnapshot,
+		Labs:      make([]LabSummary, 0, len(s.labs)),
+		Timestamp: time.Now(),
+	}
+	for _, lab := range s.labs {
+		snapshot.Labs = append(snapshot.Labs, *summarizeLab(lab))
+	}
+	s.events.mu.Lock()
+	s.events.subscribers[events] = struct{}{}
+	s.events.mu.Unlock()
+	s.mu.RUnlock()
+
+	sort.Slice(snapshot.Labs, func(i, j int) bool {
+		return snapshot.Labs[i].StartedAt.After(snapshot.Labs[j].StartedAt)
+	})
+
+	unsubscribe := func() {
+		s.events.mu.Lock()
+		delete(s.events.subscribers, events)
+		s.events.mu.Unlock()
+	}
+	return snapshot, events, unsubscribe
+}
+
+// setLabStatus moves a lab to a new status and publishes the transition. The caller must hold s.mu.
+func (s *Service) setLabStatus(lab *models.Lab, status models.LabStatus) {
+	previous := lab.Status
+	lab.Status = status
+	lab.UpdatedAt = time.Now()
+	lab.Version++
+
+	// Idle time counts from when a lab becomes ready, provisioning and stopped time don't count
+	if status == models.LabStatusReady && previous != status {
+		now := lab.UpdatedAt
+		lab.LastActivityAt = &now
+	}
+
+	if previous != status {
+		s.recordLabTimelineEvent(lab, models.LabTimelineStatusChanged, previous, "")
+		s.events.publish(LabEvent{
+			Type:           LabEventStatusChanged,
+			Lab:            summarizeLab(lab),
+			PreviousStatus: previous,
+			Timestamp:      lab.UpdatedAt,
+		})
+	}
+}
+
+// publishLabCreated announces a new lab. The caller must hold s.mu.
+func (s *Service) publishLabCreated(lab *models.Lab) {
+	s.recordLabTimelineEvent(lab, models.LabTimelineCreated, "", "")
+	s.events.publish(LabEvent{
+		Type:      LabEventCreated,
+		Lab:       summarizeLab(lab),
+		Timestamp: time.Now(),
+	})
+}
+
+// publishLabDeleted announces that a lab was removed. The caller must hold s.mu.
+func (s *Service) publishLabDeleted(lab *models.Lab) {
+	s.recordLabTimelineEvent(lab, models.LabTimelineDeleted, "", "")
+	s.events.publish(LabEvent{
+		Type:      LabEventDeleted,
+		Lab:       summarizeLab(lab),
+		Timestamp: time.Now(),
+	})
+}
+
+// publishLabExpiring warns that a lab ends soon. The caller must hold s.mu.
+func (s *Service) publishLabExpiring(lab *models.Lab, remaining time.Duration) {
+	s.events.publish(LabEvent{
+		Type:      LabEventExpiring,
+		Lab:       summarizeLab(lab),
+		ExpiresIn: int(remaining.Seconds()),
+		Timestamp: time.Now(),
+	})
+}
@@ -0,0 +1,137 @@
+package lab
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// DefaultExpiryWarningInterval is how often labs are checked for an upcoming expiry
+const DefaultExpiryWarningInterval = time.Minute
+
+// DefaultExpiryWarningThresholds are how long before a lab ends its owner is warned
+var DefaultExpiryWarningThresholds = []time.Duration{15 * time.Minute, 5 * time.Minute}
+
+// expiryWarningState records the warnings sent for a lab. Warnings are tied to the end time they were
+// sent for, so a lab whose end time moves is warned again.
+type expiryWarningState struct {
+	endsAt time.Time
+	sent   map[time.Duration]bool
+}
+
+// ParseExpiryWarningThresholds parses a comma separated list of durations such as "15m,5m". An empty
+// value disables expiry warnings.
+func ParseExpiryWarningThresholds(value string) ([]time.Duration, error) {
+	var thresholds []time.Duration
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		threshold, err := time.ParseDuration(entry)
+		if err != nil || threshold <= 0 {
+			return nil, fmt.Errorf("invalid expiry warning threshold %q", entry)
+		}
+		thresholds = append(thresholds, threshold)
+	}
+	return thresholds, nil
+}
+
+// StartExpiryWarnings starts a background task that warns lab owners at each threshold before their
+// lab ends, so they can save their work or extend the lab
+func (s *Service) StartExpiryWarnings(thresholds []time.Duration, interval time.Duration) {
+	if len(thresholds) == 0 {
+		fmt.Printf("Expiry warnings disabled\n")
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultExpiryWarningInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			s.SendExpiryWarnings(thresholds)
+		}
+	}()
+}
+
+// SendExpiryWarnings warns the owners of ready labs that have crossed a threshold since the last check.
+// A lab that crossed several thresholds at once, such as a lab shorter than the largest threshold, is
+// only warned once.
+func (s *Service) SendExpiryWarnings(thresholds []time.Duration) {
+	now := time.Now()
+
+	s.mu.Lock()
+	var notifications []*pendingNotification
+	for labID, lab := range s.labs {
+		remaining := lab.EndsAt.Sub(now)
+		if lab.Status != models.LabStatusReady || remaining <= 0 {
+			continue
+		}
+
+		state := s.expiryWarnings[labID]
+		if state == nil || !state.endsAt.Equal(lab.EndsAt) {
+			state = &expiryWarningState{endsAt: lab.EndsAt, sent: make(map[time.Duration]bool)}
+			s.expiryWarnings[labID] = state
+		}
+
+		crossed := false
+		for _, threshold := range thresholds {
+			if remaining <= threshold && !state.sent[threshold] {
+				state.sent[threshold] = true
+				crossed = true
+			}
+		}
+		if !crossed {
+			continue
+		}
+
+		fmt.Printf("Lab %s ends in %v, warning owner %s\n", labID, remaining.Round(time.Second), lab.OwnerID)
+		s.progressTracker.AddLog(labID, fmt.Sprintf("Lab ends in %v", remaining.Round(time.Minute)))
+		s.publishLabExpiring(lab, remaining)
+		if notification := s.pendingExpiryNotification(lab, remaining); notification != nil {
+			notifications = append(notifications, notification)
+		}
+	}
+
+	// Forget labs that were removed
+	for labID := range s.expiryWarnings {
+		if _, exists := s.labs[labID]; !exists {
+			delete(s.expiryWarnings, labID)
+		}
+	}
+	s.mu.Unlock()
+
+	// Deliver outside the lock, a slow webhook or mail server mustn't hold up other labs
+	for _, notification := range notifications {
+		go s.notifier.deliver(notification)
+	}
+}
+
+// pendingExpiryNotification captures the expiry warning for a lab, or returns nil when the owner
+// didn't ask to be notified. The caller must hold s.mu.
+func (s *Service) pendingExpiryNotification(lab *models.Lab, remaining time.Duration) *pendingNotification {
+	if s.notifier == nil || !lab.Notify.Enabled() {
+		return nil
+	}
+
+	return &pendingNotification{
+		settings: *lab.Notify,
+		ownerID:  lab.OwnerID,
+		payload: LabNotificationPayload{
+			Event:            "lab_expiring",
+			LabID:            lab.ID,
+			LabName:          lab.Name,
+			Status:           lab.Status,
+			URL:              s.notifier.labURL(lab.ID),
+			CredentialsCount: len(lab.Credentials),
+			ExpiresInMinutes: int(remaining.Round(time.Minute) / time.Minute),
+			EndsAt:           lab.EndsAt,
+			Timestamp:        time.Now(),
+		},
+	}
+}
@@ -0,0 +1,198 @@
+package lab
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// Health status values
+const (
+	HealthStatusHealthy   = "healthy"
+	HealthStatusDegraded  = "degraded"
+	HealthStatusUnhealthy = "unhealthy"
+)
+
+// HealthCheckTimeout bounds how long a single dependency probe may take
+const HealthCheckTimeout = 3 * time.Second
+
+// HealthCacheTTL is how long a health report is served before dependencies are probed again, so
+// frequent or anonymous health checks don't each send requests to every backing system
+const HealthCacheTTL = 15 * time.Second
+
+// DependencyHealth represents the health of a single backing service
+type DependencyHealth struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Endpoint  string `json:"endpoint"`
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// HealthReport represents the overall health of the backend and its dependencies
+type HealthReport struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyHealth `json:"dependencies"`
+	CheckedAt    time.Time                   `json:"checked_at"`
+}
+
+// HealthSummary is the health report shown to unauthenticated callers: the status of each dependency by
+// service config ID, without names, endpoints or errors
+type HealthSummary struct {
+	Status       string            `json:"status"`
+	Dependencies map[string]string `json:"dependencies"`
+	CheckedAt    time.Time         `json:"checked_at"`
+}
+
+// Summary returns the report with only the status of each dependency
+func (r *HealthReport) Summary() *HealthSummary {
+	summary := &HealthSummary{
+		Status:       r.Status,
+		Dependencies: make(map[string]string, len(r.Dependencies)),
+		CheckedAt:    r.CheckedAt,
+	}
+	for id, dependency := range r.Dependencies {
+		summary.Dependencies[id] = dependency.Status
+	}
+	return summary
+}
+
+// serviceEndpointKeys maps service types to the config key holding their endpoint
+var serviceEndpointKeys = map[string]string{
+	"palette_project": "host",
+	"palette_tenant":  "palette_host",
+	"proxmox_user":    "uri",
+	"terraform_cloud": "host",
+	"guacamole":       "host",
+	"vault":           "address",
+}
+
+// healthProber issues dependency probes. Its clients are shared across health checks so connections
+// are reused instead of leaking a new transport per probe.
+type healthProber struct {
+	client         *http.Client
+	insecureClient *http.Client // For service configs with skip_tls_verify
+
+	mu   sync.Mutex    // Held while probing, so concurrent health checks share one round of probes
+	last *HealthReport // Latest report, served until it is older than HealthCacheTTL
+}
+
+// newHealthProber creates a prober with one client that verifies TLS and one that doesn't
+func newHealthProber() *healthProber {
+	return &healthProber{
+		client: &http.Client{Transport: &http.Transport{}},
+		insecureClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+	}
+}
+
+// CheckHealth probes the endpoints of all active service configurations. Reports are cached for
+// HealthCacheTTL and shared between callers, which must not modify them.
+func (s *Service) CheckHealth(ctx context.Context) *HealthReport {
+	prober := s.healthProber
+	prober.mu.Lock()
+	defer prober.mu.Unlock()
+
+	if prober.last != nil && time.Since(prober.last.CheckedAt) < HealthCacheTTL {
+		return prober.last
+	}
+
+	// The report is shared, so a caller going away doesn't cut the probes short for everyone else
+	ctx = context.WithoutCancel(ctx)
+	report := &HealthReport{
+		Status:       HealthStatusHealthy,
+		Dependencies: make(map[string]DependencyHealth),
+		CheckedAt:    time.Now(),
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, config := range s.serviceConfigManager.GetActiveServiceConfigs() {
+		key, ok := serviceEndpointKeys[config.Type]
+		if !ok {
+			continue
+		}
+		endpoint := config.Config[key]
+		if endpoint == "" {
+			continue
+		}
+
+		wg.Add(1)
+		go func(config *models.ServiceConfig, endpoint string) {
+			defer wg.Done()
+			dependency := prober.probeEndpoint(ctx, config, endpoint)
+			mu.Lock()
+			report.Dependencies[config.ID] = dependency
+			mu.Unlock()
+		}(config, endpoint)
+	}
+	wg.Wait()
+
+	unhealthy := 0
+	for _, dependency := range report.Dependencies {
+		if dependency.Status != HealthStatusHealthy {
+			unhealthy++
+		}
+	}
+	if unhealthy > 0 {
+		report.Status = HealthStatusDegraded
+		if unhealthy == len(report.Dependencies) {
+			report.Status = HealthStatusUnhealthy
+		}
+	}
+
+	prober.last = report
+	return report
+}
+
+// probeEndpoint issues a short request against a service endpoint to verify it is reachable
+func (p *healthProber) probeEndpoint(ctx context.Context, config *models.ServiceConfig, endpoint string) DependencyHealth {
+	dependency := DependencyHealth{
+		Name:     config.Name,
+		Type:     config.Type,
+		Endpoint: endpoint,
+		Status:   HealthStatusHealthy,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, HealthCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		dependency.Status = HealthStatusUnhealthy
+		dependency.Error = fmt.Sprintf("invalid endpoint: %v", err)
+		return dependency
+	}
+
+	client := p.client
+	if config.Config["skip_tls_verify"] == "true" {
+		client = p.insecureClient
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	dependency.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		dependency.Status = HealthStatusUnhealthy
+		dependency.Error = err.Error()
+		return dependency
+	}
+	defer resp.Body.Close()
+
+	// Any response below 500 means the service is up and answering requests
+	if resp.StatusCode >= http.StatusInternalServerError {
+		dependency.Status = HealthStatusUnhealthy
+		dependency.Error = fmt.Sprintf("unexpected status: %s", resp.Status)
+	}
+
+	return dependency
+}
@@ -0,0 +1,97 @@
+package lab
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// SetIdleTimeout sets how long a ready lab may go without activity before it expires, even if its
+// duration hasn't run out. With 0, labs only expire when their duration ends.
+func (s *Service) SetIdleTimeout(idleTimeout time.Duration) {
+	if idleTimeout < 0 {
+		idleTimeout = 0
+	}
+	s.idleTimeout = idleTimeout
+}
+
+// idleExpiresAt returns when a ready lab expires if it isn't used again, or nil when idle expiry is
+// disabled, the lab isn't ready or its duration ends first
+func (s *Service) idleExpiresAt(lab *models.Lab) *time.Time {
+	if s.idleTimeout <= 0 || lab.Status != models.LabStatusReady || lab.LastActivityAt == nil {
+		return nil
+	}
+	expiresAt := lab.LastActivityAt.Add(s.idleTimeout)
+	if !expiresAt.Before(lab.EndsAt) {
+		return nil
+	}
+	return &expiresAt
+}
+
+// RecordLabActivity notes that someone used a lab, such as by fetching its credentials or progress or
+// through the UI's heartbeat, which restarts its idle timer. Only ready labs record activity.
+func (s *Service) RecordLabActivity(labID string) (*models.LabActivity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lab, exists := s.labs[labID]
+	if !exists {
+		return nil, ErrLabNotFound
+	}
+
+	if lab.Status == models.LabStatusReady && !models.IsExpired(lab.EndsAt) {
+		now := time.Now()
+		lab.LastActivityAt = &now
+	}
+
+	return s.labActivity(lab), nil
+}
+
+// GetLabActivity returns when a lab was last used and when it expires if it stays idle
+func (s *Service) GetLabActivity(labID string) (*models.LabActivity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lab, exists := s.labs[labID]
+	if !exists {
+		return nil, ErrLabNotFound
+	}
+	return s.labActivity(lab), nil
+}
+
+// labActivity reports a lab's activity. The caller must hold s.mu.
+func (s *Service) labActivity(lab *models.Lab) *models.LabActivity {
+	return &models.LabActivity{
+		LastActivityAt: lab.LastActivityAt,
+		IdleExpiresAt:  s.idleExpiresAt(lab),
+		EndsAt:         lab.EndsAt,
+	}
+}
+
+// ExpireIdleLabs ends the ready labs that have gone unused for longer than the idle timeout, so the
+// cleanup scheduler removes them like labs whose duration has run out
+func (s *Service) ExpireIdleLabs() {
+	if s.idleTimeout <= 0 {
+		return
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	var idle []string
+	for _, lab := range s.labs {
+		expiresAt := s.idleExpiresAt(lab)
+		if expiresAt == nil || now.Before(*expiresAt) {
+			continue
+		}
+		lab.EndsAt = now
+		s.setLabStatus(lab, models.LabStatusExpired)
+		idle = append(idle, lab.ID)
+	}
+	s.mu.Unlock()
+
+	for _, labID := range idle {
+		fmt.Printf("ExpireIdleLabs: Lab %s expired after %v without activity\n", labID, s.idleTimeout)
+		s.progressTracker.AddLog(labID, fmt.Sprintf("Lab expired after %v without activity", s.idleTimeout))
+	}
+}
@@ -0,0 +1,116 @@
+package lab
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// redactedValue replaces secret values in resource inventories
+const redactedValue = "[REDACTED]"
+
+// ServiceResourceInventory lists what a single service provisioned for a lab
+type ServiceResourceInventory struct {
+	ServiceID            string            `json:"service_id"`
+	ServiceName          string            `json:"service_name"`
+	ServiceType          string            `json:"service_type"`
+	Resources            map[string]string `json:"resources"`             // Recorded in ServiceData during setup, secrets redacted
+	ConstructedResources map[string]string `json:"constructed_resources"` // Names derived from the lab ID by naming convention
+}
+
+// LabResourceInventory lists everything a lab owns, grouped by service
+type LabResourceInventory struct {
+	LabID        string                     `json:"lab_id"`
+	LabName      string                     `json:"lab_name"`
+	Status       models.LabStatus           `json:"status"`
+	Services     []ServiceResourceInventory `json:"services"`
+	Unattributed map[string]string          `json:"unattributed,omitempty"` // ServiceData keys that match no used service
+}
+
+// GetLabResourceInventory returns the resources a lab provisioned, grouped by service type
+func (s *Service) GetLabResourceInventory(labID string) (*LabResourceInventory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lab, exists := s.labs[labID]
+	if !exists {
+		return nil, ErrLabNotFound
+	}
+
+	inventory := &LabResourceInventory{
+		LabID:    lab.ID,
+		LabName:  lab.Name,
+		Status:   lab.Status,
+		Services: make([]ServiceResourceInventory, 0, len(lab.UsedServices)),
+	}
+
+	attributed := make(map[string]bool)
+	for _, serviceID := range lab.UsedServices {
+		serviceInventory := ServiceResourceInventory{
+			ServiceID: serviceID,
+			Resources: make(map[string]string),
+		}
+
+		if config, exists := s.serviceConfigManager.ResolveServiceConfig(serviceID, lab.OrganizationID); exists {
+			serviceInventory.ServiceName = config.Name
+			serviceInventory.ServiceType = config.Type
+
+			if service, ok := s.serviceManager.GetServiceByType(config.Type); ok {
+				prefixes := service.ServiceDataKeys()
+				serviceInventory.ConstructedResources = make(map[string]string)
+				for key, value := range service.DescribeResources(lab.ID) {
+					name, _ := trimServiceDataPrefix(key, prefixes)
+					serviceInventory.ConstructedResources[name] = value
+				}
+				for key, value := range lab.ServiceData {
+					name, ok := trimServiceDataPrefix(key, prefixes)
+					if !ok {
+						continue
+					}
+					serviceInventory.Resources[name] = redactServiceDataValue(key, value)
+					attributed[key] = true
+				}
+			}
+		}
+
+		inventory.Services = append(inventory.Services, serviceInventory)
+	}
+
+	sort.Slice(inventory.Services, func(i, j int) bool {
+		if inventory.Services[i].ServiceType != inventory.Services[j].ServiceType {
+			return inventory.Services[i].ServiceType < inventory.Services[j].ServiceType
+		}
+		return inventory.Services[i].ServiceID < inventory.Services[j].ServiceID
+	})
+
+	for key, value := range lab.ServiceData {
+		if attributed[key] {
+			continue
+		}
+		if inventory.Unattributed == nil {
+			inventory.Unattributed = make(map[string]string)
+		}
+		inventory.Unattributed[key] = redactServiceDataValue(key, value)
+	}
+
+	return inventory, nil
+}
+
+// trimServiceDataPrefix strips the first matching service prefix from a ServiceData key
+func trimServiceDataPrefix(key string, prefixes []string) (string, bool) {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return strings.TrimPrefix(key, prefix), true
+		}
+	}
+	return key, false
+}
+
+// redactServiceDataValue hides the value of secret ServiceData keys
+func redactServiceDataValue(key, value string) string {
+	if value != "" && isSensitiveServiceDataKey(key) {
+		return redactedValue
+	}
+	return value
+}
@@ -0,0 +1,30 @@
+package lab
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// SetMaxLabLifetime caps how long any lab may run from its start to its end, whether it was created
+// directly or from a template with its own durations. With 0, only the duration limits apply.
+func (s *Service) SetMaxLabLifetime(maxLifetime time.Duration) {
+	if maxLifetime < 0 {
+		maxLifetime = 0
+	}
+	s.maxLabLifetime = maxLifetime
+}
+
+// checkLabLifetime returns an error naming the cap when a lab running for lifetime would exceed it.
+// Anything that lengthens a lab must check its new lifetime, from its start to its new end, here.
+func (s *Service) checkLabLifetime(lifetime time.Duration) error {
+	if s.maxLabLifetime <= 0 || lifetime <= s.maxLabLifetime {
+		return nil
+	}
+	maxMinutes := int(s.maxLabLifetime / time.Minute)
+	return models.NewAPIError(models.CodeLabLifetimeExceeded,
+		fmt.Sprintf("labs can run for at most %d minutes, %d minutes were requested", maxMinutes, int(lifetime/time.Minute)),
+		ErrLabLifetimeExceeded).
+		WithDetail("max_lifetime_minutes", maxMinutes)
+}
@@ -2,10 +2,13 @@ package lab
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
 	"time"
 
-	"github.com/wcrum/labby/internal/interfaces"
 	"github.com/wcrum/labby/internal/models"
 )
 
@@ -46,6 +49,43 @@ func (s *Service) GetLabsByOwner(ownerID string) ([]*models.Lab, error) {
 	return labs, nil
 }
 
+// QueryLabsByOwner returns an owner's labs whose status is one of statuses, newest first. With no
+// statuses, expired labs are left out so long-finished labs don't crowd the list.
+func (s *Service) QueryLabsByOwner(ownerID string, statuses []models.LabStatus) []*models.Lab {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[models.LabStatus]bool, len(statuses))
+	for _, status := range statuses {
+		wanted[status] = true
+	}
+
+	labs := make([]*models.Lab, 0)
+	for _, lab := range s.labs {
+		if lab.OwnerID != ownerID {
+			continue
+		}
+
+		// Labs past their end time count as expired even before the cleanup scheduler gets to them
+		status := lab.Status
+		if models.IsExpired(lab.EndsAt) {
+			status = models.LabStatusExpired
+		}
+		if len(wanted) == 0 && status == models.LabStatusExpired {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[status] {
+			continue
+		}
+		labs = append(labs, lab)
+	}
+
+	sort.Slice(labs, func(i, j int) bool {
+		return labs[i].StartedAt.After(labs[j].StartedAt)
+	})
+	return labs
+}
+
 // GetAllLabs retrieves all labs (for admin purposes)
 func (s *Service) GetAllLabs() []*models.Lab {
 	s.mu.RLock()
@@ -63,25 +103,24 @@ func (s *Service) GetAllLabs() []*models.Lab {
 	return labs
 }
 
-// DeleteLab deletes a lab
+// DeleteLab deletes a lab. Service cleanup runs without holding the lab lock so bulk deletes can run concurrently.
+// A lab that is still provisioning has its provisioning cancelled first so cleanup sees every resource it created.
+// It returns ErrCleanupInProgress, leaving the lab in place, when another cleanup of the lab is running.
 func (s *Service) DeleteLab(labID string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
+	s.mu.RLock()
 	lab, exists := s.labs[labID]
+	s.mu.RUnlock()
 	if !exists {
 		return ErrLabNotFound
 	}
 
-	// Create cleanup context
-	cleanupCtx := &interfaces.CleanupContext{
-		LabID:   labID,
-		Context: context.Background(),
-		Lab:     lab,
-	}
+	s.cancelProvisioning(labID)
 
 	// Cleanup lab services
-	if err := s.serviceManager.CleanupLabServices(cleanupCtx); err != nil {
+	if err := s.runCleanup(s.newCleanupContext(context.Background(), lab, false)); err != nil {
+		if errors.Is(err, ErrCleanupInProgress) {
+			return err
+		}
 		// Log error but continue with lab deletion
 		fmt.Printf("Warning: Failed to cleanup lab services for lab %s: %v\n", labID, err)
 	}
@@ -90,35 +129,76 @@ func (s *Service) DeleteLab(labID string) error {
 	s.progressTracker.CleanupProgress(labID)
 
 	// Remove the lab
+	s.mu.Lock()
 	delete(s.labs, labID)
+	delete(s.shares, labID)
+	s.publishLabDeleted(lab)
+	s.mu.Unlock()
 
 	return nil
 }
 
-// StopLab stops a lab (marks it as expired)
+// DefaultStopGracePeriod is how long a stopped lab keeps its resources and can be resumed
+const DefaultStopGracePeriod = time.Hour
+
+// SetStopGracePeriod sets how long stopped labs keep their resources before the cleanup scheduler
+// removes them. With 0, stopping a lab cleans it up right away.
+func (s *Service) SetStopGracePeriod(gracePeriod time.Duration) {
+	if gracePeriod < 0 {
+		gracePeriod = 0
+	}
+	s.stopGracePeriod = gracePeriod
+}
+
+// StopLab stops a lab. A ready lab keeps its resources for the stop grace period, or until it would
+// have ended if that is sooner, and can be resumed until then; the cleanup scheduler removes it
+// afterwards like an expired lab. Other labs are marked as expired and cleaned up right away, without
+// holding the lab lock. A lab that is still provisioning has its provisioning cancelled first.
 func (s *Service) StopLab(labID string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.mu.RLock()
+	_, exists := s.labs[labID]
+	s.mu.RUnlock()
+	if !exists {
+		return ErrLabNotFound
+	}
+
+	s.cancelProvisioning(labID)
 
+	s.mu.Lock()
 	lab, exists := s.labs[labID]
 	if !exists {
+		s.mu.Unlock()
 		return ErrLabNotFound
 	}
 
-	// Set lab status to expired
-	lab.Status = models.LabStatusExpired
-	lab.EndsAt = time.Now()
-	lab.UpdatedAt = time.Now()
+	if lab.Status == models.LabStatusStopped {
+		s.mu.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	if lab.Status == models.LabStatusReady && s.stopGracePeriod > 0 && now.Before(lab.EndsAt) {
+		resumeEndsAt := lab.EndsAt
+		lab.StoppedAt = &now
+		lab.ResumeEndsAt = &resumeEndsAt
+		if graceEnd := now.Add(s.stopGracePeriod); graceEnd.Before(lab.EndsAt) {
+			lab.EndsAt = graceEnd
+		}
+		s.setLabStatus(lab, models.LabStatusStopped)
+		retainedUntil := lab.EndsAt
+		s.mu.Unlock()
 
-	// Perform cleanup of lab services
-	cleanupCtx := &interfaces.CleanupContext{
-		LabID:   labID,
-		Context: context.Background(),
-		Lab:     lab,
+		s.progressTracker.AddLog(labID, fmt.Sprintf("Lab stopped, its resources are kept until %s", retainedUntil.Format(time.RFC3339)))
+		return nil
 	}
 
+	// Set lab status to expired
+	lab.EndsAt = now
+	s.setLabStatus(lab, models.LabStatusExpired)
+	s.mu.Unlock()
+
 	// Execute cleanup (don't fail the stop operation if cleanup fails)
-	if err := s.serviceManager.CleanupLabServices(cleanupCtx); err != nil {
+	if err := s.runCleanup(s.newCleanupContext(context.Background(), lab, false)); err != nil {
 		// Log the cleanup error but don't fail the stop operation
 		fmt.Printf("StopLab: Cleanup failed for lab %s: %v\n", labID, err)
 	}
@@ -126,74 +206,166 @@ func (s *Service) StopLab(labID string) error {
 	return nil
 }
 
-// CleanupExpiredLabs removes expired labs (should be called periodically)
-func (s *Service) CleanupExpiredLabs() {
+// ResumeLab makes a stopped lab ready again with the end time it had before it was stopped. Labs
+// whose grace period has run out, or whose cleanup has started, can no longer be resumed.
+func (s *Service) ResumeLab(labID string) (*models.Lab, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	now := time.Now()
-	for labID, lab := range s.labs {
-		if now.After(lab.EndsAt) {
-			// Create cleanup context for expired lab
-			cleanupCtx := &interfaces.CleanupContext{
-				LabID:   labID,
-				Context: context.Background(),
-				Lab:     lab,
-			}
+	lab, exists := s.labs[labID]
+	if !exists {
+		return nil, ErrLabNotFound
+	}
+	if lab.Status != models.LabStatusStopped {
+		return nil, ErrLabNotStopped
+	}
+	if _, cleaning := s.cleaning[labID]; cleaning {
+		return nil, ErrCleanupInProgress
+	}
+	if models.IsExpired(lab.EndsAt) {
+		return nil, ErrLabExpired
+	}
 
-			// Cleanup lab services before removing from memory
-			if err := s.serviceManager.CleanupLabServices(cleanupCtx); err != nil {
-				fmt.Printf("Warning: Failed to cleanup expired lab services for lab %s: %v\n", labID, err)
-			}
+	if lab.ResumeEndsAt != nil {
+		lab.EndsAt = *lab.ResumeEndsAt
+	}
+	lab.StoppedAt = nil
+	lab.ResumeEndsAt = nil
+	s.setLabStatus(lab, models.LabStatusReady)
+	s.progressTracker.AddLog(labID, "Lab resumed")
+
+	return lab, nil
+}
+
+// CleanupSchedulerConfig controls how often and how aggressively labs are cleaned up
+type CleanupSchedulerConfig struct {
+	Interval   time.Duration // Time between cleanup runs
+	Jitter     time.Duration // Random delay added to each run so restarts don't align cleanup spikes
+	BatchSize  int           // Number of labs cleaned up concurrently
+	BatchDelay time.Duration // Pause between batches to avoid overwhelming backing services
+}
+
+// DefaultCleanupSchedulerConfig returns the default cleanup scheduler configuration
+func DefaultCleanupSchedulerConfig() CleanupSchedulerConfig {
+	return CleanupSchedulerConfig{
+		Interval:   5 * time.Minute,
+		Jitter:     30 * time.Second,
+		BatchSize:  5,
+		BatchDelay: 2 * time.Second,
+	}
+}
 
-			// Cleanup progress tracking
-			s.progressTracker.CleanupProgress(labID)
+// CleanupExpiredLabs cleans up services for expired labs and removes them (should be called periodically)
+func (s *Service) CleanupExpiredLabs() {
+	now := time.Now()
 
-			// Remove the lab from memory
-			delete(s.labs, labID)
+	s.mu.RLock()
+	var expired []*models.Lab
+	for _, lab := range s.labs {
+		if now.After(lab.EndsAt) {
+			expired = append(expired, lab)
 		}
 	}
+	s.mu.RUnlock()
+
+	if len(expired) > 0 {
+		fmt.Printf("CleanupExpiredLabs: Found %d expired labs\n", len(expired))
+		s.cleanupLabsInBatches(expired, "expired")
+	}
 }
 
 // CleanupFailedLabs removes labs that have been in error status for too long
 func (s *Service) CleanupFailedLabs() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	now := time.Now()
 	// Clean up labs that have been in error status for more than 1 hour
 	errorThreshold := time.Hour
 
-	for labID, lab := range s.labs {
-		if lab.Status == models.LabStatusError {
-			timeSinceError := now.Sub(lab.UpdatedAt)
-			if timeSinceError > errorThreshold {
-				// Create cleanup context for failed lab
-				cleanupCtx := &interfaces.CleanupContext{
-					LabID:   labID,
-					Context: context.Background(),
-					Lab:     lab,
-				}
+	s.mu.RLock()
+	var failed []*models.Lab
+	for _, lab := range s.labs {
+		if lab.Status == models.LabStatusError && now.Sub(lab.UpdatedAt) > errorThreshold {
+			failed = append(failed, lab)
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(failed) > 0 {
+		fmt.Printf("CleanupFailedLabs: Found %d failed labs\n", len(failed))
+		s.cleanupLabsInBatches(failed, "failed")
+	}
+}
 
-				// Cleanup lab services before removing from memory
-				if err := s.serviceManager.CleanupLabServices(cleanupCtx); err != nil {
-					fmt.Printf("Warning: Failed to cleanup failed lab services for lab %s: %v\n", labID, err)
+// cleanupLabsInBatches runs service cleanup for the given labs in batches and removes the labs whose
+// cleanup succeeded from memory. Labs with failed cleanups stay until a later run cleans them up.
+// Service cleanup runs without holding the lab lock so slow backing services don't block the API.
+func (s *Service) cleanupLabsInBatches(labs []*models.Lab, reason string) {
+	batchSize := s.cleanupConfig.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	for start := 0; start < len(labs); start += batchSize {
+		end := start + batchSize
+		if end > len(labs) {
+			end = len(labs)
+		}
+
+		var wg sync.WaitGroup
+		for _, lab := range labs[start:end] {
+			wg.Add(1)
+			go func(lab *models.Lab) {
+				defer wg.Done()
+
+				s.cancelProvisioning(lab.ID)
+
+				// Cleanup lab services before removing from memory. A lab already being cleaned up
+				// elsewhere is left for the next run.
+				if err := s.runCleanup(s.newCleanupContext(context.Background(), lab, false)); err != nil {
+					if errors.Is(err, ErrCleanupInProgress) {
+						return
+					}
+					// Keep the lab so its remaining resources aren't orphaned; the next run retries
+					// only the services whose cleanup failed
+					fmt.Printf("Warning: Failed to cleanup %s lab services for lab %s, keeping it for the next run: %v\n", reason, lab.ID, err)
+					s.progressTracker.AddLog(lab.ID, fmt.Sprintf("Cleanup incomplete, will retry: %v", err))
+					return
 				}
 
 				// Cleanup progress tracking
-				s.progressTracker.CleanupProgress(labID)
-				// Remove the lab
-				delete(s.labs, labID)
-			}
+				s.progressTracker.CleanupProgress(lab.ID)
+
+				// Remove the lab from memory
+				s.mu.Lock()
+				delete(s.labs, lab.ID)
+				delete(s.shares, lab.ID)
+				s.publishLabDeleted(lab)
+				s.mu.Unlock()
+			}(lab)
+		}
+		wg.Wait()
+
+		if end < len(labs) && s.cleanupConfig.BatchDelay > 0 {
+			time.Sleep(s.cleanupConfig.BatchDelay)
 		}
 	}
 }
 
-// StartCleanupScheduler starts a background task to clean up expired labs
-func (s *Service) StartCleanupScheduler() {
-	ticker := time.NewTicker(5 * time.Minute)
+// StartCleanupScheduler starts a background task to expire idle labs and clean up expired and failed labs
+func (s *Service) StartCleanupScheduler(config CleanupSchedulerConfig) {
+	if config.Interval <= 0 {
+		config.Interval = DefaultCleanupSchedulerConfig().Interval
+	}
+	s.cleanupConfig = config
+
 	go func() {
-		for range ticker.C {
+		for {
+			delay := config.Interval
+			if config.Jitter > 0 {
+				delay += time.Duration(rand.Int63n(int64(config.Jitter)))
+			}
+			time.Sleep(delay)
+
+			s.ExpireIdleLabs()
 			s.CleanupExpiredLabs()
 			s.CleanupFailedLabs()
 		}
@@ -0,0 +1,58 @@
+package lab
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// MaxLabNameLength is the longest custom lab name accepted
+const MaxLabNameLength = 64
+
+var (
+	ErrInvalidLabName = errors.New("invalid lab name")
+	ErrLabNameTaken   = errors.New("lab name already in use")
+)
+
+// labNamePattern matches the names accepted after whitespace is normalized. Lab names are passed to
+// services as ${lab_name}, so they are kept to characters every backing service accepts in resource
+// names and descriptions, and can't break out of the Terraform or JSON strings they are placed in.
+var labNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 ._-]*$`)
+
+// defaultLabName names a template lab after its template, with the lab ID to tell labs apart
+func defaultLabName(templateName, labID string) string {
+	return fmt.Sprintf("%s-%s", templateName, labID)
+}
+
+// normalizeLabName trims a requested lab name, collapses runs of whitespace into single spaces and
+// checks its length and characters. An empty result means the default name should be used.
+func normalizeLabName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if len(name) > MaxLabNameLength {
+		return "", fmt.Errorf("%w: must be at most %d characters", ErrInvalidLabName, MaxLabNameLength)
+	}
+	if name != "" && !labNamePattern.MatchString(name) {
+		return "", fmt.Errorf("%w: %q must start with a letter or digit and may only use letters, digits, spaces and . _ -", ErrInvalidLabName, name)
+	}
+	return name, nil
+}
+
+// checkLabNameAvailable reports ErrLabNameTaken when one of the owner's active labs already uses
+// the name. Expired labs don't count, so names can be reused once a lab ends. The caller must hold s.mu.
+func (s *Service) checkLabNameAvailable(ownerID, name string) error {
+	now := time.Now()
+	for _, lab := range s.labs {
+		if lab.OwnerID != ownerID || !strings.EqualFold(lab.Name, name) {
+			continue
+		}
+		if lab.Status == models.LabStatusExpired || now.After(lab.EndsAt) {
+			continue
+		}
+		return fmt.Errorf("%w: you already have an active lab named %q", ErrLabNameTaken, lab.Name)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package lab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+	"github.com/wcrum/labby/internal/services"
+)
+
+// notificationTimeout bounds how long a webhook delivery may take
+const notificationTimeout = 10 * time.Second
+
+// ErrInvalidNotification is returned when a lab's notification settings can't be used
+var ErrInvalidNotification = errors.New("invalid notification settings")
+
+// LabNotificationPayload is the JSON body posted to notification webhooks
+type LabNotificationPayload struct {
+	Event            string           `json:"event"` // lab_ready, lab_failed or lab_expiring
+	LabID            string           `json:"lab_id"`
+	LabName          string           `json:"lab_name"`
+	Status           models.LabStatus `json:"status"`
+	URL              string           `json:"url,omitempty"`
+	CredentialsCount int              `json:"credentials_count"`
+	Failure          string           `json:"failure,omitempty"`
+	ExpiresInMinutes int              `json:"expires_in_minutes,omitempty"` // Only set for lab_expiring
+	EndsAt           time.Time        `json:"ends_at"`
+	Timestamp        time.Time        `json:"timestamp"`
+}
+
+// pendingNotification is a notification captured under the lab lock and delivered after it is released
+type pendingNotification struct {
+	settings models.LabNotification
+	ownerID  string
+	payload  LabNotificationPayload
+}
+
+// Notifier tells lab owners when their lab is ready or has failed, by email and/or webhook
+type Notifier struct {
+	email       *services.EmailService // nil when email is not configured
+	frontendURL string
+	ownerEmail  func(userID string) (string, error)
+	client      *http.Client
+}
+
+// NewNotifier creates a notifier. email may be nil to disable email notifications; frontendURL is used
+// to link to the lab and ownerEmail looks up the address of a lab's owner.
+func NewNotifier(email *services.EmailService, frontendURL string, ownerEmail func(userID string) (string, error)) *Notifier {
+	return &Notifier{
+		email:       email,
+		frontendURL: strings.TrimSuffix(frontendURL, "/"),
+		ownerEmail:  ownerEmail,
+		client:      newWebhookClient(),
+	}
+}
+
+// newWebhookClient returns an HTTP client that only connects to public addresses. The check runs on
+// every connection, including redirects, so a webhook host can't be re-pointed at an internal address
+// after it was validated.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: notificationTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("webhook address %s is not a public address", host)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: notificationTimeout,
+		Transport: &http.Transport{
+			// No proxy: it would make the connection on our behalf and bypass the address check
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: notificationTimeout,
+		},
+	}
+}
+
+// carrierGradeNAT is the shared address space (RFC 6598), internal to providers and never a valid webhook target
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP reports whether an address is routable on the internet. Loopback, private, link-local
+// (which includes the 169.254.169.254 cloud metadata endpoint) and other special ranges are not.
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified() &&
+		!carrierGradeNAT.Contains(ip)
+}
+
+// SetNotifier sets the notifier used for lab ready and failure notifications
+func (s *Service) SetNotifier(notifier *Notifier) {
+	s.notifier = notifier
+}
+
+// validateNotification checks the notification settings supplied when creating a lab. Webhooks must
+// resolve to public addresses so lab owners can't make the server call internal endpoints.
+func validateNotification(settings *models.LabNotification) error {
+	if settings == nil || settings.WebhookURL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(settings.WebhookURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%w: webhook_url must be an http or https URL", ErrInvalidNotification)
+	}
+
+	// Reject internal targets up front; delivery checks the address again in case DNS changes
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, parsed.Hostname())
+	if err != nil || len(addresses) == 0 {
+		return fmt.Errorf("%w: webhook_url host %s could not be resolved", ErrInvalidNotification, parsed.Hostname())
+	}
+	for _, address := range addresses {
+		if !isPublicIP(address.IP) {
+			return fmt.Errorf("%w: webhook_url must point to a public address", ErrInvalidNotification)
+		}
+	}
+	return nil
+}
+
+// pendingLabNotification captures the notification for a lab's current status, or returns nil when the
+// owner didn't ask to be notified. The caller must hold s.mu.
+func (s *Service) pendingLabNotification(lab *models.Lab) *pendingNotification {
+	if s.notifier == nil || !lab.Notify.Enabled() {
+		return nil
+	}
+
+	payload := LabNotificationPayload{
+		Event:            "lab_ready",
+		LabID:            lab.ID,
+		LabName:          lab.Name,
+		Status:           lab.Status,
+		URL:              s.notifier.labURL(lab.ID),
+		CredentialsCount: len(lab.Credentials),
+		EndsAt:           lab.EndsAt,
+		Timestamp:        time.Now(),
+	}
+	if lab.Status == models.LabStatusError {
+		payload.Event = "lab_failed"
+		if lab.Failure != nil {
+			payload.Failure = lab.Failure.Message
+		}
+	}
+
+	return &pendingNotification{
+		settings: *lab.Notify,
+		ownerID:  lab.OwnerID,
+		payload:  payload,
+	}
+}
+
+// labURL links to a lab in the frontend
+func (n *Notifier) labURL(labID string) string {
+	if n.frontendURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/lab?id=%s", n.frontendURL, url.QueryEscape(labID))
+}
+
+// deliver sends a notification on every channel the owner selected. Failures are logged and
+// never affect the lab.
+func (n *Notifier) deliver(notification *pendingNotification) {
+	payload := notification.payload
+
+	if notification.settings.WebhookURL != "" {
+		if err := n.postWebhook(notification.settings.WebhookURL, payload); err != nil {
+			fmt.Printf("Warning: Failed to deliver %s webhook for lab %s: %v\n", payload.Event, payload.LabID, err)
+		} else {
+			fmt.Printf("Delivered %s webhook for lab %s\n", payload.Event, payload.LabID)
+		}
+	}
+
+	if notification.settings.Email {
+		if err := n.sendEmail(notification.ownerID, payload); err != nil {
+			fmt.Printf("Warning: Failed to email %s notification for lab %s: %v\n", payload.Event, payload.LabID, err)
+		} else {
+			fmt.Printf("Emailed %s notification for lab %s\n", payload.Event, payload.LabID)
+		}
+	}
+}
+
+// postWebhook posts the notification payload as JSON
+func (n *Notifier) postWebhook(webhookURL string, payload LabNotificationPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	resp, err := n.client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendEmail emails the notification to the lab owner
+func (n *Notifier) sendEmail(ownerID string, payload LabNotificationPayload) error {
+	if n.email == nil {
+		return errors.New("email is not configured")
+	}
+
+	address, err := n.ownerEmail(ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to look up owner email: %w", err)
+	}
+
+	var subject string
+	var body strings.Builder
+	switch payload.Event {
+	case "lab_failed":
+		subject = fmt.Sprintf("Your lab %s failed to start", payload.LabName)
+		fmt.Fprintf(&body, "Your lab %s could not be set up.\n", payload.LabName)
+		if payload.Failure != "" {
+			fmt.Fprintf(&body, "\nReason: %s\n", payload.Failure)
+		}
+	case "lab_expiring":
+		subject = fmt.Sprintf("Your lab %s ends in %d minutes", payload.LabName, payload.ExpiresInMinutes)
+		fmt.Fprintf(&body, "Your lab %s ends at %s and will then be removed.\n", payload.LabName, payload.EndsAt.Format(time.RFC1123))
+		fmt.Fprintf(&body, "\nSave your work before then.\n")
+	default:
+		subject = fmt.Sprintf("Your lab %s is ready", payload.LabName)
+		fmt.Fprintf(&body, "Your lab %s is ready with %d credentials.\n", payload.LabName, payload.CredentialsCount)
+		fmt.Fprintf(&body, "\nIt is available until %s.\n", payload.EndsAt.Format(time.RFC1123))
+	}
+	if payload.URL != "" {
+		fmt.Fprintf(&body, "\nOpen the lab: %s\n", payload.URL)
+	}
+
+	return n.email.Send(address, subject, body.String())
+}
@@ -0,0 +1,38 @@
+package lab
+
+import (
+	"fmt"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// SetOrganizationResolver sets how the organization of a lab owner is looked up. Labs created from
+// templates record their owner's organization and use its service config overrides for their lifetime.
+func (s *Service) SetOrganizationResolver(resolve func(userID string) (string, error)) {
+	s.organizationResolver = resolve
+}
+
+// ownerOrganization returns the organization of a lab owner, or "" when the owner belongs to none
+func (s *Service) ownerOrganization(ownerID string) (string, error) {
+	if s.organizationResolver == nil {
+		return "", nil
+	}
+	organizationID, err := s.organizationResolver(ownerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up organization of user %s: %w", ownerID, err)
+	}
+	return organizationID, nil
+}
+
+// labServiceConfig returns the service config a lab uses for a template service ID: its organization's
+// override if there is one, otherwise the global config. The caller must not hold s.mu.
+func (s *Service) labServiceConfig(labID, serviceID string) (*models.ServiceConfig, bool) {
+	s.mu.RLock()
+	var organizationID string
+	if lab, exists := s.labs[labID]; exists {
+		organizationID = lab.OrganizationID
+	}
+	s.mu.RUnlock()
+
+	return s.serviceConfigManager.ResolveServiceConfig(serviceID, organizationID)
+}
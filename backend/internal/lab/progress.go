@@ -1,8 +1,13 @@
 package lab
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/wcrum/labby/internal/models"
 )
 
 // Constants for progress tracking
@@ -10,6 +15,7 @@ const (
 	MinLabDurationMinutes = 15
 	MaxLabDurationMinutes = 480
 	MaxLogEntries         = 50
+	FailureLogTail        = 20 // Log lines kept with a lab's failure record
 	ProgressComplete      = 100
 )
 
@@ -20,6 +26,7 @@ type ProgressStep struct {
 	Message     string    `json:"message"`
 	StartedAt   time.Time `json:"started_at,omitempty"`
 	CompletedAt time.Time `json:"completed_at,omitempty"`
+	DurationMs  int64     `json:"duration_ms,omitempty"` // Set once the step has finished
 	Error       string    `json:"error,omitempty"`
 }
 
@@ -32,24 +39,48 @@ type ServiceProgress struct {
 	Steps       []ProgressStep `json:"steps"`
 	StartedAt   time.Time      `json:"started_at,omitempty"`
 	CompletedAt time.Time      `json:"completed_at,omitempty"`
+	DurationMs  int64          `json:"duration_ms,omitempty"` // Set once the service has finished
 	Error       string         `json:"error,omitempty"`
 }
 
 // LabProgress tracks the progress of lab creation
 type LabProgress struct {
-	LabID       string            `json:"lab_id"`
-	Overall     int               `json:"overall"` // 0-100
-	CurrentStep string            `json:"current_step"`
-	Services    []ServiceProgress `json:"services"`
-	Logs        []string          `json:"logs"`
-	UpdatedAt   time.Time         `json:"updated_at"`
-	mu          sync.RWMutex
+	LabID         string            `json:"lab_id"`
+	Overall       int               `json:"overall"` // 0-100
+	CurrentStep   string            `json:"current_step"`
+	QueuePosition int               `json:"queue_position,omitempty"` // 1-based place in the provisioning queue, 0 once started
+	Services      []ServiceProgress `json:"services"`
+	Logs          []string          `json:"logs"`
+	TimingSummary string            `json:"timing_summary,omitempty"` // Total time and slowest steps, set when provisioning ends
+	UpdatedAt     time.Time         `json:"updated_at"`
+	mu            sync.RWMutex
+}
+
+// slowestStepsInSummary is how many of the slowest steps the timing summary names
+const slowestStepsInSummary = 3
+
+// finish records when a step ended and how long it ran
+func (step *ProgressStep) finish(now time.Time) {
+	step.CompletedAt = now
+	if !step.StartedAt.IsZero() {
+		step.DurationMs = now.Sub(step.StartedAt).Milliseconds()
+	}
+}
+
+// finish records when a service ended and how long it ran
+func (service *ServiceProgress) finish(now time.Time) {
+	service.CompletedAt = now
+	if !service.StartedAt.IsZero() {
+		service.DurationMs = now.Sub(service.StartedAt).Milliseconds()
+	}
 }
 
 // ProgressTracker manages progress for all labs
 type ProgressTracker struct {
-	progress map[string]*LabProgress
-	mu       sync.RWMutex
+	progress  map[string]*LabProgress
+	mu        sync.RWMutex
+	onFailure func(labID string, failure models.LabFailure) // Called after FailProgress, without tracker locks held
+	onLog     func(labID, message string)                   // Called for every log entry, with the tracker lock held
 }
 
 // NewProgressTracker creates a new progress tracker
@@ -143,7 +174,7 @@ func (pt *ProgressTracker) UpdateServiceStep(labID, serviceName, stepName, statu
 					if status == "running" && step.StartedAt.IsZero() {
 						progress.Services[i].Steps[j].StartedAt = time.Now()
 					} else if status == "completed" || status == "failed" {
-						progress.Services[i].Steps[j].CompletedAt = time.Now()
+						progress.Services[i].Steps[j].finish(time.Now())
 					}
 
 					break
@@ -156,10 +187,11 @@ func (pt *ProgressTracker) UpdateServiceStep(labID, serviceName, stepName, statu
 				progress.Services[i].StartedAt = time.Now()
 			} else if status == "completed" {
 				progress.Services[i].Status = "completed"
-				progress.Services[i].CompletedAt = time.Now()
+				progress.Services[i].finish(time.Now())
 			} else if status == "failed" {
 				progress.Services[i].Status = "failed"
 				progress.Services[i].Error = message
+				progress.Services[i].finish(time.Now())
 			}
 
 			// Calculate service progress
@@ -194,11 +226,69 @@ func (pt *ProgressTracker) UpdateServiceStep(labID, serviceName, stepName, statu
 	}
 }
 
+// CompleteService marks every step of a service as completed, for services that don't need to run again
+func (pt *ProgressTracker) CompleteService(labID, serviceName, message string) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	progress, exists := pt.progress[labID]
+	if !exists {
+		return
+	}
+
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+
+	now := time.Now()
+	for i, service := range progress.Services {
+		if service.Name != serviceName {
+			continue
+		}
+		for j := range service.Steps {
+			progress.Services[i].Steps[j].Status = "completed"
+			progress.Services[i].Steps[j].Message = message
+			progress.Services[i].Steps[j].finish(now)
+		}
+		progress.Services[i].Status = "completed"
+		progress.Services[i].Progress = ProgressComplete
+		progress.Services[i].finish(now)
+		break
+	}
+	progress.UpdatedAt = now
+}
+
+// SetQueuePosition records a lab's place in the provisioning queue; 0 means it is no longer queued
+func (pt *ProgressTracker) SetQueuePosition(labID string, position int) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	progress, exists := pt.progress[labID]
+	if !exists {
+		return
+	}
+
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+
+	progress.QueuePosition = position
+	if position > 0 {
+		progress.CurrentStep = fmt.Sprintf("Queued (position %d)", position)
+	} else if strings.HasPrefix(progress.CurrentStep, "Queued") {
+		progress.CurrentStep = "Initializing"
+	}
+	progress.UpdatedAt = time.Now()
+}
+
 // AddLog adds a log message to the progress
 func (pt *ProgressTracker) AddLog(labID, message string) {
 	pt.mu.Lock()
 	defer pt.mu.Unlock()
 
+	// Entries are handed on even without tracked progress, e.g. expiry warnings after provisioning
+	if pt.onLog != nil {
+		pt.onLog(labID, message)
+	}
+
 	progress, exists := pt.progress[labID]
 	if !exists {
 		return
@@ -232,18 +322,20 @@ func (pt *ProgressTracker) CompleteProgress(labID string) {
 	progress.mu.Lock()
 	defer progress.mu.Unlock()
 
+	now := time.Now()
+
 	// Mark all pending services as completed
 	for i, service := range progress.Services {
 		if service.Status == "pending" || service.Status == "running" {
 			progress.Services[i].Status = "completed"
-			progress.Services[i].CompletedAt = time.Now()
+			progress.Services[i].finish(now)
 
 			// Mark all pending steps as completed
 			for j, step := range service.Steps {
 				if step.Status == "pending" || step.Status == "running" {
 					progress.Services[i].Steps[j].Status = "completed"
 					progress.Services[i].Steps[j].Message = "Lab setup completed successfully"
-					progress.Services[i].Steps[j].CompletedAt = time.Now()
+					progress.Services[i].Steps[j].finish(now)
 				}
 			}
 
@@ -255,41 +347,177 @@ func (pt *ProgressTracker) CompleteProgress(labID string) {
 	// Update overall progress to 100%
 	progress.Overall = ProgressComplete
 	progress.CurrentStep = "Lab setup completed successfully"
-	progress.UpdatedAt = time.Now()
+	progress.recordTimingSummary(now)
+	progress.UpdatedAt = now
+}
+
+// SetFailureHandler registers a function that receives the failure details whenever a lab's progress fails
+func (pt *ProgressTracker) SetFailureHandler(handler func(labID string, failure models.LabFailure)) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.onFailure = handler
 }
 
-// FailProgress marks the progress as failed
+// SetLogHandler registers a function that receives every log entry, such as to keep it after the
+// progress is gone. It runs with the tracker lock held, so it must not call back into the tracker.
+func (pt *ProgressTracker) SetLogHandler(handler func(labID, message string)) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.onLog = handler
+}
+
+// FailProgress marks the progress as failed and reports the failing service and step to the failure handler
 func (pt *ProgressTracker) FailProgress(labID, error string) {
+	failure, handler := pt.failProgress(labID, error)
+	if handler != nil {
+		handler(labID, failure)
+	}
+}
+
+// failProgress marks the progress as failed and returns the failure details
+func (pt *ProgressTracker) failProgress(labID, error string) (models.LabFailure, func(string, models.LabFailure)) {
 	pt.mu.Lock()
 	defer pt.mu.Unlock()
 
+	failure := models.LabFailure{
+		Message:  error,
+		FailedAt: time.Now(),
+	}
+
 	progress, exists := pt.progress[labID]
 	if !exists {
-		return
+		return failure, pt.onFailure
 	}
 
 	progress.mu.Lock()
 	defer progress.mu.Unlock()
 
+	failure.Service, failure.Step = progress.failingStep()
+	failure.Logs = append([]string(nil), progress.Logs...)
+	if len(failure.Logs) > FailureLogTail {
+		failure.Logs = failure.Logs[len(failure.Logs)-FailureLogTail:]
+	}
+
 	// Mark all pending services as failed
+	now := time.Now()
 	for i, service := range progress.Services {
 		if service.Status == "pending" || service.Status == "running" {
 			progress.Services[i].Status = "failed"
 			progress.Services[i].Error = error
+			progress.Services[i].finish(now)
 
 			// Mark all pending steps as failed
 			for j, step := range service.Steps {
 				if step.Status == "pending" || step.Status == "running" {
 					progress.Services[i].Steps[j].Status = "failed"
 					progress.Services[i].Steps[j].Message = "Lab setup failed: " + error
-					progress.Services[i].Steps[j].CompletedAt = time.Now()
+					progress.Services[i].Steps[j].finish(now)
 				}
 			}
 		}
 	}
 
 	progress.CurrentStep = "Lab setup failed: " + error
-	progress.UpdatedAt = time.Now()
+	progress.recordTimingSummary(now)
+	progress.UpdatedAt = now
+
+	return failure, pt.onFailure
+}
+
+// failingStep finds the service and step that failed, preferring a step a service explicitly marked
+// as failed and falling back to the one that was still running. The caller must hold progress.mu.
+func (progress *LabProgress) failingStep() (string, string) {
+	for _, service := range progress.Services {
+		for _, step := range service.Steps {
+			if step.Status == "failed" {
+				return service.Name, step.Name
+			}
+		}
+	}
+
+	for _, service := range progress.Services {
+		if service.Status != "running" {
+			continue
+		}
+		for _, step := range service.Steps {
+			if step.Status == "running" {
+				return service.Name, step.Name
+			}
+		}
+		return service.Name, ""
+	}
+
+	return "", ""
+}
+
+// StepTimings returns how long each step of a lab's provisioning took, for steps that have started
+func (pt *ProgressTracker) StepTimings(labID string) []models.StepTiming {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+
+	progress, exists := pt.progress[labID]
+	if !exists {
+		return nil
+	}
+
+	progress.mu.RLock()
+	defer progress.mu.RUnlock()
+	return progress.stepTimings()
+}
+
+// stepTimings lists the steps that have started in provisioning order. The caller must hold progress.mu.
+func (progress *LabProgress) stepTimings() []models.StepTiming {
+	var timings []models.StepTiming
+	for _, service := range progress.Services {
+		for _, step := range service.Steps {
+			if step.StartedAt.IsZero() {
+				continue
+			}
+			timings = append(timings, models.StepTiming{
+				Service:     service.Name,
+				Step:        step.Name,
+				Status:      step.Status,
+				StartedAt:   step.StartedAt,
+				CompletedAt: step.CompletedAt,
+				DurationMs:  step.DurationMs,
+			})
+		}
+	}
+	return timings
+}
+
+// recordTimingSummary summarizes how long provisioning took and which steps were slowest, and adds
+// the summary to the log. The caller must hold progress.mu.
+func (progress *LabProgress) recordTimingSummary(now time.Time) {
+	timings := progress.stepTimings()
+	if len(timings) == 0 {
+		return
+	}
+
+	startedAt := timings[0].StartedAt
+	for _, timing := range timings {
+		if timing.StartedAt.Before(startedAt) {
+			startedAt = timing.StartedAt
+		}
+	}
+
+	sort.SliceStable(timings, func(i, j int) bool {
+		return timings[i].DurationMs > timings[j].DurationMs
+	})
+	if len(timings) > slowestStepsInSummary {
+		timings = timings[:slowestStepsInSummary]
+	}
+
+	slowest := make([]string, len(timings))
+	for i, timing := range timings {
+		slowest[i] = fmt.Sprintf("%s / %s %v", timing.Service, timing.Step, (time.Duration(timing.DurationMs) * time.Millisecond).Round(time.Second))
+	}
+
+	progress.TimingSummary = fmt.Sprintf("Provisioning took %v, slowest steps: %s", now.Sub(startedAt).Round(time.Second), strings.Join(slowest, ", "))
+	progress.Logs = append(progress.Logs, "["+now.Format("15:04:05")+"] "+progress.TimingSummary)
+	if len(progress.Logs) > MaxLogEntries {
+		progress.Logs = progress.Logs[len(progress.Logs)-MaxLogEntries:]
+	}
 }
 
 // CleanupProgress removes progress data for a lab
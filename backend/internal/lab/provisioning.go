@@ -1,22 +1,35 @@
 package lab
 
 import (
+	"context"
 	"fmt"
-	"time"
+	"strings"
+	"sync"
 
 	"github.com/wcrum/labby/internal/models"
 )
 
-// provisionLabFromTemplate handles lab provisioning from a template
-func (s *Service) provisionLabFromTemplate(labID, templateID string) {
+// DefaultProvisioningConcurrency is the number of a lab's services provisioned at the same time
+const DefaultProvisioningConcurrency = 3
+
+// SetProvisioningConcurrency sets how many services of a lab may be provisioned at the same time
+func (s *Service) SetProvisioningConcurrency(concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	s.provisioningConcurrency = concurrency
+}
+
+// provisionLabFromTemplate handles lab provisioning from a template. Cancelling ctx stops
+// provisioning between services and aborts the in-flight service setup.
+func (s *Service) provisionLabFromTemplate(ctx context.Context, labID, templateID string) {
 	template, exists := s.templateManager.GetTemplate(templateID)
 	if !exists {
 		s.progressTracker.FailProgress(labID, "Template not found")
 		// Set lab status to error
 		s.mu.Lock()
 		if lab, exists := s.labs[labID]; exists {
-			lab.Status = models.LabStatusError
-			lab.UpdatedAt = time.Now()
+			s.setLabStatus(lab, models.LabStatusError)
 		}
 		s.mu.Unlock()
 		return
@@ -27,11 +40,15 @@ func (s *Service) provisionLabFromTemplate(labID, templateID string) {
 	// Add services to progress tracker based on template
 	for _, serviceRef := range template.Services {
 		// Get the service configuration
-		serviceConfig, exists := s.serviceConfigManager.GetServiceConfig(serviceRef.ServiceID)
+		serviceConfig, exists := s.labServiceConfig(labID, serviceRef.ServiceID)
 		if !exists {
 			s.progressTracker.AddLog(labID, fmt.Sprintf("Service configuration not found: %s", serviceRef.ServiceID))
 			continue
 		}
+		// Services of inactive configs are skipped, provisionTemplateServices logs why
+		if !serviceConfig.IsActive {
+			continue
+		}
 
 		var steps []string
 		switch serviceConfig.Type {
@@ -40,15 +57,21 @@ func (s *Service) provisionLabFromTemplate(labID, templateID string) {
 				"Creating Project",
 				"Setting up User Account",
 				"Configuring Access Permissions",
-				"Generating API Keys",
-				"Creating Edge Tokens",
 			}
+			if serviceConfig.Config["cluster_profiles"] != "" || serviceConfig.Config["cluster_profile_uids"] != "" {
+				steps = append(steps, "Importing Cluster Profiles")
+			}
+			steps = append(steps, "Generating API Keys", "Creating Edge Tokens")
 		case "proxmox_user":
 			steps = []string{
 				"Connecting to Proxmox",
 				"Creating User Account",
-				"Setting Password",
+				"Creating Resource Pool",
 			}
+			if serviceConfig.Config["template_vmid"] != "" {
+				steps = append(steps, "Cloning Virtual Machines")
+			}
+			steps = append(steps, "Setting Password")
 		case "palette_tenant":
 			steps = []string{
 				"Connecting to Palette",
@@ -66,52 +89,67 @@ func (s *Service) provisionLabFromTemplate(labID, templateID string) {
 			steps = []string{
 				"Connecting to Guacamole",
 				"Creating User Account",
+				"Creating Connections",
+			}
+		case "vault":
+			steps = []string{
+				"Authenticating to Vault",
+				"Issuing Secret",
+			}
+		case "azure":
+			steps = []string{
+				"Authenticating to Azure",
+				"Creating Resource Group",
+			}
+			if serviceConfig.Config["create_service_principal"] != "false" {
+				steps = append(steps, "Creating Service Principal")
+			}
+			steps = append(steps, "Assigning Role")
+		case "gcp":
+			steps = []string{
+				"Authenticating to GCP",
+				"Creating Project",
+				"Enabling APIs",
+				"Granting Access",
+			}
+		case "ssh_command":
+			steps = []string{
+				"Connecting to Host",
+				"Running Commands",
+			}
+		case "http":
+			steps = []string{"Calling Setup Endpoint"}
+			if serviceConfig.Config["status_url"] != "" {
+				steps = append(steps, "Waiting for Resource")
+			}
+			steps = append(steps, "Adding Credentials")
+		case "docker":
+			steps = []string{
+				"Connecting to Docker",
+				"Pulling Image",
+				"Creating Container",
+				"Starting Container",
 			}
 		default:
 			steps = []string{"Initializing"}
 		}
+		if s.readinessProbeFor(serviceConfig) != nil {
+			steps = append(steps, readinessStep)
+		}
 
 		s.progressTracker.AddService(labID, serviceConfig.Name, serviceRef.Description, steps)
 	}
 
-	// Provision each service defined in the template
-	hasFailures := false
-	for _, serviceRef := range template.Services {
-		// Get the service configuration
-		serviceConfig, exists := s.serviceConfigManager.GetServiceConfig(serviceRef.ServiceID)
-		if !exists {
-			s.progressTracker.AddLog(labID, fmt.Sprintf("Service configuration not found: %s", serviceRef.ServiceID))
-			continue
-		}
-
-		s.progressTracker.AddLog(labID, fmt.Sprintf("Setting up service: %s (%s)", serviceRef.Name, serviceConfig.Type))
+	// A retried lab first removes what its failed services left behind
+	s.cleanupFailedServices(ctx, labID)
 
-		switch serviceConfig.Type {
-		case "palette_project":
-			s.provisionPaletteService(labID, serviceConfig)
-		case "proxmox_user":
-			s.provisionProxmoxUserService(labID, serviceConfig)
-		case "palette_tenant":
-			s.provisionPaletteTenantService(labID, serviceConfig)
-		case "terraform_cloud":
-			s.provisionTerraformCloudService(labID, serviceConfig)
-		case "guacamole":
-			s.provisionGuacamoleService(labID, serviceConfig)
-		default:
-			s.progressTracker.AddLog(labID, fmt.Sprintf("Unknown service type: %s", serviceConfig.Type))
-		}
-
-		// Check if the lab status is now error (indicating a failure)
-		s.mu.RLock()
-		if lab, exists := s.labs[labID]; exists && lab.Status == models.LabStatusError {
-			hasFailures = true
-		}
-		s.mu.RUnlock()
+	// Provision the template's services, running independent ones concurrently
+	hasFailures := s.provisionTemplateServices(ctx, labID, template)
 
-		// If we have failures, stop provisioning
-		if hasFailures {
-			break
-		}
+	// The lab is being stopped or deleted; leave its status to the caller that cancelled provisioning
+	if ctx.Err() != nil {
+		s.progressTracker.AddLog(labID, "Provisioning cancelled")
+		return
 	}
 
 	s.mu.Lock()
@@ -124,17 +162,267 @@ func (s *Service) provisionLabFromTemplate(labID, templateID string) {
 
 	// Only set status to ready if no failures occurred
 	if !hasFailures {
-		lab.Status = models.LabStatusReady
-		lab.UpdatedAt = time.Now()
+		s.setLabStatus(lab, models.LabStatusReady)
 		s.progressTracker.CompleteProgress(labID)
+		lab.StepTimings = s.progressTracker.StepTimings(labID)
 		s.progressTracker.AddLog(labID, "Lab setup completed successfully!")
 	} else {
 		// Ensure lab status is set to error if not already set
 		if lab.Status != models.LabStatusError {
-			lab.Status = models.LabStatusError
-			lab.UpdatedAt = time.Now()
+			s.setLabStatus(lab, models.LabStatusError)
 		}
 		s.progressTracker.AddLog(labID, "Lab setup failed due to service errors")
 	}
+	notification := s.pendingLabNotification(lab)
 	s.mu.Unlock()
+
+	// Notify the owner outside the lock, a slow webhook or mail server mustn't hold up other labs
+	if notification != nil {
+		go s.notifier.deliver(notification)
+	}
+}
+
+// serviceRun tracks one template service while the template's services are provisioned
+type serviceRun struct {
+	ref     models.ServiceReference
+	done    chan struct{} // Closed once the service has finished or been skipped
+	err     error         // Set before done is closed
+	skipped bool          // Set before done is closed when the service's config is inactive, or one it depends on was skipped
+}
+
+// provisionTemplateServices provisions a template's services, running services without pending
+// dependencies concurrently up to the provisioning concurrency limit. A service starts only after every
+// service it depends_on has completed. When a service fails, the remaining services are cancelled
+// and services depending on it are skipped. Services completed by an earlier attempt are not run again.
+// Services whose config has been deactivated are skipped with a note on the lab, along with the services
+// depending on them, and removed from the lab's used services. It reports whether any service failed.
+func (s *Service) provisionTemplateServices(ctx context.Context, labID string, template *models.LabTemplate) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	runs := make([]*serviceRun, len(template.Services))
+	runsByName := make(map[string]*serviceRun, len(template.Services))
+	for i, serviceRef := range template.Services {
+		runs[i] = &serviceRun{ref: serviceRef, done: make(chan struct{})}
+		if _, exists := runsByName[serviceRef.Name]; !exists {
+			runsByName[serviceRef.Name] = runs[i]
+		}
+	}
+
+	// Services merge their ServiceData into the lab as they finish, so the map must exist before any of them start
+	s.mu.Lock()
+	if lab, exists := s.labs[labID]; exists && lab.ServiceData == nil {
+		lab.ServiceData = make(map[string]string)
+	}
+	s.mu.Unlock()
+
+	concurrency := s.provisioningConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		wg.Add(1)
+		go func(run *serviceRun) {
+			defer wg.Done()
+			defer close(run.done)
+
+			// Services completed by an earlier attempt of a retried lab keep their resources
+			if s.serviceProvisioned(labID, run.ref.ServiceID) {
+				s.progressTracker.AddLog(labID, fmt.Sprintf("Service %s already provisioned, reusing its resources", run.ref.Name))
+				if serviceConfig, exists := s.labServiceConfig(labID, run.ref.ServiceID); exists {
+					s.progressTracker.CompleteService(labID, serviceConfig.Name, "Provisioned by an earlier attempt")
+				}
+				return
+			}
+
+			if serviceConfig, exists := s.labServiceConfig(labID, run.ref.ServiceID); exists && !serviceConfig.IsActive {
+				run.skipped = true
+				s.progressTracker.AddLog(labID, fmt.Sprintf("Skipping service %s: service config %s is inactive", run.ref.Name, serviceConfig.ID))
+				return
+			}
+
+			for _, dependency := range run.ref.DependsOn {
+				dependencyRun, exists := runsByName[dependency]
+				if !exists {
+					continue
+				}
+				<-dependencyRun.done
+				if dependencyRun.skipped {
+					run.skipped = true
+					s.progressTracker.AddLog(labID, fmt.Sprintf("Skipping service %s: dependency %s was skipped", run.ref.Name, dependency))
+					return
+				}
+				if dependencyRun.err != nil {
+					run.err = fmt.Errorf("dependency %s did not complete", dependency)
+					s.progressTracker.AddLog(labID, fmt.Sprintf("Skipping service %s: dependency %s did not complete", run.ref.Name, dependency))
+					return
+				}
+			}
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				run.err = ctx.Err()
+				return
+			}
+			if ctx.Err() != nil {
+				run.err = ctx.Err()
+				return
+			}
+
+			run.err = s.provisionTemplateService(ctx, labID, run.ref)
+			s.recordProvisioning(labID, run.ref, run.err)
+			if run.err != nil {
+				// Stop the other services; the lab has failed
+				cancel()
+			}
+		}(run)
+	}
+	wg.Wait()
+
+	var skipped []string
+	for _, run := range runs {
+		if run.skipped {
+			skipped = append(skipped, run.ref.ServiceID)
+		}
+	}
+	s.removeUsedServices(labID, skipped)
+
+	for _, run := range runs {
+		if run.err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// removeUsedServices drops services that were skipped from a lab's used services, so they aren't cleaned
+// up, counted against their limits or costed for the lab
+func (s *Service) removeUsedServices(labID string, serviceIDs []string) {
+	if len(serviceIDs) == 0 {
+		return
+	}
+
+	remove := make(map[string]bool, len(serviceIDs))
+	for _, serviceID := range serviceIDs {
+		remove[serviceID] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lab, exists := s.labs[labID]
+	if !exists {
+		return
+	}
+	usedServices := make([]string, 0, len(lab.UsedServices))
+	for _, serviceID := range lab.UsedServices {
+		if !remove[serviceID] {
+			usedServices = append(usedServices, serviceID)
+		}
+	}
+	lab.UsedServices = usedServices
+	lab.Version++
+}
+
+// provisionTemplateService provisions a single service of a template, resolving its settings from the
+// referenced service config, or the lab organization's override of it. A service config that no longer exists
+// or has an unsupported type fails the service.
+func (s *Service) provisionTemplateService(ctx context.Context, labID string, serviceRef models.ServiceReference) error {
+	// Get the service configuration
+	serviceConfig, exists := s.labServiceConfig(labID, serviceRef.ServiceID)
+	if !exists {
+		message := fmt.Sprintf("Service configuration not found: %s", serviceRef.ServiceID)
+		s.progressTracker.AddLog(labID, message)
+		s.progressTracker.FailProgress(labID, message)
+		return fmt.Errorf("service %s references unknown service config %s", serviceRef.Name, serviceRef.ServiceID)
+	}
+
+	s.progressTracker.AddLog(labID, fmt.Sprintf("Setting up service: %s (%s)", serviceRef.Name, serviceConfig.Type))
+	if serviceConfig.ID != serviceRef.ServiceID {
+		s.progressTracker.AddLog(labID, fmt.Sprintf("Using service config %s of organization %s", serviceConfig.ID, serviceConfig.OrganizationID))
+	}
+
+	// Substitute template variables supplied at lab creation into the service config
+	s.mu.RLock()
+	if lab, exists := s.labs[labID]; exists && len(lab.Variables) > 0 {
+		serviceConfig = applyTemplateVariables(serviceConfig, lab.Variables)
+	}
+	s.mu.RUnlock()
+
+	// Fetch secrets the config refers to, such as vault:secret/palette#api_key, only now so they aren't stored inline
+	serviceConfig, err := resolveServiceConfigSecrets(serviceConfig)
+	if err != nil {
+		message := fmt.Sprintf("Failed to resolve secrets of service %s: %v", serviceRef.Name, err)
+		s.progressTracker.AddLog(labID, message)
+		s.progressTracker.FailProgress(labID, message)
+		return fmt.Errorf("service %s: %w", serviceRef.Name, err)
+	}
+
+	switch serviceConfig.Type {
+	case "palette_project":
+		err = s.provisionPaletteService(ctx, labID, serviceConfig)
+	case "proxmox_user":
+		err = s.provisionProxmoxUserService(ctx, labID, serviceConfig)
+	case "palette_tenant":
+		err = s.provisionPaletteTenantService(ctx, labID, serviceConfig)
+	case "terraform_cloud":
+		err = s.provisionTerraformCloudService(ctx, labID, serviceConfig)
+	case "guacamole":
+		err = s.provisionGuacamoleService(ctx, labID, serviceConfig)
+	case "vault":
+		err = s.provisionVaultService(ctx, labID, serviceConfig)
+	case "azure":
+		err = s.provisionAzureService(ctx, labID, serviceConfig)
+	case "gcp":
+		err = s.provisionGCPService(ctx, labID, serviceConfig)
+	case "ssh_command":
+		err = s.provisionSSHCommandService(ctx, labID, serviceConfig)
+	case "http":
+		err = s.provisionHTTPService(ctx, labID, serviceConfig)
+	case "docker":
+		err = s.provisionDockerService(ctx, labID, serviceConfig)
+	default:
+		// Failing beats reporting a lab as ready when one of its services was never set up
+		message := fmt.Sprintf("Service %s has unsupported service type %q", serviceRef.Name, serviceConfig.Type)
+		s.progressTracker.AddLog(labID, message)
+		s.progressTracker.FailProgress(labID, message)
+		return fmt.Errorf("service %s (config %s) has unsupported service type %q", serviceRef.Name, serviceConfig.ID, serviceConfig.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Setup returning doesn't mean users can connect yet, endpoints may still be starting
+	if err := s.waitForServiceReady(ctx, labID, serviceConfig); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		s.progressTracker.FailProgress(labID, fmt.Sprintf("%s readiness check failed: %v", serviceConfig.Name, err))
+
+		s.mu.Lock()
+		if lab, exists := s.labs[labID]; exists {
+			s.setLabStatus(lab, models.LabStatusError)
+		}
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// applyTemplateVariables returns a copy of the service config with ${name} placeholders replaced by variable values
+func applyTemplateVariables(serviceConfig *models.ServiceConfig, variables map[string]string) *models.ServiceConfig {
+	configCopy := *serviceConfig
+	configCopy.Config = make(map[string]string, len(serviceConfig.Config))
+	for key, value := range serviceConfig.Config {
+		for name, variableValue := range variables {
+			value = strings.ReplaceAll(value, "${"+name+"}", variableValue)
+		}
+		configCopy.Config[key] = value
+	}
+	return &configCopy
 }
@@ -0,0 +1,91 @@
+package lab
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// DefaultMaxConcurrentProvisions is the number of labs provisioned at the same time; further labs queue
+const DefaultMaxConcurrentProvisions = 10
+
+// queuedProvision is a lab waiting for a provisioning slot
+type queuedProvision struct {
+	labID    string
+	admitted chan struct{} // Closed when the lab is given a slot
+}
+
+// SetMaxConcurrentProvisions sets how many labs may be provisioned at the same time. Zero or less
+// removes the limit. Raising the limit starts queued labs right away.
+func (s *Service) SetMaxConcurrentProvisions(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxConcurrentProvisions = limit
+	s.admitQueuedLocked()
+}
+
+// acquireProvisionSlotLocked gives a lab a provisioning slot, or queues it when every slot is taken.
+// The returned channel is closed once the lab holds a slot. The caller must hold s.mu.
+func (s *Service) acquireProvisionSlotLocked(labID string) chan struct{} {
+	admitted := make(chan struct{})
+	if s.maxConcurrentProvisions <= 0 || s.activeProvisions < s.maxConcurrentProvisions {
+		s.activeProvisions++
+		close(admitted)
+		return admitted
+	}
+
+	s.provisionQueue = append(s.provisionQueue, queuedProvision{labID: labID, admitted: admitted})
+	if lab, exists := s.labs[labID]; exists {
+		s.setLabStatus(lab, models.LabStatusQueued)
+	}
+	fmt.Printf("Lab %s: all %d provisioning slots busy, queued at position %d\n", labID, s.maxConcurrentProvisions, len(s.provisionQueue))
+	s.progressTracker.AddLog(labID, "All provisioning slots are busy, waiting in queue")
+	s.updateQueuePositionsLocked()
+	return admitted
+}
+
+// releaseProvisionSlotLocked gives up a lab's place in the queue, or its slot if it was already
+// admitted, and starts the next queued lab. The caller must hold s.mu.
+func (s *Service) releaseProvisionSlotLocked(admitted chan struct{}) {
+	for i, queued := range s.provisionQueue {
+		if queued.admitted == admitted {
+			s.provisionQueue = append(s.provisionQueue[:i], s.provisionQueue[i+1:]...)
+			s.updateQueuePositionsLocked()
+			return
+		}
+	}
+
+	s.activeProvisions--
+	s.admitQueuedLocked()
+}
+
+// admitQueuedLocked starts queued labs, oldest first, while slots are free. The caller must hold s.mu.
+func (s *Service) admitQueuedLocked() {
+	for len(s.provisionQueue) > 0 && (s.maxConcurrentProvisions <= 0 || s.activeProvisions < s.maxConcurrentProvisions) {
+		next := s.provisionQueue[0]
+		s.provisionQueue = s.provisionQueue[1:]
+		s.activeProvisions++
+
+		if lab, exists := s.labs[next.labID]; exists && lab.Status == models.LabStatusQueued {
+			// Keep the requested duration but count it from the actual start
+			now := time.Now()
+			duration := lab.EndsAt.Sub(lab.StartedAt)
+			lab.StartedAt = now
+			lab.EndsAt = now.Add(duration)
+			s.setLabStatus(lab, models.LabStatusProvisioning)
+		}
+		s.progressTracker.SetQueuePosition(next.labID, 0)
+		s.progressTracker.AddLog(next.labID, "Provisioning slot available, lab creation started")
+		close(next.admitted)
+	}
+	s.updateQueuePositionsLocked()
+}
+
+// updateQueuePositionsLocked records each queued lab's position in its progress. The caller must hold s.mu.
+func (s *Service) updateQueuePositionsLocked() {
+	for i, queued := range s.provisionQueue {
+		s.progressTracker.SetQueuePosition(queued.labID, i+1)
+	}
+}
@@ -0,0 +1,138 @@
+package lab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+	"github.com/wcrum/labby/internal/models"
+)
+
+// ErrLabNotRetryable is returned when retrying provisioning for a lab that hasn't failed
+var ErrLabNotRetryable = errors.New("lab provisioning cannot be retried")
+
+// serviceProvisioned reports whether a lab's service was provisioned by an earlier attempt
+func (s *Service) serviceProvisioned(labID, serviceID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lab, exists := s.labs[labID]
+	return exists && lab.Provisioning.Completed(serviceID)
+}
+
+// recordProvisioning records the outcome of provisioning one of a lab's services
+func (s *Service) recordProvisioning(labID string, serviceRef models.ServiceReference, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lab, exists := s.labs[labID]
+	if !exists {
+		return
+	}
+	if lab.Provisioning == nil {
+		lab.Provisioning = make(models.ProvisioningState)
+	}
+	state, exists := lab.Provisioning[serviceRef.ServiceID]
+	if !exists {
+		state = &models.ServiceProvisioningState{ServiceID: serviceRef.ServiceID}
+		lab.Provisioning[serviceRef.ServiceID] = state
+	}
+
+	state.Service = serviceRef.Name
+	state.Attempts++
+	state.UpdatedAt = time.Now()
+	if err != nil {
+		state.Status = models.ProvisioningStatusFailed
+		state.Error = err.Error()
+	} else {
+		state.Status = models.ProvisioningStatusCompleted
+		state.Error = ""
+	}
+	lab.Version++
+}
+
+// RetryLabProvisioning re-runs provisioning for a failed lab. Services that completed in an earlier
+// attempt keep their resources and are skipped; the rest are provisioned again, starting with the
+// ones that failed or never ran.
+func (s *Service) RetryLabProvisioning(labID string) (*models.Lab, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lab, exists := s.labs[labID]
+	if !exists {
+		return nil, ErrLabNotFound
+	}
+	if lab.Status != models.LabStatusError {
+		return nil, fmt.Errorf("%w: only labs in error status can be retried", ErrLabNotRetryable)
+	}
+	if lab.TemplateID == "" {
+		return nil, fmt.Errorf("%w: lab was not created from a template", ErrLabNotRetryable)
+	}
+	if _, running := s.provisioning[labID]; running {
+		return nil, fmt.Errorf("%w: lab is still provisioning", ErrLabNotRetryable)
+	}
+	if time.Now().After(lab.EndsAt) {
+		return nil, fmt.Errorf("%w: lab has expired", ErrLabNotRetryable)
+	}
+	if err := s.checkRetryServicesLocked(lab); err != nil {
+		return nil, err
+	}
+
+	// Services cleaned up after the failure, such as on a setup timeout, no longer have their
+	// resources and must be provisioned again
+	for serviceID := range lab.CleanupState {
+		delete(lab.Provisioning, serviceID)
+	}
+	lab.CleanupState = nil
+	lab.Failure = nil
+	lab.StepTimings = nil
+
+	fmt.Printf("RetryLabProvisioning: retrying provisioning for lab %s\n", labID)
+	s.progressTracker.InitializeProgress(labID)
+	s.progressTracker.AddLog(labID, "Retrying lab provisioning")
+
+	s.setLabStatus(lab, models.LabStatusProvisioning)
+	s.startProvisioning(labID, lab.TemplateID)
+
+	return lab, nil
+}
+
+// cleanupFailedServices removes the partial resources of services whose last provisioning attempt
+// failed, so they can be set up again from scratch. Failures are logged and provisioning goes ahead.
+func (s *Service) cleanupFailedServices(ctx context.Context, labID string) {
+	s.mu.RLock()
+	lab, exists := s.labs[labID]
+	var failed []string
+	if exists {
+		for _, state := range lab.Provisioning {
+			if state.Status == models.ProvisioningStatusFailed {
+				failed = append(failed, state.Service)
+			}
+		}
+	}
+	s.mu.RUnlock()
+	if len(failed) == 0 {
+		return
+	}
+
+	s.progressTracker.AddLog(labID, fmt.Sprintf("Cleaning up partial resources of failed services: %s", strings.Join(failed, ", ")))
+	cleanupCtx := &interfaces.CleanupContext{
+		LabID:   labID,
+		Context: ctx,
+		Lab:     lab,
+		ShouldCleanup: func(serviceID string) bool {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+
+			state, exists := lab.Provisioning[serviceID]
+			return exists && state.Status == models.ProvisioningStatusFailed
+		},
+	}
+	if err := s.runCleanup(cleanupCtx); err != nil {
+		fmt.Printf("Warning: Failed to clean up failed services of lab %s before retrying: %v\n", labID, err)
+		s.progressTracker.AddLog(labID, fmt.Sprintf("Warning: cleanup of failed services was incomplete: %v", err))
+	}
+}
@@ -0,0 +1,147 @@
+package lab
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+	"github.com/wcrum/labby/internal/models"
+	"github.com/wcrum/labby/internal/services"
+)
+
+const (
+	// readinessStep is the progress step reported while a service's endpoints are probed
+	readinessStep = "Checking Readiness"
+	// DefaultReadinessTimeout is how long a service's endpoints may take to become reachable after setup
+	DefaultReadinessTimeout = 5 * time.Minute
+	// DefaultReadinessInterval is how long to wait between readiness attempts
+	DefaultReadinessInterval = 5 * time.Second
+)
+
+// readinessProbe describes how to tell that a provisioned service is ready for users. Any service
+// config can set ready_url and ready_address; services implementing interfaces.ReadinessChecker also
+// check their own endpoints unless the config sets ready_check to false.
+type readinessProbe struct {
+	url           string // Must answer with a status below 500
+	address       string // host:port that must accept TCP connections
+	skipTLSVerify bool
+	useChecker    bool
+	timeout       time.Duration
+	interval      time.Duration
+}
+
+// readinessProbeFor returns the readiness probe of a service config, or nil when there is nothing to check
+func (s *Service) readinessProbeFor(serviceConfig *models.ServiceConfig) *readinessProbe {
+	probe := &readinessProbe{
+		url:           serviceConfig.Config["ready_url"],
+		address:       serviceConfig.Config["ready_address"],
+		skipTLSVerify: serviceConfig.Config["ready_skip_tls_verify"] == "true",
+		timeout:       DefaultReadinessTimeout,
+		interval:      DefaultReadinessInterval,
+	}
+	if service, exists := s.serviceManager.GetServiceByType(serviceConfig.Type); exists && serviceConfig.Config["ready_check"] != "false" {
+		_, probe.useChecker = service.(interfaces.ReadinessChecker)
+	}
+	if probe.url == "" && probe.address == "" && !probe.useChecker {
+		return nil
+	}
+
+	if value := serviceConfig.Config["ready_timeout"]; value != "" {
+		if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+			probe.timeout = timeout
+		} else {
+			fmt.Printf("Warning: invalid ready_timeout %q, using %v\n", value, probe.timeout)
+		}
+	}
+	if value := serviceConfig.Config["ready_interval"]; value != "" {
+		if interval, err := time.ParseDuration(value); err == nil && interval > 0 {
+			probe.interval = interval
+		} else {
+			fmt.Printf("Warning: invalid ready_interval %q, using %v\n", value, probe.interval)
+		}
+	}
+	return probe
+}
+
+// renderReadinessTarget substitutes ${lab_id} and lab ServiceData values, such as a VM's IP, into a probe target
+func renderReadinessTarget(target string, lab *models.Lab) string {
+	target = strings.ReplaceAll(target, "${lab_id}", lab.ID)
+	for key, value := range lab.ServiceData {
+		target = strings.ReplaceAll(target, "${"+key+"}", value)
+	}
+	return target
+}
+
+// waitForServiceReady probes a freshly provisioned service until its endpoints are reachable, so the lab
+// only becomes ready once users can actually connect. It reports the probing as its own progress step.
+func (s *Service) waitForServiceReady(ctx context.Context, labID string, serviceConfig *models.ServiceConfig) error {
+	probe := s.readinessProbeFor(serviceConfig)
+	if probe == nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	lab, exists := s.labs[labID]
+	s.mu.RUnlock()
+	if !exists {
+		return ErrLabNotFound
+	}
+	labCopy := s.isolatedLabCopy(lab)
+
+	var checker interfaces.ReadinessChecker
+	if probe.useChecker {
+		service, err := newServiceFromConfig(serviceConfig)
+		if err != nil {
+			return err
+		}
+		checker, _ = service.(interfaces.ReadinessChecker)
+	}
+	url := renderReadinessTarget(probe.url, labCopy)
+	address := renderReadinessTarget(probe.address, labCopy)
+
+	check := func() error {
+		if checker != nil {
+			if err := checker.CheckReady(ctx, labCopy); err != nil {
+				return err
+			}
+		}
+		if url != "" {
+			if err := services.ProbeURL(ctx, url, probe.skipTLSVerify, nil); err != nil {
+				return err
+			}
+		}
+		if address != "" {
+			if err := services.ProbeAddress(ctx, address); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, readinessStep, "running", "Waiting for endpoints to become reachable...")
+
+	deadline := time.Now().Add(probe.timeout)
+	for attempt := 1; ; attempt++ {
+		err := check()
+		if err == nil {
+			s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, readinessStep, "completed", "Endpoints are reachable")
+			return nil
+		}
+
+		if time.Now().Add(probe.interval).After(deadline) {
+			err = fmt.Errorf("%s not ready after %v: %w", serviceConfig.Name, probe.timeout, err)
+			s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, readinessStep, "failed", err.Error())
+			s.progressTracker.AddLog(labID, err.Error())
+			return err
+		}
+		s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, readinessStep, "running", fmt.Sprintf("Not ready yet (attempt %d): %v", attempt, err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(probe.interval):
+		}
+	}
+}
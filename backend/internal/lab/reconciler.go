@@ -0,0 +1,290 @@
+package lab
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+	"github.com/wcrum/labby/internal/models"
+	"github.com/wcrum/labby/internal/services"
+)
+
+// DefaultReconcileGracePeriod is how old an orphaned resource must be before it is cleaned up
+const DefaultReconcileGracePeriod = 2 * time.Hour
+
+// Orphaned resource actions
+const (
+	ReconcileActionWouldCleanup = "would_cleanup"
+	ReconcileActionCleaned      = "cleaned"
+	ReconcileActionFailed       = "failed"
+	ReconcileActionGracePeriod  = "skipped_grace_period"
+)
+
+// orphanKey identifies a listed resource across sweeps
+type orphanKey struct {
+	serviceConfigID string
+	name            string
+}
+
+// OrphanedResource represents a lab-named resource whose lab no longer exists
+type OrphanedResource struct {
+	ServiceConfigID string    `json:"service_config_id"`
+	ServiceType     string    `json:"service_type"`
+	Name            string    `json:"name"`
+	LabID           string    `json:"lab_id"`
+	CreatedAt       time.Time `json:"created_at,omitempty"`
+	Action          string    `json:"action"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// ReconcileReport summarizes a single reconciliation sweep
+type ReconcileReport struct {
+	DryRun      bool               `json:"dry_run"`
+	StartedAt   time.Time          `json:"started_at"`
+	CompletedAt time.Time          `json:"completed_at"`
+	Orphans     []OrphanedResource `json:"orphans"`
+	Errors      map[string]string  `json:"errors"`
+}
+
+// Reconciler detects and cleans up cloud resources left behind by labs that no longer exist
+type Reconciler struct {
+	labService  *Service
+	gracePeriod time.Duration
+	runMu       sync.Mutex
+	mu          sync.RWMutex
+	lastReport  *ReconcileReport
+	firstSeen   map[orphanKey]time.Time // When resources without a creation time were first listed, guarded by runMu
+}
+
+// NewReconciler creates a new reconciler
+func NewReconciler(labService *Service, gracePeriod time.Duration) *Reconciler {
+	return &Reconciler{
+		labService:  labService,
+		gracePeriod: gracePeriod,
+		firstSeen:   make(map[orphanKey]time.Time),
+	}
+}
+
+// SetGracePeriod sets how old an orphaned resource must be before it is cleaned up
+func (r *Reconciler) SetGracePeriod(gracePeriod time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gracePeriod = gracePeriod
+}
+
+// Start runs dry-run sweeps periodically so orphans are reported without being deleted
+func (r *Reconciler) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			r.Run(true)
+		}
+	}()
+}
+
+// GetLastReport returns the report of the most recent sweep
+func (r *Reconciler) GetLastReport() *ReconcileReport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastReport
+}
+
+// Run performs a reconciliation sweep. When dryRun is true, orphans are only reported.
+func (r *Reconciler) Run(dryRun bool) *ReconcileReport {
+	// Only one sweep at a time
+	r.runMu.Lock()
+	defer r.runMu.Unlock()
+
+	report := &ReconcileReport{
+		DryRun:    dryRun,
+		StartedAt: time.Now(),
+		Orphans:   []OrphanedResource{},
+		Errors:    make(map[string]string),
+	}
+
+	fmt.Printf("Reconciler: starting sweep (dry run: %t)\n", dryRun)
+
+	liveLabs := r.liveLabIDs()
+
+	r.mu.RLock()
+	gracePeriod := r.gracePeriod
+	r.mu.RUnlock()
+
+	seen := make(map[orphanKey]time.Time)
+	for _, config := range r.labService.serviceConfigManager.GetActiveServiceConfigs() {
+		service, err := newServiceFromConfig(config)
+		var resources []interfaces.LabResource
+		if err == nil {
+			lister, ok := service.(interfaces.ResourceLister)
+			if !ok {
+				continue
+			}
+			resources, err = lister.ListLabResources()
+		}
+		if err != nil {
+			fmt.Printf("Reconciler: failed to list resources for %s: %v\n", config.ID, err)
+			report.Errors[config.ID] = err.Error()
+			// Keep first-seen times so a listing or secret resolution failure doesn't restart the grace period
+			for key, firstSeen := range r.firstSeen {
+				if key.serviceConfigID == config.ID {
+					seen[key] = firstSeen
+				}
+			}
+			continue
+		}
+
+		for _, resource := range resources {
+			if liveLabs[resource.LabID] {
+				continue
+			}
+
+			orphan := OrphanedResource{
+				ServiceConfigID: config.ID,
+				ServiceType:     config.Type,
+				Name:            resource.Name,
+				LabID:           resource.LabID,
+				CreatedAt:       resource.CreatedAt,
+			}
+
+			// Resources without a creation time age from when a sweep first listed them, so a
+			// lab's resources aren't removed while it is still being created
+			age := resource.CreatedAt
+			if age.IsZero() {
+				key := orphanKey{serviceConfigID: config.ID, name: resource.Name}
+				if firstSeen, exists := r.firstSeen[key]; exists {
+					age = firstSeen
+				} else {
+					age = report.StartedAt
+				}
+				seen[key] = age
+			}
+			if time.Since(age) < gracePeriod {
+				orphan.Action = ReconcileActionGracePeriod
+				report.Orphans = append(report.Orphans, orphan)
+				continue
+			}
+
+			if dryRun {
+				orphan.Action = ReconcileActionWouldCleanup
+				report.Orphans = append(report.Orphans, orphan)
+				continue
+			}
+
+			fmt.Printf("Reconciler: cleaning up orphaned %s resource %s (lab %s)\n", config.Type, resource.Name, resource.LabID)
+			cleanupCtx := &interfaces.CleanupContext{
+				LabID:   resource.LabID,
+				Context: context.Background(),
+				Lab:     nil, // Lab no longer exists, services construct resource names from the lab ID
+			}
+			if err := service.ExecuteCleanup(cleanupCtx); err != nil {
+				orphan.Action = ReconcileActionFailed
+				orphan.Error = err.Error()
+			} else {
+				orphan.Action = ReconcileActionCleaned
+			}
+			report.Orphans = append(report.Orphans, orphan)
+		}
+	}
+
+	r.firstSeen = seen
+
+	report.CompletedAt = time.Now()
+	fmt.Printf("Reconciler: sweep completed, %d orphaned resources found\n", len(report.Orphans))
+
+	r.mu.Lock()
+	r.lastReport = report
+	r.mu.Unlock()
+
+	return report
+}
+
+// liveLabIDs returns the set of lab IDs currently known to the lab service
+func (r *Reconciler) liveLabIDs() map[string]bool {
+	r.labService.mu.RLock()
+	defer r.labService.mu.RUnlock()
+
+	ids := make(map[string]bool, len(r.labService.labs))
+	for id := range r.labService.labs {
+		ids[id] = true
+	}
+	return ids
+}
+
+// resolveServiceConfigSecrets returns a copy of the service config with env: and vault: references replaced
+// by the secrets they point to
+func resolveServiceConfigSecrets(serviceConfig *models.ServiceConfig) (*models.ServiceConfig, error) {
+	config, err := services.ResolveConfig(serviceConfig.Config)
+	if err != nil {
+		return nil, err
+	}
+	configCopy := *serviceConfig
+	configCopy.Config = config
+	return &configCopy, nil
+}
+
+// newServiceFromConfig creates a service configured for work outside of lab provisioning,
+// such as listing, cleaning up or testing resources. Secret references in the config are
+// resolved first; a nil service means the type has no such implementation.
+func newServiceFromConfig(config *models.ServiceConfig) (interfaces.Service, error) {
+	resolved, err := resolveServiceConfigSecrets(config)
+	if err != nil {
+		return nil, fmt.Errorf("service config %s: %w", config.ID, err)
+	}
+	config = resolved
+
+	switch config.Type {
+	case "palette_project":
+		service := services.NewPaletteProjectService()
+		service.ConfigureFromServiceConfig(config)
+		return service, nil
+	case "palette_tenant":
+		service := services.NewPaletteTenantService()
+		service.ConfigureFromServiceConfig(config.Config)
+		return service, nil
+	case "guacamole":
+		service := services.NewGuacamoleService()
+		service.ConfigureFromServiceConfig(config.Config)
+		return service, nil
+	case "vault":
+		service := services.NewVaultService()
+		service.ConfigureFromServiceConfig(config.Config)
+		return service, nil
+	case "proxmox_user":
+		service := services.NewProxmoxUserService()
+		service.ConfigureFromServiceConfig(config.Config)
+		return service, nil
+	case "azure":
+		service := services.NewAzureService()
+		service.ConfigureFromServiceConfig(config.Config)
+		return service, nil
+	case "gcp":
+		service := services.NewGCPService()
+		service.ConfigureFromServiceConfig(config.Config)
+		return service, nil
+	case "ssh_command":
+		service := services.NewSSHCommandService()
+		service.ConfigureFromServiceConfig(config.Config)
+		return service, nil
+	case "http":
+		service := services.NewHTTPService()
+		service.ConfigureFromServiceConfig(config.Config)
+		return service, nil
+	case "docker":
+		service := services.NewDockerService()
+		service.ConfigureFromServiceConfig(config.Config)
+		return service, nil
+	case "terraform_cloud":
+		// Only pass connection settings so templated variables (e.g. VLAN tags) are not allocated
+		service := services.NewTerraformCloudService()
+		service.ConfigureFromServiceConfig(map[string]string{
+			"host":         config.Config["host"],
+			"api_token":    config.Config["api_token"],
+			"organization": config.Config["organization"],
+		}, "")
+		return service, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,129 @@
+package lab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/wcrum/labby/internal/interfaces"
+	"github.com/wcrum/labby/internal/models"
+)
+
+// ErrRegistrationTokenNotFound is returned when a token to revoke isn't one of the lab's
+var ErrRegistrationTokenNotFound = errors.New("registration token not found")
+
+// LabRegistrationToken is a registration token together with the service config that issued it
+type LabRegistrationToken struct {
+	interfaces.RegistrationToken
+	ServiceID   string `json:"service_id"`
+	ServiceName string `json:"service_name"`
+}
+
+// registrationTokenSource is a configured service that can list a lab's registration tokens
+type registrationTokenSource struct {
+	config  *models.ServiceConfig
+	manager interfaces.RegistrationTokenManager
+}
+
+// registrationTokenSources returns the services to ask for a lab's registration tokens together with the
+// lab to pass them. Labs that were already removed after cleanup are looked up in every service that issues
+// tokens, by lab ID alone, since stray tokens are exactly what cleanup may have missed.
+func (s *Service) registrationTokenSources(labID string) ([]registrationTokenSource, *models.Lab) {
+	s.mu.RLock()
+	lab, exists := s.labs[labID]
+	var serviceIDs []string
+	var organizationID string
+	if exists {
+		serviceIDs = append(serviceIDs, lab.UsedServices...)
+		organizationID = lab.OrganizationID
+	}
+	s.mu.RUnlock()
+
+	var configs []*models.ServiceConfig
+	if exists {
+		for _, serviceID := range serviceIDs {
+			if config, ok := s.serviceConfigManager.ResolveServiceConfig(serviceID, organizationID); ok {
+				configs = append(configs, config)
+			}
+		}
+	} else {
+		configs = s.serviceConfigManager.GetAllServiceConfigs()
+	}
+
+	var sources []registrationTokenSource
+	for _, config := range configs {
+		service, err := newServiceFromConfig(config)
+		if err != nil {
+			fmt.Printf("Warning: skipping registration tokens of %v\n", err)
+			continue
+		}
+		if manager, ok := service.(interfaces.RegistrationTokenManager); ok {
+			sources = append(sources, registrationTokenSource{config: config, manager: manager})
+		}
+	}
+
+	if !exists {
+		return sources, &models.Lab{ID: labID, ServiceData: map[string]string{}}
+	}
+	return sources, s.isolatedLabCopy(lab)
+}
+
+// ListRegistrationTokens returns the registration tokens the services of a lab issued for it that still
+// exist on the backing systems
+func (s *Service) ListRegistrationTokens(ctx context.Context, labID string) ([]LabRegistrationToken, error) {
+	sources, lab := s.registrationTokenSources(labID)
+
+	tokens := make([]LabRegistrationToken, 0)
+	for _, source := range sources {
+		serviceTokens, err := source.manager.ListRegistrationTokens(ctx, lab)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source.config.Name, err)
+		}
+		for _, token := range serviceTokens {
+			tokens = append(tokens, LabRegistrationToken{
+				RegistrationToken: token,
+				ServiceID:         source.config.ID,
+				ServiceName:       source.config.Name,
+			})
+		}
+	}
+	return tokens, nil
+}
+
+// RevokeRegistrationToken revokes one of a lab's registration tokens on the backing system. Only tokens
+// listed for the lab can be revoked, so the endpoint can't be used to delete arbitrary tokens.
+func (s *Service) RevokeRegistrationToken(ctx context.Context, labID, tokenUID string) error {
+	sources, lab := s.registrationTokenSources(labID)
+
+	for _, source := range sources {
+		serviceTokens, err := source.manager.ListRegistrationTokens(ctx, lab)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source.config.Name, err)
+		}
+		for _, token := range serviceTokens {
+			if token.UID != tokenUID {
+				continue
+			}
+
+			if err := source.manager.RevokeRegistrationToken(ctx, lab, tokenUID); err != nil {
+				return err
+			}
+
+			// Keep the lab's record of its tokens in step, if the lab still exists
+			s.mu.Lock()
+			if current, exists := s.labs[labID]; exists {
+				if current.ServiceData == nil {
+					current.ServiceData = make(map[string]string)
+				}
+				for key, value := range lab.ServiceData {
+					current.ServiceData[key] = value
+				}
+			}
+			s.mu.Unlock()
+
+			fmt.Printf("Revoked registration token %s (%s) of lab %s\n", tokenUID, token.Name, labID)
+			return nil
+		}
+	}
+	return ErrRegistrationTokenNotFound
+}
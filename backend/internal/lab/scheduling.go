@@ -0,0 +1,157 @@
+package lab
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// MaxScheduleAhead is how far in the future a lab can be scheduled to start
+const MaxScheduleAhead = 30 * 24 * time.Hour
+
+// DefaultLabSchedulerInterval is how often the scheduler checks for labs that are due to start
+const DefaultLabSchedulerInterval = 30 * time.Second
+
+// validateStartAt checks that a requested start time is in the future and within the scheduling window
+func validateStartAt(startAt time.Time) error {
+	now := time.Now()
+	if !startAt.After(now) {
+		return fmt.Errorf("%w: start_at must be in the future", ErrInvalidStartAt)
+	}
+	if startAt.Sub(now) > MaxScheduleAhead {
+		return fmt.Errorf("%w: start_at must be within %v", ErrInvalidStartAt, MaxScheduleAhead)
+	}
+	return nil
+}
+
+// StartLabScheduler starts a background task that provisions scheduled labs once their start time arrives
+func (s *Service) StartLabScheduler(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultLabSchedulerInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			s.StartDueLabs()
+		}
+	}()
+}
+
+// StartDueLabs starts provisioning for every scheduled lab whose start time has passed. Labs are
+// claimed one at a time in start order under the lock, each counting against its services' limits
+// before the next is checked, so a class starting together fills the available slots exactly.
+func (s *Service) StartDueLabs() {
+	now := time.Now()
+
+	type dueLab struct {
+		id         string
+		templateID string
+		err        error // Why the lab couldn't start, nil when it was claimed
+	}
+	var due []dueLab
+
+	s.mu.Lock()
+	var scheduled []*models.Lab
+	for _, lab := range s.labs {
+		if lab.Status == models.LabStatusScheduled && !lab.StartedAt.After(now) {
+			scheduled = append(scheduled, lab)
+		}
+	}
+	sort.Slice(scheduled, func(i, j int) bool {
+		return scheduled[i].StartedAt.Before(scheduled[j].StartedAt)
+	})
+
+	for _, lab := range scheduled {
+		// The lab isn't provisioning yet, so usage counts only the labs already holding a slot
+		if err := s.checkTemplateServiceAvailability(lab.TemplateID); err != nil {
+			s.setLabStatus(lab, models.LabStatusError)
+			due = append(due, dueLab{id: lab.ID, templateID: lab.TemplateID, err: err})
+			continue
+		}
+
+		// Keep the requested duration but count it from the actual start
+		duration := lab.EndsAt.Sub(lab.StartedAt)
+		lab.StartedAt = now
+		lab.EndsAt = now.Add(duration)
+		s.setLabStatus(lab, models.LabStatusProvisioning)
+
+		due = append(due, dueLab{id: lab.ID, templateID: lab.TemplateID})
+	}
+	s.mu.Unlock()
+
+	for _, lab := range due {
+		if lab.err != nil {
+			fmt.Printf("Lab scheduler: lab %s cannot start: %v\n", lab.id, lab.err)
+			s.progressTracker.FailProgress(lab.id, fmt.Sprintf("Scheduled start failed: %v", lab.err))
+			continue
+		}
+
+		fmt.Printf("Lab scheduler: starting scheduled lab %s\n", lab.id)
+		s.progressTracker.AddLog(lab.id, "Scheduled start time reached, lab creation started from template")
+		s.mu.Lock()
+		s.startProvisioning(lab.id, lab.templateID)
+		s.mu.Unlock()
+	}
+}
+
+// checkTemplateServiceAvailability verifies that every service of a template is within its limits.
+// The caller must hold s.mu.
+func (s *Service) checkTemplateServiceAvailability(templateID string) error {
+	template, exists := s.templateManager.GetTemplate(templateID)
+	if !exists {
+		return fmt.Errorf("template not found: %s", templateID)
+	}
+
+	for _, serviceRef := range template.Services {
+		currentUsage := s.serviceUsageLocked(serviceRef.ServiceID)
+		if err := s.serviceConfigManager.CheckServiceAvailability(serviceRef.ServiceID, currentUsage); err != nil {
+			return fmt.Errorf("service %s (%s) not available: %w", serviceRef.Name, serviceRef.ServiceID, err)
+		}
+	}
+
+	return nil
+}
+
+// GetScheduledLabs returns labs waiting to start, optionally filtered by owner (empty for all owners)
+func (s *Service) GetScheduledLabs(ownerID string) []*models.Lab {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	labs := make([]*models.Lab, 0)
+	for _, lab := range s.labs {
+		if lab.Status != models.LabStatusScheduled {
+			continue
+		}
+		if ownerID != "" && lab.OwnerID != ownerID {
+			continue
+		}
+		labs = append(labs, lab)
+	}
+
+	return labs
+}
+
+// CancelScheduledLab removes a lab that has not started yet. Nothing has been provisioned, so no cleanup is needed.
+func (s *Service) CancelScheduledLab(labID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lab, exists := s.labs[labID]
+	if !exists {
+		return ErrLabNotFound
+	}
+	if lab.Status != models.LabStatusScheduled {
+		return ErrLabNotScheduled
+	}
+
+	s.progressTracker.CleanupProgress(labID)
+	delete(s.labs, labID)
+	delete(s.shares, labID)
+	s.publishLabDeleted(lab)
+
+	fmt.Printf("Lab scheduler: cancelled scheduled lab %s\n", labID)
+	return nil
+}
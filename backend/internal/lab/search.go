@@ -0,0 +1,136 @@
+package lab
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// MaxLabSearchResults caps the number of labs returned by a search
+const MaxLabSearchResults = 100
+
+// LabSearchMatch describes a single field of a lab that matched a search query
+type LabSearchMatch struct {
+	Field       string `json:"field"`       // e.g. "name", "credentials[Palette Project].username", "service_data.palette_project_name"
+	Value       string `json:"value"`       // Full value of the field
+	Highlighted string `json:"highlighted"` // Value with the matched text wrapped in <mark></mark>
+}
+
+// LabSearchResult is a lab together with the fields that matched
+type LabSearchResult struct {
+	Lab     *models.Lab
+	Matches []LabSearchMatch
+}
+
+// sensitiveServiceDataKeyParts mark ServiceData keys whose values are secrets
+var sensitiveServiceDataKeyParts = []string{"password", "_pass", "secret", "token", "api_key", "service_account_key", "tls_key", "sensitive_variables."}
+
+// isSensitiveServiceDataKey reports whether a ServiceData key holds a secret that must never be exposed
+func isSensitiveServiceDataKey(key string) bool {
+	lowerKey := strings.ToLower(key)
+
+	// Resource names such as "palette_project_api_key_name" are not secrets
+	if strings.HasSuffix(lowerKey, "_name") {
+		return false
+	}
+
+	for _, part := range sensitiveServiceDataKeyParts {
+		if strings.Contains(lowerKey, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchLabs performs a case-insensitive search over lab names, tags, credentials (excluding passwords)
+// and non-secret ServiceData values such as project names, usernames and URLs
+func (s *Service) SearchLabs(query string) []LabSearchResult {
+	needle := strings.ToLower(strings.TrimSpace(query))
+	if needle == "" {
+		return []LabSearchResult{}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]LabSearchResult, 0)
+	for _, lab := range s.labs {
+		var matches []LabSearchMatch
+		match := func(field, value string) {
+			if highlighted, ok := highlightMatch(value, needle); ok {
+				matches = append(matches, LabSearchMatch{Field: field, Value: value, Highlighted: highlighted})
+			}
+		}
+
+		match("id", lab.ID)
+		match("name", lab.Name)
+		match("owner_id", lab.OwnerID)
+		match("template_id", lab.TemplateID)
+		for _, tag := range lab.Tags {
+			match("tags", tag)
+		}
+
+		for _, credential := range lab.Credentials {
+			prefix := "credentials[" + credential.Label + "]."
+			match(prefix+"label", credential.Label)
+			match(prefix+"username", credential.Username)
+			match(prefix+"url", credential.URL)
+			match(prefix+"notes", credential.Notes)
+		}
+
+		for key, value := range lab.ServiceData {
+			if isSensitiveServiceDataKey(key) {
+				continue
+			}
+			match("service_data."+key, value)
+		}
+
+		if len(matches) > 0 {
+			sort.Slice(matches, func(i, j int) bool { return matches[i].Field < matches[j].Field })
+			results = append(results, LabSearchResult{Lab: lab, Matches: matches})
+		}
+	}
+
+	// Most recent labs first
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Lab.CreatedAt.After(results[j].Lab.CreatedAt)
+	})
+	if len(results) > MaxLabSearchResults {
+		results = results[:MaxLabSearchResults]
+	}
+
+	return results
+}
+
+// highlightMatch wraps every case-insensitive occurrence of needle (already lower-cased) in value with <mark></mark>
+func highlightMatch(value, needle string) (string, bool) {
+	lowerValue := strings.ToLower(value)
+	if needle == "" || !strings.Contains(lowerValue, needle) {
+		return "", false
+	}
+
+	// Lower-casing some non-ASCII characters changes their byte length, so offsets no longer line up
+	if len(lowerValue) != len(value) {
+		return value, true
+	}
+
+	var builder strings.Builder
+	offset := 0
+	for {
+		index := strings.Index(lowerValue[offset:], needle)
+		if index < 0 {
+			builder.WriteString(value[offset:])
+			break
+		}
+		start := offset + index
+		end := start + len(needle)
+		builder.WriteString(value[offset:start])
+		builder.WriteString("<mark>")
+		builder.WriteString(value[start:end])
+		builder.WriteString("</mark>")
+		offset = end
+	}
+
+	return builder.String(), true
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/wcrum/labby/internal/models"
+	"github.com/wcrum/labby/internal/services"
 
 	"gopkg.in/yaml.v3"
 )
@@ -67,8 +68,13 @@ func (scl *ServiceConfigLoader) LoadServiceConfigFromFile(filePath string) error
 	if serviceConfig.UpdatedAt.IsZero() {
 		serviceConfig.UpdatedAt = time.Now()
 	}
-	// Set IsActive to true by default for all service configs
-	serviceConfig.IsActive = true
+	// Service configs are active unless the file sets is_active: false
+	var active struct {
+		IsActive *bool `yaml:"is_active"`
+	}
+	if err := yaml.Unmarshal(data, &active); err == nil && active.IsActive == nil {
+		serviceConfig.IsActive = true
+	}
 
 	fmt.Printf("ServiceConfigLoader.LoadServiceConfigFromFile: Loaded service config %s (ID: %s, Type: %s, Active: %v)\n",
 		serviceConfig.Name, serviceConfig.ID, serviceConfig.Type, serviceConfig.IsActive)
@@ -100,17 +106,58 @@ func (scl *ServiceConfigLoader) validateServiceConfig(config *models.ServiceConf
 		return fmt.Errorf("service config type is required")
 	}
 
-	// Validate service type
-	switch config.Type {
-	case "palette_project", "proxmox_user", "palette_tenant", "terraform_cloud", "guacamole":
-		// Valid service types
-	default:
+	if !isSupportedServiceType(config.Type) {
 		return fmt.Errorf("unsupported service type: %s", config.Type)
 	}
 
+	if config.Overrides != "" && config.OrganizationID == "" {
+		return fmt.Errorf("service config overriding %s must set organization_id", config.Overrides)
+	}
+	if config.Overrides == config.ID {
+		return fmt.Errorf("service config %s cannot override itself", config.ID)
+	}
+
+	return ValidateServiceSettings(config)
+}
+
+// ValidateServiceSettings checks the settings of a service config that are specific to its type, which
+// would otherwise only fail once a lab is provisioned with it. Configs are checked when they are loaded
+// and when they are created or updated through the API.
+func ValidateServiceSettings(config *models.ServiceConfig) error {
+	var validators []func(map[string]string) error
+	switch config.Type {
+	case "terraform_cloud":
+		validators = []func(map[string]string) error{
+			services.ValidateTerraformWorkspaces,
+			services.ValidateTerraformArchive,
+			services.ValidateTerraformGitSource,
+		}
+	case "palette_project":
+		validators = []func(map[string]string) error{services.ValidatePaletteScope}
+		// Warned here rather than whenever the service is configured, which happens for every lab
+		if services.PaletteScopeInferred(config.Config) {
+			fmt.Printf("Warning: service config %s sets project_uid without scope, using project scope; set scope to project or tenant\n", config.ID)
+		}
+	}
+
+	for _, validate := range validators {
+		if err := validate(config.Config); err != nil {
+			return fmt.Errorf("%w %s: %w", ErrInvalidServiceConfig, config.ID, err)
+		}
+	}
 	return nil
 }
 
+// isSupportedServiceType reports whether labs can provision services of a type
+func isSupportedServiceType(serviceType string) bool {
+	switch serviceType {
+	case "palette_project", "proxmox_user", "palette_tenant", "terraform_cloud", "guacamole", "vault", "azure", "gcp", "ssh_command", "http", "docker":
+		return true
+	default:
+		return false
+	}
+}
+
 // LoadServiceLimitsFromDirectory loads service limits from a directory
 func (scl *ServiceConfigLoader) LoadServiceLimitsFromDirectory(dirPath string) error {
 	return filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
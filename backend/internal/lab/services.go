@@ -12,7 +12,7 @@ import (
 )
 
 // provisionPaletteService provisions a Palette service using the real Palette Project service
-func (s *Service) provisionPaletteService(labID string, serviceConfig *models.ServiceConfig) {
+func (s *Service) provisionPaletteService(ctx context.Context, labID string, serviceConfig *models.ServiceConfig) error {
 	// Create Palette Project service instance
 	paletteService := services.NewPaletteProjectService()
 
@@ -26,7 +26,7 @@ func (s *Service) provisionPaletteService(labID string, serviceConfig *models.Se
 
 	if !exists {
 		s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, "Creating Project", "failed", "Lab not found")
-		return
+		return ErrLabNotFound
 	}
 
 	// Create setup context
@@ -35,21 +35,26 @@ func (s *Service) provisionPaletteService(labID string, serviceConfig *models.Se
 		LabName:  lab.Name,
 		Duration: int(time.Until(lab.EndsAt).Minutes()),
 		OwnerID:  lab.OwnerID,
-		Context:  context.Background(),
+		Context:  ctx,
 		Lab:      lab,
 		AddCredential: func(credential *interfaces.Credential) error {
 			// Convert to models.Credential and add to lab
 			cred := models.Credential{
-				ID:        credential.ID,
-				LabID:     credential.LabID,
-				Label:     credential.Label,
-				Username:  credential.Username,
-				Password:  credential.Password,
-				URL:       credential.URL,
-				ExpiresAt: credential.ExpiresAt,
-				Notes:     credential.Notes,
-				CreatedAt: credential.CreatedAt,
-				UpdatedAt: credential.UpdatedAt,
+				ID:             credential.ID,
+				LabID:          credential.LabID,
+				Label:          credential.Label,
+				Username:       credential.Username,
+				Password:       credential.Password,
+				URL:            credential.URL,
+				ExpiresAt:      credential.ExpiresAt,
+				Notes:          credential.Notes,
+				CreatedAt:      credential.CreatedAt,
+				UpdatedAt:      credential.UpdatedAt,
+				ServiceID:      serviceConfig.ID,
+				CredentialType: credential.CredentialType,
+				OneTimeReveal:  credential.OneTimeReveal || oneTimeRevealConfigured(serviceConfig),
+				PublicKey:      credential.PublicKey,
+				PrivateKey:     credential.PrivateKey,
 			}
 
 			s.mu.Lock()
@@ -64,7 +69,7 @@ func (s *Service) provisionPaletteService(labID string, serviceConfig *models.Se
 	}
 
 	// Execute the real setup - services will update their own progress
-	err := paletteService.ExecuteSetup(setupCtx)
+	err := s.executeSetupWithTimeout(paletteService, setupCtx, serviceConfig.Type)
 	if err != nil {
 		s.progressTracker.AddLog(labID, fmt.Sprintf("Palette Project setup failed: %v", err))
 		s.progressTracker.FailProgress(labID, fmt.Sprintf("Palette Project setup failed: %v", err))
@@ -72,18 +77,19 @@ func (s *Service) provisionPaletteService(labID string, serviceConfig *models.Se
 		// Set lab status to error
 		s.mu.Lock()
 		if lab, exists := s.labs[labID]; exists {
-			lab.Status = models.LabStatusError
-			lab.UpdatedAt = time.Now()
+			s.setLabStatus(lab, models.LabStatusError)
 		}
 		s.mu.Unlock()
-		return
+		return err
 	}
 
 	s.progressTracker.AddLog(labID, "Palette Project service setup completed successfully")
+
+	return nil
 }
 
 // provisionProxmoxUserService provisions a Proxmox user service using the real Proxmox User service
-func (s *Service) provisionProxmoxUserService(labID string, serviceConfig *models.ServiceConfig) {
+func (s *Service) provisionProxmoxUserService(ctx context.Context, labID string, serviceConfig *models.ServiceConfig) error {
 	// Create Proxmox User service instance
 	proxmoxUserService := services.NewProxmoxUserService()
 
@@ -97,7 +103,7 @@ func (s *Service) provisionProxmoxUserService(labID string, serviceConfig *model
 
 	if !exists {
 		s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, "Creating User", "failed", "Lab not found")
-		return
+		return ErrLabNotFound
 	}
 
 	// Create setup context
@@ -106,21 +112,26 @@ func (s *Service) provisionProxmoxUserService(labID string, serviceConfig *model
 		LabName:  lab.Name,
 		Duration: int(time.Until(lab.EndsAt).Minutes()),
 		OwnerID:  lab.OwnerID,
-		Context:  context.Background(),
+		Context:  ctx,
 		Lab:      lab,
 		AddCredential: func(credential *interfaces.Credential) error {
 			// Convert to models.Credential and add to lab
 			cred := models.Credential{
-				ID:        credential.ID,
-				LabID:     credential.LabID,
-				Label:     credential.Label,
-				Username:  credential.Username,
-				Password:  credential.Password,
-				URL:       credential.URL,
-				ExpiresAt: credential.ExpiresAt,
-				Notes:     credential.Notes,
-				CreatedAt: credential.CreatedAt,
-				UpdatedAt: credential.UpdatedAt,
+				ID:             credential.ID,
+				LabID:          credential.LabID,
+				Label:          credential.Label,
+				Username:       credential.Username,
+				Password:       credential.Password,
+				URL:            credential.URL,
+				ExpiresAt:      credential.ExpiresAt,
+				Notes:          credential.Notes,
+				CreatedAt:      credential.CreatedAt,
+				UpdatedAt:      credential.UpdatedAt,
+				ServiceID:      serviceConfig.ID,
+				CredentialType: credential.CredentialType,
+				OneTimeReveal:  credential.OneTimeReveal || oneTimeRevealConfigured(serviceConfig),
+				PublicKey:      credential.PublicKey,
+				PrivateKey:     credential.PrivateKey,
 			}
 
 			s.mu.Lock()
@@ -135,7 +146,7 @@ func (s *Service) provisionProxmoxUserService(labID string, serviceConfig *model
 	}
 
 	// Execute the real setup - services will update their own progress
-	err := proxmoxUserService.ExecuteSetup(setupCtx)
+	err := s.executeSetupWithTimeout(proxmoxUserService, setupCtx, serviceConfig.Type)
 	if err != nil {
 		s.progressTracker.AddLog(labID, fmt.Sprintf("Proxmox user setup failed: %v", err))
 		s.progressTracker.FailProgress(labID, fmt.Sprintf("Proxmox user setup failed: %v", err))
@@ -143,18 +154,19 @@ func (s *Service) provisionProxmoxUserService(labID string, serviceConfig *model
 		// Set lab status to error
 		s.mu.Lock()
 		if lab, exists := s.labs[labID]; exists {
-			lab.Status = models.LabStatusError
-			lab.UpdatedAt = time.Now()
+			s.setLabStatus(lab, models.LabStatusError)
 		}
 		s.mu.Unlock()
-		return
+		return err
 	}
 
 	s.progressTracker.AddLog(labID, "Proxmox user created successfully")
+
+	return nil
 }
 
 // provisionPaletteTenantService provisions a Palette Tenant service using the real Palette Tenant service
-func (s *Service) provisionPaletteTenantService(labID string, serviceConfig *models.ServiceConfig) {
+func (s *Service) provisionPaletteTenantService(ctx context.Context, labID string, serviceConfig *models.ServiceConfig) error {
 	s.progressTracker.AddLog(labID, fmt.Sprintf("Starting Palette Tenant service setup for lab %s", labID))
 
 	// Set environment variables from service config with comprehensive logging
@@ -191,6 +203,7 @@ func (s *Service) provisionPaletteTenantService(labID string, serviceConfig *mod
 	// Create Palette Tenant service instance
 	s.progressTracker.AddLog(labID, "Creating Palette Tenant service instance...")
 	paletteTenantService := services.NewPaletteTenantService()
+	paletteTenantService.ConfigureFromServiceConfig(serviceConfig.Config)
 
 	// Log the environment variables that the service will use
 	s.progressTracker.AddLog(labID, fmt.Sprintf("Service will use palette_host: %s", os.Getenv("palette_host")))
@@ -204,7 +217,7 @@ func (s *Service) provisionPaletteTenantService(labID string, serviceConfig *mod
 
 	if !exists {
 		s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, "Creating User", "failed", "Lab not found")
-		return
+		return ErrLabNotFound
 	}
 
 	// Create setup context
@@ -213,21 +226,26 @@ func (s *Service) provisionPaletteTenantService(labID string, serviceConfig *mod
 		LabName:  lab.Name,
 		Duration: int(time.Until(lab.EndsAt).Minutes()),
 		OwnerID:  lab.OwnerID,
-		Context:  context.Background(),
+		Context:  ctx,
 		Lab:      lab,
 		AddCredential: func(credential *interfaces.Credential) error {
 			// Convert to models.Credential and add to lab
 			cred := models.Credential{
-				ID:        credential.ID,
-				LabID:     credential.LabID,
-				Label:     credential.Label,
-				Username:  credential.Username,
-				Password:  credential.Password,
-				URL:       credential.URL,
-				ExpiresAt: credential.ExpiresAt,
-				Notes:     credential.Notes,
-				CreatedAt: credential.CreatedAt,
-				UpdatedAt: credential.UpdatedAt,
+				ID:             credential.ID,
+				LabID:          credential.LabID,
+				Label:          credential.Label,
+				Username:       credential.Username,
+				Password:       credential.Password,
+				URL:            credential.URL,
+				ExpiresAt:      credential.ExpiresAt,
+				Notes:          credential.Notes,
+				CreatedAt:      credential.CreatedAt,
+				UpdatedAt:      credential.UpdatedAt,
+				ServiceID:      serviceConfig.ID,
+				CredentialType: credential.CredentialType,
+				OneTimeReveal:  credential.OneTimeReveal || oneTimeRevealConfigured(serviceConfig),
+				PublicKey:      credential.PublicKey,
+				PrivateKey:     credential.PrivateKey,
 			}
 
 			s.mu.Lock()
@@ -242,7 +260,7 @@ func (s *Service) provisionPaletteTenantService(labID string, serviceConfig *mod
 	}
 
 	// Execute the real setup - services will update their own progress
-	err := paletteTenantService.ExecuteSetup(setupCtx)
+	err := s.executeSetupWithTimeout(paletteTenantService, setupCtx, serviceConfig.Type)
 	if err != nil {
 		s.progressTracker.AddLog(labID, fmt.Sprintf("Palette Tenant setup failed: %v", err))
 		s.progressTracker.FailProgress(labID, fmt.Sprintf("Palette Tenant setup failed: %v", err))
@@ -250,18 +268,19 @@ func (s *Service) provisionPaletteTenantService(labID string, serviceConfig *mod
 		// Set lab status to error
 		s.mu.Lock()
 		if lab, exists := s.labs[labID]; exists {
-			lab.Status = models.LabStatusError
-			lab.UpdatedAt = time.Now()
+			s.setLabStatus(lab, models.LabStatusError)
 		}
 		s.mu.Unlock()
-		return
+		return err
 	}
 
 	s.progressTracker.AddLog(labID, "Palette Tenant service setup completed successfully")
+
+	return nil
 }
 
 // provisionTerraformCloudService provisions a Terraform Cloud service
-func (s *Service) provisionTerraformCloudService(labID string, serviceConfig *models.ServiceConfig) {
+func (s *Service) provisionTerraformCloudService(ctx context.Context, labID string, serviceConfig *models.ServiceConfig) error {
 	s.progressTracker.AddLog(labID, fmt.Sprintf("Service will use tf_cloud_host: %s", serviceConfig.Config["host"]))
 	s.progressTracker.AddLog(labID, fmt.Sprintf("Service will use tf_cloud_organization: %s", serviceConfig.Config["organization"]))
 
@@ -272,7 +291,7 @@ func (s *Service) provisionTerraformCloudService(labID string, serviceConfig *mo
 
 	if !exists {
 		s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, "Creating Workspace", "failed", "Lab not found")
-		return
+		return ErrLabNotFound
 	}
 
 	// Create setup context
@@ -281,21 +300,26 @@ func (s *Service) provisionTerraformCloudService(labID string, serviceConfig *mo
 		LabName:  lab.Name,
 		Duration: int(time.Until(lab.EndsAt).Minutes()),
 		OwnerID:  lab.OwnerID,
-		Context:  context.Background(),
+		Context:  ctx,
 		Lab:      lab,
 		AddCredential: func(credential *interfaces.Credential) error {
 			// Convert to models.Credential and add to lab
 			cred := models.Credential{
-				ID:        credential.ID,
-				LabID:     credential.LabID,
-				Label:     credential.Label,
-				Username:  credential.Username,
-				Password:  credential.Password,
-				URL:       credential.URL,
-				ExpiresAt: credential.ExpiresAt,
-				Notes:     credential.Notes,
-				CreatedAt: credential.CreatedAt,
-				UpdatedAt: credential.UpdatedAt,
+				ID:             credential.ID,
+				LabID:          credential.LabID,
+				Label:          credential.Label,
+				Username:       credential.Username,
+				Password:       credential.Password,
+				URL:            credential.URL,
+				ExpiresAt:      credential.ExpiresAt,
+				Notes:          credential.Notes,
+				CreatedAt:      credential.CreatedAt,
+				UpdatedAt:      credential.UpdatedAt,
+				ServiceID:      serviceConfig.ID,
+				CredentialType: credential.CredentialType,
+				OneTimeReveal:  credential.OneTimeReveal || oneTimeRevealConfigured(serviceConfig),
+				PublicKey:      credential.PublicKey,
+				PrivateKey:     credential.PrivateKey,
 			}
 
 			s.mu.Lock()
@@ -315,8 +339,11 @@ func (s *Service) provisionTerraformCloudService(labID string, serviceConfig *mo
 	// Configure the service from the service configuration
 	terraformCloudService.ConfigureFromServiceConfig(serviceConfig.Config, labID)
 
+	// Make template variables available to the Terraform configuration
+	terraformCloudService.SetTemplateVariables(lab.Variables)
+
 	// Execute the real setup - services will update their own progress
-	err := terraformCloudService.ExecuteSetup(setupCtx)
+	err := s.executeSetupWithTimeout(terraformCloudService, setupCtx, serviceConfig.Type)
 	if err != nil {
 		s.progressTracker.AddLog(labID, fmt.Sprintf("Terraform Cloud setup failed: %v", err))
 		s.progressTracker.FailProgress(labID, fmt.Sprintf("Terraform Cloud setup failed: %v", err))
@@ -324,18 +351,19 @@ func (s *Service) provisionTerraformCloudService(labID string, serviceConfig *mo
 		// Set lab status to error
 		s.mu.Lock()
 		if lab, exists := s.labs[labID]; exists {
-			lab.Status = models.LabStatusError
-			lab.UpdatedAt = time.Now()
+			s.setLabStatus(lab, models.LabStatusError)
 		}
 		s.mu.Unlock()
-		return
+		return err
 	}
 
 	s.progressTracker.AddLog(labID, fmt.Sprintf("Terraform Cloud setup completed for lab %s", lab.Name))
+
+	return nil
 }
 
 // provisionGuacamoleService provisions a Guacamole service using the real Guacamole service
-func (s *Service) provisionGuacamoleService(labID string, serviceConfig *models.ServiceConfig) {
+func (s *Service) provisionGuacamoleService(ctx context.Context, labID string, serviceConfig *models.ServiceConfig) error {
 	// Create Guacamole service instance
 	guacamoleService := services.NewGuacamoleService()
 
@@ -349,7 +377,7 @@ func (s *Service) provisionGuacamoleService(labID string, serviceConfig *models.
 
 	if !exists {
 		s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, "Creating User", "failed", "Lab not found")
-		return
+		return ErrLabNotFound
 	}
 
 	// Create setup context
@@ -358,21 +386,26 @@ func (s *Service) provisionGuacamoleService(labID string, serviceConfig *models.
 		LabName:  lab.Name,
 		Duration: int(time.Until(lab.EndsAt).Minutes()),
 		OwnerID:  lab.OwnerID,
-		Context:  context.Background(),
+		Context:  ctx,
 		Lab:      lab,
 		AddCredential: func(credential *interfaces.Credential) error {
 			// Convert to models.Credential and add to lab
 			cred := models.Credential{
-				ID:        credential.ID,
-				LabID:     credential.LabID,
-				Label:     credential.Label,
-				Username:  credential.Username,
-				Password:  credential.Password,
-				URL:       credential.URL,
-				ExpiresAt: credential.ExpiresAt,
-				Notes:     credential.Notes,
-				CreatedAt: credential.CreatedAt,
-				UpdatedAt: credential.UpdatedAt,
+				ID:             credential.ID,
+				LabID:          credential.LabID,
+				Label:          credential.Label,
+				Username:       credential.Username,
+				Password:       credential.Password,
+				URL:            credential.URL,
+				ExpiresAt:      credential.ExpiresAt,
+				Notes:          credential.Notes,
+				CreatedAt:      credential.CreatedAt,
+				UpdatedAt:      credential.UpdatedAt,
+				ServiceID:      serviceConfig.ID,
+				CredentialType: credential.CredentialType,
+				OneTimeReveal:  credential.OneTimeReveal || oneTimeRevealConfigured(serviceConfig),
+				PublicKey:      credential.PublicKey,
+				PrivateKey:     credential.PrivateKey,
 			}
 
 			s.mu.Lock()
@@ -387,7 +420,7 @@ func (s *Service) provisionGuacamoleService(labID string, serviceConfig *models.
 	}
 
 	// Execute the real setup - services will update their own progress
-	err := guacamoleService.ExecuteSetup(setupCtx)
+	err := s.executeSetupWithTimeout(guacamoleService, setupCtx, serviceConfig.Type)
 	if err != nil {
 		s.progressTracker.AddLog(labID, fmt.Sprintf("Guacamole setup failed: %v", err))
 		s.progressTracker.FailProgress(labID, fmt.Sprintf("Guacamole setup failed: %v", err))
@@ -395,12 +428,484 @@ func (s *Service) provisionGuacamoleService(labID string, serviceConfig *models.
 		// Set lab status to error
 		s.mu.Lock()
 		if lab, exists := s.labs[labID]; exists {
-			lab.Status = models.LabStatusError
-			lab.UpdatedAt = time.Now()
+			s.setLabStatus(lab, models.LabStatusError)
 		}
 		s.mu.Unlock()
-		return
+		return err
 	}
 
 	s.progressTracker.AddLog(labID, "Guacamole user created successfully")
+
+	return nil
+}
+
+// provisionVaultService provisions a Vault dynamic secret using the real Vault service
+func (s *Service) provisionVaultService(ctx context.Context, labID string, serviceConfig *models.ServiceConfig) error {
+	// Create Vault service instance
+	vaultService := services.NewVaultService()
+
+	// Configure the service from the service configuration
+	vaultService.ConfigureFromServiceConfig(serviceConfig.Config)
+
+	// Get lab for context
+	s.mu.Lock()
+	lab, exists := s.labs[labID]
+	s.mu.Unlock()
+
+	if !exists {
+		s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, "Issuing Secret", "failed", "Lab not found")
+		return ErrLabNotFound
+	}
+
+	// Create setup context
+	setupCtx := &interfaces.SetupContext{
+		LabID:    labID,
+		LabName:  lab.Name,
+		Duration: int(time.Until(lab.EndsAt).Minutes()),
+		OwnerID:  lab.OwnerID,
+		Context:  ctx,
+		Lab:      lab,
+		AddCredential: func(credential *interfaces.Credential) error {
+			// Convert to models.Credential and add to lab
+			cred := models.Credential{
+				ID:             credential.ID,
+				LabID:          credential.LabID,
+				Label:          credential.Label,
+				Username:       credential.Username,
+				Password:       credential.Password,
+				URL:            credential.URL,
+				ExpiresAt:      credential.ExpiresAt,
+				Notes:          credential.Notes,
+				CreatedAt:      credential.CreatedAt,
+				UpdatedAt:      credential.UpdatedAt,
+				ServiceID:      serviceConfig.ID,
+				CredentialType: credential.CredentialType,
+				OneTimeReveal:  credential.OneTimeReveal || oneTimeRevealConfigured(serviceConfig),
+				PublicKey:      credential.PublicKey,
+				PrivateKey:     credential.PrivateKey,
+			}
+
+			s.mu.Lock()
+			lab.Credentials = append(lab.Credentials, cred)
+			s.mu.Unlock()
+
+			return nil
+		},
+		UpdateProgress: func(stepName, status, message string) {
+			s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, stepName, status, message)
+		},
+	}
+
+	// Execute the real setup - services will update their own progress
+	err := s.executeSetupWithTimeout(vaultService, setupCtx, serviceConfig.Type)
+	if err != nil {
+		s.progressTracker.AddLog(labID, fmt.Sprintf("Vault setup failed: %v", err))
+		s.progressTracker.FailProgress(labID, fmt.Sprintf("Vault setup failed: %v", err))
+
+		// Set lab status to error
+		s.mu.Lock()
+		if lab, exists := s.labs[labID]; exists {
+			s.setLabStatus(lab, models.LabStatusError)
+		}
+		s.mu.Unlock()
+		return err
+	}
+
+	s.progressTracker.AddLog(labID, "Vault secret issued successfully")
+
+	return nil
+}
+
+// provisionAzureService provisions an Azure resource group using the real Azure service
+func (s *Service) provisionAzureService(ctx context.Context, labID string, serviceConfig *models.ServiceConfig) error {
+	// Create Azure service instance
+	azureService := services.NewAzureService()
+
+	// Configure the service from the service configuration
+	azureService.ConfigureFromServiceConfig(serviceConfig.Config)
+
+	// Get lab for context
+	s.mu.Lock()
+	lab, exists := s.labs[labID]
+	s.mu.Unlock()
+
+	if !exists {
+		s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, "Creating Resource Group", "failed", "Lab not found")
+		return ErrLabNotFound
+	}
+
+	// Create setup context
+	setupCtx := &interfaces.SetupContext{
+		LabID:    labID,
+		LabName:  lab.Name,
+		Duration: int(time.Until(lab.EndsAt).Minutes()),
+		OwnerID:  lab.OwnerID,
+		Context:  ctx,
+		Lab:      lab,
+		AddCredential: func(credential *interfaces.Credential) error {
+			// Convert to models.Credential and add to lab
+			cred := models.Credential{
+				ID:             credential.ID,
+				LabID:          credential.LabID,
+				Label:          credential.Label,
+				Username:       credential.Username,
+				Password:       credential.Password,
+				URL:            credential.URL,
+				ExpiresAt:      credential.ExpiresAt,
+				Notes:          credential.Notes,
+				CreatedAt:      credential.CreatedAt,
+				UpdatedAt:      credential.UpdatedAt,
+				ServiceID:      serviceConfig.ID,
+				CredentialType: credential.CredentialType,
+				OneTimeReveal:  credential.OneTimeReveal || oneTimeRevealConfigured(serviceConfig),
+				PublicKey:      credential.PublicKey,
+				PrivateKey:     credential.PrivateKey,
+			}
+
+			s.mu.Lock()
+			lab.Credentials = append(lab.Credentials, cred)
+			s.mu.Unlock()
+
+			return nil
+		},
+		UpdateProgress: func(stepName, status, message string) {
+			s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, stepName, status, message)
+		},
+	}
+
+	// Execute the real setup - services will update their own progress
+	err := s.executeSetupWithTimeout(azureService, setupCtx, serviceConfig.Type)
+	if err != nil {
+		s.progressTracker.AddLog(labID, fmt.Sprintf("Azure setup failed: %v", err))
+		s.progressTracker.FailProgress(labID, fmt.Sprintf("Azure setup failed: %v", err))
+
+		// Set lab status to error
+		s.mu.Lock()
+		if lab, exists := s.labs[labID]; exists {
+			s.setLabStatus(lab, models.LabStatusError)
+		}
+		s.mu.Unlock()
+		return err
+	}
+
+	s.progressTracker.AddLog(labID, "Azure resource group created successfully")
+
+	return nil
+}
+
+// provisionGCPService provisions a GCP project using the real GCP service
+func (s *Service) provisionGCPService(ctx context.Context, labID string, serviceConfig *models.ServiceConfig) error {
+	// Create GCP service instance
+	gcpService := services.NewGCPService()
+
+	// Configure the service from the service configuration
+	gcpService.ConfigureFromServiceConfig(serviceConfig.Config)
+
+	// Get lab for context
+	s.mu.Lock()
+	lab, exists := s.labs[labID]
+	s.mu.Unlock()
+
+	if !exists {
+		s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, "Creating Project", "failed", "Lab not found")
+		return ErrLabNotFound
+	}
+
+	// Create setup context
+	setupCtx := &interfaces.SetupContext{
+		LabID:    labID,
+		LabName:  lab.Name,
+		Duration: int(time.Until(lab.EndsAt).Minutes()),
+		OwnerID:  lab.OwnerID,
+		Context:  ctx,
+		Lab:      lab,
+		AddCredential: func(credential *interfaces.Credential) error {
+			// Convert to models.Credential and add to lab
+			cred := models.Credential{
+				ID:             credential.ID,
+				LabID:          credential.LabID,
+				Label:          credential.Label,
+				Username:       credential.Username,
+				Password:       credential.Password,
+				URL:            credential.URL,
+				ExpiresAt:      credential.ExpiresAt,
+				Notes:          credential.Notes,
+				CreatedAt:      credential.CreatedAt,
+				UpdatedAt:      credential.UpdatedAt,
+				ServiceID:      serviceConfig.ID,
+				CredentialType: credential.CredentialType,
+				OneTimeReveal:  credential.OneTimeReveal || oneTimeRevealConfigured(serviceConfig),
+				PublicKey:      credential.PublicKey,
+				PrivateKey:     credential.PrivateKey,
+			}
+
+			s.mu.Lock()
+			lab.Credentials = append(lab.Credentials, cred)
+			s.mu.Unlock()
+
+			return nil
+		},
+		UpdateProgress: func(stepName, status, message string) {
+			s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, stepName, status, message)
+		},
+	}
+
+	// Execute the real setup - services will update their own progress
+	err := s.executeSetupWithTimeout(gcpService, setupCtx, serviceConfig.Type)
+	if err != nil {
+		s.progressTracker.AddLog(labID, fmt.Sprintf("GCP setup failed: %v", err))
+		s.progressTracker.FailProgress(labID, fmt.Sprintf("GCP setup failed: %v", err))
+
+		// Set lab status to error
+		s.mu.Lock()
+		if lab, exists := s.labs[labID]; exists {
+			s.setLabStatus(lab, models.LabStatusError)
+		}
+		s.mu.Unlock()
+		return err
+	}
+
+	s.progressTracker.AddLog(labID, "GCP project created successfully")
+
+	return nil
+}
+
+// provisionSSHCommandService runs setup commands on a lab host using the real SSH command service
+func (s *Service) provisionSSHCommandService(ctx context.Context, labID string, serviceConfig *models.ServiceConfig) error {
+	// Create SSH command service instance
+	sshCommandService := services.NewSSHCommandService()
+
+	// Configure the service from the service configuration
+	sshCommandService.ConfigureFromServiceConfig(serviceConfig.Config)
+
+	// Get lab for context
+	s.mu.Lock()
+	lab, exists := s.labs[labID]
+	s.mu.Unlock()
+
+	if !exists {
+		s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, "Connecting to Host", "failed", "Lab not found")
+		return ErrLabNotFound
+	}
+
+	// Create setup context
+	setupCtx := &interfaces.SetupContext{
+		LabID:    labID,
+		LabName:  lab.Name,
+		Duration: int(time.Until(lab.EndsAt).Minutes()),
+		OwnerID:  lab.OwnerID,
+		Context:  ctx,
+		Lab:      lab,
+		AddCredential: func(credential *interfaces.Credential) error {
+			// Convert to models.Credential and add to lab
+			cred := models.Credential{
+				ID:             credential.ID,
+				LabID:          credential.LabID,
+				Label:          credential.Label,
+				Username:       credential.Username,
+				Password:       credential.Password,
+				URL:            credential.URL,
+				ExpiresAt:      credential.ExpiresAt,
+				Notes:          credential.Notes,
+				CreatedAt:      credential.CreatedAt,
+				UpdatedAt:      credential.UpdatedAt,
+				ServiceID:      serviceConfig.ID,
+				CredentialType: credential.CredentialType,
+				OneTimeReveal:  credential.OneTimeReveal || oneTimeRevealConfigured(serviceConfig),
+				PublicKey:      credential.PublicKey,
+				PrivateKey:     credential.PrivateKey,
+			}
+
+			s.mu.Lock()
+			lab.Credentials = append(lab.Credentials, cred)
+			s.mu.Unlock()
+
+			return nil
+		},
+		UpdateProgress: func(stepName, status, message string) {
+			s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, stepName, status, message)
+		},
+		AddLog: func(message string) {
+			s.progressTracker.AddLog(labID, message)
+		},
+	}
+
+	// Execute the real setup - services will update their own progress
+	err := s.executeSetupWithTimeout(sshCommandService, setupCtx, serviceConfig.Type)
+	if err != nil {
+		s.progressTracker.AddLog(labID, fmt.Sprintf("SSH command setup failed: %v", err))
+		s.progressTracker.FailProgress(labID, fmt.Sprintf("SSH command setup failed: %v", err))
+
+		// Set lab status to error
+		s.mu.Lock()
+		if lab, exists := s.labs[labID]; exists {
+			s.setLabStatus(lab, models.LabStatusError)
+		}
+		s.mu.Unlock()
+		return err
+	}
+
+	s.progressTracker.AddLog(labID, "SSH setup commands completed successfully")
+
+	return nil
+}
+
+// provisionHTTPService provisions resources through a generic HTTP callback
+func (s *Service) provisionHTTPService(ctx context.Context, labID string, serviceConfig *models.ServiceConfig) error {
+	// Create HTTP service instance
+	httpService := services.NewHTTPService()
+
+	// Configure the service from the service configuration
+	httpService.ConfigureFromServiceConfig(serviceConfig.Config)
+
+	// Get lab for context
+	s.mu.Lock()
+	lab, exists := s.labs[labID]
+	s.mu.Unlock()
+
+	if !exists {
+		s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, "Calling Setup Endpoint", "failed", "Lab not found")
+		return ErrLabNotFound
+	}
+
+	// Create setup context
+	setupCtx := &interfaces.SetupContext{
+		LabID:    labID,
+		LabName:  lab.Name,
+		Duration: int(time.Until(lab.EndsAt).Minutes()),
+		OwnerID:  lab.OwnerID,
+		Context:  ctx,
+		Lab:      lab,
+		AddCredential: func(credential *interfaces.Credential) error {
+			// Convert to models.Credential and add to lab
+			cred := models.Credential{
+				ID:             credential.ID,
+				LabID:          credential.LabID,
+				Label:          credential.Label,
+				Username:       credential.Username,
+				Password:       credential.Password,
+				URL:            credential.URL,
+				ExpiresAt:      credential.ExpiresAt,
+				Notes:          credential.Notes,
+				CreatedAt:      credential.CreatedAt,
+				UpdatedAt:      credential.UpdatedAt,
+				ServiceID:      serviceConfig.ID,
+				CredentialType: credential.CredentialType,
+				OneTimeReveal:  credential.OneTimeReveal || oneTimeRevealConfigured(serviceConfig),
+				PublicKey:      credential.PublicKey,
+				PrivateKey:     credential.PrivateKey,
+			}
+
+			s.mu.Lock()
+			lab.Credentials = append(lab.Credentials, cred)
+			s.mu.Unlock()
+
+			return nil
+		},
+		UpdateProgress: func(stepName, status, message string) {
+			s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, stepName, status, message)
+		},
+		AddLog: func(message string) {
+			s.progressTracker.AddLog(labID, message)
+		},
+	}
+
+	// Execute the real setup - services will update their own progress
+	err := s.executeSetupWithTimeout(httpService, setupCtx, serviceConfig.Type)
+	if err != nil {
+		s.progressTracker.AddLog(labID, fmt.Sprintf("HTTP service setup failed: %v", err))
+		s.progressTracker.FailProgress(labID, fmt.Sprintf("HTTP service setup failed: %v", err))
+
+		// Set lab status to error
+		s.mu.Lock()
+		if lab, exists := s.labs[labID]; exists {
+			s.setLabStatus(lab, models.LabStatusError)
+		}
+		s.mu.Unlock()
+		return err
+	}
+
+	s.progressTracker.AddLog(labID, "HTTP service setup completed successfully")
+
+	return nil
+}
+
+// provisionDockerService runs a dedicated container for the lab
+func (s *Service) provisionDockerService(ctx context.Context, labID string, serviceConfig *models.ServiceConfig) error {
+	// Create Docker service instance
+	dockerService := services.NewDockerService()
+
+	// Configure the service from the service configuration
+	dockerService.ConfigureFromServiceConfig(serviceConfig.Config)
+
+	// Get lab for context
+	s.mu.Lock()
+	lab, exists := s.labs[labID]
+	s.mu.Unlock()
+
+	if !exists {
+		s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, "Connecting to Docker", "failed", "Lab not found")
+		return ErrLabNotFound
+	}
+
+	// Create setup context
+	setupCtx := &interfaces.SetupContext{
+		LabID:    labID,
+		LabName:  lab.Name,
+		Duration: int(time.Until(lab.EndsAt).Minutes()),
+		OwnerID:  lab.OwnerID,
+		Context:  ctx,
+		Lab:      lab,
+		AddCredential: func(credential *interfaces.Credential) error {
+			// Convert to models.Credential and add to lab
+			cred := models.Credential{
+				ID:             credential.ID,
+				LabID:          credential.LabID,
+				Label:          credential.Label,
+				Username:       credential.Username,
+				Password:       credential.Password,
+				URL:            credential.URL,
+				ExpiresAt:      credential.ExpiresAt,
+				Notes:          credential.Notes,
+				CreatedAt:      credential.CreatedAt,
+				UpdatedAt:      credential.UpdatedAt,
+				ServiceID:      serviceConfig.ID,
+				CredentialType: credential.CredentialType,
+				OneTimeReveal:  credential.OneTimeReveal || oneTimeRevealConfigured(serviceConfig),
+				PublicKey:      credential.PublicKey,
+				PrivateKey:     credential.PrivateKey,
+			}
+
+			s.mu.Lock()
+			lab.Credentials = append(lab.Credentials, cred)
+			s.mu.Unlock()
+
+			return nil
+		},
+		UpdateProgress: func(stepName, status, message string) {
+			s.progressTracker.UpdateServiceStep(labID, serviceConfig.Name, stepName, status, message)
+		},
+		AddLog: func(message string) {
+			s.progressTracker.AddLog(labID, message)
+		},
+	}
+
+	// Execute the real setup - services will update their own progress
+	err := s.executeSetupWithTimeout(dockerService, setupCtx, serviceConfig.Type)
+	if err != nil {
+		s.progressTracker.AddLog(labID, fmt.Sprintf("Docker service setup failed: %v", err))
+		s.progressTracker.FailProgress(labID, fmt.Sprintf("Docker service setup failed: %v", err))
+
+		// Set lab status to error
+		s.mu.Lock()
+		if lab, exists := s.labs[labID]; exists {
+			s.setLabStatus(lab, models.LabStatusError)
+		}
+		s.mu.Unlock()
+		return err
+	}
+
+	s.progressTracker.AddLog(labID, "Docker service setup completed successfully")
+
+	return nil
 }
@@ -0,0 +1,114 @@
+package lab
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// ShareLab grants a user access to a lab, replacing any access they already had
+func (s *Service) ShareLab(labID, userID string, accessLevel models.LabAccessLevel, sharedBy string) (*models.LabShare, error) {
+	if accessLevel == "" {
+		accessLevel = models.LabAccessObserver
+	}
+	if accessLevel != models.LabAccessObserver {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAccessLevel, accessLevel)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.labs[labID]; !exists {
+		return nil, ErrLabNotFound
+	}
+
+	share := &models.LabShare{
+		LabID:       labID,
+		UserID:      userID,
+		AccessLevel: accessLevel,
+		SharedBy:    sharedBy,
+		CreatedAt:   time.Now(),
+	}
+
+	if s.shares[labID] == nil {
+		s.shares[labID] = make(map[string]*models.LabShare)
+	}
+	s.shares[labID][userID] = share
+
+	fmt.Printf("Lab %s shared with user %s as %s by %s\n", labID, userID, accessLevel, sharedBy)
+	return share, nil
+}
+
+// UnshareLab revokes a user's access to a lab
+func (s *Service) UnshareLab(labID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.labs[labID]; !exists {
+		return ErrLabNotFound
+	}
+	if _, exists := s.shares[labID][userID]; !exists {
+		return ErrLabShareNotFound
+	}
+
+	delete(s.shares[labID], userID)
+	if len(s.shares[labID]) == 0 {
+		delete(s.shares, labID)
+	}
+
+	fmt.Printf("Lab %s no longer shared with user %s\n", labID, userID)
+	return nil
+}
+
+// GetLabShares returns the users a lab is shared with, oldest share first
+func (s *Service) GetLabShares(labID string) ([]*models.LabShare, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, exists := s.labs[labID]; !exists {
+		return nil, ErrLabNotFound
+	}
+
+	shares := make([]*models.LabShare, 0, len(s.shares[labID]))
+	for _, share := range s.shares[labID] {
+		shares = append(shares, share)
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		return shares[i].CreatedAt.Before(shares[j].CreatedAt)
+	})
+	return shares, nil
+}
+
+// GetLabAccessLevel returns the access a lab has been shared with a user at, if any
+func (s *Service) GetLabAccessLevel(labID, userID string) (models.LabAccessLevel, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	share, exists := s.shares[labID][userID]
+	if !exists {
+		return "", false
+	}
+	return share.AccessLevel, true
+}
+
+// GetLabsSharedWith returns the labs shared with a user
+func (s *Service) GetLabsSharedWith(userID string) []*models.Lab {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	labs := make([]*models.Lab, 0)
+	for labID, shares := range s.shares {
+		if _, shared := shares[userID]; !shared {
+			continue
+		}
+		if lab, exists := s.labs[labID]; exists {
+			labs = append(labs, lab)
+		}
+	}
+	sort.Slice(labs, func(i, j int) bool {
+		return labs[i].CreatedAt.After(labs[j].CreatedAt)
+	})
+	return labs
+}
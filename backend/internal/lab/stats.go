@@ -0,0 +1,53 @@
+package lab
+
+import (
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// LabStats aggregates lab activity for a set of owners
+type LabStats struct {
+	Total          int
+	Active         int            // Provisioning or ready
+	ByTemplate     map[string]int // Keyed by template ID
+	ByTag          map[string]int // Labs carrying each tag
+	ActiveServices map[string]int // Active labs per service config ID
+	EstimatedCost  float64        // Estimated spend to date across all counted labs
+}
+
+// GetLabStats counts labs owned by any of the given users in a single pass, without copying them
+func (s *Service) GetLabStats(ownerIDs map[string]bool) LabStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := LabStats{
+		ByTemplate:     make(map[string]int),
+		ByTag:          make(map[string]int),
+		ActiveServices: make(map[string]int),
+	}
+
+	now := time.Now()
+	for _, lab := range s.labs {
+		if !ownerIDs[lab.OwnerID] {
+			continue
+		}
+
+		stats.Total++
+		stats.EstimatedCost += s.estimateLabCost(lab, now).CostToDate
+		stats.ByTemplate[lab.TemplateID]++
+		for _, tag := range lab.Tags {
+			stats.ByTag[tag]++
+		}
+
+		if lab.Status == models.LabStatusProvisioning || lab.Status == models.LabStatusQueued || lab.Status == models.LabStatusReady {
+			stats.Active++
+			for _, serviceID := range lab.UsedServices {
+				stats.ActiveServices[serviceID]++
+			}
+		}
+	}
+
+	stats.EstimatedCost = roundCost(stats.EstimatedCost)
+	return stats
+}
@@ -0,0 +1,83 @@
+package lab
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+const (
+	// MaxLabTags is the most tags a lab can carry
+	MaxLabTags = 20
+	// MaxLabTagLength is the longest tag accepted
+	MaxLabTagLength = 64
+)
+
+// ErrInvalidLabTags is returned for tags that are too long, too many or use unsupported characters
+var ErrInvalidLabTags = errors.New("invalid lab tags")
+
+// labTagPattern matches tags after lower-casing. Key/value labels are written as key:value, e.g. event:march-workshop.
+var labTagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._:/-]*$`)
+
+// normalizeLabTags trims and lower-cases tags, drops empty and repeated ones and checks the rest,
+// so tags compare the same way when labs are filtered and counted
+func normalizeLabTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > MaxLabTagLength {
+			return nil, fmt.Errorf("%w: %q is longer than %d characters", ErrInvalidLabTags, tag, MaxLabTagLength)
+		}
+		if !labTagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("%w: %q may only use letters, digits and . _ : / -", ErrInvalidLabTags, tag)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > MaxLabTags {
+		return nil, fmt.Errorf("%w: a lab can have at most %d tags", ErrInvalidLabTags, MaxLabTags)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// SetLabTags replaces a lab's tags
+func (s *Service) SetLabTags(labID string, tags []string) (*models.Lab, error) {
+	tags, err := normalizeLabTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lab, exists := s.labs[labID]
+	if !exists {
+		return nil, ErrLabNotFound
+	}
+
+	lab.Tags = tags
+	lab.UpdatedAt = time.Now()
+	lab.Version++
+	return lab, nil
+}
+
+// CountLabsByTag counts the labs carrying each tag. Labs without tags are not counted.
+func CountLabsByTag(labs []*models.Lab) map[string]int {
+	counts := make(map[string]int)
+	for _, lab := range labs {
+		for _, tag := range lab.Tags {
+			counts[tag]++
+		}
+	}
+	return counts
+}
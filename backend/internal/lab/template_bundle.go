@@ -0,0 +1,182 @@
+package lab
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	ErrTemplateNotFound      = errors.New("template not found")
+	ErrTemplateExists        = errors.New("template already exists")
+	ErrInvalidTemplateBundle = errors.New("invalid template bundle")
+)
+
+// templateIDPattern restricts imported template IDs to names that are safe to use as file names
+var templateIDPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+// ExportTemplateBundle returns a template together with the shapes of the service configs it references.
+// Secret config values are left out so bundles can be shared and stored safely.
+func (s *Service) ExportTemplateBundle(templateID string) (*models.TemplateBundle, error) {
+	template, exists := s.templateManager.GetTemplate(templateID)
+	if !exists {
+		return nil, ErrTemplateNotFound
+	}
+
+	bundle := &models.TemplateBundle{
+		FormatVersion:  models.TemplateBundleFormatVersion,
+		ExportedAt:     time.Now(),
+		Template:       template,
+		ServiceConfigs: []models.ServiceConfigShape{},
+	}
+
+	seen := make(map[string]bool)
+	for _, serviceRef := range template.Services {
+		if seen[serviceRef.ServiceID] {
+			continue
+		}
+		seen[serviceRef.ServiceID] = true
+
+		serviceConfig, exists := s.serviceConfigManager.GetServiceConfig(serviceRef.ServiceID)
+		if !exists {
+			fmt.Printf("ExportTemplateBundle: template %s references unknown service config %s\n", templateID, serviceRef.ServiceID)
+			continue
+		}
+		bundle.ServiceConfigs = append(bundle.ServiceConfigs, serviceConfigShape(serviceConfig))
+	}
+
+	return bundle, nil
+}
+
+// serviceConfigShape copies a service config without its secret values
+func serviceConfigShape(serviceConfig *models.ServiceConfig) models.ServiceConfigShape {
+	shape := models.ServiceConfigShape{
+		ID:          serviceConfig.ID,
+		Name:        serviceConfig.Name,
+		Type:        serviceConfig.Type,
+		Description: serviceConfig.Description,
+		Config:      make(map[string]string),
+	}
+
+	for key, value := range serviceConfig.Config {
+		if isSensitiveServiceDataKey(key) {
+			shape.SecretKeys = append(shape.SecretKeys, key)
+			continue
+		}
+		shape.Config[key] = value
+	}
+	sort.Strings(shape.SecretKeys)
+
+	return shape
+}
+
+// ImportTemplateBundle validates a bundle, loads its template and writes it to the templates directory
+// so it survives a restart. A template with the same ID or name is only replaced when overwrite is set.
+// Every service config the template references must already exist here with the same type; bundles
+// carry no secrets, so service configs are never created by an import.
+func (s *Service) ImportTemplateBundle(bundle *models.TemplateBundle, overwrite bool) (*models.LabTemplate, error) {
+	if bundle.Template == nil {
+		return nil, fmt.Errorf("%w: template is required", ErrInvalidTemplateBundle)
+	}
+	if bundle.FormatVersion > models.TemplateBundleFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalidTemplateBundle, bundle.FormatVersion)
+	}
+
+	template := *bundle.Template
+	template.SourceFile = ""
+	if template.CreatedAt.IsZero() {
+		template.CreatedAt = time.Now()
+	}
+	normalizeTemplateLabels(&template)
+
+	if err := s.templateLoader.validateTemplate(&template); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplateBundle, err)
+	}
+	if !templateIDPattern.MatchString(template.ID) {
+		return nil, fmt.Errorf("%w: template ID may only contain letters, digits, '-' and '_'", ErrInvalidTemplateBundle)
+	}
+
+	if err := s.checkBundleServiceConfigs(&template, bundle.ServiceConfigs); err != nil {
+		return nil, err
+	}
+
+	existing, exists := s.templateManager.GetTemplate(template.ID)
+	if named, found := s.templateManager.GetTemplateByName(template.Name); found && named.ID != template.ID {
+		return nil, fmt.Errorf("%w: template %s already uses the name %q", ErrTemplateExists, named.ID, template.Name)
+	}
+	if exists && !overwrite {
+		return nil, fmt.Errorf("%w: %s (set overwrite to replace it)", ErrTemplateExists, template.ID)
+	}
+
+	if exists && existing.SourceFile != "" {
+		template.SourceFile = existing.SourceFile
+	}
+	if err := s.persistTemplate(&template); err != nil {
+		return nil, err
+	}
+
+	s.templateManager.AddTemplate(&template)
+	s.templateManager.EnrichTemplatesWithServiceTypes(s.serviceConfigManager)
+
+	fmt.Printf("ImportTemplateBundle: imported template %s (%s), overwrite=%v\n", template.ID, template.Name, exists)
+	return &template, nil
+}
+
+// checkBundleServiceConfigs verifies that each service config the template references exists and,
+// when the bundle describes it, has the type the template was built against
+func (s *Service) checkBundleServiceConfigs(template *models.LabTemplate, shapes []models.ServiceConfigShape) error {
+	shapeTypes := make(map[string]string, len(shapes))
+	for _, shape := range shapes {
+		shapeTypes[shape.ID] = shape.Type
+	}
+
+	var problems []string
+	for _, serviceRef := range template.Services {
+		serviceConfig, exists := s.serviceConfigManager.GetServiceConfig(serviceRef.ServiceID)
+		if !exists {
+			problems = append(problems, fmt.Sprintf("service config %s does not exist", serviceRef.ServiceID))
+			continue
+		}
+		if expected := shapeTypes[serviceRef.ServiceID]; expected != "" && expected != serviceConfig.Type {
+			problems = append(problems, fmt.Sprintf("service config %s is %s, bundle expects %s", serviceRef.ServiceID, serviceConfig.Type, expected))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidTemplateBundle, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// persistTemplate writes a template to its YAML file, defaulting to <id>.yaml in the templates directory
+func (s *Service) persistTemplate(template *models.LabTemplate) error {
+	if template.SourceFile == "" {
+		if s.templatesDir == "" {
+			return fmt.Errorf("no templates directory configured")
+		}
+		if err := os.MkdirAll(s.templatesDir, 0755); err != nil {
+			return fmt.Errorf("failed to create templates directory: %w", err)
+		}
+		template.SourceFile = filepath.Join(s.templatesDir, template.ID+".yaml")
+	}
+
+	data, err := yaml.Marshal(template)
+	if err != nil {
+		return fmt.Errorf("failed to marshal template %s: %w", template.ID, err)
+	}
+
+	if err := ioutil.WriteFile(template.SourceFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write template %s: %w", template.SourceFile, err)
+	}
+	return nil
+}
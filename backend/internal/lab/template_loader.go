@@ -14,23 +14,28 @@ import (
 
 // TemplateLoader loads lab templates from YAML files
 type TemplateLoader struct {
-	templateManager *models.LabTemplateManager
+	templateManager      *models.LabTemplateManager
+	serviceConfigManager *models.ServiceConfigManager // Resolves the service configs templates reference
 }
 
-// NewTemplateLoader creates a new template loader
-func NewTemplateLoader(templateManager *models.LabTemplateManager) *TemplateLoader {
+// NewTemplateLoader creates a new template loader. Templates are only accepted when every service
+// config they reference exists in serviceConfigManager.
+func NewTemplateLoader(templateManager *models.LabTemplateManager, serviceConfigManager *models.ServiceConfigManager) *TemplateLoader {
 	return &TemplateLoader{
-		templateManager: templateManager,
+		templateManager:      templateManager,
+		serviceConfigManager: serviceConfigManager,
 	}
 }
 
-// LoadTemplatesFromDirectory loads all lab templates from a directory
+// LoadTemplatesFromDirectory loads all lab templates from a directory. A template that fails to load
+// is skipped so the others are still available; the failures are returned together.
 func (tl *TemplateLoader) LoadTemplatesFromDirectory(dirPath string) error {
 	files, err := ioutil.ReadDir(dirPath)
 	if err != nil {
 		return fmt.Errorf("failed to read directory %s: %w", dirPath, err)
 	}
 
+	var failures []string
 	for _, file := range files {
 		if file.IsDir() || !strings.HasSuffix(file.Name(), ".yaml") && !strings.HasSuffix(file.Name(), ".yml") {
 			continue
@@ -38,10 +43,14 @@ func (tl *TemplateLoader) LoadTemplatesFromDirectory(dirPath string) error {
 
 		filePath := filepath.Join(dirPath, file.Name())
 		if err := tl.LoadTemplateFromFile(filePath); err != nil {
-			return fmt.Errorf("failed to load template from %s: %w", filePath, err)
+			fmt.Printf("Warning: Skipping template %s: %v\n", filePath, err)
+			failures = append(failures, fmt.Sprintf("%s: %v", filePath, err))
 		}
 	}
 
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to load %d template(s): %s", len(failures), strings.Join(failures, "; "))
+	}
 	return nil
 }
 
@@ -62,10 +71,13 @@ func (tl *TemplateLoader) LoadTemplateFromFile(filePath string) error {
 		template.CreatedAt = time.Now()
 	}
 
+	normalizeTemplateLabels(&template)
+
 	// Validate template
 	if err := tl.validateTemplate(&template); err != nil {
 		return fmt.Errorf("invalid template in %s: %w", filePath, err)
 	}
+	template.SourceFile = filePath
 
 	tl.templateManager.AddTemplate(&template)
 	return nil
@@ -83,6 +95,8 @@ func (tl *TemplateLoader) LoadTemplateFromString(yamlData string) error {
 		template.CreatedAt = time.Now()
 	}
 
+	normalizeTemplateLabels(&template)
+
 	// Validate template
 	if err := tl.validateTemplate(&template); err != nil {
 		return fmt.Errorf("invalid template: %w", err)
@@ -92,6 +106,24 @@ func (tl *TemplateLoader) LoadTemplateFromString(yamlData string) error {
 	return nil
 }
 
+// normalizeTemplateLabels trims the category and lowercases, trims and de-duplicates tags so
+// filtering and facets are not split by spelling variations
+func normalizeTemplateLabels(template *models.LabTemplate) {
+	template.Category = strings.TrimSpace(template.Category)
+
+	seen := make(map[string]bool, len(template.Tags))
+	tags := make([]string, 0, len(template.Tags))
+	for _, tag := range template.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	template.Tags = tags
+}
+
 // validateTemplate validates a lab template
 func (tl *TemplateLoader) validateTemplate(template *models.LabTemplate) error {
 	if template.Name == "" {
@@ -102,13 +134,26 @@ func (tl *TemplateLoader) validateTemplate(template *models.LabTemplate) error {
 		return fmt.Errorf("template ID is required")
 	}
 
-	if template.ExpirationDuration == "" {
-		return fmt.Errorf("expiration duration is required")
+	if template.ExpirationDuration == "" && template.DefaultDurationMinutes == 0 {
+		return fmt.Errorf("expiration duration or default duration is required")
 	}
 
 	// Validate expiration duration format
-	if _, err := time.ParseDuration(template.ExpirationDuration); err != nil {
-		return fmt.Errorf("invalid expiration duration format: %s", template.ExpirationDuration)
+	if template.ExpirationDuration != "" {
+		if _, err := time.ParseDuration(template.ExpirationDuration); err != nil {
+			return fmt.Errorf("invalid expiration duration format: %s", template.ExpirationDuration)
+		}
+	}
+
+	// Validate duration limits
+	if template.DefaultDurationMinutes < 0 || template.MaxDurationMinutes < 0 {
+		return fmt.Errorf("default and max durations must not be negative")
+	}
+	if template.MaxDurationMinutes > 0 && template.MaxDurationMinutes < MinLabDurationMinutes {
+		return fmt.Errorf("max duration must be at least %d minutes", MinLabDurationMinutes)
+	}
+	if template.DefaultDurationMinutes > 0 && template.DefaultDurationMinutes > maxTemplateDurationMinutes(template) {
+		return fmt.Errorf("default duration of %d minutes exceeds the max duration of %d minutes", template.DefaultDurationMinutes, maxTemplateDurationMinutes(template))
 	}
 
 	// Validate services
@@ -120,13 +165,104 @@ func (tl *TemplateLoader) validateTemplate(template *models.LabTemplate) error {
 		if service.ServiceID == "" {
 			return fmt.Errorf("service %d service_id is required", i)
 		}
+
+		if len(service.InlineConfig) > 0 {
+			return fmt.Errorf("service %s embeds config; move it to service config %s and reference it with service_id only", service.Name, service.ServiceID)
+		}
+
+		config, exists := tl.serviceConfigManager.GetServiceConfig(service.ServiceID)
+		if !exists {
+			return fmt.Errorf("service %s references unknown service config %s", service.Name, service.ServiceID)
+		}
+		if !isSupportedServiceType(config.Type) {
+			return fmt.Errorf("service %s references service config %s of unsupported type %q", service.Name, service.ServiceID, config.Type)
+		}
+	}
+
+	if err := validateServiceDependencies(template.Services); err != nil {
+		return err
+	}
+
+	// Validate variables
+	seen := make(map[string]bool)
+	for i, variable := range template.Variables {
+		if variable.Name == "" {
+			return fmt.Errorf("variable %d name is required", i)
+		}
+
+		if seen[variable.Name] {
+			return fmt.Errorf("duplicate variable name: %s", variable.Name)
+		}
+		seen[variable.Name] = true
+
+		switch variable.Type {
+		case "", models.TemplateVariableTypeString, models.TemplateVariableTypeNumber, models.TemplateVariableTypeBoolean:
+		default:
+			return fmt.Errorf("variable %s has unsupported type: %s", variable.Name, variable.Type)
+		}
+
+		if variable.Default != "" {
+			if err := variable.Validate(variable.Default); err != nil {
+				return fmt.Errorf("invalid default: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateServiceDependencies checks that depends_on only names other services of the template
+// and that the dependencies contain no cycles
+func validateServiceDependencies(services []models.ServiceReference) error {
+	dependencies := make(map[string][]string, len(services))
+	for _, service := range services {
+		if _, exists := dependencies[service.Name]; exists && len(service.DependsOn) > 0 {
+			return fmt.Errorf("service %s has dependencies but its name is not unique", service.Name)
+		}
+		dependencies[service.Name] = append(dependencies[service.Name], service.DependsOn...)
+	}
+
+	for _, service := range services {
+		for _, dependency := range service.DependsOn {
+			if dependency == service.Name {
+				return fmt.Errorf("service %s depends on itself", service.Name)
+			}
+			if _, exists := dependencies[dependency]; !exists {
+				return fmt.Errorf("service %s depends on unknown service %s", service.Name, dependency)
+			}
+		}
+	}
+
+	// Depth-first search for cycles: 1 = on the current path, 2 = fully explored
+	state := make(map[string]int, len(dependencies))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("service dependency cycle involving %s", name)
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, dependency := range dependencies[name] {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		return nil
+	}
+	for _, service := range services {
+		if err := visit(service.Name); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
 // CreateLabFromTemplate creates a lab instance from a template
-func (tl *TemplateLoader) CreateLabFromTemplate(templateID, ownerID string) (*models.Lab, error) {
+func (tl *TemplateLoader) CreateLabFromTemplate(templateID, ownerID string, durationMinutes int, variables map[string]string) (*models.Lab, error) {
 	fmt.Printf("TemplateLoader.CreateLabFromTemplate: Starting for template %s, owner %s\n", templateID, ownerID)
 
 	template, exists := tl.templateManager.GetTemplate(templateID)
@@ -136,13 +272,20 @@ func (tl *TemplateLoader) CreateLabFromTemplate(templateID, ownerID string) (*mo
 	}
 	fmt.Printf("TemplateLoader.CreateLabFromTemplate: Found template %s with %d services\n", templateID, len(template.Services))
 
-	// Parse duration
-	duration, err := time.ParseDuration(template.ExpirationDuration)
+	// Resolve duration
+	duration, err := templateDuration(template, durationMinutes)
+	if err != nil {
+		fmt.Printf("TemplateLoader.CreateLabFromTemplate: Invalid duration: %v\n", err)
+		return nil, err
+	}
+	fmt.Printf("TemplateLoader.CreateLabFromTemplate: Resolved duration: %v\n", duration)
+
+	// Validate user-supplied variables against the template schema
+	resolvedVariables, err := template.ResolveVariables(variables)
 	if err != nil {
-		fmt.Printf("TemplateLoader.CreateLabFromTemplate: Invalid duration %s: %v\n", template.ExpirationDuration, err)
-		return nil, fmt.Errorf("invalid duration in template: %w", err)
+		fmt.Printf("TemplateLoader.CreateLabFromTemplate: Invalid variables: %v\n", err)
+		return nil, err
 	}
-	fmt.Printf("TemplateLoader.CreateLabFromTemplate: Parsed duration: %v\n", duration)
 
 	// Create lab
 	now := time.Now()
@@ -155,7 +298,7 @@ func (tl *TemplateLoader) CreateLabFromTemplate(templateID, ownerID string) (*mo
 	}
 
 	labID := models.GenerateID()
-	labName := fmt.Sprintf("lab-%s", labID)
+	labName := defaultLabName(template.Name, labID)
 
 	fmt.Printf("TemplateLoader.CreateLabFromTemplate: Generated lab ID: %s, name: %s\n", labID, labName)
 
@@ -171,8 +314,39 @@ func (tl *TemplateLoader) CreateLabFromTemplate(templateID, ownerID string) (*mo
 		Credentials:  []models.Credential{},
 		TemplateID:   templateID,
 		UsedServices: usedServices,
+		Variables:    resolvedVariables,
+		Version:      1,
 	}
 
 	fmt.Printf("TemplateLoader.CreateLabFromTemplate: Lab created successfully with %d used services\n", len(usedServices))
 	return lab, nil
 }
+
+// maxTemplateDurationMinutes returns the longest duration a lab from the template can request
+func maxTemplateDurationMinutes(template *models.LabTemplate) int {
+	if template.MaxDurationMinutes > 0 {
+		return template.MaxDurationMinutes
+	}
+	return MaxLabDurationMinutes
+}
+
+// templateDuration returns how long a lab from the template runs. A requested duration of zero uses
+// the template's default; otherwise it must lie between the global minimum and the template's max.
+func templateDuration(template *models.LabTemplate, requestedMinutes int) (time.Duration, error) {
+	if requestedMinutes == 0 {
+		if template.DefaultDurationMinutes > 0 {
+			return time.Duration(template.DefaultDurationMinutes) * time.Minute, nil
+		}
+		duration, err := time.ParseDuration(template.ExpirationDuration)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration in template: %w", err)
+		}
+		return duration, nil
+	}
+
+	maxMinutes := maxTemplateDurationMinutes(template)
+	if requestedMinutes < MinLabDurationMinutes || requestedMinutes > maxMinutes {
+		return 0, fmt.Errorf("%w: must be between %d and %d minutes for this template", ErrInvalidDuration, MinLabDurationMinutes, maxMinutes)
+	}
+	return time.Duration(requestedMinutes) * time.Minute, nil
+}
@@ -0,0 +1,81 @@
+package lab
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+	"github.com/wcrum/labby/internal/models"
+	"github.com/wcrum/labby/internal/services"
+)
+
+// GetTerraformConfiguration renders the Terraform configuration uploaded for a lab's Terraform Cloud
+// services again from their service configs and the lab's variables, with sensitive values redacted.
+// Files are keyed by path, under a directory per service config when the lab uses more than one.
+// Configuration files changed since the lab was set up are rendered as they are now.
+func (s *Service) GetTerraformConfiguration(labID string) (map[string]string, error) {
+	s.mu.RLock()
+	lab, exists := s.labs[labID]
+	var labCopy models.Lab
+	if exists {
+		labCopy = *lab
+		labCopy.UsedServices = append([]string(nil), lab.UsedServices...)
+		labCopy.Credentials = append([]models.Credential(nil), lab.Credentials...)
+		labCopy.ServiceData = make(map[string]string, len(lab.ServiceData))
+		for key, value := range lab.ServiceData {
+			labCopy.ServiceData[key] = value
+		}
+		labCopy.Variables = make(map[string]string, len(lab.Variables))
+		for key, value := range lab.Variables {
+			labCopy.Variables[key] = value
+		}
+	}
+	s.mu.RUnlock()
+
+	if !exists {
+		return nil, ErrLabNotFound
+	}
+
+	var serviceConfigs []*models.ServiceConfig
+	for _, serviceID := range labCopy.UsedServices {
+		serviceConfig, exists := s.serviceConfigManager.ResolveServiceConfig(serviceID, labCopy.OrganizationID)
+		if exists && serviceConfig.Type == "terraform_cloud" {
+			serviceConfigs = append(serviceConfigs, serviceConfig)
+		}
+	}
+	if len(serviceConfigs) == 0 {
+		return nil, ErrNoTerraformService
+	}
+
+	setupCtx := &interfaces.SetupContext{
+		LabID:    labCopy.ID,
+		LabName:  labCopy.Name,
+		Duration: int(time.Until(labCopy.EndsAt).Minutes()),
+		OwnerID:  labCopy.OwnerID,
+		Lab:      &labCopy,
+	}
+
+	files := make(map[string]string)
+	for _, serviceConfig := range serviceConfigs {
+		serviceConfig, err := resolveServiceConfigSecrets(serviceConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		terraformCloudService := services.NewTerraformCloudService()
+		terraformCloudService.ConfigureForRender(serviceConfig.Config, &labCopy)
+		rendered, err := terraformCloudService.RenderConfiguration(setupCtx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render configuration of %s: %w", serviceConfig.ID, err)
+		}
+
+		for path, content := range rendered {
+			if len(serviceConfigs) > 1 {
+				path = serviceConfig.ID + "/" + path
+			}
+			files[path] = content
+		}
+	}
+
+	return files, nil
+}
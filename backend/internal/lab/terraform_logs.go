@@ -0,0 +1,69 @@
+package lab
+
+import (
+	"fmt"
+
+	"github.com/wcrum/labby/internal/services"
+)
+
+// TerraformRunLogs holds the log locations for a lab's Terraform Cloud run
+type TerraformRunLogs struct {
+	RunID       string
+	PlanLogURL  string
+	ApplyLogURL string
+}
+
+// GetTerraformRunLogs resolves the plan and apply log URLs for the Terraform run stored on a lab
+func (s *Service) GetTerraformRunLogs(labID string) (*TerraformRunLogs, error) {
+	s.mu.RLock()
+	lab, exists := s.labs[labID]
+	var runID string
+	var usedServices []string
+	var organizationID string
+	if exists {
+		runID = lab.ServiceData["terraform_cloud_run_id"]
+		usedServices = append(usedServices, lab.UsedServices...)
+		organizationID = lab.OrganizationID
+	}
+	s.mu.RUnlock()
+
+	if !exists {
+		return nil, ErrLabNotFound
+	}
+	if runID == "" {
+		return nil, ErrNoTerraformRun
+	}
+
+	// Find the Terraform Cloud service config used by this lab for API credentials
+	for _, serviceID := range usedServices {
+		serviceConfig, exists := s.serviceConfigManager.ResolveServiceConfig(serviceID, organizationID)
+		if !exists || serviceConfig.Type != "terraform_cloud" {
+			continue
+		}
+		serviceConfig, err := resolveServiceConfigSecrets(serviceConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only pass connection settings so templated variables (e.g. VLAN tags) are not allocated
+		terraformCloudService := services.NewTerraformCloudService()
+		terraformCloudService.ConfigureFromServiceConfig(map[string]string{
+			"host":         serviceConfig.Config["host"],
+			"api_token":    serviceConfig.Config["api_token"],
+			"organization": serviceConfig.Config["organization"],
+		}, labID)
+
+		planLogURL, applyLogURL, err := terraformCloudService.GetRunLogURLs(runID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get run logs for %s: %w", runID, err)
+		}
+
+		return &TerraformRunLogs{
+			RunID:       runID,
+			PlanLogURL:  planLogURL,
+			ApplyLogURL: applyLogURL,
+		}, nil
+	}
+
+	return nil, ErrNoTerraformRun
+}
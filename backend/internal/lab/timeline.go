@@ -0,0 +1,133 @@
+package lab
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+const (
+	// MaxTimelineEvents is how many events are kept per lab, older ones are dropped first
+	MaxTimelineEvents = 1000
+	// TimelineRetention is how long the timeline of a removed lab is kept after its last event
+	TimelineRetention = 7 * 24 * time.Hour
+	// timelinePruneInterval is how often timelines past their retention are looked for
+	timelinePruneInterval = time.Hour
+)
+
+// labTimeline is the event history of one lab
+type labTimeline struct {
+	ownerID string
+	removed bool
+	events  []models.LabTimelineEvent
+}
+
+// labTimelineStore keeps the progress log entries and status transitions of labs after their progress
+// is gone, and for TimelineRetention after the lab itself is removed. It is only locked on its own,
+// so it can be written to while holding s.mu or the progress tracker's locks.
+type labTimelineStore struct {
+	timelines map[string]*labTimeline
+	sequence  int64
+	lastPrune time.Time
+	mu        sync.Mutex
+}
+
+// newLabTimelineStore creates an empty timeline store
+func newLabTimelineStore() *labTimelineStore {
+	return &labTimelineStore{
+		timelines: make(map[string]*labTimeline),
+		lastPrune: time.Now(),
+	}
+}
+
+// record appends an event to a lab's timeline. An owner ID, when given, is remembered so the timeline
+// can be authorized after the lab is removed.
+func (t *labTimelineStore) record(labID, ownerID string, event models.LabTimelineEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if event.Timestamp.Sub(t.lastPrune) >= timelinePruneInterval {
+		t.pruneLocked(event.Timestamp)
+	}
+
+	timeline, exists := t.timelines[labID]
+	if !exists {
+		timeline = &labTimeline{}
+		t.timelines[labID] = timeline
+	}
+	if ownerID != "" {
+		timeline.ownerID = ownerID
+	}
+	if event.Type == models.LabTimelineDeleted {
+		timeline.removed = true
+	}
+
+	t.sequence++
+	event.Sequence = t.sequence
+	timeline.events = append(timeline.events, event)
+	if len(timeline.events) > MaxTimelineEvents {
+		timeline.events = timeline.events[len(timeline.events)-MaxTimelineEvents:]
+	}
+}
+
+// pruneLocked forgets the timelines of removed labs whose last event is older than TimelineRetention.
+// The caller must hold t.mu.
+func (t *labTimelineStore) pruneLocked(now time.Time) {
+	t.lastPrune = now
+	for labID, timeline := range t.timelines {
+		last := timeline.events[len(timeline.events)-1].Timestamp
+		if timeline.removed && now.Sub(last) > TimelineRetention {
+			delete(t.timelines, labID)
+		}
+	}
+}
+
+// get returns a copy of a lab's timeline and its owner
+func (t *labTimelineStore) get(labID string) ([]models.LabTimelineEvent, string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timeline, exists := t.timelines[labID]
+	if !exists {
+		return nil, "", false
+	}
+	return append([]models.LabTimelineEvent(nil), timeline.events...), timeline.ownerID, true
+}
+
+// LabTimeline is the ordered event history of a lab
+type LabTimeline struct {
+	LabID   string                    `json:"lab_id"`
+	OwnerID string                    `json:"owner_id"`
+	Events  []models.LabTimelineEvent `json:"events"`
+}
+
+// GetLabTimeline returns the recorded events of a lab, oldest first. The timeline outlives the lab's
+// progress and, for TimelineRetention, the lab itself.
+func (s *Service) GetLabTimeline(labID string) (*LabTimeline, error) {
+	events, ownerID, exists := s.timeline.get(labID)
+	if !exists {
+		return nil, ErrLabNotFound
+	}
+	return &LabTimeline{LabID: labID, OwnerID: ownerID, Events: events}, nil
+}
+
+// recordLabLog adds a progress log entry to a lab's timeline
+func (s *Service) recordLabLog(labID, message string) {
+	s.timeline.record(labID, "", models.LabTimelineEvent{
+		Type:      models.LabTimelineLog,
+		Message:   message,
+		Timestamp: time.Now(),
+	})
+}
+
+// recordLabTimelineEvent adds a lifecycle event of a lab to its timeline. The caller must hold s.mu.
+func (s *Service) recordLabTimelineEvent(lab *models.Lab, eventType models.LabTimelineEventType, previous models.LabStatus, message string) {
+	s.timeline.record(lab.ID, lab.OwnerID, models.LabTimelineEvent{
+		Type:           eventType,
+		Message:        message,
+		Status:         lab.Status,
+		PreviousStatus: previous,
+		Timestamp:      time.Now(),
+	})
+}
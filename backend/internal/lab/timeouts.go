@@ -0,0 +1,142 @@
+package lab
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+	"github.com/wcrum/labby/internal/models"
+)
+
+// DefaultServiceSetupTimeout bounds how long a single service may spend setting up a lab
+const DefaultServiceSetupTimeout = 10 * time.Minute
+
+// ServiceSetupTimeouts controls how long each service type may take to set up before the lab is failed
+type ServiceSetupTimeouts struct {
+	Default time.Duration            // Applies to service types without their own timeout
+	PerType map[string]time.Duration // Keyed by service type, e.g. "proxmox_user"
+}
+
+// DefaultServiceSetupTimeouts returns the default service setup timeouts
+func DefaultServiceSetupTimeouts() ServiceSetupTimeouts {
+	return ServiceSetupTimeouts{
+		Default: DefaultServiceSetupTimeout,
+		PerType: make(map[string]time.Duration),
+	}
+}
+
+// ParseServiceSetupTimeouts parses per-type timeouts in the form "proxmox_user=20m,terraform_cloud=30m"
+func ParseServiceSetupTimeouts(value string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		serviceType, durationValue, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid entry %q, expected type=duration", entry)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(durationValue))
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout for %s: %q", serviceType, durationValue)
+		}
+		timeouts[strings.TrimSpace(serviceType)] = timeout
+	}
+	return timeouts, nil
+}
+
+// SetServiceSetupTimeouts sets the setup timeouts used for labs provisioned from now on
+func (s *Service) SetServiceSetupTimeouts(timeouts ServiceSetupTimeouts) {
+	if timeouts.Default <= 0 {
+		timeouts.Default = DefaultServiceSetupTimeout
+	}
+	s.setupTimeouts = timeouts
+}
+
+// serviceSetupTimeout returns the setup timeout for a service type
+func (s *Service) serviceSetupTimeout(serviceType string) time.Duration {
+	if timeout, ok := s.setupTimeouts.PerType[serviceType]; ok && timeout > 0 {
+		return timeout
+	}
+	return s.setupTimeouts.Default
+}
+
+// executeSetupWithTimeout runs a service's setup with a deadline on its context. Service clients that honor
+// the context abort their in-flight requests; for any that don't, provisioning stops waiting at the deadline
+// so the lab never stays stuck in provisioning. On timeout the lab's services are cleaned up.
+func (s *Service) executeSetupWithTimeout(service interfaces.Setup, setupCtx *interfaces.SetupContext, serviceType string) error {
+	timeout := s.serviceSetupTimeout(serviceType)
+
+	ctx, cancel := context.WithTimeout(setupCtx.Context, timeout)
+	defer cancel()
+	setupCtx.Context = ctx
+
+	// Services of a lab can run concurrently, so each writes its ServiceData to a private copy of
+	// the lab that is merged back once its setup returns
+	sharedLab := setupCtx.Lab
+	if sharedLab != nil {
+		setupCtx.Lab = s.isolatedLabCopy(sharedLab)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		setupErr := service.ExecuteSetup(setupCtx)
+		if sharedLab != nil {
+			s.mergeServiceData(sharedLab, setupCtx.Lab.ServiceData)
+		}
+		done <- setupErr
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+		if err == nil || ctx.Err() != context.DeadlineExceeded {
+			return err
+		}
+		err = fmt.Errorf("%w after %v: %v", ErrServiceSetupTimeout, timeout, err)
+	case <-ctx.Done():
+		err = fmt.Errorf("%w after %v", ErrServiceSetupTimeout, timeout)
+	}
+
+	fmt.Printf("Lab %s: %s setup timed out after %v, cleaning up\n", setupCtx.LabID, serviceType, timeout)
+	s.progressTracker.AddLog(setupCtx.LabID, fmt.Sprintf("%s setup timed out after %v, cleaning up lab resources", service.Name(), timeout))
+
+	labID := setupCtx.LabID
+	go func() {
+		if cleanupErr := s.cleanupLabServices(labID); cleanupErr != nil {
+			fmt.Printf("Lab %s: cleanup after setup timeout failed: %v\n", labID, cleanupErr)
+		}
+	}()
+
+	return err
+}
+
+// isolatedLabCopy returns a copy of a lab with its own ServiceData map for a single service's setup
+func (s *Service) isolatedLabCopy(lab *models.Lab) *models.Lab {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	labCopy := *lab
+	labCopy.ServiceData = make(map[string]string, len(lab.ServiceData))
+	for key, value := range lab.ServiceData {
+		labCopy.ServiceData[key] = value
+	}
+	return &labCopy
+}
+
+// mergeServiceData copies the ServiceData a service recorded during setup back onto the shared lab
+func (s *Service) mergeServiceData(lab *models.Lab, serviceData map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lab.ServiceData == nil {
+		lab.ServiceData = make(map[string]string, len(serviceData))
+	}
+	for key, value := range serviceData {
+		lab.ServiceData[key] = value
+	}
+}
@@ -0,0 +1,178 @@
+package lab
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// Service usage is counted from the labs in memory each time it is needed rather than kept in counters,
+// so it can't drift from the labs that actually exist. Limit checks count usage and add the new lab
+// under the same lock, so labs created at the same time can't both take the last slot of a service.
+
+// labHoldsService reports whether a lab counts against a service's limit. Labs waiting for or running
+// provisioning hold a slot, and so do running and stopped labs, which keep their resources until their
+// grace period ends. Failed and expired labs hold it for as long as they still have resources recorded
+// for the service that haven't been cleaned up. The caller must hold s.mu.
+func (s *Service) labHoldsService(lab *models.Lab, serviceID string) bool {
+	switch lab.Status {
+	case models.LabStatusQueued, models.LabStatusProvisioning, models.LabStatusReady, models.LabStatusStopped:
+		return true
+	case models.LabStatusError, models.LabStatusExpired:
+		return s.labHasServiceResources(lab, serviceID)
+	default:
+		return false
+	}
+}
+
+// labHasServiceResources reports whether a lab has ServiceData recorded for a service whose cleanup
+// hasn't completed yet. The caller must hold s.mu.
+func (s *Service) labHasServiceResources(lab *models.Lab, serviceID string) bool {
+	if state, exists := lab.CleanupState[serviceID]; exists && state.Status == models.CleanupStatusCompleted {
+		return false
+	}
+
+	config, exists := s.serviceConfigManager.ResolveServiceConfig(serviceID, lab.OrganizationID)
+	if !exists {
+		return false
+	}
+	service, ok := s.serviceManager.GetServiceByType(config.Type)
+	if !ok {
+		return false
+	}
+
+	prefixes := service.ServiceDataKeys()
+	for key := range lab.ServiceData {
+		if _, ok := trimServiceDataPrefix(key, prefixes); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getServiceUsage returns the current number of labs holding a specific service
+func (s *Service) getServiceUsage(serviceID string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.serviceUsageLocked(serviceID)
+}
+
+// serviceUsageLocked counts the labs holding a service. The caller must hold s.mu.
+func (s *Service) serviceUsageLocked(serviceID string) int {
+	count := 0
+	for _, lab := range s.labs {
+		if labUsesService(lab, serviceID) && s.labHoldsService(lab, serviceID) {
+			count++
+		}
+	}
+	return count
+}
+
+// serviceUsageCountsLocked counts the labs holding each service in a single pass. The caller must hold s.mu.
+func (s *Service) serviceUsageCountsLocked() map[string]int {
+	counts := make(map[string]int)
+	for _, lab := range s.labs {
+		for _, serviceID := range lab.UsedServices {
+			if s.labHoldsService(lab, serviceID) {
+				counts[serviceID]++
+			}
+		}
+	}
+	return counts
+}
+
+// labUsesService reports whether a service is one of a lab's used services
+func labUsesService(lab *models.Lab, serviceID string) bool {
+	for _, usedService := range lab.UsedServices {
+		if usedService == serviceID {
+			return true
+		}
+	}
+	return false
+}
+
+// GetServiceUsage returns usage information for all services, counted from a single snapshot of the labs
+func (s *Service) GetServiceUsage() []*models.ServiceUsage {
+	usage := make([]*models.ServiceUsage, 0)
+
+	// Get all service configs
+	configs := s.serviceConfigManager.GetAllServiceConfigs()
+
+	s.mu.RLock()
+	counts := s.serviceUsageCountsLocked()
+	s.mu.RUnlock()
+
+	for _, config := range configs {
+		usageInfo := s.serviceConfigManager.GetServiceUsage(config.ID, counts[config.ID])
+		usage = append(usage, usageInfo)
+	}
+
+	return usage
+}
+
+// checkTemplateServices checks that every service of a template is available and within its usage limit.
+// Scheduled labs only need the services to exist now, their limits are checked when they start.
+func (s *Service) checkTemplateServices(template *models.LabTemplate, scheduled bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.checkTemplateServicesLocked(template, scheduled)
+}
+
+// checkTemplateServicesLocked is checkTemplateServices for callers that hold s.mu, so the new lab can be
+// added before anyone else counts the usage
+func (s *Service) checkTemplateServicesLocked(template *models.LabTemplate, scheduled bool) error {
+	for _, serviceRef := range template.Services {
+		fmt.Printf("checkTemplateServices: Checking service %s (ID: %s)\n", serviceRef.Name, serviceRef.ServiceID)
+
+		// Get current usage for this service
+		currentUsage := 0
+		if !scheduled {
+			currentUsage = s.serviceUsageLocked(serviceRef.ServiceID)
+		}
+		fmt.Printf("checkTemplateServices: Service %s current usage: %d\n", serviceRef.ServiceID, currentUsage)
+
+		// Check if service is available and within limits
+		if err := s.serviceConfigManager.CheckServiceAvailability(serviceRef.ServiceID, currentUsage); err != nil {
+			fmt.Printf("checkTemplateServices: Service %s availability check failed: %v\n", serviceRef.ServiceID, err)
+			return serviceAvailabilityError(serviceRef.Name, serviceRef.ServiceID, err)
+		}
+		fmt.Printf("checkTemplateServices: Service %s availability check passed\n", serviceRef.ServiceID)
+	}
+	return nil
+}
+
+// checkRetryServicesLocked checks the limits of the services a failed lab no longer holds, since
+// retrying provisioning takes a slot of each of them again. The caller must hold s.mu.
+func (s *Service) checkRetryServicesLocked(lab *models.Lab) error {
+	for _, serviceID := range lab.UsedServices {
+		if s.labHoldsService(lab, serviceID) {
+			continue
+		}
+		// Services of inactive configs are skipped when the lab is provisioned again
+		if config, exists := s.serviceConfigManager.ResolveServiceConfig(serviceID, lab.OrganizationID); exists && !config.IsActive {
+			continue
+		}
+		if err := s.serviceConfigManager.CheckServiceAvailability(serviceID, s.serviceUsageLocked(serviceID)); err != nil {
+			name := serviceID
+			if config, exists := s.serviceConfigManager.ResolveServiceConfig(serviceID, lab.OrganizationID); exists {
+				name = config.Name
+			}
+			return serviceAvailabilityError(name, serviceID, err)
+		}
+	}
+	return nil
+}
+
+// serviceAvailabilityError wraps a failed availability check as an API error naming the service
+func serviceAvailabilityError(name, serviceID string, err error) error {
+	code := models.CodeServiceNotAvailable
+	if errors.Is(err, models.ErrServiceLimitExceeded) {
+		code = models.CodeServiceLimitReached
+	}
+	return models.NewAPIError(code, fmt.Sprintf("service %s (%s) not available: %v", name, serviceID, err), err).
+		WithDetail("service_id", serviceID).
+		WithDetail("service", name)
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// TokenScope is an action a personal access token is allowed to perform
+type TokenScope string
+
+const (
+	TokenScopeReadLab   TokenScope = "read-lab"   // List labs and read their status, progress and credentials
+	TokenScopeCreateLab TokenScope = "create-lab" // Create labs, directly or from a template
+	TokenScopeDeleteLab TokenScope = "delete-lab" // Stop and delete labs
+)
+
+// ValidTokenScopes lists every scope a personal access token can be granted
+var ValidTokenScopes = []TokenScope{TokenScopeReadLab, TokenScopeCreateLab, TokenScopeDeleteLab}
+
+// IsValid reports whether the scope is known
+func (s TokenScope) IsValid() bool {
+	for _, scope := range ValidTokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// PersonalAccessToken lets machine clients such as CI act as a user for a limited set of actions.
+// Only a hash of the token is stored; the token itself is shown once when it is created.
+type PersonalAccessToken struct {
+	ID         string       `json:"id"`
+	UserID     string       `json:"user_id"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"` // Start of the token, to tell tokens apart
+	TokenHash  string       `json:"-"`
+	Scopes     []TokenScope `json:"scopes"`
+	ExpiresAt  *time.Time   `json:"expires_at,omitempty"` // Nil means the token does not expire
+	LastUsedAt *time.Time   `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// HasScope reports whether the token was granted a scope
+func (t *PersonalAccessToken) HasScope(scope TokenScope) bool {
+	for _, granted := range t.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired reports whether the token has passed its expiry
+func (t *PersonalAccessToken) IsExpired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
+
+// CreatePersonalAccessTokenRequest represents a request to create a personal access token
+type CreatePersonalAccessTokenRequest struct {
+	Name          string       `json:"name" binding:"required"`
+	Scopes        []TokenScope `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int          `json:"expires_in_days,omitempty" binding:"omitempty,min=1,max=365"` // Omit for a token that does not expire
+}
+
+// CreatePersonalAccessTokenResponse returns a new token. Token is only ever returned here.
+type CreatePersonalAccessTokenResponse struct {
+	Token string `json:"token"`
+	PersonalAccessToken
+}
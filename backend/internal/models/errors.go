@@ -0,0 +1,114 @@
+package models
+
+import "errors"
+
+// ErrorCode is a stable, machine-readable identifier of an API error. Clients should match on codes,
+// messages are meant for people and may change.
+type ErrorCode string
+
+// Generic error codes, used when nothing more specific is known about a failure
+const (
+	CodeInvalidRequest     ErrorCode = "INVALID_REQUEST"
+	CodeUnauthorized       ErrorCode = "UNAUTHORIZED"
+	CodeForbidden          ErrorCode = "FORBIDDEN"
+	CodeNotFound           ErrorCode = "NOT_FOUND"
+	CodeConflict           ErrorCode = "CONFLICT"
+	CodeGone               ErrorCode = "GONE"
+	CodeValidationFailed   ErrorCode = "VALIDATION_FAILED"
+	CodeRateLimited        ErrorCode = "RATE_LIMITED"
+	CodeInternal           ErrorCode = "INTERNAL_ERROR"
+	CodeUpstreamError      ErrorCode = "UPSTREAM_ERROR"
+	CodeServiceUnavailable ErrorCode = "SERVICE_UNAVAILABLE"
+)
+
+// Error codes of specific failures
+const (
+	CodeInvalidToken              ErrorCode = "INVALID_TOKEN"
+	CodeLabNotFound               ErrorCode = "LAB_NOT_FOUND"
+	CodeLabExpired                ErrorCode = "LAB_EXPIRED"
+	CodeLabNotReady               ErrorCode = "LAB_NOT_READY"
+	CodeLabNotStopped             ErrorCode = "LAB_NOT_STOPPED"
+	CodeLabNotScheduled           ErrorCode = "LAB_NOT_SCHEDULED"
+	CodeLabNotRetryable           ErrorCode = "LAB_NOT_RETRYABLE"
+	CodeLabNameTaken              ErrorCode = "LAB_NAME_TAKEN"
+	CodeInvalidLabName            ErrorCode = "INVALID_LAB_NAME"
+	CodeInvalidLabTags            ErrorCode = "INVALID_LAB_TAGS"
+	CodeInvalidDuration           ErrorCode = "INVALID_DURATION"
+	CodeLabLifetimeExceeded       ErrorCode = "LAB_LIFETIME_EXCEEDED"
+	CodeInvalidStartTime          ErrorCode = "INVALID_START_TIME"
+	CodeInvalidNotification       ErrorCode = "INVALID_NOTIFICATION"
+	CodeCleanupInProgress         ErrorCode = "CLEANUP_IN_PROGRESS"
+	CodeNoFailedCleanup           ErrorCode = "NO_FAILED_CLEANUP"
+	CodeNoTerraformRun            ErrorCode = "NO_TERRAFORM_RUN"
+	CodeNoTerraformService        ErrorCode = "NO_TERRAFORM_SERVICE"
+	CodeLabShareNotFound          ErrorCode = "LAB_SHARE_NOT_FOUND"
+	CodeTemplateNotFound          ErrorCode = "TEMPLATE_NOT_FOUND"
+	CodeTemplateExists            ErrorCode = "TEMPLATE_EXISTS"
+	CodeTemplateInvalid           ErrorCode = "TEMPLATE_INVALID"
+	CodeInvalidTemplateVariables  ErrorCode = "INVALID_TEMPLATE_VARIABLES"
+	CodeServiceConfigNotFound     ErrorCode = "SERVICE_CONFIG_NOT_FOUND"
+	CodeServiceLimitNotFound      ErrorCode = "SERVICE_LIMIT_NOT_FOUND"
+	CodeServiceNotAvailable       ErrorCode = "SERVICE_NOT_AVAILABLE"
+	CodeServiceLimitReached       ErrorCode = "SERVICE_LIMIT_REACHED"
+	CodeVersionConflict           ErrorCode = "VERSION_CONFLICT"
+	CodeVersionRequired           ErrorCode = "VERSION_REQUIRED"
+	CodeCredentialNotFound        ErrorCode = "CREDENTIAL_NOT_FOUND"
+	CodeRotationUnsupported       ErrorCode = "ROTATION_UNSUPPORTED"
+	CodeCredentialRevealed        ErrorCode = "CREDENTIAL_ALREADY_REVEALED"
+	CodeRegistrationTokenNotFound ErrorCode = "REGISTRATION_TOKEN_NOT_FOUND"
+	CodeUserNotFound              ErrorCode = "USER_NOT_FOUND"
+	CodeEmailTaken                ErrorCode = "EMAIL_TAKEN"
+	CodeOrganizationNotFound      ErrorCode = "ORGANIZATION_NOT_FOUND"
+	CodeInvalidOrganization       ErrorCode = "INVALID_ORGANIZATION"
+	CodeAccessTokenNotFound       ErrorCode = "ACCESS_TOKEN_NOT_FOUND"
+	CodeInvalidTokenScope         ErrorCode = "INVALID_TOKEN_SCOPE"
+	CodeInviteNotFound            ErrorCode = "INVITE_NOT_FOUND"
+	CodeInviteNotRenewable        ErrorCode = "INVITE_NOT_RENEWABLE"
+	CodeImpersonationNotAllowed   ErrorCode = "IMPERSONATION_NOT_ALLOWED"
+	CodeInvalidServiceConfig      ErrorCode = "INVALID_SERVICE_CONFIG"
+)
+
+// APIError is an error with a code that is reported to API clients as {"error": {"code", "message", "details"}}.
+// Services return it, wrapping the underlying error, when a failure has details clients can act on.
+type APIError struct {
+	Code    ErrorCode              `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	Err     error                  `json:"-"` // Underlying error, for errors.Is and errors.As
+}
+
+// NewAPIError creates an API error wrapping err, whose message is used when message is empty
+func NewAPIError(code ErrorCode, message string, err error) *APIError {
+	if message == "" && err != nil {
+		message = err.Error()
+	}
+	return &APIError{Code: code, Message: message, Err: err}
+}
+
+// WithDetail adds a detail clients can use, such as the ID of the resource that caused the error
+func (e *APIError) WithDetail(key string, value interface{}) *APIError {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// Error returns the error's message
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the underlying error
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// AsAPIError returns the APIError in err's chain, if there is one
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
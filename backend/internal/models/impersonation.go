@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// ImpersonationAuditAction is what an impersonation audit entry records
+type ImpersonationAuditAction string
+
+const (
+	ImpersonationAuditIssued  ImpersonationAuditAction = "issued"  // An admin was issued an impersonation token
+	ImpersonationAuditRequest ImpersonationAuditAction = "request" // A request was made with an impersonation token
+	ImpersonationAuditDenied  ImpersonationAuditAction = "denied"  // A request was refused because it was made with an impersonation token
+)
+
+// ImpersonationAuditEntry records one step of an admin acting as another user, so support sessions
+// leave a trail of who saw what
+type ImpersonationAuditEntry struct {
+	ID                string                   `json:"id"`
+	Action            ImpersonationAuditAction `json:"action"`
+	TokenID           string                   `json:"token_id"`
+	ImpersonatorID    string                   `json:"impersonator_id"`
+	ImpersonatorEmail string                   `json:"impersonator_email"`
+	UserID            string                   `json:"user_id"`
+	UserEmail         string                   `json:"user_email"`
+	Reason            string                   `json:"reason,omitempty"`
+	Method            string                   `json:"method,omitempty"`
+	Path              string                   `json:"path,omitempty"`
+	Status            int                      `json:"status,omitempty"`
+	Timestamp         time.Time                `json:"timestamp"`
+}
+
+// ImpersonateUserRequest represents a request to impersonate a user
+type ImpersonateUserRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"` // Why support needs to act as the user, kept in the audit log
+}
+
+// ImpersonationResponse returns an impersonation token and who it acts as
+type ImpersonationResponse struct {
+	Token          string    `json:"token"`
+	TokenID        string    `json:"token_id"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	User           User      `json:"user"`
+	ImpersonatorID string    `json:"impersonator_id"`
+}
@@ -1,40 +1,157 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// ErrInvalidTemplateVariables is returned when user-supplied template variables fail validation
+var ErrInvalidTemplateVariables = errors.New("invalid template variables")
+
+// Template variable types
+const (
+	TemplateVariableTypeString  = "string"
+	TemplateVariableTypeNumber  = "number"
+	TemplateVariableTypeBoolean = "boolean"
+)
+
 // LabTemplate represents a lab template definition
 type LabTemplate struct {
-	Name               string             `yaml:"name" json:"name"`
-	ID                 string             `yaml:"id" json:"id"`
-	Description        string             `yaml:"description" json:"description"`
-	ExpirationDuration string             `yaml:"expiration_duration" json:"expiration_duration"`
-	Owner              string             `yaml:"owner" json:"owner"`
-	CreatedAt          time.Time          `yaml:"created_at" json:"created_at"`
-	Services           []ServiceReference `yaml:"services" json:"services"`
+	Name                   string             `yaml:"name" json:"name"`
+	ID                     string             `yaml:"id" json:"id"`
+	Description            string             `yaml:"description" json:"description"`
+	Category               string             `yaml:"category" json:"category,omitempty"`
+	Tags                   []string           `yaml:"tags" json:"tags,omitempty"`
+	ExpirationDuration     string             `yaml:"expiration_duration" json:"expiration_duration"`
+	DefaultDurationMinutes int                `yaml:"default_duration_minutes" json:"default_duration_minutes,omitempty"` // Used when no duration is requested, overrides ExpirationDuration
+	MaxDurationMinutes     int                `yaml:"max_duration_minutes" json:"max_duration_minutes,omitempty"`         // Longest duration a lab can request, replaces the global maximum
+	Owner                  string             `yaml:"owner" json:"owner"`
+	CreatedAt              time.Time          `yaml:"created_at" json:"created_at"`
+	Services               []ServiceReference `yaml:"services" json:"services"`
+	Variables              []TemplateVariable `yaml:"variables" json:"variables,omitempty"`
+	SourceFile             string             `yaml:"-" json:"-"` // YAML file the template was loaded from, if any
+}
+
+// TemplateVariable describes an input collected from the user when launching a lab from a template
+type TemplateVariable struct {
+	Name          string   `yaml:"name" json:"name"`
+	Description   string   `yaml:"description" json:"description,omitempty"`
+	Type          string   `yaml:"type" json:"type"` // string, number or boolean (defaults to string)
+	Default       string   `yaml:"default" json:"default,omitempty"`
+	Required      bool     `yaml:"required" json:"required"`
+	AllowedValues []string `yaml:"allowed_values" json:"allowed_values,omitempty"`
+}
+
+// Validate checks that a value satisfies the variable's type and allowed values
+func (tv *TemplateVariable) Validate(value string) error {
+	switch tv.Type {
+	case "", TemplateVariableTypeString:
+	case TemplateVariableTypeNumber:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("variable %s must be a number", tv.Name)
+		}
+	case TemplateVariableTypeBoolean:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("variable %s must be a boolean", tv.Name)
+		}
+	default:
+		return fmt.Errorf("variable %s has unsupported type: %s", tv.Name, tv.Type)
+	}
+
+	if len(tv.AllowedValues) > 0 {
+		for _, allowed := range tv.AllowedValues {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("variable %s must be one of %v", tv.Name, tv.AllowedValues)
+	}
+
+	return nil
+}
+
+// ResolveVariables validates user-supplied values against the template schema and fills in defaults
+func (lt *LabTemplate) ResolveVariables(values map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(lt.Variables))
+	known := make(map[string]bool, len(lt.Variables))
+
+	for i := range lt.Variables {
+		variable := &lt.Variables[i]
+		known[variable.Name] = true
+
+		value, provided := values[variable.Name]
+		if !provided || value == "" {
+			if variable.Required && variable.Default == "" {
+				return nil, fmt.Errorf("%w: variable %s is required", ErrInvalidTemplateVariables, variable.Name)
+			}
+			value = variable.Default
+		}
+		if value == "" {
+			continue
+		}
+
+		if err := variable.Validate(value); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidTemplateVariables, err)
+		}
+		resolved[variable.Name] = value
+	}
+
+	for name := range values {
+		if !known[name] {
+			return nil, fmt.Errorf("%w: unknown variable %s", ErrInvalidTemplateVariables, name)
+		}
+	}
+
+	return resolved, nil
 }
 
 // ServiceReference represents a reference to a preconfigured service
 type ServiceReference struct {
-	Name        string `yaml:"name" json:"name"`
-	ServiceID   string `yaml:"service_id" json:"service_id"` // Reference to ServiceConfig
-	Description string `yaml:"description" json:"description"`
-	Type        string `yaml:"type" json:"type,omitempty"` // Service type (enriched from ServiceConfig)
-	Logo        string `yaml:"logo" json:"logo,omitempty"` // Service logo (enriched from ServiceConfig)
+	Name        string   `yaml:"name" json:"name"`
+	ServiceID   string   `yaml:"service_id" json:"service_id"` // Reference to ServiceConfig
+	Description string   `yaml:"description" json:"description"`
+	Type        string   `yaml:"type" json:"type,omitempty"`                   // Service type (enriched from ServiceConfig)
+	Logo        string   `yaml:"logo" json:"logo,omitempty"`                   // Service logo (enriched from ServiceConfig)
+	DependsOn   []string `yaml:"depends_on" json:"depends_on,omitempty"`       // Names of services in the template that must finish first
+	CostPerHour *float64 `yaml:"cost_per_hour" json:"cost_per_hour,omitempty"` // Overrides the service config's cost_per_hour for this template
+
+	// InlineConfig catches config embedded in older templates. Settings now live only in the referenced
+	// ServiceConfig, so templates that still carry a copy are rejected rather than silently ignored.
+	InlineConfig map[string]string `yaml:"config,omitempty" json:"-"`
 }
 
-// ServiceTemplate represents a service configuration in a lab template (legacy, kept for backward compatibility)
-type ServiceTemplate struct {
-	Name        string            `yaml:"name" json:"name"`
-	Type        string            `yaml:"type" json:"type"`
-	Description string            `yaml:"description" json:"description"`
-	Config      map[string]string `yaml:"config" json:"config"`
+// TemplateBundleFormatVersion is the version written into exported template bundles
+const TemplateBundleFormatVersion = 1
+
+// TemplateBundle is a self-contained export of a lab template for moving it between environments
+type TemplateBundle struct {
+	FormatVersion  int                  `json:"format_version"`
+	ExportedAt     time.Time            `json:"exported_at"`
+	Template       *LabTemplate         `json:"template" binding:"required"`
+	ServiceConfigs []ServiceConfigShape `json:"service_configs"`
+}
+
+// ServiceConfigShape describes a service config a bundled template references, without its secrets.
+// Imports use it to check that the target environment has a compatible service config.
+type ServiceConfigShape struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Type        string            `json:"type"`
+	Description string            `json:"description,omitempty"`
+	Config      map[string]string `json:"config"`                // Non-secret settings
+	SecretKeys  []string          `json:"secret_keys,omitempty"` // Keys whose values were left out
 }
 
 // LabTemplateManager manages lab templates
 type LabTemplateManager struct {
 	templates map[string]*LabTemplate
+	onChange  []func() // Called after templates change
+	mu        sync.RWMutex
 }
 
 // NewLabTemplateManager creates a new lab template manager
@@ -44,19 +161,45 @@ func NewLabTemplateManager() *LabTemplateManager {
 	}
 }
 
+// OnChange registers a function called whenever templates are added or updated,
+// e.g. to invalidate cached responses
+func (ltm *LabTemplateManager) OnChange(hook func()) {
+	ltm.mu.Lock()
+	defer ltm.mu.Unlock()
+	ltm.onChange = append(ltm.onChange, hook)
+}
+
+// notifyChange calls the registered change hooks. It must be called without ltm.mu held.
+func (ltm *LabTemplateManager) notifyChange() {
+	ltm.mu.RLock()
+	hooks := ltm.onChange
+	ltm.mu.RUnlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
 // AddTemplate adds a lab template
 func (ltm *LabTemplateManager) AddTemplate(template *LabTemplate) {
+	defer ltm.notifyChange()
+	ltm.mu.Lock()
+	defer ltm.mu.Unlock()
 	ltm.templates[template.ID] = template
 }
 
 // GetTemplate retrieves a lab template by ID
 func (ltm *LabTemplateManager) GetTemplate(id string) (*LabTemplate, bool) {
+	ltm.mu.RLock()
+	defer ltm.mu.RUnlock()
 	template, exists := ltm.templates[id]
 	return template, exists
 }
 
 // GetAllTemplates returns all lab templates
 func (ltm *LabTemplateManager) GetAllTemplates() []*LabTemplate {
+	ltm.mu.RLock()
+	defer ltm.mu.RUnlock()
 	templates := make([]*LabTemplate, 0, len(ltm.templates))
 	for _, template := range ltm.templates {
 		templates = append(templates, template)
@@ -64,8 +207,113 @@ func (ltm *LabTemplateManager) GetAllTemplates() []*LabTemplate {
 	return templates
 }
 
+// GetTemplateByName retrieves a lab template by its display name, case-insensitively
+func (ltm *LabTemplateManager) GetTemplateByName(name string) (*LabTemplate, bool) {
+	ltm.mu.RLock()
+	defer ltm.mu.RUnlock()
+	for _, template := range ltm.templates {
+		if strings.EqualFold(template.Name, name) {
+			return template, true
+		}
+	}
+	return nil, false
+}
+
+// TemplateFilter narrows a template listing. Empty fields match everything.
+type TemplateFilter struct {
+	Category string // Exact category, case-insensitive
+	Tag      string // Template must carry this tag, case-insensitive
+	Query    string // Substring of the name, ID or description, case-insensitive
+}
+
+// Matches reports whether a template satisfies the filter
+func (f TemplateFilter) Matches(template *LabTemplate) bool {
+	if f.Category != "" && !strings.EqualFold(template.Category, f.Category) {
+		return false
+	}
+
+	if f.Tag != "" {
+		found := false
+		for _, tag := range template.Tags {
+			if strings.EqualFold(tag, f.Tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.Query != "" {
+		query := strings.ToLower(f.Query)
+		if !strings.Contains(strings.ToLower(template.Name), query) &&
+			!strings.Contains(strings.ToLower(template.ID), query) &&
+			!strings.Contains(strings.ToLower(template.Description), query) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// TemplateFacets lists the distinct categories and tags across all templates
+type TemplateFacets struct {
+	Categories []string `json:"categories"`
+	Tags       []string `json:"tags"`
+}
+
+// FilterTemplates returns the templates matching the filter, sorted by name
+func (ltm *LabTemplateManager) FilterTemplates(filter TemplateFilter) []*LabTemplate {
+	ltm.mu.RLock()
+	defer ltm.mu.RUnlock()
+	templates := make([]*LabTemplate, 0, len(ltm.templates))
+	for _, template := range ltm.templates {
+		if filter.Matches(template) {
+			templates = append(templates, template)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates
+}
+
+// GetFacets returns the sorted distinct categories and tags used by the loaded templates
+func (ltm *LabTemplateManager) GetFacets() TemplateFacets {
+	ltm.mu.RLock()
+	defer ltm.mu.RUnlock()
+	categories := make(map[string]bool)
+	tags := make(map[string]bool)
+	for _, template := range ltm.templates {
+		if template.Category != "" {
+			categories[template.Category] = true
+		}
+		for _, tag := range template.Tags {
+			tags[tag] = true
+		}
+	}
+
+	facets := TemplateFacets{
+		Categories: make([]string, 0, len(categories)),
+		Tags:       make([]string, 0, len(tags)),
+	}
+	for category := range categories {
+		facets.Categories = append(facets.Categories, category)
+	}
+	for tag := range tags {
+		facets.Tags = append(facets.Tags, tag)
+	}
+	sort.Strings(facets.Categories)
+	sort.Strings(facets.Tags)
+	return facets
+}
+
 // EnrichTemplatesWithServiceTypes enriches all templates with service type information
 func (ltm *LabTemplateManager) EnrichTemplatesWithServiceTypes(serviceConfigManager *ServiceConfigManager) {
+	defer ltm.notifyChange()
+	ltm.mu.Lock()
+	defer ltm.mu.Unlock()
 	for _, template := range ltm.templates {
 		for i := range template.Services {
 			serviceRef := &template.Services[i]
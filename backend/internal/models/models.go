@@ -1,7 +1,10 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,8 +14,9 @@ import (
 type UserRole string
 
 const (
-	UserRoleUser  UserRole = "user"
-	UserRoleAdmin UserRole = "admin"
+	UserRoleUser     UserRole = "user"
+	UserRoleAdmin    UserRole = "admin"
+	UserRoleOrgAdmin UserRole = "org_admin" // Manages labs and invites within their own organization
 )
 
 // User represents a lab user
@@ -26,6 +30,12 @@ type User struct {
 	UpdatedAt      time.Time `json:"updated_at"`
 }
 
+// NormalizeEmail returns the form emails are stored and compared in, lowercase without surrounding
+// spaces, so addresses differing only in case belong to the same user
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
 // LabStatus represents the status of a lab
 type LabStatus string
 
@@ -34,22 +44,170 @@ const (
 	LabStatusReady        LabStatus = "ready"
 	LabStatusError        LabStatus = "error"
 	LabStatusExpired      LabStatus = "expired"
+	LabStatusScheduled    LabStatus = "scheduled" // Waiting for its start time before provisioning
+	LabStatusQueued       LabStatus = "queued"    // Waiting for a free provisioning slot
+	LabStatusStopped      LabStatus = "stopped"   // Stopped by a user, resources kept until the stop grace period ends
 )
 
+// IsValidLabStatus reports whether status is one of the known lab statuses
+func IsValidLabStatus(status LabStatus) bool {
+	switch status {
+	case LabStatusProvisioning, LabStatusReady, LabStatusError, LabStatusExpired, LabStatusScheduled, LabStatusQueued, LabStatusStopped:
+		return true
+	default:
+		return false
+	}
+}
+
 // Lab represents a lab session
 type Lab struct {
-	ID           string            `json:"id"`
-	Name         string            `json:"name"`
-	Status       LabStatus         `json:"status"`
-	OwnerID      string            `json:"owner_id"`
-	StartedAt    time.Time         `json:"started_at"`
-	EndsAt       time.Time         `json:"ends_at"`
-	CreatedAt    time.Time         `json:"created_at"`
-	UpdatedAt    time.Time         `json:"updated_at"`
-	Credentials  []Credential      `json:"credentials"`
-	ServiceData  map[string]string `json:"service_data,omitempty"`  // Store service-specific data for cleanup
-	TemplateID   string            `json:"template_id,omitempty"`   // Reference to the template used
-	UsedServices []string          `json:"used_services,omitempty"` // Track which services were used for this lab
+	ID             string            `json:"id"`
+	Name           string            `json:"name"`
+	Status         LabStatus         `json:"status"`
+	OwnerID        string            `json:"owner_id"`
+	StartedAt      time.Time         `json:"started_at"`
+	EndsAt         time.Time         `json:"ends_at"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+	Credentials    []Credential      `json:"credentials"`
+	ServiceData    map[string]string `json:"service_data,omitempty"`     // Store service-specific data for cleanup
+	TemplateID     string            `json:"template_id,omitempty"`      // Reference to the template used
+	UsedServices   []string          `json:"used_services,omitempty"`    // Track which services were used for this lab
+	Variables      map[string]string `json:"variables,omitempty"`        // Template variable values supplied at creation
+	Failure        *LabFailure       `json:"failure,omitempty"`          // Why provisioning failed, kept after progress logs rotate
+	StepTimings    []StepTiming      `json:"step_timings,omitempty"`     // How long each provisioning step took, recorded when provisioning ends
+	Provisioning   ProvisioningState `json:"provisioning,omitempty"`     // Per-service provisioning outcome, so failed labs can be retried
+	CleanupState   CleanupState      `json:"cleanup_state,omitempty"`    // Per-service cleanup progress, so cleanup can resume where it stopped
+	Notify         *LabNotification  `json:"notify,omitempty"`           // How the owner is told when provisioning finishes
+	OrganizationID string            `json:"organization_id,omitempty"`  // Owner's organization at creation, selects organization-specific service configs
+	StoppedAt      *time.Time        `json:"stopped_at,omitempty"`       // When a stopped lab was stopped
+	ResumeEndsAt   *time.Time        `json:"resume_ends_at,omitempty"`   // End time a stopped lab gets back when it is resumed
+	Tags           []string          `json:"tags,omitempty"`             // Lower-case labels grouping labs by event, cohort or purpose
+	LastActivityAt *time.Time        `json:"last_activity_at,omitempty"` // When someone last used the lab, idle expiry counts from here
+	Version        int               `json:"version"`                    // Incremented on every change, used for optimistic concurrency
+}
+
+// HasTag reports whether the lab carries a tag, compared case-insensitively
+func (l *Lab) HasTag(tag string) bool {
+	for _, labTag := range l.Tags {
+		if strings.EqualFold(labTag, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// LabFailure records where and why a lab's provisioning failed
+type LabFailure struct {
+	Service  string    `json:"service,omitempty"` // Service that was being set up, if known
+	Step     string    `json:"step,omitempty"`    // Step within the service that failed, if known
+	Message  string    `json:"message"`
+	FailedAt time.Time `json:"failed_at"`
+	Logs     []string  `json:"logs"` // Progress log tail at the time of failure
+}
+
+// StepTiming records how long one provisioning step of a lab took
+type StepTiming struct {
+	Service     string    `json:"service"`
+	Step        string    `json:"step"`
+	Status      string    `json:"status"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+	DurationMs  int64     `json:"duration_ms"`
+}
+
+// LabTimelineEventType identifies an entry in a lab's event timeline
+type LabTimelineEventType string
+
+const (
+	LabTimelineCreated            LabTimelineEventType = "created"             // The lab was created or scheduled
+	LabTimelineStatusChanged      LabTimelineEventType = "status_changed"      // The lab moved to a new status
+	LabTimelineFailed             LabTimelineEventType = "failed"              // Provisioning failed, the message says why
+	LabTimelineDeleted            LabTimelineEventType = "deleted"             // The lab was removed
+	LabTimelineLog                LabTimelineEventType = "log"                 // A progress log entry
+	LabTimelineCredentialRevealed LabTimelineEventType = "credential_revealed" // A one-time reveal credential's secret was revealed
+)
+
+// LabTimelineEvent is one entry in the durable event history of a lab
+type LabTimelineEvent struct {
+	Sequence       int64                `json:"sequence"` // Increases with every event recorded, orders events with equal timestamps
+	Type           LabTimelineEventType `json:"type"`
+	Message        string               `json:"message,omitempty"`
+	Status         LabStatus            `json:"status,omitempty"`
+	PreviousStatus LabStatus            `json:"previous_status,omitempty"`
+	UserID         string               `json:"user_id,omitempty"` // User who caused the event, for credential reveals
+	Timestamp      time.Time            `json:"timestamp"`
+}
+
+// ProvisioningStatus represents the provisioning outcome for one of a lab's services
+type ProvisioningStatus string
+
+const (
+	ProvisioningStatusCompleted ProvisioningStatus = "completed"
+	ProvisioningStatusFailed    ProvisioningStatus = "failed"
+)
+
+// ServiceProvisioningState records the last provisioning attempt for one service of a lab
+type ServiceProvisioningState struct {
+	ServiceID string             `json:"service_id"` // Service config ID
+	Service   string             `json:"service"`    // Service name in the template
+	Status    ProvisioningStatus `json:"status"`
+	Error     string             `json:"error,omitempty"`
+	Attempts  int                `json:"attempts"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// ProvisioningState maps service config IDs to their provisioning state
+type ProvisioningState map[string]*ServiceProvisioningState
+
+// Completed reports whether a service was provisioned successfully
+func (p ProvisioningState) Completed(serviceID string) bool {
+	state, exists := p[serviceID]
+	return exists && state.Status == ProvisioningStatusCompleted
+}
+
+// LabNotification chooses how a lab's owner is notified when the lab becomes ready or fails
+type LabNotification struct {
+	Email      bool   `json:"email,omitempty"`       // Email the owner's account address
+	WebhookURL string `json:"webhook_url,omitempty"` // POST a JSON summary of the lab to this URL
+}
+
+// Enabled reports whether any notification channel is selected
+func (n *LabNotification) Enabled() bool {
+	return n != nil && (n.Email || n.WebhookURL != "")
+}
+
+// CleanupStatus represents the cleanup outcome for one of a lab's services
+type CleanupStatus string
+
+const (
+	CleanupStatusCompleted CleanupStatus = "completed"
+	CleanupStatusFailed    CleanupStatus = "failed"
+)
+
+// ServiceCleanupState records the last cleanup attempt for one service used by a lab
+type ServiceCleanupState struct {
+	ServiceID string        `json:"service_id"` // Service config ID, or service name for labs without tracked services
+	Service   string        `json:"service"`
+	Status    CleanupStatus `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	Attempts  int           `json:"attempts"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// CleanupState maps a lab's services to their cleanup progress. Services without an entry have not been cleaned up yet.
+type CleanupState map[string]*ServiceCleanupState
+
+// FailedServices returns the IDs of services whose last cleanup attempt failed
+func (cs CleanupState) FailedServices() []string {
+	var failed []string
+	for serviceID, state := range cs {
+		if state.Status == CleanupStatusFailed {
+			failed = append(failed, serviceID)
+		}
+	}
+	sort.Strings(failed)
+	return failed
 }
 
 // Credential represents access credentials for a lab service
@@ -60,24 +218,128 @@ type Credential struct {
 	Username  string    `json:"username"`
 	Password  string    `json:"password"`
 	URL       string    `json:"url,omitempty"`
-	ExpiresAt time.Time `json:"expires_at"`
+	ExpiresAt time.Time `json:"expires_at"` // When the backing system expires the credential, which may differ from the lab end
 	Notes     string    `json:"notes,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	ServiceID string    `json:"service_id,omitempty"` // Service config that issued the credential
+	// CredentialType tells password logins from SSH keys; empty means a password
+	CredentialType CredentialType `json:"credential_type,omitempty"`
+	PublicKey      string         `json:"public_key,omitempty"`  // authorized_keys line, for SSH key credentials
+	PrivateKey     string         `json:"private_key,omitempty"` // OpenSSH private key, for SSH key credentials
+	// ExpiresBeforeLab warns that the credential stops working before the lab ends. Set on responses only.
+	ExpiresBeforeLab bool `json:"expires_before_lab,omitempty"`
+	// OneTimeReveal credentials have their password and private key masked in every response; the secret
+	// is only returned once, by the reveal endpoint, which records when and by whom it was revealed
+	OneTimeReveal bool       `json:"one_time_reveal,omitempty"`
+	RevealedAt    *time.Time `json:"revealed_at,omitempty"`
+	RevealedBy    string     `json:"revealed_by,omitempty"` // ID of the user the secret was revealed to
+}
+
+// MaskedSecret replaces the secrets of one-time reveal credentials in responses
+const MaskedSecret = "********"
+
+// Masked returns the credential with its password and private key masked when it is a one-time reveal credential
+func (c Credential) Masked() Credential {
+	if !c.OneTimeReveal {
+		return c
+	}
+	if c.Password != "" {
+		c.Password = MaskedSecret
+	}
+	if c.PrivateKey != "" {
+		c.PrivateKey = MaskedSecret
+	}
+	return c
+}
+
+// MarshalJSON masks the secrets of one-time reveal credentials, so no response can leak them
+func (c Credential) MarshalJSON() ([]byte, error) {
+	type credential Credential
+	return json.Marshal(credential(c.Masked()))
+}
+
+// RevealedCredential is the secret of a one-time reveal credential, returned by the reveal endpoint
+type RevealedCredential struct {
+	ID         string     `json:"id"`
+	Label      string     `json:"label"`
+	Username   string     `json:"username"`
+	Password   string     `json:"password,omitempty"`
+	PrivateKey string     `json:"private_key,omitempty"`
+	URL        string     `json:"url,omitempty"`
+	RevealedAt *time.Time `json:"revealed_at,omitempty"` // Unset for credentials that can be read any time
+	RevealedBy string     `json:"revealed_by,omitempty"`
+}
+
+// CredentialType is the kind of secret a credential holds
+type CredentialType string
+
+const (
+	CredentialTypePassword CredentialType = "password"
+	CredentialTypeSSHKey   CredentialType = "ssh_key"
+)
+
+// LabAccessLevel is the access a user has to a lab shared with them
+type LabAccessLevel string
+
+const (
+	LabAccessObserver LabAccessLevel = "observer" // Can view the lab, its progress and credentials, but not change it
+)
+
+// LabShare grants a user other than the owner access to a lab
+type LabShare struct {
+	LabID       string         `json:"lab_id"`
+	UserID      string         `json:"user_id"`
+	AccessLevel LabAccessLevel `json:"access_level"`
+	SharedBy    string         `json:"shared_by"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// ShareLabRequest represents a request to share a lab with another user
+type ShareLabRequest struct {
+	UserID      string         `json:"user_id"`
+	Email       string         `json:"email"`
+	AccessLevel LabAccessLevel `json:"access_level"` // Defaults to observer
 }
 
 // CreateLabRequest represents a request to create a new lab
 type CreateLabRequest struct {
-	Name     string `json:"name"` // Optional, will generate UUID if not provided
-	OwnerID  string `json:"owner_id" binding:"required"`
-	Duration int    `json:"duration" binding:"required,min=15,max=480"` // Duration in minutes
+	Name     string   `json:"name"` // Optional, defaults to lab-<id>
+	OwnerID  string   `json:"owner_id" binding:"required"`
+	Duration int      `json:"duration" binding:"required,min=15,max=480"` // Duration in minutes
+	Tags     []string `json:"tags,omitempty"`                             // Optional labels, e.g. event:march-workshop
+}
+
+// CreateLabFromTemplateRequest represents a request to create a lab from a template
+type CreateLabFromTemplateRequest struct {
+	Name      string            `json:"name,omitempty"`      // Optional, defaults to the template name followed by the lab ID
+	Duration  int               `json:"duration,omitempty"`  // Optional duration in minutes, defaults to the template's default duration
+	Variables map[string]string `json:"variables,omitempty"` // Values for the template's input variables
+	StartAt   *time.Time        `json:"start_at,omitempty"`  // Optional future time to start provisioning
+	Notify    *LabNotification  `json:"notify,omitempty"`    // Optional notification when the lab is ready or fails
+	Tags      []string          `json:"tags,omitempty"`      // Optional labels, e.g. event:march-workshop
+}
+
+// UpdateLabTagsRequest replaces a lab's tags
+type UpdateLabTagsRequest struct {
+	Tags []string `json:"tags"` // Empty to remove every tag
 }
 
 // CreateUserRequest represents a request to create a new user
 type CreateUserRequest struct {
 	Email string   `json:"email" binding:"required,email"`
 	Name  string   `json:"name" binding:"required"`
-	Role  UserRole `json:"role" binding:"required,oneof=user admin"`
+	Role  UserRole `json:"role" binding:"required,oneof=user admin org_admin"`
+}
+
+// UpdateUserRoleRequest represents a request to change a user's role
+type UpdateUserRoleRequest struct {
+	Role UserRole `json:"role" binding:"required,oneof=user admin org_admin"`
+}
+
+// LoadTemplatesRequest represents a request to load lab templates from a directory on the server
+type LoadTemplatesRequest struct {
+	Directory string `json:"directory" binding:"required"`
 }
 
 // LoginRequest represents a login request
@@ -94,14 +356,28 @@ type LoginResponse struct {
 
 // LabResponse represents a lab response with owner information
 type LabResponse struct {
-	ID           string             `json:"id"`
-	Name         string             `json:"name"`
-	Status       LabStatus          `json:"status"`
-	Owner        User               `json:"owner"`
-	StartedAt    time.Time          `json:"started_at"`
-	EndsAt       time.Time          `json:"ends_at"`
-	Credentials  []Credential       `json:"credentials"`
-	UsedServices []ServiceReference `json:"used_services,omitempty"` // Track which services were used for this lab
+	ID               string             `json:"id"`
+	Name             string             `json:"name"`
+	Status           LabStatus          `json:"status"`
+	Owner            User               `json:"owner"`
+	StartedAt        time.Time          `json:"started_at"`
+	EndsAt           time.Time          `json:"ends_at"`
+	Credentials      []Credential       `json:"credentials,omitempty"` // Only included when requested with include=credentials
+	CredentialsCount int                `json:"credentials_count"`
+	CredentialsURL   string             `json:"credentials_url"`         // Paginated credential list of the lab
+	UsedServices     []ServiceReference `json:"used_services,omitempty"` // Track which services were used for this lab
+	Resources        map[string]string  `json:"resources,omitempty"`     // Resources the lab's services created, keyed by ServiceData key
+	Tags             []string           `json:"tags,omitempty"`
+	LastActivityAt   *time.Time         `json:"last_activity_at,omitempty"`
+	IdleExpiresAt    *time.Time         `json:"idle_expires_at,omitempty"` // When the lab expires unless it is used, set when idle expiry is enabled
+	Version          int                `json:"version"`
+}
+
+// LabActivity reports when a lab was last used and when it expires if it stays idle
+type LabActivity struct {
+	LastActivityAt *time.Time `json:"last_activity_at,omitempty"`
+	IdleExpiresAt  *time.Time `json:"idle_expires_at,omitempty"` // Empty when idle expiry is disabled or the lab isn't ready
+	EndsAt         time.Time  `json:"ends_at"`
 }
 
 // GenerateID generates a new short ID (8 characters)
@@ -137,21 +413,26 @@ type ServiceLimit struct {
 	MaxLabs     int       `json:"max_labs" yaml:"max_labs"`         // Maximum number of concurrent labs using this service
 	MaxDuration int       `json:"max_duration" yaml:"max_duration"` // Maximum duration in minutes
 	IsActive    bool      `json:"is_active" yaml:"is_active"`       // Whether this limit is currently active
+	Version     int       `json:"version" yaml:"-"`                 // Incremented on every update, must match when updating
 	CreatedAt   time.Time `json:"created_at" yaml:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" yaml:"updated_at"`
 }
 
 // ServiceConfig represents a preconfigured service configuration
 type ServiceConfig struct {
-	ID          string            `json:"id" yaml:"id"`
-	Name        string            `json:"name" yaml:"name"`
-	Type        string            `json:"type" yaml:"type"` // palette_project, palette_tenant, proxmox_user
-	Description string            `json:"description" yaml:"description"`
-	Logo        string            `json:"logo" yaml:"logo"`           // Path to logo file (SVG/PNG)
-	Config      map[string]string `json:"config" yaml:"config"`       // Service-specific configuration
-	IsActive    bool              `json:"is_active" yaml:"is_active"` // Whether this service config is available
-	CreatedAt   time.Time         `json:"created_at" yaml:"created_at"`
-	UpdatedAt   time.Time         `json:"updated_at" yaml:"updated_at"`
+	ID             string            `json:"id" yaml:"id"`
+	Name           string            `json:"name" yaml:"name"`
+	Type           string            `json:"type" yaml:"type"` // palette_project, palette_tenant, proxmox_user
+	Description    string            `json:"description" yaml:"description"`
+	Logo           string            `json:"logo" yaml:"logo"`                                 // Path to logo file (SVG/PNG)
+	Config         map[string]string `json:"config" yaml:"config"`                             // Service-specific configuration
+	IsActive       bool              `json:"is_active" yaml:"is_active"`                       // Whether this service config is available
+	CostPerHour    float64           `json:"cost_per_hour,omitempty" yaml:"cost_per_hour"`     // Estimated cost of one lab using this service, per hour
+	OrganizationID string            `json:"organization_id,omitempty" yaml:"organization_id"` // Only labs of this organization use the config, empty for all
+	Overrides      string            `json:"overrides,omitempty" yaml:"overrides"`             // Global service config this one replaces for its organization
+	Version        int               `json:"version" yaml:"-"`                                 // Incremented on every update, must match when updating
+	CreatedAt      time.Time         `json:"created_at" yaml:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at" yaml:"updated_at"`
 }
 
 // ServiceUsage represents current usage of a service
@@ -161,6 +442,25 @@ type ServiceUsage struct {
 	Limit      int    `json:"limit"`
 }
 
+// VlanRangeUsage reports how much of a VLAN range Terraform Cloud configs allocate tags from is in use
+type VlanRangeUsage struct {
+	Min                int                 `json:"min"`
+	Max                int                 `json:"max"`
+	Size               int                 `json:"size"`
+	InUse              int                 `json:"in_use"`
+	Available          int                 `json:"available"`
+	UtilizationPercent float64             `json:"utilization_percent"`
+	AlertThreshold     int                 `json:"alert_threshold"` // Utilization in percent past which the range alerts
+	Alert              bool                `json:"alert"`           // Whether utilization is at or past the threshold
+	Tags               []VlanTagAllocation `json:"tags"`
+}
+
+// VlanTagAllocation is a VLAN tag in use and the lab holding it
+type VlanTagAllocation struct {
+	Tag   int    `json:"tag"`
+	LabID string `json:"lab_id"`
+}
+
 // UserWithOrganization represents a user with organization information
 type UserWithOrganization struct {
 	ID           string        `json:"id"`
@@ -170,4 +470,45 @@ type UserWithOrganization struct {
 	Organization *Organization `json:"organization,omitempty"`
 	CreatedAt    time.Time     `json:"created_at"`
 	UpdatedAt    time.Time     `json:"updated_at"`
+	LastLoginAt  *time.Time    `json:"last_login_at,omitempty"` // Last login or authenticated request, nil if the user never signed in
+}
+
+// UserFilter selects users for the admin user list. Empty fields match every user.
+type UserFilter struct {
+	Role           UserRole
+	OrganizationID string
+	Query          string // Case-insensitive match against name and email
+}
+
+// Matches reports whether a user passes the filter
+func (f UserFilter) Matches(user *User) bool {
+	if f.Role != "" && user.Role != f.Role {
+		return false
+	}
+	if f.OrganizationID != "" && (user.OrganizationID == nil || *user.OrganizationID != f.OrganizationID) {
+		return false
+	}
+	if f.Query != "" {
+		query := strings.ToLower(f.Query)
+		if !strings.Contains(strings.ToLower(user.Name), query) && !strings.Contains(strings.ToLower(user.Email), query) {
+			return false
+		}
+	}
+	return true
+}
+
+// CredentialPage is one page of a lab's credentials
+type CredentialPage struct {
+	Credentials []Credential `json:"credentials"`
+	Total       int          `json:"total"` // Credentials of the lab across all pages
+	Limit       int          `json:"limit"`
+	Offset      int          `json:"offset"`
+}
+
+// UserPage is one page of the admin user list
+type UserPage struct {
+	Users    []*UserWithOrganization `json:"users"`
+	Total    int                     `json:"total"` // Users matching the filter across all pages
+	Page     int                     `json:"page"`
+	PageSize int                     `json:"page_size"`
 }
@@ -6,12 +6,13 @@ import (
 
 // Organization represents a group of users with access to specific labs
 type Organization struct {
-	ID          string    `json:"id" db:"id"`
-	Name        string    `json:"name" db:"name"`
-	Description string    `json:"description" db:"description"`
-	Domain      string    `json:"domain" db:"domain"` // Optional domain for organization
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID               string    `json:"id" db:"id"`
+	Name             string    `json:"name" db:"name"`
+	Description      string    `json:"description" db:"description"`
+	Domain           string    `json:"domain" db:"domain"`                           // Optional domain for organization
+	AutoJoinByDomain bool      `json:"auto_join_by_domain" db:"auto_join_by_domain"` // Assign users whose email matches Domain on first login
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
 }
 
 // OrganizationMember represents a user's membership in an organization
@@ -29,17 +30,74 @@ type Invite struct {
 	OrganizationID string     `json:"organization_id" db:"organization_id"`
 	Email          string     `json:"email" db:"email"`
 	InvitedBy      string     `json:"invited_by" db:"invited_by"`
-	Role           string     `json:"role" db:"role"`     // "admin", "member"
-	Status         string     `json:"status" db:"status"` // "pending", "accepted", "expired"
+	Role           string     `json:"role" db:"role"`               // "admin", "member"
+	Status         string     `json:"status" db:"status"`           // "pending", "accepted", "exhausted", "expired"
+	UsageLimit     int        `json:"usage_limit" db:"usage_limit"` // How many times the invite can be accepted
+	UsageCount     int        `json:"usage_count" db:"usage_count"`
 	ExpiresAt      time.Time  `json:"expires_at" db:"expires_at"`
 	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
-	AcceptedAt     *time.Time `json:"accepted_at" db:"accepted_at"`
+	AcceptedAt     *time.Time `json:"accepted_at" db:"accepted_at"`                   // When the invite was last accepted
+	LabTemplateID  string     `json:"lab_template_id,omitempty" db:"lab_template_id"` // Template a lab is created from for everyone who accepts
+}
+
+// RemainingUses returns how many more times the invite can be accepted
+func (i *Invite) RemainingUses() int {
+	if remaining := i.UsageLimit - i.UsageCount; remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// CreateOrganizationRequest represents a request to create an organization. The name and domain are
+// normalized and checked again when the organization is created.
+type CreateOrganizationRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description,omitempty" binding:"max=500"`
+	Domain      string `json:"domain,omitempty" binding:"omitempty,fqdn"` // Email domain of the organization's members
 }
 
 // CreateInviteRequest represents a request to create an invitation
 type CreateInviteRequest struct {
 	Email string `json:"email" binding:"required,email"`
 	Role  string `json:"role" binding:"required,oneof=admin member"`
+	// UsageLimit allows an invite link to be shared with several people; defaults to a single use
+	UsageLimit int `json:"usage_limit,omitempty" binding:"omitempty,min=1"`
+	// LabTemplateID provisions a lab from the template for each user who accepts, for self-serve workshops
+	LabTemplateID string `json:"lab_template_id,omitempty"`
+}
+
+// InviteStats counts invites by status. Pending invites past their expiry count as expired even before a
+// sweep marks them.
+type InviteStats struct {
+	Pending          int        `json:"pending"` // Can still be accepted
+	Expired          int        `json:"expired"`
+	Accepted         int        `json:"accepted"`
+	Exhausted        int        `json:"exhausted"`
+	Total            int        `json:"total"`
+	Purged           int        `json:"purged"`                  // Invites deleted by sweeps since the server started
+	LastSweepAt      *time.Time `json:"last_sweep_at,omitempty"` // Nil until the first sweep has run
+	LastSweepExpired int        `json:"last_sweep_expired"`      // Invites the last sweep marked as expired
+	LastSweepPurged  int        `json:"last_sweep_purged"`       // Invites the last sweep deleted
+}
+
+// AcceptInviteResponse reports an accepted invite and the lab created for the new member, if any
+type AcceptInviteResponse struct {
+	Message  string    `json:"message"`
+	LabID    string    `json:"lab_id,omitempty"`    // Lab created from the invite's template
+	LabError *APIError `json:"lab_error,omitempty"` // Why the invite's lab could not be created; the invite was still accepted
+}
+
+// RenewInviteRequest asks for an invite to be made acceptable again
+type RenewInviteRequest struct {
+	NewID     bool `json:"new_id,omitempty"`     // Give the invite a new ID so links to the old one stop working
+	SendEmail bool `json:"send_email,omitempty"` // Email the invite link to the invited address
+}
+
+// RenewInviteResponse reports a renewed invite and whether its link was emailed
+type RenewInviteResponse struct {
+	Invite     *Invite   `json:"invite"`
+	EmailSent  bool      `json:"email_sent"`
+	EmailError *APIError `json:"email_error,omitempty"` // Why the invite could not be emailed; it was still renewed
 }
 
 // AcceptInviteRequest represents a request to accept an invitation
@@ -48,6 +106,26 @@ type AcceptInviteRequest struct {
 	UserID   string `json:"user_id" binding:"required"`
 }
 
+// SetDomainAutoJoinRequest turns email domain auto-assignment on or off for an organization
+type SetDomainAutoJoinRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// OrganizationStats summarizes an organization's membership and lab activity
+type OrganizationStats struct {
+	OrganizationID  string         `json:"organization_id"`
+	MemberCount     int            `json:"member_count"`
+	ActiveLabs      int            `json:"active_labs"` // Provisioning or ready
+	TotalLabs       int            `json:"total_labs"`
+	LabsByTemplate  map[string]int `json:"labs_by_template"` // Keyed by template ID, "" for labs not created from a template
+	LabsByTag       map[string]int `json:"labs_by_tag"`      // Labs carrying each tag, a lab with several tags counts for each
+	InvitesIssued   int            `json:"invites_issued"`
+	InvitesAccepted int            `json:"invites_accepted"` // Counts every use of multi-use invites
+	ServiceUsage    map[string]int `json:"service_usage"`    // Active labs per service config ID
+	EstimatedCost   float64        `json:"estimated_cost"`   // Estimated spend to date of the organization's labs, from configured service rates
+	GeneratedAt     time.Time      `json:"generated_at"`
+}
+
 // OrganizationWithMembers represents an organization with its member list
 type OrganizationWithMembers struct {
 	Organization *Organization        `json:"organization"`
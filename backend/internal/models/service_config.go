@@ -3,14 +3,33 @@ package models
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"sort"
 	"sync"
 )
 
+// Errors returned by versioned updates
+var (
+	ErrServiceConfigNotFound = errors.New("service configuration not found")
+	ErrServiceLimitNotFound  = errors.New("service limit not found")
+	ErrVersionConflict       = errors.New("resource was modified by another request")
+	ErrVersionRequired       = errors.New("version is required")
+	ErrServiceIDChanged      = errors.New("service_id cannot be changed")
+)
+
+// Errors returned when a service can't take another lab
+var (
+	ErrServiceConfigInactive = errors.New("service configuration is not active")
+	ErrServiceLimitInactive  = errors.New("service limit is not active")
+	ErrServiceLimitExceeded  = errors.New("service limit exceeded")
+)
+
 // ServiceConfigManager manages service configurations and limits
 type ServiceConfigManager struct {
-	configs map[string]*ServiceConfig
-	limits  map[string]*ServiceLimit
-	mu      sync.RWMutex
+	configs  map[string]*ServiceConfig
+	limits   map[string]*ServiceLimit
+	onChange []func() // Called after service configurations change
+	mu       sync.RWMutex
 }
 
 // NewServiceConfigManager creates a new service configuration manager
@@ -21,13 +40,63 @@ func NewServiceConfigManager() *ServiceConfigManager {
 	}
 }
 
+// OnChange registers a function called whenever a service configuration is added, updated or removed,
+// e.g. to invalidate cached responses
+func (scm *ServiceConfigManager) OnChange(hook func()) {
+	scm.mu.Lock()
+	defer scm.mu.Unlock()
+	scm.onChange = append(scm.onChange, hook)
+}
+
+// notifyChange calls the registered change hooks. It must be called without scm.mu held.
+func (scm *ServiceConfigManager) notifyChange() {
+	scm.mu.RLock()
+	hooks := scm.onChange
+	scm.mu.RUnlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
 // AddServiceConfig adds a service configuration
 func (scm *ServiceConfigManager) AddServiceConfig(config *ServiceConfig) {
+	defer scm.notifyChange()
 	scm.mu.Lock()
 	defer scm.mu.Unlock()
+	if config.Version == 0 {
+		config.Version = 1
+	}
 	scm.configs[config.ID] = config
 }
 
+// UpdateServiceConfig replaces a service configuration if its current version matches expectedVersion,
+// or creates it if it doesn't exist yet. On success the stored version is written back to config.
+func (scm *ServiceConfigManager) UpdateServiceConfig(config *ServiceConfig, expectedVersion int) error {
+	defer scm.notifyChange()
+	scm.mu.Lock()
+	defer scm.mu.Unlock()
+
+	existing, exists := scm.configs[config.ID]
+	if !exists {
+		config.CreatedAt = config.UpdatedAt
+		config.Version = 1
+		scm.configs[config.ID] = config
+		return nil
+	}
+	if expectedVersion == 0 {
+		return ErrVersionRequired
+	}
+	if existing.Version != expectedVersion {
+		return fmt.Errorf("%w: current version is %d", ErrVersionConflict, existing.Version)
+	}
+
+	config.CreatedAt = existing.CreatedAt
+	config.Version = existing.Version + 1
+	scm.configs[config.ID] = config
+	return nil
+}
+
 // GetServiceConfig retrieves a service configuration by ID
 func (scm *ServiceConfigManager) GetServiceConfig(id string) (*ServiceConfig, bool) {
 	scm.mu.RLock()
@@ -36,6 +105,28 @@ func (scm *ServiceConfigManager) GetServiceConfig(id string) (*ServiceConfig, bo
 	return config, exists
 }
 
+// ResolveServiceConfig returns the service configuration labs of an organization use for a service ID: a
+// config of the organization that overrides it if there is one, otherwise the config itself. Configs
+// scoped to an organization are not used for labs of other organizations.
+func (scm *ServiceConfigManager) ResolveServiceConfig(serviceID, organizationID string) (*ServiceConfig, bool) {
+	scm.mu.RLock()
+	defer scm.mu.RUnlock()
+
+	if organizationID != "" {
+		for _, config := range scm.configs {
+			if config.Overrides == serviceID && config.OrganizationID == organizationID {
+				return config, true
+			}
+		}
+	}
+
+	config, exists := scm.configs[serviceID]
+	if !exists || (config.OrganizationID != "" && config.OrganizationID != organizationID) {
+		return nil, false
+	}
+	return config, true
+}
+
 // GetAllServiceConfigs returns all service configurations
 func (scm *ServiceConfigManager) GetAllServiceConfigs() []*ServiceConfig {
 	scm.mu.RLock()
@@ -62,6 +153,7 @@ func (scm *ServiceConfigManager) GetActiveServiceConfigs() []*ServiceConfig {
 
 // RemoveServiceConfig removes a service configuration
 func (scm *ServiceConfigManager) RemoveServiceConfig(id string) {
+	defer scm.notifyChange()
 	scm.mu.Lock()
 	defer scm.mu.Unlock()
 	delete(scm.configs, id)
@@ -71,9 +163,43 @@ func (scm *ServiceConfigManager) RemoveServiceConfig(id string) {
 func (scm *ServiceConfigManager) AddServiceLimit(limit *ServiceLimit) {
 	scm.mu.Lock()
 	defer scm.mu.Unlock()
+	if limit.Version == 0 {
+		limit.Version = 1
+	}
 	scm.limits[limit.ServiceID] = limit
 }
 
+// UpdateServiceLimit replaces an existing service limit, looked up by its ID, if its current version
+// matches expectedVersion. On success the stored version is incremented and written back to limit.
+func (scm *ServiceConfigManager) UpdateServiceLimit(limit *ServiceLimit, expectedVersion int) error {
+	scm.mu.Lock()
+	defer scm.mu.Unlock()
+
+	var existing *ServiceLimit
+	for _, candidate := range scm.limits {
+		if candidate.ID == limit.ID {
+			existing = candidate
+			break
+		}
+	}
+	if existing == nil {
+		return ErrServiceLimitNotFound
+	}
+	if existing.Version != expectedVersion {
+		return fmt.Errorf("%w: current version is %d", ErrVersionConflict, existing.Version)
+	}
+	// Limits are keyed by service ID, so moving one would overwrite another service's limit
+	if limit.ServiceID != "" && limit.ServiceID != existing.ServiceID {
+		return ErrServiceIDChanged
+	}
+
+	limit.ServiceID = existing.ServiceID
+	limit.CreatedAt = existing.CreatedAt
+	limit.Version = existing.Version + 1
+	scm.limits[limit.ServiceID] = limit
+	return nil
+}
+
 // GetServiceLimit retrieves a service limit by service ID
 func (scm *ServiceConfigManager) GetServiceLimit(serviceID string) (*ServiceLimit, bool) {
 	scm.mu.RLock()
@@ -111,33 +237,33 @@ func (scm *ServiceConfigManager) CheckServiceAvailability(serviceID string, curr
 	config, exists := scm.configs[serviceID]
 	if !exists {
 		fmt.Printf("CheckServiceAvailability: Service config not found for %s\n", serviceID)
-		return errors.New("service configuration not found")
+		return ErrServiceConfigNotFound
 	}
 	fmt.Printf("CheckServiceAvailability: Found service config %s (active: %v)\n", config.Name, config.IsActive)
 	fmt.Printf("CheckServiceAvailability: Debug - IsActive field value: %v, type: %T\n", config.IsActive, config.IsActive)
 
 	if !config.IsActive {
 		fmt.Printf("CheckServiceAvailability: Service config %s is not active\n", serviceID)
-		return errors.New("service configuration is not active")
+		return ErrServiceConfigInactive
 	}
 
 	// Check if limit exists and is active
 	limit, exists := scm.limits[serviceID]
 	if !exists {
 		fmt.Printf("CheckServiceAvailability: Service limit not found for %s\n", serviceID)
-		return errors.New("service limit not found")
+		return ErrServiceLimitNotFound
 	}
 	fmt.Printf("CheckServiceAvailability: Found service limit for %s (active: %v, max_labs: %d)\n", serviceID, limit.IsActive, limit.MaxLabs)
 
 	if !limit.IsActive {
 		fmt.Printf("CheckServiceAvailability: Service limit %s is not active\n", serviceID)
-		return errors.New("service limit is not active")
+		return ErrServiceLimitInactive
 	}
 
 	// Check if current usage is within limits
 	if currentUsage >= limit.MaxLabs {
 		fmt.Printf("CheckServiceAvailability: Service %s limit exceeded (usage: %d, limit: %d)\n", serviceID, currentUsage, limit.MaxLabs)
-		return errors.New("service limit exceeded")
+		return ErrServiceLimitExceeded
 	}
 
 	fmt.Printf("CheckServiceAvailability: Service %s availability check passed (usage: %d, limit: %d)\n", serviceID, currentUsage, limit.MaxLabs)
@@ -164,3 +290,105 @@ func (scm *ServiceConfigManager) GetServiceUsage(serviceID string, currentUsage
 		Limit:      limit.MaxLabs,
 	}
 }
+
+// ServiceConfigChanges lists the service configs, by ID, and service limits, by service ID, that a
+// replacement added, removed or changed
+type ServiceConfigChanges struct {
+	AddedConfigs   []string `json:"added_configs"`
+	RemovedConfigs []string `json:"removed_configs"`
+	ChangedConfigs []string `json:"changed_configs"`
+	AddedLimits    []string `json:"added_limits"`
+	RemovedLimits  []string `json:"removed_limits"`
+	ChangedLimits  []string `json:"changed_limits"`
+}
+
+// HasChanges reports whether anything was added, removed or changed
+func (c *ServiceConfigChanges) HasChanges() bool {
+	return len(c.AddedConfigs)+len(c.RemovedConfigs)+len(c.ChangedConfigs)+
+		len(c.AddedLimits)+len(c.RemovedLimits)+len(c.ChangedLimits) > 0
+}
+
+// ReplaceAll swaps all service configurations and limits for new ones at once, so readers never see a
+// mix of old and new. Unchanged entries keep their version and creation time, changed ones are
+// stored with their version incremented.
+func (scm *ServiceConfigManager) ReplaceAll(configs []*ServiceConfig, limits []*ServiceLimit) ServiceConfigChanges {
+	scm.mu.Lock()
+
+	changes := ServiceConfigChanges{
+		AddedConfigs:   []string{},
+		RemovedConfigs: []string{},
+		ChangedConfigs: []string{},
+		AddedLimits:    []string{},
+		RemovedLimits:  []string{},
+		ChangedLimits:  []string{},
+	}
+
+	newConfigs := make(map[string]*ServiceConfig, len(configs))
+	for _, config := range configs {
+		existing, exists := scm.configs[config.ID]
+		switch {
+		case !exists:
+			config.Version = 1
+			changes.AddedConfigs = append(changes.AddedConfigs, config.ID)
+		case sameServiceConfig(existing, config):
+			config = existing
+		default:
+			config.CreatedAt = existing.CreatedAt
+			config.Version = existing.Version + 1
+			changes.ChangedConfigs = append(changes.ChangedConfigs, config.ID)
+		}
+		newConfigs[config.ID] = config
+	}
+	for id := range scm.configs {
+		if _, kept := newConfigs[id]; !kept {
+			changes.RemovedConfigs = append(changes.RemovedConfigs, id)
+		}
+	}
+
+	newLimits := make(map[string]*ServiceLimit, len(limits))
+	for _, limit := range limits {
+		existing, exists := scm.limits[limit.ServiceID]
+		switch {
+		case !exists:
+			limit.Version = 1
+			changes.AddedLimits = append(changes.AddedLimits, limit.ServiceID)
+		case sameServiceLimit(existing, limit):
+			limit = existing
+		default:
+			limit.CreatedAt = existing.CreatedAt
+			limit.Version = existing.Version + 1
+			changes.ChangedLimits = append(changes.ChangedLimits, limit.ServiceID)
+		}
+		newLimits[limit.ServiceID] = limit
+	}
+	for serviceID := range scm.limits {
+		if _, kept := newLimits[serviceID]; !kept {
+			changes.RemovedLimits = append(changes.RemovedLimits, serviceID)
+		}
+	}
+
+	scm.configs = newConfigs
+	scm.limits = newLimits
+	scm.mu.Unlock()
+
+	for _, ids := range [][]string{changes.AddedConfigs, changes.RemovedConfigs, changes.ChangedConfigs,
+		changes.AddedLimits, changes.RemovedLimits, changes.ChangedLimits} {
+		sort.Strings(ids)
+	}
+	if changes.HasChanges() {
+		scm.notifyChange()
+	}
+	return changes
+}
+
+// sameServiceConfig reports whether two service configurations differ only in their version and timestamps
+func sameServiceConfig(a, b *ServiceConfig) bool {
+	return a.Name == b.Name && a.Type == b.Type && a.Description == b.Description && a.Logo == b.Logo &&
+		a.IsActive == b.IsActive && a.CostPerHour == b.CostPerHour && a.OrganizationID == b.OrganizationID &&
+		a.Overrides == b.Overrides && maps.Equal(a.Config, b.Config)
+}
+
+// sameServiceLimit reports whether two service limits differ only in their version and timestamps
+func sameServiceLimit(a, b *ServiceLimit) bool {
+	return a.ID == b.ID && a.MaxLabs == b.MaxLabs && a.MaxDuration == b.MaxDuration && a.IsActive == b.IsActive
+}
@@ -0,0 +1,839 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+
+	"github.com/google/uuid"
+)
+
+const (
+	azureLoginURL      = "https://login.microsoftonline.com"
+	azureManagementURL = "https://management.azure.com"
+	azureGraphURL      = "https://graph.microsoft.com/v1.0"
+	azurePortalURL     = "https://portal.azure.com"
+
+	azureResourceGroupAPIVersion  = "2021-04-01"
+	azureRoleAssignmentAPIVersion = "2022-04-01"
+	azureSubscriptionAPIVersion   = "2020-01-01"
+
+	// azureContributorRoleID is the built-in Contributor role definition
+	azureContributorRoleID = "b24988ac-6180-42a0-ab88-20f7382dd24c"
+
+	// azureLabTagName tags lab resource groups so they can be found by the reconciler
+	azureLabTagName = "labby-lab-id"
+)
+
+// AzureService handles setup and cleanup of Azure resource groups for labs
+type AzureService struct {
+	tenantID               string
+	clientID               string
+	clientSecret           string
+	subscriptionID         string
+	location               string
+	roleDefinitionID       string
+	createServicePrincipal bool
+	principalID            string
+	principalType          string
+	// Replaces the real HTTP client, set with SetHTTPDoer
+	httpDoer HTTPDoer
+}
+
+// NewAzureService creates a new Azure service instance
+func NewAzureService() *AzureService {
+	location := os.Getenv("AZURE_LOCATION")
+	if location == "" {
+		location = "eastus"
+	}
+
+	return &AzureService{
+		tenantID:               os.Getenv("AZURE_TENANT_ID"),
+		clientID:               os.Getenv("AZURE_CLIENT_ID"),
+		clientSecret:           os.Getenv("AZURE_CLIENT_SECRET"),
+		subscriptionID:         os.Getenv("AZURE_SUBSCRIPTION_ID"),
+		location:               location,
+		roleDefinitionID:       azureContributorRoleID,
+		createServicePrincipal: true,
+		principalType:          "User",
+	}
+}
+
+// ConfigureFromServiceConfig configures the service from a service configuration
+func (v *AzureService) ConfigureFromServiceConfig(config map[string]string) {
+	if tenantID, ok := config["tenant_id"]; ok {
+		v.tenantID = tenantID
+	}
+	if clientID, ok := config["client_id"]; ok {
+		v.clientID = clientID
+	}
+	if clientSecret, ok := config["client_secret"]; ok {
+		v.clientSecret = clientSecret
+	}
+	if subscriptionID, ok := config["subscription_id"]; ok {
+		v.subscriptionID = subscriptionID
+	}
+	if location, ok := config["location"]; ok && location != "" {
+		v.location = location
+	}
+	if roleDefinitionID, ok := config["role_definition_id"]; ok && roleDefinitionID != "" {
+		v.roleDefinitionID = roleDefinitionID
+	}
+	if createServicePrincipal, ok := config["create_service_principal"]; ok {
+		v.createServicePrincipal = createServicePrincipal != "false"
+	}
+	if principalID, ok := config["principal_id"]; ok {
+		v.principalID = principalID
+	}
+	if principalType, ok := config["principal_type"]; ok && principalType != "" {
+		v.principalType = principalType
+	}
+}
+
+// GetName returns the service name
+func (v *AzureService) GetName() string {
+	return "azure"
+}
+
+// GetDescription returns the service description
+func (v *AzureService) GetDescription() string {
+	return "Azure resource group with scoped access"
+}
+
+// GetRequiredParams returns the required parameters for this service
+func (v *AzureService) GetRequiredParams() []string {
+	return []string{"AZURE_TENANT_ID", "AZURE_CLIENT_ID", "AZURE_CLIENT_SECRET", "AZURE_SUBSCRIPTION_ID"}
+}
+
+// ConfigSchema describes the keys the service's configs accept (implements ConfigSchemaProvider)
+func (v *AzureService) ConfigSchema() []interfaces.ConfigField {
+	return []interfaces.ConfigField{
+		{Key: "tenant_id", Description: "Azure AD tenant of the managing service principal", Required: true, Env: "AZURE_TENANT_ID"},
+		{Key: "client_id", Description: "Client ID of the managing service principal", Required: true, Env: "AZURE_CLIENT_ID"},
+		{Key: "client_secret", Description: "Client secret of the managing service principal", Required: true, Secret: true, Env: "AZURE_CLIENT_SECRET"},
+		{Key: "subscription_id", Description: "Subscription lab resource groups are created in", Required: true, Env: "AZURE_SUBSCRIPTION_ID"},
+		{Key: "location", Description: "Region of lab resource groups", Default: "eastus", Env: "AZURE_LOCATION"},
+		{Key: "role_definition_id", Description: "Role assigned on the lab resource group", Default: azureContributorRoleID},
+		{Key: "create_service_principal", Description: "Create a service principal for each lab (true or false)", Default: "true"},
+		{Key: "principal_id", Description: "Existing principal assigned the role when create_service_principal is false"},
+		{Key: "principal_type", Description: "Type of principal_id, e.g. User or Group", Default: "User"},
+	}
+}
+
+// ServiceDataKeys returns the prefixes of the ServiceData keys the service records (implements Service interface)
+func (v *AzureService) ServiceDataKeys() []string {
+	return []string{"azure_"}
+}
+
+// DescribeResources returns the resource names the service derives from the lab ID (implements Service interface)
+func (v *AzureService) DescribeResources(labID string) map[string]string {
+	return map[string]string{
+		"azure_resource_group":   fmt.Sprintf("lab-%s", labID),
+		"azure_application_name": fmt.Sprintf("lab-%s", labID),
+	}
+}
+
+// SetHTTPDoer replaces the client the service sends Azure requests with, such as with a fake in tests
+func (v *AzureService) SetHTTPDoer(doer HTTPDoer) {
+	v.httpDoer = doer
+}
+
+// Name returns the service name (implements Setup interface)
+func (v *AzureService) Name() string {
+	return v.GetName()
+}
+
+// AzureClient represents an Azure Resource Manager and Microsoft Graph API client
+type AzureClient struct {
+	tenantID       string
+	clientID       string
+	clientSecret   string
+	subscriptionID string
+	httpClient     HTTPDoer
+	ctx            context.Context // Cancels in-flight requests, e.g. when lab setup times out
+	tokens         map[string]string
+}
+
+// AzureApplication represents an app registration and its service principal
+type AzureApplication struct {
+	ObjectID           string
+	AppID              string
+	ServicePrincipalID string
+}
+
+// NewAzureClient creates a new Azure client and verifies the service principal credentials
+func NewAzureClient(ctx context.Context, tenantID, clientID, clientSecret, subscriptionID string, doer HTTPDoer) (*AzureClient, error) {
+	client := &AzureClient{
+		tenantID:       tenantID,
+		clientID:       clientID,
+		clientSecret:   clientSecret,
+		subscriptionID: subscriptionID,
+		httpClient:     httpDoerOr(doer, &http.Client{Timeout: 30 * time.Second}),
+		ctx:            ctx,
+		tokens:         make(map[string]string),
+	}
+
+	// Authenticate up front so bad credentials fail fast
+	if _, err := client.token(azureManagementURL); err != nil {
+		return nil, fmt.Errorf("failed to authenticate: %w", err)
+	}
+
+	return client, nil
+}
+
+// token returns an access token for the given resource using the client credentials flow
+func (ac *AzureClient) token(resource string) (string, error) {
+	if token, ok := ac.tokens[resource]; ok {
+		return token, nil
+	}
+
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/v2.0/token", azureLoginURL, ac.tenantID)
+
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+	data.Set("client_id", ac.clientID)
+	data.Set("client_secret", ac.clientSecret)
+	data.Set("scope", resource+"/.default")
+
+	fmt.Printf("Authenticating to Azure tenant %s for %s\n", ac.tenantID, resource)
+
+	req, err := http.NewRequestWithContext(ac.ctx, "POST", tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create authentication request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := ac.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed with status: %d, response: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	ac.tokens[resource] = result.AccessToken
+	return result.AccessToken, nil
+}
+
+// do performs an authenticated JSON request and decodes the response into out when provided
+func (ac *AzureClient) do(method, resource, requestURL string, payload interface{}, out interface{}) error {
+	token, err := ac.token(resource)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ac.ctx, method, requestURL, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := ac.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &azureAPIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// azureAPIError is returned when an Azure API responds with a non-2xx status
+type azureAPIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *azureAPIError) Error() string {
+	return fmt.Sprintf("request failed with status: %d, response: %s", e.StatusCode, e.Body)
+}
+
+// isAzureNotFound reports whether err is a 404 from an Azure API
+func isAzureNotFound(err error) bool {
+	apiErr, ok := err.(*azureAPIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// reportAzureCleanup records a cleanup outcome, treating resources that are already gone as skipped
+func reportAzureCleanup(ctx *interfaces.CleanupContext, resource, action string, err error) {
+	if isAzureNotFound(err) {
+		ctx.SkipResource(resource, action, "not found")
+		return
+	}
+	ctx.ReportResource(resource, action, err)
+}
+
+// resourceGroupID returns the ARM ID of a resource group
+func (ac *AzureClient) resourceGroupID(name string) string {
+	return fmt.Sprintf("/subscriptions/%s/resourcegroups/%s", ac.subscriptionID, name)
+}
+
+// createResourceGroup creates (or updates) a resource group tagged with the lab ID
+func (ac *AzureClient) createResourceGroup(name, location, labID string) error {
+	requestURL := fmt.Sprintf("%s%s?api-version=%s", azureManagementURL, ac.resourceGroupID(name), azureResourceGroupAPIVersion)
+	payload := map[string]interface{}{
+		"location": location,
+		"tags": map[string]string{
+			azureLabTagName: labID,
+		},
+	}
+	return ac.do("PUT", azureManagementURL, requestURL, payload, nil)
+}
+
+// deleteResourceGroup starts deletion of a resource group and everything in it
+func (ac *AzureClient) deleteResourceGroup(name string) error {
+	requestURL := fmt.Sprintf("%s%s?api-version=%s", azureManagementURL, ac.resourceGroupID(name), azureResourceGroupAPIVersion)
+	return ac.do("DELETE", azureManagementURL, requestURL, nil, nil)
+}
+
+// listLabResourceGroups lists resource groups carrying the lab tag
+func (ac *AzureClient) listLabResourceGroups() (map[string]string, error) {
+	requestURL := fmt.Sprintf("%s/subscriptions/%s/resourcegroups?api-version=%s", azureManagementURL, ac.subscriptionID, azureResourceGroupAPIVersion)
+
+	groups := make(map[string]string)
+	for requestURL != "" {
+		var result struct {
+			Value []struct {
+				Name string            `json:"name"`
+				Tags map[string]string `json:"tags"`
+			} `json:"value"`
+			NextLink string `json:"nextLink"`
+		}
+		if err := ac.do("GET", azureManagementURL, requestURL, nil, &result); err != nil {
+			return nil, err
+		}
+
+		for _, group := range result.Value {
+			if labID, ok := group.Tags[azureLabTagName]; ok {
+				groups[group.Name] = labID
+			}
+		}
+		requestURL = result.NextLink
+	}
+
+	return groups, nil
+}
+
+// createRoleAssignment assigns a role to a principal at the given scope and returns the assignment ID
+func (ac *AzureClient) createRoleAssignment(scope, roleDefinitionID, principalID, principalType string) (string, error) {
+	assignmentID := fmt.Sprintf("%s/providers/Microsoft.Authorization/roleAssignments/%s", scope, uuid.New().String())
+	requestURL := fmt.Sprintf("%s%s?api-version=%s", azureManagementURL, assignmentID, azureRoleAssignmentAPIVersion)
+
+	payload := map[string]interface{}{
+		"properties": map[string]string{
+			"roleDefinitionId": fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Authorization/roleDefinitions/%s", ac.subscriptionID, roleDefinitionID),
+			"principalId":      principalID,
+			"principalType":    principalType,
+		},
+	}
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := ac.do("PUT", azureManagementURL, requestURL, payload, &result); err != nil {
+		return "", err
+	}
+
+	if result.ID != "" {
+		return result.ID, nil
+	}
+	return assignmentID, nil
+}
+
+// deleteRoleAssignment deletes a role assignment by its full ID
+func (ac *AzureClient) deleteRoleAssignment(assignmentID string) error {
+	requestURL := fmt.Sprintf("%s%s?api-version=%s", azureManagementURL, assignmentID, azureRoleAssignmentAPIVersion)
+	return ac.do("DELETE", azureManagementURL, requestURL, nil, nil)
+}
+
+// createApplication registers an application and its service principal
+func (ac *AzureClient) createApplication(displayName string) (*AzureApplication, error) {
+	var app struct {
+		ID    string `json:"id"`
+		AppID string `json:"appId"`
+	}
+	if err := ac.do("POST", azureGraphURL, azureGraphURL+"/applications", map[string]string{
+		"displayName": displayName,
+	}, &app); err != nil {
+		return nil, fmt.Errorf("failed to create application: %w", err)
+	}
+
+	var sp struct {
+		ID string `json:"id"`
+	}
+	if err := ac.do("POST", azureGraphURL, azureGraphURL+"/servicePrincipals", map[string]string{
+		"appId": app.AppID,
+	}, &sp); err != nil {
+		return &AzureApplication{ObjectID: app.ID, AppID: app.AppID}, fmt.Errorf("failed to create service principal: %w", err)
+	}
+
+	return &AzureApplication{
+		ObjectID:           app.ID,
+		AppID:              app.AppID,
+		ServicePrincipalID: sp.ID,
+	}, nil
+}
+
+// addApplicationPassword adds a client secret to an application that expires at the given time
+func (ac *AzureClient) addApplicationPassword(objectID, displayName string, expiresAt time.Time) (string, error) {
+	payload := map[string]interface{}{
+		"passwordCredential": map[string]string{
+			"displayName": displayName,
+			"endDateTime": expiresAt.UTC().Format(time.RFC3339),
+		},
+	}
+
+	var result struct {
+		SecretText string `json:"secretText"`
+	}
+	if err := ac.do("POST", azureGraphURL, fmt.Sprintf("%s/applications/%s/addPassword", azureGraphURL, objectID), payload, &result); err != nil {
+		return "", err
+	}
+
+	return result.SecretText, nil
+}
+
+// findApplication looks up an application by display name, returning nil if none exists
+func (ac *AzureClient) findApplication(displayName string) (*AzureApplication, error) {
+	filter := url.QueryEscape(fmt.Sprintf("displayName eq '%s'", displayName))
+
+	var result struct {
+		Value []struct {
+			ID    string `json:"id"`
+			AppID string `json:"appId"`
+		} `json:"value"`
+	}
+	if err := ac.do("GET", azureGraphURL, fmt.Sprintf("%s/applications?$filter=%s", azureGraphURL, filter), nil, &result); err != nil {
+		return nil, err
+	}
+
+	if len(result.Value) == 0 {
+		return nil, nil
+	}
+
+	return &AzureApplication{ObjectID: result.Value[0].ID, AppID: result.Value[0].AppID}, nil
+}
+
+// deleteServicePrincipal deletes a service principal by object ID
+func (ac *AzureClient) deleteServicePrincipal(objectID string) error {
+	return ac.do("DELETE", azureGraphURL, fmt.Sprintf("%s/servicePrincipals/%s", azureGraphURL, objectID), nil, nil)
+}
+
+// deleteApplication deletes an application registration by object ID
+func (ac *AzureClient) deleteApplication(objectID string) error {
+	return ac.do("DELETE", azureGraphURL, fmt.Sprintf("%s/applications/%s", azureGraphURL, objectID), nil, nil)
+}
+
+// ListLabResources lists resource groups tagged with a lab ID
+func (v *AzureService) ListLabResources() ([]interfaces.LabResource, error) {
+	if v.tenantID == "" || v.clientID == "" || v.clientSecret == "" || v.subscriptionID == "" {
+		return nil, fmt.Errorf("AZURE_TENANT_ID, AZURE_CLIENT_ID, AZURE_CLIENT_SECRET, and AZURE_SUBSCRIPTION_ID configuration is required")
+	}
+
+	client, err := NewAzureClient(context.Background(), v.tenantID, v.clientID, v.clientSecret, v.subscriptionID, v.httpDoer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure client: %w", err)
+	}
+
+	groups, err := client.listLabResourceGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []interfaces.LabResource
+	for name, labID := range groups {
+		resources = append(resources, interfaces.LabResource{
+			Name:  name,
+			LabID: labID,
+		})
+	}
+
+	return resources, nil
+}
+
+// TestConnection verifies the service principal credentials and its access to the subscription
+func (v *AzureService) TestConnection() error {
+	if v.tenantID == "" || v.clientID == "" || v.clientSecret == "" || v.subscriptionID == "" {
+		return fmt.Errorf("tenant_id, client_id, client_secret and subscription_id are required")
+	}
+
+	client, err := NewAzureClient(context.Background(), v.tenantID, v.clientID, v.clientSecret, v.subscriptionID, v.httpDoer)
+	if err != nil {
+		return err
+	}
+
+	requestURL := fmt.Sprintf("%s/subscriptions/%s?api-version=%s", azureManagementURL, v.subscriptionID, azureSubscriptionAPIVersion)
+	if err := client.do("GET", azureManagementURL, requestURL, nil, nil); err != nil {
+		return fmt.Errorf("failed to read subscription %s: %w", v.subscriptionID, err)
+	}
+
+	return nil
+}
+
+// ExecuteSetup creates a resource group for the lab and grants the lab user access to it
+func (v *AzureService) ExecuteSetup(ctx *interfaces.SetupContext) error {
+	// Update progress: Authenticating to Azure
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Authenticating to Azure", "running", "Authenticating to Azure...")
+	}
+
+	if v.tenantID == "" || v.clientID == "" || v.clientSecret == "" || v.subscriptionID == "" {
+		err := fmt.Errorf("AZURE_TENANT_ID, AZURE_CLIENT_ID, AZURE_CLIENT_SECRET, and AZURE_SUBSCRIPTION_ID environment variables are required")
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Authenticating to Azure", "failed", err.Error())
+		}
+		return err
+	}
+
+	if !v.createServicePrincipal && v.principalID == "" {
+		err := fmt.Errorf("principal_id is required when create_service_principal is false")
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Authenticating to Azure", "failed", err.Error())
+		}
+		return err
+	}
+
+	// Use lab ID directly as it's already the short ID
+	shortID := ctx.LabID
+
+	fmt.Printf("Setting up Azure resource group for lab %s...\n", ctx.LabName)
+
+	// Create Azure client
+	client, err := NewAzureClient(ctx.Context, v.tenantID, v.clientID, v.clientSecret, v.subscriptionID, v.httpDoer)
+	if err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Authenticating to Azure", "failed", fmt.Sprintf("Failed to authenticate: %v", err))
+		}
+		return fmt.Errorf("failed to create Azure client: %w", err)
+	}
+
+	// Update progress: Authenticating to Azure completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Authenticating to Azure", "completed", "Successfully authenticated to Azure")
+	}
+
+	// Store configuration for cleanup before creating anything
+	if ctx.Lab != nil {
+		if ctx.Lab.ServiceData == nil {
+			ctx.Lab.ServiceData = make(map[string]string)
+		}
+		ctx.Lab.ServiceData["azure_tenant_id"] = v.tenantID
+		ctx.Lab.ServiceData["azure_client_id"] = v.clientID
+		ctx.Lab.ServiceData["azure_client_secret"] = v.clientSecret
+		ctx.Lab.ServiceData["azure_subscription_id"] = v.subscriptionID
+	}
+
+	// Update progress: Creating Resource Group
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Creating Resource Group", "running", "Creating Azure resource group...")
+	}
+
+	resourceGroupName := fmt.Sprintf("lab-%s", shortID)
+	fmt.Printf("- Creating resource group: %s in %s\n", resourceGroupName, v.location)
+	if err := client.createResourceGroup(resourceGroupName, v.location, shortID); err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Creating Resource Group", "failed", fmt.Sprintf("Failed to create resource group: %v", err))
+		}
+		return fmt.Errorf("failed to create resource group: %w", err)
+	}
+	fmt.Printf("  Resource group created successfully\n")
+
+	ctx.Context = context.WithValue(ctx.Context, "azure_resource_group", resourceGroupName)
+	if ctx.Lab != nil {
+		ctx.Lab.ServiceData["azure_resource_group"] = resourceGroupName
+	}
+
+	// Update progress: Creating Resource Group completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Creating Resource Group", "completed", "Azure resource group created successfully")
+	}
+
+	expiresAt := time.Now().Add(time.Duration(ctx.Duration) * time.Minute)
+	principalID := v.principalID
+	principalType := v.principalType
+	var app *AzureApplication
+	var clientSecret string
+
+	// Create a short-lived service principal for the lab user
+	if v.createServicePrincipal {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Creating Service Principal", "running", "Creating lab service principal...")
+		}
+
+		appName := fmt.Sprintf("lab-%s", shortID)
+		fmt.Printf("- Creating application and service principal: %s\n", appName)
+		app, err = client.createApplication(appName)
+		if app != nil && ctx.Lab != nil {
+			// Record what was created even on partial failure so cleanup can remove it
+			ctx.Lab.ServiceData["azure_application_object_id"] = app.ObjectID
+			ctx.Lab.ServiceData["azure_app_id"] = app.AppID
+			ctx.Lab.ServiceData["azure_service_principal_id"] = app.ServicePrincipalID
+		}
+		if err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Creating Service Principal", "failed", fmt.Sprintf("Failed to create service principal: %v", err))
+			}
+			return err
+		}
+
+		clientSecret, err = client.addApplicationPassword(app.ObjectID, fmt.Sprintf("lab-%s", shortID), expiresAt)
+		if err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Creating Service Principal", "failed", fmt.Sprintf("Failed to create client secret: %v", err))
+			}
+			return fmt.Errorf("failed to create client secret: %w", err)
+		}
+		fmt.Printf("  Service principal created successfully (app ID: %s)\n", app.AppID)
+
+		ctx.Context = context.WithValue(ctx.Context, "azure_application_object_id", app.ObjectID)
+		ctx.Context = context.WithValue(ctx.Context, "azure_service_principal_id", app.ServicePrincipalID)
+
+		principalID = app.ServicePrincipalID
+		principalType = "ServicePrincipal"
+
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Creating Service Principal", "completed", "Lab service principal created successfully")
+		}
+	}
+
+	// Update progress: Assigning Role
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Assigning Role", "running", "Granting access to the resource group...")
+	}
+
+	// New service principals take a few seconds to replicate, so retry the assignment
+	scope := client.resourceGroupID(resourceGroupName)
+	var roleAssignmentID string
+	for attempt := 1; attempt <= 6; attempt++ {
+		roleAssignmentID, err = client.createRoleAssignment(scope, v.roleDefinitionID, principalID, principalType)
+		if err == nil || !strings.Contains(err.Error(), "PrincipalNotFound") {
+			break
+		}
+		fmt.Printf("  Principal not yet replicated (attempt %d), retrying...\n", attempt)
+		time.Sleep(time.Duration(attempt) * 5 * time.Second)
+	}
+	if err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Assigning Role", "failed", fmt.Sprintf("Failed to assign role: %v", err))
+		}
+		return fmt.Errorf("failed to create role assignment: %w", err)
+	}
+	fmt.Printf("  Role assignment created successfully: %s\n", roleAssignmentID)
+
+	ctx.Context = context.WithValue(ctx.Context, "azure_role_assignment_id", roleAssignmentID)
+	if ctx.Lab != nil {
+		ctx.Lab.ServiceData["azure_role_assignment_id"] = roleAssignmentID
+	}
+
+	portalURL := fmt.Sprintf("%s/#@%s/resource%s", azurePortalURL, v.tenantID, scope)
+
+	// Add credential to lab
+	credential := &interfaces.Credential{
+		ID:        fmt.Sprintf("azure-%s", shortID),
+		LabID:     ctx.LabID,
+		Label:     "Azure",
+		URL:       portalURL,
+		ExpiresAt: expiresAt,
+		Notes:     fmt.Sprintf("Tenant: %s, Subscription: %s, Resource group: %s", v.tenantID, v.subscriptionID, resourceGroupName),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if app != nil {
+		credential.Label = "Azure Service Principal"
+		credential.Username = app.AppID
+		credential.Password = clientSecret
+	}
+
+	if err := ctx.AddCredential(credential); err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Assigning Role", "failed", fmt.Sprintf("Failed to add credential: %v", err))
+		}
+		return fmt.Errorf("failed to add Azure credential: %w", err)
+	}
+
+	// Update progress: Assigning Role completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Assigning Role", "completed", "Access granted successfully")
+	}
+
+	fmt.Printf("Azure setup completed for lab %s\n", ctx.LabName)
+	return nil
+}
+
+// ExecuteCleanup removes the role assignment, the lab service principal and the resource group
+func (v *AzureService) ExecuteCleanup(ctx *interfaces.CleanupContext) error {
+	// Use lab ID directly as it's already the short ID
+	shortID := ctx.LabID
+
+	// Get configuration from lab's ServiceData
+	var tenantID, clientID, clientSecret, subscriptionID string
+	var resourceGroupName, roleAssignmentID, applicationObjectID, servicePrincipalID string
+
+	if ctx.Lab != nil && ctx.Lab.ServiceData != nil {
+		tenantID = ctx.Lab.ServiceData["azure_tenant_id"]
+		clientID = ctx.Lab.ServiceData["azure_client_id"]
+		clientSecret = ctx.Lab.ServiceData["azure_client_secret"]
+		subscriptionID = ctx.Lab.ServiceData["azure_subscription_id"]
+		resourceGroupName = ctx.Lab.ServiceData["azure_resource_group"]
+		roleAssignmentID = ctx.Lab.ServiceData["azure_role_assignment_id"]
+		applicationObjectID = ctx.Lab.ServiceData["azure_application_object_id"]
+		servicePrincipalID = ctx.Lab.ServiceData["azure_service_principal_id"]
+	}
+
+	// Fallback to environment variables if not in ServiceData
+	if tenantID == "" {
+		tenantID = v.tenantID
+	}
+	if clientID == "" {
+		clientID = v.clientID
+	}
+	if clientSecret == "" {
+		clientSecret = v.clientSecret
+	}
+	if subscriptionID == "" {
+		subscriptionID = v.subscriptionID
+	}
+
+	// Fallback to context values (e.g. admin cleanup), then to the lab naming convention
+	if resourceGroupName == "" {
+		if contextName, ok := ctx.Context.Value("azure_resource_group").(string); ok {
+			resourceGroupName = contextName
+		} else {
+			resourceGroupName = fmt.Sprintf("lab-%s", shortID)
+			fmt.Printf("Warning: azure resource group not found in context or lab data, using constructed name: %s\n", resourceGroupName)
+		}
+	}
+	if roleAssignmentID == "" {
+		if contextID, ok := ctx.Context.Value("azure_role_assignment_id").(string); ok {
+			roleAssignmentID = contextID
+		}
+	}
+	if applicationObjectID == "" {
+		if contextID, ok := ctx.Context.Value("azure_application_object_id").(string); ok {
+			applicationObjectID = contextID
+		}
+	}
+	if servicePrincipalID == "" {
+		if contextID, ok := ctx.Context.Value("azure_service_principal_id").(string); ok {
+			servicePrincipalID = contextID
+		}
+	}
+
+	// Validate required configuration
+	if tenantID == "" || clientID == "" || clientSecret == "" || subscriptionID == "" {
+		return fmt.Errorf("AZURE_TENANT_ID, AZURE_CLIENT_ID, AZURE_CLIENT_SECRET, and AZURE_SUBSCRIPTION_ID configuration not found in lab data or environment")
+	}
+
+	// Create Azure client for cleanup
+	client, err := NewAzureClient(ctx.Context, tenantID, clientID, clientSecret, subscriptionID, v.httpDoer)
+	if err != nil {
+		return fmt.Errorf("failed to create Azure client for cleanup: %w", err)
+	}
+
+	fmt.Printf("Cleaning up Azure resources for lab %s:\n", ctx.LabID)
+
+	// Delete role assignment
+	if roleAssignmentID != "" {
+		fmt.Printf("- Deleting role assignment: %s\n", roleAssignmentID)
+		err := client.deleteRoleAssignment(roleAssignmentID)
+		if err != nil && !isAzureNotFound(err) {
+			fmt.Printf("Warning: Failed to delete role assignment: %v\n", err)
+		} else {
+			fmt.Printf("  Role assignment deleted successfully\n")
+		}
+		reportAzureCleanup(ctx, "role assignment "+roleAssignmentID, "delete", err)
+	}
+
+	// Look up the lab application by name when its IDs were not recorded
+	if applicationObjectID == "" {
+		app, err := client.findApplication(fmt.Sprintf("lab-%s", shortID))
+		if err != nil {
+			fmt.Printf("Warning: Failed to look up lab application: %v\n", err)
+			ctx.ReportResource(fmt.Sprintf("application lab-%s", shortID), "look up", err)
+		} else if app != nil {
+			applicationObjectID = app.ObjectID
+		}
+	}
+
+	// Delete service principal, then the application registration
+	if servicePrincipalID != "" {
+		fmt.Printf("- Deleting service principal: %s\n", servicePrincipalID)
+		err := client.deleteServicePrincipal(servicePrincipalID)
+		if err != nil && !isAzureNotFound(err) {
+			fmt.Printf("Warning: Failed to delete service principal: %v\n", err)
+		} else {
+			fmt.Printf("  Service principal deleted successfully\n")
+		}
+		reportAzureCleanup(ctx, "service principal "+servicePrincipalID, "delete", err)
+	}
+	if applicationObjectID != "" {
+		fmt.Printf("- Deleting application: %s\n", applicationObjectID)
+		err := client.deleteApplication(applicationObjectID)
+		if err != nil && !isAzureNotFound(err) {
+			fmt.Printf("Warning: Failed to delete application: %v\n", err)
+		} else {
+			fmt.Printf("  Application deleted successfully\n")
+		}
+		reportAzureCleanup(ctx, "application "+applicationObjectID, "delete", err)
+	}
+
+	// Delete resource group (Azure completes the deletion asynchronously)
+	fmt.Printf("- Deleting resource group: %s\n", resourceGroupName)
+	err = client.deleteResourceGroup(resourceGroupName)
+	reportAzureCleanup(ctx, "resource group "+resourceGroupName, "delete", err)
+	if err != nil && !isAzureNotFound(err) {
+		return fmt.Errorf("failed to delete resource group %s: %w", resourceGroupName, err)
+	}
+	fmt.Printf("  Resource group deletion started\n")
+
+	fmt.Printf("Azure cleanup completed for lab %s\n", ctx.LabID)
+	return nil
+}
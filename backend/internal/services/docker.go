@@ -0,0 +1,899 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+	"github.com/wcrum/labby/internal/models"
+)
+
+const (
+	// dockerAPIVersion is the Engine API version requests are made against
+	dockerAPIVersion = "v1.41"
+	// dockerDefaultHost is used when neither the config nor DOCKER_HOST names a daemon
+	dockerDefaultHost = "unix:///var/run/docker.sock"
+	// dockerLabLabel is the container, volume and network label holding the lab ID
+	dockerLabLabel = "lab"
+)
+
+// errDockerNotFound is returned for 404 responses, so cleanup can treat missing resources as removed
+var errDockerNotFound = errors.New("not found")
+
+// DockerService runs a throwaway container per lab on a Docker daemon. Mapped ports are exposed as
+// credential URLs, and cleanup removes the container together with the volumes and network created for it.
+type DockerService struct {
+	host          string // unix:///path, tcp://host:port or https://host:port
+	tlsCACert     string // PEM encoded CA certificate of the daemon
+	tlsCert       string // PEM encoded client certificate
+	tlsKey        string // PEM encoded client key
+	skipTLSVerify bool
+	publicHost    string // Host name used in credential URLs; defaults to the daemon host
+	image         string
+	pullImage     bool
+	command       []string
+	env           map[string]string
+	ports         []string // Container ports to publish on random host ports, e.g. 22/tcp
+	volumes       []string // Container paths that each get a volume of their own
+	createNetwork bool
+	memoryBytes   int64
+	nanoCPUs      int64
+	sshPort       string // Published port that accepts SSH logins, if any
+	sshUsername   string
+	passwordEnv   []string // Environment variables the generated lab password is passed in
+	publicKeyEnv  string   // Environment variable a generated SSH public key is passed in, if any
+	webScheme     string
+	// Policy for the generated lab password
+	passwordPolicy PasswordPolicy
+	requestTimeout time.Duration
+	httpDoer       HTTPDoer // Replaces the real HTTP client, set with SetHTTPDoer
+}
+
+// NewDockerService creates a new Docker container service instance. The daemon defaults to the
+// standard DOCKER_HOST environment variable.
+func NewDockerService() *DockerService {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = dockerDefaultHost
+	}
+
+	return &DockerService{
+		host:           host,
+		pullImage:      true,
+		env:            make(map[string]string),
+		sshUsername:    "lab",
+		webScheme:      "http",
+		passwordPolicy: passwordPolicyFromEnv(""),
+		requestTimeout: 5 * time.Minute,
+	}
+}
+
+// ConfigureFromServiceConfig configures the service from a service configuration
+func (v *DockerService) ConfigureFromServiceConfig(config map[string]string) {
+	if host, ok := config["host"]; ok && host != "" {
+		v.host = host
+	}
+	if caCert, ok := config["tls_ca_cert"]; ok {
+		v.tlsCACert = caCert
+	}
+	if cert, ok := config["tls_cert"]; ok {
+		v.tlsCert = cert
+	}
+	if key, ok := config["tls_key"]; ok {
+		v.tlsKey = key
+	}
+	if skipTLSVerify, ok := config["skip_tls_verify"]; ok {
+		v.skipTLSVerify = skipTLSVerify == "true"
+	}
+	if publicHost, ok := config["public_host"]; ok {
+		v.publicHost = publicHost
+	}
+	if image, ok := config["image"]; ok {
+		v.image = image
+	}
+	if pullImage, ok := config["pull_image"]; ok {
+		v.pullImage = pullImage != "false"
+	}
+	if command, ok := config["command"]; ok {
+		v.command = strings.Fields(command)
+	}
+	if env, ok := config["env"]; ok {
+		v.env = parseHTTPPairs(env, "=")
+	}
+	if ports, ok := config["ports"]; ok {
+		v.ports = nil
+		for _, port := range splitDockerList(ports) {
+			v.ports = append(v.ports, normalizeDockerPort(port))
+		}
+	}
+	if volumes, ok := config["volumes"]; ok {
+		v.volumes = splitDockerList(volumes)
+	}
+	if createNetwork, ok := config["create_network"]; ok {
+		v.createNetwork = createNetwork == "true"
+	}
+	if memory, ok := config["memory"]; ok && memory != "" {
+		if limit, err := parseDockerMemory(memory); err == nil {
+			v.memoryBytes = limit
+		} else {
+			fmt.Printf("Warning: invalid memory %q: %v\n", memory, err)
+		}
+	}
+	if cpus, ok := config["cpus"]; ok && cpus != "" {
+		if parsed, err := strconv.ParseFloat(cpus, 64); err == nil && parsed > 0 {
+			v.nanoCPUs = int64(parsed * 1e9)
+		} else {
+			fmt.Printf("Warning: invalid cpus %q\n", cpus)
+		}
+	}
+	if sshPort, ok := config["ssh_port"]; ok && sshPort != "" {
+		v.sshPort = normalizeDockerPort(sshPort)
+	}
+	if sshUsername, ok := config["ssh_username"]; ok && sshUsername != "" {
+		v.sshUsername = sshUsername
+	}
+	if passwordEnv, ok := config["password_env"]; ok {
+		v.passwordEnv = splitDockerList(passwordEnv)
+	}
+	if publicKeyEnv, ok := config["ssh_public_key_env"]; ok {
+		v.publicKeyEnv = strings.TrimSpace(publicKeyEnv)
+	}
+	if webScheme, ok := config["web_scheme"]; ok && webScheme != "" {
+		v.webScheme = webScheme
+	}
+	if requestTimeout, ok := config["request_timeout"]; ok && requestTimeout != "" {
+		if timeout, err := time.ParseDuration(requestTimeout); err == nil && timeout > 0 {
+			v.requestTimeout = timeout
+		} else {
+			fmt.Printf("Warning: invalid request_timeout %q, using %v\n", requestTimeout, v.requestTimeout)
+		}
+	}
+	v.passwordPolicy = v.passwordPolicy.withOverrides(config)
+}
+
+// splitDockerList splits a comma separated list, dropping empty entries
+func splitDockerList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// normalizeDockerPort adds the default tcp protocol to a bare port number
+func normalizeDockerPort(port string) string {
+	if !strings.Contains(port, "/") {
+		return port + "/tcp"
+	}
+	return port
+}
+
+// parseDockerMemory parses a memory limit such as 512m or 2g into bytes
+func parseDockerMemory(value string) (int64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "k"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "m"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "g"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+
+	amount, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || amount <= 0 {
+		return 0, fmt.Errorf("expected a positive size such as 512m or 2g")
+	}
+	return amount * multiplier, nil
+}
+
+// GetName returns the service name
+func (v *DockerService) GetName() string {
+	return "docker"
+}
+
+// GetDescription returns the service description
+func (v *DockerService) GetDescription() string {
+	return "Dedicated Docker container per lab"
+}
+
+// GetRequiredParams returns the required parameters for this service
+func (v *DockerService) GetRequiredParams() []string {
+	return []string{"image"}
+}
+
+// ConfigSchema describes the keys the service's configs accept (implements ConfigSchemaProvider)
+func (v *DockerService) ConfigSchema() []interfaces.ConfigField {
+	fields := []interfaces.ConfigField{
+		{Key: "host", Description: "Docker daemon, unix:///path, tcp://host:port or https://host:port", Default: dockerDefaultHost, Env: "DOCKER_HOST"},
+		{Key: "tls_ca_cert", Description: "PEM encoded CA certificate of the daemon"},
+		{Key: "tls_cert", Description: "PEM encoded client certificate"},
+		{Key: "tls_key", Description: "PEM encoded client key", Secret: true},
+		{Key: "skip_tls_verify", Description: "Skip verifying the daemon's certificate (true or false)", Default: "false"},
+		{Key: "public_host", Description: "Host name used in credential URLs, defaults to the daemon host"},
+		{Key: "image", Description: "Image each lab's container runs", Required: true},
+		{Key: "pull_image", Description: "Pull the image before creating the container (true or false)", Default: "true"},
+		{Key: "command", Description: "Command the container runs instead of the image's default"},
+		{Key: "env", Description: "Newline-separated NAME=value environment variables"},
+		{Key: "ports", Description: "Comma-separated container ports published on random host ports, e.g. 22/tcp"},
+		{Key: "volumes", Description: "Comma-separated container paths that each get a volume of their own"},
+		{Key: "create_network", Description: "Create a network for each lab's container (true or false)", Default: "false"},
+		{Key: "memory", Description: "Memory limit such as 512m or 2g"},
+		{Key: "cpus", Description: "CPU limit, e.g. 1.5"},
+		{Key: "ssh_port", Description: "Published port that accepts SSH logins"},
+		{Key: "ssh_username", Description: "User of SSH credentials", Default: "lab"},
+		{Key: "password_env", Description: "Comma-separated environment variables the generated lab password is passed in"},
+		{Key: "ssh_public_key_env", Description: "Environment variable a generated SSH public key is passed in"},
+		{Key: "web_scheme", Description: "Scheme of credential URLs for published ports", Default: "http"},
+		{Key: "request_timeout", Description: "Timeout of a single Docker API request", Default: "5m"},
+	}
+	return append(fields, passwordPolicyConfigFields()...)
+}
+
+// ServiceDataKeys returns the prefixes of the ServiceData keys the service records (implements Service interface)
+func (v *DockerService) ServiceDataKeys() []string {
+	return []string{"docker_"}
+}
+
+// DescribeResources returns the resource names the service derives from the lab ID (implements Service interface)
+func (v *DockerService) DescribeResources(labID string) map[string]string {
+	return map[string]string{
+		"docker_container_name": fmt.Sprintf("lab-%s", labID),
+		"docker_network_name":   fmt.Sprintf("lab-%s", labID),
+	}
+}
+
+// SetHTTPDoer replaces the client the service sends Docker Engine requests with, such as with a fake in tests
+func (v *DockerService) SetHTTPDoer(doer HTTPDoer) {
+	v.httpDoer = doer
+}
+
+// Name returns the service name (implements Setup interface)
+func (v *DockerService) Name() string {
+	return v.GetName()
+}
+
+// DockerClient talks to the Docker Engine API
+type DockerClient struct {
+	baseURL    string
+	httpClient HTTPDoer
+}
+
+// NewDockerClient creates a client for a daemon at a unix socket or TCP address. TLS is used for
+// https:// hosts and whenever certificates are given.
+func NewDockerClient(host, caCert, cert, key string, skipTLSVerify bool, timeout time.Duration, doer HTTPDoer) (*DockerClient, error) {
+	parsed, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Docker host %q: %w", host, err)
+	}
+
+	transport := &http.Transport{}
+	baseURL := ""
+	switch parsed.Scheme {
+	case "unix":
+		socketPath := parsed.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+		baseURL = "http://docker"
+	case "tcp", "http", "https":
+		useTLS := parsed.Scheme == "https" || caCert != "" || cert != "" || skipTLSVerify
+		if useTLS {
+			tlsConfig := &tls.Config{InsecureSkipVerify: skipTLSVerify}
+			if caCert != "" {
+				pool := x509.NewCertPool()
+				if !pool.AppendCertsFromPEM([]byte(caCert)) {
+					return nil, fmt.Errorf("tls_ca_cert does not contain a PEM certificate")
+				}
+				tlsConfig.RootCAs = pool
+			}
+			if cert != "" || key != "" {
+				keyPair, err := tls.X509KeyPair([]byte(cert), []byte(key))
+				if err != nil {
+					return nil, fmt.Errorf("invalid tls_cert or tls_key: %w", err)
+				}
+				tlsConfig.Certificates = []tls.Certificate{keyPair}
+			}
+			transport.TLSClientConfig = tlsConfig
+			baseURL = "https://" + parsed.Host
+		} else {
+			baseURL = "http://" + parsed.Host
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Docker host scheme %q, expected unix, tcp, http or https", parsed.Scheme)
+	}
+
+	return &DockerClient{
+		baseURL:    baseURL,
+		httpClient: httpDoerOr(doer, &http.Client{Timeout: timeout, Transport: transport}),
+	}, nil
+}
+
+// newClient creates a client for the configured daemon
+func (v *DockerService) newClient() (*DockerClient, error) {
+	return NewDockerClient(v.host, v.tlsCACert, v.tlsCert, v.tlsKey, v.skipTLSVerify, v.requestTimeout, v.httpDoer)
+}
+
+// do sends a request to the Engine API and decodes a JSON response into result, if given
+func (dc *DockerClient) do(ctx context.Context, method, path string, query url.Values, body interface{}, result interface{}) error {
+	resp, err := dc.send(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("failed to decode response from %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// send sends a request and returns the response, or an error carrying the daemon's message for
+// unsuccessful statuses. The caller must close the response body.
+func (dc *DockerClient) send(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	requestURL := fmt.Sprintf("%s/%s%s", dc.baseURL, dockerAPIVersion, path)
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := dc.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to Docker daemon failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var apiError struct {
+			Message string `json:"message"`
+		}
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, httpMaxResponseBody))
+		if json.Unmarshal(respBody, &apiError) != nil || apiError.Message == "" {
+			apiError.Message = string(respBody)
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%s %s: %w: %s", method, path, errDockerNotFound, apiError.Message)
+		}
+		return nil, fmt.Errorf("%s %s failed with status %d: %s", method, path, resp.StatusCode, apiError.Message)
+	}
+	return resp, nil
+}
+
+// ping checks that the daemon is reachable
+func (dc *DockerClient) ping(ctx context.Context) error {
+	resp, err := dc.send(ctx, http.MethodGet, "/_ping", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// pullImage pulls an image. The daemon streams progress messages and reports failures in the stream,
+// so it is read to the end.
+func (dc *DockerClient) pullImage(ctx context.Context, image string) error {
+	name, tag := image, "latest"
+	if at := strings.Index(image, "@"); at >= 0 {
+		name, tag = image[:at], image[at+1:]
+	} else if colon := strings.LastIndex(image, ":"); colon > strings.LastIndex(image, "/") {
+		name, tag = image[:colon], image[colon+1:]
+	}
+
+	resp, err := dc.send(ctx, http.MethodPost, "/images/create", url.Values{"fromImage": {name}, "tag": {tag}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&message); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read pull progress: %w", err)
+		}
+		if message.Error != "" {
+			return fmt.Errorf("failed to pull %s: %s", image, message.Error)
+		}
+	}
+}
+
+// createVolume creates a named volume labelled with the lab ID
+func (dc *DockerClient) createVolume(ctx context.Context, name, labID string) error {
+	return dc.do(ctx, http.MethodPost, "/volumes/create", nil, map[string]interface{}{
+		"Name":   name,
+		"Labels": map[string]string{dockerLabLabel: labID},
+	}, nil)
+}
+
+// createNetwork creates a bridge network labelled with the lab ID
+func (dc *DockerClient) createNetwork(ctx context.Context, name, labID string) error {
+	return dc.do(ctx, http.MethodPost, "/networks/create", nil, map[string]interface{}{
+		"Name":           name,
+		"CheckDuplicate": true,
+		"Labels":         map[string]string{dockerLabLabel: labID},
+	}, nil)
+}
+
+// startContainer starts a created container
+func (dc *DockerClient) startContainer(ctx context.Context, name string) error {
+	return dc.do(ctx, http.MethodPost, fmt.Sprintf("/containers/%s/start", url.PathEscape(name)), nil, nil, nil)
+}
+
+// publishedPorts returns the host port each published container port was mapped to
+func (dc *DockerClient) publishedPorts(ctx context.Context, name string) (map[string]string, error) {
+	var inspect struct {
+		NetworkSettings struct {
+			Ports map[string][]struct {
+				HostPort string `json:"HostPort"`
+			} `json:"Ports"`
+		} `json:"NetworkSettings"`
+	}
+	if err := dc.do(ctx, http.MethodGet, fmt.Sprintf("/containers/%s/json", url.PathEscape(name)), nil, nil, &inspect); err != nil {
+		return nil, err
+	}
+
+	ports := make(map[string]string)
+	for containerPort, bindings := range inspect.NetworkSettings.Ports {
+		if len(bindings) > 0 && bindings[0].HostPort != "" {
+			ports[containerPort] = bindings[0].HostPort
+		}
+	}
+	return ports, nil
+}
+
+// removeContainer force-removes a container along with its anonymous volumes
+func (dc *DockerClient) removeContainer(ctx context.Context, name string) error {
+	return dc.do(ctx, http.MethodDelete, fmt.Sprintf("/containers/%s", url.PathEscape(name)), url.Values{"force": {"true"}, "v": {"true"}}, nil, nil)
+}
+
+// removeVolume removes a named volume
+func (dc *DockerClient) removeVolume(ctx context.Context, name string) error {
+	return dc.do(ctx, http.MethodDelete, fmt.Sprintf("/volumes/%s", url.PathEscape(name)), nil, nil, nil)
+}
+
+// removeNetwork removes a network
+func (dc *DockerClient) removeNetwork(ctx context.Context, name string) error {
+	return dc.do(ctx, http.MethodDelete, fmt.Sprintf("/networks/%s", url.PathEscape(name)), nil, nil, nil)
+}
+
+// ListLabResources lists containers labelled with a lab ID
+func (v *DockerService) ListLabResources() ([]interfaces.LabResource, error) {
+	client, err := v.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	filters, _ := json.Marshal(map[string][]string{"label": {dockerLabLabel}})
+	var containers []struct {
+		Names   []string          `json:"Names"`
+		Labels  map[string]string `json:"Labels"`
+		Created int64             `json:"Created"`
+	}
+	if err := client.do(context.Background(), http.MethodGet, "/containers/json", url.Values{"all": {"true"}, "filters": {string(filters)}}, nil, &containers); err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	var resources []interfaces.LabResource
+	for _, container := range containers {
+		name := ""
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		resources = append(resources, interfaces.LabResource{
+			Name:      name,
+			LabID:     container.Labels[dockerLabLabel],
+			CreatedAt: time.Unix(container.Created, 0),
+		})
+	}
+
+	return resources, nil
+}
+
+// TestConnection verifies that the Docker daemon is reachable with the configured TLS settings
+func (v *DockerService) TestConnection() error {
+	client, err := v.newClient()
+	if err != nil {
+		return err
+	}
+	if err := client.ping(context.Background()); err != nil {
+		return fmt.Errorf("failed to reach Docker daemon at %s: %w", v.host, err)
+	}
+	return nil
+}
+
+// CheckReady checks that every published port of the lab's container accepts connections
+func (v *DockerService) CheckReady(ctx context.Context, lab *models.Lab) error {
+	for _, endpoint := range splitDockerList(lab.ServiceData["docker_endpoints"]) {
+		if err := ProbeAddress(ctx, endpoint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// credentialHost returns the host name lab users reach published ports on
+func (v *DockerService) credentialHost() string {
+	if v.publicHost != "" {
+		return v.publicHost
+	}
+	if parsed, err := url.Parse(v.host); err == nil && parsed.Scheme != "unix" && parsed.Hostname() != "" {
+		return parsed.Hostname()
+	}
+	return "localhost"
+}
+
+// ExecuteSetup pulls the configured image and runs it in a container of the lab's own
+func (v *DockerService) ExecuteSetup(ctx *interfaces.SetupContext) error {
+	// Update progress: Connecting to Docker
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Connecting to Docker", "running", "Connecting to Docker daemon...")
+	}
+
+	if v.image == "" {
+		err := fmt.Errorf("image is required")
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Connecting to Docker", "failed", err.Error())
+		}
+		return err
+	}
+
+	client, err := v.newClient()
+	if err == nil {
+		err = client.ping(ctx.Context)
+	}
+	if err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Connecting to Docker", "failed", fmt.Sprintf("Failed to connect: %v", err))
+		}
+		return fmt.Errorf("failed to connect to Docker daemon: %w", err)
+	}
+
+	// Cleanup runs on an unconfigured instance, so it needs to know which daemon to talk to
+	if ctx.Lab != nil {
+		if ctx.Lab.ServiceData == nil {
+			ctx.Lab.ServiceData = make(map[string]string)
+		}
+		ctx.Lab.ServiceData["docker_host"] = v.host
+		ctx.Lab.ServiceData["docker_tls_ca_cert"] = v.tlsCACert
+		ctx.Lab.ServiceData["docker_tls_cert"] = v.tlsCert
+		ctx.Lab.ServiceData["docker_tls_key"] = v.tlsKey
+		ctx.Lab.ServiceData["docker_skip_tls_verify"] = fmt.Sprintf("%t", v.skipTLSVerify)
+	}
+
+	// Update progress: Connecting to Docker completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Connecting to Docker", "completed", "Connected to Docker daemon")
+	}
+
+	// Update progress: Pulling Image
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Pulling Image", "running", fmt.Sprintf("Pulling %s...", v.image))
+	}
+
+	if v.pullImage {
+		fmt.Printf("- Pulling image: %s\n", v.image)
+		if err := client.pullImage(ctx.Context, v.image); err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Pulling Image", "failed", err.Error())
+			}
+			return err
+		}
+	}
+
+	// Update progress: Pulling Image completed
+	if ctx.UpdateProgress != nil {
+		message := fmt.Sprintf("Pulled %s", v.image)
+		if !v.pullImage {
+			message = fmt.Sprintf("Using local image %s", v.image)
+		}
+		ctx.UpdateProgress("Pulling Image", "completed", message)
+	}
+
+	// Update progress: Creating Container
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Creating Container", "running", "Creating lab container...")
+	}
+
+	containerName := fmt.Sprintf("lab-%s", ctx.LabID)
+	labels := map[string]string{dockerLabLabel: ctx.LabID}
+
+	env := make([]string, 0, len(v.env)+len(v.passwordEnv))
+	for name, value := range v.env {
+		env = append(env, fmt.Sprintf("%s=%s", name, value))
+	}
+	var labPassword string
+	if len(v.passwordEnv) > 0 {
+		labPassword, err = generatePassword(v.passwordPolicy)
+		if err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Creating Container", "failed", fmt.Sprintf("Failed to generate password: %v", err))
+			}
+			return fmt.Errorf("failed to generate password: %w", err)
+		}
+		for _, name := range v.passwordEnv {
+			env = append(env, fmt.Sprintf("%s=%s", name, labPassword))
+		}
+	}
+	var sshPublicKey, sshPrivateKey string
+	if v.publicKeyEnv != "" {
+		sshPublicKey, sshPrivateKey, err = GenerateSSHKeyPair(containerName)
+		if err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Creating Container", "failed", err.Error())
+			}
+			return err
+		}
+		env = append(env, fmt.Sprintf("%s=%s", v.publicKeyEnv, sshPublicKey))
+	}
+
+	hostConfig := map[string]interface{}{
+		"Memory":   v.memoryBytes,
+		"NanoCpus": v.nanoCPUs,
+	}
+
+	// Record each resource as soon as it exists, so a failure below can still clean it up
+	var volumeNames []string
+	var mounts []map[string]interface{}
+	for i, target := range v.volumes {
+		volumeName := fmt.Sprintf("lab-%s-%d", ctx.LabID, i+1)
+		fmt.Printf("- Creating volume: %s\n", volumeName)
+		if err := client.createVolume(ctx.Context, volumeName, ctx.LabID); err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Creating Container", "failed", fmt.Sprintf("Failed to create volume: %v", err))
+			}
+			return fmt.Errorf("failed to create volume %s: %w", volumeName, err)
+		}
+		volumeNames = append(volumeNames, volumeName)
+		if ctx.Lab != nil {
+			ctx.Lab.ServiceData["docker_volume_names"] = strings.Join(volumeNames, ",")
+		}
+		mounts = append(mounts, map[string]interface{}{"Type": "volume", "Source": volumeName, "Target": target})
+	}
+	if len(mounts) > 0 {
+		hostConfig["Mounts"] = mounts
+	}
+
+	if v.createNetwork {
+		networkName := fmt.Sprintf("lab-%s", ctx.LabID)
+		fmt.Printf("- Creating network: %s\n", networkName)
+		if err := client.createNetwork(ctx.Context, networkName, ctx.LabID); err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Creating Container", "failed", fmt.Sprintf("Failed to create network: %v", err))
+			}
+			return fmt.Errorf("failed to create network %s: %w", networkName, err)
+		}
+		if ctx.Lab != nil {
+			ctx.Lab.ServiceData["docker_network_name"] = networkName
+		}
+		hostConfig["NetworkMode"] = networkName
+	}
+
+	exposedPorts := make(map[string]struct{})
+	portBindings := make(map[string][]map[string]string)
+	for _, port := range v.ports {
+		exposedPorts[port] = struct{}{}
+		// An empty host port lets the daemon pick a free one
+		portBindings[port] = []map[string]string{{"HostPort": ""}}
+	}
+	hostConfig["PortBindings"] = portBindings
+
+	containerConfig := map[string]interface{}{
+		"Image":        v.image,
+		"Env":          env,
+		"Labels":       labels,
+		"ExposedPorts": exposedPorts,
+		"HostConfig":   hostConfig,
+	}
+	if len(v.command) > 0 {
+		containerConfig["Cmd"] = v.command
+	}
+
+	fmt.Printf("- Creating container: %s\n", containerName)
+	if err := client.do(ctx.Context, http.MethodPost, "/containers/create", url.Values{"name": {containerName}}, containerConfig, nil); err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Creating Container", "failed", fmt.Sprintf("Failed to create container: %v", err))
+		}
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+	if ctx.Lab != nil {
+		ctx.Lab.ServiceData["docker_container_name"] = containerName
+	}
+
+	// Update progress: Creating Container completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Creating Container", "completed", fmt.Sprintf("Container %s created", containerName))
+	}
+
+	// Update progress: Starting Container
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Starting Container", "running", "Starting lab container...")
+	}
+
+	if err := client.startContainer(ctx.Context, containerName); err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Starting Container", "failed", fmt.Sprintf("Failed to start container: %v", err))
+		}
+		return fmt.Errorf("failed to start container: %w", err)
+	}
+
+	published, err := client.publishedPorts(ctx.Context, containerName)
+	if err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Starting Container", "failed", fmt.Sprintf("Failed to read published ports: %v", err))
+		}
+		return fmt.Errorf("failed to read published ports: %w", err)
+	}
+
+	host := v.credentialHost()
+	var endpoints []string
+	for _, port := range v.ports {
+		hostPort, exists := published[port]
+		if !exists {
+			fmt.Printf("Warning: port %s of container %s was not published\n", port, containerName)
+			continue
+		}
+		endpoints = append(endpoints, net.JoinHostPort(host, hostPort))
+
+		credential := &interfaces.Credential{
+			ID:        fmt.Sprintf("docker-%s-%s", ctx.LabID, strings.ReplaceAll(port, "/", "-")),
+			LabID:     ctx.LabID,
+			Label:     fmt.Sprintf("Container Port %s", port),
+			URL:       fmt.Sprintf("%s://%s", v.webScheme, net.JoinHostPort(host, hostPort)),
+			ExpiresAt: time.Now().Add(time.Duration(ctx.Duration) * time.Minute),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+		if port == v.sshPort {
+			credential.Label = "Container SSH"
+			credential.Username = v.sshUsername
+			credential.Password = labPassword
+			credential.URL = fmt.Sprintf("ssh://%s@%s", v.sshUsername, net.JoinHostPort(host, hostPort))
+			credential.Notes = fmt.Sprintf("ssh -p %s %s@%s", hostPort, v.sshUsername, host)
+			if sshPrivateKey != "" {
+				credential.CredentialType = models.CredentialTypeSSHKey
+				credential.PublicKey = sshPublicKey
+				credential.PrivateKey = sshPrivateKey
+				credential.Notes = fmt.Sprintf("ssh -i <key file> -p %s %s@%s", hostPort, v.sshUsername, host)
+			}
+		}
+
+		if err := ctx.AddCredential(credential); err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Starting Container", "failed", fmt.Sprintf("Failed to add credential: %v", err))
+			}
+			return fmt.Errorf("failed to add Docker credential: %w", err)
+		}
+	}
+
+	if ctx.Lab != nil {
+		ctx.Lab.ServiceData["docker_endpoints"] = strings.Join(endpoints, ",")
+	}
+
+	// Update progress: Starting Container completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Starting Container", "completed", fmt.Sprintf("Container %s is running", containerName))
+	}
+
+	fmt.Printf("Docker container setup completed for lab %s\n", ctx.LabName)
+	return nil
+}
+
+// ExecuteCleanup removes the lab's container and the volumes and network created for it. Resources
+// that are already gone are treated as removed.
+func (v *DockerService) ExecuteCleanup(ctx *interfaces.CleanupContext) error {
+	// Work on a copy, since the daemon recorded for the lab overrides this instance's
+	caller := *v
+	var containerName, networkName string
+	var volumeNames []string
+	if ctx.Lab != nil && ctx.Lab.ServiceData != nil {
+		if host := ctx.Lab.ServiceData["docker_host"]; host != "" {
+			caller.host = host
+			caller.tlsCACert = ctx.Lab.ServiceData["docker_tls_ca_cert"]
+			caller.tlsCert = ctx.Lab.ServiceData["docker_tls_cert"]
+			caller.tlsKey = ctx.Lab.ServiceData["docker_tls_key"]
+			caller.skipTLSVerify = ctx.Lab.ServiceData["docker_skip_tls_verify"] == "true"
+		}
+		containerName = ctx.Lab.ServiceData["docker_container_name"]
+		networkName = ctx.Lab.ServiceData["docker_network_name"]
+		volumeNames = splitDockerList(ctx.Lab.ServiceData["docker_volume_names"])
+	}
+
+	// Fallback to the names passed in context (e.g. admin cleanup)
+	if containerName == "" {
+		if contextName, ok := ctx.Context.Value("docker_container_name").(string); ok {
+			containerName = contextName
+		}
+	}
+	if networkName == "" {
+		if contextName, ok := ctx.Context.Value("docker_network_name").(string); ok {
+			networkName = contextName
+		}
+	}
+
+	if containerName == "" && networkName == "" && len(volumeNames) == 0 {
+		fmt.Printf("No Docker resources recorded for lab %s, nothing to clean up\n", ctx.LabID)
+		ctx.SkipResource("container", "remove", "no container recorded for the lab")
+		return nil
+	}
+
+	client, err := caller.newClient()
+	if err != nil {
+		return fmt.Errorf("failed to create Docker client: %w", err)
+	}
+
+	var failed []string
+	remove := func(kind, name string, removeFunc func(context.Context, string) error) {
+		resource := fmt.Sprintf("%s %s", kind, name)
+		fmt.Printf("- Removing %s\n", resource)
+		if err := removeFunc(ctx.Context, name); err != nil {
+			if errors.Is(err, errDockerNotFound) {
+				ctx.SkipResource(resource, "remove", "not found")
+				return
+			}
+			ctx.ReportResource(resource, "remove", err)
+			failed = append(failed, fmt.Sprintf("%s: %v", resource, err))
+			return
+		}
+		ctx.ReportResource(resource, "remove", nil)
+	}
+
+	// The container goes first, volumes and networks can't be removed while it uses them
+	if containerName != "" {
+		remove("container", containerName, client.removeContainer)
+	}
+	for _, volumeName := range volumeNames {
+		remove("volume", volumeName, client.removeVolume)
+	}
+	if networkName != "" {
+		remove("network", networkName, client.removeNetwork)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to remove Docker resources: %s", strings.Join(failed, "; "))
+	}
+
+	fmt.Printf("Docker cleanup completed for lab %s\n", ctx.LabID)
+	return nil
+}
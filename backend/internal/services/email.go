@@ -0,0 +1,74 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// EmailService sends plain text email through an SMTP relay
+type EmailService struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+// NewEmailServiceFromEnv creates an email service from the SMTP_* environment variables.
+// It returns nil when SMTP_HOST is not set, meaning email is disabled.
+func NewEmailServiceFromEnv() *EmailService {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	return &EmailService{
+		host:     host,
+		port:     port,
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     os.Getenv("SMTP_FROM"),
+	}
+}
+
+// Send emails a plain text message to a single recipient
+func (e *EmailService) Send(to, subject, body string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid email header value")
+	}
+
+	from := e.from
+	if from == "" {
+		from = e.username
+	}
+
+	message := strings.Join([]string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	var auth smtp.Auth
+	if e.username != "" {
+		auth = smtp.PlainAuth("", e.username, e.password, e.host)
+	}
+
+	if err := smtp.SendMail(net.JoinHostPort(e.host, e.port), auth, from, []string{to}, []byte(message)); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", to, err)
+	}
+	return nil
+}
@@ -0,0 +1,806 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	gcpTokenURL           = "https://oauth2.googleapis.com/token"
+	gcpResourceManagerURL = "https://cloudresourcemanager.googleapis.com/v3"
+	gcpServiceUsageURL    = "https://serviceusage.googleapis.com/v1"
+	gcpBillingURL         = "https://cloudbilling.googleapis.com/v1"
+	gcpIAMURL             = "https://iam.googleapis.com/v1"
+	gcpConsoleURL         = "https://console.cloud.google.com"
+	gcpCloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+	// gcpLabLabelName labels lab projects so they can be found by the reconciler
+	gcpLabLabelName = "labby-lab-id"
+
+	// gcpLabServiceAccountID is the account ID of the service account created in each lab project
+	gcpLabServiceAccountID = "lab-user"
+
+	// gcpOperationTimeout bounds how long to wait for a long-running operation to finish
+	gcpOperationTimeout = 5 * time.Minute
+)
+
+// GCPService handles setup and cleanup of GCP projects for labs
+type GCPService struct {
+	serviceAccountKey    string   // JSON key of the service account that manages lab projects
+	parent               string   // Optional folders/{id} or organizations/{id} to create projects under
+	billingAccount       string   // Optional billing account linked to each project
+	apis                 []string // APIs enabled in each project
+	role                 string   // Role granted on the project
+	createServiceAccount bool     // Whether to create a lab service account and issue a key for it
+	members              []string // Additional principals granted the role, e.g. "user:trainee@example.com"
+	httpDoer             HTTPDoer // Replaces the real HTTP client, set with SetHTTPDoer
+}
+
+// NewGCPService creates a new GCP service instance
+func NewGCPService() *GCPService {
+	return &GCPService{
+		serviceAccountKey:    os.Getenv("GCP_SERVICE_ACCOUNT_KEY"),
+		parent:               os.Getenv("GCP_PARENT"),
+		billingAccount:       os.Getenv("GCP_BILLING_ACCOUNT"),
+		apis:                 []string{"compute.googleapis.com", "iam.googleapis.com"},
+		role:                 "roles/editor",
+		createServiceAccount: true,
+	}
+}
+
+// ConfigureFromServiceConfig configures the service from a service configuration
+func (v *GCPService) ConfigureFromServiceConfig(config map[string]string) {
+	if serviceAccountKey, ok := config["service_account_key"]; ok {
+		v.serviceAccountKey = serviceAccountKey
+	}
+	if parent, ok := config["parent"]; ok {
+		v.parent = parent
+	}
+	if billingAccount, ok := config["billing_account"]; ok {
+		v.billingAccount = billingAccount
+	}
+	if apis, ok := config["apis"]; ok {
+		v.apis = splitGCPList(apis)
+	}
+	if role, ok := config["role"]; ok && role != "" {
+		v.role = role
+	}
+	if createServiceAccount, ok := config["create_service_account"]; ok {
+		v.createServiceAccount = createServiceAccount != "false"
+	}
+	if members, ok := config["members"]; ok {
+		v.members = splitGCPList(members)
+	}
+}
+
+// splitGCPList splits a comma-separated config value, dropping empty entries
+func splitGCPList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// GetName returns the service name
+func (v *GCPService) GetName() string {
+	return "gcp"
+}
+
+// GetDescription returns the service description
+func (v *GCPService) GetDescription() string {
+	return "GCP project with scoped access"
+}
+
+// GetRequiredParams returns the required parameters for this service
+func (v *GCPService) GetRequiredParams() []string {
+	return []string{"GCP_SERVICE_ACCOUNT_KEY"}
+}
+
+// ConfigSchema describes the keys the service's configs accept (implements ConfigSchemaProvider)
+func (v *GCPService) ConfigSchema() []interfaces.ConfigField {
+	return []interfaces.ConfigField{
+		{Key: "service_account_key", Description: "JSON key of the service account that manages lab projects", Required: true, Secret: true, Env: "GCP_SERVICE_ACCOUNT_KEY"},
+		{Key: "parent", Description: "folders/{id} or organizations/{id} lab projects are created under", Env: "GCP_PARENT"},
+		{Key: "billing_account", Description: "Billing account linked to lab projects", Env: "GCP_BILLING_ACCOUNT"},
+		{Key: "apis", Description: "Comma-separated APIs enabled in lab projects", Default: "compute.googleapis.com,iam.googleapis.com"},
+		{Key: "role", Description: "Role granted on lab projects", Default: "roles/editor"},
+		{Key: "create_service_account", Description: "Create a service account and key in each lab project (true or false)", Default: "true"},
+		{Key: "members", Description: "Comma-separated principals also granted the role, e.g. user:trainee@example.com"},
+	}
+}
+
+// ServiceDataKeys returns the prefixes of the ServiceData keys the service records (implements Service interface)
+func (v *GCPService) ServiceDataKeys() []string {
+	return []string{"gcp_"}
+}
+
+// DescribeResources returns the resource names the service derives from the lab ID (implements Service interface)
+func (v *GCPService) DescribeResources(labID string) map[string]string {
+	return map[string]string{
+		"gcp_project_id": fmt.Sprintf("lab-%s", labID),
+	}
+}
+
+// SetHTTPDoer replaces the client the service sends Google Cloud requests with, such as with a fake in tests
+func (v *GCPService) SetHTTPDoer(doer HTTPDoer) {
+	v.httpDoer = doer
+}
+
+// Name returns the service name (implements Setup interface)
+func (v *GCPService) Name() string {
+	return v.GetName()
+}
+
+// GCPServiceAccountKey is the subset of a service account JSON key needed to authenticate
+type GCPServiceAccountKey struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// GCPClient represents a Google Cloud REST API client
+type GCPClient struct {
+	key        GCPServiceAccountKey
+	httpClient HTTPDoer
+	ctx        context.Context // Cancels in-flight requests, e.g. when lab setup times out
+	token      string
+}
+
+// gcpOperation is a long-running operation returned by Resource Manager and Service Usage
+type gcpOperation struct {
+	Name  string `json:"name"`
+	Done  bool   `json:"done"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// gcpIAMPolicy is a project IAM policy
+type gcpIAMPolicy struct {
+	Version      int               `json:"version,omitempty"`
+	Etag         string            `json:"etag,omitempty"`
+	Bindings     []gcpIAMBinding   `json:"bindings,omitempty"`
+	AuditConfigs []json.RawMessage `json:"auditConfigs,omitempty"`
+}
+
+// gcpIAMBinding binds a role to a set of members
+type gcpIAMBinding struct {
+	Role      string          `json:"role"`
+	Members   []string        `json:"members"`
+	Condition json.RawMessage `json:"condition,omitempty"`
+}
+
+// NewGCPClient creates a new GCP client from a service account JSON key and verifies it can authenticate
+func NewGCPClient(ctx context.Context, serviceAccountKey string, doer HTTPDoer) (*GCPClient, error) {
+	var key GCPServiceAccountKey
+	if err := json.Unmarshal([]byte(serviceAccountKey), &key); err != nil {
+		return nil, fmt.Errorf("failed to parse service account key: %w", err)
+	}
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, fmt.Errorf("service account key is missing client_email or private_key")
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = gcpTokenURL
+	}
+
+	client := &GCPClient{
+		key:        key,
+		httpClient: httpDoerOr(doer, &http.Client{Timeout: 30 * time.Second}),
+		ctx:        ctx,
+	}
+
+	// Authenticate up front so bad credentials fail fast
+	if err := client.authenticate(); err != nil {
+		return nil, fmt.Errorf("failed to authenticate: %w", err)
+	}
+
+	return client, nil
+}
+
+// authenticate exchanges a signed JWT assertion for an access token
+func (gc *GCPClient) authenticate() error {
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(gc.key.PrivateKey))
+	if err != nil {
+		return fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	now := time.Now()
+	assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   gc.key.ClientEmail,
+		"scope": gcpCloudPlatformScope,
+		"aud":   gc.key.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	assertion.Header["kid"] = gc.key.PrivateKeyID
+
+	signed, err := assertion.SignedString(privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to sign token assertion: %w", err)
+	}
+
+	fmt.Printf("Authenticating to GCP as %s\n", gc.key.ClientEmail)
+
+	data := url.Values{}
+	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	data.Set("assertion", signed)
+
+	req, err := http.NewRequestWithContext(gc.ctx, "POST", gc.key.TokenURI, strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create authentication request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := gc.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token request failed with status: %d, response: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	gc.token = result.AccessToken
+	return nil
+}
+
+// do performs an authenticated JSON request and decodes the response into out when provided
+func (gc *GCPClient) do(method, requestURL string, payload interface{}, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(gc.ctx, method, requestURL, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+gc.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := gc.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &gcpAPIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// gcpAPIError is returned when a Google Cloud API responds with a non-2xx status
+type gcpAPIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *gcpAPIError) Error() string {
+	return fmt.Sprintf("request failed with status: %d, response: %s", e.StatusCode, e.Body)
+}
+
+// isGCPNotFound reports whether err is a 404 from a Google Cloud API
+func isGCPNotFound(err error) bool {
+	apiErr, ok := err.(*gcpAPIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// waitForOperation polls a long-running operation until it completes
+func (gc *GCPClient) waitForOperation(baseURL string, operation *gcpOperation) error {
+	deadline := time.Now().Add(gcpOperationTimeout)
+	for !operation.Done {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for operation %s", operation.Name)
+		}
+		select {
+		case <-gc.ctx.Done():
+			return fmt.Errorf("stopped waiting for operation %s: %w", operation.Name, gc.ctx.Err())
+		case <-time.After(5 * time.Second):
+		}
+
+		if err := gc.do("GET", fmt.Sprintf("%s/%s", baseURL, operation.Name), nil, operation); err != nil {
+			return fmt.Errorf("failed to get operation %s: %w", operation.Name, err)
+		}
+	}
+
+	if operation.Error != nil {
+		return fmt.Errorf("operation %s failed: %s (code %d)", operation.Name, operation.Error.Message, operation.Error.Code)
+	}
+	return nil
+}
+
+// createProject creates a project labelled with the lab ID and waits for it to be ready
+func (gc *GCPClient) createProject(projectID, parent, labID string) error {
+	payload := map[string]interface{}{
+		"projectId":   projectID,
+		"displayName": projectID,
+		"labels": map[string]string{
+			gcpLabLabelName: labID,
+		},
+	}
+	if parent != "" {
+		payload["parent"] = parent
+	}
+
+	var operation gcpOperation
+	if err := gc.do("POST", gcpResourceManagerURL+"/projects", payload, &operation); err != nil {
+		return err
+	}
+	return gc.waitForOperation(gcpResourceManagerURL, &operation)
+}
+
+// deleteProject requests deletion of a project. GCP keeps it in DELETE_REQUESTED for 30 days before purging it.
+func (gc *GCPClient) deleteProject(projectID string) error {
+	return gc.do("DELETE", fmt.Sprintf("%s/projects/%s", gcpResourceManagerURL, projectID), nil, nil)
+}
+
+// linkBillingAccount links a project to a billing account
+func (gc *GCPClient) linkBillingAccount(projectID, billingAccount string) error {
+	if !strings.HasPrefix(billingAccount, "billingAccounts/") {
+		billingAccount = "billingAccounts/" + billingAccount
+	}
+	return gc.do("PUT", fmt.Sprintf("%s/projects/%s/billingInfo", gcpBillingURL, projectID), map[string]string{
+		"billingAccountName": billingAccount,
+	}, nil)
+}
+
+// enableAPIs enables services in a project and waits for the operation to complete
+func (gc *GCPClient) enableAPIs(projectID string, apis []string) error {
+	// batchEnable accepts at most 20 services per call
+	for start := 0; start < len(apis); start += 20 {
+		end := start + 20
+		if end > len(apis) {
+			end = len(apis)
+		}
+
+		var operation gcpOperation
+		if err := gc.do("POST", fmt.Sprintf("%s/projects/%s/services:batchEnable", gcpServiceUsageURL, projectID), map[string]interface{}{
+			"serviceIds": apis[start:end],
+		}, &operation); err != nil {
+			return err
+		}
+		if err := gc.waitForOperation(gcpServiceUsageURL, &operation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createServiceAccount creates a service account in a project and returns its email
+func (gc *GCPClient) createServiceAccount(projectID, accountID, displayName string) (string, error) {
+	var result struct {
+		Email string `json:"email"`
+	}
+	if err := gc.do("POST", fmt.Sprintf("%s/projects/%s/serviceAccounts", gcpIAMURL, projectID), map[string]interface{}{
+		"accountId": accountID,
+		"serviceAccount": map[string]string{
+			"displayName": displayName,
+		},
+	}, &result); err != nil {
+		return "", err
+	}
+	return result.Email, nil
+}
+
+// createServiceAccountKey issues a JSON key for a service account and returns the decoded key file
+func (gc *GCPClient) createServiceAccountKey(projectID, email string) (string, error) {
+	var result struct {
+		PrivateKeyData string `json:"privateKeyData"`
+	}
+	if err := gc.do("POST", fmt.Sprintf("%s/projects/%s/serviceAccounts/%s/keys", gcpIAMURL, projectID, email), map[string]string{}, &result); err != nil {
+		return "", err
+	}
+
+	keyData, err := base64.StdEncoding.DecodeString(result.PrivateKeyData)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode service account key: %w", err)
+	}
+	return string(keyData), nil
+}
+
+// grantProjectRole adds members to a role binding on the project IAM policy
+func (gc *GCPClient) grantProjectRole(projectID, role string, members []string) error {
+	var policy gcpIAMPolicy
+	if err := gc.do("POST", fmt.Sprintf("%s/projects/%s:getIamPolicy", gcpResourceManagerURL, projectID), map[string]interface{}{
+		"options": map[string]int{"requestedPolicyVersion": 3},
+	}, &policy); err != nil {
+		return fmt.Errorf("failed to get IAM policy: %w", err)
+	}
+
+	var binding *gcpIAMBinding
+	for i := range policy.Bindings {
+		if policy.Bindings[i].Role == role && len(policy.Bindings[i].Condition) == 0 {
+			binding = &policy.Bindings[i]
+			break
+		}
+	}
+	if binding == nil {
+		policy.Bindings = append(policy.Bindings, gcpIAMBinding{Role: role})
+		binding = &policy.Bindings[len(policy.Bindings)-1]
+	}
+	binding.Members = append(binding.Members, members...)
+
+	if err := gc.do("POST", fmt.Sprintf("%s/projects/%s:setIamPolicy", gcpResourceManagerURL, projectID), map[string]interface{}{
+		"policy": policy,
+	}, nil); err != nil {
+		return fmt.Errorf("failed to set IAM policy: %w", err)
+	}
+	return nil
+}
+
+// listLabProjects lists active projects carrying the lab label
+func (gc *GCPClient) listLabProjects() ([]interfaces.LabResource, error) {
+	query := url.QueryEscape(fmt.Sprintf("labels.%s:*", gcpLabLabelName))
+	requestURL := fmt.Sprintf("%s/projects:search?query=%s", gcpResourceManagerURL, query)
+
+	var projects []interfaces.LabResource
+	pageToken := ""
+	for {
+		pageURL := requestURL
+		if pageToken != "" {
+			pageURL += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+
+		var result struct {
+			Projects []struct {
+				ProjectID  string            `json:"projectId"`
+				State      string            `json:"state"`
+				Labels     map[string]string `json:"labels"`
+				CreateTime time.Time         `json:"createTime"`
+			} `json:"projects"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := gc.do("GET", pageURL, nil, &result); err != nil {
+			return nil, err
+		}
+
+		for _, project := range result.Projects {
+			if project.State != "ACTIVE" {
+				continue
+			}
+			projects = append(projects, interfaces.LabResource{
+				Name:      project.ProjectID,
+				LabID:     project.Labels[gcpLabLabelName],
+				CreatedAt: project.CreateTime,
+			})
+		}
+
+		if result.NextPageToken == "" {
+			break
+		}
+		pageToken = result.NextPageToken
+	}
+
+	return projects, nil
+}
+
+// ListLabResources lists active projects labelled with a lab ID
+func (v *GCPService) ListLabResources() ([]interfaces.LabResource, error) {
+	if v.serviceAccountKey == "" {
+		return nil, fmt.Errorf("GCP_SERVICE_ACCOUNT_KEY configuration is required")
+	}
+
+	client, err := NewGCPClient(context.Background(), v.serviceAccountKey, v.httpDoer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCP client: %w", err)
+	}
+
+	return client.listLabProjects()
+}
+
+// TestConnection verifies the service account key and its access to Resource Manager
+func (v *GCPService) TestConnection() error {
+	if v.serviceAccountKey == "" {
+		return fmt.Errorf("service_account_key is required")
+	}
+
+	client, err := NewGCPClient(context.Background(), v.serviceAccountKey, v.httpDoer)
+	if err != nil {
+		return err
+	}
+
+	requestURL := fmt.Sprintf("%s/projects:search?pageSize=1", gcpResourceManagerURL)
+	if v.parent != "" {
+		requestURL = fmt.Sprintf("%s/%s", gcpResourceManagerURL, v.parent)
+	}
+	if err := client.do("GET", requestURL, nil, nil); err != nil {
+		return fmt.Errorf("failed to query Resource Manager: %w", err)
+	}
+
+	return nil
+}
+
+// ExecuteSetup creates a project for the lab, enables APIs and grants the lab user access to it
+func (v *GCPService) ExecuteSetup(ctx *interfaces.SetupContext) error {
+	// Update progress: Authenticating to GCP
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Authenticating to GCP", "running", "Authenticating to GCP...")
+	}
+
+	if v.serviceAccountKey == "" {
+		err := fmt.Errorf("GCP_SERVICE_ACCOUNT_KEY environment variable is required")
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Authenticating to GCP", "failed", err.Error())
+		}
+		return err
+	}
+
+	if !v.createServiceAccount && len(v.members) == 0 {
+		err := fmt.Errorf("members is required when create_service_account is false")
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Authenticating to GCP", "failed", err.Error())
+		}
+		return err
+	}
+
+	// Use lab ID directly as it's already the short ID
+	shortID := ctx.LabID
+
+	fmt.Printf("Setting up GCP project for lab %s...\n", ctx.LabName)
+
+	// Create GCP client
+	client, err := NewGCPClient(ctx.Context, v.serviceAccountKey, v.httpDoer)
+	if err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Authenticating to GCP", "failed", fmt.Sprintf("Failed to authenticate: %v", err))
+		}
+		return fmt.Errorf("failed to create GCP client: %w", err)
+	}
+
+	// Update progress: Authenticating to GCP completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Authenticating to GCP", "completed", "Successfully authenticated to GCP")
+	}
+
+	// Store configuration for cleanup before creating anything
+	projectID := fmt.Sprintf("lab-%s", shortID)
+	if ctx.Lab != nil {
+		if ctx.Lab.ServiceData == nil {
+			ctx.Lab.ServiceData = make(map[string]string)
+		}
+		ctx.Lab.ServiceData["gcp_service_account_key"] = v.serviceAccountKey
+		ctx.Lab.ServiceData["gcp_project_id"] = projectID
+	}
+	ctx.Context = context.WithValue(ctx.Context, "gcp_project_id", projectID)
+
+	// Update progress: Creating Project
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Creating Project", "running", "Creating GCP project...")
+	}
+
+	fmt.Printf("- Creating project: %s\n", projectID)
+	if err := client.createProject(projectID, v.parent, shortID); err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Creating Project", "failed", fmt.Sprintf("Failed to create project: %v", err))
+		}
+		return fmt.Errorf("failed to create project: %w", err)
+	}
+	fmt.Printf("  Project created successfully\n")
+
+	if v.billingAccount != "" {
+		fmt.Printf("- Linking billing account: %s\n", v.billingAccount)
+		if err := client.linkBillingAccount(projectID, v.billingAccount); err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Creating Project", "failed", fmt.Sprintf("Failed to link billing account: %v", err))
+			}
+			return fmt.Errorf("failed to link billing account: %w", err)
+		}
+		fmt.Printf("  Billing account linked successfully\n")
+	}
+
+	// Update progress: Creating Project completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Creating Project", "completed", "GCP project created successfully")
+	}
+
+	// Update progress: Enabling APIs
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Enabling APIs", "running", fmt.Sprintf("Enabling %d APIs...", len(v.apis)))
+	}
+
+	if len(v.apis) > 0 {
+		fmt.Printf("- Enabling APIs: %s\n", strings.Join(v.apis, ", "))
+		if err := client.enableAPIs(projectID, v.apis); err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Enabling APIs", "failed", fmt.Sprintf("Failed to enable APIs: %v", err))
+			}
+			return fmt.Errorf("failed to enable APIs: %w", err)
+		}
+		fmt.Printf("  APIs enabled successfully\n")
+	}
+
+	// Update progress: Enabling APIs completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Enabling APIs", "completed", "APIs enabled successfully")
+	}
+
+	// Update progress: Granting Access
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Granting Access", "running", "Granting access to the project...")
+	}
+
+	members := append([]string{}, v.members...)
+	var serviceAccountEmail, serviceAccountKey string
+	if v.createServiceAccount {
+		fmt.Printf("- Creating service account: %s\n", gcpLabServiceAccountID)
+		serviceAccountEmail, err = client.createServiceAccount(projectID, gcpLabServiceAccountID, fmt.Sprintf("Lab %s user", shortID))
+		if err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Granting Access", "failed", fmt.Sprintf("Failed to create service account: %v", err))
+			}
+			return fmt.Errorf("failed to create service account: %w", err)
+		}
+		fmt.Printf("  Service account created: %s\n", serviceAccountEmail)
+
+		if ctx.Lab != nil {
+			ctx.Lab.ServiceData["gcp_lab_service_account"] = serviceAccountEmail
+		}
+		members = append(members, "serviceAccount:"+serviceAccountEmail)
+	}
+
+	// New service accounts take a few seconds to propagate, so retry the binding
+	fmt.Printf("- Granting %s to %s\n", v.role, strings.Join(members, ", "))
+	for attempt := 1; attempt <= 6; attempt++ {
+		err = client.grantProjectRole(projectID, v.role, members)
+		if err == nil {
+			break
+		}
+		fmt.Printf("  Failed to grant role (attempt %d), retrying: %v\n", attempt, err)
+		time.Sleep(time.Duration(attempt) * 5 * time.Second)
+	}
+	if err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Granting Access", "failed", fmt.Sprintf("Failed to grant role: %v", err))
+		}
+		return fmt.Errorf("failed to grant project role: %w", err)
+	}
+	fmt.Printf("  Role granted successfully\n")
+
+	if v.createServiceAccount {
+		serviceAccountKey, err = client.createServiceAccountKey(projectID, serviceAccountEmail)
+		if err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Granting Access", "failed", fmt.Sprintf("Failed to create service account key: %v", err))
+			}
+			return fmt.Errorf("failed to create service account key: %w", err)
+		}
+	}
+
+	// Add credential to lab
+	credential := &interfaces.Credential{
+		ID:        fmt.Sprintf("gcp-%s", shortID),
+		LabID:     ctx.LabID,
+		Label:     "GCP",
+		URL:       fmt.Sprintf("%s/home/dashboard?project=%s", gcpConsoleURL, projectID),
+		ExpiresAt: time.Now().Add(time.Duration(ctx.Duration) * time.Minute),
+		Notes:     fmt.Sprintf("Project: %s, Role: %s", projectID, v.role),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if v.createServiceAccount {
+		credential.Label = "GCP Service Account"
+		credential.Username = serviceAccountEmail
+		credential.Password = serviceAccountKey
+	}
+
+	if err := ctx.AddCredential(credential); err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Granting Access", "failed", fmt.Sprintf("Failed to add credential: %v", err))
+		}
+		return fmt.Errorf("failed to add GCP credential: %w", err)
+	}
+
+	// Update progress: Granting Access completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Granting Access", "completed", "Access granted successfully")
+	}
+
+	fmt.Printf("GCP setup completed for lab %s\n", ctx.LabName)
+	return nil
+}
+
+// ExecuteCleanup deletes the lab project, which also removes its service accounts, keys and IAM bindings.
+// GCP keeps deleted projects for 30 days before purging them, and the project ID cannot be reused until then.
+func (v *GCPService) ExecuteCleanup(ctx *interfaces.CleanupContext) error {
+	// Use lab ID directly as it's already the short ID
+	shortID := ctx.LabID
+
+	// Get configuration from lab's ServiceData
+	var serviceAccountKey, projectID string
+	if ctx.Lab != nil && ctx.Lab.ServiceData != nil {
+		serviceAccountKey = ctx.Lab.ServiceData["gcp_service_account_key"]
+		projectID = ctx.Lab.ServiceData["gcp_project_id"]
+	}
+
+	// Fallback to environment variables if not in ServiceData
+	if serviceAccountKey == "" {
+		serviceAccountKey = v.serviceAccountKey
+	}
+
+	// Fallback to context values (e.g. admin cleanup), then to the lab naming convention
+	if projectID == "" {
+		if contextID, ok := ctx.Context.Value("gcp_project_id").(string); ok {
+			projectID = contextID
+		} else {
+			projectID = fmt.Sprintf("lab-%s", shortID)
+			fmt.Printf("Warning: gcp project ID not found in context or lab data, using constructed ID: %s\n", projectID)
+		}
+	}
+
+	// Validate required configuration
+	if serviceAccountKey == "" {
+		return fmt.Errorf("GCP_SERVICE_ACCOUNT_KEY configuration not found in lab data or environment")
+	}
+
+	// Create GCP client for cleanup
+	client, err := NewGCPClient(ctx.Context, serviceAccountKey, v.httpDoer)
+	if err != nil {
+		return fmt.Errorf("failed to create GCP client for cleanup: %w", err)
+	}
+
+	fmt.Printf("Cleaning up GCP resources for lab %s:\n", ctx.LabID)
+
+	fmt.Printf("- Deleting project: %s\n", projectID)
+	err = client.deleteProject(projectID)
+	if isGCPNotFound(err) {
+		ctx.SkipResource("project "+projectID, "delete", "not found")
+	} else {
+		ctx.ReportResource("project "+projectID, "delete", err)
+	}
+	if err != nil && !isGCPNotFound(err) {
+		return fmt.Errorf("failed to delete project %s: %w", projectID, err)
+	}
+	fmt.Printf("  Project deletion requested (GCP purges it after 30 days)\n")
+
+	fmt.Printf("GCP cleanup completed for lab %s\n", ctx.LabID)
+	return nil
+}
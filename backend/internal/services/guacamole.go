@@ -10,28 +10,44 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/wcrum/labby/internal/interfaces"
-
-	"github.com/sethvargo/go-password/password"
+	"github.com/wcrum/labby/internal/models"
 )
 
 // GuacamoleService handles setup and cleanup for Guacamole user accounts
 type GuacamoleService struct {
-	host          string
-	adminUsername string
-	adminPassword string
-	skipTLSVerify bool
+	host           string
+	adminUsername  string
+	adminPassword  string
+	skipTLSVerify  bool
+	connections    []GuacamoleConnectionTemplate
+	passwordPolicy PasswordPolicy
+	// Retries for authenticating to the appliance when it is briefly unreachable
+	authRetry AuthRetryPolicy
+	// Replaces the real HTTP client, set with SetHTTPDoer
+	httpDoer HTTPDoer
+}
+
+// GuacamoleConnectionTemplate describes a connection to create for each lab.
+// Parameter values may reference lab ServiceData keys (e.g. "${proxmox_vm_ip}") and "${lab_id}".
+type GuacamoleConnectionTemplate struct {
+	Name       string            `json:"name"`
+	Protocol   string            `json:"protocol"`
+	Parameters map[string]string `json:"parameters"`
 }
 
 // NewGuacamoleService creates a new Guacamole service instance
 func NewGuacamoleService() *GuacamoleService {
 	return &GuacamoleService{
-		host:          os.Getenv("GUACAMOLE_HOST"),
-		adminUsername: os.Getenv("GUACAMOLE_ADMIN_USERNAME"),
-		adminPassword: os.Getenv("GUACAMOLE_ADMIN_PASSWORD"),
-		skipTLSVerify: os.Getenv("GUACAMOLE_SKIP_TLS_VERIFY") == "true",
+		host:           os.Getenv("GUACAMOLE_HOST"),
+		adminUsername:  os.Getenv("GUACAMOLE_ADMIN_USERNAME"),
+		adminPassword:  os.Getenv("GUACAMOLE_ADMIN_PASSWORD"),
+		skipTLSVerify:  os.Getenv("GUACAMOLE_SKIP_TLS_VERIFY") == "true",
+		passwordPolicy: passwordPolicyFromEnv(""),
+		authRetry:      authRetryPolicyFromEnv(),
 	}
 }
 
@@ -49,6 +65,29 @@ func (v *GuacamoleService) ConfigureFromServiceConfig(config map[string]string)
 	if skipTLSVerify, ok := config["skip_tls_verify"]; ok {
 		v.skipTLSVerify = skipTLSVerify == "true"
 	}
+	if connections, ok := config["connections"]; ok && connections != "" {
+		var templates []GuacamoleConnectionTemplate
+		if err := json.Unmarshal([]byte(connections), &templates); err != nil {
+			fmt.Printf("Warning: Failed to parse Guacamole connections config: %v\n", err)
+		} else {
+			v.connections = templates
+		}
+	}
+	v.passwordPolicy = v.passwordPolicy.withOverrides(config)
+	v.authRetry = v.authRetry.withOverrides(config)
+}
+
+// renderConnectionParameters substitutes lab ServiceData values into connection parameters
+func renderConnectionParameters(parameters map[string]string, labID string, serviceData map[string]string) map[string]string {
+	rendered := make(map[string]string, len(parameters))
+	for key, value := range parameters {
+		value = strings.ReplaceAll(value, "${lab_id}", labID)
+		for dataKey, dataValue := range serviceData {
+			value = strings.ReplaceAll(value, fmt.Sprintf("${%s}", dataKey), dataValue)
+		}
+		rendered[key] = value
+	}
+	return rendered
 }
 
 // GetName returns the service name
@@ -66,6 +105,37 @@ func (v *GuacamoleService) GetRequiredParams() []string {
 	return []string{"GUACAMOLE_HOST", "GUACAMOLE_ADMIN_USERNAME", "GUACAMOLE_ADMIN_PASSWORD"}
 }
 
+// ConfigSchema describes the keys the service's configs accept (implements ConfigSchemaProvider)
+func (v *GuacamoleService) ConfigSchema() []interfaces.ConfigField {
+	fields := []interfaces.ConfigField{
+		{Key: "host", Description: "Guacamole URL", Required: true, Env: "GUACAMOLE_HOST"},
+		{Key: "admin_username", Description: "Guacamole admin that creates lab users and connections", Required: true, Env: "GUACAMOLE_ADMIN_USERNAME"},
+		{Key: "admin_password", Description: "Password of admin_username", Required: true, Secret: true, Env: "GUACAMOLE_ADMIN_PASSWORD"},
+		{Key: "skip_tls_verify", Description: "Skip verifying the Guacamole certificate (true or false)", Default: "false", Env: "GUACAMOLE_SKIP_TLS_VERIFY"},
+		{Key: "connections", Description: "JSON list of connections created for each lab user, parameters may use ${lab_id} and ServiceData keys"},
+	}
+	fields = append(fields, passwordPolicyConfigFields()...)
+	return append(fields, authRetryConfigFields()...)
+}
+
+// ServiceDataKeys returns the prefixes of the ServiceData keys the service records (implements Service interface)
+func (v *GuacamoleService) ServiceDataKeys() []string {
+	return []string{"guacamole_"}
+}
+
+// DescribeResources returns the resource names the service derives from the lab ID (implements Service interface)
+func (v *GuacamoleService) DescribeResources(labID string) map[string]string {
+	return map[string]string{
+		"guacamole_user_username":         fmt.Sprintf("lab-%s", labID),
+		"guacamole_connection_group_name": fmt.Sprintf("lab-%s", labID),
+	}
+}
+
+// SetHTTPDoer replaces the client the service sends Guacamole requests with, such as with a fake in tests
+func (v *GuacamoleService) SetHTTPDoer(doer HTTPDoer) {
+	v.httpDoer = doer
+}
+
 // Name returns the service name (implements Setup interface)
 func (v *GuacamoleService) Name() string {
 	return v.GetName()
@@ -74,12 +144,13 @@ func (v *GuacamoleService) Name() string {
 // GuacamoleClient represents a Guacamole API client
 type GuacamoleClient struct {
 	baseURL    string
-	httpClient *http.Client
+	httpClient HTTPDoer
+	ctx        context.Context // Cancels in-flight requests, e.g. when lab setup times out
 	authToken  string
 }
 
 // NewGuacamoleClient creates a new Guacamole client
-func NewGuacamoleClient(baseURL, username, password string, skipTLSVerify bool) (*GuacamoleClient, error) {
+func NewGuacamoleClient(ctx context.Context, baseURL, username, password string, skipTLSVerify bool, retry AuthRetryPolicy, doer HTTPDoer) (*GuacamoleClient, error) {
 	// Create HTTP client with TLS configuration
 	httpClient := &http.Client{
 		Timeout: 30 * time.Second,
@@ -92,11 +163,15 @@ func NewGuacamoleClient(baseURL, username, password string, skipTLSVerify bool)
 
 	client := &GuacamoleClient{
 		baseURL:    baseURL,
-		httpClient: httpClient,
+		httpClient: httpDoerOr(doer, httpClient),
+		ctx:        ctx,
 	}
 
 	// Authenticate and get token
-	if err := client.authenticate(username, password); err != nil {
+	err := retryAuthenticate(ctx, retry, baseURL, func() error {
+		return client.authenticate(username, password)
+	})
+	if err != nil {
 		return nil, fmt.Errorf("failed to authenticate: %w", err)
 	}
 
@@ -123,7 +198,13 @@ func (gc *GuacamoleClient) authenticate(username, password string) error {
 	fmt.Printf("Authenticating to Guacamole at: %s\n", loginURL)
 	fmt.Printf("Using admin user: %s\n", username)
 
-	resp, err := gc.httpClient.PostForm(loginURL, data)
+	req, err := http.NewRequestWithContext(gc.ctx, "POST", loginURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create authentication request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := gc.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("authentication request failed: %w", err)
 	}
@@ -139,7 +220,11 @@ func (gc *GuacamoleClient) authenticate(username, password string) error {
 	fmt.Printf("Authentication response body: %s\n", string(body))
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("authentication failed with status: %d, response: %s", resp.StatusCode, string(body))
+		err := fmt.Errorf("authentication failed with status: %d, response: %s", resp.StatusCode, string(body))
+		if isAuthRejectedStatus(resp.StatusCode) {
+			return &authRejectedError{err: err}
+		}
+		return err
 	}
 
 	var result GuacamoleTokenResponse
@@ -184,7 +269,7 @@ func (gc *GuacamoleClient) createUser(username, password string) error {
 		return fmt.Errorf("failed to marshal user request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", createURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(gc.ctx, "POST", createURL, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -218,11 +303,36 @@ func (gc *GuacamoleClient) createUser(username, password string) error {
 	return nil
 }
 
+// updateUserPassword replaces a Guacamole user's password
+func (gc *GuacamoleClient) updateUserPassword(username, password string) error {
+	updateURL := fmt.Sprintf("%s/guacamole/api/session/data/mysql/users/%s", gc.baseURL, url.PathEscape(username))
+
+	// Updating a user replaces it, so the attributes are sent as they were at creation
+	userReq := GuacamoleUserRequest{
+		Username: username,
+		Password: password,
+		Attributes: map[string]interface{}{
+			"expired":             "",
+			"access-window-start": "",
+			"access-window-end":   "",
+			"valid-from":          "",
+			"valid-until":         "",
+			"timezone":            nil,
+		},
+	}
+
+	fmt.Printf("Updating password of Guacamole user: %s\n", username)
+	if _, err := gc.doJSON("PUT", updateURL, userReq); err != nil {
+		return fmt.Errorf("update user failed: %w", err)
+	}
+	return nil
+}
+
 // deleteUser deletes a Guacamole user
 func (gc *GuacamoleClient) deleteUser(username string) error {
 	deleteURL := fmt.Sprintf("%s/guacamole/api/session/data/mysql/users/%s", gc.baseURL, url.PathEscape(username))
 
-	req, err := http.NewRequest("DELETE", deleteURL, nil)
+	req, err := http.NewRequestWithContext(gc.ctx, "DELETE", deleteURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -254,6 +364,205 @@ func (gc *GuacamoleClient) deleteUser(username string) error {
 	return nil
 }
 
+// GuacamoleConnectionGroupRequest represents the request to create a Guacamole connection group
+type GuacamoleConnectionGroupRequest struct {
+	ParentIdentifier string                 `json:"parentIdentifier"`
+	Name             string                 `json:"name"`
+	Type             string                 `json:"type"`
+	Attributes       map[string]interface{} `json:"attributes"`
+}
+
+// GuacamoleConnectionRequest represents the request to create a Guacamole connection
+type GuacamoleConnectionRequest struct {
+	ParentIdentifier string                 `json:"parentIdentifier"`
+	Name             string                 `json:"name"`
+	Protocol         string                 `json:"protocol"`
+	Parameters       map[string]string      `json:"parameters"`
+	Attributes       map[string]interface{} `json:"attributes"`
+}
+
+// GuacamolePermissionPatch represents a single permission change for a Guacamole user
+type GuacamolePermissionPatch struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value string `json:"value"`
+}
+
+// doJSON sends a JSON request to the Guacamole API and returns the response body
+func (gc *GuacamoleClient) doJSON(method, requestURL string, payload interface{}) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(gc.ctx, method, requestURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Guacamole-Token", gc.authToken)
+
+	resp, err := gc.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return nil, fmt.Errorf("request failed with status: %d, response: %s", resp.StatusCode, string(respBody))
+	}
+
+	return respBody, nil
+}
+
+// createConnectionGroup creates a new organizational connection group under ROOT and returns its identifier
+func (gc *GuacamoleClient) createConnectionGroup(name string) (string, error) {
+	createURL := fmt.Sprintf("%s/guacamole/api/session/data/mysql/connectionGroups", gc.baseURL)
+
+	fmt.Printf("Creating Guacamole connection group: %s\n", name)
+
+	body, err := gc.doJSON("POST", createURL, GuacamoleConnectionGroupRequest{
+		ParentIdentifier: "ROOT",
+		Name:             name,
+		Type:             "ORGANIZATIONAL",
+		Attributes:       map[string]interface{}{},
+	})
+	if err != nil {
+		return "", fmt.Errorf("create connection group failed: %w", err)
+	}
+
+	var result struct {
+		Identifier string `json:"identifier"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to decode connection group response: %w", err)
+	}
+
+	return result.Identifier, nil
+}
+
+// findConnectionGroup looks up a connection group identifier by name
+func (gc *GuacamoleClient) findConnectionGroup(name string) (string, error) {
+	listURL := fmt.Sprintf("%s/guacamole/api/session/data/mysql/connectionGroups", gc.baseURL)
+
+	body, err := gc.doJSON("GET", listURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("list connection groups failed: %w", err)
+	}
+
+	var groups map[string]struct {
+		Identifier string `json:"identifier"`
+		Name       string `json:"name"`
+	}
+	if err := json.Unmarshal(body, &groups); err != nil {
+		return "", fmt.Errorf("failed to decode connection groups response: %w", err)
+	}
+
+	for _, group := range groups {
+		if group.Name == name {
+			return group.Identifier, nil
+		}
+	}
+
+	return "", nil
+}
+
+// deleteConnectionGroup deletes a connection group along with the connections it contains
+func (gc *GuacamoleClient) deleteConnectionGroup(identifier string) error {
+	deleteURL := fmt.Sprintf("%s/guacamole/api/session/data/mysql/connectionGroups/%s", gc.baseURL, url.PathEscape(identifier))
+
+	fmt.Printf("Deleting Guacamole connection group: %s\n", identifier)
+
+	if _, err := gc.doJSON("DELETE", deleteURL, nil); err != nil {
+		return fmt.Errorf("delete connection group failed: %w", err)
+	}
+
+	return nil
+}
+
+// createConnection creates a connection inside the given connection group and returns its identifier
+func (gc *GuacamoleClient) createConnection(groupID, name, protocol string, parameters map[string]string) (string, error) {
+	createURL := fmt.Sprintf("%s/guacamole/api/session/data/mysql/connections", gc.baseURL)
+
+	fmt.Printf("Creating Guacamole %s connection: %s\n", protocol, name)
+
+	body, err := gc.doJSON("POST", createURL, GuacamoleConnectionRequest{
+		ParentIdentifier: groupID,
+		Name:             name,
+		Protocol:         protocol,
+		Parameters:       parameters,
+		Attributes:       map[string]interface{}{},
+	})
+	if err != nil {
+		return "", fmt.Errorf("create connection failed: %w", err)
+	}
+
+	var result struct {
+		Identifier string `json:"identifier"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to decode connection response: %w", err)
+	}
+
+	return result.Identifier, nil
+}
+
+// grantAccess grants a user read access to a connection group and its connections
+func (gc *GuacamoleClient) grantAccess(username, groupID string, connectionIDs []string) error {
+	patchURL := fmt.Sprintf("%s/guacamole/api/session/data/mysql/users/%s/permissions", gc.baseURL, url.PathEscape(username))
+
+	patches := []GuacamolePermissionPatch{
+		{Op: "add", Path: fmt.Sprintf("/connectionGroupPermissions/%s", groupID), Value: "READ"},
+	}
+	for _, connectionID := range connectionIDs {
+		patches = append(patches, GuacamolePermissionPatch{
+			Op:    "add",
+			Path:  fmt.Sprintf("/connectionPermissions/%s", connectionID),
+			Value: "READ",
+		})
+	}
+
+	fmt.Printf("Granting %s access to connection group %s (%d connections)\n", username, groupID, len(connectionIDs))
+
+	if _, err := gc.doJSON("PATCH", patchURL, patches); err != nil {
+		return fmt.Errorf("grant access failed: %w", err)
+	}
+
+	return nil
+}
+
+// TestConnection verifies the host and admin credentials by requesting an auth token
+func (v *GuacamoleService) TestConnection() error {
+	if v.host == "" || v.adminUsername == "" || v.adminPassword == "" {
+		return fmt.Errorf("host, admin_username and admin_password are required")
+	}
+
+	// A single attempt so the test reports the problem instead of waiting it out
+	if _, err := NewGuacamoleClient(context.Background(), v.host, v.adminUsername, v.adminPassword, v.skipTLSVerify, AuthRetryPolicy{Attempts: 1}, v.httpDoer); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CheckReady checks that the Guacamole web UI lab users log in to is answering
+func (v *GuacamoleService) CheckReady(ctx context.Context, lab *models.Lab) error {
+	if v.host == "" {
+		return fmt.Errorf("host is required")
+	}
+	return ProbeURL(ctx, v.host, v.skipTLSVerify, v.httpDoer)
+}
+
 // ExecuteSetup sets up Guacamole user access and adds credentials
 func (v *GuacamoleService) ExecuteSetup(ctx *interfaces.SetupContext) error {
 	// Update progress: Connecting to Guacamole
@@ -275,7 +584,7 @@ func (v *GuacamoleService) ExecuteSetup(ctx *interfaces.SetupContext) error {
 	fmt.Printf("Setting up Guacamole user for lab %s...\n", ctx.LabName)
 
 	// Create Guacamole client
-	client, err := NewGuacamoleClient(v.host, v.adminUsername, v.adminPassword, v.skipTLSVerify)
+	client, err := NewGuacamoleClient(ctx.Context, v.host, v.adminUsername, v.adminPassword, v.skipTLSVerify, v.authRetry, v.httpDoer)
 	if err != nil {
 		if ctx.UpdateProgress != nil {
 			ctx.UpdateProgress("Connecting to Guacamole", "failed", fmt.Sprintf("Failed to connect: %v", err))
@@ -295,7 +604,7 @@ func (v *GuacamoleService) ExecuteSetup(ctx *interfaces.SetupContext) error {
 
 	// Generate username and password for lab user
 	labUsername := fmt.Sprintf("lab-%s", shortID)
-	labPassword, err := password.Generate(16, 4, 4, false, false)
+	labPassword, err := generatePassword(v.passwordPolicy)
 	if err != nil {
 		if ctx.UpdateProgress != nil {
 			ctx.UpdateProgress("Creating User Account", "failed", fmt.Sprintf("Failed to generate password: %v", err))
@@ -318,9 +627,57 @@ func (v *GuacamoleService) ExecuteSetup(ctx *interfaces.SetupContext) error {
 		ctx.UpdateProgress("Creating User Account", "completed", "Guacamole user account created successfully")
 	}
 
+	// Update progress: Creating Connections
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Creating Connections", "running", "Creating Guacamole connection group...")
+	}
+
+	// Create a connection group per lab so multi-machine labs stay organized
+	groupName := fmt.Sprintf("lab-%s", shortID)
+	groupID, err := client.createConnectionGroup(groupName)
+	if err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Creating Connections", "failed", fmt.Sprintf("Failed to create connection group: %v", err))
+		}
+		return fmt.Errorf("failed to create connection group: %w", err)
+	}
+	fmt.Printf("  Connection group created successfully: %s\n", groupID)
+
+	// Resolve connection parameters from data provisioned by other services
+	var serviceData map[string]string
+	if ctx.Lab != nil {
+		serviceData = ctx.Lab.ServiceData
+	}
+
+	var connectionIDs []string
+	for _, connection := range v.connections {
+		parameters := renderConnectionParameters(connection.Parameters, ctx.LabID, serviceData)
+		connectionID, err := client.createConnection(groupID, connection.Name, connection.Protocol, parameters)
+		if err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Creating Connections", "failed", fmt.Sprintf("Failed to create connection %s: %v", connection.Name, err))
+			}
+			return fmt.Errorf("failed to create connection %s: %w", connection.Name, err)
+		}
+		connectionIDs = append(connectionIDs, connectionID)
+	}
+
+	if err := client.grantAccess(labUsername, groupID, connectionIDs); err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Creating Connections", "failed", fmt.Sprintf("Failed to grant access: %v", err))
+		}
+		return fmt.Errorf("failed to grant connection access: %w", err)
+	}
+
+	// Update progress: Creating Connections completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Creating Connections", "completed", fmt.Sprintf("Created %d connections in group %s", len(connectionIDs), groupName))
+	}
+
 	// Store lab-specific data in context for cleanup
 	ctx.Context = context.WithValue(ctx.Context, "guacamole_user_username", labUsername)
 	ctx.Context = context.WithValue(ctx.Context, "guacamole_user_password", labPassword)
+	ctx.Context = context.WithValue(ctx.Context, "guacamole_connection_group_id", groupID)
 
 	// Store in lab's ServiceData for persistence
 	if ctx.Lab != nil {
@@ -329,6 +686,7 @@ func (v *GuacamoleService) ExecuteSetup(ctx *interfaces.SetupContext) error {
 		}
 		ctx.Lab.ServiceData["guacamole_user_username"] = labUsername
 		ctx.Lab.ServiceData["guacamole_user_password"] = labPassword
+		ctx.Lab.ServiceData["guacamole_connection_group_id"] = groupID
 		// Store configuration for cleanup
 		ctx.Lab.ServiceData["guacamole_host"] = v.host
 		ctx.Lab.ServiceData["guacamole_admin_username"] = v.adminUsername
@@ -415,21 +773,80 @@ func (v *GuacamoleService) ExecuteCleanup(ctx *interfaces.CleanupContext) error
 	}
 
 	// Create Guacamole client for cleanup
-	client, err := NewGuacamoleClient(host, adminUsername, adminPassword, skipTLSVerify)
+	client, err := NewGuacamoleClient(ctx.Context, host, adminUsername, adminPassword, skipTLSVerify, v.authRetry, v.httpDoer)
 	if err != nil {
 		return fmt.Errorf("failed to create Guacamole client for cleanup: %w", err)
 	}
 
 	fmt.Printf("Cleaning up Guacamole user resources for lab %s:\n", ctx.LabID)
 
+	// Delete connection group (removes the connections inside it)
+	groupID, _ := ctx.Context.Value("guacamole_connection_group_id").(string)
+	if groupID == "" && ctx.Lab != nil && ctx.Lab.ServiceData != nil {
+		groupID = ctx.Lab.ServiceData["guacamole_connection_group_id"]
+	}
+	if groupID == "" {
+		groupName := fmt.Sprintf("lab-%s", shortID)
+		if foundID, err := client.findConnectionGroup(groupName); err != nil {
+			fmt.Printf("Warning: Failed to look up connection group %s: %v\n", groupName, err)
+			ctx.ReportResource("connection group "+groupName, "look up", err)
+		} else {
+			groupID = foundID
+		}
+	}
+	if groupID != "" {
+		fmt.Printf("- Deleting connection group: %s\n", groupID)
+		err = client.deleteConnectionGroup(groupID)
+		if err != nil {
+			fmt.Printf("Warning: Failed to delete connection group: %v\n", err)
+		} else {
+			fmt.Printf("  Connection group deleted successfully\n")
+		}
+		ctx.ReportResource("connection group "+groupID, "delete", err)
+	}
+
 	// Delete user
 	fmt.Printf("- Deleting user: %s\n", username)
-	if err := client.deleteUser(username); err != nil {
+	err = client.deleteUser(username)
+	if err != nil {
 		fmt.Printf("Warning: Failed to delete user: %v\n", err)
 	} else {
 		fmt.Printf("  User deleted successfully\n")
 	}
+	ctx.ReportResource("user "+username, "delete", err)
 
 	fmt.Printf("Guacamole user cleanup completed for lab %s\n", ctx.LabID)
 	return nil
 }
+
+// RotateCredential sets a new password for the lab's Guacamole user
+func (v *GuacamoleService) RotateCredential(ctx context.Context, lab *models.Lab, credential *models.Credential) error {
+	host, adminUsername, adminPassword, skipTLSVerify := v.host, v.adminUsername, v.adminPassword, v.skipTLSVerify
+	if lab.ServiceData["guacamole_host"] != "" {
+		host = lab.ServiceData["guacamole_host"]
+		adminUsername = lab.ServiceData["guacamole_admin_username"]
+		adminPassword = lab.ServiceData["guacamole_admin_password"]
+		skipTLSVerify = lab.ServiceData["guacamole_skip_tls_verify"] == "true"
+	}
+	if host == "" || adminUsername == "" || adminPassword == "" {
+		return fmt.Errorf("GUACAMOLE_HOST, GUACAMOLE_ADMIN_USERNAME, and GUACAMOLE_ADMIN_PASSWORD configuration not found in lab data or environment")
+	}
+
+	password, err := generatePassword(v.passwordPolicy)
+	if err != nil {
+		return fmt.Errorf("failed to generate password: %w", err)
+	}
+
+	client, err := NewGuacamoleClient(ctx, host, adminUsername, adminPassword, skipTLSVerify, v.authRetry, v.httpDoer)
+	if err != nil {
+		return fmt.Errorf("failed to create Guacamole client: %w", err)
+	}
+
+	if err := client.updateUserPassword(credential.Username, password); err != nil {
+		return err
+	}
+
+	credential.Password = password
+	lab.ServiceData["guacamole_user_password"] = password
+	return nil
+}
@@ -0,0 +1,544 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+)
+
+const (
+	// httpDefaultSetupBody is sent to the setup URL when no setup_body is configured
+	httpDefaultSetupBody = `{"lab_id": "${lab_id}", "lab_name": "${lab_name}", "owner_id": "${owner_id}", "duration_minutes": ${duration}}`
+	// httpMaxResponseBody caps how much of a response is read
+	httpMaxResponseBody = 1024 * 1024
+)
+
+// HTTPService provisions lab resources by calling a bespoke REST endpoint. Setup sends a templated
+// request to a setup URL, optionally polls a status URL until the resource is ready, and maps fields
+// of the response into a credential. Cleanup calls a teardown URL.
+type HTTPService struct {
+	setupURL          string
+	setupMethod       string
+	setupBody         string
+	teardownURL       string
+	teardownMethod    string
+	teardownBody      string
+	statusURL         string
+	statusPath        string // Response field holding the provisioning status, e.g. response.status
+	readyValue        string
+	failedValue       string
+	pollInterval      time.Duration
+	pollTimeout       time.Duration
+	resourceIDPath    string // Response field holding the ID of the created resource, e.g. response.id
+	authHeader        string
+	authToken         string
+	headers           map[string]string
+	credentialLabel   string
+	credentialMapping map[string]string // Credential field (username, password, url, notes) to response field
+	requestTimeout    time.Duration
+	skipTLSVerify     bool
+	httpDoer          HTTPDoer // Replaces the real HTTP client, set with SetHTTPDoer
+}
+
+// NewHTTPService creates a new HTTP callback service instance
+func NewHTTPService() *HTTPService {
+	return &HTTPService{
+		setupMethod:       http.MethodPost,
+		setupBody:         httpDefaultSetupBody,
+		teardownMethod:    http.MethodDelete,
+		statusPath:        "response.status",
+		readyValue:        "ready",
+		failedValue:       "failed",
+		pollInterval:      10 * time.Second,
+		pollTimeout:       15 * time.Minute,
+		resourceIDPath:    "response.id",
+		authHeader:        "Authorization",
+		headers:           make(map[string]string),
+		credentialLabel:   "Lab Resource",
+		credentialMapping: make(map[string]string),
+		requestTimeout:    30 * time.Second,
+	}
+}
+
+// ConfigureFromServiceConfig configures the service from a service configuration
+func (v *HTTPService) ConfigureFromServiceConfig(config map[string]string) {
+	if setupURL, ok := config["setup_url"]; ok {
+		v.setupURL = setupURL
+	}
+	if setupMethod, ok := config["setup_method"]; ok && setupMethod != "" {
+		v.setupMethod = strings.ToUpper(setupMethod)
+	}
+	if setupBody, ok := config["setup_body"]; ok && setupBody != "" {
+		v.setupBody = setupBody
+	}
+	if teardownURL, ok := config["teardown_url"]; ok {
+		v.teardownURL = teardownURL
+	}
+	if teardownMethod, ok := config["teardown_method"]; ok && teardownMethod != "" {
+		v.teardownMethod = strings.ToUpper(teardownMethod)
+	}
+	if teardownBody, ok := config["teardown_body"]; ok {
+		v.teardownBody = teardownBody
+	}
+	if statusURL, ok := config["status_url"]; ok {
+		v.statusURL = statusURL
+	}
+	if statusPath, ok := config["status_path"]; ok && statusPath != "" {
+		v.statusPath = statusPath
+	}
+	if readyValue, ok := config["ready_value"]; ok && readyValue != "" {
+		v.readyValue = readyValue
+	}
+	if failedValue, ok := config["failed_value"]; ok && failedValue != "" {
+		v.failedValue = failedValue
+	}
+	if pollInterval, ok := config["poll_interval"]; ok && pollInterval != "" {
+		if interval, err := time.ParseDuration(pollInterval); err == nil && interval > 0 {
+			v.pollInterval = interval
+		} else {
+			fmt.Printf("Warning: invalid poll_interval %q, using %v\n", pollInterval, v.pollInterval)
+		}
+	}
+	if pollTimeout, ok := config["poll_timeout"]; ok && pollTimeout != "" {
+		if timeout, err := time.ParseDuration(pollTimeout); err == nil && timeout > 0 {
+			v.pollTimeout = timeout
+		} else {
+			fmt.Printf("Warning: invalid poll_timeout %q, using %v\n", pollTimeout, v.pollTimeout)
+		}
+	}
+	if resourceIDPath, ok := config["resource_id_path"]; ok && resourceIDPath != "" {
+		v.resourceIDPath = resourceIDPath
+	}
+	if authHeader, ok := config["auth_header"]; ok && authHeader != "" {
+		v.authHeader = authHeader
+	}
+	if authToken, ok := config["auth_token"]; ok {
+		v.authToken = authToken
+	}
+	if headers, ok := config["headers"]; ok {
+		v.headers = parseHTTPPairs(headers, ":")
+	}
+	if credentialLabel, ok := config["credential_label"]; ok && credentialLabel != "" {
+		v.credentialLabel = credentialLabel
+	}
+	if credentialMapping, ok := config["credential_mapping"]; ok {
+		v.credentialMapping = parseHTTPPairs(credentialMapping, "=")
+	}
+	if requestTimeout, ok := config["request_timeout"]; ok && requestTimeout != "" {
+		if timeout, err := time.ParseDuration(requestTimeout); err == nil && timeout > 0 {
+			v.requestTimeout = timeout
+		} else {
+			fmt.Printf("Warning: invalid request_timeout %q, using %v\n", requestTimeout, v.requestTimeout)
+		}
+	}
+	if skipTLSVerify, ok := config["skip_tls_verify"]; ok {
+		v.skipTLSVerify = skipTLSVerify == "true"
+	}
+}
+
+// parseHTTPPairs parses newline-separated "key<sep>value" lines, skipping blank lines and # comments
+func parseHTTPPairs(value, sep string) map[string]string {
+	pairs := make(map[string]string)
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, pairValue, found := strings.Cut(line, sep)
+		if !found {
+			fmt.Printf("Warning: ignoring malformed line %q, expected key%svalue\n", line, sep)
+			continue
+		}
+		pairs[strings.TrimSpace(key)] = strings.TrimSpace(pairValue)
+	}
+	return pairs
+}
+
+// GetName returns the service name
+func (v *HTTPService) GetName() string {
+	return "http"
+}
+
+// GetDescription returns the service description
+func (v *HTTPService) GetDescription() string {
+	return "Provision resources through a generic HTTP callback"
+}
+
+// GetRequiredParams returns the required parameters for this service
+func (v *HTTPService) GetRequiredParams() []string {
+	return []string{"setup_url"}
+}
+
+// ConfigSchema describes the keys the service's configs accept (implements ConfigSchemaProvider)
+func (v *HTTPService) ConfigSchema() []interfaces.ConfigField {
+	return []interfaces.ConfigField{
+		{Key: "setup_url", Description: "URL called to provision a lab's resource", Required: true},
+		{Key: "setup_method", Description: "HTTP method of the setup request", Default: "POST"},
+		{Key: "setup_body", Description: "Templated setup request body", Default: httpDefaultSetupBody},
+		{Key: "teardown_url", Description: "URL called to remove a lab's resource"},
+		{Key: "teardown_method", Description: "HTTP method of the teardown request", Default: "DELETE"},
+		{Key: "teardown_body", Description: "Templated teardown request body"},
+		{Key: "status_url", Description: "URL polled until the resource is ready, setup doesn't wait when unset"},
+		{Key: "status_path", Description: "Response field holding the provisioning status", Default: "response.status"},
+		{Key: "ready_value", Description: "Status value meaning the resource is ready", Default: "ready"},
+		{Key: "failed_value", Description: "Status value meaning provisioning failed", Default: "failed"},
+		{Key: "poll_interval", Description: "How often status_url is polled", Default: "10s"},
+		{Key: "poll_timeout", Description: "How long to wait for the resource to become ready", Default: "15m"},
+		{Key: "resource_id_path", Description: "Response field holding the ID of the created resource", Default: "response.id"},
+		{Key: "auth_header", Description: "Header the auth token is sent in", Default: "Authorization"},
+		{Key: "auth_token", Description: "Value of auth_header", Secret: true},
+		{Key: "headers", Description: "Newline-separated Name: value headers sent with every request"},
+		{Key: "credential_label", Description: "Label of the credential the lab gets", Default: "Lab Resource"},
+		{Key: "credential_mapping", Description: "Newline-separated field=response.path lines mapping username, password, url and notes"},
+		{Key: "request_timeout", Description: "Timeout of a single request", Default: "30s"},
+		{Key: "skip_tls_verify", Description: "Skip verifying the endpoint's certificate (true or false)", Default: "false"},
+	}
+}
+
+// ServiceDataKeys returns the prefixes of the ServiceData keys the service records (implements Service interface)
+func (v *HTTPService) ServiceDataKeys() []string {
+	return []string{"http_"}
+}
+
+// DescribeResources returns the resource names the service derives from the lab ID (implements Service interface)
+func (v *HTTPService) DescribeResources(labID string) map[string]string {
+	// Resource IDs are issued by the endpoint and cannot be constructed from the lab ID
+	return map[string]string{}
+}
+
+// SetHTTPDoer replaces the client the service sends callback requests with, such as with a fake in tests
+func (v *HTTPService) SetHTTPDoer(doer HTTPDoer) {
+	v.httpDoer = doer
+}
+
+// Name returns the service name (implements Setup interface)
+func (v *HTTPService) Name() string {
+	return v.GetName()
+}
+
+// httpTemplateValues returns the placeholders available to URLs and request bodies
+func httpTemplateValues(labID, labName, ownerID, resourceID string, duration int) map[string]string {
+	return map[string]string{
+		"lab_id":      labID,
+		"lab_name":    labName,
+		"owner_id":    ownerID,
+		"resource_id": resourceID,
+		"duration":    strconv.Itoa(duration),
+	}
+}
+
+// renderHTTPTemplate replaces ${name} placeholders, passing each value through escape
+func renderHTTPTemplate(template string, values map[string]string, escape func(string) string) string {
+	for name, value := range values {
+		template = strings.ReplaceAll(template, "${"+name+"}", escape(value))
+	}
+	return template
+}
+
+// jsonStringContent escapes a value for use inside a JSON string literal
+func jsonStringContent(value string) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded[1 : len(encoded)-1])
+}
+
+// httpClient builds the client used for all callbacks, unless replaced with SetHTTPDoer
+func (v *HTTPService) httpClient() HTTPDoer {
+	return httpDoerOr(v.httpDoer, &http.Client{
+		Timeout: v.requestTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: v.skipTLSVerify,
+			},
+		},
+	})
+}
+
+// do sends a request with the configured headers and decodes a JSON response. A response that is
+// empty or not a JSON object decodes to an empty map.
+func (v *HTTPService) do(ctx context.Context, client HTTPDoer, method, requestURL, body string) (map[string]interface{}, int, error) {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, reader)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range v.headers {
+		req.Header.Set(name, value)
+	}
+	if v.authToken != "" {
+		req.Header.Set(v.authHeader, v.authToken)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, httpMaxResponseBody))
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, resp.StatusCode, fmt.Errorf("%s %s failed with status: %d, response: %s", method, requestURL, resp.StatusCode, string(respBody))
+	}
+
+	result := make(map[string]interface{})
+	if len(bytes.TrimSpace(respBody)) > 0 {
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			fmt.Printf("Warning: response from %s is not a JSON object, ignoring it\n", requestURL)
+		}
+	}
+	return result, resp.StatusCode, nil
+}
+
+// responseField looks up a dotted path such as response.credentials.url in a decoded response.
+// Missing fields return an empty string; numbers and booleans are formatted as strings.
+func responseField(response map[string]interface{}, path string) string {
+	path = strings.TrimPrefix(path, "response.")
+	var current interface{} = response
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		current = object[part]
+	}
+
+	switch value := current.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	}
+}
+
+// waitForReady polls the status URL until the status field reports ready or failed, returning the last response
+func (v *HTTPService) waitForReady(ctx context.Context, client HTTPDoer, statusURL string, progress func(string)) (map[string]interface{}, error) {
+	deadline := time.Now().Add(v.pollTimeout)
+	for {
+		response, _, err := v.do(ctx, client, http.MethodGet, statusURL, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to check status: %w", err)
+		}
+
+		status := responseField(response, v.statusPath)
+		switch status {
+		case v.readyValue:
+			return response, nil
+		case v.failedValue:
+			return nil, fmt.Errorf("provisioning failed: %s is %q", v.statusPath, status)
+		}
+
+		if time.Now().Add(v.pollInterval).After(deadline) {
+			return nil, fmt.Errorf("resource not ready after %v (last status %q)", v.pollTimeout, status)
+		}
+		progress(fmt.Sprintf("Resource status is %q, waiting...", status))
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped waiting for resource: %w", ctx.Err())
+		case <-time.After(v.pollInterval):
+		}
+	}
+}
+
+// ExecuteSetup calls the setup URL, waits for the resource if a status URL is configured and adds the mapped credential
+func (v *HTTPService) ExecuteSetup(ctx *interfaces.SetupContext) error {
+	// Update progress: Calling Setup Endpoint
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Calling Setup Endpoint", "running", "Requesting resource...")
+	}
+
+	if v.setupURL == "" {
+		err := fmt.Errorf("setup_url is required")
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Calling Setup Endpoint", "failed", err.Error())
+		}
+		return err
+	}
+
+	values := httpTemplateValues(ctx.LabID, ctx.LabName, ctx.OwnerID, "", ctx.Duration)
+	setupURL := renderHTTPTemplate(v.setupURL, values, url.PathEscape)
+	setupBody := renderHTTPTemplate(v.setupBody, values, jsonStringContent)
+
+	fmt.Printf("Calling HTTP setup endpoint for lab %s: %s %s\n", ctx.LabName, v.setupMethod, setupURL)
+
+	client := v.httpClient()
+	response, _, err := v.do(ctx.Context, client, v.setupMethod, setupURL, setupBody)
+	if err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Calling Setup Endpoint", "failed", err.Error())
+		}
+		return fmt.Errorf("setup request failed: %w", err)
+	}
+
+	resourceID := responseField(response, v.resourceIDPath)
+	values["resource_id"] = resourceID
+
+	// Store what cleanup needs as soon as the resource exists, so a failure below can still tear it down
+	if ctx.Lab != nil {
+		if ctx.Lab.ServiceData == nil {
+			ctx.Lab.ServiceData = make(map[string]string)
+		}
+		ctx.Lab.ServiceData["http_resource_id"] = resourceID
+		ctx.Lab.ServiceData["http_teardown_url"] = renderHTTPTemplate(v.teardownURL, values, url.PathEscape)
+		ctx.Lab.ServiceData["http_teardown_method"] = v.teardownMethod
+		ctx.Lab.ServiceData["http_teardown_body"] = renderHTTPTemplate(v.teardownBody, values, jsonStringContent)
+		ctx.Lab.ServiceData["http_auth_header"] = v.authHeader
+		ctx.Lab.ServiceData["http_auth_token"] = v.authToken
+		ctx.Lab.ServiceData["http_skip_tls_verify"] = fmt.Sprintf("%t", v.skipTLSVerify)
+	}
+
+	// Update progress: Calling Setup Endpoint completed
+	if ctx.UpdateProgress != nil {
+		message := "Resource requested"
+		if resourceID != "" {
+			message = fmt.Sprintf("Resource %s requested", resourceID)
+		}
+		ctx.UpdateProgress("Calling Setup Endpoint", "completed", message)
+	}
+
+	// Asynchronous endpoints are polled until the resource is ready; credentials come from the final status
+	if v.statusURL != "" {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Waiting for Resource", "running", "Waiting for resource to become ready...")
+		}
+
+		statusURL := renderHTTPTemplate(v.statusURL, values, url.PathEscape)
+		status, err := v.waitForReady(ctx.Context, client, statusURL, func(message string) {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Waiting for Resource", "running", message)
+			}
+		})
+		if err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Waiting for Resource", "failed", err.Error())
+			}
+			return err
+		}
+		for key, value := range status {
+			response[key] = value
+		}
+
+		// Update progress: Waiting for Resource completed
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Waiting for Resource", "completed", "Resource is ready")
+		}
+	}
+
+	// Update progress: Adding Credentials
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Adding Credentials", "running", "Reading credentials from response...")
+	}
+
+	if len(v.credentialMapping) > 0 {
+		credential := &interfaces.Credential{
+			ID:        fmt.Sprintf("http-%s", ctx.LabID),
+			LabID:     ctx.LabID,
+			Label:     v.credentialLabel,
+			Username:  responseField(response, v.credentialMapping["username"]),
+			Password:  responseField(response, v.credentialMapping["password"]),
+			URL:       responseField(response, v.credentialMapping["url"]),
+			Notes:     responseField(response, v.credentialMapping["notes"]),
+			ExpiresAt: time.Now().Add(time.Duration(ctx.Duration) * time.Minute),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+
+		if err := ctx.AddCredential(credential); err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Adding Credentials", "failed", fmt.Sprintf("Failed to add credential: %v", err))
+			}
+			return fmt.Errorf("failed to add HTTP service credential: %w", err)
+		}
+	}
+
+	// Update progress: Adding Credentials completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Adding Credentials", "completed", "Resource provisioned successfully")
+	}
+
+	fmt.Printf("HTTP service setup completed for lab %s\n", ctx.LabName)
+	return nil
+}
+
+// ExecuteCleanup calls the teardown URL recorded during setup. A resource the endpoint no longer
+// knows about (404) is treated as already removed.
+func (v *HTTPService) ExecuteCleanup(ctx *interfaces.CleanupContext) error {
+	// Work on a copy, since the settings recorded for the lab override this instance's
+	caller := *v
+	teardownURL := v.teardownURL
+	teardownMethod := v.teardownMethod
+	teardownBody := v.teardownBody
+	if ctx.Lab != nil && ctx.Lab.ServiceData != nil {
+		if recorded, exists := ctx.Lab.ServiceData["http_teardown_url"]; exists {
+			teardownURL = recorded
+			teardownMethod = ctx.Lab.ServiceData["http_teardown_method"]
+			teardownBody = ctx.Lab.ServiceData["http_teardown_body"]
+			if authHeader := ctx.Lab.ServiceData["http_auth_header"]; authHeader != "" {
+				caller.authHeader = authHeader
+			}
+			caller.authToken = ctx.Lab.ServiceData["http_auth_token"]
+			caller.skipTLSVerify = ctx.Lab.ServiceData["http_skip_tls_verify"] == "true"
+		}
+	}
+
+	// Fallback to the teardown URL passed in context (e.g. admin cleanup)
+	if teardownURL == "" {
+		if contextURL, ok := ctx.Context.Value("http_teardown_url").(string); ok {
+			teardownURL = contextURL
+		}
+	}
+
+	if teardownURL == "" {
+		fmt.Printf("No HTTP teardown URL for lab %s, nothing to clean up\n", ctx.LabID)
+		ctx.SkipResource("resource", "teardown", "no teardown URL recorded for the lab")
+		return nil
+	}
+	if teardownMethod == "" {
+		teardownMethod = http.MethodDelete
+	}
+
+	fmt.Printf("Calling HTTP teardown endpoint for lab %s: %s %s\n", ctx.LabID, teardownMethod, teardownURL)
+
+	_, statusCode, err := caller.do(ctx.Context, caller.httpClient(), teardownMethod, teardownURL, teardownBody)
+	if err != nil {
+		if statusCode == http.StatusNotFound {
+			fmt.Printf("HTTP resource for lab %s not found, treating as already removed\n", ctx.LabID)
+			ctx.SkipResource(teardownURL, "teardown", "not found")
+			return nil
+		}
+		ctx.ReportResource(teardownURL, "teardown", err)
+		return fmt.Errorf("teardown request failed: %w", err)
+	}
+	ctx.ReportResource(teardownURL, "teardown", nil)
+
+	fmt.Printf("HTTP service cleanup completed for lab %s\n", ctx.LabID)
+	return nil
+}
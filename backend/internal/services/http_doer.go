@@ -0,0 +1,20 @@
+package services
+
+import (
+	"net/http"
+)
+
+// HTTPDoer sends HTTP requests. *http.Client implements it, and services that talk to their backing
+// system over HTTP accept a replacement through SetHTTPDoer, so tests can exercise setup and cleanup
+// against a fake instead of real Proxmox, Terraform Cloud or cloud provider endpoints.
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// httpDoerOr returns the replacement client when one was set, and the real client otherwise
+func httpDoerOr(doer HTTPDoer, client *http.Client) HTTPDoer {
+	if doer != nil {
+		return doer
+	}
+	return client
+}
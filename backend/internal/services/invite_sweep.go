@@ -0,0 +1,109 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// Invites only flip to expired when they are looked up, so the sweep marks the ones nobody looks at
+// again, keeping the pending count honest, and deletes invites that finished long ago.
+
+// InviteSweepConfig controls how often stale invites are expired and how long finished ones are kept
+type InviteSweepConfig struct {
+	Interval   time.Duration // Time between sweeps
+	PurgeAfter time.Duration // How long expired, accepted and exhausted invites are kept, 0 to keep them
+}
+
+// DefaultInviteSweepConfig returns the default invite sweep configuration
+func DefaultInviteSweepConfig() InviteSweepConfig {
+	return InviteSweepConfig{
+		Interval: time.Hour,
+	}
+}
+
+// inviteSweep is the outcome of one sweep
+type inviteSweep struct {
+	at      time.Time
+	expired int
+	purged  int
+}
+
+// SweepInvites marks pending invites past their expiry as expired and, with a purgeAfter above 0,
+// deletes expired, accepted and exhausted invites that finished more than purgeAfter ago. Expired
+// invites can be renewed until they are purged.
+func (s *OrganizationService) SweepInvites(purgeAfter time.Duration) (expired, purged int) {
+	s.invitesMu.Lock()
+	defer s.invitesMu.Unlock()
+
+	now := time.Now()
+	for id, invite := range s.invites {
+		if invite.Status == "pending" && now.After(invite.ExpiresAt) {
+			invite.Status = "expired"
+			expired++
+		}
+		if purgeAfter > 0 && invite.Status != "pending" && now.Sub(inviteFinishedAt(invite)) > purgeAfter {
+			delete(s.invites, id)
+			purged++
+		}
+	}
+
+	s.lastSweep = &inviteSweep{at: now, expired: expired, purged: purged}
+	s.purged += purged
+	if expired > 0 || purged > 0 {
+		fmt.Printf("SweepInvites: Expired %d and purged %d invites, %d remain\n", expired, purged, len(s.invites))
+	}
+	return expired, purged
+}
+
+// inviteFinishedAt returns when an invite stopped being acceptable: when its last use was taken for
+// accepted and exhausted invites, otherwise when it expired
+func inviteFinishedAt(invite *models.Invite) time.Time {
+	if (invite.Status == "accepted" || invite.Status == "exhausted") && invite.AcceptedAt != nil {
+		return *invite.AcceptedAt
+	}
+	return invite.ExpiresAt
+}
+
+// StartInviteSweeper starts a background task that sweeps invites periodically
+func (s *OrganizationService) StartInviteSweeper(config InviteSweepConfig) {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInviteSweepConfig().Interval
+	}
+
+	go func() {
+		for {
+			time.Sleep(config.Interval)
+			s.SweepInvites(config.PurgeAfter)
+		}
+	}()
+}
+
+// GetInviteStats counts invites by status, with the outcome of the last sweep
+func (s *OrganizationService) GetInviteStats() models.InviteStats {
+	s.invitesMu.RLock()
+	defer s.invitesMu.RUnlock()
+
+	now := time.Now()
+	stats := models.InviteStats{Total: len(s.invites), Purged: s.purged}
+	for _, invite := range s.invites {
+		switch {
+		case invite.Status == "expired" || (invite.Status == "pending" && now.After(invite.ExpiresAt)):
+			stats.Expired++
+		case invite.Status == "pending":
+			stats.Pending++
+		case invite.Status == "accepted":
+			stats.Accepted++
+		case invite.Status == "exhausted":
+			stats.Exhausted++
+		}
+	}
+	if s.lastSweep != nil {
+		at := s.lastSweep.at
+		stats.LastSweepAt = &at
+		stats.LastSweepExpired = s.lastSweep.expired
+		stats.LastSweepPurged = s.lastSweep.purged
+	}
+	return stats
+}
@@ -2,11 +2,22 @@ package services
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/wcrum/labby/internal/interfaces"
 	"github.com/wcrum/labby/internal/models"
 )
 
+// ServiceTypeDescription describes a service type service configs can use
+type ServiceTypeDescription struct {
+	Type           string                   `json:"type"` // Value of a service config's type
+	Name           string                   `json:"name"` // Name the service is registered under
+	Description    string                   `json:"description"`
+	RequiredParams []string                 `json:"required_params"`
+	ConfigSchema   []interfaces.ConfigField `json:"config_schema"` // Empty for services that don't describe their config
+}
+
 // ServiceManager manages all available services
 type ServiceManager struct {
 	registry             *interfaces.ServiceRegistry
@@ -25,6 +36,12 @@ func NewServiceManager(serviceConfigManager *models.ServiceConfigManager) *Servi
 	paletteTenantService := NewPaletteTenantService()
 	terraformCloudService := NewTerraformCloudService()
 	guacamoleService := NewGuacamoleService()
+	vaultService := NewVaultService()
+	azureService := NewAzureService()
+	gcpService := NewGCPService()
+	sshCommandService := NewSSHCommandService()
+	httpService := NewHTTPService()
+	dockerService := NewDockerService()
 
 	// Register services with their GetName() for backward compatibility
 	registry.RegisterService(paletteProjectService)
@@ -32,6 +49,12 @@ func NewServiceManager(serviceConfigManager *models.ServiceConfigManager) *Servi
 	registry.RegisterService(paletteTenantService)
 	registry.RegisterService(terraformCloudService)
 	registry.RegisterService(guacamoleService)
+	registry.RegisterService(vaultService)
+	registry.RegisterService(azureService)
+	registry.RegisterService(gcpService)
+	registry.RegisterService(sshCommandService)
+	registry.RegisterService(httpService)
+	registry.RegisterService(dockerService)
 
 	// Create mapping from service types to service instances
 	serviceTypeMap := make(map[string]interfaces.Service)
@@ -43,6 +66,12 @@ func NewServiceManager(serviceConfigManager *models.ServiceConfigManager) *Servi
 	serviceTypeMap["palette_tenant"] = paletteTenantService
 	serviceTypeMap["terraform_cloud"] = terraformCloudService
 	serviceTypeMap["guacamole"] = guacamoleService
+	serviceTypeMap["vault"] = vaultService
+	serviceTypeMap["azure"] = azureService
+	serviceTypeMap["gcp"] = gcpService
+	serviceTypeMap["ssh_command"] = sshCommandService
+	serviceTypeMap["http"] = httpService
+	serviceTypeMap["docker"] = dockerService
 
 	return &ServiceManager{
 		registry:             registry,
@@ -62,6 +91,36 @@ func (sm *ServiceManager) GetServiceByType(serviceType string) (interfaces.Servi
 	return service, exists
 }
 
+// GetServiceTypes returns the service types service configs can use, sorted
+func (sm *ServiceManager) GetServiceTypes() []string {
+	types := make([]string, 0, len(sm.serviceTypeMap))
+	for serviceType := range sm.serviceTypeMap {
+		types = append(types, serviceType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// DescribeServiceTypes describes every service type, sorted by type
+func (sm *ServiceManager) DescribeServiceTypes() []ServiceTypeDescription {
+	descriptions := make([]ServiceTypeDescription, 0, len(sm.serviceTypeMap))
+	for _, serviceType := range sm.GetServiceTypes() {
+		service := sm.serviceTypeMap[serviceType]
+		description := ServiceTypeDescription{
+			Type:           serviceType,
+			Name:           service.GetName(),
+			Description:    service.GetDescription(),
+			RequiredParams: service.GetRequiredParams(),
+			ConfigSchema:   []interfaces.ConfigField{},
+		}
+		if provider, ok := service.(interfaces.ConfigSchemaProvider); ok {
+			description.ConfigSchema = provider.ConfigSchema()
+		}
+		descriptions = append(descriptions, description)
+	}
+	return descriptions
+}
+
 // GetServiceByConfigID returns a service by looking up the service type from the service config ID
 func (sm *ServiceManager) GetServiceByConfigID(configID string) (interfaces.Service, bool) {
 	// Get the service config to find the service type
@@ -87,7 +146,9 @@ func (sm *ServiceManager) SetupLabServices(ctx *interfaces.SetupContext) error {
 	return nil
 }
 
-// CleanupLabServices cleans up only the services that were used for a lab
+// CleanupLabServices cleans up only the services that were used for a lab. Services the context reports
+// as already cleaned up are skipped, and a failing service does not stop the others, so cleanup can be
+// re-run until every service has succeeded.
 func (sm *ServiceManager) CleanupLabServices(ctx *interfaces.CleanupContext) error {
 	// Get the lab to check which services were used
 	if ctx.Lab == nil {
@@ -97,38 +158,58 @@ func (sm *ServiceManager) CleanupLabServices(ctx *interfaces.CleanupContext) err
 	fmt.Printf("Starting cleanup for lab %s (ID: %s)\n", ctx.Lab.Name, ctx.LabID)
 	fmt.Printf("Lab used services: %v\n", ctx.Lab.UsedServices)
 
+	var failed []string
+
 	// If no used services are tracked, clean up all services (backward compatibility)
 	if len(ctx.Lab.UsedServices) == 0 {
 		fmt.Printf("No used services tracked, cleaning up all registered services (backward compatibility)\n")
 		services := sm.registry.GetAllServices()
 		for serviceName, service := range services {
-			fmt.Printf("Cleaning up service: %s\n", serviceName)
-			if err := service.ExecuteCleanup(ctx); err != nil {
-				fmt.Printf("Error cleaning up service %s: %v\n", serviceName, err)
-				return err
+			if err := sm.cleanupService(ctx, serviceName, serviceName, service); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", serviceName, err))
 			}
 		}
-		return nil
-	}
+	} else {
+		// Only clean up services that were actually used for this lab
+		fmt.Printf("Cleaning up only services that were used for this lab\n")
+		for _, serviceConfigID := range ctx.Lab.UsedServices {
+			// Get service by looking up the service type from the service config
+			service, exists := sm.GetServiceByConfigID(serviceConfigID)
+			if !exists {
+				// Log warning but continue with other services
+				fmt.Printf("Warning: Service for config ID %s not found during cleanup for lab %s\n", serviceConfigID, ctx.LabID)
+				continue
+			}
 
-	// Only clean up services that were actually used for this lab
-	fmt.Printf("Cleaning up only services that were used for this lab\n")
-	for _, serviceConfigID := range ctx.Lab.UsedServices {
-		// Get service by looking up the service type from the service config
-		service, exists := sm.GetServiceByConfigID(serviceConfigID)
-		if !exists {
-			// Log warning but continue with other services
-			fmt.Printf("Warning: Service for config ID %s not found during cleanup for lab %s\n", serviceConfigID, ctx.LabID)
-			continue
+			if err := sm.cleanupService(ctx, serviceConfigID, service.GetName(), service); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", serviceConfigID, err))
+			}
 		}
+	}
 
-		fmt.Printf("Cleaning up service: %s (config ID: %s)\n", service.GetName(), serviceConfigID)
-		if err := service.ExecuteCleanup(ctx); err != nil {
-			fmt.Printf("Error cleaning up service %s: %v\n", serviceConfigID, err)
-			return err
-		}
+	if len(failed) > 0 {
+		return fmt.Errorf("cleanup failed for %d service(s): %s", len(failed), strings.Join(failed, "; "))
 	}
 
 	fmt.Printf("Cleanup completed successfully for lab %s\n", ctx.LabID)
 	return nil
 }
+
+// cleanupService runs cleanup for one service unless it already completed, and records the outcome
+func (sm *ServiceManager) cleanupService(ctx *interfaces.CleanupContext, serviceID, serviceName string, service interfaces.Cleanup) error {
+	if ctx.ShouldCleanup != nil && !ctx.ShouldCleanup(serviceID) {
+		fmt.Printf("Skipping cleanup of service %s (%s), already cleaned up\n", serviceName, serviceID)
+		return nil
+	}
+
+	fmt.Printf("Cleaning up service: %s (ID: %s)\n", serviceName, serviceID)
+	err := service.ExecuteCleanup(ctx)
+	if err != nil {
+		fmt.Printf("Error cleaning up service %s: %v\n", serviceID, err)
+	}
+
+	if ctx.RecordCleanup != nil {
+		ctx.RecordCleanup(serviceID, serviceName, err)
+	}
+	return err
+}
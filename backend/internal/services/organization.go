@@ -1,7 +1,9 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,8 +16,32 @@ type OrganizationService struct {
 	organizations map[string]*models.Organization
 	members       map[string]*models.OrganizationMember
 	invites       map[string]*models.Invite
+	// Guards invites and the sweep results. Held for writing while invites are created, accepted, renewed
+	// or swept, so usage is checked and counted atomically; callers are only given copies of invites.
+	invitesMu sync.RWMutex
+
+	lastSweep *inviteSweep // Result of the last invite sweep
+	purged    int          // Invites deleted by sweeps since startup
 }
 
+var (
+	// ErrInviteExhausted is returned when an invite has already been accepted as many times as allowed
+	ErrInviteExhausted = errors.New("invite has reached its usage limit")
+	// ErrInviteNotFound is returned when an invite does not exist
+	ErrInviteNotFound = errors.New("invite not found")
+	// ErrInviteNotRenewable is returned when renewing an invite that has no uses left
+	ErrInviteNotRenewable = errors.New("invite has no uses left to renew")
+	// ErrOrganizationNotFound is returned when an organization does not exist
+	ErrOrganizationNotFound = errors.New("organization not found")
+	// ErrOrganizationDomainRequired is returned when auto-assignment is enabled for an organization without a domain
+	ErrOrganizationDomainRequired = errors.New("organization has no domain")
+	// ErrDomainAutoJoinConflict is returned when another organization already auto-assigns users of the same domain
+	ErrDomainAutoJoinConflict = errors.New("another organization already auto-assigns users of this domain")
+)
+
+// inviteValidity is how long an invite can be accepted after it is created or renewed
+const inviteValidity = 7 * 24 * time.Hour
+
 var (
 	organizationServiceInstance *OrganizationService
 	organizationServiceOnce     sync.Once
@@ -51,8 +77,14 @@ func NewOrganizationService() *OrganizationService {
 	return organizationServiceInstance
 }
 
-// CreateOrganization creates a new organization
+// CreateOrganization creates a new organization. It returns ErrInvalidOrganization when the name,
+// description or domain can't be used.
 func (s *OrganizationService) CreateOrganization(name, description, domain string) (*models.Organization, error) {
+	name, description, domain, err := normalizeOrganization(name, description, domain)
+	if err != nil {
+		return nil, err
+	}
+
 	org := &models.Organization{
 		ID:          fmt.Sprintf("org-%s", uuid.New().String()[:8]),
 		Name:        name,
@@ -70,7 +102,7 @@ func (s *OrganizationService) CreateOrganization(name, description, domain strin
 func (s *OrganizationService) GetOrganization(id string) (*models.Organization, error) {
 	org, exists := s.organizations[id]
 	if !exists {
-		return nil, fmt.Errorf("organization not found")
+		return nil, ErrOrganizationNotFound
 	}
 	return org, nil
 }
@@ -88,7 +120,7 @@ func (s *OrganizationService) GetAllOrganizations() []*models.Organization {
 func (s *OrganizationService) AddMember(organizationID, userID, role string) (*models.OrganizationMember, error) {
 	// Check if organization exists
 	if _, exists := s.organizations[organizationID]; !exists {
-		return nil, fmt.Errorf("organization not found")
+		return nil, ErrOrganizationNotFound
 	}
 
 	// Check if user is already a member
@@ -121,13 +153,19 @@ func (s *OrganizationService) GetOrganizationMembers(organizationID string) []mo
 	return members
 }
 
-// CreateInvite creates an invitation to join an organization
-func (s *OrganizationService) CreateInvite(organizationID, email, role, invitedBy string) (*models.Invite, error) {
-	fmt.Printf("DEBUG: Creating invite for org: %s, email: %s, role: %s\n", organizationID, email, role)
+// CreateInvite creates an invitation to join an organization that can be accepted up to usageLimit times.
+// A usageLimit below 1 creates a single-use invite. The email is stored lowercase. Accepting an invite with
+// a labTemplateID also creates a lab from that template for the new member.
+func (s *OrganizationService) CreateInvite(organizationID, email, role, invitedBy string, usageLimit int, labTemplateID string) (*models.Invite, error) {
+	email = models.NormalizeEmail(email)
+
+	if usageLimit < 1 {
+		usageLimit = 1
+	}
 
 	// Check if organization exists
 	if _, exists := s.organizations[organizationID]; !exists {
-		return nil, fmt.Errorf("organization not found")
+		return nil, ErrOrganizationNotFound
 	}
 
 	// Check if user is already a member
@@ -145,18 +183,28 @@ func (s *OrganizationService) CreateInvite(organizationID, email, role, invitedB
 		InvitedBy:      invitedBy,
 		Role:           role,
 		Status:         "pending",
-		ExpiresAt:      time.Now().Add(7 * 24 * time.Hour), // 7 days
+		UsageLimit:     usageLimit,
+		LabTemplateID:  labTemplateID,
+		ExpiresAt:      time.Now().Add(inviteValidity),
 		CreatedAt:      time.Now(),
 	}
 
+	s.invitesMu.Lock()
 	s.invites[invite.ID] = invite
-	fmt.Printf("DEBUG: Created invite with ID: %s, total invites now: %d\n", invite.ID, len(s.invites))
-	fmt.Printf("DEBUG: Invite details: %+v\n", invite)
-	return invite, nil
+	total := len(s.invites)
+	created := *invite
+	s.invitesMu.Unlock()
+
+	fmt.Printf("Created invite %s for %s to join organization %s as %s (%d uses, %d invites in total)\n",
+		created.ID, created.Email, created.OrganizationID, created.Role, created.UsageLimit, total)
+	return &created, nil
 }
 
-// GetInvite retrieves an invite by ID
+// GetInvite retrieves a copy of an invite by ID, with the status expired once it is past its expiry
 func (s *OrganizationService) GetInvite(id string) (*models.Invite, error) {
+	s.invitesMu.RLock()
+	defer s.invitesMu.RUnlock()
+
 	// Debug: log the search attempt
 	fmt.Printf("DEBUG: Searching for invite with ID: %s\n", id)
 	fmt.Printf("DEBUG: Total invites in system: %d\n", len(s.invites))
@@ -174,58 +222,171 @@ func (s *OrganizationService) GetInvite(id string) (*models.Invite, error) {
 
 	invite, exists := s.invites[id]
 	if !exists {
-		return nil, fmt.Errorf("invite not found: ID '%s' does not exist in the system (total invites: %d)", id, len(s.invites))
+		return nil, fmt.Errorf("%w: ID '%s' does not exist in the system (total invites: %d)", ErrInviteNotFound, id, len(s.invites))
 	}
 
-	// Check if invite has expired
-	if time.Now().After(invite.ExpiresAt) {
-		invite.Status = "expired"
+	found := *invite
+	// The stored invite is marked expired by the sweep or when it is accepted
+	if found.Status == "pending" && time.Now().After(found.ExpiresAt) {
+		found.Status = "expired"
 	}
 
-	fmt.Printf("DEBUG: Found invite: %+v\n", invite)
-	return invite, nil
+	fmt.Printf("DEBUG: Found invite: %+v\n", found)
+	return &found, nil
 }
 
-// AcceptInvite accepts an invitation and adds the user to the organization
+// AcceptInvite accepts an invitation and adds the user to the organization. The usage limit is
+// checked and the usage counted under a lock so concurrent accepts cannot exceed it.
 func (s *OrganizationService) AcceptInvite(inviteID, userID string) error {
-	invite, err := s.GetInvite(inviteID)
-	if err != nil {
-		return err
+	s.invitesMu.Lock()
+	defer s.invitesMu.Unlock()
+
+	invite, exists := s.invites[inviteID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrInviteNotFound, inviteID)
+	}
+
+	// Invites created before usage limits existed are single-use
+	if invite.UsageLimit < 1 {
+		invite.UsageLimit = 1
+	}
+
+	if invite.Status == "exhausted" {
+		return ErrInviteExhausted
 	}
 
 	if invite.Status != "pending" {
 		return fmt.Errorf("invite is not pending")
 	}
 
+	if invite.RemainingUses() == 0 {
+		invite.Status = "exhausted"
+		return ErrInviteExhausted
+	}
+
 	if time.Now().After(invite.ExpiresAt) {
+		invite.Status = "expired"
 		return fmt.Errorf("invite has expired")
 	}
 
 	// Add user to organization
-	_, err = s.AddMember(invite.OrganizationID, userID, invite.Role)
+	_, err := s.AddMember(invite.OrganizationID, userID, invite.Role)
 	if err != nil {
 		return err
 	}
 
-	// Mark invite as accepted
-	invite.Status = "accepted"
+	// Count the use, closing the invite once every use has been taken
+	invite.UsageCount++
 	now := time.Now()
 	invite.AcceptedAt = &now
+	if invite.RemainingUses() == 0 {
+		if invite.UsageLimit == 1 {
+			invite.Status = "accepted"
+		} else {
+			invite.Status = "exhausted"
+		}
+	}
 
+	fmt.Printf("Invite %s accepted by %s (%d/%d uses)\n", invite.ID, userID, invite.UsageCount, invite.UsageLimit)
 	return nil
 }
 
-// GetInvitesByEmail returns all invites for a specific email
+// RenewInvite makes an invite acceptable again for another validity period, keeping its organization,
+// role, usage and lab template. With newID the invite also gets a new ID, so links to the old one stop
+// working. Invites whose uses have all been taken cannot be renewed.
+func (s *OrganizationService) RenewInvite(inviteID string, newID bool) (*models.Invite, error) {
+	s.invitesMu.Lock()
+	defer s.invitesMu.Unlock()
+
+	invite, exists := s.invites[inviteID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrInviteNotFound, inviteID)
+	}
+
+	// Invites created before usage limits existed are single-use
+	if invite.UsageLimit < 1 {
+		invite.UsageLimit = 1
+	}
+	if invite.Status == "accepted" || invite.Status == "exhausted" || invite.RemainingUses() == 0 {
+		return nil, ErrInviteNotRenewable
+	}
+
+	if newID {
+		delete(s.invites, invite.ID)
+		invite.ID = uuid.New().String()[:8]
+		s.invites[invite.ID] = invite
+	}
+	invite.Status = "pending"
+	invite.ExpiresAt = time.Now().Add(inviteValidity)
+
+	fmt.Printf("Renewed invite %s as %s until %s\n", inviteID, invite.ID, invite.ExpiresAt.Format(time.RFC3339))
+	renewed := *invite
+	return &renewed, nil
+}
+
+// normalizeDomain lowercases a domain and strips a leading "@"
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+}
+
+// SetDomainAutoJoin turns auto-assignment of users by email domain on or off for an organization. At most
+// one organization may auto-assign a given domain.
+func (s *OrganizationService) SetDomainAutoJoin(organizationID string, enabled bool) (*models.Organization, error) {
+	org, exists := s.organizations[organizationID]
+	if !exists {
+		return nil, ErrOrganizationNotFound
+	}
+
+	if enabled {
+		domain := normalizeDomain(org.Domain)
+		if domain == "" {
+			return nil, ErrOrganizationDomainRequired
+		}
+		for _, other := range s.organizations {
+			if other.ID != org.ID && other.AutoJoinByDomain && normalizeDomain(other.Domain) == domain {
+				return nil, fmt.Errorf("%w: %s", ErrDomainAutoJoinConflict, other.Name)
+			}
+		}
+	}
+
+	org.AutoJoinByDomain = enabled
+	org.UpdatedAt = time.Now()
+	fmt.Printf("Set domain auto-join for organization %s (%s) to %v\n", org.ID, org.Domain, enabled)
+	return org, nil
+}
+
+// FindOrganizationForEmail returns the ID of the organization that auto-assigns users of the email's domain
+func (s *OrganizationService) FindOrganizationForEmail(email string) (string, bool) {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return "", false
+	}
+	domain := normalizeDomain(email[at+1:])
+	if domain == "" {
+		return "", false
+	}
+
+	for _, org := range s.organizations {
+		if org.AutoJoinByDomain && normalizeDomain(org.Domain) == domain {
+			return org.ID, true
+		}
+	}
+	return "", false
+}
+
+// GetInvitesByEmail returns copies of the pending, unexpired invites for a specific email, in any case
 func (s *OrganizationService) GetInvitesByEmail(email string) []*models.Invite {
+	email = models.NormalizeEmail(email)
+
+	s.invitesMu.RLock()
+	defer s.invitesMu.RUnlock()
+
+	now := time.Now()
 	var invites []*models.Invite
 	for _, invite := range s.invites {
-		if invite.Email == email && invite.Status == "pending" {
-			// Check if invite has expired
-			if time.Now().After(invite.ExpiresAt) {
-				invite.Status = "expired"
-			} else {
-				invites = append(invites, invite)
-			}
+		if invite.Email == email && invite.Status == "pending" && !now.After(invite.ExpiresAt) {
+			found := *invite
+			invites = append(invites, &found)
 		}
 	}
 	return invites
@@ -241,11 +402,13 @@ func (s *OrganizationService) GetOrganizationWithMembers(organizationID string)
 	members := s.GetOrganizationMembers(organizationID)
 
 	var invites []models.Invite
+	s.invitesMu.RLock()
 	for _, invite := range s.invites {
 		if invite.OrganizationID == organizationID {
 			invites = append(invites, *invite)
 		}
 	}
+	s.invitesMu.RUnlock()
 
 	return &models.OrganizationWithMembers{
 		Organization: org,
@@ -253,3 +416,35 @@ func (s *OrganizationService) GetOrganizationWithMembers(organizationID string)
 		Invites:      invites,
 	}, nil
 }
+
+// GetOrganizationMemberIDs returns the IDs of users with a membership record in an organization
+func (s *OrganizationService) GetOrganizationMemberIDs(organizationID string) []string {
+	var userIDs []string
+	for _, member := range s.members {
+		if member.OrganizationID == organizationID {
+			userIDs = append(userIDs, member.UserID)
+		}
+	}
+	return userIDs
+}
+
+// GetInviteCounts returns how many invites an organization has issued and how many times they were accepted
+func (s *OrganizationService) GetInviteCounts(organizationID string) (issued, accepted int) {
+	s.invitesMu.RLock()
+	defer s.invitesMu.RUnlock()
+
+	for _, invite := range s.invites {
+		if invite.OrganizationID != organizationID {
+			continue
+		}
+		issued++
+
+		// Invites accepted before usage was counted only record their status
+		if invite.UsageCount == 0 && invite.Status == "accepted" {
+			accepted++
+		} else {
+			accepted += invite.UsageCount
+		}
+	}
+	return issued, accepted
+}
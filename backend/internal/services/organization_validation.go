@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxOrganizationNameLength is the longest organization name accepted
+	MaxOrganizationNameLength = 64
+	// MaxOrganizationDescriptionLength is the longest organization description accepted
+	MaxOrganizationDescriptionLength = 500
+	// maxDomainLength is the longest domain name DNS allows
+	maxDomainLength = 253
+)
+
+// ErrInvalidOrganization is returned for organization names, descriptions or domains that can't be used
+var ErrInvalidOrganization = errors.New("invalid organization")
+
+// organizationNamePattern matches names after whitespace is normalized, using the same characters as
+// lab names so an organization's name is safe wherever services reuse it
+var organizationNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 ._-]*$`)
+
+// domainLabelPattern matches a single label of a domain name
+var domainLabelPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// normalizeOrganization trims an organization's fields, collapses runs of whitespace in its name and
+// lowercases its domain, then checks them. The name is required; the description and domain are optional.
+func normalizeOrganization(name, description, domain string) (string, string, string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "", "", "", fmt.Errorf("%w: name is required", ErrInvalidOrganization)
+	}
+	if len(name) > MaxOrganizationNameLength {
+		return "", "", "", fmt.Errorf("%w: name must be at most %d characters", ErrInvalidOrganization, MaxOrganizationNameLength)
+	}
+	if !organizationNamePattern.MatchString(name) {
+		return "", "", "", fmt.Errorf("%w: name %q must start with a letter or digit and may only use letters, digits, spaces and . _ -", ErrInvalidOrganization, name)
+	}
+
+	description = strings.TrimSpace(description)
+	if len(description) > MaxOrganizationDescriptionLength {
+		return "", "", "", fmt.Errorf("%w: description must be at most %d characters", ErrInvalidOrganization, MaxOrganizationDescriptionLength)
+	}
+	for _, r := range description {
+		if r == unicode.ReplacementChar || (unicode.IsControl(r) && r != '\n' && r != '\t') {
+			return "", "", "", fmt.Errorf("%w: description contains unprintable characters", ErrInvalidOrganization)
+		}
+	}
+
+	domain = normalizeDomain(domain)
+	if domain != "" && !validDomain(domain) {
+		return "", "", "", fmt.Errorf("%w: %q is not a valid domain name", ErrInvalidOrganization, domain)
+	}
+
+	return name, description, domain, nil
+}
+
+// validDomain reports whether a lowercased domain has at least two labels of letters, digits and hyphens
+func validDomain(domain string) bool {
+	if len(domain) > maxDomainLength {
+		return false
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if !domainLabelPattern.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// paletteClusterProfilesKey holds cluster profile exports (JSON or YAML, one profile or a list) to import into lab projects
+	paletteClusterProfilesKey = "cluster_profiles"
+	// paletteClusterProfileUIDsKey holds comma-separated UIDs of profiles to copy from the service's scope into lab projects
+	paletteClusterProfileUIDsKey = "cluster_profile_uids"
+	// paletteClusterProfileUIDsData is the ServiceData key listing the profiles imported into a lab project
+	paletteClusterProfileUIDsData = "palette_project_cluster_profile_uids"
+)
+
+// hasClusterProfiles reports whether the service is configured to import cluster profiles into lab projects
+func (v *PaletteProjectService) hasClusterProfiles() bool {
+	return strings.TrimSpace(v.clusterProfiles) != "" || len(v.clusterProfileUIDs) > 0
+}
+
+// parseClusterProfileBlobs splits a cluster_profiles value into one JSON document per profile.
+// The value may be JSON or YAML and hold a single profile export or a list of them.
+func parseClusterProfileBlobs(blob string) ([][]byte, error) {
+	if strings.TrimSpace(blob) == "" {
+		return nil, nil
+	}
+
+	// YAML is a superset of JSON, so one decoder handles both
+	var document interface{}
+	if err := yaml.Unmarshal([]byte(blob), &document); err != nil {
+		return nil, fmt.Errorf("failed to parse cluster profiles: %w", err)
+	}
+
+	profiles, isList := document.([]interface{})
+	if !isList {
+		profiles = []interface{}{document}
+	}
+
+	blobs := make([][]byte, 0, len(profiles))
+	for i, profile := range profiles {
+		if _, isObject := profile.(map[string]interface{}); !isObject {
+			return nil, fmt.Errorf("cluster profile %d is not an object", i+1)
+		}
+		data, err := json.Marshal(profile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode cluster profile %d: %w", i+1, err)
+		}
+		blobs = append(blobs, data)
+	}
+	return blobs, nil
+}
+
+// importClusterProfiles imports the configured cluster profiles into a lab project and returns their UIDs.
+// UIDs are recorded in the lab's ServiceData as each profile is created, so cleanup removes them even
+// when a later import fails.
+func (v *PaletteProjectService) importClusterProfiles(ctx *interfaces.SetupContext, projectID string) ([]string, error) {
+	profiles, err := parseClusterProfileBlobs(v.clusterProfiles)
+	if err != nil {
+		return nil, err
+	}
+
+	// Profiles referenced by UID are exported from the scope the service is configured for
+	for _, sourceUID := range v.clusterProfileUIDs {
+		fmt.Printf("- Exporting cluster profile %s\n", sourceUID)
+		profile, err := v.paletteRequest(ctx.Context, "GET", fmt.Sprintf("/v1/clusterprofiles/%s/export", sourceUID), v.projectUID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export cluster profile %s: %w", sourceUID, err)
+		}
+		profiles = append(profiles, profile)
+	}
+
+	var importedUIDs []string
+	for i, profile := range profiles {
+		fmt.Printf("- Importing cluster profile %d of %d into project %s\n", i+1, len(profiles), projectID)
+		respBody, err := v.paletteRequest(ctx.Context, "POST", "/v1/clusterprofiles/import?publish=true", projectID, profile)
+		if err != nil {
+			return importedUIDs, fmt.Errorf("failed to import cluster profile %d: %w", i+1, err)
+		}
+
+		var created struct {
+			UID string `json:"uid"`
+		}
+		if err := json.Unmarshal(respBody, &created); err != nil || created.UID == "" {
+			return importedUIDs, fmt.Errorf("failed to read UID of imported cluster profile %d", i+1)
+		}
+		fmt.Printf("  Cluster profile imported with UID: %s\n", created.UID)
+
+		importedUIDs = append(importedUIDs, created.UID)
+		if ctx.Lab != nil {
+			if ctx.Lab.ServiceData == nil {
+				ctx.Lab.ServiceData = make(map[string]string)
+			}
+			ctx.Lab.ServiceData[paletteClusterProfileUIDsData] = strings.Join(importedUIDs, ",")
+		}
+	}
+
+	return importedUIDs, nil
+}
+
+// deleteClusterProfiles removes cluster profiles imported into a lab project. Profiles that are already
+// gone are skipped.
+func (v *PaletteProjectService) deleteClusterProfiles(ctx *interfaces.CleanupContext, projectID string, profileUIDs []string) {
+	for _, profileUID := range profileUIDs {
+		fmt.Printf("  Deleting cluster profile: %s\n", profileUID)
+		_, err := v.paletteRequest(ctx.Context, "DELETE", "/v1/clusterprofiles/"+profileUID, projectID, nil)
+		if err != nil {
+			if isPaletteNotFound(err) {
+				fmt.Printf("  Cluster profile %s not found, treating as already deleted\n", profileUID)
+				ctx.SkipResource("cluster profile "+profileUID, "delete", "not found")
+				continue
+			}
+			fmt.Printf("Warning: Failed to delete cluster profile %s: %v\n", profileUID, err)
+		}
+		ctx.ReportResource("cluster profile "+profileUID, "delete", err)
+	}
+}
+
+// paletteAPIError is returned for Palette API responses outside the 2xx range
+type paletteAPIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *paletteAPIError) Error() string {
+	return fmt.Sprintf("palette API returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// isPaletteNotFound reports whether an error is a Palette 404
+func isPaletteNotFound(err error) bool {
+	apiErr, ok := err.(*paletteAPIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// paletteRequest calls the Palette REST API for endpoints the SDK client doesn't cover.
+// projectUID scopes the request to a project; empty means tenant scope.
+func (v *PaletteProjectService) paletteRequest(ctx context.Context, method, path, projectUID string, payload []byte) ([]byte, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(v.host, "/")+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("ApiKey", v.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	if projectUID != "" {
+		req.Header.Set("ProjectUid", projectUID)
+	}
+
+	resp, err := httpDoerOr(v.httpDoer, &http.Client{Timeout: 60 * time.Second}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &paletteAPIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return respBody, nil
+}
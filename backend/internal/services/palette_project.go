@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,7 +13,6 @@ import (
 
 	"github.com/go-openapi/strfmt"
 	"github.com/google/uuid"
-	"github.com/sethvargo/go-password/password"
 	"github.com/spectrocloud/palette-sdk-go/api/client/version1"
 	palettemodels "github.com/spectrocloud/palette-sdk-go/api/models"
 	"github.com/spectrocloud/palette-sdk-go/client"
@@ -23,16 +23,77 @@ type PaletteProjectService struct {
 	host       string
 	apiKey     string
 	projectUID string
+	// Scope API requests are sent in, project or tenant; unset infers project scope from projectUID
+	scope string
+	// How long API keys and edge tokens issued to lab users stay valid in Palette
+	apiKeyExpiry time.Duration
+	// Naming of lab projects and users, with ${lab_id} replaced, and the role users get in their project
+	projectNamePattern string
+	userEmailPattern   string
+	projectRole        string
+	// Cluster profiles imported into every lab project, as exports and as source profile UIDs
+	clusterProfiles    string
+	clusterProfileUIDs []string
+	// Retries of setting the lab user's password, and whether setup fails when it can't be set instead of
+	// pointing the credential at the activation link
+	activationRetry        AuthRetryPolicy
+	failOnActivationFailed bool
 	// Service config credentials (preferred)
-	serviceConfig *models.ServiceConfig
+	serviceConfig  *models.ServiceConfig
+	passwordPolicy PasswordPolicy
+	// Replaces the real HTTP client of REST API calls the SDK client doesn't cover, set with SetHTTPDoer
+	httpDoer HTTPDoer
+}
+
+// paletteEdgeTokenUIDsData is the ServiceData key listing the edge registration tokens created for a lab
+const paletteEdgeTokenUIDsData = "palette_project_edge_token_uids"
+
+// defaultPaletteAPIKeyExpiry is the lifetime of lab API keys and edge tokens unless configured otherwise
+const defaultPaletteAPIKeyExpiry = 7 * 24 * time.Hour
+
+// Default naming of lab projects and users, and the role users are given in their project
+const (
+	defaultPaletteProjectNamePattern = "lab-${lab_id}"
+	defaultPaletteUserEmailPattern   = "lab+${lab_id}@spectrocloud.com"
+	defaultPaletteProjectRole        = "Project Admin"
+)
+
+// defaultPaletteActivationRetry returns how setting a lab user's password is retried unless configured otherwise
+func defaultPaletteActivationRetry() AuthRetryPolicy {
+	return AuthRetryPolicy{
+		Attempts:       3,
+		InitialBackoff: 2 * time.Second,
+		MaxBackoff:     30 * time.Second,
+	}
+}
+
+// activationRetryPolicyWithOverrides applies activation_retry_* settings to a retry policy
+func activationRetryPolicyWithOverrides(policy AuthRetryPolicy, config map[string]string) AuthRetryPolicy {
+	return policy.withOverrides(map[string]string{
+		"auth_retry_attempts":    config["activation_retry_attempts"],
+		"auth_retry_backoff":     config["activation_retry_backoff"],
+		"auth_retry_max_backoff": config["activation_retry_max_backoff"],
+	})
 }
 
 // NewPaletteProjectService creates a new Palette Project service instance
 func NewPaletteProjectService() *PaletteProjectService {
 	return &PaletteProjectService{
-		host:       os.Getenv("PALETTE_HOST"),
-		apiKey:     os.Getenv("PALETTE_API_KEY"),
-		projectUID: os.Getenv("PALETTE_PROJECT_UID"),
+		host:               os.Getenv("PALETTE_HOST"),
+		apiKey:             os.Getenv("PALETTE_API_KEY"),
+		projectUID:         os.Getenv("PALETTE_PROJECT_UID"),
+		scope:              strings.ToLower(strings.TrimSpace(os.Getenv("PALETTE_SCOPE"))),
+		apiKeyExpiry:       defaultPaletteAPIKeyExpiry,
+		projectNamePattern: defaultPaletteProjectNamePattern,
+		userEmailPattern:   defaultPaletteUserEmailPattern,
+		projectRole:        defaultPaletteProjectRole,
+		activationRetry: activationRetryPolicyWithOverrides(defaultPaletteActivationRetry(), map[string]string{
+			"activation_retry_attempts":    os.Getenv("PALETTE_ACTIVATION_RETRY_ATTEMPTS"),
+			"activation_retry_backoff":     os.Getenv("PALETTE_ACTIVATION_RETRY_BACKOFF"),
+			"activation_retry_max_backoff": os.Getenv("PALETTE_ACTIVATION_RETRY_MAX_BACKOFF"),
+		}),
+		failOnActivationFailed: os.Getenv("PALETTE_ACTIVATION_FAILURE") == "fail",
+		passwordPolicy:         passwordPolicyFromEnv(palettePasswordPrefix),
 	}
 }
 
@@ -50,6 +111,62 @@ func (v *PaletteProjectService) ConfigureFromServiceConfig(serviceConfig *models
 	if projectUID, ok := serviceConfig.Config["project_uid"]; ok {
 		v.projectUID = projectUID
 	}
+	if scope, ok := serviceConfig.Config["scope"]; ok && scope != "" {
+		v.scope = strings.ToLower(strings.TrimSpace(scope))
+	}
+	if apiKeyExpiry, ok := serviceConfig.Config["api_key_expiry"]; ok && apiKeyExpiry != "" {
+		if expiry, err := time.ParseDuration(apiKeyExpiry); err == nil && expiry > 0 {
+			v.apiKeyExpiry = expiry
+		} else {
+			fmt.Printf("Warning: invalid api_key_expiry %q, using %v\n", apiKeyExpiry, v.apiKeyExpiry)
+		}
+	}
+	// Patterns without ${lab_id} would give every lab the same project or user
+	if pattern, ok := serviceConfig.Config["project_name_pattern"]; ok && pattern != "" {
+		if strings.Contains(pattern, "${lab_id}") {
+			v.projectNamePattern = pattern
+		} else {
+			fmt.Printf("Warning: project_name_pattern %q does not contain ${lab_id}, using %q\n", pattern, v.projectNamePattern)
+		}
+	}
+	if pattern, ok := serviceConfig.Config["user_email_pattern"]; ok && pattern != "" {
+		if strings.Contains(pattern, "${lab_id}") && strings.Contains(pattern, "@") {
+			v.userEmailPattern = pattern
+		} else {
+			fmt.Printf("Warning: user_email_pattern %q must contain ${lab_id} and a domain, using %q\n", pattern, v.userEmailPattern)
+		}
+	}
+	if role, ok := serviceConfig.Config["project_role"]; ok && role != "" {
+		v.projectRole = role
+	}
+	if clusterProfiles, ok := serviceConfig.Config[paletteClusterProfilesKey]; ok {
+		v.clusterProfiles = clusterProfiles
+	}
+	if profileUIDs, ok := serviceConfig.Config[paletteClusterProfileUIDsKey]; ok {
+		v.clusterProfileUIDs = nil
+		for _, uid := range strings.Split(profileUIDs, ",") {
+			if uid = strings.TrimSpace(uid); uid != "" {
+				v.clusterProfileUIDs = append(v.clusterProfileUIDs, uid)
+			}
+		}
+	}
+	v.activationRetry = activationRetryPolicyWithOverrides(v.activationRetry, serviceConfig.Config)
+	switch failure := serviceConfig.Config["activation_failure"]; failure {
+	case "":
+	case "fail":
+		v.failOnActivationFailed = true
+	case "flag":
+		v.failOnActivationFailed = false
+	default:
+		fmt.Printf("Warning: invalid activation_failure %q, expected fail or flag\n", failure)
+	}
+	v.passwordPolicy = v.passwordPolicy.withOverrides(serviceConfig.Config)
+}
+
+// SetHTTPDoer replaces the client the service sends Palette REST API requests with, such as with a fake
+// in tests. Requests made through the Palette SDK client are not affected.
+func (v *PaletteProjectService) SetHTTPDoer(doer HTTPDoer) {
+	v.httpDoer = doer
 }
 
 // GetName returns the service name
@@ -67,11 +184,109 @@ func (v *PaletteProjectService) GetRequiredParams() []string {
 	return []string{"PALETTE_HOST", "PALETTE_API_KEY"}
 }
 
+// ConfigSchema describes the keys the service's configs accept (implements ConfigSchemaProvider)
+func (v *PaletteProjectService) ConfigSchema() []interfaces.ConfigField {
+	fields := []interfaces.ConfigField{
+		{Key: "host", Description: "Palette API host", Required: true, Env: "PALETTE_HOST"},
+		{Key: "api_key", Description: "Palette API key used to manage lab projects", Required: true, Secret: true, Env: "PALETTE_API_KEY"},
+		{Key: "scope", Description: "Scope API requests are sent in: project (requires project_uid) or tenant, which ignores project_uid. Unset uses project scope when project_uid is set", Env: "PALETTE_SCOPE"},
+		{Key: "project_uid", Description: "Project UID sent with API requests in project scope", Env: "PALETTE_PROJECT_UID"},
+		{Key: "api_key_expiry", Description: "How long API keys and edge tokens issued to lab users stay valid", Default: defaultPaletteAPIKeyExpiry.String()},
+		{Key: "project_name_pattern", Description: "Name of lab projects, must contain ${lab_id}", Default: defaultPaletteProjectNamePattern},
+		{Key: "user_email_pattern", Description: "Email of lab users, must contain ${lab_id} and a domain", Default: defaultPaletteUserEmailPattern},
+		{Key: "project_role", Description: "Role lab users get in their project", Default: defaultPaletteProjectRole},
+		{Key: paletteClusterProfilesKey, Description: "Cluster profile exports (JSON or YAML, one profile or a list) imported into every lab project"},
+		{Key: paletteClusterProfileUIDsKey, Description: "Comma-separated UIDs of cluster profiles copied into every lab project"},
+		{Key: "activation_retry_attempts", Description: "Attempts to set the lab user's password", Default: "3", Env: "PALETTE_ACTIVATION_RETRY_ATTEMPTS"},
+		{Key: "activation_retry_backoff", Description: "Wait before retrying to set the password, doubled after each attempt", Default: "2s", Env: "PALETTE_ACTIVATION_RETRY_BACKOFF"},
+		{Key: "activation_retry_max_backoff", Description: "Longest wait between password attempts", Default: "30s", Env: "PALETTE_ACTIVATION_RETRY_MAX_BACKOFF"},
+		{Key: "activation_failure", Description: "fail to fail setup when the password can't be set, flag to hand out the activation link instead", Default: "flag", Env: "PALETTE_ACTIVATION_FAILURE"},
+	}
+	return append(fields, passwordPolicyConfigFields()...)
+}
+
+// ServiceDataKeys returns the prefixes of the ServiceData keys the service records (implements Service interface)
+func (v *PaletteProjectService) ServiceDataKeys() []string {
+	return []string{"palette_project_"}
+}
+
+// DescribeResources returns the resource names the service derives from the lab ID (implements Service interface)
+func (v *PaletteProjectService) DescribeResources(labID string) map[string]string {
+	return map[string]string{
+		"palette_project_name":         v.projectName(labID),
+		"palette_project_user_email":   v.userEmail(labID),
+		"palette_project_api_key_name": v.apiKeyName(labID),
+	}
+}
+
+// projectName returns the name of a lab's project
+func (v *PaletteProjectService) projectName(labID string) string {
+	return strings.ReplaceAll(v.projectNamePattern, "${lab_id}", labID)
+}
+
+// userEmail returns the email address of a lab's user
+func (v *PaletteProjectService) userEmail(labID string) string {
+	return strings.ReplaceAll(v.userEmailPattern, "${lab_id}", labID)
+}
+
+// apiKeyName returns the name of a lab user's API key
+func (v *PaletteProjectService) apiKeyName(labID string) string {
+	return v.projectName(labID) + "-api-key"
+}
+
+// scopeName returns the scope the service sends API requests in, project or tenant
+func (v *PaletteProjectService) scopeName() string {
+	return resolvePaletteScope(v.scope, v.projectUID)
+}
+
 // Name returns the service name (implements Setup interface)
 func (v *PaletteProjectService) Name() string {
 	return v.GetName()
 }
 
+// TestConnection verifies the host and API key by looking up a built-in role, and with project scope that
+// the API key can see the project
+func (v *PaletteProjectService) TestConnection() error {
+	if v.host == "" || v.apiKey == "" {
+		return fmt.Errorf("host and api_key are required")
+	}
+	if _, err := parsePaletteScope(v.scope, v.projectUID); err != nil {
+		return err
+	}
+
+	pc := client.New(
+		client.WithPaletteURI(v.host),
+		client.WithAPIKey(v.apiKey),
+	)
+	if v.scopeName() == paletteScopeProject {
+		// Projects are listed at tenant scope
+		client.WithScopeTenant()(pc)
+		projects, err := pc.GetProjects()
+		if err != nil {
+			return fmt.Errorf("failed to list projects: %w", err)
+		}
+		found := false
+		for _, project := range projects.Items {
+			if project.Metadata != nil && project.Metadata.UID == v.projectUID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("project %s is not visible to the API key", v.projectUID)
+		}
+		client.WithScopeProject(v.projectUID)(pc)
+	} else {
+		client.WithScopeTenant()(pc)
+	}
+
+	if _, err := pc.GetRole(v.projectRole); err != nil {
+		return fmt.Errorf("failed to look up %s role: %w", v.projectRole, err)
+	}
+
+	return nil
+}
+
 // ExecuteSetup sets up Palette Project access and adds credentials
 func (v *PaletteProjectService) ExecuteSetup(ctx *interfaces.SetupContext) error {
 	// Update progress: Creating Project
@@ -86,6 +301,12 @@ func (v *PaletteProjectService) ExecuteSetup(ctx *interfaces.SetupContext) error
 		}
 		return err
 	}
+	if _, err := parsePaletteScope(v.scope, v.projectUID); err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Creating Project", "failed", err.Error())
+		}
+		return err
+	}
 
 	// Use lab ID directly as it's already the short ID
 	shortID := ctx.LabID
@@ -98,28 +319,26 @@ func (v *PaletteProjectService) ExecuteSetup(ctx *interfaces.SetupContext) error
 		client.WithAPIKey(v.apiKey),
 	)
 
-	// Set scope based on project UID
-	scope := "tenant"
-	if v.projectUID != "" {
+	// Set the configured scope, or project scope when only a project UID is set
+	if v.scopeName() == paletteScopeProject {
 		client.WithScopeProject(v.projectUID)(pc)
-		scope = "project"
 	} else {
 		client.WithScopeTenant()(pc)
 	}
 
-	fmt.Printf("Using %s scope\n", scope)
+	fmt.Printf("Using %s scope\n", v.scopeName())
 
 	// Create Project Entity
 	projectEntity := palettemodels.V1ProjectEntity{
 		Metadata: &palettemodels.V1ObjectMeta{
-			Name: fmt.Sprintf("lab-%s", shortID),
+			Name: v.projectName(shortID),
 		},
 	}
 
 	// Create User Entity
 	userEntity := palettemodels.V1UserEntity{
 		Spec: &palettemodels.V1UserSpecEntity{
-			EmailID:   fmt.Sprintf("lab+%s@spectrocloud.com", shortID),
+			EmailID:   v.userEmail(shortID),
 			FirstName: "Lab",
 			LastName:  "User",
 		},
@@ -162,14 +381,14 @@ func (v *PaletteProjectService) ExecuteSetup(ctx *interfaces.SetupContext) error
 		ctx.UpdateProgress("Configuring Access Permissions", "running", "Configuring access permissions...")
 	}
 
-	// Get Project Admin Role
-	fmt.Printf("- Getting Project Admin role\n")
-	projectAdmin, err := pc.GetRole("Project Admin")
+	// Get the role lab users are given in their project
+	fmt.Printf("- Getting %s role\n", v.projectRole)
+	projectRole, err := pc.GetRole(v.projectRole)
 	if err != nil {
 		if ctx.UpdateProgress != nil {
-			ctx.UpdateProgress("Configuring Access Permissions", "failed", fmt.Sprintf("Failed to get Project Admin role: %v", err))
+			ctx.UpdateProgress("Configuring Access Permissions", "failed", fmt.Sprintf("Failed to get %s role: %v", v.projectRole, err))
 		}
-		return fmt.Errorf("failed to get Project Admin role: %w", err)
+		return fmt.Errorf("failed to get %s role: %w", v.projectRole, err)
 	}
 
 	// Associate User with Project Role
@@ -177,12 +396,12 @@ func (v *PaletteProjectService) ExecuteSetup(ctx *interfaces.SetupContext) error
 		Projects: []*palettemodels.V1ProjectRolesPatchProjectsItems0{{
 			ProjectUID: projectID,
 			Roles: []string{
-				projectAdmin.Metadata.UID,
+				projectRole.Metadata.UID,
 			},
 		}},
 	}
 
-	fmt.Printf("- Assigning Project Admin role to user\n")
+	fmt.Printf("- Assigning %s role to user\n", v.projectRole)
 	if err = pc.AssociateUserProjectRole(userID, &projectRolePatch); err != nil {
 		if ctx.UpdateProgress != nil {
 			ctx.UpdateProgress("Configuring Access Permissions", "failed", fmt.Sprintf("Failed to associate user with project role: %v", err))
@@ -200,6 +419,25 @@ func (v *PaletteProjectService) ExecuteSetup(ctx *interfaces.SetupContext) error
 		ctx.UpdateProgress("Setting up User Account", "completed", "User account created")
 	}
 
+	// Import starter cluster profiles into the project, if configured
+	if v.hasClusterProfiles() {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Importing Cluster Profiles", "running", "Importing cluster profiles into project...")
+		}
+
+		profileUIDs, err := v.importClusterProfiles(ctx, projectID)
+		if err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Importing Cluster Profiles", "failed", fmt.Sprintf("Failed to import cluster profiles: %v", err))
+			}
+			return fmt.Errorf("failed to import cluster profiles: %w", err)
+		}
+
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Importing Cluster Profiles", "completed", fmt.Sprintf("Imported %d cluster profile(s)", len(profileUIDs)))
+		}
+	}
+
 	// Get User to get activation link
 	user, err := pc.GetUserByID(userID)
 	if err != nil {
@@ -219,13 +457,13 @@ func (v *PaletteProjectService) ExecuteSetup(ctx *interfaces.SetupContext) error
 	}
 
 	// Generate secure password
-	mySecretPassword, err := password.Generate(16, 4, 4, false, false)
+	goodPassword, err := generatePassword(v.passwordPolicy)
 	if err != nil {
 		return fmt.Errorf("failed to generate password: %w", err)
 	}
-	goodPassword := "L3@rN-" + mySecretPassword
 
 	// Activate user password if token is available
+	activationErr := fmt.Errorf("activation link has no password token")
 	if token != "" {
 		fmt.Printf("- Setting user password\n")
 		passwordActivateParams := version1.NewV1PasswordActivateParams()
@@ -233,30 +471,28 @@ func (v *PaletteProjectService) ExecuteSetup(ctx *interfaces.SetupContext) error
 		passwordActivateParams.Body.Password = &passwordValues
 		passwordActivateParams.PasswordToken = token
 
-		// Try password activation with retry logic
-		var respPass interface{}
-		var err error
-		maxRetries := 3
-		for attempt := 1; attempt <= maxRetries; attempt++ {
-			respPass, err = pc.Client.V1PasswordActivate(passwordActivateParams)
-			if err == nil {
-				fmt.Printf("  Password activated successfully on attempt %d: %v\n", attempt, respPass)
-				break
-			} else {
-				fmt.Printf("  Password activation attempt %d failed: %v\n", attempt, err)
-				if attempt < maxRetries {
-					time.Sleep(2 * time.Second) // Wait before retry
-				}
+		activationErr = retryWithBackoff(ctx.Context, v.activationRetry, "Palette password activation", func() error {
+			_, err := pc.Client.V1PasswordActivate(passwordActivateParams)
+			return err
+		})
+		if activationErr == nil {
+			fmt.Printf("  Password activated successfully\n")
+		}
+	}
+
+	// A credential whose password was never set would be a login that silently doesn't work
+	passwordSet := activationErr == nil
+	if !passwordSet {
+		if v.failOnActivationFailed {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Setting up User Account", "failed", fmt.Sprintf("Failed to set user password: %v", activationErr))
 			}
+			return fmt.Errorf("failed to set password of Palette user %s: %w", userEntity.Spec.EmailID, activationErr)
 		}
-		if err != nil {
-			fmt.Printf("Warning: All password activation attempts failed: %v\n", err)
+		fmt.Printf("Warning: password of Palette user %s not set, pointing the credential at the activation link: %v\n", userEntity.Spec.EmailID, activationErr)
+		if ctx.AddLog != nil {
+			ctx.AddLog(fmt.Sprintf("Palette password could not be set (%v); the user must use the activation link", activationErr))
 		}
-	} else {
-		fmt.Printf("Warning: No activation token found, attempting direct password update\n")
-		// Try to update password directly if activation token is not available
-		// This might require additional API calls depending on the Palette SDK
-		fmt.Printf("  Note: Password may need to be set manually in Palette UI\n")
 	}
 
 	// Update progress: Generating API Keys
@@ -264,16 +500,19 @@ func (v *PaletteProjectService) ExecuteSetup(ctx *interfaces.SetupContext) error
 		ctx.UpdateProgress("Generating API Keys", "running", "Generating API keys...")
 	}
 
+	// API keys and edge tokens outlive the lab unless cleanup removes them, so report their real expiry
+	apiKeyExpiresAt := time.Now().Add(v.apiKeyExpiry)
+
 	// Create API Key
 	fmt.Printf("- Creating API key for user\n")
 	body := &palettemodels.V1APIKeyEntity{
 		Metadata: &palettemodels.V1ObjectMeta{
-			Name:        fmt.Sprintf("lab-%s-api-key", shortID),
+			Name:        v.apiKeyName(shortID),
 			Annotations: make(map[string]string),
 		},
 		Spec: &palettemodels.V1APIKeySpecEntity{
 			UserUID: userID,
-			Expiry:  palettemodels.V1Time(time.Now().Add(time.Duration(7 * 24 * time.Hour))),
+			Expiry:  palettemodels.V1Time(apiKeyExpiresAt),
 		},
 	}
 	body.Metadata.Annotations["description"] = "Autogenerated Lab API Key"
@@ -302,11 +541,11 @@ func (v *PaletteProjectService) ExecuteSetup(ctx *interfaces.SetupContext) error
 	fmt.Printf("- Creating edge registration token\n")
 	edgeEntity := &palettemodels.V1EdgeTokenEntity{
 		Metadata: &palettemodels.V1ObjectMeta{
-			Name: fmt.Sprintf("lab-%s", shortID),
+			Name: v.projectName(shortID),
 		},
 		Spec: &palettemodels.V1EdgeTokenSpecEntity{
 			DefaultProjectUID: projectID,
-			Expiry:            palettemodels.V1Time(time.Now().Add(time.Duration(7 * 24 * time.Hour))),
+			Expiry:            palettemodels.V1Time(apiKeyExpiresAt),
 		},
 	}
 	edgeTokenParams := version1.NewV1EdgeTokensCreateParams().WithBody(edgeEntity)
@@ -327,6 +566,12 @@ func (v *PaletteProjectService) ExecuteSetup(ctx *interfaces.SetupContext) error
 		return fmt.Errorf("failed to get edge token: %w", err)
 	}
 	fmt.Printf("  Edge token created: %s\n", edgeTokenGet.Payload.Spec.Token)
+	if ctx.Lab != nil {
+		if ctx.Lab.ServiceData == nil {
+			ctx.Lab.ServiceData = make(map[string]string)
+		}
+		ctx.Lab.ServiceData[paletteEdgeTokenUIDsData] = *registrationTokenUid.Payload.UID
+	}
 
 	// Update progress: Creating Edge Tokens completed
 	if ctx.UpdateProgress != nil {
@@ -352,6 +597,7 @@ func (v *PaletteProjectService) ExecuteSetup(ctx *interfaces.SetupContext) error
 		ctx.Lab.ServiceData["palette_project_name"] = projectEntity.Metadata.Name
 		ctx.Lab.ServiceData["palette_project_user_email"] = userEntity.Spec.EmailID
 		ctx.Lab.ServiceData["palette_project_api_key_name"] = body.Metadata.Name
+		ctx.Lab.ServiceData["palette_project_password_set"] = strconv.FormatBool(passwordSet)
 	}
 
 	// Add credentials to the lab
@@ -362,12 +608,20 @@ func (v *PaletteProjectService) ExecuteSetup(ctx *interfaces.SetupContext) error
 		Username:  userEntity.Spec.EmailID,
 		Password:  goodPassword,
 		URL:       fmt.Sprintf("%s/login", v.host),
-		ExpiresAt: time.Now().Add(time.Duration(ctx.Duration) * time.Minute),
-		Notes: fmt.Sprintf("Spectro Cloud Project access. Project: %s, API Key: %s, Edge Token: %s",
-			projectEntity.Metadata.Name, resp.Payload.APIKey, edgeTokenGet.Payload.Spec.Token),
+		ExpiresAt: apiKeyExpiresAt,
+		Notes: fmt.Sprintf("Spectro Cloud Project access. Project: %s, API Key: %s, Edge Token: %s (API key and edge token expire %s; all access is removed when the lab ends)",
+			projectEntity.Metadata.Name, resp.Payload.APIKey, edgeTokenGet.Payload.Spec.Token, apiKeyExpiresAt.Format(time.RFC3339)),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
+	if !passwordSet {
+		credential.Password = ""
+		if user.Status.ActivationLink != "" {
+			credential.Notes = fmt.Sprintf("Password not set — use the activation link to choose one: %s. %s", user.Status.ActivationLink, credential.Notes)
+		} else {
+			credential.Notes = "Password not set — reset it from the Palette login page. " + credential.Notes
+		}
+	}
 
 	if err := ctx.AddCredential(credential); err != nil {
 		if ctx.UpdateProgress != nil {
@@ -380,6 +634,199 @@ func (v *PaletteProjectService) ExecuteSetup(ctx *interfaces.SetupContext) error
 	return nil
 }
 
+// ListLabResources lists projects following the project name pattern, lab-{id} by default
+func (v *PaletteProjectService) ListLabResources() ([]interfaces.LabResource, error) {
+	if v.host == "" || v.apiKey == "" {
+		return nil, fmt.Errorf("PALETTE_HOST and PALETTE_API_KEY configuration is required")
+	}
+
+	// Projects are listed at tenant scope
+	pc := client.New(
+		client.WithPaletteURI(v.host),
+		client.WithAPIKey(v.apiKey),
+	)
+	client.WithScopeTenant()(pc)
+
+	projects, err := pc.GetProjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+
+	prefix, suffix, _ := strings.Cut(v.projectNamePattern, "${lab_id}")
+	var resources []interfaces.LabResource
+	for _, project := range projects.Items {
+		if project.Metadata == nil {
+			continue
+		}
+		name := project.Metadata.Name
+		if len(name) <= len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		resources = append(resources, interfaces.LabResource{
+			Name:  name,
+			LabID: strings.TrimSuffix(strings.TrimPrefix(name, prefix), suffix),
+		})
+	}
+
+	return resources, nil
+}
+
+// RotateCredential replaces the lab user's API key with a new one that expires at the same time,
+// updating the key shown in the credential notes
+func (v *PaletteProjectService) RotateCredential(ctx context.Context, lab *models.Lab, credential *models.Credential) error {
+	if v.host == "" || v.apiKey == "" {
+		return fmt.Errorf("PALETTE_HOST and PALETTE_API_KEY configuration is required")
+	}
+
+	userID := lab.ServiceData["palette_project_user_id"]
+	if userID == "" {
+		return fmt.Errorf("lab has no Palette user to issue an API key for")
+	}
+	apiKeyName := lab.ServiceData["palette_project_api_key_name"]
+	if apiKeyName == "" {
+		apiKeyName = v.apiKeyName(lab.ID)
+	}
+
+	pc := client.New(
+		client.WithPaletteURI(v.host),
+		client.WithAPIKey(v.apiKey),
+	)
+	if v.scopeName() == paletteScopeProject {
+		client.WithScopeProject(v.projectUID)(pc)
+	} else {
+		client.WithScopeTenant()(pc)
+	}
+
+	fmt.Printf("Rotating Palette API key %s for lab %s\n", apiKeyName, lab.ID)
+	if err := pc.DeleteAPIKeyByName(apiKeyName); err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+
+	body := &palettemodels.V1APIKeyEntity{
+		Metadata: &palettemodels.V1ObjectMeta{
+			Name:        apiKeyName,
+			Annotations: map[string]string{"description": "Autogenerated Lab API Key"},
+		},
+		Spec: &palettemodels.V1APIKeySpecEntity{
+			UserUID: userID,
+			Expiry:  palettemodels.V1Time(credential.ExpiresAt),
+		},
+	}
+	resp, err := pc.Client.V1APIKeysCreate(version1.NewV1APIKeysCreateParams().WithBody(body))
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	// The notes read "... API Key: <key>, Edge Token: ..."
+	const keyLabel = "API Key: "
+	if start := strings.Index(credential.Notes, keyLabel); start >= 0 {
+		start += len(keyLabel)
+		end := strings.Index(credential.Notes[start:], ",")
+		if end < 0 {
+			end = len(credential.Notes) - start
+		}
+		credential.Notes = credential.Notes[:start] + resp.Payload.APIKey + credential.Notes[start+end:]
+	} else {
+		credential.Notes = fmt.Sprintf("%s API Key: %s", credential.Notes, resp.Payload.APIKey)
+	}
+	return nil
+}
+
+// ListRegistrationTokens lists the edge registration tokens of a lab: those recorded in its ServiceData,
+// those named after it and those registering devices into its project
+func (v *PaletteProjectService) ListRegistrationTokens(ctx context.Context, lab *models.Lab) ([]interfaces.RegistrationToken, error) {
+	if v.host == "" || v.apiKey == "" {
+		return nil, fmt.Errorf("PALETTE_HOST and PALETTE_API_KEY configuration is required")
+	}
+
+	recorded := make(map[string]bool)
+	for _, uid := range strings.Split(lab.ServiceData[paletteEdgeTokenUIDsData], ",") {
+		if uid = strings.TrimSpace(uid); uid != "" {
+			recorded[uid] = true
+		}
+	}
+	labTokenName := v.projectName(lab.ID)
+	projectID := lab.ServiceData["palette_project_id"]
+
+	pc := client.New(
+		client.WithPaletteURI(v.host),
+		client.WithAPIKey(v.apiKey),
+	)
+	if v.scopeName() == paletteScopeProject {
+		client.WithScopeProject(v.projectUID)(pc)
+	} else {
+		client.WithScopeTenant()(pc)
+	}
+
+	edgeTokens, err := pc.Client.V1EdgeTokensList(version1.NewV1EdgeTokensListParamsWithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list edge tokens: %w", err)
+	}
+
+	tokens := make([]interfaces.RegistrationToken, 0)
+	for _, token := range edgeTokens.Payload.Items {
+		if token == nil || token.Metadata == nil {
+			continue
+		}
+
+		var tokenProjectID string
+		if token.Spec != nil && token.Spec.DefaultProject != nil {
+			tokenProjectID = token.Spec.DefaultProject.UID
+		}
+		if !recorded[token.Metadata.UID] && token.Metadata.Name != labTokenName && (projectID == "" || tokenProjectID != projectID) {
+			continue
+		}
+
+		registrationToken := interfaces.RegistrationToken{
+			UID:        token.Metadata.UID,
+			Name:       token.Metadata.Name,
+			ProjectUID: tokenProjectID,
+			Recorded:   recorded[token.Metadata.UID],
+		}
+		if token.Spec != nil {
+			registrationToken.ExpiresAt = time.Time(token.Spec.Expiry)
+		}
+		tokens = append(tokens, registrationToken)
+	}
+
+	return tokens, nil
+}
+
+// RevokeRegistrationToken deletes one of a lab's edge registration tokens, so no further devices can
+// register with it
+func (v *PaletteProjectService) RevokeRegistrationToken(ctx context.Context, lab *models.Lab, tokenUID string) error {
+	if v.host == "" || v.apiKey == "" {
+		return fmt.Errorf("PALETTE_HOST and PALETTE_API_KEY configuration is required")
+	}
+
+	pc := client.New(
+		client.WithPaletteURI(v.host),
+		client.WithAPIKey(v.apiKey),
+	)
+	if v.scopeName() == paletteScopeProject {
+		client.WithScopeProject(v.projectUID)(pc)
+	} else {
+		client.WithScopeTenant()(pc)
+	}
+
+	fmt.Printf("Revoking registration token %s of lab %s\n", tokenUID, lab.ID)
+	if err := pc.DeleteRegistrationToken(tokenUID); err != nil {
+		return fmt.Errorf("failed to delete registration token: %w", err)
+	}
+
+	// Forget the token so cleanup and later listings don't look for it
+	var remaining []string
+	for _, uid := range strings.Split(lab.ServiceData[paletteEdgeTokenUIDsData], ",") {
+		if uid = strings.TrimSpace(uid); uid != "" && uid != tokenUID {
+			remaining = append(remaining, uid)
+		}
+	}
+	if lab.ServiceData != nil {
+		lab.ServiceData[paletteEdgeTokenUIDsData] = strings.Join(remaining, ",")
+	}
+	return nil
+}
+
 // ExecuteCleanup cleans up Palette Project resources
 func (v *PaletteProjectService) ExecuteCleanup(ctx *interfaces.CleanupContext) error {
 	// Validate required environment variables
@@ -456,10 +903,10 @@ func (v *PaletteProjectService) ExecuteCleanup(ctx *interfaces.CleanupContext) e
 				projectName = storedProjectName
 				fmt.Printf("Retrieved project name from lab ServiceData: %s\n", projectName)
 			} else {
-				projectName = fmt.Sprintf("lab-%s", sandboxID)
+				projectName = v.projectName(sandboxID)
 			}
 		} else {
-			projectName = fmt.Sprintf("lab-%s", sandboxID)
+			projectName = v.projectName(sandboxID)
 		}
 	}
 
@@ -471,10 +918,10 @@ func (v *PaletteProjectService) ExecuteCleanup(ctx *interfaces.CleanupContext) e
 				userEmail = storedUserEmail
 				fmt.Printf("Retrieved user email from lab ServiceData: %s\n", userEmail)
 			} else {
-				userEmail = fmt.Sprintf("lab+%s@spectrocloud.com", sandboxID)
+				userEmail = v.userEmail(sandboxID)
 			}
 		} else {
-			userEmail = fmt.Sprintf("lab+%s@spectrocloud.com", sandboxID)
+			userEmail = v.userEmail(sandboxID)
 		}
 	}
 
@@ -486,10 +933,10 @@ func (v *PaletteProjectService) ExecuteCleanup(ctx *interfaces.CleanupContext) e
 				apiKeyName = storedApiKeyName
 				fmt.Printf("Retrieved API key name from lab ServiceData: %s\n", apiKeyName)
 			} else {
-				apiKeyName = fmt.Sprintf("lab-%s-api-key", sandboxID)
+				apiKeyName = v.apiKeyName(sandboxID)
 			}
 		} else {
-			apiKeyName = fmt.Sprintf("lab-%s-api-key", sandboxID)
+			apiKeyName = v.apiKeyName(sandboxID)
 		}
 	}
 
@@ -499,8 +946,8 @@ func (v *PaletteProjectService) ExecuteCleanup(ctx *interfaces.CleanupContext) e
 		client.WithAPIKey(v.apiKey),
 	)
 
-	// Set scope based on project UID
-	if v.projectUID != "" {
+	// Set the configured scope, or project scope when only a project UID is set
+	if v.scopeName() == paletteScopeProject {
 		client.WithScopeProject(v.projectUID)(pc)
 	} else {
 		client.WithScopeTenant()(pc)
@@ -535,18 +982,23 @@ func (v *PaletteProjectService) ExecuteCleanup(ctx *interfaces.CleanupContext) e
 
 	// Delete API Key
 	fmt.Printf("- Deleting API key: %s\n", apiKeyName)
-	if err := pc.DeleteAPIKeyByName(apiKeyName); err != nil {
+	err := pc.DeleteAPIKeyByName(apiKeyName)
+	if err != nil {
 		fmt.Printf("Warning: Failed to delete API key: %v\n", err)
 	}
+	ctx.ReportResource("api key "+apiKeyName, "delete", err)
 
 	// Delete User (only if we found the user ID)
 	if userID != "" {
 		fmt.Printf("- Deleting user: %s (ID: %s)\n", userEmail, userID)
-		if err := pc.DeleteUser(userID); err != nil {
+		err = pc.DeleteUser(userID)
+		if err != nil {
 			fmt.Printf("Warning: Failed to delete user: %v\n", err)
 		}
+		ctx.ReportResource("user "+userEmail, "delete", err)
 	} else {
 		fmt.Printf("- Skipping user deletion (user ID not found)\n")
+		ctx.SkipResource("user "+userEmail, "delete", "user not found")
 	}
 
 	// Switch to project scope for cleanup (only if we have a project ID)
@@ -558,26 +1010,36 @@ func (v *PaletteProjectService) ExecuteCleanup(ctx *interfaces.CleanupContext) e
 		edgeClusters, err := pc.GetClusterGroupSummaries()
 		if err != nil {
 			fmt.Printf("Warning: Failed to get clusters: %v\n", err)
+			ctx.ReportResource("clusters in project "+projectName, "list", err)
 		} else {
 			for _, cluster := range edgeClusters {
 				fmt.Printf("  Deleting cluster: %s\n", cluster.Metadata.UID)
 				if err = pc.ForceDeleteCluster(cluster.Metadata.UID, true); err != nil {
 					fmt.Printf("Warning: Failed to delete cluster %s: %v\n", cluster.Metadata.UID, err)
 				}
+				ctx.ReportResource("cluster "+cluster.Metadata.UID, "delete", err)
 			}
 		}
 
+		// Clean up imported cluster profiles once no cluster uses them
+		if ctx.Lab != nil && ctx.Lab.ServiceData[paletteClusterProfileUIDsData] != "" {
+			fmt.Printf("- Cleaning up cluster profiles in project: %s\n", projectName)
+			v.deleteClusterProfiles(ctx, projectID, strings.Split(ctx.Lab.ServiceData[paletteClusterProfileUIDsData], ","))
+		}
+
 		// Clean up edge devices
 		fmt.Printf("- Cleaning up edge devices in project: %s\n", projectName)
 		edgeDevices, err := pc.ListEdgeHosts()
 		if err != nil {
 			fmt.Printf("Warning: Failed to get edge devices: %v\n", err)
+			ctx.ReportResource("edge devices in project "+projectName, "list", err)
 		} else {
 			for _, edgeDevice := range edgeDevices {
 				fmt.Printf("  Deleting edge device: %s\n", edgeDevice.Metadata.UID)
 				if err = pc.DeleteAppliance(edgeDevice.Metadata.UID); err != nil {
 					fmt.Printf("Warning: Failed to delete edge device %s: %v\n", edgeDevice.Metadata.UID, err)
 				}
+				ctx.ReportResource("edge device "+edgeDevice.Metadata.UID, "delete", err)
 			}
 		}
 
@@ -587,6 +1049,7 @@ func (v *PaletteProjectService) ExecuteCleanup(ctx *interfaces.CleanupContext) e
 		edgeTokens, err := pc.Client.V1EdgeTokensList(params)
 		if err != nil {
 			fmt.Printf("Warning: Failed to get edge tokens: %v\n", err)
+			ctx.ReportResource("registration tokens in project "+projectName, "list", err)
 		} else {
 			for _, token := range edgeTokens.Payload.Items {
 				if token.Spec.DefaultProject.UID == projectID {
@@ -594,12 +1057,13 @@ func (v *PaletteProjectService) ExecuteCleanup(ctx *interfaces.CleanupContext) e
 					if err = pc.DeleteRegistrationToken(token.Metadata.UID); err != nil {
 						fmt.Printf("Warning: Failed to delete registration token %s: %v\n", token.Metadata.UID, err)
 					}
+					ctx.ReportResource("registration token "+token.Metadata.UID, "delete", err)
 				}
 			}
 		}
 
-		// Switch back to tenant scope for project deletion
-		if v.projectUID != "" {
+		// Switch back to the service's scope for project deletion
+		if v.scopeName() == paletteScopeProject {
 			client.WithScopeProject(v.projectUID)(pc)
 		} else {
 			client.WithScopeTenant()(pc)
@@ -610,8 +1074,10 @@ func (v *PaletteProjectService) ExecuteCleanup(ctx *interfaces.CleanupContext) e
 		if err = pc.DeleteProject(projectID); err != nil {
 			fmt.Printf("Warning: Failed to delete project: %v\n", err)
 		}
+		ctx.ReportResource("project "+projectName, "delete", err)
 	} else {
 		fmt.Printf("- Skipping project cleanup (project ID not found)\n")
+		ctx.SkipResource("project "+projectName, "delete", "project not found")
 	}
 
 	fmt.Printf("Palette Project cleanup completed for lab %s\n", sandboxID)
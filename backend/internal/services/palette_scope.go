@@ -0,0 +1,65 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Scopes a Palette Project service config can manage lab projects in
+const (
+	paletteScopeProject = "project"
+	paletteScopeTenant  = "tenant"
+)
+
+// ValidatePaletteScope checks a Palette Project service config's scope setting against its project_uid
+func ValidatePaletteScope(config map[string]string) error {
+	_, err := parsePaletteScope(paletteScopeSettings(config))
+	return err
+}
+
+// PaletteScopeInferred reports whether a Palette Project service config gets project scope only because a
+// project UID is set, without a scope setting
+func PaletteScopeInferred(config map[string]string) bool {
+	scope, projectUID := paletteScopeSettings(config)
+	return strings.TrimSpace(scope) == "" && projectUID != ""
+}
+
+// paletteScopeSettings returns a config's scope and project_uid, falling back to PALETTE_SCOPE and
+// PALETTE_PROJECT_UID like the service does for keys the config doesn't set
+func paletteScopeSettings(config map[string]string) (scope, projectUID string) {
+	scope, ok := config["scope"]
+	if !ok || scope == "" {
+		scope = os.Getenv("PALETTE_SCOPE")
+	}
+	projectUID, ok = config["project_uid"]
+	if !ok {
+		projectUID = os.Getenv("PALETTE_PROJECT_UID")
+	}
+	return scope, projectUID
+}
+
+// parsePaletteScope returns the scope named by a scope setting, or "" when it is unset and the scope is
+// inferred from the project UID. Project scope needs a project UID to send requests to.
+func parsePaletteScope(scope, projectUID string) (string, error) {
+	switch scope = strings.ToLower(strings.TrimSpace(scope)); scope {
+	case "", paletteScopeTenant:
+		return scope, nil
+	case paletteScopeProject:
+		if strings.TrimSpace(projectUID) == "" {
+			return "", fmt.Errorf("scope %s requires project_uid", paletteScopeProject)
+		}
+		return scope, nil
+	default:
+		return "", fmt.Errorf("invalid scope %q, expected %s or %s", scope, paletteScopeProject, paletteScopeTenant)
+	}
+}
+
+// resolvePaletteScope returns the scope API requests are sent in. Without a scope setting, project scope
+// is used when a project UID is set, as configs did before scope could be set; tenant scope always wins.
+func resolvePaletteScope(scope, projectUID string) string {
+	if scope != paletteScopeTenant && projectUID != "" {
+		return paletteScopeProject
+	}
+	return paletteScopeTenant
+}
@@ -11,7 +11,6 @@ import (
 
 	internalclient "github.com/spectrocloud/palette-sdk-go-internal/client"
 
-	"github.com/sethvargo/go-password/password"
 	hapimodels "github.com/spectrocloud/hapi/models"
 )
 
@@ -20,6 +19,7 @@ type PaletteTenantService struct {
 	host           string
 	systemUsername string
 	systemPassword string
+	passwordPolicy PasswordPolicy
 }
 
 // NewPaletteTenantService creates a new Palette Tenant service instance
@@ -28,9 +28,24 @@ func NewPaletteTenantService() *PaletteTenantService {
 		host:           os.Getenv("palette_host"),
 		systemUsername: os.Getenv("palette_system_username"),
 		systemPassword: os.Getenv("palette_system_password"),
+		passwordPolicy: passwordPolicyFromEnv(palettePasswordPrefix),
 	}
 }
 
+// ConfigureFromServiceConfig applies service config settings on top of the environment
+func (v *PaletteTenantService) ConfigureFromServiceConfig(config map[string]string) {
+	if host, ok := config["palette_host"]; ok {
+		v.host = host
+	}
+	if systemUsername, ok := config["palette_system_username"]; ok {
+		v.systemUsername = systemUsername
+	}
+	if systemPassword, ok := config["palette_system_password"]; ok {
+		v.systemPassword = systemPassword
+	}
+	v.passwordPolicy = v.passwordPolicy.withOverrides(config)
+}
+
 // GetName returns the service name
 func (v *PaletteTenantService) GetName() string {
 	return "palette_tenant"
@@ -46,11 +61,53 @@ func (v *PaletteTenantService) GetRequiredParams() []string {
 	return []string{"palette_host", "palette_system_username", "palette_system_password"}
 }
 
+// ConfigSchema describes the keys the service's configs accept (implements ConfigSchemaProvider)
+func (v *PaletteTenantService) ConfigSchema() []interfaces.ConfigField {
+	fields := []interfaces.ConfigField{
+		{Key: "palette_host", Description: "Palette API host", Required: true, Env: "palette_host"},
+		{Key: "palette_system_username", Description: "Palette system admin user that creates tenants", Required: true, Env: "palette_system_username"},
+		{Key: "palette_system_password", Description: "Password of palette_system_username", Required: true, Secret: true, Env: "palette_system_password"},
+	}
+	return append(fields, passwordPolicyConfigFields()...)
+}
+
+// ServiceDataKeys returns the prefixes of the ServiceData keys the service records (implements Service interface)
+func (v *PaletteTenantService) ServiceDataKeys() []string {
+	return []string{"palette_tenant_"}
+}
+
+// DescribeResources returns the resource names the service derives from the lab ID (implements Service interface)
+func (v *PaletteTenantService) DescribeResources(labID string) map[string]string {
+	return map[string]string{
+		"palette_tenant_id": fmt.Sprintf("tenant-%s", labID),
+	}
+}
+
 // Name returns the service name (implements Setup interface)
 func (v *PaletteTenantService) Name() string {
 	return v.GetName()
 }
 
+// TestConnection verifies the host and system credentials by logging in as the system admin
+func (v *PaletteTenantService) TestConnection() error {
+	if v.host == "" || v.systemUsername == "" || v.systemPassword == "" {
+		return fmt.Errorf("palette_host, palette_system_username and palette_system_password are required")
+	}
+
+	pc := internalclient.New(
+		internalclient.WithHubbleURI(v.host),
+		internalclient.WithUsername(v.systemUsername),
+		internalclient.WithPassword(v.systemPassword),
+		internalclient.WithScopeSystem(v.systemUsername, v.systemPassword),
+	)
+
+	if _, err := pc.SysAdminLogin(v.systemUsername, v.systemPassword); err != nil {
+		return fmt.Errorf("failed to authenticate with system credentials: %w", err)
+	}
+
+	return nil
+}
+
 // ExecuteSetup sets up Palette Tenant user access and adds credentials
 func (v *PaletteTenantService) ExecuteSetup(ctx *interfaces.SetupContext) error {
 	fmt.Printf("PaletteTenantService.ExecuteSetup called for lab: %s\n", ctx.LabName)
@@ -216,7 +273,7 @@ func (v *PaletteTenantService) ExecuteSetup(ctx *interfaces.SetupContext) error
 
 	// Generate a secure password for the tenant admin
 	fmt.Printf("- Generating secure password for tenant admin...\n")
-	mySecretPassword, err := password.Generate(16, 4, 4, false, false)
+	goodPassword, err := generatePassword(v.passwordPolicy)
 	if err != nil {
 		fmt.Printf("ERROR: Failed to generate password: %v\n", err)
 		if ctx.UpdateProgress != nil {
@@ -226,7 +283,7 @@ func (v *PaletteTenantService) ExecuteSetup(ctx *interfaces.SetupContext) error
 	}
 
 	// Validate that password was generated
-	if mySecretPassword == "" {
+	if goodPassword == "" {
 		err := fmt.Errorf("generated password is empty")
 		if ctx.UpdateProgress != nil {
 			ctx.UpdateProgress("Setting Password", "failed", err.Error())
@@ -234,7 +291,6 @@ func (v *PaletteTenantService) ExecuteSetup(ctx *interfaces.SetupContext) error
 		return err
 	}
 
-	goodPassword := "L3@rN-" + mySecretPassword
 	fmt.Printf("  Password generated successfully\n")
 
 	// Activate the user with the password
@@ -454,13 +510,16 @@ func (v *PaletteTenantService) ExecuteCleanup(ctx *interfaces.CleanupContext) er
 	// Delete Tenant (only if we found the tenant ID)
 	if tenantID != "" {
 		fmt.Printf("- Deleting tenant: %s\n", tenantID)
-		if err := pc.DeleteTenant(tenantID); err != nil {
+		err := pc.DeleteTenant(tenantID)
+		if err != nil {
 			fmt.Printf("Warning: Failed to delete tenant: %v\n", err)
 		} else {
 			fmt.Printf("  Tenant deleted successfully\n")
 		}
+		ctx.ReportResource("tenant "+tenantID, "delete", err)
 	} else {
 		fmt.Printf("- Skipping tenant deletion (no valid tenant ID found)\n")
+		ctx.SkipResource("tenant", "delete", "no valid tenant ID found")
 	}
 
 	fmt.Printf("Palette Tenant cleanup completed for lab %s\n", ctx.LabID)
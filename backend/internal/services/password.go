@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/sethvargo/go-password/password"
+
+	"github.com/wcrum/labby/internal/interfaces"
+)
+
+// palettePasswordPrefix is prepended to Palette passwords so they always satisfy Palette's complexity rules
+const palettePasswordPrefix = "L3@rN-"
+
+// PasswordPolicy controls how lab user passwords are generated
+type PasswordPolicy struct {
+	Length      int    // Length of the random part, excluding the prefix
+	Digits      int    // Number of digits in the random part
+	Symbols     int    // Number of symbols in the random part
+	SymbolSet   string // Allowed symbols, empty for the generator's default set
+	Prefix      string // Fixed string prepended to every password
+	AllowRepeat bool   // Whether characters may repeat
+}
+
+// DefaultPasswordPolicy returns the policy used when nothing is configured
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		Length:  16,
+		Digits:  4,
+		Symbols: 4,
+	}
+}
+
+// passwordPolicyFromEnv builds a policy from the global PASSWORD_* environment variables.
+// defaultPrefix is used when PASSWORD_PREFIX is not set.
+func passwordPolicyFromEnv(defaultPrefix string) PasswordPolicy {
+	policy := DefaultPasswordPolicy()
+	policy.Prefix = defaultPrefix
+
+	return policy.withOverrides(map[string]string{
+		"password_length":       os.Getenv("PASSWORD_LENGTH"),
+		"password_digits":       os.Getenv("PASSWORD_DIGITS"),
+		"password_symbols":      os.Getenv("PASSWORD_SYMBOLS"),
+		"password_symbol_set":   os.Getenv("PASSWORD_SYMBOL_SET"),
+		"password_prefix":       os.Getenv("PASSWORD_PREFIX"),
+		"password_allow_repeat": os.Getenv("PASSWORD_ALLOW_REPEAT"),
+	})
+}
+
+// passwordPolicyConfigFields describes the password_* keys of services that generate lab passwords
+func passwordPolicyConfigFields() []interfaces.ConfigField {
+	return []interfaces.ConfigField{
+		{Key: "password_length", Description: "Length of the random part of generated passwords", Default: "16", Env: "PASSWORD_LENGTH"},
+		{Key: "password_digits", Description: "Number of digits in generated passwords", Default: "4", Env: "PASSWORD_DIGITS"},
+		{Key: "password_symbols", Description: "Number of symbols in generated passwords", Default: "4", Env: "PASSWORD_SYMBOLS"},
+		{Key: "password_symbol_set", Description: "Symbols generated passwords may use", Env: "PASSWORD_SYMBOL_SET"},
+		{Key: "password_prefix", Description: "Fixed string prepended to generated passwords", Env: "PASSWORD_PREFIX"},
+		{Key: "password_allow_repeat", Description: "Whether characters may repeat in generated passwords (true or false)", Default: "false", Env: "PASSWORD_ALLOW_REPEAT"},
+	}
+}
+
+// withOverrides returns a copy of the policy with any password_* keys from a service config applied.
+// Empty or invalid values leave the existing setting in place.
+func (p PasswordPolicy) withOverrides(config map[string]string) PasswordPolicy {
+	intValue := func(key string, current int) int {
+		value := config[key]
+		if value == "" {
+			return current
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			fmt.Printf("Warning: invalid %s %q, keeping %d\n", key, value, current)
+			return current
+		}
+		return parsed
+	}
+
+	p.Length = intValue("password_length", p.Length)
+	p.Digits = intValue("password_digits", p.Digits)
+	p.Symbols = intValue("password_symbols", p.Symbols)
+	if symbolSet := config["password_symbol_set"]; symbolSet != "" {
+		p.SymbolSet = symbolSet
+	}
+	if prefix, ok := config["password_prefix"]; ok && prefix != "" {
+		p.Prefix = prefix
+	}
+	if allowRepeat := config["password_allow_repeat"]; allowRepeat != "" {
+		p.AllowRepeat = allowRepeat == "true"
+	}
+
+	return p
+}
+
+// generatePassword generates a password that satisfies the given policy
+func generatePassword(policy PasswordPolicy) (string, error) {
+	generator, err := password.NewGenerator(&password.GeneratorInput{
+		Symbols: policy.SymbolSet,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create password generator: %w", err)
+	}
+
+	generated, err := generator.Generate(policy.Length, policy.Digits, policy.Symbols, false, policy.AllowRepeat)
+	if err != nil {
+		return "", err
+	}
+
+	return policy.Prefix + generated, nil
+}
@@ -9,12 +9,12 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/wcrum/labby/internal/interfaces"
-
-	"github.com/sethvargo/go-password/password"
+	"github.com/wcrum/labby/internal/models"
 )
 
 // ProxmoxUserService handles setup and cleanup for Proxmox user accounts
@@ -23,6 +23,18 @@ type ProxmoxUserService struct {
 	adminUser     string
 	adminPass     string
 	skipTLSVerify bool
+	// Optional VM provisioning: clone templateVMID vmCount times into the lab's pool
+	node         string
+	templateVMID int
+	vmCount      int
+	vmRole       string
+	fullClone    bool
+	// Policy for the generated lab user password
+	passwordPolicy PasswordPolicy
+	// Retries for authenticating to the appliance when it is briefly unreachable
+	authRetry AuthRetryPolicy
+	// Replaces the real HTTP client, set with SetHTTPDoer
+	httpDoer HTTPDoer
 }
 
 // NewProxmoxUserService creates a new Proxmox user service instance
@@ -32,6 +44,11 @@ func NewProxmoxUserService() *ProxmoxUserService {
 		adminUser:     os.Getenv("PROXMOX_ADMIN_USER"),
 		adminPass:     os.Getenv("PROXMOX_ADMIN_PASS"),
 		skipTLSVerify: os.Getenv("PROXMOX_SKIP_TLS_VERIFY") == "true",
+		node:          os.Getenv("PROXMOX_NODE"),
+		vmRole:        "PVEVMUser",
+		// Proxmox passwords have never carried a prefix
+		passwordPolicy: passwordPolicyFromEnv(""),
+		authRetry:      authRetryPolicyFromEnv(),
 	}
 }
 
@@ -49,6 +66,36 @@ func (v *ProxmoxUserService) ConfigureFromServiceConfig(config map[string]string
 	if skipTLSVerify, ok := config["skip_tls_verify"]; ok {
 		v.skipTLSVerify = skipTLSVerify == "true"
 	}
+	if node, ok := config["node"]; ok {
+		v.node = node
+	}
+	if templateVMID, ok := config["template_vmid"]; ok {
+		if vmid, err := strconv.Atoi(templateVMID); err == nil {
+			v.templateVMID = vmid
+		} else {
+			fmt.Printf("Warning: invalid template_vmid %q: %v\n", templateVMID, err)
+		}
+	}
+	if vmCount, ok := config["vm_count"]; ok {
+		if count, err := strconv.Atoi(vmCount); err == nil {
+			v.vmCount = count
+		} else {
+			fmt.Printf("Warning: invalid vm_count %q: %v\n", vmCount, err)
+		}
+	}
+	if vmRole, ok := config["vm_role"]; ok && vmRole != "" {
+		v.vmRole = vmRole
+	}
+	if fullClone, ok := config["full_clone"]; ok {
+		v.fullClone = fullClone == "true"
+	}
+	v.passwordPolicy = v.passwordPolicy.withOverrides(config)
+	v.authRetry = v.authRetry.withOverrides(config)
+}
+
+// vmProvisioningEnabled reports whether the service is configured to clone VMs for each lab
+func (v *ProxmoxUserService) vmProvisioningEnabled() bool {
+	return v.templateVMID > 0 && v.vmCount > 0
 }
 
 // GetName returns the service name
@@ -66,6 +113,41 @@ func (v *ProxmoxUserService) GetRequiredParams() []string {
 	return []string{"PROXMOX_URI", "PROXMOX_ADMIN_USER", "PROXMOX_ADMIN_PASS"}
 }
 
+// ConfigSchema describes the keys the service's configs accept (implements ConfigSchemaProvider)
+func (v *ProxmoxUserService) ConfigSchema() []interfaces.ConfigField {
+	fields := []interfaces.ConfigField{
+		{Key: "uri", Description: "Proxmox VE API URL", Required: true, Env: "PROXMOX_URI"},
+		{Key: "admin_user", Description: "Proxmox user that creates lab users and pools", Required: true, Env: "PROXMOX_ADMIN_USER"},
+		{Key: "admin_pass", Description: "Password of admin_user", Required: true, Secret: true, Env: "PROXMOX_ADMIN_PASS"},
+		{Key: "skip_tls_verify", Description: "Skip verifying the Proxmox certificate (true or false)", Default: "false", Env: "PROXMOX_SKIP_TLS_VERIFY"},
+		{Key: "node", Description: "Node lab VMs are cloned on", Env: "PROXMOX_NODE"},
+		{Key: "template_vmid", Description: "VM ID of the template cloned for each lab, no VMs are cloned when unset"},
+		{Key: "vm_count", Description: "Number of VMs cloned for each lab"},
+		{Key: "vm_role", Description: "Role lab users get on their pool", Default: "PVEVMUser"},
+		{Key: "full_clone", Description: "Make full clones instead of linked clones (true or false)", Default: "false"},
+	}
+	fields = append(fields, passwordPolicyConfigFields()...)
+	return append(fields, authRetryConfigFields()...)
+}
+
+// ServiceDataKeys returns the prefixes of the ServiceData keys the service records (implements Service interface)
+func (v *ProxmoxUserService) ServiceDataKeys() []string {
+	return []string{"proxmox_"}
+}
+
+// DescribeResources returns the resource names the service derives from the lab ID (implements Service interface)
+func (v *ProxmoxUserService) DescribeResources(labID string) map[string]string {
+	return map[string]string{
+		"proxmox_user_username": fmt.Sprintf("lab-%s@pve", labID),
+		"proxmox_pool_name":     fmt.Sprintf("lab-%s-pool", labID),
+	}
+}
+
+// SetHTTPDoer replaces the client the service sends Proxmox requests with, such as with a fake in tests
+func (v *ProxmoxUserService) SetHTTPDoer(doer HTTPDoer) {
+	v.httpDoer = doer
+}
+
 // Name returns the service name (implements Setup interface)
 func (v *ProxmoxUserService) Name() string {
 	return v.GetName()
@@ -74,13 +156,14 @@ func (v *ProxmoxUserService) Name() string {
 // ProxmoxClient represents a Proxmox API client
 type ProxmoxClient struct {
 	baseURL    string
-	httpClient *http.Client
+	httpClient HTTPDoer
+	ctx        context.Context // Cancels in-flight requests, e.g. when lab setup times out
 	ticket     string
 	csrfToken  string
 }
 
 // NewProxmoxClient creates a new Proxmox client
-func NewProxmoxClient(baseURL, username, password string, skipTLSVerify bool) (*ProxmoxClient, error) {
+func NewProxmoxClient(ctx context.Context, baseURL, username, password string, skipTLSVerify bool, retry AuthRetryPolicy, doer HTTPDoer) (*ProxmoxClient, error) {
 	// Create HTTP client with TLS configuration
 	httpClient := &http.Client{
 		Timeout: 30 * time.Second,
@@ -93,11 +176,15 @@ func NewProxmoxClient(baseURL, username, password string, skipTLSVerify bool) (*
 
 	client := &ProxmoxClient{
 		baseURL:    baseURL,
-		httpClient: httpClient,
+		httpClient: httpDoerOr(doer, httpClient),
+		ctx:        ctx,
 	}
 
 	// Authenticate and get ticket
-	if err := client.authenticate(username, password); err != nil {
+	err := retryAuthenticate(ctx, retry, baseURL, func() error {
+		return client.authenticate(username, password)
+	})
+	if err != nil {
 		return nil, fmt.Errorf("failed to authenticate: %w", err)
 	}
 
@@ -115,7 +202,13 @@ func (pc *ProxmoxClient) authenticate(username, password string) error {
 	fmt.Printf("Authenticating to Proxmox at: %s\n", loginURL)
 	fmt.Printf("Using admin user: %s\n", username)
 
-	resp, err := pc.httpClient.PostForm(loginURL, data)
+	req, err := http.NewRequestWithContext(pc.ctx, "POST", loginURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create authentication request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := pc.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("authentication request failed: %w", err)
 	}
@@ -131,7 +224,11 @@ func (pc *ProxmoxClient) authenticate(username, password string) error {
 	fmt.Printf("Authentication response body: %s\n", string(body))
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("authentication failed with status: %d, response: %s", resp.StatusCode, string(body))
+		err := fmt.Errorf("authentication failed with status: %d, response: %s", resp.StatusCode, string(body))
+		if isAuthRejectedStatus(resp.StatusCode) {
+			return &authRejectedError{err: err}
+		}
+		return err
 	}
 
 	var result struct {
@@ -162,7 +259,7 @@ func (pc *ProxmoxClient) createUser(username, password string) error {
 	data.Set("password", password)
 	data.Set("comment", "Lab user account")
 
-	req, err := http.NewRequest("POST", createURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(pc.ctx, "POST", createURL, strings.NewReader(data.Encode()))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -197,7 +294,7 @@ func (pc *ProxmoxClient) resetUserPassword(username, newPassword string) error {
 	data := url.Values{}
 	data.Set("password", newPassword)
 
-	req, err := http.NewRequest("PUT", resetURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(pc.ctx, "PUT", resetURL, strings.NewReader(data.Encode()))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -223,7 +320,7 @@ func (pc *ProxmoxClient) resetUserPassword(username, newPassword string) error {
 func (pc *ProxmoxClient) deleteUser(username string) error {
 	deleteURL := fmt.Sprintf("%s/api2/json/access/users/%s", pc.baseURL, username)
 
-	req, err := http.NewRequest("DELETE", deleteURL, nil)
+	req, err := http.NewRequestWithContext(pc.ctx, "DELETE", deleteURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -252,7 +349,7 @@ func (pc *ProxmoxClient) createPool(poolName string) error {
 	data.Set("poolid", poolName)
 	data.Set("comment", "Lab resource pool")
 
-	req, err := http.NewRequest("POST", createURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(pc.ctx, "POST", createURL, strings.NewReader(data.Encode()))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -284,7 +381,7 @@ func (pc *ProxmoxClient) createPool(poolName string) error {
 func (pc *ProxmoxClient) deletePool(poolName string) error {
 	deleteURL := fmt.Sprintf("%s/api2/json/pools/%s", pc.baseURL, poolName)
 
-	req, err := http.NewRequest("DELETE", deleteURL, nil)
+	req, err := http.NewRequestWithContext(pc.ctx, "DELETE", deleteURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -305,6 +402,301 @@ func (pc *ProxmoxClient) deletePool(poolName string) error {
 	return nil
 }
 
+// listPools lists all resource pool IDs
+func (pc *ProxmoxClient) listPools() ([]string, error) {
+	listURL := fmt.Sprintf("%s/api2/json/pools", pc.baseURL)
+
+	req, err := http.NewRequestWithContext(pc.ctx, "GET", listURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Cookie", fmt.Sprintf("PVEAuthCookie=%s", pc.ticket))
+
+	resp, err := pc.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("list pools request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list pools failed with status: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data []struct {
+			PoolID string `json:"poolid"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode pools response: %w", err)
+	}
+
+	pools := make([]string, 0, len(result.Data))
+	for _, pool := range result.Data {
+		pools = append(pools, pool.PoolID)
+	}
+
+	return pools, nil
+}
+
+// proxmoxTaskTimeout bounds how long we wait for asynchronous Proxmox tasks (clone, stop, destroy)
+const proxmoxTaskTimeout = 10 * time.Minute
+
+// ProxmoxVM identifies a virtual machine on a Proxmox node
+type ProxmoxVM struct {
+	VMID int    `json:"vmid"`
+	Node string `json:"node"`
+}
+
+// doForm sends an authenticated form-encoded request and returns the raw "data" field of the response
+func (pc *ProxmoxClient) doForm(method, path string, data url.Values) (json.RawMessage, error) {
+	requestURL := fmt.Sprintf("%s/api2/json%s", pc.baseURL, path)
+
+	var body io.Reader
+	if data != nil {
+		body = strings.NewReader(data.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(pc.ctx, method, requestURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if data != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.Header.Set("Cookie", fmt.Sprintf("PVEAuthCookie=%s", pc.ticket))
+	req.Header.Set("CSRFPreventionToken", pc.csrfToken)
+
+	resp, err := pc.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s request failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s failed with status: %d, response: %s", method, path, resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result.Data, nil
+}
+
+// doTask sends a request that starts an asynchronous task and waits for it to finish
+func (pc *ProxmoxClient) doTask(method, path, node string, data url.Values) error {
+	raw, err := pc.doForm(method, path, data)
+	if err != nil {
+		return err
+	}
+
+	var upid string
+	if err := json.Unmarshal(raw, &upid); err != nil {
+		return fmt.Errorf("failed to decode task ID: %w", err)
+	}
+
+	return pc.waitForTask(node, upid)
+}
+
+// waitForTask polls a Proxmox task until it stops, returning an error if it did not exit cleanly
+func (pc *ProxmoxClient) waitForTask(node, upid string) error {
+	if upid == "" {
+		return nil
+	}
+
+	deadline := time.Now().Add(proxmoxTaskTimeout)
+	for time.Now().Before(deadline) {
+		raw, err := pc.doForm("GET", fmt.Sprintf("/nodes/%s/tasks/%s/status", node, url.PathEscape(upid)), nil)
+		if err != nil {
+			return fmt.Errorf("failed to get task status: %w", err)
+		}
+
+		var status struct {
+			Status     string `json:"status"`
+			ExitStatus string `json:"exitstatus"`
+		}
+		if err := json.Unmarshal(raw, &status); err != nil {
+			return fmt.Errorf("failed to decode task status: %w", err)
+		}
+
+		if status.Status == "stopped" {
+			if status.ExitStatus != "OK" {
+				return fmt.Errorf("task %s failed: %s", upid, status.ExitStatus)
+			}
+			return nil
+		}
+
+		select {
+		case <-pc.ctx.Done():
+			return fmt.Errorf("stopped waiting for task %s: %w", upid, pc.ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	return fmt.Errorf("timed out waiting for task %s", upid)
+}
+
+// nextVMID asks the cluster for the next free VMID
+func (pc *ProxmoxClient) nextVMID() (int, error) {
+	raw, err := pc.doForm("GET", "/cluster/nextid", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	// The API returns the ID as a string
+	var idStr string
+	if err := json.Unmarshal(raw, &idStr); err != nil {
+		return 0, fmt.Errorf("failed to decode next VMID: %w", err)
+	}
+
+	return strconv.Atoi(idStr)
+}
+
+// cloneVM clones a template VM into the given pool and waits for the clone to complete
+func (pc *ProxmoxClient) cloneVM(node string, templateVMID, newVMID int, name, poolName string, fullClone bool) error {
+	data := url.Values{}
+	data.Set("newid", strconv.Itoa(newVMID))
+	data.Set("name", name)
+	data.Set("pool", poolName)
+	if fullClone {
+		data.Set("full", "1")
+	} else {
+		data.Set("full", "0")
+	}
+
+	return pc.doTask("POST", fmt.Sprintf("/nodes/%s/qemu/%d/clone", node, templateVMID), node, data)
+}
+
+// grantPoolAccess assigns a role to a user on a resource pool
+func (pc *ProxmoxClient) grantPoolAccess(poolName, username, role string) error {
+	data := url.Values{}
+	data.Set("path", fmt.Sprintf("/pool/%s", poolName))
+	data.Set("users", username)
+	data.Set("roles", role)
+
+	_, err := pc.doForm("PUT", "/access/acl", data)
+	return err
+}
+
+// stopVM immediately stops a VM and waits for it to power off
+func (pc *ProxmoxClient) stopVM(vm ProxmoxVM) error {
+	return pc.doTask("POST", fmt.Sprintf("/nodes/%s/qemu/%d/status/stop", vm.Node, vm.VMID), vm.Node, url.Values{})
+}
+
+// destroyVM deletes a VM and its disks
+func (pc *ProxmoxClient) destroyVM(vm ProxmoxVM) error {
+	return pc.doTask("DELETE", fmt.Sprintf("/nodes/%s/qemu/%d?purge=1", vm.Node, vm.VMID), vm.Node, nil)
+}
+
+// listPoolVMs lists the QEMU VMs that are members of a resource pool
+func (pc *ProxmoxClient) listPoolVMs(poolName string) ([]ProxmoxVM, error) {
+	raw, err := pc.doForm("GET", fmt.Sprintf("/pools/%s", poolName), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var pool struct {
+		Members []struct {
+			Type string `json:"type"`
+			VMID int    `json:"vmid"`
+			Node string `json:"node"`
+		} `json:"members"`
+	}
+	if err := json.Unmarshal(raw, &pool); err != nil {
+		return nil, fmt.Errorf("failed to decode pool members: %w", err)
+	}
+
+	var vms []ProxmoxVM
+	for _, member := range pool.Members {
+		if member.Type == "qemu" {
+			vms = append(vms, ProxmoxVM{VMID: member.VMID, Node: member.Node})
+		}
+	}
+
+	return vms, nil
+}
+
+// formatProxmoxVMs serializes VMs as "node:vmid" pairs for storage in ServiceData
+func formatProxmoxVMs(vms []ProxmoxVM) string {
+	parts := make([]string, 0, len(vms))
+	for _, vm := range vms {
+		parts = append(parts, fmt.Sprintf("%s:%d", vm.Node, vm.VMID))
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseProxmoxVMs parses VMs stored by formatProxmoxVMs
+func parseProxmoxVMs(value string) []ProxmoxVM {
+	var vms []ProxmoxVM
+	for _, part := range strings.Split(value, ",") {
+		node, vmidStr, found := strings.Cut(strings.TrimSpace(part), ":")
+		if !found {
+			continue
+		}
+		vmid, err := strconv.Atoi(vmidStr)
+		if err != nil {
+			continue
+		}
+		vms = append(vms, ProxmoxVM{VMID: vmid, Node: node})
+	}
+	return vms
+}
+
+// ListLabResources lists resource pools following the lab-{id}-pool naming convention
+func (v *ProxmoxUserService) ListLabResources() ([]interfaces.LabResource, error) {
+	if v.uri == "" || v.adminUser == "" || v.adminPass == "" {
+		return nil, fmt.Errorf("PROXMOX_URI, PROXMOX_ADMIN_USER, and PROXMOX_ADMIN_PASS configuration is required")
+	}
+
+	client, err := NewProxmoxClient(context.Background(), v.uri, v.adminUser, v.adminPass, v.skipTLSVerify, v.authRetry, v.httpDoer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Proxmox client: %w", err)
+	}
+
+	pools, err := client.listPools()
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []interfaces.LabResource
+	for _, pool := range pools {
+		if !strings.HasPrefix(pool, "lab-") || !strings.HasSuffix(pool, "-pool") {
+			continue
+		}
+		resources = append(resources, interfaces.LabResource{
+			Name:  pool,
+			LabID: strings.TrimSuffix(strings.TrimPrefix(pool, "lab-"), "-pool"),
+		})
+	}
+
+	return resources, nil
+}
+
+// TestConnection verifies the URI and admin credentials by requesting an auth ticket
+func (v *ProxmoxUserService) TestConnection() error {
+	if v.uri == "" || v.adminUser == "" || v.adminPass == "" {
+		return fmt.Errorf("uri, admin_user and admin_pass are required")
+	}
+
+	// A single attempt so the test reports the problem instead of waiting it out
+	if _, err := NewProxmoxClient(context.Background(), v.uri, v.adminUser, v.adminPass, v.skipTLSVerify, AuthRetryPolicy{Attempts: 1}, v.httpDoer); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // ExecuteSetup sets up Proxmox user access and adds credentials
 func (v *ProxmoxUserService) ExecuteSetup(ctx *interfaces.SetupContext) error {
 	// Update progress: Connecting to Proxmox
@@ -326,7 +718,7 @@ func (v *ProxmoxUserService) ExecuteSetup(ctx *interfaces.SetupContext) error {
 	fmt.Printf("Setting up Proxmox user for lab %s...\n", ctx.LabName)
 
 	// Create Proxmox client
-	client, err := NewProxmoxClient(v.uri, v.adminUser, v.adminPass, v.skipTLSVerify)
+	client, err := NewProxmoxClient(ctx.Context, v.uri, v.adminUser, v.adminPass, v.skipTLSVerify, v.authRetry, v.httpDoer)
 	if err != nil {
 		if ctx.UpdateProgress != nil {
 			ctx.UpdateProgress("Connecting to Proxmox", "failed", fmt.Sprintf("Failed to connect: %v", err))
@@ -346,7 +738,7 @@ func (v *ProxmoxUserService) ExecuteSetup(ctx *interfaces.SetupContext) error {
 
 	// Generate username and password for lab user
 	labUsername := fmt.Sprintf("lab-%s@pve", shortID)
-	labPassword, err := password.Generate(16, 4, 4, false, false)
+	labPassword, err := generatePassword(v.passwordPolicy)
 	if err != nil {
 		if ctx.UpdateProgress != nil {
 			ctx.UpdateProgress("Creating User Account", "failed", fmt.Sprintf("Failed to generate password: %v", err))
@@ -392,6 +784,63 @@ func (v *ProxmoxUserService) ExecuteSetup(ctx *interfaces.SetupContext) error {
 		ctx.UpdateProgress("Creating Resource Pool", "completed", "Proxmox resource pool created successfully")
 	}
 
+	// Clone virtual machines into the pool when a template is configured
+	var vms []ProxmoxVM
+	if v.vmProvisioningEnabled() {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Cloning Virtual Machines", "running", fmt.Sprintf("Cloning %d virtual machine(s) from template %d...", v.vmCount, v.templateVMID))
+		}
+
+		if v.node == "" {
+			err := fmt.Errorf("node is required when template_vmid is set")
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Cloning Virtual Machines", "failed", err.Error())
+			}
+			return err
+		}
+
+		for i := 1; i <= v.vmCount; i++ {
+			vmid, err := client.nextVMID()
+			if err != nil {
+				if ctx.UpdateProgress != nil {
+					ctx.UpdateProgress("Cloning Virtual Machines", "failed", fmt.Sprintf("Failed to allocate VMID: %v", err))
+				}
+				return fmt.Errorf("failed to allocate VMID: %w", err)
+			}
+
+			vmName := fmt.Sprintf("lab-%s-vm-%d", shortID, i)
+			fmt.Printf("- Cloning template %d to VM %d (%s)\n", v.templateVMID, vmid, vmName)
+			if err := client.cloneVM(v.node, v.templateVMID, vmid, vmName, poolName, v.fullClone); err != nil {
+				if ctx.UpdateProgress != nil {
+					ctx.UpdateProgress("Cloning Virtual Machines", "failed", fmt.Sprintf("Failed to clone VM: %v", err))
+				}
+				return fmt.Errorf("failed to clone VM %d: %w", vmid, err)
+			}
+			vms = append(vms, ProxmoxVM{VMID: vmid, Node: v.node})
+
+			// Record each VM as soon as it exists so a partial failure can still be cleaned up
+			if ctx.Lab != nil {
+				if ctx.Lab.ServiceData == nil {
+					ctx.Lab.ServiceData = make(map[string]string)
+				}
+				ctx.Lab.ServiceData["proxmox_vms"] = formatProxmoxVMs(vms)
+			}
+			fmt.Printf("  VM %d cloned successfully\n", vmid)
+		}
+
+		// Give the lab user access to everything in its pool
+		if err := client.grantPoolAccess(poolName, labUsername, v.vmRole); err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Cloning Virtual Machines", "failed", fmt.Sprintf("Failed to grant VM access: %v", err))
+			}
+			return fmt.Errorf("failed to grant pool access: %w", err)
+		}
+
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Cloning Virtual Machines", "completed", fmt.Sprintf("Cloned %d virtual machine(s)", len(vms)))
+		}
+	}
+
 	// Update progress: Setting Password
 	if ctx.UpdateProgress != nil {
 		ctx.UpdateProgress("Setting Password", "running", "Setting up user password...")
@@ -401,6 +850,9 @@ func (v *ProxmoxUserService) ExecuteSetup(ctx *interfaces.SetupContext) error {
 	ctx.Context = context.WithValue(ctx.Context, "proxmox_user_username", labUsername)
 	ctx.Context = context.WithValue(ctx.Context, "proxmox_user_password", labPassword)
 	ctx.Context = context.WithValue(ctx.Context, "proxmox_pool_name", poolName)
+	if len(vms) > 0 {
+		ctx.Context = context.WithValue(ctx.Context, "proxmox_vms", formatProxmoxVMs(vms))
+	}
 
 	// Store in lab's ServiceData for persistence
 	if ctx.Lab != nil {
@@ -417,6 +869,15 @@ func (v *ProxmoxUserService) ExecuteSetup(ctx *interfaces.SetupContext) error {
 		ctx.Lab.ServiceData["proxmox_skip_tls_verify"] = fmt.Sprintf("%t", v.skipTLSVerify)
 	}
 
+	notes := fmt.Sprintf("Proxmox VE cluster management access. Resource pool: %s", poolName)
+	if len(vms) > 0 {
+		vmIDs := make([]string, 0, len(vms))
+		for _, vm := range vms {
+			vmIDs = append(vmIDs, strconv.Itoa(vm.VMID))
+		}
+		notes += fmt.Sprintf(". Virtual machines: %s", strings.Join(vmIDs, ", "))
+	}
+
 	// Add credential to lab
 	credential := &interfaces.Credential{
 		ID:        fmt.Sprintf("proxmox-%s", shortID),
@@ -426,7 +887,7 @@ func (v *ProxmoxUserService) ExecuteSetup(ctx *interfaces.SetupContext) error {
 		Password:  labPassword,
 		URL:       v.uri,
 		ExpiresAt: time.Now().Add(time.Duration(ctx.Duration) * time.Minute),
-		Notes:     fmt.Sprintf("Proxmox VE cluster management access. Resource pool: %s", poolName),
+		Notes:     notes,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -521,29 +982,102 @@ func (v *ProxmoxUserService) ExecuteCleanup(ctx *interfaces.CleanupContext) erro
 	}
 
 	// Create Proxmox client for cleanup
-	client, err := NewProxmoxClient(uri, adminUser, adminPass, skipTLSVerify)
+	client, err := NewProxmoxClient(ctx.Context, uri, adminUser, adminPass, skipTLSVerify, v.authRetry, v.httpDoer)
 	if err != nil {
 		return fmt.Errorf("failed to create Proxmox client for cleanup: %w", err)
 	}
 
 	fmt.Printf("Cleaning up Proxmox user resources for lab %s:\n", ctx.LabID)
 
+	// Stop and destroy lab VMs first, the pool cannot be deleted while it still has members
+	var vms []ProxmoxVM
+	if storedVMs, ok := ctx.Context.Value("proxmox_vms").(string); ok {
+		vms = parseProxmoxVMs(storedVMs)
+	} else if ctx.Lab != nil && ctx.Lab.ServiceData != nil && ctx.Lab.ServiceData["proxmox_vms"] != "" {
+		vms = parseProxmoxVMs(ctx.Lab.ServiceData["proxmox_vms"])
+	} else {
+		// Lab data is unavailable (e.g. admin or orphan cleanup), fall back to the pool's members
+		poolVMs, err := client.listPoolVMs(poolName)
+		if err != nil {
+			fmt.Printf("Warning: Failed to list VMs in pool %s: %v\n", poolName, err)
+			ctx.ReportResource("VMs in pool "+poolName, "list", err)
+		}
+		vms = poolVMs
+	}
+
+	for _, vm := range vms {
+		vmResource := fmt.Sprintf("VM %d", vm.VMID)
+
+		fmt.Printf("- Stopping VM: %d on node %s\n", vm.VMID, vm.Node)
+		err := client.stopVM(vm)
+		if err != nil {
+			fmt.Printf("Warning: Failed to stop VM %d: %v\n", vm.VMID, err)
+		}
+		ctx.ReportResource(vmResource, "stop", err)
+
+		fmt.Printf("- Destroying VM: %d\n", vm.VMID)
+		err = client.destroyVM(vm)
+		if err != nil {
+			fmt.Printf("Warning: Failed to destroy VM %d: %v\n", vm.VMID, err)
+		} else {
+			fmt.Printf("  VM destroyed successfully\n")
+		}
+		ctx.ReportResource(vmResource, "destroy", err)
+	}
+
 	// Delete user
 	fmt.Printf("- Deleting user: %s\n", username)
-	if err := client.deleteUser(username); err != nil {
+	err = client.deleteUser(username)
+	if err != nil {
 		fmt.Printf("Warning: Failed to delete user: %v\n", err)
 	} else {
 		fmt.Printf("  User deleted successfully\n")
 	}
+	ctx.ReportResource("user "+username, "delete", err)
 
 	// Delete pool
 	fmt.Printf("- Deleting pool: %s\n", poolName)
-	if err := client.deletePool(poolName); err != nil {
+	err = client.deletePool(poolName)
+	if err != nil {
 		fmt.Printf("Warning: Failed to delete pool: %v\n", err)
 	} else {
 		fmt.Printf("  Pool deleted successfully\n")
 	}
+	ctx.ReportResource("pool "+poolName, "delete", err)
 
 	fmt.Printf("Proxmox user cleanup completed for lab %s\n", ctx.LabID)
 	return nil
 }
+
+// RotateCredential sets a new password for the lab's Proxmox user
+func (v *ProxmoxUserService) RotateCredential(ctx context.Context, lab *models.Lab, credential *models.Credential) error {
+	uri, adminUser, adminPass, skipTLSVerify := v.uri, v.adminUser, v.adminPass, v.skipTLSVerify
+	if lab.ServiceData["proxmox_uri"] != "" {
+		uri = lab.ServiceData["proxmox_uri"]
+		adminUser = lab.ServiceData["proxmox_admin_user"]
+		adminPass = lab.ServiceData["proxmox_admin_pass"]
+		skipTLSVerify = lab.ServiceData["proxmox_skip_tls_verify"] == "true"
+	}
+	if uri == "" || adminUser == "" || adminPass == "" {
+		return fmt.Errorf("PROXMOX_URI, PROXMOX_ADMIN_USER, and PROXMOX_ADMIN_PASS configuration not found in lab data or environment")
+	}
+
+	password, err := generatePassword(v.passwordPolicy)
+	if err != nil {
+		return fmt.Errorf("failed to generate password: %w", err)
+	}
+
+	client, err := NewProxmoxClient(ctx, uri, adminUser, adminPass, skipTLSVerify, v.authRetry, v.httpDoer)
+	if err != nil {
+		return fmt.Errorf("failed to create Proxmox client: %w", err)
+	}
+
+	fmt.Printf("Rotating password of Proxmox user %s for lab %s\n", credential.Username, lab.ID)
+	if err := client.resetUserPassword(credential.Username, password); err != nil {
+		return err
+	}
+
+	credential.Password = password
+	lab.ServiceData["proxmox_user_password"] = password
+	return nil
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// readinessProbeTimeout bounds a single readiness attempt
+const readinessProbeTimeout = 10 * time.Second
+
+// ProbeURL checks that a web endpoint answers, sending the request with doer unless it is nil. Any
+// response below 500 counts, since a login page, redirect or 401 shows the server is up; redirects are
+// not followed.
+func ProbeURL(ctx context.Context, target string, skipTLSVerify bool, doer HTTPDoer) error {
+	client := &http.Client{
+		Timeout: readinessProbeTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: skipTLSVerify},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("invalid URL %s: %w", target, err)
+	}
+	resp, err := httpDoerOr(doer, client).Do(req)
+	if err != nil {
+		return fmt.Errorf("%s is not reachable: %w", target, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("%s answered with status %d", target, resp.StatusCode)
+	}
+	return nil
+}
+
+// ProbeAddress checks that a host:port accepts TCP connections
+func ProbeAddress(ctx context.Context, address string) error {
+	dialer := net.Dialer{Timeout: readinessProbeTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("%s is not accepting connections: %w", address, err)
+	}
+	conn.Close()
+	return nil
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+)
+
+// AuthRetryPolicy controls how client authentication is retried when the appliance cannot be reached
+type AuthRetryPolicy struct {
+	Attempts       int           // Total attempts, including the first
+	InitialBackoff time.Duration // Wait before the first retry, doubled for each further retry
+	MaxBackoff     time.Duration // Upper bound for the wait between retries
+}
+
+// DefaultAuthRetryPolicy returns the policy used when nothing is configured
+func DefaultAuthRetryPolicy() AuthRetryPolicy {
+	return AuthRetryPolicy{
+		Attempts:       4,
+		InitialBackoff: 2 * time.Second,
+		MaxBackoff:     30 * time.Second,
+	}
+}
+
+// authRetryPolicyFromEnv builds a policy from the global AUTH_RETRY_* environment variables
+func authRetryPolicyFromEnv() AuthRetryPolicy {
+	return DefaultAuthRetryPolicy().withOverrides(map[string]string{
+		"auth_retry_attempts":    os.Getenv("AUTH_RETRY_ATTEMPTS"),
+		"auth_retry_backoff":     os.Getenv("AUTH_RETRY_BACKOFF"),
+		"auth_retry_max_backoff": os.Getenv("AUTH_RETRY_MAX_BACKOFF"),
+	})
+}
+
+// authRetryConfigFields describes the auth_retry_* keys of services that retry authenticating
+func authRetryConfigFields() []interfaces.ConfigField {
+	return []interfaces.ConfigField{
+		{Key: "auth_retry_attempts", Description: "Attempts to authenticate before setup fails", Default: "4", Env: "AUTH_RETRY_ATTEMPTS"},
+		{Key: "auth_retry_backoff", Description: "Wait before the first retry, doubled after each attempt", Default: "2s", Env: "AUTH_RETRY_BACKOFF"},
+		{Key: "auth_retry_max_backoff", Description: "Longest wait between retries", Default: "30s", Env: "AUTH_RETRY_MAX_BACKOFF"},
+	}
+}
+
+// withOverrides returns a copy of the policy with any auth_retry_* keys from a service config applied.
+// Empty or invalid values leave the existing setting in place.
+func (p AuthRetryPolicy) withOverrides(config map[string]string) AuthRetryPolicy {
+	durationValue := func(key string, current time.Duration) time.Duration {
+		value := config[key]
+		if value == "" {
+			return current
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			fmt.Printf("Warning: invalid %s %q, keeping %v\n", key, value, current)
+			return current
+		}
+		return parsed
+	}
+
+	if value := config["auth_retry_attempts"]; value != "" {
+		if attempts, err := strconv.Atoi(value); err == nil && attempts > 0 {
+			p.Attempts = attempts
+		} else {
+			fmt.Printf("Warning: invalid auth_retry_attempts %q, keeping %d\n", value, p.Attempts)
+		}
+	}
+	p.InitialBackoff = durationValue("auth_retry_backoff", p.InitialBackoff)
+	p.MaxBackoff = durationValue("auth_retry_max_backoff", p.MaxBackoff)
+
+	return p
+}
+
+// authRejectedError marks an authentication failure caused by the credentials or request
+// rather than the connection, which retrying cannot fix
+type authRejectedError struct {
+	err error
+}
+
+func (e *authRejectedError) Error() string { return e.err.Error() }
+func (e *authRejectedError) Unwrap() error { return e.err }
+
+// isAuthRejectedStatus reports whether an authentication response status means the login itself
+// was refused. Timeouts, rate limiting and server errors are treated as transient.
+func isAuthRejectedStatus(statusCode int) bool {
+	if statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests {
+		return false
+	}
+	return statusCode >= 400 && statusCode < 500
+}
+
+// permanentError marks a failure caused by the request itself rather than the connection,
+// which retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// isTransientStatus reports whether a response status is worth retrying: timeouts, rate limiting
+// and server errors
+func isTransientStatus(statusCode int) bool {
+	return statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// retryAuthenticate calls authenticate until it succeeds, fails with an authRejectedError, runs out
+// of attempts or ctx is cancelled, backing off exponentially between attempts
+func retryAuthenticate(ctx context.Context, policy AuthRetryPolicy, target string, authenticate func() error) error {
+	return retryWithBackoff(ctx, policy, "authentication to "+target, authenticate)
+}
+
+// retryWithBackoff calls operation until it succeeds, fails with an authRejectedError or permanentError,
+// runs out of attempts or ctx is cancelled, backing off exponentially between attempts
+func retryWithBackoff(ctx context.Context, policy AuthRetryPolicy, description string, operation func() error) error {
+	attempts := policy.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := policy.InitialBackoff
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = operation()
+		if err == nil {
+			return nil
+		}
+
+		var rejected *authRejectedError
+		var permanent *permanentError
+		if errors.As(err, &rejected) || errors.As(err, &permanent) {
+			return err
+		}
+		if attempt == attempts {
+			break
+		}
+
+		fmt.Printf("Attempt %d/%d of %s failed, retrying in %v: %v\n", attempt, attempts, description, backoff, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped retrying %s: %w", description, ctx.Err())
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// envSecretPrefix marks a service config value read from an environment variable, e.g. env:PALETTE_API_KEY
+	envSecretPrefix = "env:"
+	// vaultSecretPrefix marks a service config value read from Vault, e.g. vault:secret/palette#api_key
+	vaultSecretPrefix = "vault:"
+)
+
+// ResolveConfig returns a copy of a service config with env: and vault: references replaced by the
+// secrets they point to, so credentials don't have to be stored inline. Vault is reached with the
+// VAULT_ADDR, VAULT_TOKEN (or VAULT_ROLE_ID and VAULT_SECRET_ID) and VAULT_NAMESPACE environment.
+// Errors name the config key and reference, never the secret value.
+func ResolveConfig(config map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(config))
+	var vaultClient *VaultClient
+	vaultSecrets := make(map[string]map[string]interface{})
+
+	for key, value := range config {
+		switch {
+		case strings.HasPrefix(value, envSecretPrefix):
+			name := strings.TrimPrefix(value, envSecretPrefix)
+			secret, ok := os.LookupEnv(name)
+			if name == "" || !ok {
+				return nil, fmt.Errorf("config %s: environment variable %q is not set", key, name)
+			}
+			resolved[key] = secret
+
+		case strings.HasPrefix(value, vaultSecretPrefix):
+			path, field, found := strings.Cut(strings.TrimPrefix(value, vaultSecretPrefix), "#")
+			if !found || path == "" || field == "" {
+				return nil, fmt.Errorf("config %s: invalid Vault reference %q, expected vault:<path>#<key>", key, value)
+			}
+
+			data, cached := vaultSecrets[path]
+			if !cached {
+				if vaultClient == nil {
+					client, err := newSecretVaultClient()
+					if err != nil {
+						return nil, fmt.Errorf("config %s: %w", key, err)
+					}
+					vaultClient = client
+				}
+				secret, err := vaultClient.readSecretData(path)
+				if err != nil {
+					return nil, fmt.Errorf("config %s: failed to read Vault secret %s: %w", key, path, err)
+				}
+				data = secret
+				vaultSecrets[path] = data
+			}
+
+			secret, ok := data[field].(string)
+			if !ok {
+				return nil, fmt.Errorf("config %s: Vault secret %s has no string key %q", key, path, field)
+			}
+			resolved[key] = secret
+
+		default:
+			resolved[key] = value
+		}
+	}
+	return resolved, nil
+}
+
+// newSecretVaultClient connects to the Vault configured in the environment for resolving config references
+func newSecretVaultClient() (*VaultClient, error) {
+	settings := NewVaultService()
+	if settings.address == "" {
+		return nil, fmt.Errorf("VAULT_ADDR is required to resolve Vault references")
+	}
+	client, err := NewVaultClient(context.Background(), settings.address, settings.namespace, settings.token,
+		settings.approleMount, settings.roleID, settings.secretID, settings.skipTLSVerify, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Vault: %w", err)
+	}
+	return client, nil
+}
+
+// readSecretData reads the key/value pairs of a secret. Paths of KV version 2 mounts may be given without
+// their data/ segment, e.g. secret/palette for secret/data/palette.
+func (vc *VaultClient) readSecretData(path string) (map[string]interface{}, error) {
+	result, err := vc.readSecret(path)
+	if err != nil {
+		mount, rest, found := strings.Cut(strings.Trim(path, "/"), "/")
+		if !found || strings.HasPrefix(rest, "data/") || !strings.Contains(err.Error(), "status: 404") {
+			return nil, err
+		}
+		if result, err = vc.readSecret(mount + "/data/" + rest); err != nil {
+			return nil, err
+		}
+	}
+
+	// KV version 2 nests the secret under data.data next to its metadata
+	if nested, ok := result.Data["data"].(map[string]interface{}); ok {
+		if _, versioned := result.Data["metadata"]; versioned {
+			return nested, nil
+		}
+	}
+	return result.Data, nil
+}
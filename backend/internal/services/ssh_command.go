@@ -0,0 +1,497 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// sshDialTimeout bounds a single connection attempt; connectTimeout bounds all of them
+	sshDialTimeout = 30 * time.Second
+	// sshConnectRetryInterval is how long to wait between connection attempts while the host boots
+	sshConnectRetryInterval = 5 * time.Second
+	// sshMaxOutputLine caps the length of a single line of command output sent to the progress log
+	sshMaxOutputLine = 1024
+)
+
+// SSHCommandService runs an ordered list of setup commands on a lab host over SSH
+type SSHCommandService struct {
+	host                 string
+	hostFrom             string // ServiceData key holding the host, e.g. set by an earlier service
+	port                 string
+	username             string
+	password             string
+	privateKey           string
+	privateKeyPassphrase string
+	hostKey              string // Expected host key in authorized_keys format; unverified when empty
+	commands             []string
+	commandTimeout       time.Duration
+	connectTimeout       time.Duration
+	continueOnError      bool
+}
+
+// sshCommand is a single command to run and whether its failure should fail the lab
+type sshCommand struct {
+	command     string
+	ignoreError bool
+}
+
+// NewSSHCommandService creates a new SSH command service instance
+func NewSSHCommandService() *SSHCommandService {
+	return &SSHCommandService{
+		port:           "22",
+		username:       os.Getenv("SSH_COMMAND_USERNAME"),
+		password:       os.Getenv("SSH_COMMAND_PASSWORD"),
+		privateKey:     os.Getenv("SSH_COMMAND_PRIVATE_KEY"),
+		commandTimeout: 10 * time.Minute,
+		connectTimeout: 5 * time.Minute,
+	}
+}
+
+// ConfigureFromServiceConfig configures the service from a service configuration
+func (v *SSHCommandService) ConfigureFromServiceConfig(config map[string]string) {
+	if host, ok := config["host"]; ok {
+		v.host = host
+	}
+	if hostFrom, ok := config["host_from"]; ok {
+		v.hostFrom = hostFrom
+	}
+	if port, ok := config["port"]; ok && port != "" {
+		v.port = port
+	}
+	if username, ok := config["username"]; ok {
+		v.username = username
+	}
+	if password, ok := config["password"]; ok {
+		v.password = password
+	}
+	if privateKey, ok := config["private_key"]; ok {
+		v.privateKey = privateKey
+	}
+	if passphrase, ok := config["private_key_passphrase"]; ok {
+		v.privateKeyPassphrase = passphrase
+	}
+	if hostKey, ok := config["host_key"]; ok {
+		v.hostKey = hostKey
+	}
+	if commands, ok := config["commands"]; ok {
+		v.commands = parseSSHCommands(commands)
+	}
+	if commandTimeout, ok := config["command_timeout"]; ok && commandTimeout != "" {
+		if timeout, err := time.ParseDuration(commandTimeout); err == nil && timeout > 0 {
+			v.commandTimeout = timeout
+		} else {
+			fmt.Printf("Warning: invalid command_timeout %q, using %v\n", commandTimeout, v.commandTimeout)
+		}
+	}
+	if connectTimeout, ok := config["connect_timeout"]; ok && connectTimeout != "" {
+		if timeout, err := time.ParseDuration(connectTimeout); err == nil && timeout > 0 {
+			v.connectTimeout = timeout
+		} else {
+			fmt.Printf("Warning: invalid connect_timeout %q, using %v\n", connectTimeout, v.connectTimeout)
+		}
+	}
+	if continueOnError, ok := config["continue_on_error"]; ok {
+		v.continueOnError = continueOnError == "true"
+	}
+}
+
+// parseSSHCommands splits a newline-separated command list, skipping blank lines and # comments
+func parseSSHCommands(value string) []string {
+	commands := make([]string, 0)
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		commands = append(commands, line)
+	}
+	return commands
+}
+
+// GetName returns the service name
+func (v *SSHCommandService) GetName() string {
+	return "ssh_command"
+}
+
+// GetDescription returns the service description
+func (v *SSHCommandService) GetDescription() string {
+	return "Run setup commands on a lab host over SSH"
+}
+
+// GetRequiredParams returns the required parameters for this service
+func (v *SSHCommandService) GetRequiredParams() []string {
+	return []string{"SSH_COMMAND_USERNAME"}
+}
+
+// ConfigSchema describes the keys the service's configs accept (implements ConfigSchemaProvider)
+func (v *SSHCommandService) ConfigSchema() []interfaces.ConfigField {
+	return []interfaces.ConfigField{
+		{Key: "host", Description: "Host commands run on, required unless host_from is set"},
+		{Key: "host_from", Description: "ServiceData key holding the host, e.g. recorded by an earlier service"},
+		{Key: "port", Description: "SSH port", Default: "22"},
+		{Key: "username", Description: "SSH user", Required: true, Env: "SSH_COMMAND_USERNAME"},
+		{Key: "password", Description: "SSH password", Secret: true, Env: "SSH_COMMAND_PASSWORD"},
+		{Key: "private_key", Description: "PEM encoded SSH private key", Secret: true, Env: "SSH_COMMAND_PRIVATE_KEY"},
+		{Key: "private_key_passphrase", Description: "Passphrase of private_key", Secret: true},
+		{Key: "host_key", Description: "Expected host key in authorized_keys format, the host key is not verified when unset"},
+		{Key: "commands", Description: "Newline-separated commands run in order, blank lines and # comments are skipped", Required: true},
+		{Key: "command_timeout", Description: "Timeout of each command", Default: "10m"},
+		{Key: "connect_timeout", Description: "How long to keep trying to connect while the host boots", Default: "5m"},
+		{Key: "continue_on_error", Description: "Run the remaining commands after one fails (true or false)", Default: "false"},
+	}
+}
+
+// ServiceDataKeys returns the prefixes of the ServiceData keys the service records (implements Service interface)
+func (v *SSHCommandService) ServiceDataKeys() []string {
+	return []string{"ssh_command_"}
+}
+
+// DescribeResources returns the resource names the service derives from the lab ID (implements Service interface)
+func (v *SSHCommandService) DescribeResources(labID string) map[string]string {
+	// Commands run on an existing host and create no named resources
+	return map[string]string{}
+}
+
+// Name returns the service name (implements Setup interface)
+func (v *SSHCommandService) Name() string {
+	return v.GetName()
+}
+
+// plannedCommands returns the configured commands with their failure behavior. A leading "-" marks
+// a command whose failure is logged but does not fail the lab, as in a Makefile.
+func (v *SSHCommandService) plannedCommands() []sshCommand {
+	planned := make([]sshCommand, 0, len(v.commands))
+	for _, command := range v.commands {
+		ignoreError := v.continueOnError
+		if strings.HasPrefix(command, "-") {
+			command = strings.TrimSpace(strings.TrimPrefix(command, "-"))
+			ignoreError = true
+		}
+		planned = append(planned, sshCommand{command: command, ignoreError: ignoreError})
+	}
+	return planned
+}
+
+// resolveHost returns the host to connect to, preferring the ServiceData key named by host_from
+func (v *SSHCommandService) resolveHost(ctx *interfaces.SetupContext) (string, error) {
+	if v.hostFrom != "" {
+		if ctx.Lab != nil && ctx.Lab.ServiceData != nil {
+			if host := ctx.Lab.ServiceData[v.hostFrom]; host != "" {
+				return host, nil
+			}
+		}
+		if v.host == "" {
+			return "", fmt.Errorf("lab has no value for %s; make sure the service that sets it runs first", v.hostFrom)
+		}
+	}
+	if v.host == "" {
+		return "", fmt.Errorf("host or host_from is required")
+	}
+	return v.host, nil
+}
+
+// clientConfig builds the SSH client configuration from the configured credentials
+func (v *SSHCommandService) clientConfig() (*ssh.ClientConfig, error) {
+	if v.username == "" {
+		return nil, fmt.Errorf("username is required")
+	}
+
+	auth := make([]ssh.AuthMethod, 0, 2)
+	if v.privateKey != "" {
+		var signer ssh.Signer
+		var err error
+		if v.privateKeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(v.privateKey), []byte(v.privateKeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(v.privateKey))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if v.password != "" {
+		auth = append(auth, ssh.Password(v.password))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("a private_key or password is required")
+	}
+
+	// Lab hosts are usually created moments before setup runs, so their host key cannot be known in advance
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if v.hostKey != "" {
+		publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(v.hostKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse host_key: %w", err)
+		}
+		hostKeyCallback = ssh.FixedHostKey(publicKey)
+	}
+
+	return &ssh.ClientConfig{
+		User:            v.username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshDialTimeout,
+	}, nil
+}
+
+// dial opens a single SSH connection, aborting if ctx is cancelled
+func (v *SSHCommandService) dial(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	dialer := &net.Dialer{Timeout: sshDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// connect dials the host until it accepts the connection or the connect timeout elapses,
+// since freshly provisioned hosts often take a while to start sshd
+func (v *SSHCommandService) connect(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	deadline := time.Now().Add(v.connectTimeout)
+	attempt := 0
+	for {
+		attempt++
+		client, err := v.dial(ctx, address, config)
+		if err == nil {
+			return client, nil
+		}
+		if time.Now().Add(sshConnectRetryInterval).After(deadline) {
+			return nil, fmt.Errorf("failed to connect to %s after %d attempts: %w", address, attempt, err)
+		}
+
+		fmt.Printf("SSH connection to %s failed (attempt %d), retrying: %v\n", address, attempt, err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped connecting to %s: %w", address, ctx.Err())
+		case <-time.After(sshConnectRetryInterval):
+		}
+	}
+}
+
+// runCommand runs a single command in its own session, sending each line of output to logLine.
+// It returns an *ssh.ExitError when the command exits non-zero.
+func (v *SSHCommandService) runCommand(ctx context.Context, client *ssh.Client, command string, logLine func(string)) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to open session: %w", err)
+	}
+	defer session.Close()
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to attach stdout: %w", err)
+	}
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to attach stderr: %w", err)
+	}
+
+	if err := session.Start(command); err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+
+	var output sync.WaitGroup
+	for _, stream := range []io.Reader{stdout, stderr} {
+		output.Add(1)
+		go func(stream io.Reader) {
+			defer output.Done()
+			streamSSHOutput(stream, logLine)
+		}(stream)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		output.Wait()
+		done <- session.Wait()
+	}()
+
+	timer := time.NewTimer(v.commandTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		session.Signal(ssh.SIGKILL)
+		return fmt.Errorf("command timed out after %v", v.commandTimeout)
+	case <-ctx.Done():
+		session.Signal(ssh.SIGKILL)
+		return fmt.Errorf("command cancelled: %w", ctx.Err())
+	}
+}
+
+// streamSSHOutput sends each line read from stream to logLine, truncating very long lines
+func streamSSHOutput(stream io.Reader, logLine func(string)) {
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) > sshMaxOutputLine {
+			line = line[:sshMaxOutputLine] + "..."
+		}
+		logLine(line)
+	}
+	// Drain anything left (e.g. after an oversized line) so the remote side never blocks on a full pipe
+	io.Copy(io.Discard, stream)
+}
+
+// TestConnection verifies the host accepts the configured credentials without running any commands
+func (v *SSHCommandService) TestConnection() error {
+	if v.host == "" {
+		return fmt.Errorf("host is required to test the connection (host_from is only resolved during lab setup)")
+	}
+
+	config, err := v.clientConfig()
+	if err != nil {
+		return err
+	}
+
+	client, err := v.dial(context.Background(), net.JoinHostPort(v.host, v.port), config)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	return client.Close()
+}
+
+// ExecuteSetup connects to the lab host and runs the configured commands in order
+func (v *SSHCommandService) ExecuteSetup(ctx *interfaces.SetupContext) error {
+	// Update progress: Connecting to Host
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Connecting to Host", "running", "Resolving lab host...")
+	}
+
+	host, err := v.resolveHost(ctx)
+	if err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Connecting to Host", "failed", err.Error())
+		}
+		return err
+	}
+
+	commands := v.plannedCommands()
+	if len(commands) == 0 {
+		err := fmt.Errorf("no commands configured")
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Connecting to Host", "failed", err.Error())
+		}
+		return err
+	}
+
+	config, err := v.clientConfig()
+	if err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Connecting to Host", "failed", err.Error())
+		}
+		return err
+	}
+
+	address := net.JoinHostPort(host, v.port)
+	fmt.Printf("Running %d SSH commands on %s for lab %s...\n", len(commands), address, ctx.LabName)
+
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Connecting to Host", "running", fmt.Sprintf("Connecting to %s as %s...", address, v.username))
+	}
+
+	client, err := v.connect(ctx.Context, address, config)
+	if err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Connecting to Host", "failed", err.Error())
+		}
+		return err
+	}
+	defer client.Close()
+
+	// Update progress: Connecting to Host completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Connecting to Host", "completed", fmt.Sprintf("Connected to %s", address))
+	}
+
+	// Store the resolved host for visibility in the lab inventory
+	if ctx.Lab != nil {
+		if ctx.Lab.ServiceData == nil {
+			ctx.Lab.ServiceData = make(map[string]string)
+		}
+		ctx.Lab.ServiceData["ssh_command_host"] = host
+	}
+
+	logLine := func(line string) {
+		fmt.Printf("  [%s] %s\n", host, line)
+		if ctx.AddLog != nil {
+			ctx.AddLog(fmt.Sprintf("[%s] %s", host, line))
+		}
+	}
+
+	ignoredFailures := 0
+	for i, command := range commands {
+		// Update progress: Running Commands
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Running Commands", "running", fmt.Sprintf("Running command %d of %d: %s", i+1, len(commands), command.command))
+		}
+		logLine(fmt.Sprintf("$ %s", command.command))
+
+		err := v.runCommand(ctx.Context, client, command.command, logLine)
+		if err == nil {
+			continue
+		}
+
+		if exitErr, ok := err.(*ssh.ExitError); ok {
+			err = fmt.Errorf("command %d exited with status %d: %s", i+1, exitErr.ExitStatus(), command.command)
+		} else {
+			err = fmt.Errorf("command %d failed: %s: %w", i+1, command.command, err)
+		}
+
+		if command.ignoreError {
+			ignoredFailures++
+			logLine(fmt.Sprintf("Ignoring failure: %v", err))
+			continue
+		}
+
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Running Commands", "failed", err.Error())
+		}
+		return err
+	}
+
+	if ctx.Lab != nil {
+		ctx.Lab.ServiceData["ssh_command_commands_run"] = strconv.Itoa(len(commands))
+	}
+
+	message := fmt.Sprintf("Ran %d commands on %s", len(commands), host)
+	if ignoredFailures > 0 {
+		message = fmt.Sprintf("%s (%d failures ignored)", message, ignoredFailures)
+	}
+
+	// Update progress: Running Commands completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Running Commands", "completed", message)
+	}
+
+	fmt.Printf("SSH command setup completed for lab %s\n", ctx.LabName)
+	return nil
+}
+
+// ExecuteCleanup is a no-op: commands run on hosts owned by other services, which remove the hosts themselves
+func (v *SSHCommandService) ExecuteCleanup(ctx *interfaces.CleanupContext) error {
+	fmt.Printf("No SSH command cleanup needed for lab %s\n", ctx.LabID)
+	return nil
+}
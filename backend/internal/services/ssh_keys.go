@@ -0,0 +1,35 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// GenerateSSHKeyPair creates an Ed25519 keypair for logging in to lab machines. The public key is
+// returned in authorized_keys format and the private key as an OpenSSH PEM block.
+func GenerateSSHKeyPair(comment string) (publicKey, privateKey string, err error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate SSH key: %w", err)
+	}
+
+	sshPublicKey, err := ssh.NewPublicKey(public)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode SSH public key: %w", err)
+	}
+	block, err := ssh.MarshalPrivateKey(private, comment)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode SSH private key: %w", err)
+	}
+
+	publicKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublicKey)))
+	if comment != "" {
+		publicKey += " " + comment
+	}
+	return publicKey, string(pem.EncodeToMemory(block)), nil
+}
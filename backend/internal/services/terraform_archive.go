@@ -0,0 +1,213 @@
+package services
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// archiveFormatTarGz is the only archive format Terraform Cloud accepts for configuration versions
+const archiveFormatTarGz = "tar.gz"
+
+// defaultArchiveIgnore lists the files left out of configuration uploads when a config sets no archive_ignore
+var defaultArchiveIgnore = []string{".git", ".terraform", "*.tfstate", "*.tfstate.*", "crash.log", "*.zip", "*.tar.gz"}
+
+// terraformArchive describes how a configuration is packed for upload
+type terraformArchive struct {
+	format string
+	ignore []string
+}
+
+// ValidateTerraformArchive checks a Terraform Cloud service config's archive_format and archive_ignore
+func ValidateTerraformArchive(config map[string]string) error {
+	_, err := parseTerraformArchive(config)
+	return err
+}
+
+// parseTerraformArchive reads the archive settings of a config. archive_ignore is a comma-separated list
+// of glob patterns matched against each file's path and every element of it, and replaces the defaults.
+// State files and .terraform directories are never uploaded, whatever the ignore list says.
+func parseTerraformArchive(config map[string]string) (terraformArchive, error) {
+	archive := terraformArchive{format: archiveFormatTarGz, ignore: defaultArchiveIgnore}
+
+	if format := strings.ToLower(strings.TrimSpace(config["archive_format"])); format != "" {
+		if format == "tgz" {
+			format = archiveFormatTarGz
+		}
+		if format != archiveFormatTarGz {
+			return archive, fmt.Errorf("unsupported archive_format %q, Terraform Cloud only accepts tar.gz", format)
+		}
+		archive.format = format
+	}
+
+	if value, ok := config["archive_ignore"]; ok {
+		archive.ignore = nil
+		for _, pattern := range strings.Split(value, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern == "" {
+				continue
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return archive, fmt.Errorf("invalid archive_ignore pattern %q: %v", pattern, err)
+			}
+			archive.ignore = append(archive.ignore, pattern)
+		}
+	}
+
+	return archive, nil
+}
+
+// ignores reports whether a file, given by its slash-separated path in the configuration, is left out
+func (a terraformArchive) ignores(relPath string) bool {
+	elements := strings.Split(relPath, "/")
+	for _, pattern := range a.ignore {
+		if matched, _ := path.Match(pattern, relPath); matched {
+			return true
+		}
+		for _, element := range elements {
+			if matched, _ := path.Match(pattern, element); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// forbiddenArchivePath reports whether a file must never be uploaded: Terraform state, which holds the
+// resources and secrets of whoever ran Terraform locally, and the .terraform working directory
+func forbiddenArchivePath(relPath string) bool {
+	elements := strings.Split(relPath, "/")
+	for _, element := range elements[:len(elements)-1] {
+		if element == ".terraform" {
+			return true
+		}
+	}
+	name := elements[len(elements)-1]
+	return name == ".terraform" || strings.HasSuffix(name, ".tfstate") || strings.Contains(name, ".tfstate.")
+}
+
+// createTarGzFile packs the files in sourceDir into a tar.gz archive, leaving out ignored files.
+// It fails when a file that must never be uploaded, such as Terraform state, isn't ignored.
+func (a terraformArchive) createTarGzFile(sourceDir, tarGzPath string) error {
+	tarGzFile, err := os.Create(tarGzPath)
+	if err != nil {
+		return fmt.Errorf("failed to create tar.gz file: %v", err)
+	}
+	defer tarGzFile.Close()
+
+	gzipWriter := gzip.NewWriter(tarGzFile)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	// Walk through the source directory
+	err = filepath.Walk(sourceDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Create a relative path for the tar file
+		relPath, err := filepath.Rel(sourceDir, filePath)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %v", err)
+		}
+		if relPath == "." {
+			return nil
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		if a.ignores(relPath) {
+			fmt.Printf("Skipped ignored file: %s\n", relPath)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if forbiddenArchivePath(relPath) {
+			return fmt.Errorf("refusing to upload %s: Terraform state and .terraform files must not be uploaded", relPath)
+		}
+
+		// Read file content
+		fileContent, err := os.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read file %s: %v", filePath, err)
+		}
+
+		// Create tar header
+		header := &tar.Header{
+			Name: relPath,
+			Mode: int64(info.Mode().Perm()),
+			Size: int64(len(fileContent)),
+		}
+
+		// Write tar header
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write tar header for %s: %v", relPath, err)
+		}
+
+		// Write file content
+		if _, err := tarWriter.Write(fileContent); err != nil {
+			return fmt.Errorf("failed to write to tar entry: %v", err)
+		}
+
+		fmt.Printf("Added to tar.gz: %s (%d bytes)\n", relPath, len(fileContent))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to walk directory: %v", err)
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close tar writer: %v", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close gzip writer: %v", err)
+	}
+	return nil
+}
+
+// validateTarGzFile reads an archive back before it is uploaded, checking that it holds at least one
+// file and nothing that must never be uploaded
+func validateTarGzFile(tarGzPath string) error {
+	file, err := os.Open(tarGzPath)
+	if err != nil {
+		return fmt.Errorf("failed to open tar.gz file for validation: %v", err)
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to read tar.gz file: %v", err)
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	fileCount := 0
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar.gz entry: %v", err)
+		}
+		if forbiddenArchivePath(header.Name) {
+			return fmt.Errorf("archive contains %s, Terraform state and .terraform files must not be uploaded", header.Name)
+		}
+		if header.Typeflag == tar.TypeReg {
+			fileCount++
+		}
+	}
+
+	if fileCount == 0 {
+		return fmt.Errorf("tar.gz file contains no files")
+	}
+
+	fmt.Printf("Tar.gz file validation passed: %d files found\n", fileCount)
+	return nil
+}
@@ -1,22 +1,24 @@
 package services
 
 import (
-	"archive/tar"
-	"archive/zip"
 	"bytes"
-	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/wcrum/labby/internal/interfaces"
+	"github.com/wcrum/labby/internal/models"
 )
 
 // TerraformCloudService handles setup and cleanup for Terraform Cloud workspaces
@@ -32,13 +34,47 @@ type TerraformCloudService struct {
 	executionMode   string
 	variables       map[string]string
 	sensitiveVars   map[string]string
+	// Names of the lab's template variables forwarded to the workspace
+	templateVariables []string
+	// Terraform variable that receives the public half of a generated SSH keypair, if any
+	sshKeyVariable string
+	// Workspaces a lab gets in the order they are set up, and why the config's workspaces are invalid
+	workspaces    []terraformWorkspace
+	workspacesErr error
+	// Set when configured to re-render a lab's configuration, so no values are generated
+	renderOnly bool
+	// Retry policy for API calls that are safe to repeat, such as setting workspace variables
+	retry AuthRetryPolicy
+	// How configurations are packed for upload, and why the config's archive settings are invalid
+	archive    terraformArchive
+	archiveErr error
+	// Repository the configuration is cloned from instead of a local source directory, and why the
+	// config's git settings are invalid
+	git    *terraformGitSource
+	gitErr error
+	// Timeout of a single configuration upload attempt, and how failed uploads are retried
+	uploadTimeout time.Duration
+	uploadRetry   AuthRetryPolicy
+	// Why a VLAN tag couldn't be allocated, such as the range being exhausted
+	vlanErr error
+	// Set by ExecuteSetup so its requests are cancelled when lab setup times out
+	ctx context.Context
+	// Sends API requests instead of a real client with a per-call timeout, set with SetHTTPDoer
+	httpDoer HTTPDoer
 }
 
-// Global VLAN tag tracking (in a real production environment, this should be in a database)
-var (
-	vlanTagMutex sync.Mutex
-	usedVlanTags = make(map[int]bool)
-)
+// defaultUploadTimeout bounds a single configuration upload attempt when nothing is configured
+const defaultUploadTimeout = 120 * time.Second
+
+// maxLoggedVariableLength is the longest regular variable value written to the log as it is
+const maxLoggedVariableLength = 16
+
+// sensitiveVariableKeyParts mark regular variables whose values are redacted in the log even though
+// they aren't set as sensitive, such as vm_user or pm_api_url
+var sensitiveVariableKeyParts = []string{"password", "pass", "secret", "token", "key", "cred", "user", "email", "address", "octet", "host", "url", "cidr"}
+
+// ipAddressPattern matches values that contain an IPv4 address or part of one, such as a 10.10 prefix
+var ipAddressPattern = regexp.MustCompile(`\d{1,3}\.\d{1,3}`)
 
 // NewTerraformCloudService creates a new Terraform Cloud service instance
 func NewTerraformCloudService() *TerraformCloudService {
@@ -48,42 +84,50 @@ func NewTerraformCloudService() *TerraformCloudService {
 		organization:  "",
 		variables:     make(map[string]string),
 		sensitiveVars: make(map[string]string),
+		retry:         authRetryPolicyFromEnv(),
+		archive:       terraformArchive{format: archiveFormatTarGz, ignore: defaultArchiveIgnore},
+		uploadTimeout: uploadTimeoutValue("TF_CLOUD_UPLOAD_TIMEOUT", os.Getenv("TF_CLOUD_UPLOAD_TIMEOUT"), defaultUploadTimeout),
+		uploadRetry: uploadRetryPolicyWithOverrides(authRetryPolicyFromEnv(), map[string]string{
+			"upload_retry_attempts":    os.Getenv("TF_CLOUD_UPLOAD_RETRY_ATTEMPTS"),
+			"upload_retry_backoff":     os.Getenv("TF_CLOUD_UPLOAD_RETRY_BACKOFF"),
+			"upload_retry_max_backoff": os.Getenv("TF_CLOUD_UPLOAD_RETRY_MAX_BACKOFF"),
+		}),
 	}
 }
 
-// generateUniqueVlanTag generates a unique VLAN tag in the specified range
-func (v *TerraformCloudService) generateUniqueVlanTag(min, max int) string {
-	vlanTagMutex.Lock()
-	defer vlanTagMutex.Unlock()
-
-	// Log current usage
-	usedCount := len(usedVlanTags)
-	fmt.Printf("Current VLAN tag usage: %d tags in use\n", usedCount)
+// SetHTTPDoer replaces the client the service sends Terraform Cloud API requests with, such as with a fake in tests
+func (v *TerraformCloudService) SetHTTPDoer(doer HTTPDoer) {
+	v.httpDoer = doer
+}
 
-	// Try to find an available VLAN tag
-	for vlanTag := min; vlanTag <= max; vlanTag++ {
-		if !usedVlanTags[vlanTag] {
-			usedVlanTags[vlanTag] = true
-			fmt.Printf("Generated unique VLAN tag: %d (range: %d-%d, total used: %d)\n", vlanTag, min, max, usedCount+1)
-			return fmt.Sprintf("%d", vlanTag)
-		}
+// httpClient returns the client for an API request, a real one with the given timeout unless replaced
+func (v *TerraformCloudService) httpClient(timeout time.Duration) HTTPDoer {
+	if v.httpDoer != nil {
+		return v.httpDoer
 	}
+	return &http.Client{Timeout: timeout}
+}
 
-	// If no VLAN tags are available, return an error
-	// In a production environment, you might want to implement a cleanup mechanism
-	// or expand the range dynamically
-	fmt.Printf("Warning: No available VLAN tags in range %d-%d, reusing first available\n", min, max)
-
-	// For now, find the first available tag by clearing old entries
-	// This is a simple approach - in production, you'd want proper cleanup
-	for vlanTag := min; vlanTag <= max; vlanTag++ {
-		usedVlanTags[vlanTag] = true
-		fmt.Printf("Reusing VLAN tag: %d (range: %d-%d)\n", vlanTag, min, max)
-		return fmt.Sprintf("%d", vlanTag)
+// uploadTimeoutValue parses an upload timeout, keeping current when the value is empty or invalid
+func uploadTimeoutValue(key, value string, current time.Duration) time.Duration {
+	if value == "" {
+		return current
 	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		fmt.Printf("Warning: invalid %s %q, keeping %v\n", key, value, current)
+		return current
+	}
+	return timeout
+}
 
-	// Fallback to min value if all else fails
-	return fmt.Sprintf("%d", min)
+// uploadRetryPolicyWithOverrides applies the upload_retry_* keys of a service config to an upload retry policy
+func uploadRetryPolicyWithOverrides(policy AuthRetryPolicy, config map[string]string) AuthRetryPolicy {
+	return policy.withOverrides(map[string]string{
+		"auth_retry_attempts":    config["upload_retry_attempts"],
+		"auth_retry_backoff":     config["upload_retry_backoff"],
+		"auth_retry_max_backoff": config["upload_retry_max_backoff"],
+	})
 }
 
 // processTemplateString processes template strings like "${unique_integer(3100,3149)}" and "${lab_uuid}"
@@ -92,8 +136,8 @@ func (v *TerraformCloudService) processTemplateString(value string, labID string
 	if strings.Contains(value, "${") && strings.Contains(value, "}") {
 		fmt.Printf("TerraformCloudService: Processing template string: %s\n", value)
 
-		// Process unique_integer template
-		if strings.Contains(value, "${unique_integer(") {
+		// Process unique_integer template, values generated at setup aren't generated again for rendering
+		if strings.Contains(value, "${unique_integer(") && !v.renderOnly {
 			// Extract the range from "${unique_integer(3100,3149)}"
 			start := strings.Index(value, "(") + 1
 			end := strings.Index(value, ")")
@@ -104,7 +148,13 @@ func (v *TerraformCloudService) processTemplateString(value string, labID string
 					var min, max int
 					if _, err := fmt.Sscanf(strings.TrimSpace(parts[0]), "%d", &min); err == nil {
 						if _, err := fmt.Sscanf(strings.TrimSpace(parts[1]), "%d", &max); err == nil {
-							result := v.generateUniqueVlanTag(min, max)
+							vlanTag, err := allocateVlanTag(min, max, labID)
+							if err != nil {
+								fmt.Printf("TerraformCloudService: Failed to generate unique integer: %v\n", err)
+								v.vlanErr = err
+								return ""
+							}
+							result := strconv.Itoa(vlanTag)
 							fmt.Printf("TerraformCloudService: Generated unique integer: %s (range: %d-%d)\n", result, min, max)
 							return result
 						}
@@ -137,11 +187,22 @@ func (v *TerraformCloudService) ConfigureFromServiceConfig(config map[string]str
 	if organization, ok := config["organization"]; ok {
 		v.organization = organization
 	}
+	v.retry = v.retry.withOverrides(config)
+	v.uploadTimeout = uploadTimeoutValue("upload_timeout", config["upload_timeout"], v.uploadTimeout)
+	v.uploadRetry = uploadRetryPolicyWithOverrides(v.uploadRetry, config)
+	v.archive, v.archiveErr = parseTerraformArchive(config)
+	if v.archiveErr != nil {
+		fmt.Printf("TerraformCloudService: Invalid archive configuration: %v\n", v.archiveErr)
+	}
 
 	// Set source directory
 	if sourceDir, ok := config["source_directory"]; ok {
 		v.sourceDirectory = sourceDir
 	}
+	v.git, v.gitErr = parseTerraformGitSource(config)
+	if v.gitErr != nil {
+		fmt.Printf("TerraformCloudService: Invalid git configuration: %v\n", v.gitErr)
+	}
 
 	// Set agent pool ID and execution mode
 	if agentPoolID, ok := config["agent_pool_id"]; ok {
@@ -234,6 +295,37 @@ func (v *TerraformCloudService) ConfigureFromServiceConfig(config map[string]str
 	if vlanTag, exists := v.variables["vlan_tag"]; exists {
 		fmt.Printf("TerraformCloudService: VLAN tag set to: %s\n", vlanTag)
 	}
+
+	// A keypair is generated per lab when the configuration names a variable to pass its public key in
+	v.sshKeyVariable = strings.TrimSpace(config["ssh_key_variable"])
+
+	// Template variables this workspace accepts, as a comma-separated list of names
+	v.templateVariables = nil
+	for _, name := range strings.Split(config["template_variables"], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			v.templateVariables = append(v.templateVariables, name)
+		}
+	}
+
+	// Named workspaces declared with workspaces and workspace.<name>.* keys, or the config's single one
+	v.workspaces, v.workspacesErr = parseTerraformWorkspaces(config)
+	if v.workspacesErr != nil {
+		fmt.Printf("TerraformCloudService: Invalid workspaces configuration: %v\n", v.workspacesErr)
+	}
+}
+
+// SetTemplateVariables adds the template variables supplied at lab creation that the service config
+// lists in template_variables to the Terraform variables. Variables meant for other services of the
+// template are not sent to the workspace, and values are never logged since they may be secrets.
+func (v *TerraformCloudService) SetTemplateVariables(variables map[string]string) {
+	for _, name := range v.templateVariables {
+		value, exists := variables[name]
+		if !exists {
+			continue
+		}
+		v.variables[name] = value
+		fmt.Printf("TerraformCloudService: Template variable %s set\n", name)
+	}
 }
 
 // GetName returns the service name
@@ -251,30 +343,46 @@ func (v *TerraformCloudService) GetRequiredParams() []string {
 	return []string{"TF_CLOUD_HOST", "TF_CLOUD_API_TOKEN", "TF_CLOUD_ORGANIZATION"}
 }
 
-// ReleaseVlanTag releases a VLAN tag back to the pool
-func (v *TerraformCloudService) ReleaseVlanTag(vlanTag string) {
-	vlanTagMutex.Lock()
-	defer vlanTagMutex.Unlock()
-
-	// Convert string to int for map lookup
-	var vlanTagInt int
-	if _, err := fmt.Sscanf(vlanTag, "%d", &vlanTagInt); err == nil {
-		delete(usedVlanTags, vlanTagInt)
-		fmt.Printf("Released VLAN tag: %s\n", vlanTag)
-	}
+// ConfigSchema describes the keys the service's configs accept (implements ConfigSchemaProvider)
+func (v *TerraformCloudService) ConfigSchema() []interfaces.ConfigField {
+	fields := []interfaces.ConfigField{
+		{Key: "host", Description: "Terraform Cloud or Enterprise host", Required: true},
+		{Key: "api_token", Description: "API token used to manage lab workspaces", Required: true, Secret: true},
+		{Key: "organization", Description: "Organization lab workspaces are created in", Required: true},
+		{Key: "source_directory", Description: "Directory of the Terraform configuration uploaded to lab workspaces, relative to git_path when git_url is set"},
+		{Key: "git_url", Description: "Repository the Terraform configuration is cloned from instead of a local source_directory (https://, ssh:// or user@host:path)"},
+		{Key: "git_ref", Description: "Branch, tag or commit SHA of git_url to clone", Default: defaultGitRef},
+		{Key: "git_path", Description: "Directory of the configuration inside the repository"},
+		{Key: "git_username", Description: "Username sent with git_token", Default: defaultGitUsername},
+		{Key: "git_token", Description: "Token for cloning private https repositories", Secret: true},
+		{Key: "git_cache_ttl", Description: "How long a clone of a branch or tag is reused before it is fetched again; clones of a commit SHA are always reused", Default: defaultGitCacheTTL.String()},
+		{Key: "agent_pool_id", Description: "Agent pool runs use in agent execution mode"},
+		{Key: "execution_mode", Description: "Workspace execution mode, e.g. remote or agent"},
+		{Key: "workspaces", Description: "Comma-separated names of the workspaces each lab gets, configured with workspace.<name>.* keys"},
+		{Key: "template_variables", Description: "Comma-separated template variables passed to the workspace as Terraform variables"},
+		{Key: "ssh_key_variable", Description: "Terraform variable a generated SSH public key is passed in, no key is generated when unset"},
+		{Key: "archive_format", Description: "Format configurations are uploaded in, only tar.gz is supported", Default: archiveFormatTarGz},
+		{Key: "archive_ignore", Description: "Comma-separated glob patterns of files left out of uploads, replacing the defaults; state files and .terraform are never uploaded", Default: strings.Join(defaultArchiveIgnore, ",")},
+		{Key: "upload_timeout", Description: "Timeout of a single configuration upload", Default: defaultUploadTimeout.String(), Env: "TF_CLOUD_UPLOAD_TIMEOUT"},
+		{Key: "upload_retry_attempts", Description: "Attempts to upload the configuration", Env: "TF_CLOUD_UPLOAD_RETRY_ATTEMPTS"},
+		{Key: "upload_retry_backoff", Description: "Wait before retrying an upload, doubled after each attempt", Env: "TF_CLOUD_UPLOAD_RETRY_BACKOFF"},
+		{Key: "upload_retry_max_backoff", Description: "Longest wait between upload attempts", Env: "TF_CLOUD_UPLOAD_RETRY_MAX_BACKOFF"},
+		{Key: "terraform_config.variables.<name>", Description: "Terraform variable set on lab workspaces"},
+		{Key: "terraform_config.sensitive_variables.<name>", Description: "Sensitive Terraform variable set on lab workspaces", Secret: true},
+	}
+	return append(fields, authRetryConfigFields()...)
 }
 
-// GetVlanTagUsage returns the current VLAN tag usage statistics
-func (v *TerraformCloudService) GetVlanTagUsage() map[int]bool {
-	vlanTagMutex.Lock()
-	defer vlanTagMutex.Unlock()
+// ServiceDataKeys returns the prefixes of the ServiceData keys the service records (implements Service interface)
+func (v *TerraformCloudService) ServiceDataKeys() []string {
+	return []string{"terraform_cloud_"}
+}
 
-	// Create a copy of the map to avoid race conditions
-	usage := make(map[int]bool)
-	for k, v := range usedVlanTags {
-		usage[k] = v
+// DescribeResources returns the resource names the service derives from the lab ID (implements Service interface)
+func (v *TerraformCloudService) DescribeResources(labID string) map[string]string {
+	return map[string]string{
+		"terraform_cloud_workspace_name": fmt.Sprintf("lab-%s", labID),
 	}
-	return usage
 }
 
 // Name returns the service name (implements Setup interface)
@@ -282,13 +390,75 @@ func (v *TerraformCloudService) Name() string {
 	return v.GetName()
 }
 
-// ExecuteSetup sets up Terraform Cloud workspace and adds credentials
+// TestConnection verifies the host and API token by reading the configured organization
+func (v *TerraformCloudService) TestConnection() error {
+	if v.host == "" || v.apiToken == "" || v.organization == "" {
+		return fmt.Errorf("host, api_token and organization are required")
+	}
+
+	url := fmt.Sprintf("%s/api/v2/organizations/%s", v.host, v.organization)
+	req, err := http.NewRequestWithContext(v.requestContext(), "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create organization request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+v.apiToken)
+	req.Header.Set("Content-Type", "application/vnd.api+json")
+
+	client := v.httpClient(10 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Terraform Cloud: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return fmt.Errorf("API token was rejected (status 401)")
+	case http.StatusNotFound:
+		return fmt.Errorf("organization %s not found or not accessible with this token", v.organization)
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("organization request failed with status: %d, response: %s", resp.StatusCode, string(body))
+	}
+}
+
+// requestContext returns the context outgoing Terraform Cloud requests are bound to
+func (v *TerraformCloudService) requestContext() context.Context {
+	if v.ctx != nil {
+		return v.ctx
+	}
+	return context.Background()
+}
+
+// ExecuteSetup sets up the lab's Terraform Cloud workspaces and adds credentials. Workspaces are set up in
+// dependency order, and a workspace's run is only triggered once the runs of the workspaces it depends on applied.
 func (v *TerraformCloudService) ExecuteSetup(ctx *interfaces.SetupContext) error {
+	v.ctx = ctx.Context
+
 	// Update progress: Creating Workspace
 	if ctx.UpdateProgress != nil {
 		ctx.UpdateProgress("Creating Workspace", "running", "Creating workspace in Terraform Cloud...")
 	}
 
+	if ctx.Lab != nil && ctx.Lab.ServiceData == nil {
+		ctx.Lab.ServiceData = make(map[string]string)
+	}
+
+	// Remember the VLAN tag the lab got before anything can fail, so cleanup releases it and its
+	// configuration can be rendered again
+	if vlanTag, exists := v.variables["vlan_tag"]; exists && vlanTag != "" && ctx.Lab != nil {
+		ctx.Lab.ServiceData["terraform_cloud_vlan_tag"] = vlanTag
+	}
+
+	if v.vlanErr != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Creating Workspace", "failed", v.vlanErr.Error())
+		}
+		return v.vlanErr
+	}
 	if v.host == "" || v.apiToken == "" || v.organization == "" {
 		err := fmt.Errorf("TF_CLOUD_HOST, TF_CLOUD_API_TOKEN, and TF_CLOUD_ORGANIZATION environment variables are required")
 		if ctx.UpdateProgress != nil {
@@ -296,67 +466,166 @@ func (v *TerraformCloudService) ExecuteSetup(ctx *interfaces.SetupContext) error
 		}
 		return err
 	}
-
-	// Use lab ID directly as it's already the short ID
-	shortID := ctx.LabID
+	if v.workspacesErr != nil {
+		err := fmt.Errorf("invalid workspaces configuration: %w", v.workspacesErr)
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Creating Workspace", "failed", err.Error())
+		}
+		return err
+	}
+	if v.gitErr != nil {
+		err := fmt.Errorf("invalid git configuration: %w", v.gitErr)
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Creating Workspace", "failed", err.Error())
+		}
+		return err
+	}
 
 	fmt.Printf("Setting up Terraform Cloud workspace for lab %s...\n", ctx.LabName)
 
+	// Generate the lab's SSH keypair, the VMs get the public key through a Terraform variable
+	var sshPublicKey, sshPrivateKey string
+	if v.sshKeyVariable != "" {
+		var err error
+		sshPublicKey, sshPrivateKey, err = GenerateSSHKeyPair(fmt.Sprintf("lab-%s", ctx.LabID))
+		if err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Setting Variables", "failed", err.Error())
+			}
+			return err
+		}
+		v.variables[v.sshKeyVariable] = sshPublicKey
+	}
+
+	var created []terraformWorkspaceEntry
+	runIDs := make(map[string]string)
+	for _, workspace := range v.workspaces {
+		workspaceID, err := v.setupWorkspace(ctx, workspace, runIDs)
+		if err != nil {
+			return err
+		}
+		created = append(created, terraformWorkspaceEntry{name: workspace.name, id: workspaceID})
+	}
+
+	// Add credentials
+	for _, workspace := range created {
+		workspaceURL := fmt.Sprintf("%s/app/%s/workspaces/%s", v.host, v.organization, workspace.id)
+		label := "Terraform Cloud Workspace"
+		if workspace.name != "" {
+			label = fmt.Sprintf("Terraform Cloud Workspace (%s)", workspace.name)
+		}
+
+		credential := &interfaces.Credential{
+			ID:        uuid.New().String(),
+			LabID:     ctx.LabID,
+			Label:     label,
+			Username:  "API Token",
+			Password:  v.apiToken,
+			URL:       workspaceURL,
+			ExpiresAt: time.Now().Add(time.Duration(ctx.Duration) * time.Minute),
+			Notes:     fmt.Sprintf("Workspace ID: %s\nOrganization: %s", workspace.id, v.organization),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+
+		if err := ctx.AddCredential(credential); err != nil {
+			fmt.Printf("Warning: Failed to add credential: %v\n", err)
+		}
+	}
+
+	if sshPrivateKey != "" {
+		sshCredential := &interfaces.Credential{
+			ID:             uuid.New().String(),
+			LabID:          ctx.LabID,
+			Label:          "VM SSH Key",
+			Username:       v.variables["vm_user"],
+			ExpiresAt:      time.Now().Add(time.Duration(ctx.Duration) * time.Minute),
+			Notes:          fmt.Sprintf("Save the private key with mode 600 and connect with: ssh -i <key file> %s@<vm address>", v.variables["vm_user"]),
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+			CredentialType: models.CredentialTypeSSHKey,
+			PublicKey:      sshPublicKey,
+			PrivateKey:     sshPrivateKey,
+		}
+		if err := ctx.AddCredential(sshCredential); err != nil {
+			fmt.Printf("Warning: Failed to add SSH key credential: %v\n", err)
+		}
+	}
+
+	fmt.Printf("Terraform Cloud workspace setup completed for lab %s\n", ctx.LabName)
+	return nil
+}
+
+// setupWorkspace creates one of the lab's workspaces, uploads its configuration, sets its variables and
+// triggers its run once the runs of the workspaces it depends on applied. The run IDs of workspaces set up
+// so far are kept in runIDs by workspace name.
+func (v *TerraformCloudService) setupWorkspace(ctx *interfaces.SetupContext, workspace terraformWorkspace, runIDs map[string]string) (string, error) {
+	name := workspaceName(ctx.LabID, workspace)
+
 	// Create workspace
-	workspaceID, err := v.createWorkspace(ctx, shortID)
+	workspaceID, err := v.createWorkspace(ctx, name, workspace)
 	if err != nil {
 		if ctx.UpdateProgress != nil {
-			ctx.UpdateProgress("Creating Workspace", "failed", fmt.Sprintf("Failed to create workspace: %v", err))
+			ctx.UpdateProgress("Creating Workspace", "failed", fmt.Sprintf("Failed to create workspace %s: %v", name, err))
 		}
-		return err
+		return "", err
 	}
 
 	v.workspaceID = workspaceID
 
 	// Store workspace ID in lab data
 	if ctx.Lab != nil {
-		if ctx.Lab.ServiceData == nil {
-			ctx.Lab.ServiceData = make(map[string]string)
+		if workspace.name == "" {
+			ctx.Lab.ServiceData["terraform_cloud_workspace_id"] = workspaceID
+		} else {
+			ctx.Lab.ServiceData["terraform_cloud_workspace_ids"] = appendWorkspaceEntry(ctx.Lab.ServiceData["terraform_cloud_workspace_ids"], workspace.name, workspaceID)
 		}
-		ctx.Lab.ServiceData["terraform_cloud_workspace_id"] = workspaceID
 	}
 
 	// Update progress: Workspace Created
 	if ctx.UpdateProgress != nil {
-		ctx.UpdateProgress("Creating Workspace", "completed", "Workspace created successfully")
+		ctx.UpdateProgress("Creating Workspace", "completed", fmt.Sprintf("Workspace %s created successfully", name))
 	}
 
 	// Upload Terraform configuration if provided
 	if ctx.UpdateProgress != nil {
-		ctx.UpdateProgress("Uploading Configuration", "running", "Uploading Terraform configuration...")
+		ctx.UpdateProgress("Uploading Configuration", "running", fmt.Sprintf("Uploading Terraform configuration to %s...", name))
 	}
 
+	sourceDirectory := workspace.sourceDirectory
+	if sourceDirectory == "" {
+		sourceDirectory = v.sourceDirectory
+	}
+	variables := mergedVariables(v.variables, workspace.variables)
+	sensitiveVars := mergedVariables(v.sensitiveVars, workspace.sensitiveVars)
+
 	// Load Terraform configuration from spacewalk directory or use default
-	configFiles, err := v.LoadTerraformConfiguration(ctx)
+	configFiles, err := v.loadConfiguration(ctx, sourceDirectory, variables)
 	if err != nil {
 		if ctx.UpdateProgress != nil {
 			ctx.UpdateProgress("Loading Configuration", "failed", fmt.Sprintf("Failed to load configuration: %v", err))
 		}
-		return err
+		return "", err
 	}
 
 	if err := v.uploadConfiguration(workspaceID, configFiles); err != nil {
 		if ctx.UpdateProgress != nil {
 			ctx.UpdateProgress("Uploading Configuration", "failed", fmt.Sprintf("Failed to upload configuration: %v", err))
 		}
-		return err
+		v.deleteAbandonedWorkspace(ctx, workspace, workspaceID)
+		return "", err
 	}
 
 	// Set workspace variables from service configuration
 	if ctx.UpdateProgress != nil {
-		ctx.UpdateProgress("Setting Variables", "running", "Setting workspace variables...")
+		ctx.UpdateProgress("Setting Variables", "running", fmt.Sprintf("Setting variables of %s...", name))
 	}
 
-	if err := v.SetWorkspaceVariables(workspaceID); err != nil {
+	if err := v.setVariables(workspaceID, variables, sensitiveVars); err != nil {
 		if ctx.UpdateProgress != nil {
 			ctx.UpdateProgress("Setting Variables", "failed", fmt.Sprintf("Failed to set variables: %v", err))
 		}
-		return err
+		return "", err
 	}
 
 	if ctx.UpdateProgress != nil {
@@ -372,51 +641,109 @@ func (v *TerraformCloudService) ExecuteSetup(ctx *interfaces.SetupContext) error
 		ctx.UpdateProgress("Triggering Run", "running", "Triggering Terraform apply...")
 	}
 
-	runID, err := v.triggerRun(workspaceID, "Initial lab setup")
+	for _, dependency := range workspace.dependsOn {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Triggering Run", "running", fmt.Sprintf("Waiting for the run of workspace %s to apply before %s...", dependency, workspace.name))
+		}
+		if err := v.waitForRun(runIDs[dependency]); err != nil {
+			if ctx.UpdateProgress != nil {
+				ctx.UpdateProgress("Triggering Run", "failed", fmt.Sprintf("Workspace %s depends on %s: %v", workspace.name, dependency, err))
+			}
+			return "", err
+		}
+	}
+
+	// Runs of workspaces others depend on apply on their own, so the dependents' runs can follow
+	runID, err := v.triggerRun(workspaceID, "Initial lab setup", v.hasDependents(workspace.name))
 	if err != nil {
 		if ctx.UpdateProgress != nil {
 			ctx.UpdateProgress("Triggering Run", "failed", fmt.Sprintf("Failed to trigger run: %v", err))
 		}
-		return err
+		return "", err
 	}
+	runIDs[workspace.name] = runID
 
-	// Store run ID in lab data
+	// Store run ID in lab data, terraform_cloud_run_id is the latest run
 	if ctx.Lab != nil {
 		ctx.Lab.ServiceData["terraform_cloud_run_id"] = runID
+		if workspace.name != "" {
+			ctx.Lab.ServiceData["terraform_cloud_run_ids"] = appendWorkspaceEntry(ctx.Lab.ServiceData["terraform_cloud_run_ids"], workspace.name, runID)
+		}
 	}
 
 	if ctx.UpdateProgress != nil {
 		ctx.UpdateProgress("Triggering Run", "completed", "Terraform run triggered successfully")
 	}
 
-	// Add credentials
-	workspaceURL := fmt.Sprintf("%s/app/%s/workspaces/%s", v.host, v.organization, workspaceID)
+	return workspaceID, nil
+}
+
+// deleteAbandonedWorkspace removes a workspace whose setup failed before anything ran in it, so it isn't
+// left behind. When deletion fails the workspace ID stays in the lab's ServiceData for cleanup to retry.
+func (v *TerraformCloudService) deleteAbandonedWorkspace(ctx *interfaces.SetupContext, workspace terraformWorkspace, workspaceID string) {
+	// The setup context may already be cancelled by the setup timeout, delete with a fresh one
+	setupCtx := v.ctx
+	deleteCtx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	v.ctx = deleteCtx
+	defer func() {
+		cancel()
+		v.ctx = setupCtx
+	}()
 
-	credential := &interfaces.Credential{
-		ID:        uuid.New().String(),
-		LabID:     ctx.LabID,
-		Label:     "Terraform Cloud Workspace",
-		Username:  "API Token",
-		Password:  v.apiToken,
-		URL:       workspaceURL,
-		ExpiresAt: time.Now().Add(time.Duration(ctx.Duration) * time.Minute),
-		Notes:     fmt.Sprintf("Workspace ID: %s\nOrganization: %s", workspaceID, v.organization),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	if err := v.deleteWorkspace(workspaceID); err != nil {
+		fmt.Printf("Warning: failed to delete abandoned workspace %s: %v\n", workspaceID, err)
+		return
 	}
 
-	if err := ctx.AddCredential(credential); err != nil {
-		fmt.Printf("Warning: Failed to add credential: %v\n", err)
+	v.workspaceID = ""
+	if ctx.Lab == nil {
+		return
+	}
+	if workspace.name == "" {
+		delete(ctx.Lab.ServiceData, "terraform_cloud_workspace_id")
+		return
+	}
+	if remaining := removeWorkspaceEntry(ctx.Lab.ServiceData["terraform_cloud_workspace_ids"], workspaceID); remaining != "" {
+		ctx.Lab.ServiceData["terraform_cloud_workspace_ids"] = remaining
+	} else {
+		delete(ctx.Lab.ServiceData, "terraform_cloud_workspace_ids")
 	}
+}
 
-	fmt.Printf("Terraform Cloud workspace setup completed for lab %s\n", ctx.LabName)
+// ExecuteCleanup cleans up the lab's Terraform Cloud workspaces. Named workspaces are deleted in reverse
+// order of creation, so no workspace goes before the ones depending on it; cleanup stops at the first
+// failure and a retry picks up the rest. The lab's VLAN tags are released once its workspaces are gone.
+func (v *TerraformCloudService) ExecuteCleanup(ctx *interfaces.CleanupContext) error {
+	if err := v.cleanupWorkspaces(ctx); err != nil {
+		return err
+	}
+
+	// The lab's VLAN tags can be handed out again once nothing uses them anymore. Every tag allocated
+	// for the lab is released, not only vlan_tag's, whichever variable it was allocated for.
+	ReleaseLabVlanTags(ctx.LabID)
 	return nil
 }
 
-// ExecuteCleanup cleans up Terraform Cloud workspace
-func (v *TerraformCloudService) ExecuteCleanup(ctx *interfaces.CleanupContext) error {
+// cleanupWorkspaces deletes the workspaces recorded for the lab, or looks its workspace up by name when
+// none were recorded
+func (v *TerraformCloudService) cleanupWorkspaces(ctx *interfaces.CleanupContext) error {
 	fmt.Printf("Cleaning up Terraform Cloud workspace for lab %s...\n", ctx.LabID)
 
+	var workspaces []terraformWorkspaceEntry
+	if ctx.Lab != nil && ctx.Lab.ServiceData != nil {
+		workspaces = parseWorkspaceEntries(ctx.Lab.ServiceData["terraform_cloud_workspace_ids"])
+	}
+	if len(workspaces) > 0 {
+		for i := len(workspaces) - 1; i >= 0; i-- {
+			fmt.Printf("Cleaning up workspace %s (ID: %s)...\n", workspaces[i].name, workspaces[i].id)
+			if err := v.cleanupWorkspace(ctx, workspaces[i].id); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Terraform Cloud workspace cleanup completed for lab %s\n", ctx.LabID)
+		return nil
+	}
+
 	// Get workspace ID from lab data
 	var workspaceID string
 	if ctx.Lab != nil && ctx.Lab.ServiceData != nil {
@@ -440,58 +767,81 @@ func (v *TerraformCloudService) ExecuteCleanup(ctx *interfaces.CleanupContext) e
 		}
 	}
 
-	// Additional safety check: verify the workspace still exists before cleanup
-	if workspaceID != "" {
-		exists, err := v.workspaceExists(workspaceID)
-		if err != nil {
-			fmt.Printf("Warning: Failed to verify workspace existence: %v\n", err)
-		} else if !exists {
-			fmt.Printf("Workspace %s no longer exists, skipping cleanup\n", workspaceID)
-			return nil
-		}
-	}
-
 	if workspaceID == "" {
 		fmt.Printf("Warning: No workspace found for lab %s\n", ctx.LabID)
+		ctx.SkipResource(fmt.Sprintf("workspace lab-%s", ctx.LabID), "delete", "workspace not found")
+		return nil
+	}
+
+	if err := v.cleanupWorkspace(ctx, workspaceID); err != nil {
+		return err
+	}
+
+	fmt.Printf("Terraform Cloud workspace cleanup completed for lab %s\n", ctx.LabID)
+	return nil
+}
+
+// cleanupWorkspace cancels a workspace's runs, deletes its variables and then the workspace itself.
+// Workspaces that no longer exist are skipped.
+func (v *TerraformCloudService) cleanupWorkspace(ctx *interfaces.CleanupContext, workspaceID string) error {
+	// Additional safety check: verify the workspace still exists before cleanup
+	exists, err := v.workspaceExists(workspaceID)
+	if err != nil {
+		fmt.Printf("Warning: Failed to verify workspace existence: %v\n", err)
+	} else if !exists {
+		fmt.Printf("Workspace %s no longer exists, skipping cleanup\n", workspaceID)
+		ctx.SkipResource("workspace "+workspaceID, "delete", "workspace no longer exists")
 		return nil
 	}
 
 	// Clean up any runs associated with the workspace
 	fmt.Printf("Cleaning up runs for workspace %s...\n", workspaceID)
-	if err := v.cleanupWorkspaceRuns(workspaceID); err != nil {
+	err = v.cleanupWorkspaceRuns(workspaceID)
+	if err != nil {
 		fmt.Printf("Warning: Failed to cleanup runs for workspace %s: %v\n", workspaceID, err)
 		// Continue with workspace deletion even if run cleanup fails
 	}
+	ctx.ReportResource("runs of workspace "+workspaceID, "cancel", err)
 
 	// Clean up any variables associated with the workspace
 	fmt.Printf("Cleaning up variables for workspace %s...\n", workspaceID)
-	if err := v.cleanupWorkspaceVariables(workspaceID); err != nil {
+	err = v.cleanupWorkspaceVariables(workspaceID)
+	if err != nil {
 		fmt.Printf("Warning: Failed to cleanup variables for workspace %s: %v\n", workspaceID, err)
 		// Continue with workspace deletion even if variable cleanup fails
 	}
+	ctx.ReportResource("variables of workspace "+workspaceID, "delete", err)
 
 	// Delete workspace
-	if err := v.deleteWorkspace(workspaceID); err != nil {
+	err = v.deleteWorkspace(workspaceID)
+	ctx.ReportResource("workspace "+workspaceID, "delete", err)
+	if err != nil {
 		fmt.Printf("Warning: Failed to delete workspace %s: %v\n", workspaceID, err)
 		return err
 	}
-
-	fmt.Printf("Terraform Cloud workspace cleanup completed for lab %s\n", ctx.LabID)
 	return nil
 }
 
-// createWorkspace creates a new Terraform Cloud workspace
-func (v *TerraformCloudService) createWorkspace(ctx *interfaces.SetupContext, shortID string) (string, error) {
+// createWorkspace creates a new Terraform Cloud workspace, in the workspace's agent pool and execution
+// mode when it sets its own
+func (v *TerraformCloudService) createWorkspace(ctx *interfaces.SetupContext, workspaceName string, workspace terraformWorkspace) (string, error) {
+	executionMode := workspace.executionMode
+	if executionMode == "" {
+		executionMode = v.executionMode
+	}
+	agentPoolID := workspace.agentPoolID
+	if agentPoolID == "" {
+		agentPoolID = v.agentPoolID
+	}
+
 	// Validate required configuration
-	if v.executionMode == "" {
+	if executionMode == "" {
 		return "", fmt.Errorf("execution_mode is required but not configured")
 	}
-	if v.agentPoolID == "" {
+	if agentPoolID == "" {
 		return "", fmt.Errorf("agent_pool_id is required but not configured")
 	}
 
-	workspaceName := fmt.Sprintf("lab-%s", shortID)
-
 	// Prepare workspace data
 	workspaceData := map[string]interface{}{
 		"data": map[string]interface{}{
@@ -502,8 +852,8 @@ func (v *TerraformCloudService) createWorkspace(ctx *interfaces.SetupContext, sh
 				"auto-apply":            false,
 				"file-triggers-enabled": true,
 				"terraform-version":     "1.5.0",
-				"execution-mode":        v.executionMode,
-				"agent-pool-id":         v.agentPoolID,
+				"execution-mode":        executionMode,
+				"agent-pool-id":         agentPoolID,
 			},
 		},
 	}
@@ -515,7 +865,7 @@ func (v *TerraformCloudService) createWorkspace(ctx *interfaces.SetupContext, sh
 
 	// Create HTTP request
 	url := fmt.Sprintf("%s/api/v2/organizations/%s/workspaces", v.host, v.organization)
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(jsonData)))
+	req, err := http.NewRequestWithContext(v.requestContext(), "POST", url, strings.NewReader(string(jsonData)))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %v", err)
 	}
@@ -524,7 +874,7 @@ func (v *TerraformCloudService) createWorkspace(ctx *interfaces.SetupContext, sh
 	req.Header.Set("Content-Type", "application/vnd.api+json")
 
 	// Make request
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := v.httpClient(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to make request: %v", err)
@@ -560,19 +910,92 @@ func (v *TerraformCloudService) createWorkspace(ctx *interfaces.SetupContext, sh
 	return workspaceID, nil
 }
 
+// ListLabResources lists workspaces following the lab-{id} and lab-{id}-{workspace} naming conventions
+func (v *TerraformCloudService) ListLabResources() ([]interfaces.LabResource, error) {
+	if v.host == "" || v.apiToken == "" || v.organization == "" {
+		return nil, fmt.Errorf("host, api_token and organization configuration is required")
+	}
+
+	var resources []interfaces.LabResource
+	client := v.httpClient(30 * time.Second)
+
+	for page := 1; page > 0; {
+		url := fmt.Sprintf("%s/api/v2/organizations/%s/workspaces?search[name]=lab-&page[size]=100&page[number]=%d", v.host, v.organization, page)
+		req, err := http.NewRequestWithContext(v.requestContext(), "GET", url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create list request: %v", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+v.apiToken)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workspaces: %v", err)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %v", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to list workspaces: %s - %s", resp.Status, string(body))
+		}
+
+		var response struct {
+			Data []struct {
+				ID         string `json:"id"`
+				Attributes struct {
+					Name      string    `json:"name"`
+					CreatedAt time.Time `json:"created-at"`
+				} `json:"attributes"`
+			} `json:"data"`
+			Meta struct {
+				Pagination struct {
+					NextPage *int `json:"next-page"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %v", err)
+		}
+
+		for _, workspace := range response.Data {
+			name := workspace.Attributes.Name
+			labID, ok := workspaceLabID(name)
+			if !ok {
+				continue
+			}
+			resources = append(resources, interfaces.LabResource{
+				Name:      name,
+				LabID:     labID,
+				CreatedAt: workspace.Attributes.CreatedAt,
+			})
+		}
+
+		page = 0
+		if response.Meta.Pagination.NextPage != nil {
+			page = *response.Meta.Pagination.NextPage
+		}
+	}
+
+	return resources, nil
+}
+
 // findWorkspaceByName searches for a Terraform Cloud workspace by name
 func (v *TerraformCloudService) findWorkspaceByName(workspaceName string) (string, error) {
 	fmt.Printf("Searching for Terraform Cloud workspace: %s\n", workspaceName)
 
 	url := fmt.Sprintf("%s/api/v2/organizations/%s/workspaces?search[name]=%s", v.host, v.organization, workspaceName)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(v.requestContext(), "GET", url, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create search request: %v", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+v.apiToken)
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := v.httpClient(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to search workspace: %v", err)
@@ -633,14 +1056,14 @@ func (v *TerraformCloudService) cleanupWorkspaceRuns(workspaceID string) error {
 
 	// Get all runs for the workspace
 	url := fmt.Sprintf("%s/api/v2/workspaces/%s/runs", v.host, workspaceID)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(v.requestContext(), "GET", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create runs request: %v", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+v.apiToken)
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := v.httpClient(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to get runs: %v", err)
@@ -705,7 +1128,7 @@ func (v *TerraformCloudService) cleanupWorkspaceRuns(workspaceID string) error {
 // cancelRun cancels a Terraform Cloud run
 func (v *TerraformCloudService) cancelRun(runID string) error {
 	url := fmt.Sprintf("%s/api/v2/runs/%s/actions/cancel", v.host, runID)
-	req, err := http.NewRequest("POST", url, nil)
+	req, err := http.NewRequestWithContext(v.requestContext(), "POST", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create cancel request: %v", err)
 	}
@@ -713,7 +1136,7 @@ func (v *TerraformCloudService) cancelRun(runID string) error {
 	req.Header.Set("Authorization", "Bearer "+v.apiToken)
 	req.Header.Set("Content-Type", "application/vnd.api+json")
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := v.httpClient(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to cancel run: %v", err)
@@ -734,14 +1157,14 @@ func (v *TerraformCloudService) cleanupWorkspaceVariables(workspaceID string) er
 
 	// Get all variables for the workspace
 	url := fmt.Sprintf("%s/api/v2/workspaces/%s/vars", v.host, workspaceID)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(v.requestContext(), "GET", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create variables request: %v", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+v.apiToken)
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := v.httpClient(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to get variables: %v", err)
@@ -793,14 +1216,14 @@ func (v *TerraformCloudService) cleanupWorkspaceVariables(workspaceID string) er
 // deleteVariable deletes a Terraform Cloud variable
 func (v *TerraformCloudService) deleteVariable(workspaceID, variableID string) error {
 	url := fmt.Sprintf("%s/api/v2/workspaces/%s/vars/%s", v.host, workspaceID, variableID)
-	req, err := http.NewRequest("DELETE", url, nil)
+	req, err := http.NewRequestWithContext(v.requestContext(), "DELETE", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create delete variable request: %v", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+v.apiToken)
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := v.httpClient(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to delete variable: %v", err)
@@ -818,14 +1241,14 @@ func (v *TerraformCloudService) deleteVariable(workspaceID, variableID string) e
 // workspaceExists checks if a workspace exists by making a GET request to the workspace endpoint
 func (v *TerraformCloudService) workspaceExists(workspaceID string) (bool, error) {
 	url := fmt.Sprintf("%s/api/v2/workspaces/%s", v.host, workspaceID)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(v.requestContext(), "GET", url, nil)
 	if err != nil {
 		return false, fmt.Errorf("failed to create workspace check request: %v", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+v.apiToken)
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := v.httpClient(10 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return false, fmt.Errorf("failed to check workspace existence: %v", err)
@@ -859,7 +1282,7 @@ func (v *TerraformCloudService) deleteWorkspace(workspaceID string) error {
 // safeDeleteWorkspace attempts to safely delete a workspace using the safe-delete endpoint
 func (v *TerraformCloudService) safeDeleteWorkspace(workspaceID string) error {
 	url := fmt.Sprintf("%s/api/v2/workspaces/%s/actions/safe-delete", v.host, workspaceID)
-	req, err := http.NewRequest("POST", url, nil)
+	req, err := http.NewRequestWithContext(v.requestContext(), "POST", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create safe delete request: %v", err)
 	}
@@ -867,7 +1290,7 @@ func (v *TerraformCloudService) safeDeleteWorkspace(workspaceID string) error {
 	req.Header.Set("Authorization", "Bearer "+v.apiToken)
 	req.Header.Set("Content-Type", "application/vnd.api+json")
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := v.httpClient(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to execute safe delete request: %v", err)
@@ -885,20 +1308,26 @@ func (v *TerraformCloudService) safeDeleteWorkspace(workspaceID string) error {
 // forceDeleteWorkspace forces deletion of a workspace using the DELETE endpoint
 func (v *TerraformCloudService) forceDeleteWorkspace(workspaceID string) error {
 	url := fmt.Sprintf("%s/api/v2/workspaces/%s", v.host, workspaceID)
-	req, err := http.NewRequest("DELETE", url, nil)
+	req, err := http.NewRequestWithContext(v.requestContext(), "DELETE", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create force delete request: %v", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+v.apiToken)
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := v.httpClient(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to execute force delete request: %v", err)
 	}
 	defer resp.Body.Close()
 
+	// A workspace that is already gone counts as deleted so cleanup can be retried safely
+	if resp.StatusCode == http.StatusNotFound {
+		fmt.Printf("Workspace %s not found, treating as already deleted\n", workspaceID)
+		return nil
+	}
+
 	if resp.StatusCode != http.StatusNoContent {
 		body, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("force delete failed: %s - %s", resp.Status, string(body))
@@ -909,6 +1338,10 @@ func (v *TerraformCloudService) forceDeleteWorkspace(workspaceID string) error {
 
 // uploadConfiguration uploads Terraform configuration to the workspace
 func (v *TerraformCloudService) uploadConfiguration(workspaceID string, configFiles map[string]string) error {
+	if v.archiveErr != nil {
+		return fmt.Errorf("invalid archive configuration: %w", v.archiveErr)
+	}
+
 	// Create a configuration version
 	_, err := v.createConfigurationVersion(workspaceID)
 	if err != nil {
@@ -927,19 +1360,28 @@ func (v *TerraformCloudService) uploadConfiguration(workspaceID string, configFi
 		return fmt.Errorf("no configuration files to upload")
 	}
 
+	// Configuration files go in their own directory so the archive isn't written among them
+	sourceDir := filepath.Join(tempDir, "config")
+
 	// Write all configuration files to temp directory
 	for fileName, content := range configFiles {
 		// Validate file name
 		if fileName == "" {
 			return fmt.Errorf("empty file name not allowed")
 		}
+		if !filepath.IsLocal(fileName) {
+			return fmt.Errorf("file name %s must be a relative path inside the configuration", fileName)
+		}
 
 		// Validate content
 		if len(content) == 0 {
 			fmt.Printf("Warning: Empty file content for %s\n", fileName)
 		}
 
-		filePath := filepath.Join(tempDir, fileName)
+		filePath := filepath.Join(sourceDir, fileName)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %v", fileName, err)
+		}
 		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
 			return fmt.Errorf("failed to write file %s: %v", fileName, err)
 		}
@@ -948,9 +1390,12 @@ func (v *TerraformCloudService) uploadConfiguration(workspaceID string, configFi
 
 	// Create a tar.gz file containing all configuration files
 	tarGzPath := filepath.Join(tempDir, "config.tar.gz")
-	if err := v.createTarGzFile(tempDir, tarGzPath); err != nil {
+	if err := v.archive.createTarGzFile(sourceDir, tarGzPath); err != nil {
 		return fmt.Errorf("failed to create tar.gz file: %v", err)
 	}
+	if err := validateTarGzFile(tarGzPath); err != nil {
+		return err
+	}
 
 	// Verify tar.gz file was created and has content
 	tarGzInfo, err := os.Stat(tarGzPath)
@@ -988,7 +1433,7 @@ func (v *TerraformCloudService) createConfigurationVersion(workspaceID string) (
 	}
 
 	url := fmt.Sprintf("%s/api/v2/workspaces/%s/configuration-versions", v.host, workspaceID)
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(jsonData)))
+	req, err := http.NewRequestWithContext(v.requestContext(), "POST", url, strings.NewReader(string(jsonData)))
 	if err != nil {
 		return "", fmt.Errorf("failed to create configuration version request: %v", err)
 	}
@@ -996,7 +1441,7 @@ func (v *TerraformCloudService) createConfigurationVersion(workspaceID string) (
 	req.Header.Set("Authorization", "Bearer "+v.apiToken)
 	req.Header.Set("Content-Type", "application/vnd.api+json")
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := v.httpClient(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to make configuration version request: %v", err)
@@ -1044,240 +1489,74 @@ func (v *TerraformCloudService) createConfigurationVersion(workspaceID string) (
 	return configVersionID, nil
 }
 
-// createZipFile creates a zip file containing all configuration files
-func (v *TerraformCloudService) createZipFile(sourceDir, zipPath string) error {
-	zipFile, err := os.Create(zipPath)
-	if err != nil {
-		return fmt.Errorf("failed to create zip file: %v", err)
-	}
-	defer zipFile.Close()
-
-	zipWriter := zip.NewWriter(zipFile)
-
-	// Walk through the source directory
-	err = filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip directories and the zip file itself
-		if info.IsDir() || filepath.Base(path) == "config.zip" {
-			return nil
-		}
-
-		// Create a relative path for the zip file
-		relPath, err := filepath.Rel(sourceDir, path)
-		if err != nil {
-			return fmt.Errorf("failed to get relative path: %v", err)
-		}
-
-		// Create zip file entry
-		zipEntry, err := zipWriter.Create(relPath)
-		if err != nil {
-			return fmt.Errorf("failed to create zip entry: %v", err)
-		}
-
-		// Read and write file content
-		fileContent, err := os.ReadFile(path)
-		if err != nil {
-			return fmt.Errorf("failed to read file %s: %v", path, err)
-		}
-
-		_, err = zipEntry.Write(fileContent)
-		if err != nil {
-			return fmt.Errorf("failed to write to zip entry: %v", err)
-		}
-
-		fmt.Printf("Added to zip: %s (%d bytes)\n", relPath, len(fileContent))
-		return nil
-	})
-
-	if err != nil {
-		zipWriter.Close()
-		return fmt.Errorf("failed to walk directory: %v", err)
-	}
+// uploadTarGzFile uploads the tar.gz file to Terraform Cloud
+func (v *TerraformCloudService) uploadTarGzFile(tarGzPath string) error {
+	return v.uploadArchive(tarGzPath, "tar.gz file")
+}
 
-	// Close the zip writer to finalize the zip file
-	if err := zipWriter.Close(); err != nil {
-		return fmt.Errorf("failed to close zip writer: %v", err)
+// uploadArchive PUTs a configuration archive to the configuration version's upload URL. Each attempt
+// is bounded by the upload timeout, and network errors, timeouts and server errors are retried with backoff.
+func (v *TerraformCloudService) uploadArchive(archivePath, kind string) error {
+	if v.uploadURL == "" {
+		return fmt.Errorf("upload URL not available")
 	}
 
-	return nil
-}
-
-// createTarGzFile creates a tar.gz file containing all configuration files
-func (v *TerraformCloudService) createTarGzFile(sourceDir, tarGzPath string) error {
-	tarGzFile, err := os.Create(tarGzPath)
+	data, err := os.ReadFile(archivePath)
 	if err != nil {
-		return fmt.Errorf("failed to create tar.gz file: %v", err)
+		return fmt.Errorf("failed to read %s: %v", kind, err)
 	}
-	defer tarGzFile.Close()
 
-	gzipWriter := gzip.NewWriter(tarGzFile)
-	defer gzipWriter.Close()
+	fmt.Printf("Uploading %s: %d bytes\n", kind, len(data))
 
-	tarWriter := tar.NewWriter(gzipWriter)
-	defer tarWriter.Close()
-
-	// Walk through the source directory
-	err = filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip directories and the tar.gz file itself
-		if info.IsDir() || filepath.Base(path) == "config.tar.gz" {
-			return nil
-		}
+	timeout := v.uploadTimeout
+	if timeout <= 0 {
+		timeout = defaultUploadTimeout
+	}
+	client := v.httpClient(timeout)
 
-		// Create a relative path for the tar file
-		relPath, err := filepath.Rel(sourceDir, path)
+	err = retryWithBackoff(v.requestContext(), v.uploadRetry, "uploading "+kind, func() error {
+		req, err := http.NewRequestWithContext(v.requestContext(), "PUT", v.uploadURL, bytes.NewReader(data))
 		if err != nil {
-			return fmt.Errorf("failed to get relative path: %v", err)
+			return &permanentError{err: fmt.Errorf("failed to create upload request: %v", err)}
 		}
+		req.Header.Set("Content-Type", "application/octet-stream")
 
-		// Read file content
-		fileContent, err := os.ReadFile(path)
+		resp, err := client.Do(req)
 		if err != nil {
-			return fmt.Errorf("failed to read file %s: %v", path, err)
-		}
-
-		// Create tar header
-		header := &tar.Header{
-			Name: relPath,
-			Mode: int64(info.Mode()),
-			Size: int64(len(fileContent)),
+			return fmt.Errorf("failed to upload %s: %v", kind, err)
 		}
+		defer resp.Body.Close()
 
-		// Write tar header
-		if err := tarWriter.WriteHeader(header); err != nil {
-			return fmt.Errorf("failed to write tar header for %s: %v", relPath, err)
-		}
-
-		// Write file content
-		if _, err := tarWriter.Write(fileContent); err != nil {
-			return fmt.Errorf("failed to write to tar entry: %v", err)
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			err := fmt.Errorf("failed to upload %s: %s - %s", kind, resp.Status, string(body))
+			if !isTransientStatus(resp.StatusCode) {
+				return &permanentError{err: err}
+			}
+			return err
 		}
-
-		fmt.Printf("Added to tar.gz: %s (%d bytes)\n", relPath, len(fileContent))
 		return nil
 	})
-
-	if err != nil {
-		return fmt.Errorf("failed to walk directory: %v", err)
-	}
-
-	return nil
-}
-
-// validateZipFile validates that the zip file is properly formatted
-func (v *TerraformCloudService) validateZipFile(zipPath string) error {
-	reader, err := zip.OpenReader(zipPath)
-	if err != nil {
-		return fmt.Errorf("failed to open zip file for validation: %v", err)
-	}
-	defer reader.Close()
-
-	fileCount := 0
-	for _, file := range reader.File {
-		if !file.FileInfo().IsDir() {
-			fileCount++
-			fmt.Printf("Validated zip entry: %s (%d bytes)\n", file.Name, file.UncompressedSize64)
-		}
-	}
-
-	if fileCount == 0 {
-		return fmt.Errorf("zip file contains no files")
-	}
-
-	fmt.Printf("Zip file validation passed: %d files found\n", fileCount)
-	return nil
-}
-
-// uploadZipFile uploads the zip file to Terraform Cloud
-func (v *TerraformCloudService) uploadZipFile(zipPath string) error {
-	if v.uploadURL == "" {
-		return fmt.Errorf("upload URL not available")
-	}
-
-	// Read the zip file
-	zipData, err := os.ReadFile(zipPath)
 	if err != nil {
-		return fmt.Errorf("failed to read zip file: %v", err)
-	}
-
-	fmt.Printf("Uploading zip file: %d bytes\n", len(zipData))
-
-	// Create request with zip data
-	req, err := http.NewRequest("PUT", v.uploadURL, bytes.NewReader(zipData))
-	if err != nil {
-		return fmt.Errorf("failed to create upload request: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/octet-stream")
-
-	client := &http.Client{Timeout: 120 * time.Second} // Increased timeout for large files
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to upload zip file: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to upload zip file: %s - %s", resp.Status, string(body))
+		return err
 	}
 
-	fmt.Printf("Successfully uploaded zip file to Terraform Cloud\n")
+	fmt.Printf("Successfully uploaded %s to Terraform Cloud\n", kind)
 	return nil
 }
 
-// uploadTarGzFile uploads the tar.gz file to Terraform Cloud
-func (v *TerraformCloudService) uploadTarGzFile(tarGzPath string) error {
-	if v.uploadURL == "" {
-		return fmt.Errorf("upload URL not available")
+// triggerRun triggers a Terraform run in the workspace, one that applies without confirmation when autoApply is set
+func (v *TerraformCloudService) triggerRun(workspaceID, message string, autoApply bool) (string, error) {
+	attributes := map[string]interface{}{
+		"message": message,
 	}
-
-	// Read the tar.gz file
-	tarGzData, err := os.ReadFile(tarGzPath)
-	if err != nil {
-		return fmt.Errorf("failed to read tar.gz file: %v", err)
-	}
-
-	fmt.Printf("Uploading tar.gz file: %d bytes\n", len(tarGzData))
-
-	// Create request with tar.gz data
-	req, err := http.NewRequest("PUT", v.uploadURL, bytes.NewReader(tarGzData))
-	if err != nil {
-		return fmt.Errorf("failed to create upload request: %v", err)
-	}
-
-	req.Header.Set("Content-Type", "application/octet-stream")
-
-	client := &http.Client{Timeout: 120 * time.Second} // Increased timeout for large files
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to upload tar.gz file: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to upload tar.gz file: %s - %s", resp.Status, string(body))
+	if autoApply {
+		attributes["auto-apply"] = true
 	}
-
-	fmt.Printf("Successfully uploaded tar.gz file to Terraform Cloud\n")
-	return nil
-}
-
-// triggerRun triggers a Terraform run in the workspace
-func (v *TerraformCloudService) triggerRun(workspaceID, message string) (string, error) {
 	runData := map[string]interface{}{
 		"data": map[string]interface{}{
-			"type": "runs",
-			"attributes": map[string]interface{}{
-				"message": message,
-			},
+			"type":       "runs",
+			"attributes": attributes,
 			"relationships": map[string]interface{}{
 				"workspace": map[string]interface{}{
 					"data": map[string]interface{}{
@@ -1295,7 +1574,7 @@ func (v *TerraformCloudService) triggerRun(workspaceID, message string) (string,
 	}
 
 	url := fmt.Sprintf("%s/api/v2/runs", v.host)
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(jsonData)))
+	req, err := http.NewRequestWithContext(v.requestContext(), "POST", url, strings.NewReader(string(jsonData)))
 	if err != nil {
 		return "", fmt.Errorf("failed to create run request: %v", err)
 	}
@@ -1303,7 +1582,7 @@ func (v *TerraformCloudService) triggerRun(workspaceID, message string) (string,
 	req.Header.Set("Authorization", "Bearer "+v.apiToken)
 	req.Header.Set("Content-Type", "application/vnd.api+json")
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := v.httpClient(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to make run request: %v", err)
@@ -1341,14 +1620,14 @@ func (v *TerraformCloudService) triggerRun(workspaceID, message string) (string,
 // getRunStatus gets the status of a Terraform run
 func (v *TerraformCloudService) getRunStatus(runID string) (string, error) {
 	url := fmt.Sprintf("%s/api/v2/runs/%s", v.host, runID)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(v.requestContext(), "GET", url, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create status request: %v", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+v.apiToken)
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := v.httpClient(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("failed to make status request: %v", err)
@@ -1387,6 +1666,82 @@ func (v *TerraformCloudService) getRunStatus(runID string) (string, error) {
 	return status, nil
 }
 
+// GetRunLogURLs returns the plan and apply log-read-urls for a run
+func (v *TerraformCloudService) GetRunLogURLs(runID string) (string, string, error) {
+	url := fmt.Sprintf("%s/api/v2/runs/%s?include=plan,apply", v.host, runID)
+	req, err := http.NewRequestWithContext(v.requestContext(), "GET", url, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create run request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+v.apiToken)
+
+	client := v.httpClient(30 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get run: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read run response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("failed to get run: %s - %s", resp.Status, string(body))
+	}
+
+	var response struct {
+		Included []struct {
+			Type       string `json:"type"`
+			Attributes struct {
+				LogReadURL string `json:"log-read-url"`
+			} `json:"attributes"`
+		} `json:"included"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", "", fmt.Errorf("failed to parse run response: %v", err)
+	}
+
+	var planLogURL, applyLogURL string
+	for _, included := range response.Included {
+		switch included.Type {
+		case "plans":
+			planLogURL = included.Attributes.LogReadURL
+		case "applies":
+			applyLogURL = included.Attributes.LogReadURL
+		}
+	}
+
+	return planLogURL, applyLogURL, nil
+}
+
+// StreamTerraformLog copies the log at a TFC log-read-url to the writer, fetching it with doer unless
+// it is nil
+func StreamTerraformLog(logURL string, w io.Writer, doer HTTPDoer) error {
+	// Log URLs are pre-signed and don't require authorization
+	req, err := http.NewRequest(http.MethodGet, logURL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid log URL: %v", err)
+	}
+	resp, err := httpDoerOr(doer, &http.Client{Timeout: 5 * time.Minute}).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch log: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch log: %s", resp.Status)
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to stream log: %v", err)
+	}
+
+	return nil
+}
+
 // UploadCustomConfiguration uploads custom Terraform configuration files to the workspace
 func (v *TerraformCloudService) UploadCustomConfiguration(workspaceID string, configFiles map[string]string) error {
 	return v.uploadConfiguration(workspaceID, configFiles)
@@ -1394,14 +1749,43 @@ func (v *TerraformCloudService) UploadCustomConfiguration(workspaceID string, co
 
 // LoadTerraformConfiguration loads Terraform configuration from the spacewalk directory
 func (v *TerraformCloudService) LoadTerraformConfiguration(ctx *interfaces.SetupContext) (map[string]string, error) {
-	if v.sourceDirectory == "" {
-		return nil, fmt.Errorf("no source directory specified for Terraform configuration. Please configure a source_directory in the service configuration")
+	return v.loadConfiguration(ctx, v.sourceDirectory, v.variables)
+}
+
+// loadConfiguration loads the Terraform configuration in a source directory, templatized with the given
+// variables. With git_url set, the directory is in a clone of the repository, and the commit the
+// configuration came from is recorded in the lab's ServiceData so it can be rendered again from it.
+func (v *TerraformCloudService) loadConfiguration(ctx *interfaces.SetupContext, sourceDirectory string, variables map[string]string) (map[string]string, error) {
+	if v.git != nil {
+		var configFiles map[string]string
+		err := v.git.withCheckout(v.requestContext(), func(dir, commit string) error {
+			configPath, err := v.git.configPath(dir, sourceDirectory)
+			if err != nil {
+				return err
+			}
+			if configFiles, err = readConfiguration(ctx, configPath, variables); err != nil {
+				return err
+			}
+			if ctx.Lab != nil && ctx.Lab.ServiceData != nil && !v.renderOnly {
+				ctx.Lab.ServiceData["terraform_cloud_git_commit"] = commit
+			}
+			return nil
+		})
+		return configFiles, err
+	}
+
+	if sourceDirectory == "" {
+		return nil, fmt.Errorf("no source directory specified for Terraform configuration. Please configure a source_directory or git_url in the service configuration")
 	}
 
 	// Construct the full path to the Terraform configuration
 	// The sourceDirectory is relative to the project root, but we're running from the backend directory
-	configPath := filepath.Join("..", v.sourceDirectory)
+	return readConfiguration(ctx, filepath.Join("..", sourceDirectory), variables)
+}
 
+// readConfiguration reads the .tf files, terraform.tfvars and versions.tf in a directory, templatizing
+// all but versions.tf with the given variables
+func readConfiguration(ctx *interfaces.SetupContext, configPath string, variables map[string]string) (map[string]string, error) {
 	// Check if the directory exists
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("Terraform configuration directory not found: %s", configPath)
@@ -1425,7 +1809,7 @@ func (v *TerraformCloudService) LoadTerraformConfiguration(ctx *interfaces.Setup
 		filename := filepath.Base(tfFile)
 
 		// Templatize the content with lab-specific variables
-		templatizedContent := v.templatizeContent(string(content), ctx)
+		templatizedContent := templatize(string(content), ctx, variables)
 		configFiles[filename] = templatizedContent
 	}
 
@@ -1438,7 +1822,7 @@ func (v *TerraformCloudService) LoadTerraformConfiguration(ctx *interfaces.Setup
 		}
 
 		// Templatize the tfvars content
-		templatizedTfvars := v.templatizeContent(string(content), ctx)
+		templatizedTfvars := templatize(string(content), ctx, variables)
 		configFiles["terraform.tfvars"] = templatizedTfvars
 	}
 
@@ -1457,6 +1841,11 @@ func (v *TerraformCloudService) LoadTerraformConfiguration(ctx *interfaces.Setup
 
 // templatizeContent replaces variables in Terraform configuration with values from service config
 func (v *TerraformCloudService) templatizeContent(content string, ctx *interfaces.SetupContext) string {
+	return templatize(content, ctx, v.variables)
+}
+
+// templatize replaces lab placeholders and the given variables in Terraform configuration
+func templatize(content string, ctx *interfaces.SetupContext, variables map[string]string) string {
 	// Use lab ID directly as it's already the short ID
 	shortID := ctx.LabID
 
@@ -1468,7 +1857,7 @@ func (v *TerraformCloudService) templatizeContent(content string, ctx *interface
 	}
 
 	// Add variables from service configuration
-	for key, value := range v.variables {
+	for key, value := range variables {
 		replacements["${"+key+"}"] = value
 	}
 
@@ -1487,68 +1876,187 @@ func (v *TerraformCloudService) templatizeContent(content string, ctx *interface
 
 // SetWorkspaceVariables sets variables in the Terraform Cloud workspace
 func (v *TerraformCloudService) SetWorkspaceVariables(workspaceID string) error {
-	fmt.Printf("Setting %d regular variables in workspace %s\n", len(v.variables), workspaceID)
+	return v.setVariables(workspaceID, v.variables, v.sensitiveVars)
+}
+
+// setVariables sets the given regular and sensitive variables in a workspace. A variable that can't be
+// set doesn't stop the rest, so one bad call leaves as few variables missing as possible; the error
+// lists every variable that failed.
+func (v *TerraformCloudService) setVariables(workspaceID string, variables, sensitiveVars map[string]string) error {
+	var failed []string
+	var failures []string
+	set := func(key, value string, sensitive bool) {
+		if err := v.setWorkspaceVariable(workspaceID, key, value, sensitive); err != nil {
+			fmt.Printf("Failed to set variable %s in workspace %s: %v\n", key, workspaceID, err)
+			failed = append(failed, key)
+			failures = append(failures, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+
+	fmt.Printf("Setting %d regular variables in workspace %s\n", len(variables), workspaceID)
 
 	// Set regular variables
-	for key, value := range v.variables {
-		fmt.Printf("Setting variable %s = %s\n", key, value)
-		if err := v.setWorkspaceVariable(workspaceID, key, value, false); err != nil {
-			return fmt.Errorf("failed to set variable %s: %v", key, err)
+	for _, key := range slices.Sorted(maps.Keys(variables)) {
+		if v.requestContext().Err() != nil {
+			break
 		}
+		fmt.Printf("Setting variable %s = %s\n", key, loggedVariableValue(key, variables[key]))
+		set(key, variables[key], false)
 	}
 
-	fmt.Printf("Setting %d sensitive variables in workspace %s\n", len(v.sensitiveVars), workspaceID)
+	fmt.Printf("Setting %d sensitive variables in workspace %s\n", len(sensitiveVars), workspaceID)
 
 	// Set sensitive variables
-	for key, value := range v.sensitiveVars {
-		fmt.Printf("Setting sensitive variable %s = [REDACTED]\n", key)
-		if err := v.setWorkspaceVariable(workspaceID, key, value, true); err != nil {
-			return fmt.Errorf("failed to set sensitive variable %s: %v", key, err)
+	for _, key := range slices.Sorted(maps.Keys(sensitiveVars)) {
+		if v.requestContext().Err() != nil {
+			break
 		}
+		fmt.Printf("Setting sensitive variable %s = [REDACTED]\n", key)
+		set(key, sensitiveVars[key], true)
 	}
 
+	if err := v.requestContext().Err(); err != nil {
+		return fmt.Errorf("stopped setting variables in workspace %s: %w", workspaceID, err)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to set %d of %d variables (%s): %s", len(failed), len(variables)+len(sensitiveVars),
+			strings.Join(failed, ", "), strings.Join(failures, "; "))
+	}
 	return nil
 }
 
-// setWorkspaceVariable sets a single variable in the Terraform Cloud workspace
-func (v *TerraformCloudService) setWorkspaceVariable(workspaceID, key, value string, sensitive bool) error {
-	varData := map[string]interface{}{
-		"data": map[string]interface{}{
-			"type": "vars",
-			"attributes": map[string]interface{}{
-				"key":       key,
-				"value":     value,
-				"sensitive": sensitive,
-				"category":  "terraform",
-			},
-		},
+// loggedVariableValue returns how a regular variable's value is written to the log. Values are only shown
+// when they are short and neither their name nor their content suggests they identify a user, host or
+// secret; anything else is redacted down to its length.
+func loggedVariableValue(key, value string) string {
+	if len(value) > maxLoggedVariableLength || ipAddressPattern.MatchString(value) || strings.Contains(value, "@") {
+		return fmt.Sprintf("[REDACTED, %d characters]", len(value))
+	}
+	lowerKey := strings.ToLower(key)
+	for _, part := range sensitiveVariableKeyParts {
+		if strings.Contains(lowerKey, part) {
+			return fmt.Sprintf("[REDACTED, %d characters]", len(value))
+		}
 	}
+	return value
+}
+
+// setWorkspaceVariable sets a single variable in the Terraform Cloud workspace. It updates the variable
+// if the workspace already has it, so re-running a partially failed setup doesn't fail on duplicates,
+// and retries transient failures.
+func (v *TerraformCloudService) setWorkspaceVariable(workspaceID, key, value string, sensitive bool) error {
+	return retryWithBackoff(v.requestContext(), v.retry, fmt.Sprintf("setting variable %s", key), func() error {
+		return v.upsertWorkspaceVariable(workspaceID, key, value, sensitive)
+	})
+}
 
-	jsonData, err := json.Marshal(varData)
+// upsertWorkspaceVariable creates a workspace variable, or updates it when one with the same key exists
+func (v *TerraformCloudService) upsertWorkspaceVariable(workspaceID, key, value string, sensitive bool) error {
+	existingID, err := v.findWorkspaceVariable(workspaceID, key)
 	if err != nil {
-		return fmt.Errorf("failed to marshal variable data: %v", err)
+		return err
+	}
+
+	attributes := map[string]interface{}{
+		"key":       key,
+		"value":     value,
+		"sensitive": sensitive,
+		"category":  "terraform",
+	}
+	data := map[string]interface{}{
+		"type":       "vars",
+		"attributes": attributes,
 	}
 
+	method := "POST"
 	url := fmt.Sprintf("%s/api/v2/workspaces/%s/vars", v.host, workspaceID)
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(jsonData)))
+	expectedStatus := http.StatusCreated
+	if existingID != "" {
+		fmt.Printf("Variable %s already exists in workspace %s, updating it\n", key, workspaceID)
+		method = "PATCH"
+		url = fmt.Sprintf("%s/api/v2/workspaces/%s/vars/%s", v.host, workspaceID, existingID)
+		expectedStatus = http.StatusOK
+		data["id"] = existingID
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{"data": data})
+	if err != nil {
+		return &permanentError{err: fmt.Errorf("failed to marshal variable data: %v", err)}
+	}
+
+	req, err := http.NewRequestWithContext(v.requestContext(), method, url, strings.NewReader(string(jsonData)))
 	if err != nil {
-		return fmt.Errorf("failed to create variable request: %v", err)
+		return &permanentError{err: fmt.Errorf("failed to create variable request: %v", err)}
 	}
 
 	req.Header.Set("Authorization", "Bearer "+v.apiToken)
 	req.Header.Set("Content-Type", "application/vnd.api+json")
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := v.httpClient(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to make variable request: %v", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
+	if resp.StatusCode != expectedStatus {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to set variable %s: %s - %s", key, resp.Status, string(body))
+		err := fmt.Errorf("failed to set variable %s: %s - %s", key, resp.Status, string(body))
+		// A conflict means the variable was created since we looked, so the next attempt updates it
+		if isTransientStatus(resp.StatusCode) || resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusUnprocessableEntity {
+			return err
+		}
+		return &permanentError{err: err}
 	}
 
 	return nil
 }
+
+// findWorkspaceVariable returns the ID of the workspace's Terraform variable with the given key,
+// or an empty string if there is none
+func (v *TerraformCloudService) findWorkspaceVariable(workspaceID, key string) (string, error) {
+	url := fmt.Sprintf("%s/api/v2/workspaces/%s/vars", v.host, workspaceID)
+	req, err := http.NewRequestWithContext(v.requestContext(), "GET", url, nil)
+	if err != nil {
+		return "", &permanentError{err: fmt.Errorf("failed to create variables request: %v", err)}
+	}
+
+	req.Header.Set("Authorization", "Bearer "+v.apiToken)
+	req.Header.Set("Content-Type", "application/vnd.api+json")
+
+	client := v.httpClient(30 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to list workspace variables: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		err := fmt.Errorf("failed to list workspace variables: %s - %s", resp.Status, string(body))
+		if isTransientStatus(resp.StatusCode) {
+			return "", err
+		}
+		return "", &permanentError{err: err}
+	}
+
+	var result struct {
+		Data []struct {
+			ID         string `json:"id"`
+			Attributes struct {
+				Key      string `json:"key"`
+				Category string `json:"category"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode workspace variables: %v", err)
+	}
+
+	for _, variable := range result.Data {
+		if variable.Attributes.Key == key && variable.Attributes.Category == "terraform" {
+			return variable.ID, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,376 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wcrum/labby/internal/interfaces"
+	"github.com/wcrum/labby/internal/models"
+)
+
+// fakeResponse is what the fake Terraform Cloud API answers a request with
+type fakeResponse struct {
+	status int
+	body   string
+}
+
+// fakeTerraformCloud is a Terraform Cloud API that answers requests by method and path, recording them.
+// Requests without a response get a 404.
+type fakeTerraformCloud struct {
+	mu        sync.Mutex
+	responses map[string]fakeResponse
+	requests  []string
+	uploaded  []byte
+}
+
+func (f *fakeTerraformCloud) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route := r.Method + " " + r.URL.Path
+	body, _ := io.ReadAll(r.Body)
+
+	f.mu.Lock()
+	f.requests = append(f.requests, route)
+	if route == "PUT /upload" {
+		f.uploaded = body
+	}
+	response, exists := f.responses[route]
+	f.mu.Unlock()
+
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(response.status)
+	io.WriteString(w, response.body)
+}
+
+// newFakeTerraformCloud starts a fake Terraform Cloud API with the given responses on top of ones for a
+// successful lab setup and cleanup
+func newFakeTerraformCloud(t *testing.T, overrides map[string]fakeResponse) (*fakeTerraformCloud, *httptest.Server) {
+	t.Helper()
+	fake := &fakeTerraformCloud{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	fake.responses = map[string]fakeResponse{
+		"POST /api/v2/organizations/acme/workspaces":          {http.StatusCreated, `{"data":{"id":"ws-1"}}`},
+		"POST /api/v2/workspaces/ws-1/configuration-versions": {http.StatusCreated, fmt.Sprintf(`{"data":{"id":"cv-1","attributes":{"upload-url":"%s/upload"}}}`, server.URL)},
+		"PUT /upload":                                      {http.StatusOK, ""},
+		"GET /api/v2/workspaces/ws-1/vars":                 {http.StatusOK, `{"data":[]}`},
+		"POST /api/v2/workspaces/ws-1/vars":                {http.StatusCreated, `{"data":{"id":"var-1"}}`},
+		"POST /api/v2/runs":                                {http.StatusCreated, `{"data":{"id":"run-1"}}`},
+		"GET /api/v2/workspaces/ws-1":                      {http.StatusOK, `{"data":{"id":"ws-1"}}`},
+		"GET /api/v2/workspaces/ws-1/runs":                 {http.StatusOK, `{"data":[]}`},
+		"POST /api/v2/workspaces/ws-1/actions/safe-delete": {http.StatusNoContent, ""},
+	}
+	for route, response := range overrides {
+		fake.responses[route] = response
+	}
+	return fake, server
+}
+
+// requested reports whether the fake received a request for a route
+func (f *fakeTerraformCloud) requested(route string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Contains(f.requests, route)
+}
+
+// newTestTerraformCloudService returns a service configured against a fake API, loading its configuration
+// from a directory holding a single main.tf
+func newTestTerraformCloudService(t *testing.T, server *httptest.Server) *TerraformCloudService {
+	t.Helper()
+
+	// Source directories are resolved relative to the parent of the working directory
+	configDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(configDir, "main.tf"), []byte(`resource "null_resource" "lab" {}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	parent, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceDirectory, err := filepath.Rel(parent, configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewTerraformCloudService()
+	service.ConfigureFromServiceConfig(map[string]string{
+		"host":                  server.URL,
+		"api_token":             "test-token",
+		"organization":          "acme",
+		"source_directory":      sourceDirectory,
+		"agent_pool_id":         "apool-1",
+		"execution_mode":        "agent",
+		"lab_id":                "${lab_id}",
+		"auth_retry_attempts":   "1",
+		"upload_retry_attempts": "1",
+	}, "abc123")
+	service.SetHTTPDoer(server.Client())
+	return service
+}
+
+func TestTerraformCloudServiceExecuteSetup(t *testing.T) {
+	tests := []struct {
+		name          string
+		responses     map[string]fakeResponse
+		wantErr       string
+		wantRequested []string
+		wantSkipped   []string
+		wantData      map[string]string
+	}{
+		{
+			name: "creates workspace, uploads configuration and triggers run",
+			wantRequested: []string{
+				"POST /api/v2/organizations/acme/workspaces",
+				"POST /api/v2/workspaces/ws-1/configuration-versions",
+				"PUT /upload",
+				"POST /api/v2/workspaces/ws-1/vars",
+				"POST /api/v2/runs",
+			},
+			wantData: map[string]string{"terraform_cloud_workspace_id": "ws-1", "terraform_cloud_run_id": "run-1"},
+		},
+		{
+			name: "workspace creation fails",
+			responses: map[string]fakeResponse{
+				"POST /api/v2/organizations/acme/workspaces": {http.StatusUnprocessableEntity, `{"errors":[{"detail":"Name has already been taken"}]}`},
+			},
+			wantErr:     "failed to create workspace",
+			wantSkipped: []string{"PUT /upload", "POST /api/v2/runs"},
+			wantData:    map[string]string{"terraform_cloud_workspace_id": ""},
+		},
+		{
+			name: "upload fails and the abandoned workspace is deleted",
+			responses: map[string]fakeResponse{
+				"PUT /upload": {http.StatusForbidden, "signature expired"},
+			},
+			wantErr:       "failed to upload",
+			wantRequested: []string{"POST /api/v2/workspaces/ws-1/actions/safe-delete"},
+			wantSkipped:   []string{"POST /api/v2/workspaces/ws-1/vars", "POST /api/v2/runs"},
+			wantData:      map[string]string{"terraform_cloud_workspace_id": ""},
+		},
+		{
+			name: "run trigger fails",
+			responses: map[string]fakeResponse{
+				"POST /api/v2/runs": {http.StatusBadRequest, `{"errors":[{"detail":"invalid run"}]}`},
+			},
+			wantErr:       "failed to trigger run",
+			wantRequested: []string{"PUT /upload", "POST /api/v2/workspaces/ws-1/vars"},
+			wantData:      map[string]string{"terraform_cloud_workspace_id": "ws-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, server := newFakeTerraformCloud(t, tt.responses)
+			service := newTestTerraformCloudService(t, server)
+
+			lab := &models.Lab{ID: "abc123", ServiceData: map[string]string{}}
+			var credentials []*interfaces.Credential
+			err := service.ExecuteSetup(&interfaces.SetupContext{
+				LabID:    "abc123",
+				LabName:  "Test Lab",
+				Duration: 60,
+				Context:  context.Background(),
+				Lab:      lab,
+				AddCredential: func(credential *interfaces.Credential) error {
+					credentials = append(credentials, credential)
+					return nil
+				},
+			})
+
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("ExecuteSetup() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("ExecuteSetup() error = %v, want one containing %q", err, tt.wantErr)
+			}
+			for _, route := range tt.wantRequested {
+				if !fake.requested(route) {
+					t.Errorf("expected request %s, got %v", route, fake.requests)
+				}
+			}
+			for _, route := range tt.wantSkipped {
+				if fake.requested(route) {
+					t.Errorf("unexpected request %s", route)
+				}
+			}
+			for key, want := range tt.wantData {
+				if got := lab.ServiceData[key]; got != want {
+					t.Errorf("ServiceData[%s] = %q, want %q", key, got, want)
+				}
+			}
+			if tt.wantErr == "" {
+				if len(fake.uploaded) == 0 {
+					t.Error("expected a configuration archive to be uploaded")
+				}
+				if len(credentials) != 1 || !strings.Contains(credentials[0].Notes, "ws-1") {
+					t.Errorf("expected a workspace credential, got %v", credentials)
+				}
+			} else if _, exists := lab.ServiceData["terraform_cloud_run_id"]; exists {
+				t.Error("expected no run ID to be recorded")
+			}
+		})
+	}
+}
+
+func TestTerraformCloudServiceExecuteCleanup(t *testing.T) {
+	tests := []struct {
+		name          string
+		responses     map[string]fakeResponse
+		wantErr       string
+		wantRequested []string
+		wantSkipped   []string
+		wantStatuses  map[string]string
+	}{
+		{
+			name: "cancels runs, deletes variables and the workspace",
+			responses: map[string]fakeResponse{
+				"GET /api/v2/workspaces/ws-1/runs":          {http.StatusOK, `{"data":[{"id":"run-1","attributes":{"status":"running"}},{"id":"run-0","attributes":{"status":"applied"}}]}`},
+				"POST /api/v2/runs/run-1/actions/cancel":    {http.StatusOK, ""},
+				"GET /api/v2/workspaces/ws-1/vars":          {http.StatusOK, `{"data":[{"id":"var-1","attributes":{"key":"lab_id","category":"terraform"}}]}`},
+				"DELETE /api/v2/workspaces/ws-1/vars/var-1": {http.StatusNoContent, ""},
+			},
+			wantRequested: []string{
+				"POST /api/v2/runs/run-1/actions/cancel",
+				"DELETE /api/v2/workspaces/ws-1/vars/var-1",
+				"POST /api/v2/workspaces/ws-1/actions/safe-delete",
+			},
+			wantSkipped:  []string{"POST /api/v2/runs/run-0/actions/cancel", "DELETE /api/v2/workspaces/ws-1"},
+			wantStatuses: map[string]string{"workspace ws-1": interfaces.ResourceCleanupSucceeded},
+		},
+		{
+			name: "workspace already gone",
+			responses: map[string]fakeResponse{
+				"GET /api/v2/workspaces/ws-1": {http.StatusNotFound, ""},
+			},
+			wantSkipped:  []string{"POST /api/v2/workspaces/ws-1/actions/safe-delete", "DELETE /api/v2/workspaces/ws-1"},
+			wantStatuses: map[string]string{"workspace ws-1": interfaces.ResourceCleanupSkipped},
+		},
+		{
+			name: "safe delete refused, force delete succeeds",
+			responses: map[string]fakeResponse{
+				"POST /api/v2/workspaces/ws-1/actions/safe-delete": {http.StatusConflict, `{"errors":[{"detail":"workspace is managing resources"}]}`},
+				"DELETE /api/v2/workspaces/ws-1":                   {http.StatusNoContent, ""},
+			},
+			wantRequested: []string{"DELETE /api/v2/workspaces/ws-1"},
+			wantStatuses:  map[string]string{"workspace ws-1": interfaces.ResourceCleanupSucceeded},
+		},
+		{
+			name: "workspace can't be deleted",
+			responses: map[string]fakeResponse{
+				"POST /api/v2/workspaces/ws-1/actions/safe-delete": {http.StatusConflict, ""},
+				"DELETE /api/v2/workspaces/ws-1":                   {http.StatusInternalServerError, ""},
+			},
+			wantErr:      "both safe and force deletion failed",
+			wantStatuses: map[string]string{"workspace ws-1": interfaces.ResourceCleanupFailed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, server := newFakeTerraformCloud(t, tt.responses)
+			service := newTestTerraformCloudService(t, server)
+
+			statuses := make(map[string]string)
+			err := service.ExecuteCleanup(&interfaces.CleanupContext{
+				LabID:   "abc123",
+				Context: context.Background(),
+				Lab:     &models.Lab{ID: "abc123", ServiceData: map[string]string{"terraform_cloud_workspace_id": "ws-1"}},
+				RecordResource: func(result interfaces.ResourceCleanupResult) {
+					statuses[result.Resource] = result.Status
+				},
+			})
+
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("ExecuteCleanup() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("ExecuteCleanup() error = %v, want one containing %q", err, tt.wantErr)
+			}
+			for _, route := range tt.wantRequested {
+				if !fake.requested(route) {
+					t.Errorf("expected request %s, got %v", route, fake.requests)
+				}
+			}
+			for _, route := range tt.wantSkipped {
+				if fake.requested(route) {
+					t.Errorf("unexpected request %s", route)
+				}
+			}
+			for resource, want := range tt.wantStatuses {
+				if got := statuses[resource]; got != want {
+					t.Errorf("status of %s = %q, want %q", resource, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTerraformCloudServiceCleanupReleasesVlanTags(t *testing.T) {
+	_, server := newFakeTerraformCloud(t, nil)
+
+	// Tags allocated for any variable are the lab's, not only vlan_tag's
+	service := NewTerraformCloudService()
+	service.ConfigureFromServiceConfig(map[string]string{
+		"host":          server.URL,
+		"api_token":     "test-token",
+		"organization":  "acme",
+		"vlan_tag":      "${unique_integer(4090,4091)}",
+		"resource_pool": "${unique_integer(4092,4093)}",
+	}, "vlan-lab")
+	service.SetHTTPDoer(server.Client())
+
+	if service.variables["vlan_tag"] != "4090" || service.variables["resource_pool"] != "4092" {
+		t.Fatalf("allocated vlan_tag %q and resource_pool %q", service.variables["vlan_tag"], service.variables["resource_pool"])
+	}
+
+	err := service.ExecuteCleanup(&interfaces.CleanupContext{
+		LabID:   "vlan-lab",
+		Context: context.Background(),
+		Lab:     &models.Lab{ID: "vlan-lab", ServiceData: map[string]string{"terraform_cloud_workspace_id": "ws-1"}},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteCleanup() error = %v", err)
+	}
+
+	for _, usage := range GetVlanTagUsage() {
+		for _, tag := range usage.Tags {
+			if tag.LabID == "vlan-lab" {
+				t.Errorf("VLAN tag %d is still held by the lab", tag.Tag)
+			}
+		}
+	}
+}
+
+func TestStreamTerraformLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/logs/plan" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "Plan: 1 to add, 0 to change, 0 to destroy.")
+	}))
+	defer server.Close()
+
+	var log strings.Builder
+	if err := StreamTerraformLog(server.URL+"/logs/plan", &log, server.Client()); err != nil {
+		t.Fatalf("StreamTerraformLog() error = %v", err)
+	}
+	if !strings.Contains(log.String(), "1 to add") {
+		t.Errorf("StreamTerraformLog() wrote %q", log.String())
+	}
+	if err := StreamTerraformLog(server.URL+"/logs/missing", &log, server.Client()); err == nil {
+		t.Error("expected an error for a missing log")
+	}
+}
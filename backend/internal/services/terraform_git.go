@@ -0,0 +1,252 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultGitRef is fetched when a config sets git_url without git_ref
+	defaultGitRef = "HEAD"
+	// defaultGitCacheTTL is how long a clone of a branch or tag is used before it is fetched again
+	defaultGitCacheTTL = 5 * time.Minute
+	// gitCloneTimeout bounds a single shallow clone
+	gitCloneTimeout = 2 * time.Minute
+	// defaultGitUsername is sent with git_token, as GitHub and most hosts accept for token authentication
+	defaultGitUsername = "x-access-token"
+)
+
+// gitCommitPattern matches full commit SHAs, whose clones never change and are cached for good
+var gitCommitPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// terraformGitSource is a Git repository a Terraform Cloud config loads its configuration from instead
+// of a local source_directory. Source directories are resolved under path inside the repository.
+type terraformGitSource struct {
+	url      string
+	ref      string
+	path     string
+	username string
+	token    string
+	cacheTTL time.Duration
+}
+
+// gitCheckout is a cached shallow clone of one ref of a repository
+type gitCheckout struct {
+	mu        sync.RWMutex // Held for reading while files are loaded, and for writing while the clone is refreshed
+	dir       string
+	commit    string
+	fetchedAt time.Time
+}
+
+// Clones are shared by every lab using the same repository and ref
+var (
+	gitCheckoutsMu sync.Mutex
+	gitCheckouts   = make(map[string]*gitCheckout)
+)
+
+// ValidateTerraformGitSource checks a Terraform Cloud service config's git_* settings
+func ValidateTerraformGitSource(config map[string]string) error {
+	_, err := parseTerraformGitSource(config)
+	return err
+}
+
+// parseTerraformGitSource reads the git_url, git_ref, git_path, git_username, git_token and git_cache_ttl
+// settings of a config. It returns nil when the config loads its configuration from a local directory.
+func parseTerraformGitSource(config map[string]string) (*terraformGitSource, error) {
+	url := strings.TrimSpace(config["git_url"])
+	if url == "" {
+		return nil, nil
+	}
+	if !validGitURL(url) {
+		return nil, fmt.Errorf("invalid git_url %q, use an https://, ssh:// or user@host:path repository URL", url)
+	}
+
+	source := &terraformGitSource{
+		url:      url,
+		ref:      strings.TrimSpace(config["git_ref"]),
+		path:     strings.Trim(strings.TrimSpace(config["git_path"]), "/"),
+		username: strings.TrimSpace(config["git_username"]),
+		token:    strings.TrimSpace(config["git_token"]),
+		cacheTTL: defaultGitCacheTTL,
+	}
+	if source.ref == "" {
+		source.ref = defaultGitRef
+	}
+	if strings.HasPrefix(source.ref, "-") || strings.ContainsAny(source.ref, " \t\n:") {
+		return nil, fmt.Errorf("invalid git_ref %q", source.ref)
+	}
+	if source.path != "" && !filepath.IsLocal(source.path) {
+		return nil, fmt.Errorf("invalid git_path %q, it must be a relative path inside the repository", source.path)
+	}
+	if source.username == "" {
+		source.username = defaultGitUsername
+	}
+	if value := strings.TrimSpace(config["git_cache_ttl"]); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid git_cache_ttl %q", value)
+		}
+		source.cacheTTL = ttl
+	}
+	return source, nil
+}
+
+// validGitURL reports whether a repository URL uses a transport that can't run local commands
+func validGitURL(url string) bool {
+	if strings.HasPrefix(url, "-") {
+		return false
+	}
+	if strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "ssh://") {
+		return true
+	}
+	// scp-like syntax, e.g. git@github.com:org/repo.git
+	user, rest, found := strings.Cut(url, "@")
+	host, path, hasPath := strings.Cut(rest, ":")
+	return found && user != "" && !strings.Contains(user, "/") && host != "" && hasPath && path != ""
+}
+
+// cacheKey identifies the clones of the source's repository and ref
+func (g *terraformGitSource) cacheKey() string {
+	sum := sha256.Sum256([]byte(g.url + "\x00" + g.ref))
+	return hex.EncodeToString(sum[:8])
+}
+
+// configPath returns where a source directory is in a clone, which must stay inside the repository
+func (g *terraformGitSource) configPath(dir, sourceDirectory string) (string, error) {
+	relPath := filepath.Join(g.path, sourceDirectory)
+	if relPath != "." && !filepath.IsLocal(relPath) {
+		return "", fmt.Errorf("Terraform configuration directory %s is outside the repository", relPath)
+	}
+	return filepath.Join(dir, relPath), nil
+}
+
+// withCheckout calls fn with the directory of an up-to-date clone of the source's ref and the commit it
+// is at. Clones are cached by repository and ref; those of a branch or tag are fetched again once they
+// are older than the cache TTL, those of a commit SHA are kept. When fetching again fails, the previous
+// clone is used.
+func (g *terraformGitSource) withCheckout(ctx context.Context, fn func(dir, commit string) error) error {
+	gitCheckoutsMu.Lock()
+	checkout, exists := gitCheckouts[g.cacheKey()]
+	if !exists {
+		checkout = &gitCheckout{}
+		gitCheckouts[g.cacheKey()] = checkout
+	}
+	gitCheckoutsMu.Unlock()
+
+	checkout.mu.RLock()
+	if !checkout.stale(g) {
+		defer checkout.mu.RUnlock()
+		return fn(checkout.dir, checkout.commit)
+	}
+	checkout.mu.RUnlock()
+
+	checkout.mu.Lock()
+	if checkout.stale(g) {
+		if err := checkout.refresh(ctx, g); err != nil {
+			if checkout.dir == "" {
+				checkout.mu.Unlock()
+				return err
+			}
+			// An older clone is better than failing the lab while the repository can't be reached
+			fmt.Printf("Warning: %v, using the clone at commit %s\n", err, checkout.commit)
+		}
+	}
+	checkout.mu.Unlock()
+
+	checkout.mu.RLock()
+	defer checkout.mu.RUnlock()
+	return fn(checkout.dir, checkout.commit)
+}
+
+// stale reports whether a checkout has to be cloned (again). The caller must hold checkout.mu.
+func (c *gitCheckout) stale(g *terraformGitSource) bool {
+	if c.dir == "" {
+		return true
+	}
+	if gitCommitPattern.MatchString(g.ref) {
+		return false
+	}
+	return time.Since(c.fetchedAt) >= g.cacheTTL
+}
+
+// refresh shallow-clones the source's ref into a new directory and replaces the previous clone with it.
+// The caller must hold checkout.mu for writing.
+func (c *gitCheckout) refresh(ctx context.Context, g *terraformGitSource) error {
+	dir, err := os.MkdirTemp("", "labby-terraform-git-"+g.cacheKey()+"-")
+	if err != nil {
+		return fmt.Errorf("failed to create clone directory: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gitCloneTimeout)
+	defer cancel()
+
+	fmt.Printf("Cloning %s at %s for Terraform configuration...\n", g.url, g.ref)
+	// Fetching the ref into an empty repository works for branches, tags and commit SHAs alike
+	steps := [][]string{
+		{"init", "--quiet"},
+		{"remote", "add", "origin", "--", g.url},
+		{"fetch", "--quiet", "--depth", "1", "origin", "--", g.ref},
+		{"checkout", "--quiet", "--detach", "FETCH_HEAD"},
+	}
+	for _, args := range steps {
+		if _, err := g.run(ctx, dir, args...); err != nil {
+			os.RemoveAll(dir)
+			return fmt.Errorf("failed to clone %s at %s: %w", g.url, g.ref, err)
+		}
+	}
+	commit, err := g.run(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("failed to read commit of %s at %s: %w", g.url, g.ref, err)
+	}
+
+	if c.dir != "" {
+		os.RemoveAll(c.dir)
+	}
+	c.dir = dir
+	c.commit = commit
+	c.fetchedAt = time.Now()
+	fmt.Printf("Cloned %s at %s (commit %s)\n", g.url, g.ref, commit)
+	return nil
+}
+
+// run runs a git command in dir without prompting for credentials, returning its trimmed output
+func (g *terraformGitSource) run(ctx context.Context, dir string, args ...string) (string, error) {
+	// Transports that run local commands are never used, whatever the repository's URL
+	gitArgs := []string{"-c", "protocol.ext.allow=never", "-c", "protocol.file.allow=never"}
+	cmd := exec.CommandContext(ctx, "git", append(gitArgs, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if g.token != "" {
+		// Passed through the environment rather than arguments, which other processes can read
+		credentials := base64.StdEncoding.EncodeToString([]byte(g.username + ":" + g.token))
+		cmd.Env = append(cmd.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+credentials,
+		)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if g.token != "" {
+			message = strings.ReplaceAll(message, g.token, "REDACTED")
+		}
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, message)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/wcrum/labby/internal/interfaces"
+	"github.com/wcrum/labby/internal/models"
+)
+
+const (
+	// redactedTerraformValue replaces the values of sensitive variables in rendered configuration
+	redactedTerraformValue = "REDACTED"
+	// workspaceVariablesFile holds a workspace's variables in a rendered configuration, Terraform loads it on its own
+	workspaceVariablesFile = "workspace-variables.auto.tfvars.json"
+)
+
+// ConfigureForRender configures the service like ConfigureFromServiceConfig to render a lab's configuration
+// again. Values generated during the lab's setup are taken from the lab instead of being generated anew:
+// the VLAN tag from its ServiceData and the SSH public key from its SSH key credential. Configurations
+// cloned from Git are rendered from the commit the lab was set up with.
+func (v *TerraformCloudService) ConfigureForRender(config map[string]string, lab *models.Lab) {
+	v.renderOnly = true
+
+	renderConfig := make(map[string]string, len(config))
+	for key, value := range config {
+		renderConfig[key] = value
+	}
+	if vlanTag, exists := lab.ServiceData["terraform_cloud_vlan_tag"]; exists {
+		renderConfig["vlan_tag"] = vlanTag
+	}
+	if commit, exists := lab.ServiceData["terraform_cloud_git_commit"]; exists && renderConfig["git_url"] != "" {
+		renderConfig["git_ref"] = commit
+	}
+
+	v.ConfigureFromServiceConfig(renderConfig, lab.ID)
+	v.SetTemplateVariables(lab.Variables)
+
+	if v.sshKeyVariable != "" {
+		for _, credential := range lab.Credentials {
+			if credential.CredentialType == models.CredentialTypeSSHKey && credential.PublicKey != "" {
+				v.variables[v.sshKeyVariable] = credential.PublicKey
+				break
+			}
+		}
+	}
+}
+
+// RenderConfiguration renders the Terraform configuration uploaded to each of a lab's workspaces again,
+// together with a workspace-variables.auto.tfvars.json file of the variables set in the workspace. Files
+// are keyed by path, in a directory per workspace when the config declares named workspaces. Values of
+// sensitive variables are replaced with REDACTED wherever they appear.
+func (v *TerraformCloudService) RenderConfiguration(ctx *interfaces.SetupContext) (map[string]string, error) {
+	if v.workspacesErr != nil {
+		return nil, fmt.Errorf("invalid workspaces configuration: %w", v.workspacesErr)
+	}
+
+	files := make(map[string]string)
+	for _, workspace := range v.workspaces {
+		sourceDirectory := workspace.sourceDirectory
+		if sourceDirectory == "" {
+			sourceDirectory = v.sourceDirectory
+		}
+		variables := mergedVariables(v.variables, workspace.variables)
+		sensitiveVars := mergedVariables(v.sensitiveVars, workspace.sensitiveVars)
+
+		configFiles, err := v.loadConfiguration(ctx, sourceDirectory, variables)
+		if err != nil {
+			return nil, err
+		}
+
+		dir := ""
+		if workspace.name != "" {
+			dir = workspace.name + "/"
+		}
+		for name, content := range configFiles {
+			files[dir+name] = redactSensitiveValues(content, sensitiveVars)
+		}
+
+		workspaceVariables := make(map[string]string, len(variables)+len(sensitiveVars))
+		for key, value := range variables {
+			workspaceVariables[key] = redactSensitiveValues(value, sensitiveVars)
+		}
+		for key := range sensitiveVars {
+			workspaceVariables[key] = redactedTerraformValue
+		}
+		data, err := json.MarshalIndent(workspaceVariables, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal workspace variables: %v", err)
+		}
+		files[dir+workspaceVariablesFile] = string(data) + "\n"
+	}
+
+	return files, nil
+}
+
+// redactSensitiveValues replaces every value of a sensitive variable in content
+func redactSensitiveValues(content string, sensitiveVars map[string]string) string {
+	for _, value := range sensitiveVars {
+		if value != "" {
+			content = strings.ReplaceAll(content, value, redactedTerraformValue)
+		}
+	}
+	return content
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// workspaceConfigPrefix starts the service config keys of a named workspace, e.g. workspace.network.source_directory
+	workspaceConfigPrefix = "workspace."
+	// terraformRunPollInterval is how often the run of a workspace others depend on is checked
+	terraformRunPollInterval = 10 * time.Second
+)
+
+// workspaceNamePattern matches the names workspaces can be declared with, they become part of the
+// Terraform Cloud workspace name lab-{id}-{name}
+var workspaceNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+(-[A-Za-z0-9_]+)*$`)
+
+// terraformWorkspace is one of the workspaces a lab gets from a Terraform Cloud service config. Configs
+// that don't declare workspaces get a single unnamed one that uses the config's top-level settings.
+type terraformWorkspace struct {
+	name            string
+	sourceDirectory string
+	agentPoolID     string
+	executionMode   string
+	dependsOn       []string
+	variables       map[string]string
+	sensitiveVars   map[string]string
+}
+
+// terraformWorkspaceEntry is a workspace or run ID recorded in a lab's ServiceData under its workspace's name
+type terraformWorkspaceEntry struct {
+	name string
+	id   string
+}
+
+// ValidateTerraformWorkspaces checks the workspaces a Terraform Cloud service config declares: their names
+// and settings, and that their dependencies are declared and don't form a cycle
+func ValidateTerraformWorkspaces(config map[string]string) error {
+	_, err := parseTerraformWorkspaces(config)
+	return err
+}
+
+// parseTerraformWorkspaces reads the workspaces listed in a config's comma-separated workspaces key and
+// their workspace.<name>.* settings, ordered so every workspace comes after the ones it depends on.
+// Without a workspaces key the config describes a single unnamed workspace.
+func parseTerraformWorkspaces(config map[string]string) ([]terraformWorkspace, error) {
+	var workspaces []*terraformWorkspace
+	byName := make(map[string]*terraformWorkspace)
+	for _, name := range strings.Split(config["workspaces"], ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if !workspaceNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid workspace name %q, use letters, digits, - and _", name)
+		}
+		if _, exists := byName[name]; exists {
+			return nil, fmt.Errorf("workspace %s is listed more than once", name)
+		}
+		workspace := &terraformWorkspace{
+			name:          name,
+			variables:     make(map[string]string),
+			sensitiveVars: make(map[string]string),
+		}
+		workspaces = append(workspaces, workspace)
+		byName[name] = workspace
+	}
+
+	for key, value := range config {
+		rest, found := strings.CutPrefix(key, workspaceConfigPrefix)
+		if !found {
+			continue
+		}
+		name, setting, _ := strings.Cut(rest, ".")
+		workspace, declared := byName[name]
+		if !declared {
+			return nil, fmt.Errorf("config %s: workspace %q is not listed in workspaces", key, name)
+		}
+
+		switch {
+		case setting == "source_directory":
+			workspace.sourceDirectory = value
+		case setting == "agent_pool_id":
+			workspace.agentPoolID = value
+		case setting == "execution_mode":
+			workspace.executionMode = value
+		case setting == "depends_on":
+			for _, dependency := range strings.Split(value, ",") {
+				if dependency = strings.TrimSpace(dependency); dependency != "" {
+					workspace.dependsOn = append(workspace.dependsOn, dependency)
+				}
+			}
+		case strings.HasPrefix(setting, "variables."):
+			workspace.variables[strings.TrimPrefix(setting, "variables.")] = value
+		case strings.HasPrefix(setting, "sensitive_variables."):
+			workspace.sensitiveVars[strings.TrimPrefix(setting, "sensitive_variables.")] = value
+		default:
+			return nil, fmt.Errorf("config %s: unknown workspace setting %q", key, setting)
+		}
+	}
+
+	if len(workspaces) == 0 {
+		return []terraformWorkspace{{}}, nil
+	}
+
+	for _, workspace := range workspaces {
+		if workspace.sourceDirectory == "" {
+			return nil, fmt.Errorf("workspace %s has no source_directory", workspace.name)
+		}
+		for _, dependency := range workspace.dependsOn {
+			if _, declared := byName[dependency]; !declared {
+				return nil, fmt.Errorf("workspace %s depends on undeclared workspace %s", workspace.name, dependency)
+			}
+			if dependency == workspace.name {
+				return nil, fmt.Errorf("workspace %s depends on itself", workspace.name)
+			}
+		}
+	}
+
+	// Place workspaces in listed order once everything they depend on is placed
+	ordered := make([]terraformWorkspace, 0, len(workspaces))
+	placed := make(map[string]bool)
+	for len(ordered) < len(workspaces) {
+		progressed := false
+		for _, workspace := range workspaces {
+			if placed[workspace.name] || !allPlaced(workspace.dependsOn, placed) {
+				continue
+			}
+			ordered = append(ordered, *workspace)
+			placed[workspace.name] = true
+			progressed = true
+		}
+		if !progressed {
+			var cyclic []string
+			for _, workspace := range workspaces {
+				if !placed[workspace.name] {
+					cyclic = append(cyclic, workspace.name)
+				}
+			}
+			sort.Strings(cyclic)
+			return nil, fmt.Errorf("workspaces %s depend on each other in a cycle", strings.Join(cyclic, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+// allPlaced reports whether every named workspace is placed
+func allPlaced(names []string, placed map[string]bool) bool {
+	for _, name := range names {
+		if !placed[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// hasDependents reports whether any of the service's workspaces depends on the named one
+func (v *TerraformCloudService) hasDependents(name string) bool {
+	for _, workspace := range v.workspaces {
+		for _, dependency := range workspace.dependsOn {
+			if dependency == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// workspaceName returns the Terraform Cloud name of a lab's workspace
+func workspaceName(labID string, workspace terraformWorkspace) string {
+	if workspace.name == "" {
+		return fmt.Sprintf("lab-%s", labID)
+	}
+	return fmt.Sprintf("lab-%s-%s", labID, workspace.name)
+}
+
+// workspaceLabID returns the lab ID in a workspace name following the lab-{id} or lab-{id}-{name} convention
+func workspaceLabID(name string) (string, bool) {
+	rest, found := strings.CutPrefix(name, "lab-")
+	if !found || rest == "" {
+		return "", false
+	}
+	// Lab IDs contain no dashes, anything after the first is the workspace's name in the service config
+	labID, _, _ := strings.Cut(rest, "-")
+	return labID, true
+}
+
+// mergedVariables returns the service's variables overridden by a workspace's own
+func mergedVariables(shared, own map[string]string) map[string]string {
+	merged := make(map[string]string, len(shared)+len(own))
+	for key, value := range shared {
+		merged[key] = value
+	}
+	for key, value := range own {
+		merged[key] = value
+	}
+	return merged
+}
+
+// parseWorkspaceEntries reads a ServiceData value of comma-separated name=id pairs
+func parseWorkspaceEntries(value string) []terraformWorkspaceEntry {
+	var entries []terraformWorkspaceEntry
+	for _, pair := range strings.Split(value, ",") {
+		name, id, found := strings.Cut(pair, "=")
+		if !found || id == "" {
+			continue
+		}
+		entries = append(entries, terraformWorkspaceEntry{name: name, id: id})
+	}
+	return entries
+}
+
+// appendWorkspaceEntry adds a name=id pair to a ServiceData value
+func appendWorkspaceEntry(value, name, id string) string {
+	if value == "" {
+		return name + "=" + id
+	}
+	return value + "," + name + "=" + id
+}
+
+// removeWorkspaceEntry drops the pair with the given ID from a ServiceData value
+func removeWorkspaceEntry(value, id string) string {
+	var pairs []string
+	for _, entry := range parseWorkspaceEntries(value) {
+		if entry.id != id {
+			pairs = append(pairs, entry.name+"="+entry.id)
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+// waitForRun polls a run until it has applied, so workspaces that depend on its workspace can start.
+// Runs that end without applying fail the wait, as does the setup context ending.
+func (v *TerraformCloudService) waitForRun(runID string) error {
+	for {
+		status, err := v.getRunStatus(runID)
+		if err != nil {
+			return err
+		}
+		switch status {
+		case "applied", "planned_and_finished":
+			return nil
+		case "errored", "canceled", "force_canceled", "discarded", "policy_soft_failed":
+			return fmt.Errorf("run %s ended with status %s", runID, status)
+		}
+
+		select {
+		case <-v.requestContext().Done():
+			return fmt.Errorf("stopped waiting for run %s (status %s): %w", runID, status, v.requestContext().Err())
+		case <-time.After(terraformRunPollInterval):
+		}
+	}
+}
@@ -0,0 +1,497 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wcrum/labby/internal/interfaces"
+)
+
+// VaultService handles issuing and revoking dynamic secrets from HashiCorp Vault
+type VaultService struct {
+	address       string
+	token         string
+	roleID        string
+	secretID      string
+	approleMount  string
+	namespace     string
+	secretPath    string
+	usernameField string
+	passwordField string
+	skipTLSVerify bool
+	// Replaces the real HTTP client, set with SetHTTPDoer
+	httpDoer HTTPDoer
+}
+
+// NewVaultService creates a new Vault service instance
+func NewVaultService() *VaultService {
+	return &VaultService{
+		address:       os.Getenv("VAULT_ADDR"),
+		token:         os.Getenv("VAULT_TOKEN"),
+		roleID:        os.Getenv("VAULT_ROLE_ID"),
+		secretID:      os.Getenv("VAULT_SECRET_ID"),
+		approleMount:  "approle",
+		namespace:     os.Getenv("VAULT_NAMESPACE"),
+		secretPath:    os.Getenv("VAULT_SECRET_PATH"),
+		usernameField: "username",
+		passwordField: "password",
+		skipTLSVerify: os.Getenv("VAULT_SKIP_TLS_VERIFY") == "true",
+	}
+}
+
+// ConfigureFromServiceConfig configures the service from a service configuration
+func (v *VaultService) ConfigureFromServiceConfig(config map[string]string) {
+	if address, ok := config["address"]; ok {
+		v.address = address
+	}
+	if token, ok := config["token"]; ok {
+		v.token = token
+	}
+	if roleID, ok := config["role_id"]; ok {
+		v.roleID = roleID
+	}
+	if secretID, ok := config["secret_id"]; ok {
+		v.secretID = secretID
+	}
+	if approleMount, ok := config["approle_mount"]; ok && approleMount != "" {
+		v.approleMount = approleMount
+	}
+	if namespace, ok := config["namespace"]; ok {
+		v.namespace = namespace
+	}
+	if secretPath, ok := config["secret_path"]; ok {
+		v.secretPath = secretPath
+	}
+	if usernameField, ok := config["username_field"]; ok && usernameField != "" {
+		v.usernameField = usernameField
+	}
+	if passwordField, ok := config["password_field"]; ok && passwordField != "" {
+		v.passwordField = passwordField
+	}
+	if skipTLSVerify, ok := config["skip_tls_verify"]; ok {
+		v.skipTLSVerify = skipTLSVerify == "true"
+	}
+}
+
+// GetName returns the service name
+func (v *VaultService) GetName() string {
+	return "vault"
+}
+
+// GetDescription returns the service description
+func (v *VaultService) GetDescription() string {
+	return "HashiCorp Vault dynamic secrets"
+}
+
+// GetRequiredParams returns the required parameters for this service
+func (v *VaultService) GetRequiredParams() []string {
+	return []string{"VAULT_ADDR", "VAULT_SECRET_PATH"}
+}
+
+// ConfigSchema describes the keys the service's configs accept (implements ConfigSchemaProvider)
+func (v *VaultService) ConfigSchema() []interfaces.ConfigField {
+	return []interfaces.ConfigField{
+		{Key: "address", Description: "Vault address", Required: true, Env: "VAULT_ADDR"},
+		{Key: "token", Description: "Vault token, AppRole login is used when unset", Secret: true, Env: "VAULT_TOKEN"},
+		{Key: "role_id", Description: "AppRole role ID", Env: "VAULT_ROLE_ID"},
+		{Key: "secret_id", Description: "AppRole secret ID", Secret: true, Env: "VAULT_SECRET_ID"},
+		{Key: "approle_mount", Description: "Mount path of the AppRole auth method", Default: "approle"},
+		{Key: "namespace", Description: "Vault Enterprise namespace", Env: "VAULT_NAMESPACE"},
+		{Key: "secret_path", Description: "Path of the secret issued to each lab", Required: true, Env: "VAULT_SECRET_PATH"},
+		{Key: "username_field", Description: "Field of the secret holding the username", Default: "username"},
+		{Key: "password_field", Description: "Field of the secret holding the password", Default: "password"},
+		{Key: "skip_tls_verify", Description: "Skip verifying the Vault certificate (true or false)", Default: "false", Env: "VAULT_SKIP_TLS_VERIFY"},
+	}
+}
+
+// ServiceDataKeys returns the prefixes of the ServiceData keys the service records (implements Service interface)
+func (v *VaultService) ServiceDataKeys() []string {
+	return []string{"vault_"}
+}
+
+// DescribeResources returns the resource names the service derives from the lab ID (implements Service interface)
+func (v *VaultService) DescribeResources(labID string) map[string]string {
+	// Lease IDs are issued by Vault and cannot be constructed from the lab ID
+	return map[string]string{}
+}
+
+// SetHTTPDoer replaces the client the service sends Vault requests with, such as with a fake in tests
+func (v *VaultService) SetHTTPDoer(doer HTTPDoer) {
+	v.httpDoer = doer
+}
+
+// Name returns the service name (implements Setup interface)
+func (v *VaultService) Name() string {
+	return v.GetName()
+}
+
+// VaultClient represents a Vault API client
+type VaultClient struct {
+	baseURL    string
+	namespace  string
+	httpClient HTTPDoer
+	ctx        context.Context // Cancels in-flight requests, e.g. when lab setup times out
+	token      string
+}
+
+// VaultSecretResponse represents a Vault response carrying secret data and lease information
+type VaultSecretResponse struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+}
+
+// NewVaultClient creates a new Vault client, logging in with AppRole when no token is provided
+func NewVaultClient(ctx context.Context, baseURL, namespace, token, approleMount, roleID, secretID string, skipTLSVerify bool, doer HTTPDoer) (*VaultClient, error) {
+	// Create HTTP client with TLS configuration
+	httpClient := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: skipTLSVerify,
+			},
+		},
+	}
+
+	client := &VaultClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		namespace:  namespace,
+		httpClient: httpDoerOr(doer, httpClient),
+		ctx:        ctx,
+		token:      token,
+	}
+
+	if client.token == "" {
+		if roleID == "" || secretID == "" {
+			return nil, fmt.Errorf("either a Vault token or an AppRole role_id and secret_id are required")
+		}
+		if err := client.loginAppRole(approleMount, roleID, secretID); err != nil {
+			return nil, fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	return client, nil
+}
+
+// do performs a request against the Vault API and decodes the response
+func (vc *VaultClient) do(method, path string, payload interface{}) (*VaultSecretResponse, error) {
+	var body io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+
+	reqURL := fmt.Sprintf("%s/v1/%s", vc.baseURL, strings.TrimPrefix(path, "/"))
+	req, err := http.NewRequestWithContext(vc.ctx, method, reqURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if vc.token != "" {
+		req.Header.Set("X-Vault-Token", vc.token)
+	}
+	if vc.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", vc.namespace)
+	}
+
+	resp, err := vc.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("request to %s failed with status: %d, response: %s", path, resp.StatusCode, string(respBody))
+	}
+
+	var result VaultSecretResponse
+	if len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+
+	return &result, nil
+}
+
+// loginAppRole authenticates using the AppRole auth method
+func (vc *VaultClient) loginAppRole(mount, roleID, secretID string) error {
+	fmt.Printf("Authenticating to Vault at %s using AppRole (mount: %s)\n", vc.baseURL, mount)
+
+	result, err := vc.do("POST", fmt.Sprintf("auth/%s/login", mount), map[string]string{
+		"role_id":   roleID,
+		"secret_id": secretID,
+	})
+	if err != nil {
+		return err
+	}
+	if result.Auth == nil || result.Auth.ClientToken == "" {
+		return fmt.Errorf("AppRole login response did not contain a client token")
+	}
+
+	vc.token = result.Auth.ClientToken
+	fmt.Printf("AppRole authentication successful\n")
+
+	return nil
+}
+
+// readSecret reads or generates a secret at the given path
+func (vc *VaultClient) readSecret(path string) (*VaultSecretResponse, error) {
+	fmt.Printf("Reading Vault secret at path: %s\n", path)
+	return vc.do("GET", path, nil)
+}
+
+// revokeLease revokes a lease by ID. A lease Vault no longer knows about has already expired or
+// been revoked, so it is treated as success.
+func (vc *VaultClient) revokeLease(leaseID string) error {
+	fmt.Printf("Revoking Vault lease: %s\n", leaseID)
+	_, err := vc.do("PUT", "sys/leases/revoke", map[string]string{
+		"lease_id": leaseID,
+	})
+	if err != nil && isVaultLeaseNotFound(err) {
+		fmt.Printf("Vault lease %s not found, treating as already revoked\n", leaseID)
+		return nil
+	}
+	return err
+}
+
+// isVaultLeaseNotFound reports whether a revoke failed because Vault has no record of the lease
+func isVaultLeaseNotFound(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "invalid lease") || strings.Contains(message, "lease not found") || strings.Contains(message, "status: 404")
+}
+
+// TestConnection verifies the address and credentials by looking up the token in use
+func (v *VaultService) TestConnection() error {
+	if v.address == "" {
+		return fmt.Errorf("address is required")
+	}
+
+	client, err := NewVaultClient(context.Background(), v.address, v.namespace, v.token, v.approleMount, v.roleID, v.secretID, v.skipTLSVerify, v.httpDoer)
+	if err != nil {
+		return err
+	}
+
+	if _, err := client.do("GET", "auth/token/lookup-self", nil); err != nil {
+		return fmt.Errorf("failed to look up token: %w", err)
+	}
+
+	return nil
+}
+
+// ExecuteSetup issues a dynamic secret from Vault and adds it as a credential
+func (v *VaultService) ExecuteSetup(ctx *interfaces.SetupContext) error {
+	// Update progress: Authenticating to Vault
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Authenticating to Vault", "running", "Authenticating to Vault...")
+	}
+
+	if v.address == "" || v.secretPath == "" {
+		err := fmt.Errorf("VAULT_ADDR and VAULT_SECRET_PATH environment variables are required")
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Authenticating to Vault", "failed", err.Error())
+		}
+		return err
+	}
+
+	// Use lab ID directly as it's already the short ID
+	shortID := ctx.LabID
+
+	fmt.Printf("Issuing Vault secret for lab %s...\n", ctx.LabName)
+
+	// Create Vault client
+	client, err := NewVaultClient(ctx.Context, v.address, v.namespace, v.token, v.approleMount, v.roleID, v.secretID, v.skipTLSVerify, v.httpDoer)
+	if err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Authenticating to Vault", "failed", fmt.Sprintf("Failed to authenticate: %v", err))
+		}
+		return fmt.Errorf("failed to create Vault client: %w", err)
+	}
+
+	// Update progress: Authenticating to Vault completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Authenticating to Vault", "completed", "Successfully authenticated to Vault")
+	}
+
+	// Update progress: Issuing Secret
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Issuing Secret", "running", fmt.Sprintf("Issuing secret from %s...", v.secretPath))
+	}
+
+	secret, err := client.readSecret(v.secretPath)
+	if err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Issuing Secret", "failed", fmt.Sprintf("Failed to issue secret: %v", err))
+		}
+		return fmt.Errorf("failed to issue Vault secret: %w", err)
+	}
+
+	// KV v2 nests the secret under data.data
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+
+	username, _ := data[v.usernameField].(string)
+	secretValue, _ := data[v.passwordField].(string)
+	if secretValue == "" {
+		err := fmt.Errorf("secret at %s does not contain field %q", v.secretPath, v.passwordField)
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Issuing Secret", "failed", err.Error())
+		}
+		// Don't leave an orphaned lease behind
+		if secret.LeaseID != "" {
+			if revokeErr := client.revokeLease(secret.LeaseID); revokeErr != nil {
+				fmt.Printf("Warning: Failed to revoke lease %s: %v\n", secret.LeaseID, revokeErr)
+			}
+		}
+		return err
+	}
+
+	// Reflect the lease TTL in the credential expiry, falling back to the lab duration for static secrets
+	expiresAt := time.Now().Add(time.Duration(ctx.Duration) * time.Minute)
+	if secret.LeaseDuration > 0 {
+		expiresAt = time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second)
+	}
+
+	fmt.Printf("  Secret issued successfully (lease: %s, ttl: %ds)\n", secret.LeaseID, secret.LeaseDuration)
+
+	// Update progress: Issuing Secret completed
+	if ctx.UpdateProgress != nil {
+		ctx.UpdateProgress("Issuing Secret", "completed", "Vault secret issued successfully")
+	}
+
+	// Store lab-specific data in context for cleanup
+	ctx.Context = context.WithValue(ctx.Context, "vault_lease_id", secret.LeaseID)
+
+	// Store in lab's ServiceData for persistence
+	if ctx.Lab != nil {
+		if ctx.Lab.ServiceData == nil {
+			ctx.Lab.ServiceData = make(map[string]string)
+		}
+		ctx.Lab.ServiceData["vault_lease_id"] = secret.LeaseID
+		// Store configuration for cleanup
+		ctx.Lab.ServiceData["vault_address"] = v.address
+		ctx.Lab.ServiceData["vault_namespace"] = v.namespace
+		ctx.Lab.ServiceData["vault_token"] = v.token
+		ctx.Lab.ServiceData["vault_approle_mount"] = v.approleMount
+		ctx.Lab.ServiceData["vault_role_id"] = v.roleID
+		ctx.Lab.ServiceData["vault_secret_id"] = v.secretID
+		ctx.Lab.ServiceData["vault_skip_tls_verify"] = fmt.Sprintf("%t", v.skipTLSVerify)
+	}
+
+	// Add credential to lab
+	credential := &interfaces.Credential{
+		ID:        fmt.Sprintf("vault-%s", shortID),
+		LabID:     ctx.LabID,
+		Label:     "Vault Secret",
+		Username:  username,
+		Password:  secretValue,
+		ExpiresAt: expiresAt,
+		Notes:     fmt.Sprintf("Dynamic secret issued from %s", v.secretPath),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if err := ctx.AddCredential(credential); err != nil {
+		if ctx.UpdateProgress != nil {
+			ctx.UpdateProgress("Issuing Secret", "failed", fmt.Sprintf("Failed to add credential: %v", err))
+		}
+		return fmt.Errorf("failed to add Vault credential: %w", err)
+	}
+
+	fmt.Printf("Vault secret setup completed for lab %s\n", ctx.LabName)
+	return nil
+}
+
+// ExecuteCleanup revokes the lease of the secret issued for the lab
+func (v *VaultService) ExecuteCleanup(ctx *interfaces.CleanupContext) error {
+	// Get configuration from lab's ServiceData
+	var address, namespace, token, approleMount, roleID, secretID, leaseID string
+	skipTLSVerify := v.skipTLSVerify
+
+	if ctx.Lab != nil && ctx.Lab.ServiceData != nil {
+		address = ctx.Lab.ServiceData["vault_address"]
+		namespace = ctx.Lab.ServiceData["vault_namespace"]
+		token = ctx.Lab.ServiceData["vault_token"]
+		approleMount = ctx.Lab.ServiceData["vault_approle_mount"]
+		roleID = ctx.Lab.ServiceData["vault_role_id"]
+		secretID = ctx.Lab.ServiceData["vault_secret_id"]
+		leaseID = ctx.Lab.ServiceData["vault_lease_id"]
+		if skipTLSVerifyStr, exists := ctx.Lab.ServiceData["vault_skip_tls_verify"]; exists {
+			skipTLSVerify = skipTLSVerifyStr == "true"
+		}
+	}
+
+	// Fallback to environment variables if not in ServiceData
+	if address == "" {
+		address = v.address
+	}
+	if namespace == "" {
+		namespace = v.namespace
+	}
+	if token == "" && roleID == "" {
+		token = v.token
+		roleID = v.roleID
+		secretID = v.secretID
+	}
+	if approleMount == "" {
+		approleMount = v.approleMount
+	}
+
+	// Fallback to the lease ID passed in context (e.g. admin cleanup)
+	if leaseID == "" {
+		if contextLeaseID, ok := ctx.Context.Value("vault_lease_id").(string); ok {
+			leaseID = contextLeaseID
+		}
+	}
+
+	if leaseID == "" {
+		fmt.Printf("No Vault lease found for lab %s, nothing to revoke\n", ctx.LabID)
+		ctx.SkipResource("lease", "revoke", "no lease recorded for the lab")
+		return nil
+	}
+
+	if address == "" {
+		return fmt.Errorf("VAULT_ADDR configuration not found in lab data or environment")
+	}
+
+	// Create Vault client for cleanup
+	client, err := NewVaultClient(ctx.Context, address, namespace, token, approleMount, roleID, secretID, skipTLSVerify, v.httpDoer)
+	if err != nil {
+		return fmt.Errorf("failed to create Vault client for cleanup: %w", err)
+	}
+
+	fmt.Printf("Cleaning up Vault secret for lab %s:\n", ctx.LabID)
+
+	err = client.revokeLease(leaseID)
+	ctx.ReportResource("lease "+leaseID, "revoke", err)
+	if err != nil {
+		return fmt.Errorf("failed to revoke lease %s: %w", leaseID, err)
+	}
+	fmt.Printf("  Lease revoked successfully\n")
+
+	fmt.Printf("Vault secret cleanup completed for lab %s\n", ctx.LabID)
+	return nil
+}
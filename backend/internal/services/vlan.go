@@ -0,0 +1,199 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/wcrum/labby/internal/models"
+)
+
+// VLAN tags are handed out from the ranges Terraform Cloud configs give with ${unique_integer(min,max)}.
+// A range is its own cap: when every tag in it is held by a lab, setup fails instead of reusing a tag,
+// since two live labs on the same VLAN see each other's traffic on Proxmox. Every tag a lab holds, for
+// whichever variable, is released when the lab's workspaces are cleaned up. In a real production environment this should be in a database.
+
+// ErrVlanRangeExhausted is returned when every VLAN tag of a range is in use
+var ErrVlanRangeExhausted = errors.New("no VLAN available")
+
+// defaultVlanAlertThreshold is the utilization, in percent, past which a range is reported as running out
+const defaultVlanAlertThreshold = 80
+
+// vlanRange is an inclusive range of VLAN tags
+type vlanRange struct {
+	min, max int
+}
+
+// size returns how many tags the range holds
+func (r vlanRange) size() int {
+	return r.max - r.min + 1
+}
+
+// Global VLAN tag tracking
+var (
+	vlanTagMutex sync.Mutex
+	// Lab holding each tag in use
+	usedVlanTags = make(map[int]string)
+	// Ranges tags have been allocated from, and whether each is past the alert threshold
+	vlanRanges         = make(map[vlanRange]bool)
+	vlanAlertThreshold = vlanAlertThresholdFromEnv()
+)
+
+// vlanAlertThresholdFromEnv reads VLAN_ALERT_THRESHOLD, the range utilization in percent that triggers an alert
+func vlanAlertThresholdFromEnv() int {
+	value := os.Getenv("VLAN_ALERT_THRESHOLD")
+	if value == "" {
+		return defaultVlanAlertThreshold
+	}
+	threshold, err := strconv.Atoi(value)
+	if err != nil || threshold <= 0 || threshold > 100 {
+		fmt.Printf("Warning: invalid VLAN_ALERT_THRESHOLD %q, using %d\n", value, defaultVlanAlertThreshold)
+		return defaultVlanAlertThreshold
+	}
+	return threshold
+}
+
+// allocateVlanTag hands the lowest free tag of a range to a lab. It returns ErrVlanRangeExhausted when
+// every tag of the range is in use.
+func allocateVlanTag(min, max int, labID string) (int, error) {
+	if min > max {
+		return 0, fmt.Errorf("invalid VLAN range %d-%d", min, max)
+	}
+	r := vlanRange{min: min, max: max}
+
+	vlanTagMutex.Lock()
+	defer vlanTagMutex.Unlock()
+
+	if _, exists := vlanRanges[r]; !exists {
+		vlanRanges[r] = false
+	}
+
+	for vlanTag := min; vlanTag <= max; vlanTag++ {
+		if _, used := usedVlanTags[vlanTag]; !used {
+			usedVlanTags[vlanTag] = labID
+			fmt.Printf("Allocated VLAN tag %d to lab %s (range: %d-%d)\n", vlanTag, labID, min, max)
+			checkVlanUtilizationLocked(r)
+			return vlanTag, nil
+		}
+	}
+
+	checkVlanUtilizationLocked(r)
+	fmt.Printf("ALERT: VLAN range %d-%d is exhausted, lab %s can't be given a VLAN tag\n", min, max, labID)
+	return 0, fmt.Errorf("%w: all %d VLAN tags in range %d-%d are in use", ErrVlanRangeExhausted, r.size(), min, max)
+}
+
+// checkVlanUtilizationLocked logs an alert when a range's utilization crosses the alert threshold, and
+// again once it has dropped back below it. The caller must hold vlanTagMutex.
+func checkVlanUtilizationLocked(r vlanRange) {
+	inUse := vlanTagsInUseLocked(r)
+	alerting := inUse*100 >= r.size()*vlanAlertThreshold
+	if alerting == vlanRanges[r] {
+		return
+	}
+	vlanRanges[r] = alerting
+	if alerting {
+		fmt.Printf("ALERT: VLAN range %d-%d is %d%% used (%d of %d tags), past the %d%% threshold\n",
+			r.min, r.max, inUse*100/r.size(), inUse, r.size(), vlanAlertThreshold)
+	} else {
+		fmt.Printf("VLAN range %d-%d is back below the %d%% threshold (%d of %d tags used)\n",
+			r.min, r.max, vlanAlertThreshold, inUse, r.size())
+	}
+}
+
+// vlanTagsInUseLocked counts the tags of a range in use. The caller must hold vlanTagMutex.
+func vlanTagsInUseLocked(r vlanRange) int {
+	inUse := 0
+	for vlanTag := range usedVlanTags {
+		if vlanTag >= r.min && vlanTag <= r.max {
+			inUse++
+		}
+	}
+	return inUse
+}
+
+// ReleaseVlanTag releases a VLAN tag back to the pool
+func ReleaseVlanTag(vlanTag string) {
+	vlanTagInt, err := strconv.Atoi(vlanTag)
+	if err != nil {
+		return
+	}
+
+	vlanTagMutex.Lock()
+	defer vlanTagMutex.Unlock()
+
+	if _, used := usedVlanTags[vlanTagInt]; !used {
+		return
+	}
+	delete(usedVlanTags, vlanTagInt)
+	fmt.Printf("Released VLAN tag: %s\n", vlanTag)
+
+	for r := range vlanRanges {
+		if vlanTagInt >= r.min && vlanTagInt <= r.max {
+			checkVlanUtilizationLocked(r)
+		}
+	}
+}
+
+// ReleaseLabVlanTags releases every VLAN tag held by a lab, returning the tags released
+func ReleaseLabVlanTags(labID string) []int {
+	vlanTagMutex.Lock()
+	defer vlanTagMutex.Unlock()
+
+	var released []int
+	for vlanTag, holder := range usedVlanTags {
+		if holder == labID {
+			delete(usedVlanTags, vlanTag)
+			released = append(released, vlanTag)
+		}
+	}
+	if len(released) == 0 {
+		return nil
+	}
+	sort.Ints(released)
+	fmt.Printf("Released VLAN tags %v of lab %s\n", released, labID)
+
+	for r := range vlanRanges {
+		checkVlanUtilizationLocked(r)
+	}
+	return released
+}
+
+// GetVlanTagUsage returns the utilization of every range VLAN tags have been allocated from, with the
+// lab holding each tag in use
+func GetVlanTagUsage() []models.VlanRangeUsage {
+	vlanTagMutex.Lock()
+	defer vlanTagMutex.Unlock()
+
+	usage := make([]models.VlanRangeUsage, 0, len(vlanRanges))
+	for r, alerting := range vlanRanges {
+		rangeUsage := models.VlanRangeUsage{
+			Min:            r.min,
+			Max:            r.max,
+			Size:           r.size(),
+			AlertThreshold: vlanAlertThreshold,
+			Alert:          alerting,
+			Tags:           []models.VlanTagAllocation{},
+		}
+		for vlanTag, labID := range usedVlanTags {
+			if vlanTag >= r.min && vlanTag <= r.max {
+				rangeUsage.Tags = append(rangeUsage.Tags, models.VlanTagAllocation{Tag: vlanTag, LabID: labID})
+			}
+		}
+		sort.Slice(rangeUsage.Tags, func(i, j int) bool { return rangeUsage.Tags[i].Tag < rangeUsage.Tags[j].Tag })
+		rangeUsage.InUse = len(rangeUsage.Tags)
+		rangeUsage.Available = rangeUsage.Size - rangeUsage.InUse
+		rangeUsage.UtilizationPercent = float64(rangeUsage.InUse) * 100 / float64(rangeUsage.Size)
+		usage = append(usage, rangeUsage)
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Min != usage[j].Min {
+			return usage[i].Min < usage[j].Min
+		}
+		return usage[i].Max < usage[j].Max
+	})
+	return usage
+}
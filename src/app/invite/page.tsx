@@ -17,6 +17,7 @@ interface Invite {
   invited_by: string;
   role: string;
   status: string;
+  lab_template_id?: string;
   expires_at: string;
   created_at: string;
   accepted_at?: string;
@@ -42,6 +43,8 @@ function InvitePageContent() {
   const [error, setError] = useState<string | null>(null);
   const [accepting, setAccepting] = useState(false);
   const [accepted, setAccepted] = useState(false);
+  const [labId, setLabId] = useState<string | null>(null);
+  const [labError, setLabError] = useState<string | null>(null);
 
   const fetchInvite = useCallback(async () => {
     if (!inviteCode) {
@@ -103,6 +106,12 @@ function InvitePageContent() {
       }
 
       const result = await response.json();
+      if (result.lab_id) {
+        setLabId(result.lab_id);
+      }
+      if (result.lab_error) {
+        setLabError(result.lab_error.message);
+      }
 
       setAccepted(true);
       
@@ -192,9 +201,20 @@ function InvitePageContent() {
               <p className="text-green-700">
                 You have successfully joined {organization?.name || 'the organization'}!
               </p>
-              <Button onClick={() => window.location.href = '/'}>
-                Go to Dashboard
-              </Button>
+              {labError && (
+                <p className="text-amber-700">
+                  Your lab could not be created: {labError}
+                </p>
+              )}
+              {labId ? (
+                <Button onClick={() => window.location.href = `/lab?id=${labId}`}>
+                  Go to Your Lab
+                </Button>
+              ) : (
+                <Button onClick={() => window.location.href = '/'}>
+                  Go to Dashboard
+                </Button>
+              )}
             </CardContent>
           </Card>
         </div>
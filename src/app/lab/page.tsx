@@ -53,6 +53,27 @@ function LabSessionPageContent() {
     autoFetch: !!labId 
   });
 
+  // Keep a ready lab from expiring as idle while its page is open and visible
+  const labStatus = lab?.status;
+  useEffect(() => {
+    if (!labId || labStatus !== 'ready') return;
+
+    const sendHeartbeat = () => {
+      if (document.visibilityState !== 'visible') return;
+      apiService.heartbeatLab(labId).catch((err) => {
+        console.error('Failed to send lab heartbeat:', err);
+      });
+    };
+
+    sendHeartbeat();
+    const interval = setInterval(sendHeartbeat, 60000);
+    document.addEventListener('visibilitychange', sendHeartbeat);
+    return () => {
+      clearInterval(interval);
+      document.removeEventListener('visibilitychange', sendHeartbeat);
+    };
+  }, [labId, labStatus]);
+
   const totalMs = lab?.startedAt && lab?.endsAt ? Math.max(0, new Date(lab.endsAt).getTime() - new Date(lab.startedAt).getTime()) : undefined;
   const overallCountdown = useCountdown(lab?.endsAt, totalMs);
   const progressValue = Math.min(100, Math.max(0, 100 - overallCountdown.pct));
@@ -116,7 +137,7 @@ function LabSessionPageContent() {
   }
 
   // Show starting view if lab is in starting status
-  if (lab.status === "starting" || lab.status === "provisioning") {
+  if (lab.status === "starting" || lab.status === "provisioning" || lab.status === "queued") {
     return (
       <AppLayout>
         <LabStartingView labId={labId} onLabReady={handleLabReady} />
@@ -153,7 +174,7 @@ function LabSessionPageContent() {
           <Progress value={progressValue} className="h-2" />
         </motion.div>
 
-        <LabCredentials credentials={lab.credentials} />
+        <LabCredentials labId={lab.id} credentials={lab.credentials} />
 
         <Separator />
 
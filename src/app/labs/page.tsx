@@ -127,7 +127,7 @@ export default function LabsPage() {
                     <CardDescription>{template.description}</CardDescription>
                   </div>
                   <Badge variant="outline" className="text-xs">
-                    {formatDuration(template.expiration_duration)}
+                    {formatDuration(template.default_duration_minutes ? `${template.default_duration_minutes / 60}h` : template.expiration_duration)}
                   </Badge>
                 </div>
               </CardHeader>
@@ -1,7 +1,7 @@
 "use client";
 
 import React, { useEffect, useState } from "react";
-import { apiService, LabResponse } from "@/lib/api";
+import { apiService, ApiError, LabResponse } from "@/lib/api";
 
 import { LabSessionContent } from "./LabSessionContent";
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from "@/components/ui/card";
@@ -23,7 +23,7 @@ export function LabManager() {
       console.error("Failed to fetch labs:", err);
       
       // Check if it's an authentication error
-      if (err instanceof Error && err.message && err.message.includes("Invalid token")) {
+      if (err instanceof ApiError && err.code === "INVALID_TOKEN") {
         setError("Authentication failed. Please log in again.");
         // Redirect to login or clear auth state
         apiService.clearToken();
@@ -64,7 +64,7 @@ export function LabSessionContent({ labId }: { labId: string }) {
   }
 
   // Show starting view if lab is in starting status
-  if (lab.status === "starting" || lab.status === "provisioning") {
+  if (lab.status === "starting" || lab.status === "provisioning" || lab.status === "queued") {
     return <LabStartingView labId={labId} onLabReady={handleLabReady} />;
   }
 
@@ -82,7 +82,7 @@ export function LabSessionContent({ labId }: { labId: string }) {
         <Progress value={progressValue} className="h-2" />
       </motion.div>
 
-      <LabCredentials credentials={lab.credentials} />
+      <LabCredentials labId={lab.id} credentials={lab.credentials} />
 
       <Separator />
 
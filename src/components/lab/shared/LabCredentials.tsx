@@ -1,23 +1,83 @@
 // Shared lab credentials display component
 
-import React from "react";
+import React, { useState } from "react";
 import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
 import { Button } from "@/components/ui/button";
 import { Label } from "@/components/ui/label";
 import { PasswordToggleFieldWithCopy } from "@/components/ui/password-toggle-field";
 import { InputWithCopy } from "@/components/ui/input-with-copy";
-import { ShieldCheck, ExternalLink, Info } from "lucide-react";
+import { ShieldCheck, ExternalLink, Info, AlertTriangle, Download, Eye } from "lucide-react";
 import { Credential } from "@/types/lab";
+import { apiService } from "@/lib/api";
+
+// Save an SSH private key as a file the user can pass to ssh -i
+function downloadPrivateKey(cred: Credential, privateKey?: string) {
+  const blob = new Blob([privateKey ?? ""], { type: "application/x-pem-file" });
+  const url = URL.createObjectURL(blob);
+  const link = document.createElement("a");
+  link.href = url;
+  link.download = `${cred.label.replace(/[^A-Za-z0-9_-]+/g, "-").toLowerCase()}.pem`;
+  link.click();
+  URL.revokeObjectURL(url);
+}
 
 interface LabCredentialsProps {
+  labId: string;
   credentials: Credential[];
 }
 
-export function LabCredentials({ credentials }: LabCredentialsProps) {
+type RevealedSecret = { password?: string; privateKey?: string };
+
+export function LabCredentials({ labId, credentials }: LabCredentialsProps) {
+  // Secrets of one-time reveal credentials, kept only for as long as the page is open
+  const [revealed, setRevealed] = useState<Record<string, RevealedSecret>>({});
+  const [revealing, setRevealing] = useState<string | null>(null);
+  const [revealError, setRevealError] = useState<Record<string, string>>({});
+
+  const handleReveal = async (cred: Credential) => {
+    setRevealing(cred.id);
+    try {
+      const secret = await apiService.revealLabCredential(labId, cred.id);
+      setRevealed((prev) => ({ ...prev, [cred.id]: { password: secret.password, privateKey: secret.private_key } }));
+      setRevealError((prev) => {
+        const next = { ...prev };
+        delete next[cred.id];
+        return next;
+      });
+    } catch (error) {
+      setRevealError((prev) => ({ ...prev, [cred.id]: error instanceof Error ? error.message : "Failed to reveal credential" }));
+    } finally {
+      setRevealing(null);
+    }
+  };
+
   if (credentials.length === 0) {
     return null;
   }
 
+  // A one-time reveal credential's secret stays hidden until it is revealed on this page
+  const renderSecret = (cred: Credential, label: string, field: (secret: RevealedSecret) => React.ReactNode) => {
+    const secret = revealed[cred.id] ?? (cred.oneTimeReveal ? undefined : { password: cred.password, privateKey: cred.privateKey });
+    return (
+      <div className="grid grid-cols-3 items-center gap-2">
+        <Label className="col-span-1">{label}</Label>
+        <div className="col-span-2">
+          {secret ? (
+            field(secret)
+          ) : cred.revealedAt ? (
+            <span className="text-sm text-muted-foreground">
+              Revealed {new Date(cred.revealedAt).toLocaleString()}, it can&apos;t be shown again
+            </span>
+          ) : (
+            <Button variant="outline" size="sm" className="gap-2" disabled={revealing === cred.id} onClick={() => handleReveal(cred)}>
+              <Eye className="h-4 w-4" /> {revealing === cred.id ? "Revealing..." : "Reveal once"}
+            </Button>
+          )}
+        </div>
+      </div>
+    );
+  };
+
   return (
     <section className="grid grid-cols-1 md:grid-cols-2 gap-6">
       {credentials.map((cred) => (
@@ -50,20 +110,52 @@ export function LabCredentials({ credentials }: LabCredentialsProps) {
                     />
                   </div>
                 </div>
-                <div className="grid grid-cols-3 items-center gap-2">
-                  <Label className="col-span-1">Password</Label>
-                  <div className="col-span-2">
+                {cred.credentialType === "ssh_key" ? (
+                  <>
+                    <div className="grid grid-cols-3 items-center gap-2">
+                      <Label className="col-span-1">Public Key</Label>
+                      <div className="col-span-2">
+                        <InputWithCopy
+                          value={cred.publicKey ?? ""}
+                          placeholder="Public key"
+                          className="w-full font-mono"
+                        />
+                      </div>
+                    </div>
+                    {renderSecret(cred, "Private Key", (secret) => (
+                      <Button variant="outline" size="sm" className="gap-2" onClick={() => downloadPrivateKey(cred, secret.privateKey)}>
+                        <Download className="h-4 w-4" /> Download
+                      </Button>
+                    ))}
+                  </>
+                ) : (
+                  renderSecret(cred, "Password", (secret) => (
                     <PasswordToggleFieldWithCopy 
-                      value={cred.password} 
+                      value={secret.password ?? ""} 
                       placeholder="Password"
                       className="w-full"
                     />
-                  </div>
-                </div>
+                  ))
+                )}
+              </div>
+            {cred.oneTimeReveal && revealed[cred.id] && (
+              <div className="text-xs text-amber-600 flex items-center gap-2">
+                <AlertTriangle className="h-4 w-4" /> Save this secret now, it won&apos;t be shown again
+              </div>
+            )}
+            {revealError[cred.id] && (
+              <div className="text-xs text-destructive flex items-center gap-2">
+                <AlertTriangle className="h-4 w-4" /> {revealError[cred.id]}
               </div>
+            )}
             <div className="text-xs text-muted-foreground flex items-center gap-2">
               <Info className="h-4 w-4" /> Expires at {new Date(cred.expiresAt).toLocaleString()}
             </div>
+            {cred.expiresBeforeLab && (
+              <div className="text-xs text-amber-600 flex items-center gap-2">
+                <AlertTriangle className="h-4 w-4" /> This credential expires before the lab ends
+              </div>
+            )}
             {cred.notes && (
               <div className="text-sm text-muted-foreground">
                 {cred.notes}
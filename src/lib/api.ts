@@ -22,6 +22,21 @@ export interface UserWithOrganization {
   organization?: Organization;
   created_at: string;
   updated_at: string;
+  last_login_at?: string;
+}
+
+export interface InactiveUsers {
+  days: number;
+  cutoff: string;
+  users: UserWithOrganization[];
+  total: number;
+}
+
+export interface UserPage {
+  users: UserWithOrganization[];
+  total: number;
+  page: number;
+  page_size: number;
 }
 
 export interface Credential {
@@ -35,29 +50,90 @@ export interface Credential {
   notes?: string;
   created_at: string;
   updated_at: string;
+  service_id?: string;
+  expires_before_lab?: boolean;
+  credential_type?: 'password' | 'ssh_key';
+  public_key?: string;
+  private_key?: string;
+  one_time_reveal?: boolean; // Secrets are masked; reveal them once with revealLabCredential
+  revealed_at?: string;
+  revealed_by?: string;
+}
+
+export interface RevealedCredential {
+  id: string;
+  label: string;
+  username: string;
+  password?: string;
+  private_key?: string;
+  url?: string;
+  revealed_at?: string;
+  revealed_by?: string;
 }
 
 export interface Lab {
   id: string;
   name: string;
-  status: 'provisioning' | 'ready' | 'error' | 'expired';
+  status: 'provisioning' | 'queued' | 'ready' | 'stopped' | 'error' | 'expired';
   owner_id: string;
   started_at: string;
   ends_at: string;
   created_at: string;
   updated_at: string;
   credentials: Credential[];
+  tags?: string[];
+}
+
+export interface LabNotification {
+  email?: boolean;
+  webhook_url?: string;
 }
 
 export interface LabResponse {
   id: string;
   name: string;
-  status: 'provisioning' | 'ready' | 'error' | 'expired';
+  status: 'provisioning' | 'queued' | 'ready' | 'stopped' | 'error' | 'expired';
   owner: User;
   started_at: string;
   ends_at: string;
-  credentials: Credential[];
+  credentials?: Credential[]; // Only present when requested with include=credentials
+  credentials_count: number;
+  credentials_url: string;
   used_services?: ServiceTemplate[];
+  resources?: Record<string, string>;
+  tags?: string[];
+  last_activity_at?: string;
+  idle_expires_at?: string; // Present when the idle timeout would end the lab before ends_at
+}
+
+export interface LabActivity {
+  last_activity_at?: string;
+  idle_expires_at?: string;
+  ends_at: string;
+}
+
+export interface ServiceConfigField {
+  key: string;
+  description: string;
+  required?: boolean;
+  secret?: boolean;
+  default?: string;
+  env?: string;
+}
+
+export interface ServiceTypeDescription {
+  type: string;
+  name: string;
+  description: string;
+  required_params: string[];
+  config_schema: ServiceConfigField[];
+}
+
+export interface CredentialPage {
+  credentials: Credential[];
+  total: number;
+  limit: number;
+  offset: number;
 }
 
 export interface LoginRequest {
@@ -74,6 +150,7 @@ export interface CreateLabRequest {
   name?: string; // Optional since backend will generate UUID
   owner_id: string;
   duration: number;
+  tags?: string[];
 }
 
 export interface ServiceTemplate {
@@ -82,19 +159,33 @@ export interface ServiceTemplate {
   description: string;
   service_id: string; // Required for enriched services
   logo?: string; // Optional since it's enriched from ServiceConfig
-  config?: Record<string, string>; // Optional for backward compatibility
 }
 
 export interface LabTemplate {
   name: string;
   id: string;
   description: string;
+  category?: string;
+  tags?: string[];
   expiration_duration: string;
+  default_duration_minutes?: number;
+  max_duration_minutes?: number;
   owner: string;
   created_at: string;
   services: ServiceTemplate[];
 }
 
+export interface TemplateFilter {
+  category?: string;
+  tag?: string;
+  q?: string;
+}
+
+export interface TemplateFacets {
+  categories: string[];
+  tags: string[];
+}
+
 export interface ServiceConfig {
   id: string;
   name: string;
@@ -102,6 +193,10 @@ export interface ServiceConfig {
   description: string;
   config: Record<string, string>;
   is_active: boolean;
+  cost_per_hour?: number;
+  organization_id?: string;
+  overrides?: string;
+  version: number;
   created_at: string;
   updated_at: string;
 }
@@ -112,10 +207,22 @@ export interface ServiceLimit {
   max_labs: number;
   max_duration: number;
   is_active: boolean;
+  version: number;
   created_at: string;
   updated_at: string;
 }
 
+export interface ServiceConfigReload {
+  configs: number;
+  limits: number;
+  added_configs: string[];
+  removed_configs: string[];
+  changed_configs: string[];
+  added_limits: string[];
+  removed_limits: string[];
+  changed_limits: string[];
+}
+
 export interface ServiceUsage {
   service_id: string;
   active_labs: number;
@@ -127,10 +234,19 @@ export interface Organization {
   name: string;
   description: string;
   domain: string;
+  auto_join_by_domain: boolean;
   created_at: string;
   updated_at: string;
 }
 
+export interface ResourceCleanupResult {
+  service?: string;
+  resource: string;
+  action: string;
+  status: 'succeeded' | 'failed' | 'skipped';
+  error?: string;
+}
+
 export interface Invite {
   id: string;
   organization_id: string;
@@ -138,11 +254,162 @@ export interface Invite {
   invited_by: string;
   role: string;
   status: string;
+  usage_limit: number;
+  usage_count: number;
+  lab_template_id?: string;
   expires_at: string;
   created_at: string;
   accepted_at?: string;
 }
 
+export interface RenewInviteResponse {
+  invite: Invite;
+  email_sent: boolean;
+  email_error?: { code: string; message: string };
+}
+
+export interface LabFailure {
+  service?: string;
+  step?: string;
+  message: string;
+  failed_at: string;
+  logs: string[];
+}
+
+export interface StepTiming {
+  service: string;
+  step: string;
+  status: string;
+  started_at: string;
+  completed_at: string;
+  duration_ms: number;
+}
+
+export interface LabDiagnostics {
+  lab_id: string;
+  status: string;
+  current_step?: string;
+  failure?: LabFailure;
+  step_timings?: StepTiming[];
+  logs: string[];
+}
+
+export interface LabTimelineEvent {
+  sequence: number;
+  type: 'created' | 'status_changed' | 'failed' | 'deleted' | 'log';
+  message?: string;
+  status?: string;
+  previous_status?: string;
+  timestamp: string;
+}
+
+export interface LabTimeline {
+  lab_id: string;
+  owner_id: string;
+  events: LabTimelineEvent[];
+}
+
+export interface LabSummary {
+  id: string;
+  name: string;
+  owner_id: string;
+  template_id?: string;
+  status: string;
+  started_at: string;
+  ends_at: string;
+  updated_at: string;
+}
+
+export interface LabEvent {
+  type: 'snapshot' | 'lab_created' | 'lab_status_changed' | 'lab_deleted' | 'lab_expiring' | 'keepalive';
+  lab?: LabSummary;
+  previous_status?: string;
+  expires_in?: number;
+  labs?: LabSummary[];
+  timestamp: string;
+}
+
+export interface ServiceCleanupState {
+  service_id: string;
+  service: string;
+  status: 'completed' | 'failed';
+  error?: string;
+  attempts: number;
+  updated_at: string;
+}
+
+export interface LabCleanupState {
+  lab_id: string;
+  success?: boolean;
+  services: Record<string, ServiceCleanupState>;
+  failed_services: string[] | null;
+}
+
+export interface LabRegistrationToken {
+  uid: string;
+  name: string;
+  project_uid?: string;
+  expires_at?: string;
+  recorded: boolean;
+  service_id: string;
+  service_name: string;
+}
+
+export type TokenScope = 'read-lab' | 'create-lab' | 'delete-lab';
+
+export interface PersonalAccessToken {
+  id: string;
+  user_id: string;
+  name: string;
+  prefix: string;
+  scopes: TokenScope[];
+  expires_at?: string;
+  last_used_at?: string;
+  created_at: string;
+}
+
+export interface CreatedPersonalAccessToken extends PersonalAccessToken {
+  token: string;
+}
+
+export interface LabCostEstimate {
+  lab_id: string;
+  cost_per_hour: number;
+  elapsed_hours: number;
+  total_hours: number;
+  cost_to_date: number;
+  estimated_cost: number;
+  services: Array<{
+    service_id: string;
+    name: string;
+    cost_per_hour: number;
+    cost_to_date: number;
+    estimated_cost: number;
+  }>;
+  calculated_at: string;
+}
+
+export interface LabShare {
+  lab_id: string;
+  user_id: string;
+  access_level: 'observer';
+  shared_by: string;
+  created_at: string;
+}
+
+// Error returned by the API, with a stable code to match on and details about the failure
+export class ApiError extends Error {
+  constructor(
+    message: string,
+    public status: number,
+    public code: string,
+    public details?: Record<string, unknown>
+  ) {
+    super(message);
+    this.name = 'ApiError';
+  }
+}
+
 class ApiService {
   private token: string | null = null;
 
@@ -188,7 +455,13 @@ class ApiService {
       
       if (!response.ok) {
         const errorData = await response.json().catch(() => ({}));
-        throw new Error(errorData.error || `HTTP error! status: ${response.status}`);
+        const apiError = errorData.error ?? {};
+        throw new ApiError(
+          apiError.message || `HTTP error! status: ${response.status}`,
+          response.status,
+          apiError.code || 'UNKNOWN_ERROR',
+          apiError.details
+        );
       }
 
       // Handle 204 No Content responses (common for DELETE operations)
@@ -219,6 +492,24 @@ class ApiService {
     return response;
   }
 
+  // Personal access tokens
+  async getAccessTokens(): Promise<PersonalAccessToken[]> {
+    return this.request<PersonalAccessToken[]>('/api/tokens');
+  }
+
+  async createAccessToken(name: string, scopes: TokenScope[], expiresInDays?: number): Promise<CreatedPersonalAccessToken> {
+    return this.request<CreatedPersonalAccessToken>('/api/tokens', {
+      method: 'POST',
+      body: JSON.stringify({ name, scopes, expires_in_days: expiresInDays }),
+    });
+  }
+
+  async revokeAccessToken(tokenId: string): Promise<void> {
+    await this.request(`/api/tokens/${tokenId}`, {
+      method: 'DELETE',
+    });
+  }
+
   // Labs
   async createLab(data: CreateLabRequest): Promise<Lab> {
     return this.request<Lab>('/api/labs', {
@@ -228,13 +519,21 @@ class ApiService {
   }
 
   async getLab(labId: string): Promise<LabResponse> {
-    return this.request<LabResponse>(`/api/labs/${labId}`);
+    return this.request<LabResponse>(`/api/labs/${labId}?include=credentials`);
+  }
+
+  async updateLabTags(labId: string, tags: string[]): Promise<LabResponse> {
+    return this.request<LabResponse>(`/api/labs/${labId}/tags`, {
+      method: 'PUT',
+      body: JSON.stringify({ tags }),
+    });
   }
 
   async getLabProgress(labId: string): Promise<{
     lab_id: string;
     overall: number;
     current_step: string;
+    queue_position?: number;
     services: Array<{
       name: string;
       description: string;
@@ -246,20 +545,40 @@ class ApiService {
         message: string;
         started_at?: string;
         completed_at?: string;
+        duration_ms?: number;
         error?: string;
       }>;
       started_at?: string;
       completed_at?: string;
+      duration_ms?: number;
       error?: string;
     }>;
     logs: string[];
+    timing_summary?: string;
     updated_at: string;
   }> {
     return this.request(`/api/labs/${labId}/progress`);
   }
 
-  async getUserLabs(): Promise<LabResponse[]> {
-    return this.request<LabResponse[]>('/api/labs');
+  async getLabCredentials(labId: string, limit = 50, offset = 0): Promise<CredentialPage> {
+    return this.request<CredentialPage>(`/api/labs/${labId}/credentials?limit=${limit}&offset=${offset}`);
+  }
+
+  async getLabDiagnostics(labId: string): Promise<LabDiagnostics> {
+    return this.request<LabDiagnostics>(`/api/labs/${labId}/diagnostics`);
+  }
+
+  async getLabEvents(labId: string): Promise<LabTimeline> {
+    return this.request<LabTimeline>(`/api/labs/${labId}/events`);
+  }
+
+  async getLabCost(labId: string): Promise<LabCostEstimate> {
+    return this.request<LabCostEstimate>(`/api/labs/${labId}/cost`);
+  }
+
+  async getUserLabs(status?: string): Promise<LabResponse[]> {
+    const query = status ? `?status=${encodeURIComponent(status)}` : '';
+    return this.request<LabResponse[]>(`/api/labs${query}`);
   }
 
   async deleteLab(labId: string): Promise<void> {
@@ -274,12 +593,77 @@ class ApiService {
     });
   }
 
+  async resumeLab(labId: string): Promise<Lab> {
+    return this.request<Lab>(`/api/labs/${labId}/resume`, {
+      method: 'POST',
+    });
+  }
+
+  async heartbeatLab(labId: string): Promise<LabActivity> {
+    return this.request<LabActivity>(`/api/labs/${labId}/heartbeat`, {
+      method: 'POST',
+    });
+  }
+
+  async retryLabProvisioning(labId: string): Promise<Lab> {
+    return this.request<Lab>(`/api/labs/${labId}/retry`, {
+      method: 'POST',
+    });
+  }
+
+  async revealLabCredential(labId: string, credentialId: string): Promise<RevealedCredential> {
+    return this.request<RevealedCredential>(`/api/labs/${labId}/credentials/${credentialId}/reveal`, {
+      method: 'POST',
+    });
+  }
+
+  async rotateLabCredential(labId: string, credentialId: string): Promise<Credential> {
+    return this.request<Credential>(`/api/labs/${labId}/credentials/${credentialId}/rotate`, {
+      method: 'POST',
+    });
+  }
+
+  async getSharedLabs(): Promise<LabResponse[]> {
+    return this.request<LabResponse[]>('/api/labs/shared');
+  }
+
+  async getLabShares(labId: string): Promise<LabShare[]> {
+    return this.request<LabShare[]>(`/api/labs/${labId}/shares`);
+  }
+
+  async shareLab(labId: string, data: { user_id?: string; email?: string }): Promise<LabShare> {
+    return this.request<LabShare>(`/api/labs/${labId}/shares`, {
+      method: 'POST',
+      body: JSON.stringify(data),
+    });
+  }
+
+  async unshareLab(labId: string, userId: string): Promise<void> {
+    await this.request(`/api/labs/${labId}/shares/${userId}`, {
+      method: 'DELETE',
+    });
+  }
+
   async adminStopLab(labId: string): Promise<void> {
     await this.request(`/api/admin/labs/${labId}/stop`, {
       method: 'POST',
     });
   }
 
+  // Opens the live lab dashboard WebSocket. The first event is a snapshot of every lab.
+  subscribeLabEvents(onEvent: (event: LabEvent) => void): WebSocket {
+    const url = new URL('/api/admin/labs/ws', API_BASE_URL);
+    url.protocol = url.protocol === 'https:' ? 'wss:' : 'ws:';
+    const token = this.getToken();
+    if (token) {
+      url.searchParams.set('token', token);
+    }
+
+    const socket = new WebSocket(url.toString());
+    socket.onmessage = (message) => onEvent(JSON.parse(message.data) as LabEvent);
+    return socket;
+  }
+
   async adminDeleteLab(labId: string): Promise<void> {
     await this.request(`/api/admin/labs/${labId}`, {
       method: 'DELETE',
@@ -292,6 +676,26 @@ class ApiService {
     });
   }
 
+  async getLabCleanupState(labId: string): Promise<LabCleanupState> {
+    return this.request<LabCleanupState>(`/api/admin/labs/${labId}/cleanup`);
+  }
+
+  async retryLabCleanup(labId: string): Promise<LabCleanupState> {
+    return this.request<LabCleanupState>(`/api/admin/labs/${labId}/cleanup/retry`, {
+      method: 'POST',
+    });
+  }
+
+  async getLabRegistrationTokens(labId: string): Promise<{ lab_id: string; tokens: LabRegistrationToken[] }> {
+    return this.request(`/api/admin/labs/${labId}/registration-tokens`);
+  }
+
+  async revokeLabRegistrationToken(labId: string, tokenId: string): Promise<void> {
+    await this.request(`/api/admin/labs/${labId}/registration-tokens/${encodeURIComponent(tokenId)}`, {
+      method: 'DELETE',
+    });
+  }
+
   async cleanupFailedLab(labId: string): Promise<void> {
     await this.request(`/api/labs/${labId}/cleanup`, {
       method: 'POST',
@@ -299,17 +703,34 @@ class ApiService {
   }
 
   // Template management
-  async getTemplates(): Promise<LabTemplate[]> {
-    return this.request<LabTemplate[]>('/api/templates');
+  async getTemplates(filter: TemplateFilter = {}): Promise<LabTemplate[]> {
+    const params = new URLSearchParams();
+    if (filter.category) params.set('category', filter.category);
+    if (filter.tag) params.set('tag', filter.tag);
+    if (filter.q) params.set('q', filter.q);
+    const query = params.toString();
+    return this.request<LabTemplate[]>(`/api/templates${query ? `?${query}` : ''}`);
+  }
+
+  async getTemplateFacets(): Promise<TemplateFacets> {
+    return this.request<TemplateFacets>('/api/templates/facets');
   }
 
   async getTemplate(templateId: string): Promise<LabTemplate> {
     return this.request<LabTemplate>(`/api/templates/${templateId}`);
   }
 
-  async createLabFromTemplate(templateId: string): Promise<Lab> {
+  async createLabFromTemplate(templateId: string, options: {
+    name?: string;
+    duration?: number;
+    variables?: Record<string, string>;
+    start_at?: string;
+    notify?: LabNotification;
+    tags?: string[];
+  } = {}): Promise<Lab> {
     return this.request<Lab>(`/api/templates/${templateId}/labs`, {
       method: 'POST',
+      body: JSON.stringify(options),
     });
   }
 
@@ -335,6 +756,10 @@ class ApiService {
   }
 
   // New flexible cleanup API methods
+  async getServiceTypes(): Promise<ServiceTypeDescription[]> {
+    return this.request<ServiceTypeDescription[]>('/api/admin/service-types');
+  }
+
   async getAvailableServices(): Promise<{
     available_services: Array<{
       type: string;
@@ -389,6 +814,8 @@ class ApiService {
     errors: Record<string, string>;
     successful: number;
     failed: number;
+    resources: ResourceCleanupResult[];
+    failed_resources: number;
   }> {
     return this.request('/api/admin/cleanup/lab', {
       method: 'POST',
@@ -416,8 +843,13 @@ class ApiService {
 
 
   // Admin endpoints
-  async getAllLabs(): Promise<LabResponse[]> {
-    return this.request<LabResponse[]>('/api/admin/labs');
+  async getAllLabs(tag?: string): Promise<LabResponse[]> {
+    const query = tag ? `&tag=${encodeURIComponent(tag)}` : '';
+    return this.request<LabResponse[]>(`/api/admin/labs?include=credentials${query}`);
+  }
+
+  async getLabTagCounts(): Promise<Record<string, number>> {
+    return this.request<Record<string, number>>('/api/admin/labs/tags');
   }
 
 
@@ -446,13 +878,19 @@ class ApiService {
     return this.request<ServiceConfig[]>('/api/admin/service-configs');
   }
 
-  async createServiceConfig(config: Omit<ServiceConfig, 'id' | 'created_at' | 'updated_at'>): Promise<ServiceConfig> {
+  async createServiceConfig(config: Omit<ServiceConfig, 'id' | 'version' | 'created_at' | 'updated_at'>): Promise<ServiceConfig> {
     return this.request<ServiceConfig>('/api/admin/service-configs', {
       method: 'POST',
       body: JSON.stringify(config),
     });
   }
 
+  async reloadServiceConfigs(): Promise<ServiceConfigReload> {
+    return this.request<ServiceConfigReload>('/api/admin/service-configs/reload', {
+      method: 'POST',
+    });
+  }
+
   async updateServiceConfig(id: string, config: Partial<ServiceConfig>): Promise<ServiceConfig> {
     return this.request<ServiceConfig>(`/api/admin/service-configs/${id}`, {
       method: 'PUT',
@@ -470,7 +908,7 @@ class ApiService {
     return this.request<ServiceLimit[]>('/api/admin/service-limits');
   }
 
-  async createServiceLimit(limit: Omit<ServiceLimit, 'id' | 'created_at' | 'updated_at'>): Promise<ServiceLimit> {
+  async createServiceLimit(limit: Omit<ServiceLimit, 'id' | 'version' | 'created_at' | 'updated_at'>): Promise<ServiceLimit> {
     return this.request<ServiceLimit>('/api/admin/service-limits', {
       method: 'POST',
       body: JSON.stringify(limit),
@@ -499,6 +937,12 @@ class ApiService {
     return this.request<User>('/api/auth/me');
   }
 
+  async logout(): Promise<{ message: string }> {
+    return this.request<{ message: string }>('/api/auth/logout', {
+      method: 'POST',
+    });
+  }
+
   // Health check
   async healthCheck(): Promise<{ status: string; message: string }> {
     return this.request<{ status: string; message: string }>('/health');
@@ -516,13 +960,28 @@ class ApiService {
     });
   }
 
-  async createInvite(organizationId: string, data: { email: string; role: string }): Promise<Invite> {
+  async setOrganizationDomainAutoJoin(organizationId: string, enabled: boolean): Promise<Organization> {
+    return this.request<Organization>(`/api/admin/organizations/${organizationId}/auto-join`, {
+      method: 'PUT',
+      body: JSON.stringify({ enabled }),
+    });
+  }
+
+  async createInvite(organizationId: string, data: { email: string; role: string; usage_limit?: number; lab_template_id?: string }): Promise<Invite> {
     return this.request<Invite>(`/api/admin/organizations/${organizationId}/invites`, {
       method: 'POST',
       body: JSON.stringify(data),
     });
   }
 
+  // Renew an invite's expiry, optionally giving it a new ID and emailing the link
+  async renewInvite(inviteId: string, options: { new_id?: boolean; send_email?: boolean } = {}): Promise<RenewInviteResponse> {
+    return this.request<RenewInviteResponse>(`/api/admin/invites/${inviteId}/renew`, {
+      method: 'POST',
+      body: JSON.stringify(options),
+    });
+  }
+
   // Get user's organization
   async getUserOrganization(): Promise<Organization | null> {
     try {
@@ -534,9 +993,39 @@ class ApiService {
     }
   }
 
-  // Get all users (admin only)
+  // List users, filtered and paginated (admin only)
+  async getUsers(params: {
+    role?: UserRole;
+    org_id?: string;
+    q?: string;
+    page?: number;
+    page_size?: number;
+  } = {}): Promise<UserPage> {
+    const query = new URLSearchParams();
+    Object.entries(params).forEach(([key, value]) => {
+      if (value !== undefined && value !== '') {
+        query.set(key, String(value));
+      }
+    });
+    const suffix = query.toString() ? `?${query.toString()}` : '';
+    return this.request<UserPage>(`/api/admin/users${suffix}`);
+  }
+
+  // Get all users (admin only), fetching every page
+  async getInactiveUsers(days?: number): Promise<InactiveUsers> {
+    const query = days ? `?days=${days}` : '';
+    return this.request<InactiveUsers>(`/api/admin/users/inactive${query}`);
+  }
+
   async getAllUsers(): Promise<UserWithOrganization[]> {
-    return this.request<UserWithOrganization[]>('/api/admin/users');
+    const users: UserWithOrganization[] = [];
+    for (let page = 1; ; page++) {
+      const result = await this.getUsers({ page, page_size: 200 });
+      users.push(...result.users);
+      if (users.length >= result.total || result.users.length === 0) {
+        return users;
+      }
+    }
   }
 }
 
@@ -56,6 +56,10 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
   };
 
   const logout = () => {
+    // Revoke the session server-side; the local token is dropped either way
+    apiService.logout().catch((error) => {
+      console.error('Failed to revoke session:', error);
+    });
     apiService.clearToken();
     setUser(null);
   };
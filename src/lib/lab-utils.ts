@@ -12,14 +12,20 @@ export function convertLabResponse(labResponse: LabResponse): LabSession {
     startedAt: labResponse.started_at,
     endsAt: labResponse.ends_at,
     owner: labResponse.owner || { name: "Unknown", email: "unknown" },
-    credentials: labResponse.credentials.map(cred => ({
+    credentials: (labResponse.credentials ?? []).map(cred => ({
       id: cred.id,
       label: cred.label,
       username: cred.username,
       password: cred.password,
       url: cred.url,
       expiresAt: cred.expires_at,
+      expiresBeforeLab: cred.expires_before_lab,
       notes: cred.notes,
+      credentialType: cred.credential_type,
+      publicKey: cred.public_key,
+      privateKey: cred.private_key,
+      oneTimeReveal: cred.one_time_reveal,
+      revealedAt: cred.revealed_at,
     })),
     usedServices: labResponse.used_services,
   };
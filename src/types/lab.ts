@@ -7,13 +7,19 @@ export type Credential = {
   password: string;
   url?: string;
   expiresAt: string;
+  expiresBeforeLab?: boolean;
   notes?: string;
+  credentialType?: "password" | "ssh_key";
+  publicKey?: string;
+  privateKey?: string;
+  oneTimeReveal?: boolean; // Password and private key are masked until revealed once
+  revealedAt?: string;
 };
 
 export type LabSession = {
   id: string;
   name: string;
-  status: "provisioning" | "ready" | "error" | "expired" | "starting";
+  status: "provisioning" | "queued" | "ready" | "stopped" | "error" | "expired" | "starting";
   startedAt?: string;
   endsAt?: string;
   owner: { name: string; email: string };
@@ -35,6 +41,8 @@ export function getLabBadgeVariant(status: LabStatus) {
     case 'ready':
       return 'default' as const;
     case 'provisioning':
+    case 'queued':
+    case 'stopped':
     case 'starting':
       return 'secondary' as const;
     case 'error':